@@ -52,6 +52,18 @@ func main() {
 
 	cm := capture.NewCaptureManager(l, tel)
 
+	if os.Getenv(captureConstants.CaptureCleanupEnvKey) == "true" {
+		l.Info("Start to remove capture artifacts")
+		err := cm.RemoveOutput(context.Background())
+		writeResult(l, cm.Result("", err))
+		if err != nil {
+			l.Error("Failed to remove capture artifacts", zap.Error(err))
+			os.Exit(1)
+		}
+		l.Info("Done for removing capture artifacts")
+		return
+	}
+
 	defer func() {
 		if err := cm.Cleanup(); err != nil {
 			l.Error("Failed to cleanup network capture", zap.Error(err))
@@ -60,6 +72,7 @@ func main() {
 	srcDir, err := cm.CaptureNetwork(captureCtx)
 	if err != nil {
 		l.Error("Failed to capture network traffic", zap.Error(err))
+		writeResult(l, cm.Result(srcDir, err))
 		os.Exit(1)
 	}
 
@@ -68,6 +81,16 @@ func main() {
 	outputCtx := context.Background()
 	if err := cm.OutputCapture(outputCtx, srcDir); err != nil {
 		l.Error("Failed to output network traffic", zap.Error(err))
+		writeResult(l, cm.Result(srcDir, err))
+		return
 	}
+	writeResult(l, cm.Result(srcDir, nil))
 	l.Info("Done for capturing network traffic")
 }
+
+// writeResult reports the result of the capture through the termination message of the container.
+func writeResult(l *log.ZapLogger, result *capture.Result) {
+	if err := capture.WriteResult(captureConstants.CaptureTerminationMessagePath, result); err != nil {
+		l.Warn("Failed to write capture result", zap.Error(err))
+	}
+}
@@ -151,6 +151,7 @@ func NewCommand(kubeClient kubernetes.Interface) *cobra.Command {
 
 	capture.AddCommand(NewCreateSubCommand(kubeClient))
 	capture.AddCommand(NewDeleteSubCommand(kubeClient))
+	capture.AddCommand(NewDescribeSubCommand())
 	capture.AddCommand(NewDownloadSubCommand())
 	capture.AddCommand(NewListSubCommand())
 
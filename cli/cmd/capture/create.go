@@ -7,6 +7,7 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"os"
 	"os/signal"
 	"strings"
 	"syscall"
@@ -180,7 +181,7 @@ func create(kubeClient kubernetes.Interface) error {
 	// let the customer recycle them.
 	retinacmd.Logger.Info("Waiting for capture jobs to finish")
 
-	allJobsCompleted := waitUntilJobsComplete(ctx, kubeClient, jobsCreated)
+	allJobsCompleted := waitUntilJobsComplete(ctx, kubeClient, capture.Name, jobsCreated)
 
 	// Delete all jobs created only if they all completed, otherwise keep the jobs for debugging.
 	if allJobsCompleted {
@@ -736,7 +737,7 @@ func createJobs(ctx context.Context, kubeClient kubernetes.Interface, capture *r
 	return jobsCreated, nil
 }
 
-func waitUntilJobsComplete(ctx context.Context, kubeClient kubernetes.Interface, jobs []batchv1.Job) bool {
+func waitUntilJobsComplete(ctx context.Context, kubeClient kubernetes.Interface, captureName string, jobs []batchv1.Job) bool {
 	allJobsCompleted := false
 
 	// TODO: let's make the timeout and period to wait for all job to finish configurable.
@@ -750,11 +751,17 @@ func waitUntilJobsComplete(ctx context.Context, kubeClient kubernetes.Interface,
 		}
 	}
 
+	progress := newProgressTable(os.Stdout)
+
 	period := DefaultWaitPeriod
 	// To print less noisy messages, we rely on duration to decide the wait period.
 	if period < opts.duration/10 {
 		period = opts.duration / 10
 	}
+	// The progress table is redrawn in place on a terminal, so it can be refreshed often.
+	if progress.redraw {
+		period = DefaultProgressRefreshPeriod
+	}
 	// Ensure poll period is less than the deadline so we get multiple checks.
 	if period >= deadline {
 		period = deadline / MinPollAttempts
@@ -767,14 +774,17 @@ func waitUntilJobsComplete(ctx context.Context, kubeClient kubernetes.Interface,
 	wait.JitterUntil(func() {
 		jobsCompleted := []string{}
 		jobsIncompleted := []string{}
+		jobsLatest := make([]batchv1.Job, 0, len(jobs))
 
 		for _, job := range jobs {
 			jobRet, err := kubeClient.BatchV1().Jobs(job.Namespace).Get(ctx, job.Name, metav1.GetOptions{})
 			if err != nil {
 				retinacmd.Logger.Error("Failed to get job", zap.String("namespace", job.Namespace), zap.String("job name", job.Name), zap.Error(err))
 				jobsIncompleted = append(jobsIncompleted, job.Name)
+				jobsLatest = append(jobsLatest, job)
 				continue
 			}
+			jobsLatest = append(jobsLatest, *jobRet)
 			if jobRet.Status.CompletionTime != nil {
 				jobsCompleted = append(jobsCompleted, job.Name)
 			} else {
@@ -782,12 +792,20 @@ func waitUntilJobsComplete(ctx context.Context, kubeClient kubernetes.Interface,
 			}
 		}
 
+		if statuses, err := getCaptureNodeStatuses(ctx, kubeClient, captureName, *opts.Namespace, jobsLatest); err != nil {
+			retinacmd.Logger.Warn("Failed to get capture progress", zap.Error(err))
+		} else {
+			progress.Render(statuses, opts.duration, time.Now())
+		}
+
 		if len(jobsIncompleted) != 0 {
-			retinacmd.Logger.Info("Not all jobs are completed",
-				zap.String("namespace", *opts.Namespace),
-				zap.String("Completed jobs", strings.Join(jobsCompleted, ",")),
-				zap.String("Uncompleted packet capture jobs", strings.Join(jobsIncompleted, ",")),
-			)
+			if !progress.redraw {
+				retinacmd.Logger.Info("Not all jobs are completed",
+					zap.String("namespace", *opts.Namespace),
+					zap.String("Completed jobs", strings.Join(jobsCompleted, ",")),
+					zap.String("Uncompleted packet capture jobs", strings.Join(jobsIncompleted, ",")),
+				)
+			}
 			// Return to have another try after an interval.
 			return
 		}
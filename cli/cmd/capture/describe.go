@@ -0,0 +1,265 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package capture
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	durationUtil "k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/kubectl/pkg/util/i18n"
+	"k8s.io/kubectl/pkg/util/templates"
+	"k8s.io/kubectl/pkg/util/term"
+
+	retinav1alpha1 "github.com/microsoft/retina/crd/api/v1alpha1"
+	pkgcapture "github.com/microsoft/retina/pkg/capture"
+	captureConstants "github.com/microsoft/retina/pkg/capture/constants"
+	captureUtils "github.com/microsoft/retina/pkg/capture/utils"
+)
+
+// DefaultProgressRefreshPeriod is how often the per-node progress table is refreshed on a terminal.
+const DefaultProgressRefreshPeriod = 5 * time.Second
+
+var errCaptureNotFound = errors.New("capture not found")
+
+var describeWatch bool
+
+var describeExample = templates.Examples(i18n.T(`
+		# Show the status of Retina Capture "retina-capture" on each node, and its result on the nodes where it finished
+		kubectl retina capture describe --name retina-capture
+
+		# Keep refreshing the table until the capture finishes on all nodes
+		kubectl retina capture describe --name retina-capture --watch
+	`))
+
+func NewDescribeSubCommand() *cobra.Command {
+	describeCapture := &cobra.Command{
+		Use:     "describe",
+		Short:   "Show the status of a Retina Capture on each node, and its result once finished",
+		Example: describeExample,
+		RunE: func(*cobra.Command, []string) error {
+			kubeConfig, err := opts.ToRESTConfig()
+			if err != nil {
+				return errors.Wrap(err, "failed to compose k8s rest config")
+			}
+
+			kubeClient, err := kubernetes.NewForConfig(kubeConfig)
+			if err != nil {
+				return errors.Wrap(err, "failed to initialize kubernetes client")
+			}
+
+			captureNamespace := *opts.Namespace
+			if captureNamespace == "" {
+				captureNamespace, _, err = opts.ToRawKubeConfigLoader().Namespace()
+				if err != nil {
+					return errors.Wrap(err, "failed to get namespace from kubeconfig")
+				}
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+			defer cancel()
+
+			return describeCaptureNodes(ctx, kubeClient, newProgressTable(os.Stdout), *opts.Name, captureNamespace, describeWatch)
+		},
+	}
+
+	describeCapture.Flags().BoolVarP(&describeWatch, "watch", "w", false, "Keep refreshing the table until the capture finishes on all nodes")
+	return describeCapture
+}
+
+// describeCaptureNodes prints the per-node status of the Capture, and keeps refreshing it until the capture finishes
+// on all nodes when watch is set.
+func describeCaptureNodes(ctx context.Context, kubeClient kubernetes.Interface, table *progressTable, name, namespace string, watch bool) error {
+	for {
+		jobList, err := kubeClient.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: labels.SelectorFromSet(captureUtils.GetJobLabelsFromCaptureName(name)).String(),
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to list capture jobs")
+		}
+		if len(jobList.Items) == 0 {
+			return errors.Wrapf(errCaptureNotFound, "no jobs of capture %s/%s", namespace, name)
+		}
+
+		statuses, err := getCaptureNodeStatuses(ctx, kubeClient, name, namespace, jobList.Items)
+		if err != nil {
+			return err
+		}
+		table.Render(statuses, jobCaptureDuration(&jobList.Items[0]), time.Now())
+
+		if !watch || captureNodesFinished(statuses) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(DefaultProgressRefreshPeriod):
+		}
+	}
+}
+
+// getCaptureNodeStatuses derives the per-node status of the Capture from its jobs and pods.
+func getCaptureNodeStatuses(ctx context.Context, kubeClient kubernetes.Interface, name, namespace string, jobs []batchv1.Job) ([]retinav1alpha1.CaptureNodeStatus, error) {
+	podList, err := kubeClient.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(captureUtils.GetContainerLabelsFromCaptureName(name)).String(),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list capture pods")
+	}
+	return pkgcapture.NodeStatusesFromJobs(jobs, podList.Items), nil
+}
+
+// jobCaptureDuration returns the capture duration configured for the job, or zero if it is not limited by time.
+func jobCaptureDuration(job *batchv1.Job) time.Duration {
+	for _, container := range job.Spec.Template.Spec.Containers {
+		for _, env := range container.Env {
+			if env.Name != captureConstants.CaptureDurationEnvKey {
+				continue
+			}
+			if d, err := time.ParseDuration(env.Value); err == nil {
+				return d
+			}
+		}
+	}
+	return 0
+}
+
+func captureNodesFinished(statuses []retinav1alpha1.CaptureNodeStatus) bool {
+	for i := range statuses {
+		if !nodeFinished(&statuses[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func nodeFinished(status *retinav1alpha1.CaptureNodeStatus) bool {
+	return status.Phase == retinav1alpha1.CaptureNodeSucceeded || status.Phase == retinav1alpha1.CaptureNodeFailed
+}
+
+// progressTable prints the per-node status of a capture. On a terminal the previous table is redrawn in place,
+// otherwise a new table is printed only when the status of a node changes.
+type progressTable struct {
+	out    io.Writer
+	redraw bool
+
+	lines   int
+	lastKey string
+}
+
+func newProgressTable(out io.Writer) *progressTable {
+	return &progressTable{
+		out:    out,
+		redraw: term.TTY{Out: out}.IsTerminalOut(),
+	}
+}
+
+func (p *progressTable) Render(statuses []retinav1alpha1.CaptureNodeStatus, duration time.Duration, now time.Time) {
+	if !p.redraw {
+		key := nodeStatusesKey(statuses)
+		if key == p.lastKey {
+			return
+		}
+		p.lastKey = key
+	}
+
+	var buf bytes.Buffer
+	writeNodeStatusTable(&buf, statuses, duration, now)
+
+	if p.redraw && p.lines > 0 {
+		// Move the cursor to the start of the previous table and clear it.
+		fmt.Fprintf(p.out, "\x1b[%dA\x1b[J", p.lines)
+	}
+	p.lines = bytes.Count(buf.Bytes(), []byte("\n"))
+	p.out.Write(buf.Bytes()) //nolint:errcheck // best effort output
+}
+
+// nodeStatusesKey identifies the status of all nodes, ignoring the elapsed time of running captures.
+func nodeStatusesKey(statuses []retinav1alpha1.CaptureNodeStatus) string {
+	var b strings.Builder
+	for i := range statuses {
+		s := &statuses[i]
+		fmt.Fprintf(&b, "%s/%s/%d/%s;", s.NodeName, s.Phase, s.BytesCaptured, s.Error)
+	}
+	return b.String()
+}
+
+func writeNodeStatusTable(out io.Writer, statuses []retinav1alpha1.CaptureNodeStatus, duration time.Duration, now time.Time) {
+	w := tabwriter.NewWriter(out, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, "NODE\tJOB\tPHASE\tPROGRESS\tSIZE\tPACKETS\tDROPPED BY KERNEL\tRESULT")
+
+	finished := 0
+	var totalBytes int64
+	for i := range statuses {
+		s := &statuses[i]
+		size, packets, dropped := "-", "-", "-"
+		if nodeFinished(s) {
+			finished++
+			totalBytes += s.BytesCaptured
+			size = formatBytes(s.BytesCaptured)
+			packets = fmt.Sprint(s.PacketsCaptured)
+			dropped = fmt.Sprint(s.PacketsDroppedByKernel)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			s.NodeName, s.JobName, s.Phase, nodeProgress(s, duration, now), size, packets, dropped, nodeResult(s))
+	}
+	w.Flush()
+	fmt.Fprintf(out, "\n%d/%d nodes finished, %s captured\n", finished, len(statuses), formatBytes(totalBytes))
+}
+
+// nodeProgress shows how long the capture has been running against the configured duration, or how long it took once
+// it has finished.
+func nodeProgress(s *retinav1alpha1.CaptureNodeStatus, duration time.Duration, now time.Time) string {
+	if s.StartTime == nil {
+		return "-"
+	}
+	if nodeFinished(s) {
+		if s.CompletionTime == nil {
+			return "-"
+		}
+		return durationUtil.HumanDuration(s.CompletionTime.Sub(s.StartTime.Time))
+	}
+	elapsed := durationUtil.HumanDuration(now.Sub(s.StartTime.Time))
+	if duration == 0 {
+		return elapsed
+	}
+	return elapsed + "/" + durationUtil.HumanDuration(duration)
+}
+
+func nodeResult(s *retinav1alpha1.CaptureNodeStatus) string {
+	if s.Error != "" {
+		return s.Error
+	}
+	if len(s.ArtifactLocations) != 0 {
+		return strings.Join(s.ArtifactLocations, ",")
+	}
+	return "-"
+}
+
+func formatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%dB", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,86 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package capture
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	retinav1alpha1 "github.com/microsoft/retina/crd/api/v1alpha1"
+	captureConstants "github.com/microsoft/retina/pkg/capture/constants"
+	captureUtils "github.com/microsoft/retina/pkg/capture/utils"
+)
+
+func TestDescribeCaptureNodes(t *testing.T) {
+	start := metav1.NewTime(time.Now().Add(-30 * time.Second))
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-capture-x1", Namespace: "default", Labels: captureUtils.GetJobLabelsFromCaptureName("test-capture")},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name: captureConstants.CaptureContainername,
+						Env: []corev1.EnvVar{
+							{Name: captureConstants.NodeHostNameEnvKey, Value: "node1"},
+							{Name: captureConstants.CaptureDurationEnvKey, Value: "1m0s"},
+						},
+					}},
+				},
+			},
+		},
+	}
+	labels := captureUtils.GetContainerLabelsFromCaptureName("test-capture")
+	labels[batchv1.JobNameLabel] = job.Name
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-capture-x1-abcde", Namespace: "default", Labels: labels},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning, StartTime: &start},
+	}
+	kubeClient := fake.NewSimpleClientset(job, pod)
+
+	var out bytes.Buffer
+	require.NoError(t, describeCaptureNodes(context.Background(), kubeClient, newProgressTable(&out), "test-capture", "default", false))
+	assert.Contains(t, out.String(), "node1")
+	assert.Contains(t, out.String(), string(retinav1alpha1.CaptureNodeRunning))
+	assert.Contains(t, out.String(), "/60s")
+	assert.Contains(t, out.String(), "0/1 nodes finished")
+
+	err := describeCaptureNodes(context.Background(), kubeClient, newProgressTable(&out), "missing", "default", false)
+	require.ErrorIs(t, err, errCaptureNotFound)
+}
+
+func TestProgressTableRender(t *testing.T) {
+	start := metav1.NewTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	done := metav1.NewTime(start.Add(time.Minute))
+	statuses := []retinav1alpha1.CaptureNodeStatus{{
+		NodeName:               "node1",
+		Phase:                  retinav1alpha1.CaptureNodeSucceeded,
+		StartTime:              &start,
+		CompletionTime:         &done,
+		BytesCaptured:          3 * 1024 * 1024,
+		PacketsCaptured:        100,
+		PacketsDroppedByKernel: 4,
+		ArtifactLocations:      []string{"HostPath/node1.tar.gz"},
+	}}
+
+	var out bytes.Buffer
+	table := newProgressTable(&out)
+	table.Render(statuses, time.Minute, done.Time)
+	assert.Contains(t, out.String(), "3.0MiB")
+	assert.Contains(t, out.String(), "HostPath/node1.tar.gz")
+	assert.Contains(t, out.String(), "1/1 nodes finished, 3.0MiB captured")
+
+	// Output that is not a terminal only gets a new table when the status changes.
+	printed := out.Len()
+	table.Render(statuses, time.Minute, done.Add(time.Minute))
+	assert.Equal(t, printed, out.Len())
+}
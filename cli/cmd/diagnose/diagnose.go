@@ -0,0 +1,496 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package diagnose
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	retinacmd "github.com/microsoft/retina/cli/cmd"
+	retinav1alpha1 "github.com/microsoft/retina/crd/api/v1alpha1"
+	"github.com/microsoft/retina/internal/buildinfo"
+	pkgcapture "github.com/microsoft/retina/pkg/capture"
+	captureUtils "github.com/microsoft/retina/pkg/capture/utils"
+	"github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/shell"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/kubectl/pkg/util/i18n"
+	"k8s.io/kubectl/pkg/util/templates"
+)
+
+const (
+	DefaultDuration       = 15 * time.Second
+	DefaultStartupTimeout = 30 * time.Second
+	DefaultImageRepo      = "mcr.microsoft.com/containernetworking/retina-shell"
+
+	// maxNodes bounds the number of nodes traced, since a Service can have many backends.
+	maxNodes = 4
+
+	// captureDeadlineBufferSeconds is added to the capture duration for the job's activeDeadlineSeconds.
+	captureDeadlineBufferSeconds int64 = 600
+)
+
+var (
+	errInvalidOutputFormat = errors.New("invalid output format: must be 'text' or 'json'")
+	errInvalidDuration     = errors.New("--duration must be positive")
+	errMissingImageVersion = errors.New("missing required --retina-shell-image-version")
+	errNoCaptureAddresses  = errors.New("both endpoints need an IP address to filter the capture")
+)
+
+// Opts are the options of the diagnose command.
+type Opts struct {
+	configFlags *genericclioptions.ConfigFlags
+
+	duration          time.Duration
+	startupTimeout    time.Duration
+	output            string
+	skipTrace         bool
+	skipMetrics       bool
+	capture           bool
+	retinaNamespace   string
+	retinaPodSelector string
+	retinaMetricsPort string
+	imageRepo         string
+	imageVersion      string
+}
+
+var diagnoseExample = templates.Examples(i18n.T(`
+		# Diagnose connectivity from a pod to a Service in the current namespace
+		kubectl retina diagnose pod/frontend-7d9f8 svc/backend:8080
+
+		# Diagnose connectivity between pods in different namespaces
+		kubectl retina diagnose pod/web/frontend-7d9f8 pod/data/postgres-0:5432
+
+		# Diagnose connectivity from a pod to an external IP, observing for 30 seconds
+		kubectl retina diagnose pod/frontend-7d9f8 203.0.113.10:443 --duration 30s
+
+		# Also start a packet capture between the endpoints
+		kubectl retina diagnose pod/frontend-7d9f8 svc/backend --capture
+
+		# Output the report as JSON
+		kubectl retina diagnose 10.244.1.15 10.244.2.20:80 -o json
+	`))
+
+// NewCommand returns the diagnose command.
+func NewCommand() *cobra.Command {
+	opts := &Opts{}
+
+	diagnose := &cobra.Command{
+		Use:   "diagnose SOURCE DESTINATION",
+		Short: "[EXPERIMENTAL] Troubleshoot connectivity between two endpoints",
+		Long: templates.LongDesc(`
+	[EXPERIMENTAL] This is an experimental command. The flags and behavior may change in the future.
+
+	Run a guided investigation of connectivity between a source and a destination and
+	print a single report that points at the likely culprit.
+
+	SOURCE and DESTINATION are one of:
+	* pod/[NAMESPACE/]NAME[:PORT]
+	* svc/[NAMESPACE/]NAME[:PORT]
+	* IP[:PORT]
+
+	The investigation:
+	* resolves the path: pod state, nodes and Service backends
+	* compares Retina drop, retransmit and DNS metrics for the endpoints before and after the observation window
+	* runs bpftrace on the nodes involved, filtered to the pair of endpoints
+	* optionally starts a packet capture between the endpoints (--capture)
+
+	Pod-level metrics require advanced metrics to be enabled with a MetricsConfiguration.
+`),
+		Example: diagnoseExample,
+		Args:    cobra.ExactArgs(2), //nolint:gomnd // source and destination
+		PersistentPreRun: func(cmd *cobra.Command, _ []string) {
+			cmd.SilenceUsage = true
+			cmd.SilenceErrors = true
+
+			// Allow setting image repo and version via environment variables (CLI flags still take precedence).
+			if !cmd.Flags().Changed("retina-shell-image-repo") {
+				if envRepo := os.Getenv("RETINA_SHELL_IMAGE_REPO"); envRepo != "" {
+					opts.imageRepo = envRepo
+				}
+			}
+			if !cmd.Flags().Changed("retina-shell-image-version") {
+				if envVersion := os.Getenv("RETINA_SHELL_IMAGE_VERSION"); envVersion != "" {
+					opts.imageVersion = envVersion
+				}
+			}
+		},
+		RunE: func(_ *cobra.Command, args []string) error {
+			return opts.run(args[0], args[1])
+		},
+	}
+
+	diagnose.Flags().DurationVar(&opts.duration, "duration", DefaultDuration, "How long to observe metrics and trace the endpoints")
+	diagnose.Flags().DurationVar(&opts.startupTimeout, "startup-timeout", DefaultStartupTimeout, "Timeout for starting the trace pods")
+	diagnose.Flags().StringVarP(&opts.output, "output", "o", "text", "Output format: 'text' or 'json'")
+	diagnose.Flags().BoolVar(&opts.skipTrace, "skip-trace", false, "Do not run bpftrace on the nodes")
+	diagnose.Flags().BoolVar(&opts.skipMetrics, "skip-metrics", false, "Do not check Retina metrics")
+	diagnose.Flags().BoolVar(&opts.capture, "capture", false, "Start a packet capture between the endpoints for the observation window")
+	diagnose.Flags().StringVar(&opts.retinaNamespace, "retina-namespace", DefaultRetinaNamespace, "Namespace of the Retina agent pods")
+	diagnose.Flags().StringVar(&opts.retinaPodSelector, "retina-pod-selector", DefaultRetinaPodSelector, "Label selector of the Retina agent pods")
+	diagnose.Flags().StringVar(&opts.retinaMetricsPort, "retina-metrics-port", DefaultRetinaMetricsPort, "Metrics port of the Retina agent pods")
+	diagnose.Flags().StringVar(&opts.imageRepo, "retina-shell-image-repo", DefaultImageRepo, "The container registry repository for the retina-shell image")
+	diagnose.Flags().StringVar(&opts.imageVersion, "retina-shell-image-version", buildinfo.Version, "The version (tag) of the retina-shell image")
+
+	opts.configFlags = genericclioptions.NewConfigFlags(true)
+	opts.configFlags.AddFlags(diagnose.PersistentFlags())
+
+	return diagnose
+}
+
+func (o *Opts) validate() error {
+	if o.output != "text" && o.output != "json" {
+		return fmt.Errorf("%w: got %q", errInvalidOutputFormat, o.output)
+	}
+	if o.duration <= 0 {
+		return errInvalidDuration
+	}
+	if !o.skipTrace && o.imageVersion == "" {
+		return errMissingImageVersion
+	}
+	return nil
+}
+
+func (o *Opts) run(srcArg, dstArg string) error {
+	if err := o.validate(); err != nil {
+		return err
+	}
+
+	namespace, _, err := o.configFlags.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return fmt.Errorf("error retrieving namespace arg: %w", err)
+	}
+
+	src, err := ParseEndpoint(srcArg, namespace)
+	if err != nil {
+		return fmt.Errorf("invalid source: %w", err)
+	}
+	dst, err := ParseEndpoint(dstArg, namespace)
+	if err != nil {
+		return fmt.Errorf("invalid destination: %w", err)
+	}
+
+	restConfig, err := o.configFlags.ToRESTConfig()
+	if err != nil {
+		return fmt.Errorf("error constructing REST config: %w", err)
+	}
+	kubeClient, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return fmt.Errorf("error constructing kube clientset: %w", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	report, err := o.diagnose(ctx, kubeClient, restConfig, namespace, src, dst)
+	if err != nil {
+		return err
+	}
+
+	if o.output == "json" {
+		return report.WriteJSON(os.Stdout)
+	}
+	report.WriteText(os.Stdout)
+	return nil
+}
+
+// diagnose runs the investigation and returns the analyzed report.
+func (o *Opts) diagnose(
+	ctx context.Context,
+	kubeClient kubernetes.Interface,
+	restConfig *rest.Config,
+	namespace string,
+	src, dst *Endpoint,
+) (*Report, error) {
+	for _, ep := range []*Endpoint{src, dst} {
+		if err := ep.Resolve(ctx, kubeClient); err != nil {
+			return nil, err
+		}
+	}
+
+	report := NewReport(src, dst, o.duration)
+	report.Nodes = pathNodes(src, dst)
+	retinacmd.Logger.Info("Resolved path", zap.String("source", src.String()), zap.String("destination", dst.String()), zap.Strings("nodes", report.Nodes))
+
+	if len(report.Nodes) == 0 {
+		report.Skip("metrics and trace: neither endpoint runs on a cluster node")
+		report.Analyze()
+		return report, nil
+	}
+
+	var scraper *agentScraper
+	before := map[string]MetricFamilies{}
+	if o.skipMetrics {
+		report.Skip("metrics: disabled with --skip-metrics")
+	} else {
+		scraper = newAgentScraper(kubeClient, o.retinaNamespace, o.retinaPodSelector, o.retinaMetricsPort)
+		if err := scraper.discover(ctx); err != nil {
+			report.Skip("metrics: %v", err)
+			scraper = nil
+		} else {
+			before = o.scrapeAll(ctx, scraper, report)
+		}
+	}
+
+	if o.capture {
+		name, err := startCapture(ctx, kubeClient, namespace, report.Nodes, src.IPs(), dst.IPs(), o.duration)
+		if err != nil {
+			report.Skip("capture: %v", err)
+		} else {
+			report.CaptureName = name
+		}
+	}
+
+	// The trace runs during the observation window for the metrics. Traces can fail early,
+	// so the window is waited out before the second scrape either way.
+	windowEnd := time.Now().Add(o.duration)
+	if o.skipTrace {
+		report.Skip("trace: disabled with --skip-trace")
+	} else {
+		report.Trace = o.traceAll(ctx, restConfig, namespace, report, src, dst)
+	}
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("diagnose interrupted: %w", ctx.Err())
+	case <-time.After(time.Until(windowEnd)):
+	}
+
+	if scraper != nil {
+		after := o.scrapeAll(ctx, scraper, report)
+		o.collectSignals(report, before, after)
+	}
+
+	report.Analyze()
+	return report, nil
+}
+
+// scrapeAll scrapes the Retina agent of every node on the path. Nodes that fail are recorded as skipped.
+func (o *Opts) scrapeAll(ctx context.Context, scraper *agentScraper, report *Report) map[string]MetricFamilies {
+	var mu sync.Mutex
+	result := map[string]MetricFamilies{}
+
+	var wg sync.WaitGroup
+	for _, node := range report.Nodes {
+		wg.Add(1)
+		go func(node string) {
+			defer wg.Done()
+			families, err := scraper.scrape(ctx, node)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				report.Skip("metrics on node %s: %v", node, err)
+				return
+			}
+			result[node] = families
+		}(node)
+	}
+	wg.Wait()
+	return result
+}
+
+// collectSignals computes the metric increases between the two scrapes.
+func (o *Opts) collectSignals(report *Report, before, after map[string]MetricFamilies) {
+	advanced := false
+	srcSignals, dstSignals := newSignals(), newSignals()
+
+	for node, a := range after {
+		b, ok := before[node]
+		if !ok {
+			continue
+		}
+		advanced = advanced || a.HasAdvancedMetrics()
+		report.NodeSignals[node] = a.NodeSignals().Sub(b.NodeSignals())
+		srcSignals.add(a.EndpointSignals(report.Source).Sub(b.EndpointSignals(report.Source)))
+		dstSignals.add(a.EndpointSignals(report.Destination).Sub(b.EndpointSignals(report.Destination)))
+		for i := range report.Destination.Backends {
+			backend := backendEndpoint(report.Destination.Backends[i])
+			dstSignals.add(a.EndpointSignals(backend).Sub(b.EndpointSignals(backend)))
+		}
+	}
+
+	if !advanced {
+		report.Skip("pod-level metrics: advanced metrics are not enabled, only node-level drops were checked")
+		return
+	}
+	report.SourceSignals = &srcSignals
+	report.DestinationSignals = &dstSignals
+}
+
+// traceAll runs bpftrace on every node on the path for the observation window.
+func (o *Opts) traceAll(ctx context.Context, restConfig *rest.Config, namespace string, report *Report, src, dst *Endpoint) *TraceSummary {
+	filterIPs := []net.IP{}
+	for _, ip := range append(src.IPs(), dst.IPs()...) {
+		parsed := net.ParseIP(ip)
+		if parsed == nil || parsed.To4() == nil {
+			report.Skip("trace: IPv6 address %s is not supported by bpftrace filters", ip)
+			return nil
+		}
+		filterIPs = append(filterIPs, parsed)
+	}
+
+	var mu sync.Mutex
+	events := []TraceEvent{}
+
+	g, gctx := errgroup.WithContext(ctx)
+	for _, node := range report.Nodes {
+		g.Go(func() error {
+			var stdout, stderr bytes.Buffer
+			traceConfig := shell.TraceConfig{
+				RestConfig:        restConfig,
+				RetinaShellImage:  fmt.Sprintf("%s:%s", o.imageRepo, o.imageVersion),
+				FilterIPs:         filterIPs,
+				OutputJSON:        true,
+				EnableDrops:       true,
+				EnableRST:         true,
+				EnableErrors:      true,
+				EnableRetransmits: true,
+				TraceDuration:     o.duration,
+				Timeout:           o.startupTimeout,
+				Stdout:            &stdout,
+				Stderr:            &stderr,
+			}
+
+			traceCtx, cancel := context.WithTimeout(gctx, o.duration+o.startupTimeout)
+			defer cancel()
+
+			retinacmd.Logger.Info("Tracing node", zap.String("node", node), zap.Duration("duration", o.duration))
+			err := shell.RunTrace(traceCtx, traceConfig, node, namespace)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				report.Skip("trace on node %s: %v", node, err)
+				return nil
+			}
+			events = append(events, ParseTraceOutput(node, &stdout, src.IPs(), dst.IPs())...)
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	return Summarize(events)
+}
+
+// startCapture creates capture jobs on the nodes, filtered to traffic between the endpoints.
+func startCapture(ctx context.Context, kubeClient kubernetes.Interface, namespace string, nodes, srcIPs, dstIPs []string, duration time.Duration) (string, error) {
+	if hostClause(srcIPs) == "" || hostClause(dstIPs) == "" {
+		return "", errNoCaptureAddresses
+	}
+
+	name := "retina-diagnose-" + utilrand.String(5) //nolint:gomnd // random suffix length
+	hostPath := name
+	filter := pairPcapFilter(srcIPs, dstIPs)
+
+	capture := &retinav1alpha1.Capture{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: retinav1alpha1.CaptureSpec{
+			CaptureConfiguration: retinav1alpha1.CaptureConfiguration{
+				IncludeMetadata: true,
+				CaptureTarget: retinav1alpha1.CaptureTarget{
+					NodeSelector: &metav1.LabelSelector{
+						MatchExpressions: []metav1.LabelSelectorRequirement{{
+							Key:      corev1.LabelHostname,
+							Operator: metav1.LabelSelectorOpIn,
+							Values:   nodes,
+						}},
+					},
+				},
+				CaptureOption: retinav1alpha1.CaptureOption{
+					Duration:   &metav1.Duration{Duration: duration},
+					PcapFilter: &filter,
+				},
+			},
+			OutputConfiguration: retinav1alpha1.OutputConfiguration{
+				HostPath: &hostPath,
+			},
+		},
+	}
+
+	translator := pkgcapture.NewCaptureToPodTranslator(kubeClient, retinacmd.Logger, config.CaptureConfig{
+		CaptureImageVersion:       buildinfo.Version,
+		CaptureImageVersionSource: captureUtils.VersionSourceCLIVersion,
+		CaptureHostPathBaseDir:    pkgcapture.DefaultHostPathBaseDir,
+	})
+	jobs, err := translator.TranslateCaptureToJobs(ctx, capture)
+	if err != nil {
+		return "", fmt.Errorf("failed to translate capture: %w", err)
+	}
+
+	deadline := int64(duration.Seconds()) + captureDeadlineBufferSeconds
+	for _, job := range jobs {
+		job.Spec.ActiveDeadlineSeconds = &deadline
+		if _, err := kubeClient.BatchV1().Jobs(namespace).Create(ctx, job, metav1.CreateOptions{}); err != nil {
+			return "", fmt.Errorf("failed to create capture job: %w", err)
+		}
+	}
+	retinacmd.Logger.Info("Packet capture started", zap.String("namespace", namespace), zap.String("capture", name))
+	return name, nil
+}
+
+// pairPcapFilter returns a BPF filter matching packets between any source and any destination address.
+// The addresses come from the API server and are validated as IPs before use.
+func pairPcapFilter(srcIPs, dstIPs []string) string {
+	return fmt.Sprintf("(%s) and (%s)", hostClause(srcIPs), hostClause(dstIPs))
+}
+
+func hostClause(ips []string) string {
+	clause := ""
+	for _, ip := range ips {
+		if net.ParseIP(ip) == nil {
+			continue
+		}
+		if clause != "" {
+			clause += " or "
+		}
+		clause += "host " + ip
+	}
+	return clause
+}
+
+// pathNodes returns the nodes hosting either endpoint, bounded by maxNodes.
+func pathNodes(src, dst *Endpoint) []string {
+	seen := map[string]struct{}{}
+	nodes := []string{}
+	for _, n := range append(src.Nodes(), dst.Nodes()...) {
+		if _, ok := seen[n]; ok {
+			continue
+		}
+		seen[n] = struct{}{}
+		nodes = append(nodes, n)
+		if len(nodes) == maxNodes {
+			break
+		}
+	}
+	return nodes
+}
+
+func backendEndpoint(b Backend) *Endpoint {
+	return &Endpoint{
+		Kind:      EndpointKindPod,
+		Namespace: b.Namespace,
+		Name:      b.Name,
+		IP:        b.IP,
+		NodeName:  b.NodeName,
+		InCluster: true,
+	}
+}
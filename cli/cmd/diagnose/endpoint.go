@@ -0,0 +1,308 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package diagnose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	ErrInvalidEndpoint     = errors.New("invalid endpoint")
+	ErrUnsupportedEndpoint = errors.New("unsupported endpoint type")
+)
+
+// EndpointKind is the kind of a diagnose endpoint.
+type EndpointKind string
+
+const (
+	EndpointKindPod     EndpointKind = "pod"
+	EndpointKindService EndpointKind = "service"
+	EndpointKindIP      EndpointKind = "ip"
+)
+
+// Backend is a pod that serves traffic for a Service endpoint.
+type Backend struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	IP        string `json:"ip"`
+	NodeName  string `json:"nodeName"`
+	Ready     bool   `json:"ready"`
+}
+
+// Endpoint is one side of the connection being diagnosed, resolved against the cluster.
+type Endpoint struct {
+	// Raw is the endpoint as given on the command line.
+	Raw       string       `json:"raw"`
+	Kind      EndpointKind `json:"kind"`
+	Namespace string       `json:"namespace,omitempty"`
+	Name      string       `json:"name,omitempty"`
+	IP        string       `json:"ip,omitempty"`
+	Port      int32        `json:"port,omitempty"`
+
+	// Pod details, set when the endpoint is (or resolves to) a pod.
+	NodeName string `json:"nodeName,omitempty"`
+	PodPhase string `json:"podPhase,omitempty"`
+	PodReady bool   `json:"podReady,omitempty"`
+
+	// Service details, set when the endpoint is a Service.
+	Backends []Backend `json:"backends,omitempty"`
+
+	// InCluster is false when an IP endpoint did not match any pod or Service.
+	InCluster bool `json:"inCluster"`
+}
+
+// ParseEndpoint parses an endpoint of the form pod/[NAMESPACE/]NAME[:PORT],
+// svc/[NAMESPACE/]NAME[:PORT] or IP[:PORT]. Namespace defaults to defaultNamespace.
+func ParseEndpoint(raw, defaultNamespace string) (*Endpoint, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, fmt.Errorf("%w: empty endpoint", ErrInvalidEndpoint)
+	}
+
+	ep := &Endpoint{Raw: raw}
+
+	kind, rest, hasKind := strings.Cut(raw, "/")
+	if !hasKind {
+		// Not TYPE/NAME, so this must be an IP or IP:PORT.
+		host, port, err := splitHostPort(raw)
+		if err != nil {
+			return nil, err
+		}
+		if net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("%w: %q is not a valid IP address", ErrInvalidEndpoint, host)
+		}
+		ep.Kind = EndpointKindIP
+		ep.IP = host
+		ep.Port = port
+		return ep, nil
+	}
+
+	switch strings.ToLower(kind) {
+	case "pod", "pods", "po":
+		ep.Kind = EndpointKindPod
+	case "svc", "service", "services":
+		ep.Kind = EndpointKindService
+	default:
+		return nil, fmt.Errorf("%w: %q (valid: pod, svc)", ErrUnsupportedEndpoint, kind)
+	}
+
+	name, port, err := splitHostPort(rest)
+	if err != nil {
+		return nil, err
+	}
+	ep.Port = port
+
+	ep.Namespace = defaultNamespace
+	if ns, n, ok := strings.Cut(name, "/"); ok {
+		ep.Namespace = ns
+		name = n
+	}
+	if ep.Namespace == "" || name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidEndpoint, raw)
+	}
+	ep.Name = name
+
+	return ep, nil
+}
+
+// splitHostPort splits an optional :PORT suffix off s. Bracketed IPv6 literals are supported.
+func splitHostPort(s string) (string, int32, error) {
+	if ip := net.ParseIP(s); ip != nil {
+		return s, 0, nil
+	}
+	if !strings.Contains(s, ":") {
+		return s, 0, nil
+	}
+	host, portStr, err := net.SplitHostPort(s)
+	if err != nil {
+		return "", 0, fmt.Errorf("%w: %q: %w", ErrInvalidEndpoint, s, err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil || port == 0 {
+		return "", 0, fmt.Errorf("%w: invalid port %q", ErrInvalidEndpoint, portStr)
+	}
+	return host, int32(port), nil
+}
+
+// Resolve fills in IPs, nodes and backends for the endpoint from the cluster.
+func (ep *Endpoint) Resolve(ctx context.Context, kubeClient kubernetes.Interface) error {
+	switch ep.Kind {
+	case EndpointKindPod:
+		pod, err := kubeClient.CoreV1().Pods(ep.Namespace).Get(ctx, ep.Name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get pod %s/%s: %w", ep.Namespace, ep.Name, err)
+		}
+		ep.setPod(pod)
+		return nil
+	case EndpointKindService:
+		svc, err := kubeClient.CoreV1().Services(ep.Namespace).Get(ctx, ep.Name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get service %s/%s: %w", ep.Namespace, ep.Name, err)
+		}
+		return ep.setService(ctx, kubeClient, svc)
+	case EndpointKindIP:
+		return ep.resolveIP(ctx, kubeClient)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedEndpoint, ep.Kind)
+	}
+}
+
+func (ep *Endpoint) setPod(pod *corev1.Pod) {
+	ep.Kind = EndpointKindPod
+	ep.Namespace = pod.Namespace
+	ep.Name = pod.Name
+	ep.IP = pod.Status.PodIP
+	ep.NodeName = pod.Spec.NodeName
+	ep.PodPhase = string(pod.Status.Phase)
+	ep.PodReady = isPodReady(pod)
+	ep.InCluster = true
+}
+
+func (ep *Endpoint) setService(ctx context.Context, kubeClient kubernetes.Interface, svc *corev1.Service) error {
+	ep.Kind = EndpointKindService
+	ep.Namespace = svc.Namespace
+	ep.Name = svc.Name
+	ep.IP = svc.Spec.ClusterIP
+	ep.InCluster = true
+	if ep.Port == 0 && len(svc.Spec.Ports) == 1 {
+		ep.Port = svc.Spec.Ports[0].Port
+	}
+
+	slices, err := kubeClient.DiscoveryV1().EndpointSlices(svc.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: discoveryv1.LabelServiceName + "=" + svc.Name,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list endpointslices for service %s/%s: %w", svc.Namespace, svc.Name, err)
+	}
+
+	for i := range slices.Items {
+		for _, e := range slices.Items[i].Endpoints {
+			if len(e.Addresses) == 0 {
+				continue
+			}
+			b := Backend{
+				IP:    e.Addresses[0],
+				Ready: e.Conditions.Ready == nil || *e.Conditions.Ready,
+			}
+			if e.NodeName != nil {
+				b.NodeName = *e.NodeName
+			}
+			if e.TargetRef != nil && e.TargetRef.Kind == "Pod" {
+				b.Namespace = e.TargetRef.Namespace
+				b.Name = e.TargetRef.Name
+			}
+			ep.Backends = append(ep.Backends, b)
+		}
+	}
+	sort.SliceStable(ep.Backends, func(i, j int) bool {
+		return ep.Backends[i].IP < ep.Backends[j].IP
+	})
+	return nil
+}
+
+// resolveIP looks for a pod, then a Service, owning the IP. IPs outside the cluster are left unresolved.
+func (ep *Endpoint) resolveIP(ctx context.Context, kubeClient kubernetes.Interface) error {
+	pods, err := kubeClient.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("status.podIP", ep.IP).String(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to look up pod with IP %s: %w", ep.IP, err)
+	}
+	for i := range pods.Items {
+		// Skip host network pods, which share the node IP.
+		if pods.Items[i].Status.PodIP != ep.IP || pods.Items[i].Spec.HostNetwork {
+			continue
+		}
+		ep.setPod(&pods.Items[i])
+		return nil
+	}
+
+	svcs, err := kubeClient.CoreV1().Services(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to look up service with IP %s: %w", ep.IP, err)
+	}
+	for i := range svcs.Items {
+		for _, clusterIP := range svcs.Items[i].Spec.ClusterIPs {
+			if clusterIP == ep.IP {
+				ip := ep.IP
+				if err := ep.setService(ctx, kubeClient, &svcs.Items[i]); err != nil {
+					return err
+				}
+				// Keep the requested address family for dual-stack services.
+				ep.IP = ip
+				return nil
+			}
+		}
+	}
+
+	return nil
+}
+
+// String returns a human readable identifier of the endpoint.
+func (ep *Endpoint) String() string {
+	var s string
+	switch {
+	case ep.Kind == EndpointKindService:
+		s = fmt.Sprintf("svc/%s/%s", ep.Namespace, ep.Name)
+	case ep.Kind == EndpointKindPod:
+		s = fmt.Sprintf("pod/%s/%s", ep.Namespace, ep.Name)
+	default:
+		s = ep.IP
+	}
+	if ep.Port != 0 {
+		s = fmt.Sprintf("%s:%d", s, ep.Port)
+	}
+	return s
+}
+
+// IPs returns every address the endpoint's traffic can carry, including Service backends after DNAT.
+func (ep *Endpoint) IPs() []string {
+	ips := []string{}
+	if ep.IP != "" {
+		ips = append(ips, ep.IP)
+	}
+	for _, b := range ep.Backends {
+		ips = append(ips, b.IP)
+	}
+	return ips
+}
+
+// Nodes returns the nodes hosting the endpoint or its backends.
+func (ep *Endpoint) Nodes() []string {
+	seen := map[string]struct{}{}
+	nodes := []string{}
+	add := func(n string) {
+		if _, ok := seen[n]; n == "" || ok {
+			return
+		}
+		seen[n] = struct{}{}
+		nodes = append(nodes, n)
+	}
+	add(ep.NodeName)
+	for _, b := range ep.Backends {
+		add(b.NodeName)
+	}
+	return nodes
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package diagnose
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    *Endpoint
+		wantErr bool
+	}{
+		{
+			name:  "pod in default namespace",
+			input: "pod/web-0",
+			want:  &Endpoint{Raw: "pod/web-0", Kind: EndpointKindPod, Namespace: "default", Name: "web-0"},
+		},
+		{
+			name:  "pod with namespace and port",
+			input: "po/data/postgres-0:5432",
+			want:  &Endpoint{Raw: "po/data/postgres-0:5432", Kind: EndpointKindPod, Namespace: "data", Name: "postgres-0", Port: 5432},
+		},
+		{
+			name:  "service",
+			input: "svc/backend:8080",
+			want:  &Endpoint{Raw: "svc/backend:8080", Kind: EndpointKindService, Namespace: "default", Name: "backend", Port: 8080},
+		},
+		{
+			name:  "IPv4 with port",
+			input: "10.0.0.1:443",
+			want:  &Endpoint{Raw: "10.0.0.1:443", Kind: EndpointKindIP, IP: "10.0.0.1", Port: 443},
+		},
+		{
+			name:  "IPv6 without port",
+			input: "fd00::1",
+			want:  &Endpoint{Raw: "fd00::1", Kind: EndpointKindIP, IP: "fd00::1"},
+		},
+		{
+			name:  "IPv6 with port",
+			input: "[fd00::1]:53",
+			want:  &Endpoint{Raw: "[fd00::1]:53", Kind: EndpointKindIP, IP: "fd00::1", Port: 53},
+		},
+		{name: "empty", input: "", wantErr: true},
+		{name: "hostname", input: "example.com", wantErr: true},
+		{name: "unsupported kind", input: "deploy/web", wantErr: true},
+		{name: "invalid port", input: "pod/web-0:http", wantErr: true},
+		{name: "port out of range", input: "10.0.0.1:70000", wantErr: true},
+		{name: "too many segments", input: "pod/a/b/c", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEndpoint(tt.input, "default")
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestResolveEndpoints(t *testing.T) {
+	ready := true
+	notReady := false
+	node1, node2 := "node1", "node2"
+
+	client := fake.NewSimpleClientset(
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "client", Namespace: "web"},
+			Spec:       corev1.PodSpec{NodeName: node1},
+			Status: corev1.PodStatus{
+				Phase:      corev1.PodRunning,
+				PodIP:      "10.0.1.10",
+				Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+			},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "backend", Namespace: "web"},
+			Spec: corev1.ServiceSpec{
+				ClusterIP:  "10.96.0.20",
+				ClusterIPs: []string{"10.96.0.20"},
+				Ports:      []corev1.ServicePort{{Port: 8080}},
+			},
+		},
+		&discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "backend-abcde",
+				Namespace: "web",
+				Labels:    map[string]string{discoveryv1.LabelServiceName: "backend"},
+			},
+			Endpoints: []discoveryv1.Endpoint{
+				{
+					Addresses:  []string{"10.0.2.21"},
+					Conditions: discoveryv1.EndpointConditions{Ready: &notReady},
+					NodeName:   &node2,
+					TargetRef:  &corev1.ObjectReference{Kind: "Pod", Namespace: "web", Name: "backend-1"},
+				},
+				{
+					Addresses:  []string{"10.0.2.20"},
+					Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+					NodeName:   &node2,
+					TargetRef:  &corev1.ObjectReference{Kind: "Pod", Namespace: "web", Name: "backend-0"},
+				},
+			},
+		},
+	)
+	ctx := context.Background()
+
+	t.Run("pod", func(t *testing.T) {
+		ep, err := ParseEndpoint("pod/web/client", "default")
+		require.NoError(t, err)
+		require.NoError(t, ep.Resolve(ctx, client))
+		assert.Equal(t, "10.0.1.10", ep.IP)
+		assert.Equal(t, node1, ep.NodeName)
+		assert.True(t, ep.PodReady)
+		assert.Equal(t, []string{node1}, ep.Nodes())
+	})
+
+	t.Run("service", func(t *testing.T) {
+		ep, err := ParseEndpoint("svc/web/backend", "default")
+		require.NoError(t, err)
+		require.NoError(t, ep.Resolve(ctx, client))
+		assert.Equal(t, int32(8080), ep.Port)
+		require.Len(t, ep.Backends, 2)
+		assert.Equal(t, "backend-0", ep.Backends[0].Name)
+		assert.True(t, ep.Backends[0].Ready)
+		assert.False(t, ep.Backends[1].Ready)
+		assert.Equal(t, []string{"10.96.0.20", "10.0.2.20", "10.0.2.21"}, ep.IPs())
+		assert.Equal(t, []string{node2}, ep.Nodes())
+	})
+
+	t.Run("IP of a pod", func(t *testing.T) {
+		ep, err := ParseEndpoint("10.0.1.10:80", "default")
+		require.NoError(t, err)
+		require.NoError(t, ep.Resolve(ctx, client))
+		assert.Equal(t, EndpointKindPod, ep.Kind)
+		assert.Equal(t, "pod/web/client:80", ep.String())
+	})
+
+	t.Run("IP of a service", func(t *testing.T) {
+		ep, err := ParseEndpoint("10.96.0.20", "default")
+		require.NoError(t, err)
+		require.NoError(t, ep.Resolve(ctx, client))
+		assert.Equal(t, EndpointKindService, ep.Kind)
+		assert.Equal(t, "svc/web/backend:8080", ep.String())
+	})
+
+	t.Run("external IP", func(t *testing.T) {
+		ep, err := ParseEndpoint("203.0.113.10:443", "default")
+		require.NoError(t, err)
+		require.NoError(t, ep.Resolve(ctx, client))
+		assert.False(t, ep.InCluster)
+		assert.Empty(t, ep.Nodes())
+	})
+
+	t.Run("missing pod", func(t *testing.T) {
+		ep, err := ParseEndpoint("pod/web/missing", "default")
+		require.NoError(t, err)
+		require.Error(t, ep.Resolve(ctx, client))
+	})
+}
@@ -0,0 +1,273 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package diagnose
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/microsoft/retina/pkg/exporter"
+	"github.com/microsoft/retina/pkg/utils"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	DefaultRetinaNamespace   = "kube-system"
+	DefaultRetinaPodSelector = "k8s-app=retina"
+	DefaultRetinaMetricsPort = "10093"
+
+	// returnCodeLabel is the DNS response code label of the DNS response metrics.
+	returnCodeLabel = "return_code"
+	dnsNoError      = "NOERROR"
+)
+
+var (
+	// Basic (node-level) metrics.
+	nodeDropCountMetric = exporter.RetinaNamespace + "_" + utils.DroppedPacketsGaugeName
+
+	// Advanced (pod-level) metrics.
+	advDropCountMetric   = exporter.RetinaNamespace + "_adv_drop_count"
+	advRetransMetric     = exporter.RetinaNamespace + "_adv_tcpretrans_count"
+	advDNSResponseMetric = exporter.RetinaNamespace + "_adv_" + utils.DNSResponseCounterName
+
+	// Labels that may carry an endpoint IP, depending on the metric context (local or remote).
+	ipLabels = []string{"ip", "source_ip", "destination_ip"}
+
+	// Namespace and pod label pairs, depending on the metric context (local or remote).
+	podLabels = [][2]string{
+		{"namespace", "podname"},
+		{"source_namespace", "source_podname"},
+		{"destination_namespace", "destination_podname"},
+	}
+
+	ErrNoRetinaAgent = errors.New("no retina agent found on node")
+)
+
+// MetricFamilies are the metric families scraped from one Retina agent, keyed by metric name.
+type MetricFamilies map[string]*dto.MetricFamily
+
+// Signals summarizes the Retina counters relevant to one endpoint or node.
+type Signals struct {
+	// Drops is the number of dropped packets by drop reason.
+	Drops map[string]float64 `json:"drops,omitempty"`
+	// Retransmits is the number of TCP retransmissions.
+	Retransmits float64 `json:"retransmits,omitempty"`
+	// DNSFailures is the number of failed DNS responses by return code.
+	DNSFailures map[string]float64 `json:"dnsFailures,omitempty"`
+}
+
+func newSignals() Signals {
+	return Signals{
+		Drops:       map[string]float64{},
+		DNSFailures: map[string]float64{},
+	}
+}
+
+// TotalDrops returns the number of drops across all reasons.
+func (s Signals) TotalDrops() float64 {
+	return sum(s.Drops)
+}
+
+// TotalDNSFailures returns the number of DNS failures across all return codes.
+func (s Signals) TotalDNSFailures() float64 {
+	return sum(s.DNSFailures)
+}
+
+// Sub returns the increase of every counter from before to s. Counter resets are treated as zero.
+func (s Signals) Sub(before Signals) Signals {
+	d := newSignals()
+	for k, v := range s.Drops {
+		if delta := v - before.Drops[k]; delta > 0 {
+			d.Drops[k] = delta
+		}
+	}
+	for k, v := range s.DNSFailures {
+		if delta := v - before.DNSFailures[k]; delta > 0 {
+			d.DNSFailures[k] = delta
+		}
+	}
+	if delta := s.Retransmits - before.Retransmits; delta > 0 {
+		d.Retransmits = delta
+	}
+	return d
+}
+
+func (s *Signals) add(o Signals) {
+	s.Retransmits += o.Retransmits
+	for k, v := range o.Drops {
+		s.Drops[k] += v
+	}
+	for k, v := range o.DNSFailures {
+		s.DNSFailures[k] += v
+	}
+}
+
+// ParseMetrics parses Prometheus text exposition format.
+func ParseMetrics(r io.Reader) (MetricFamilies, error) {
+	parser := expfmt.NewTextParser(model.LegacyValidation)
+	families, err := parser.TextToMetricFamilies(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse metrics: %w", err)
+	}
+	return families, nil
+}
+
+// EndpointSignals sums the advanced metric series that reference the endpoint by IP or by pod.
+func (m MetricFamilies) EndpointSignals(ep *Endpoint) Signals {
+	s := newSignals()
+	if ep == nil {
+		return s
+	}
+
+	matches := func(metric *dto.Metric) bool {
+		labels := labelMap(metric)
+		for _, l := range ipLabels {
+			if ip, ok := labels[l]; ok && ip != "" && ip == ep.IP {
+				return true
+			}
+		}
+		if ep.Kind != EndpointKindPod {
+			return false
+		}
+		for _, pair := range podLabels {
+			if labels[pair[0]] == ep.Namespace && labels[pair[1]] == ep.Name {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, metric := range m.metrics(advDropCountMetric) {
+		if matches(metric) {
+			s.Drops[labelMap(metric)[utils.Reason]] += value(metric)
+		}
+	}
+	for _, metric := range m.metrics(advRetransMetric) {
+		if matches(metric) {
+			s.Retransmits += value(metric)
+		}
+	}
+	for _, metric := range m.metrics(advDNSResponseMetric) {
+		rcode := labelMap(metric)[returnCodeLabel]
+		if rcode == dnsNoError || rcode == "" || !matches(metric) {
+			continue
+		}
+		s.DNSFailures[rcode] += value(metric)
+	}
+	return s
+}
+
+// NodeSignals sums the basic (node-level) metrics.
+func (m MetricFamilies) NodeSignals() Signals {
+	s := newSignals()
+	for _, metric := range m.metrics(nodeDropCountMetric) {
+		s.Drops[labelMap(metric)[utils.Reason]] += value(metric)
+	}
+	return s
+}
+
+// HasAdvancedMetrics reports whether the agent exports any pod-level metrics used by diagnose.
+func (m MetricFamilies) HasAdvancedMetrics() bool {
+	for _, name := range []string{advDropCountMetric, advRetransMetric, advDNSResponseMetric} {
+		if _, ok := m[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (m MetricFamilies) metrics(name string) []*dto.Metric {
+	mf, ok := m[name]
+	if !ok {
+		return nil
+	}
+	return mf.GetMetric()
+}
+
+func labelMap(metric *dto.Metric) map[string]string {
+	labels := make(map[string]string, len(metric.GetLabel()))
+	for _, l := range metric.GetLabel() {
+		labels[l.GetName()] = l.GetValue()
+	}
+	return labels
+}
+
+func value(metric *dto.Metric) float64 {
+	switch {
+	case metric.GetCounter() != nil:
+		return metric.GetCounter().GetValue()
+	case metric.GetGauge() != nil:
+		return metric.GetGauge().GetValue()
+	case metric.GetUntyped() != nil:
+		return metric.GetUntyped().GetValue()
+	default:
+		return 0
+	}
+}
+
+func sum(m map[string]float64) float64 {
+	total := 0.0
+	for _, v := range m {
+		total += v
+	}
+	return total
+}
+
+// agentScraper scrapes the Retina agents through the API server pod proxy.
+type agentScraper struct {
+	kubeClient kubernetes.Interface
+	namespace  string
+	selector   string
+	port       string
+
+	// agents maps node name to the Retina agent pod running on it.
+	agents map[string]string
+}
+
+func newAgentScraper(kubeClient kubernetes.Interface, namespace, selector, port string) *agentScraper {
+	return &agentScraper{
+		kubeClient: kubeClient,
+		namespace:  namespace,
+		selector:   selector,
+		port:       port,
+	}
+}
+
+// discover finds the running Retina agent pods by node.
+func (a *agentScraper) discover(ctx context.Context) error {
+	pods, err := a.kubeClient.CoreV1().Pods(a.namespace).List(ctx, metav1.ListOptions{LabelSelector: a.selector})
+	if err != nil {
+		return fmt.Errorf("failed to list retina agents in namespace %s: %w", a.namespace, err)
+	}
+	a.agents = map[string]string{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase != corev1.PodRunning || pod.Spec.NodeName == "" {
+			continue
+		}
+		a.agents[pod.Spec.NodeName] = pod.Name
+	}
+	return nil
+}
+
+// scrape returns the metrics of the Retina agent on the node.
+func (a *agentScraper) scrape(ctx context.Context, nodeName string) (MetricFamilies, error) {
+	podName, ok := a.agents[nodeName]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrNoRetinaAgent, nodeName)
+	}
+	raw, err := a.kubeClient.CoreV1().Pods(a.namespace).ProxyGet("http", podName, a.port, "/metrics", nil).DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scrape retina agent %s/%s: %w", a.namespace, podName, err)
+	}
+	return ParseMetrics(bytes.NewReader(raw))
+}
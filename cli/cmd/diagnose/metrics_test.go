@@ -0,0 +1,74 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package diagnose
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const metricsBefore = `# TYPE networkobservability_drop_count gauge
+networkobservability_drop_count{direction="ingress",reason="IPTABLE_RULE_DROP"} 10
+# TYPE networkobservability_adv_drop_count gauge
+networkobservability_adv_drop_count{direction="ingress",ip="10.0.2.20",namespace="web",podname="backend-0",reason="IPTABLE_RULE_DROP"} 4
+# TYPE networkobservability_adv_tcpretrans_count gauge
+networkobservability_adv_tcpretrans_count{ip="10.0.1.10",namespace="web",podname="client"} 2
+# TYPE networkobservability_adv_dns_response_count counter
+networkobservability_adv_dns_response_count{ip="10.0.1.10",namespace="web",podname="client",num_response="0",query="db.",query_type="A",response="",return_code="NXDOMAIN"} 1
+networkobservability_adv_dns_response_count{ip="10.0.1.10",namespace="web",podname="client",num_response="1",query="web.",query_type="A",response="10.0.0.1",return_code="NOERROR"} 5
+`
+
+const metricsAfter = `# TYPE networkobservability_drop_count gauge
+networkobservability_drop_count{direction="ingress",reason="IPTABLE_RULE_DROP"} 15
+# TYPE networkobservability_adv_drop_count gauge
+networkobservability_adv_drop_count{direction="ingress",ip="10.0.2.20",namespace="web",podname="backend-0",reason="IPTABLE_RULE_DROP"} 9
+# TYPE networkobservability_adv_tcpretrans_count gauge
+networkobservability_adv_tcpretrans_count{ip="10.0.1.10",namespace="web",podname="client"} 2
+# TYPE networkobservability_adv_dns_response_count counter
+networkobservability_adv_dns_response_count{ip="10.0.1.10",namespace="web",podname="client",num_response="0",query="db.",query_type="A",response="",return_code="NXDOMAIN"} 4
+networkobservability_adv_dns_response_count{ip="10.0.1.10",namespace="web",podname="client",num_response="1",query="web.",query_type="A",response="10.0.0.1",return_code="NOERROR"} 9
+`
+
+func TestEndpointSignals(t *testing.T) {
+	before, err := ParseMetrics(strings.NewReader(metricsBefore))
+	require.NoError(t, err)
+	after, err := ParseMetrics(strings.NewReader(metricsAfter))
+	require.NoError(t, err)
+	assert.True(t, after.HasAdvancedMetrics())
+
+	client := &Endpoint{Kind: EndpointKindPod, Namespace: "web", Name: "client", IP: "10.0.1.10"}
+	backend := &Endpoint{Kind: EndpointKindPod, Namespace: "web", Name: "backend-0", IP: "10.0.2.20"}
+
+	clientDelta := after.EndpointSignals(client).Sub(before.EndpointSignals(client))
+	assert.Zero(t, clientDelta.TotalDrops())
+	assert.Zero(t, clientDelta.Retransmits)
+	assert.Equal(t, map[string]float64{"NXDOMAIN": 3}, clientDelta.DNSFailures)
+
+	backendDelta := after.EndpointSignals(backend).Sub(before.EndpointSignals(backend))
+	assert.Equal(t, map[string]float64{"IPTABLE_RULE_DROP": 5}, backendDelta.Drops)
+	assert.Zero(t, backendDelta.TotalDNSFailures())
+
+	nodeDelta := after.NodeSignals().Sub(before.NodeSignals())
+	assert.InDelta(t, 5, nodeDelta.TotalDrops(), 0)
+}
+
+func TestEndpointSignalsRemoteContext(t *testing.T) {
+	families, err := ParseMetrics(strings.NewReader(`# TYPE networkobservability_adv_drop_count gauge
+networkobservability_adv_drop_count{direction="egress",reason="IPTABLE_RULE_DROP",source_ip="10.0.1.10",destination_ip="10.0.2.20"} 3
+`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"IPTABLE_RULE_DROP": 3}, families.EndpointSignals(&Endpoint{Kind: EndpointKindIP, IP: "10.0.2.20"}).Drops)
+	assert.Empty(t, families.EndpointSignals(&Endpoint{Kind: EndpointKindIP, IP: "10.0.3.30"}).Drops)
+}
+
+func TestSignalsSubCounterReset(t *testing.T) {
+	before := Signals{Drops: map[string]float64{"a": 10}, Retransmits: 10}
+	after := Signals{Drops: map[string]float64{"a": 2}, Retransmits: 3}
+	delta := after.Sub(before)
+	assert.Empty(t, delta.Drops)
+	assert.Zero(t, delta.Retransmits)
+}
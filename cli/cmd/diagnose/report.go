@@ -0,0 +1,381 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package diagnose
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Severity ranks how strongly a finding explains a connectivity problem.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityCritical
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityCritical:
+		return "CRITICAL"
+	case SeverityWarning:
+		return "WARNING"
+	default:
+		return "INFO"
+	}
+}
+
+func (s Severity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String()) //nolint:wrapcheck // trivial marshal
+}
+
+// Finding categories.
+const (
+	CategoryPath    = "path"
+	CategoryPolicy  = "policy"
+	CategorySocket  = "socket"
+	CategoryLoss    = "packet-loss"
+	CategoryDNS     = "dns"
+	CategoryGeneral = "general"
+)
+
+// Finding is one observation of the investigation.
+type Finding struct {
+	Severity Severity `json:"severity"`
+	Category string   `json:"category"`
+	Summary  string   `json:"summary"`
+	Evidence string   `json:"evidence,omitempty"`
+}
+
+// Report is the result of a diagnose run.
+type Report struct {
+	Source      *Endpoint `json:"source"`
+	Destination *Endpoint `json:"destination"`
+	Nodes       []string  `json:"nodes"`
+	Window      string    `json:"window"`
+
+	// Metric increases observed during the window.
+	SourceSignals      *Signals           `json:"sourceSignals,omitempty"`
+	DestinationSignals *Signals           `json:"destinationSignals,omitempty"`
+	NodeSignals        map[string]Signals `json:"nodeSignals,omitempty"`
+
+	Trace       *TraceSummary `json:"trace,omitempty"`
+	CaptureName string        `json:"captureName,omitempty"`
+
+	// Skipped lists the checks that could not run and why.
+	Skipped []string `json:"skipped,omitempty"`
+
+	Findings      []Finding `json:"findings"`
+	LikelyCulprit *Finding  `json:"likelyCulprit,omitempty"`
+}
+
+// NewReport creates an empty report for the endpoint pair.
+func NewReport(src, dst *Endpoint, window time.Duration) *Report {
+	return &Report{
+		Source:      src,
+		Destination: dst,
+		Window:      window.String(),
+		NodeSignals: map[string]Signals{},
+	}
+}
+
+// Skip records a check that could not run.
+func (r *Report) Skip(format string, args ...any) {
+	r.Skipped = append(r.Skipped, fmt.Sprintf(format, args...))
+}
+
+func (r *Report) add(sev Severity, category, summary, evidence string) {
+	r.Findings = append(r.Findings, Finding{Severity: sev, Category: category, Summary: summary, Evidence: evidence})
+}
+
+// Analyze turns the collected data into findings and picks the likely culprit.
+// Findings are checked in order of how directly they explain the failure: the
+// resolved path first, then events observed between the pair, then metrics.
+func (r *Report) Analyze() {
+	r.Findings = nil
+	r.LikelyCulprit = nil
+
+	r.analyzePath()
+	r.analyzeTrace()
+	r.analyzeSignals()
+
+	if len(r.Findings) == 0 {
+		r.add(SeverityInfo, CategoryGeneral,
+			"No drops, resets, retransmits or DNS failures were observed between the endpoints",
+			"The problem may be intermittent, outside the observation window, or at the application layer.")
+	}
+
+	sort.SliceStable(r.Findings, func(i, j int) bool {
+		return r.Findings[i].Severity > r.Findings[j].Severity
+	})
+	if r.Findings[0].Severity > SeverityInfo {
+		culprit := r.Findings[0]
+		r.LikelyCulprit = &culprit
+	}
+}
+
+func (r *Report) analyzePath() {
+	for _, ep := range []*Endpoint{r.Source, r.Destination} {
+		if ep == nil {
+			continue
+		}
+		switch {
+		case !ep.InCluster:
+			r.add(SeverityInfo, CategoryPath,
+				fmt.Sprintf("%s is outside the cluster", ep),
+				"Only the in-cluster side of the connection can be inspected.")
+		case ep.Kind == EndpointKindPod && ep.PodPhase != "Running":
+			r.add(SeverityCritical, CategoryPath,
+				fmt.Sprintf("Pod %s is not running", ep),
+				fmt.Sprintf("phase=%s", ep.PodPhase))
+		case ep.Kind == EndpointKindPod && !ep.PodReady && ep == r.Destination:
+			r.add(SeverityCritical, CategoryPath,
+				fmt.Sprintf("Destination pod %s is not ready", ep),
+				"A failing readiness probe removes the pod from Service endpoints.")
+		case ep.Kind == EndpointKindService:
+			r.analyzeBackends(ep)
+		}
+	}
+}
+
+func (r *Report) analyzeBackends(ep *Endpoint) {
+	ready := 0
+	notReady := []string{}
+	for _, b := range ep.Backends {
+		if b.Ready {
+			ready++
+		} else {
+			notReady = append(notReady, b.IP)
+		}
+	}
+	switch {
+	case len(ep.Backends) == 0:
+		r.add(SeverityCritical, CategoryPath,
+			fmt.Sprintf("Service %s has no endpoints", ep),
+			"The Service selector matches no pods, or the pods expose no matching port.")
+	case ready == 0:
+		r.add(SeverityCritical, CategoryPath,
+			fmt.Sprintf("Service %s has no ready endpoints", ep),
+			fmt.Sprintf("not ready: %s", strings.Join(notReady, ", ")))
+	case len(notReady) > 0:
+		r.add(SeverityWarning, CategoryPath,
+			fmt.Sprintf("Service %s has %d of %d endpoints not ready", ep, len(notReady), len(ep.Backends)),
+			fmt.Sprintf("not ready: %s", strings.Join(notReady, ", ")))
+	}
+}
+
+func (r *Report) analyzeTrace() {
+	if r.Trace == nil {
+		return
+	}
+
+	for _, reason := range sortedKeys(r.Trace.DropReasons) {
+		count := r.Trace.DropReasons[reason]
+		evidence := fmt.Sprintf("%d packet(s) dropped by the kernel with reason %s", count, reason)
+		switch {
+		case strings.Contains(reason, "NETFILTER"):
+			r.add(SeverityCritical, CategoryPolicy,
+				"Packets between the endpoints are dropped by a netfilter rule (NetworkPolicy or firewall)", evidence)
+		case strings.Contains(reason, "NO_SOCKET"):
+			r.add(SeverityCritical, CategorySocket,
+				"Nothing is listening on the destination port", evidence)
+		default:
+			r.add(SeverityWarning, CategoryLoss,
+				"Packets between the endpoints are dropped by the kernel", evidence)
+		}
+	}
+
+	if n := r.Trace.Events[TraceEventNfqDrop]; n > 0 {
+		r.add(SeverityCritical, CategoryPolicy,
+			"Packets are sent to an NFQUEUE with no consumer",
+			fmt.Sprintf("%d NFQUEUE drop(s)", n))
+	}
+
+	for _, errno := range sortedKeys(r.Trace.Errnos) {
+		count := r.Trace.Errnos[errno]
+		name := errnoName(errno)
+		evidence := fmt.Sprintf("%d socket error(s) %s", count, name)
+		switch name {
+		case "ECONNREFUSED":
+			r.add(SeverityCritical, CategorySocket, "The destination refused the connection", evidence)
+		case "ETIMEDOUT", "EHOSTUNREACH", "ENETUNREACH":
+			r.add(SeverityCritical, CategoryPath, "The destination is unreachable from the source", evidence)
+		default:
+			r.add(SeverityWarning, CategorySocket, "Connections between the endpoints report socket errors", evidence)
+		}
+	}
+
+	if n := r.Trace.Events[TraceEventRSTSent] + r.Trace.Events[TraceEventRSTRecv]; n > 0 {
+		r.add(SeverityCritical, CategorySocket,
+			"Connections between the endpoints are reset",
+			fmt.Sprintf("%d RST sent, %d RST received", r.Trace.Events[TraceEventRSTSent], r.Trace.Events[TraceEventRSTRecv]))
+	}
+
+	if n := r.Trace.Events[TraceEventRetransmit]; n > 0 {
+		r.add(SeverityWarning, CategoryLoss,
+			"TCP segments between the endpoints are retransmitted (packet loss or congestion)",
+			fmt.Sprintf("%d retransmission(s)", n))
+	}
+}
+
+func (r *Report) analyzeSignals() {
+	for _, side := range []struct {
+		name    string
+		signals *Signals
+	}{
+		{"source", r.SourceSignals},
+		{"destination", r.DestinationSignals},
+	} {
+		if side.signals == nil {
+			continue
+		}
+		s := side.signals
+		for _, reason := range sortedKeys(s.Drops) {
+			evidence := fmt.Sprintf("%.0f packet(s) dropped at the %s with reason %s", s.Drops[reason], side.name, reason)
+			if strings.Contains(reason, "IPTABLE") {
+				r.add(SeverityCritical, CategoryPolicy,
+					fmt.Sprintf("Drop metrics show iptables drops at the %s (NetworkPolicy or firewall)", side.name), evidence)
+			} else {
+				r.add(SeverityWarning, CategoryLoss,
+					fmt.Sprintf("Drop metrics show drops at the %s", side.name), evidence)
+			}
+		}
+		if s.Retransmits > 0 {
+			r.add(SeverityWarning, CategoryLoss,
+				fmt.Sprintf("Retransmit metrics increased at the %s", side.name),
+				fmt.Sprintf("%.0f retransmission(s)", s.Retransmits))
+		}
+		if total := s.TotalDNSFailures(); total > 0 {
+			parts := []string{}
+			for _, rcode := range sortedKeys(s.DNSFailures) {
+				parts = append(parts, fmt.Sprintf("%s=%.0f", rcode, s.DNSFailures[rcode]))
+			}
+			r.add(SeverityWarning, CategoryDNS,
+				fmt.Sprintf("DNS lookups at the %s are failing", side.name),
+				strings.Join(parts, ", "))
+		}
+	}
+
+	for _, node := range sortedKeys(r.NodeSignals) {
+		s := r.NodeSignals[node]
+		if total := s.TotalDrops(); total > 0 {
+			parts := []string{}
+			for _, reason := range sortedKeys(s.Drops) {
+				parts = append(parts, fmt.Sprintf("%s=%.0f", reason, s.Drops[reason]))
+			}
+			r.add(SeverityInfo, CategoryLoss,
+				fmt.Sprintf("Node %s dropped %.0f packet(s) during the window (all traffic)", node, total),
+				strings.Join(parts, ", "))
+		}
+	}
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r) //nolint:wrapcheck // caller reports the error
+}
+
+// WriteText writes a human readable report.
+func (r *Report) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "\nConnectivity diagnosis: %s -> %s\n", r.Source, r.Destination)
+	fmt.Fprintf(w, "Observation window: %s\n\n", r.Window)
+
+	fmt.Fprintln(w, "PATH")
+	tw := tabwriter.NewWriter(w, 0, 8, 3, ' ', 0)
+	for _, side := range []struct {
+		name string
+		ep   *Endpoint
+	}{{"source", r.Source}, {"destination", r.Destination}} {
+		if side.ep == nil {
+			continue
+		}
+		fmt.Fprintf(tw, "  %s\t%s\tip=%s\tnode=%s\n", side.name, side.ep, valueOr(side.ep.IP), valueOr(side.ep.NodeName))
+		for _, b := range side.ep.Backends {
+			fmt.Fprintf(tw, "    backend\t%s/%s\tip=%s\tnode=%s\tready=%t\n", b.Namespace, b.Name, b.IP, valueOr(b.NodeName), b.Ready)
+		}
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+
+	if r.Trace != nil {
+		fmt.Fprintln(w, "TRACE")
+		if len(r.Trace.Events) == 0 {
+			fmt.Fprintln(w, "  no events between the endpoints")
+		}
+		for _, t := range sortedKeys(r.Trace.Events) {
+			fmt.Fprintf(w, "  %-10s %d\n", t, r.Trace.Events[t])
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintln(w, "FINDINGS")
+	for _, f := range r.Findings {
+		fmt.Fprintf(w, "  [%s] %s\n", f.Severity, f.Summary)
+		if f.Evidence != "" {
+			fmt.Fprintf(w, "      %s\n", f.Evidence)
+		}
+	}
+	fmt.Fprintln(w)
+
+	if len(r.Skipped) > 0 {
+		fmt.Fprintln(w, "NOT CHECKED")
+		for _, s := range r.Skipped {
+			fmt.Fprintf(w, "  - %s\n", s)
+		}
+		fmt.Fprintln(w)
+	}
+
+	if r.CaptureName != "" {
+		fmt.Fprintf(w, "Packet capture %q started. Download it with:\n  kubectl retina capture download --name %s\n\n", r.CaptureName, r.CaptureName)
+	}
+
+	if r.LikelyCulprit != nil {
+		fmt.Fprintf(w, "LIKELY CULPRIT: %s\n", r.LikelyCulprit.Summary)
+	} else {
+		fmt.Fprintln(w, "LIKELY CULPRIT: none identified")
+	}
+}
+
+func valueOr(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func errnoName(errno int) string {
+	// Errno values are reported by the kernel, so these are the Linux numbers.
+	switch errno {
+	case 101: //nolint:gomnd // ENETUNREACH
+		return "ENETUNREACH"
+	case 104: //nolint:gomnd // ECONNRESET
+		return "ECONNRESET"
+	case 110: //nolint:gomnd // ETIMEDOUT
+		return "ETIMEDOUT"
+	case 111: //nolint:gomnd // ECONNREFUSED
+		return "ECONNREFUSED"
+	case 113: //nolint:gomnd // EHOSTUNREACH
+		return "EHOSTUNREACH"
+	default:
+		return fmt.Sprintf("errno %d", errno)
+	}
+}
+
+func sortedKeys[K int | string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
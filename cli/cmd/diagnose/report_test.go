@@ -0,0 +1,124 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package diagnose
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runningPod(name, ip string) *Endpoint {
+	return &Endpoint{Kind: EndpointKindPod, Namespace: "web", Name: name, IP: ip, NodeName: "node1", PodPhase: "Running", PodReady: true, InCluster: true}
+}
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		name         string
+		report       func() *Report
+		wantCulprit  string
+		wantCategory string
+	}{
+		{
+			name: "healthy",
+			report: func() *Report {
+				return NewReport(runningPod("a", "10.0.0.1"), runningPod("b", "10.0.0.2"), time.Second)
+			},
+		},
+		{
+			name: "service without endpoints",
+			report: func() *Report {
+				svc := &Endpoint{Kind: EndpointKindService, Namespace: "web", Name: "backend", IP: "10.96.0.1", InCluster: true}
+				r := NewReport(runningPod("a", "10.0.0.1"), svc, time.Second)
+				r.Trace = Summarize([]TraceEvent{{Type: TraceEventRetransmit}})
+				return r
+			},
+			wantCulprit:  "Service svc/web/backend has no endpoints",
+			wantCategory: CategoryPath,
+		},
+		{
+			name: "netfilter drop beats retransmits",
+			report: func() *Report {
+				r := NewReport(runningPod("a", "10.0.0.1"), runningPod("b", "10.0.0.2"), time.Second)
+				r.Trace = Summarize([]TraceEvent{
+					{Type: TraceEventRetransmit},
+					{Type: TraceEventDrop, Reason: "NETFILTER_DROP"},
+				})
+				return r
+			},
+			wantCulprit:  "Packets between the endpoints are dropped by a netfilter rule (NetworkPolicy or firewall)",
+			wantCategory: CategoryPolicy,
+		},
+		{
+			name: "connection refused",
+			report: func() *Report {
+				r := NewReport(runningPod("a", "10.0.0.1"), runningPod("b", "10.0.0.2"), time.Second)
+				r.Trace = Summarize([]TraceEvent{{Type: TraceEventSockErr, Errno: 111}})
+				return r
+			},
+			wantCulprit:  "The destination refused the connection",
+			wantCategory: CategorySocket,
+		},
+		{
+			name: "DNS failures from metrics",
+			report: func() *Report {
+				r := NewReport(runningPod("a", "10.0.0.1"), runningPod("b", "10.0.0.2"), time.Second)
+				r.SourceSignals = &Signals{DNSFailures: map[string]float64{"SERVFAIL": 3}}
+				return r
+			},
+			wantCulprit:  "DNS lookups at the source are failing",
+			wantCategory: CategoryDNS,
+		},
+		{
+			name: "destination not ready",
+			report: func() *Report {
+				dst := runningPod("b", "10.0.0.2")
+				dst.PodReady = false
+				return NewReport(runningPod("a", "10.0.0.1"), dst, time.Second)
+			},
+			wantCulprit:  "Destination pod pod/web/b is not ready",
+			wantCategory: CategoryPath,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.report()
+			r.Analyze()
+			require.NotEmpty(t, r.Findings)
+			if tt.wantCulprit == "" {
+				assert.Nil(t, r.LikelyCulprit)
+				return
+			}
+			require.NotNil(t, r.LikelyCulprit)
+			assert.Equal(t, tt.wantCulprit, r.LikelyCulprit.Summary)
+			assert.Equal(t, tt.wantCategory, r.LikelyCulprit.Category)
+		})
+	}
+}
+
+func TestReportOutput(t *testing.T) {
+	r := NewReport(runningPod("a", "10.0.0.1"), runningPod("b", "10.0.0.2"), 15*time.Second)
+	r.Trace = Summarize([]TraceEvent{{Type: TraceEventRSTRecv}})
+	r.Skip("metrics: %s", "disabled")
+	r.Analyze()
+
+	var text bytes.Buffer
+	r.WriteText(&text)
+	assert.Contains(t, text.String(), "pod/web/a -> pod/web/b")
+	assert.Contains(t, text.String(), "LIKELY CULPRIT: Connections between the endpoints are reset")
+	assert.Contains(t, text.String(), "metrics: disabled")
+
+	var out bytes.Buffer
+	require.NoError(t, r.WriteJSON(&out))
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	culprit, ok := decoded["likelyCulprit"].(map[string]any)
+	require.True(t, ok)
+	assert.Equal(t, "CRITICAL", culprit["severity"])
+}
@@ -0,0 +1,129 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package diagnose
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Trace event types emitted by the bpftrace script in JSON mode.
+const (
+	TraceEventDrop       = "DROP"
+	TraceEventRSTSent    = "RST_SENT"
+	TraceEventRSTRecv    = "RST_RECV"
+	TraceEventSockErr    = "SOCK_ERR"
+	TraceEventRetransmit = "RETRANS"
+	TraceEventNfqDrop    = "NFQ_DROP"
+)
+
+// dropReasonLine matches the "CODE = NAME" lines printed before the trace starts.
+var dropReasonLine = regexp.MustCompile(`^\s*(\d+) = ([A-Z0-9_]+)\s*$`)
+
+// TraceEvent is one event emitted by the bpftrace script.
+type TraceEvent struct {
+	Node       string `json:"node"`
+	Type       string `json:"type"`
+	SrcIP      string `json:"src_ip"`
+	SrcPort    int    `json:"src_port"`
+	DstIP      string `json:"dst_ip"`
+	DstPort    int    `json:"dst_port"`
+	ReasonCode int    `json:"reason_code,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	Errno      int    `json:"errno,omitempty"`
+}
+
+// TraceSummary aggregates the trace events between the source and destination.
+type TraceSummary struct {
+	// Events counts events by type.
+	Events map[string]int `json:"events,omitempty"`
+	// DropReasons counts drop events by kernel drop reason.
+	DropReasons map[string]int `json:"dropReasons,omitempty"`
+	// Errnos counts socket errors by errno.
+	Errnos map[int]int `json:"errnos,omitempty"`
+	// Samples keeps the first few events for the report.
+	Samples []TraceEvent `json:"samples,omitempty"`
+}
+
+const maxTraceSamples = 10
+
+func newTraceSummary() *TraceSummary {
+	return &TraceSummary{
+		Events:      map[string]int{},
+		DropReasons: map[string]int{},
+		Errnos:      map[int]int{},
+	}
+}
+
+// ParseTraceOutput reads bpftrace JSON output from one node and returns the events
+// exchanged between any address in src and any address in dst.
+func ParseTraceOutput(node string, r io.Reader, src, dst []string) []TraceEvent {
+	reasons := map[int]string{}
+	events := []TraceEvent{}
+
+	isSrc := toSet(src)
+	isDst := toSet(dst)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := dropReasonLine.FindStringSubmatch(line); m != nil {
+			if code, err := strconv.Atoi(m[1]); err == nil {
+				reasons[code] = m[2]
+			}
+			continue
+		}
+		if !strings.HasPrefix(strings.TrimSpace(line), "{") {
+			continue
+		}
+		var ev TraceEvent
+		if err := json.Unmarshal([]byte(line), &ev); err != nil || ev.Type == "" {
+			continue
+		}
+		forward := isSrc[ev.SrcIP] && isDst[ev.DstIP]
+		reverse := isDst[ev.SrcIP] && isSrc[ev.DstIP]
+		if !forward && !reverse {
+			continue
+		}
+		ev.Node = node
+		if ev.Type == TraceEventDrop {
+			ev.Reason = reasons[ev.ReasonCode]
+			if ev.Reason == "" {
+				ev.Reason = strconv.Itoa(ev.ReasonCode)
+			}
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+// Summarize aggregates trace events.
+func Summarize(events []TraceEvent) *TraceSummary {
+	s := newTraceSummary()
+	for _, ev := range events {
+		s.Events[ev.Type]++
+		switch ev.Type {
+		case TraceEventDrop:
+			s.DropReasons[ev.Reason]++
+		case TraceEventSockErr:
+			s.Errnos[ev.Errno]++
+		}
+		if len(s.Samples) < maxTraceSamples {
+			s.Samples = append(s.Samples, ev)
+		}
+	}
+	return s
+}
+
+func toSet(items []string) map[string]bool {
+	set := make(map[string]bool, len(items))
+	for _, i := range items {
+		set[i] = true
+	}
+	return set
+}
@@ -0,0 +1,44 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package diagnose
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const traceOutput = `Creating trace pod default/retina-trace-abcde on node node1
+Trace pod ready, starting trace...
+
+=== SKB Drop Reason Codes (kernel-specific) ===
+2 = NOT_SPECIFIED
+5 = NETFILTER_DROP
+{"event":"start","message":"Tracing network issues..."}
+{"time":"10:00:00","type":"DROP","reason_code":5,"probe":"kfree_skb","src_ip":"10.0.1.10","src_port":40000,"dst_ip":"10.0.2.20","dst_port":8080}
+{"time":"10:00:01","type":"DROP","reason_code":9,"probe":"kfree_skb","src_ip":"10.0.1.10","src_port":40001,"dst_ip":"10.0.2.20","dst_port":8080}
+{"time":"10:00:01","type":"RST_RECV","probe":"tcp_receive_reset","src_ip":"10.0.2.20","src_port":8080,"dst_ip":"10.0.1.10","dst_port":40000}
+{"time":"10:00:02","type":"SOCK_ERR","errno":111,"probe":"inet_sk_error_report","src_ip":"10.0.1.10","src_port":40000,"dst_ip":"10.0.2.20","dst_port":8080}
+{"time":"10:00:03","type":"RETRANS","tcp_state":1,"probe":"tcp_retransmit_skb","src_ip":"10.0.1.10","src_port":40002,"dst_ip":"10.0.9.9","dst_port":443}
+not json
+Cleaning up trace pod default/retina-trace-abcde
+`
+
+func TestParseTraceOutput(t *testing.T) {
+	events := ParseTraceOutput("node1", strings.NewReader(traceOutput), []string{"10.0.1.10"}, []string{"10.96.0.20", "10.0.2.20"})
+	require.Len(t, events, 4)
+
+	assert.Equal(t, "node1", events[0].Node)
+	assert.Equal(t, "NETFILTER_DROP", events[0].Reason)
+	// Unknown reason codes fall back to the number.
+	assert.Equal(t, "9", events[1].Reason)
+
+	summary := Summarize(events)
+	assert.Equal(t, map[string]int{TraceEventDrop: 2, TraceEventRSTRecv: 1, TraceEventSockErr: 1}, summary.Events)
+	assert.Equal(t, map[string]int{"NETFILTER_DROP": 1, "9": 1}, summary.DropReasons)
+	assert.Equal(t, map[int]int{111: 1}, summary.Errnos)
+	assert.Len(t, summary.Samples, 4)
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/microsoft/retina/internal/buildinfo"
@@ -12,6 +14,9 @@ import (
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/homedir"
 	cmdutil "k8s.io/kubectl/pkg/cmd/util"
 	"k8s.io/kubectl/pkg/scheme"
 	"k8s.io/kubectl/pkg/util/templates"
@@ -29,6 +34,11 @@ var (
 	hostPID                  bool
 	capabilities             []string
 	timeout                  time.Duration
+	shellProfile             string
+	shellProfilesFile        string
+	shellProfilesConfigMap   string
+	recordPath               string
+	recordInput              bool
 )
 
 var (
@@ -40,8 +50,12 @@ var (
 
 	defaultTimeout = 30 * time.Second
 
+	// Profiles are looked up next to the kubeconfig by default.
+	defaultShellProfilesFile = filepath.Join(homedir.HomeDir(), ".kube", "retina-shell-profiles.yaml")
+
 	errMissingRequiredRetinaShellImageVersionArg = errors.New("missing required --retina-shell-image-version")
 	errUnsupportedResourceType                   = errors.New("unsupported resource type")
+	errRecordInputWithoutRecord                  = errors.New("--record-input requires --record")
 )
 
 var shellCmd = &cobra.Command{
@@ -59,6 +73,14 @@ var shellCmd = &cobra.Command{
 	CLI flags (--retina-shell-image-repo and --retina-shell-image-version) or
 	environment variables (RETINA_SHELL_IMAGE_REPO and RETINA_SHELL_IMAGE_VERSION).
 	CLI flags take precedence over env vars.
+
+	A profile (--profile) bundles the image, capabilities, mounts and a startup script
+	for a debugging task. Profiles are looked up in the local profiles file
+	(--profiles-file or RETINA_SHELL_PROFILES, by default ~/.kube/retina-shell-profiles.yaml),
+	then in the ConfigMap given by --profiles-configmap, and finally in the built-in
+	profiles "netdebug", "conntrack" and "hostfs". CLI flags add to the settings of the profile.
+
+	The session can be recorded to a local asciicast v2 file with --record.
 `),
 
 	Example: templates.Examples(`
@@ -77,13 +99,22 @@ var shellCmd = &cobra.Command{
 		# start a shell in a node, with NET_RAW and NET_ADMIN capabilities
 		# (required for iptables and tcpdump)
 		kubectl retina shell node001 --capabilities NET_RAW,NET_ADMIN
+
+		# start a shell in a node with the built-in conntrack profile
+		kubectl retina shell node001 --profile conntrack
+
+		# start a shell in a node with a profile from a ConfigMap, recording the session for audits
+		kubectl retina shell node001 --profile netdebug --profiles-configmap kube-system/retina-shell-profiles --record node001.cast
 `),
 	Args: cobra.ExactArgs(1),
-	RunE: func(_ *cobra.Command, args []string) error {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		// retinaShellImageVersion defaults to the CLI version, but that might not be set if the CLI is built without -ldflags.
 		if retinaShellImageVersion == "" {
 			return errMissingRequiredRetinaShellImageVersionArg
 		}
+		if recordInput && recordPath == "" {
+			return errRecordInputWithoutRecord
+		}
 
 		namespace, explicitNamespace, err := matchVersionFlags.ToRawKubeConfigLoader().Namespace()
 		if err != nil {
@@ -118,6 +149,19 @@ var shellCmd = &cobra.Command{
 			AppArmorUnconfined:       appArmorUnconfined,
 			SeccompUnconfined:        seccompUnconfined,
 			Timeout:                  timeout,
+			RecordPath:               recordPath,
+			RecordInput:              recordInput,
+		}
+
+		if shellProfile != "" {
+			profile, err := resolveShellProfile(cmd, restConfig, namespace)
+			if err != nil {
+				return err
+			}
+			config = shell.ApplyProfile(config, profile)
+			if profile.Image != "" && !shellImageOverridden(cmd) {
+				config.RetinaShellImage = profile.Image
+			}
 		}
 
 		return r.Visit(func(info *resource.Info, err error) error {
@@ -140,6 +184,55 @@ var shellCmd = &cobra.Command{
 	},
 }
 
+// resolveShellProfile looks up the profile selected with --profile in the profiles ConfigMap, the local profiles file
+// and the built-in profiles.
+func resolveShellProfile(cmd *cobra.Command, restConfig *rest.Config, namespace string) (shell.Profile, error) {
+	sources := []map[string]shell.Profile{shell.BuiltinProfiles()}
+
+	if shellProfilesConfigMap != "" {
+		cmNamespace, cmName := namespace, shellProfilesConfigMap
+		if ns, name, found := strings.Cut(shellProfilesConfigMap, "/"); found {
+			cmNamespace, cmName = ns, name
+		}
+		clientset, err := kubernetes.NewForConfig(restConfig)
+		if err != nil {
+			return shell.Profile{}, fmt.Errorf("error constructing kube clientset: %w", err)
+		}
+		profiles, err := shell.LoadProfilesConfigMap(cmd.Context(), clientset, cmNamespace, cmName)
+		if err != nil {
+			return shell.Profile{}, fmt.Errorf("error loading shell profiles: %w", err)
+		}
+		sources = append(sources, profiles)
+	}
+
+	// A missing profiles file is only an error if it was set explicitly.
+	profilesFileExplicit := cmd.Flags().Changed("profiles-file")
+	if !profilesFileExplicit {
+		if envFile := os.Getenv("RETINA_SHELL_PROFILES"); envFile != "" {
+			shellProfilesFile = envFile
+			profilesFileExplicit = true
+		}
+	}
+	profiles, err := shell.LoadProfilesFile(shellProfilesFile, profilesFileExplicit)
+	if err != nil {
+		return shell.Profile{}, fmt.Errorf("error loading shell profiles: %w", err)
+	}
+	sources = append(sources, profiles)
+
+	profile, err := shell.ResolveProfile(shellProfile, sources...)
+	if err != nil {
+		return shell.Profile{}, fmt.Errorf("error resolving shell profile: %w", err)
+	}
+	return profile, nil
+}
+
+// shellImageOverridden reports whether the shell image was set explicitly, in which case it takes precedence over
+// the image of the profile.
+func shellImageOverridden(cmd *cobra.Command) bool {
+	return cmd.Flags().Changed("retina-shell-image-repo") || cmd.Flags().Changed("retina-shell-image-version") ||
+		os.Getenv("RETINA_SHELL_IMAGE_REPO") != "" || os.Getenv("RETINA_SHELL_IMAGE_VERSION") != ""
+}
+
 func init() {
 	Retina.AddCommand(shellCmd)
 	shellCmd.PersistentPreRun = func(cmd *cobra.Command, _ []string) {
@@ -169,6 +262,11 @@ func init() {
 	shellCmd.Flags().DurationVar(&timeout, "timeout", defaultTimeout, "The maximum time to wait for the shell container to start")
 	shellCmd.Flags().BoolVar(&appArmorUnconfined, "apparmor-unconfined", false, "Set AppArmor profile type to unconfined. Applies only to nodes, not pods.")
 	shellCmd.Flags().BoolVar(&seccompUnconfined, "seccomp-unconfined", false, "Set Seccomp profile type to unconfined. Applies only to nodes, not pods.")
+	shellCmd.Flags().StringVar(&shellProfile, "profile", "", "The profile bundling the image, capabilities, mounts and startup script of the shell")
+	shellCmd.Flags().StringVar(&shellProfilesFile, "profiles-file", defaultShellProfilesFile, "The local file to look up profiles in")
+	shellCmd.Flags().StringVar(&shellProfilesConfigMap, "profiles-configmap", "", "The ConfigMap ([NAMESPACE/]NAME) to look up profiles in")
+	shellCmd.Flags().StringVar(&recordPath, "record", "", "Record the session to this local file in asciicast v2 format. The file must not exist.")
+	shellCmd.Flags().BoolVar(&recordInput, "record-input", false, "Also record the keystrokes sent to the shell, including input that is not echoed such as passwords. Requires --record.")
 
 	// configFlags and matchVersion flags are used to load kubeconfig.
 	// This uses the same mechanism as `kubectl debug` to connect to apiserver and attach to containers.
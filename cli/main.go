@@ -8,6 +8,7 @@ import (
 
 	"github.com/microsoft/retina/cli/cmd"
 	"github.com/microsoft/retina/cli/cmd/capture"
+	"github.com/microsoft/retina/cli/cmd/diagnose"
 )
 
 func main() {
@@ -17,6 +18,7 @@ func main() {
 		os.Exit(1)
 	}
 	cmd.Retina.AddCommand(capture.NewCommand(kubeClient))
+	cmd.Retina.AddCommand(diagnose.NewCommand())
 	if err := cmd.Retina.Execute(); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -0,0 +1,162 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/microsoft/retina/crd/api/v1alpha1"
+	"github.com/microsoft/retina/crd/api/v1alpha1/validations"
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/replay"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap/zapcore"
+	"sigs.k8s.io/yaml"
+)
+
+var errNoRecordings = errors.New("no flow recordings")
+
+var (
+	replayRecordings        []string
+	replayMetricsConfig     string
+	replaySnapshot          string
+	replayRemoteContext     bool
+	replayEnableAnnotations bool
+	replayCardinality       bool
+
+	replayCmd = &cobra.Command{
+		Use:   "replay",
+		Short: "Replay recorded flows through the enricher and the metrics of a MetricsConfiguration",
+		Long: `Replay flows recorded on a node through the enricher and the advanced metrics of a MetricsConfiguration,
+and print the resulting Prometheus series. This shows the labels, values and cardinality of a
+MetricsConfiguration change before rolling it out.
+
+Flows are recorded by the agent to the flowRecordingDir directory of its configuration, on the node.
+A recording is a file or a directory of recordings, which are replayed oldest first:
+
+  kubectl cp kube-system/<retina-agent-pod>:/var/log/retina/flows ./flows
+
+The snapshot provides the pods, services and nodes used to enrich the flows:
+
+  kubectl get pods,services,nodes -A -o yaml > snapshot.yaml`,
+		Example: `  retina-agent replay --recording ./flows --snapshot snapshot.yaml --metrics-config metricsconfig.yaml --cardinality`,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if _, err := log.SetupZapLogger(&log.LogOpts{Level: zapcore.WarnLevel.String(), File: false}); err != nil {
+				return fmt.Errorf("setting up logger: %w", err)
+			}
+
+			spec, err := loadMetricsSpec(replayMetricsConfig)
+			if err != nil {
+				return err
+			}
+
+			snapshot, err := os.Open(replaySnapshot)
+			if err != nil {
+				return fmt.Errorf("opening snapshot: %w", err)
+			}
+			defer snapshot.Close()
+			c, err := replay.LoadSnapshot(snapshot)
+			if err != nil {
+				return fmt.Errorf("loading snapshot: %w", err)
+			}
+
+			paths, err := recordingPaths(replayRecordings)
+			if err != nil {
+				return err
+			}
+			recordings := make([]*replay.Reader, 0, len(paths))
+			for _, path := range paths {
+				f, err := os.Open(path)
+				if err != nil {
+					return fmt.Errorf("opening recording: %w", err)
+				}
+				defer f.Close()
+				r, err := replay.NewReader(f)
+				if err != nil {
+					return fmt.Errorf("reading recording %s: %w", path, err)
+				}
+				recordings = append(recordings, r)
+			}
+
+			conf := &kcfg.Config{
+				EnableAnnotations: replayEnableAnnotations,
+				RemoteContext:     replayRemoteContext,
+			}
+			stats, families, err := replay.Replay(cmd.Context(), conf, spec, c, recordings...)
+			if err != nil {
+				return fmt.Errorf("replaying flows: %w", err)
+			}
+
+			out := cmd.OutOrStdout()
+			if replayCardinality {
+				if err := replay.WriteCardinality(out, families); err != nil {
+					return err //nolint:wrapcheck // already wrapped
+				}
+			} else if err := replay.WriteSeries(out, families); err != nil {
+				return err //nolint:wrapcheck // already wrapped
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "Replayed %d flows, %d enriched, %d selected by the namespace filters\n", stats.Flows, stats.Enriched, stats.Processed)
+			if stats.Truncated > 0 {
+				fmt.Fprintf(cmd.ErrOrStderr(), "%d recordings were cut off, e.g. while the agent was writing them, and replayed up to the cut\n", stats.Truncated)
+			}
+			return nil
+		},
+	}
+)
+
+// recordingPaths expands the directories of the recording arguments to the recordings they contain.
+func recordingPaths(args []string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, fmt.Errorf("opening recording: %w", err)
+		}
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+		files, err := replay.RecordingFiles(arg)
+		if err != nil {
+			return nil, fmt.Errorf("listing recordings of %s: %w", arg, err)
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("%w in %s", errNoRecordings, arg)
+		}
+		paths = append(paths, files...)
+	}
+	return paths, nil
+}
+
+// loadMetricsSpec reads and validates a MetricsConfiguration.
+func loadMetricsSpec(path string) (*v1alpha1.MetricsSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading MetricsConfiguration: %w", err)
+	}
+	mc := &v1alpha1.MetricsConfiguration{}
+	if err := yaml.UnmarshalStrict(data, mc); err != nil {
+		return nil, fmt.Errorf("decoding MetricsConfiguration: %w", err)
+	}
+	if err := validations.MetricsCRD(mc); err != nil {
+		return nil, fmt.Errorf("invalid MetricsConfiguration: %w", err)
+	}
+	return &mc.Spec, nil
+}
+
+func init() {
+	replayCmd.Flags().StringSliceVar(&replayRecordings, "recording", nil, "Flow recordings, or directories of flow recordings, to replay in order")
+	replayCmd.Flags().StringVar(&replayMetricsConfig, "metrics-config", "", "MetricsConfiguration to replay the flows with")
+	replayCmd.Flags().StringVar(&replaySnapshot, "snapshot", "", "Pods, services and nodes to enrich the flows with")
+	replayCmd.Flags().BoolVar(&replayRemoteContext, "remote-context", false, "Replay in remote context mode, as the agent does with remoteContext enabled")
+	replayCmd.Flags().BoolVar(&replayEnableAnnotations, "enable-annotations", false, "Select pods annotated to be observed, as the agent does with enableAnnotations enabled")
+	replayCmd.Flags().BoolVar(&replayCardinality, "cardinality", false, "Print the number of series and label values of every metric instead of the series")
+	for _, flag := range []string{"recording", "metrics-config", "snapshot"} {
+		_ = replayCmd.MarkFlagRequired(flag)
+	}
+
+	rootCmd.AddCommand(replayCmd)
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"slices"
 	"strings"
 
 	"go.uber.org/zap"
@@ -45,6 +46,7 @@ import (
 	"github.com/microsoft/retina/pkg/metrics"
 	mm "github.com/microsoft/retina/pkg/module/metrics"
 	"github.com/microsoft/retina/pkg/pubsub"
+	"github.com/microsoft/retina/pkg/replay"
 	"github.com/microsoft/retina/pkg/telemetry"
 )
 
@@ -201,6 +203,10 @@ func (d *Daemon) Start() error {
 		}
 		podNodeIPNotMatchSelector := fields.OneTermNotEqualSelector("status.podIP", nodeIP)
 		podSelector := fields.AndSelectors(podNodeNameSelector, podNodeIPNotMatchSelector)
+		// The cgroupskb plugin attributes the traffic of the hostnetwork pods by cgroup, so they are watched too.
+		if slices.Contains(daemonConfig.EnabledPlugin, "cgroupskb") {
+			podSelector = podNodeNameSelector
+		}
 
 		mainLogger.Info("pod selector when remote context is disabled", zap.String("pod selector", podSelector.String()))
 		mgrOption.Cache = crcache.Options{
@@ -253,6 +259,14 @@ func (d *Daemon) Start() error {
 		}
 		defer fm.Stop() //nolint:errcheck // best effort
 		enrich.Run()
+		if daemonConfig.FlowRecordingDir != "" {
+			recorder := replay.NewFileRecorder(daemonConfig.FlowRecordingDir, int64(daemonConfig.FlowRecordingMaxFileSizeMB)<<20, daemonConfig.FlowRecordingMaxFiles) //nolint:gomnd // MiB
+			go func() {
+				if err := recorder.Run(ctx, enrich); err != nil {
+					mainLogger.Error("Failed to record flows", zap.Error(err))
+				}
+			}()
+		}
 		metricsModule := mm.InitModule(ctx, daemonConfig, pubSub, enrich, fm, controllerCache)
 
 		if !daemonConfig.RemoteContext {
@@ -293,7 +307,7 @@ func (d *Daemon) Start() error {
 			go namespaceController.Start(ctx)
 		} else {
 			mainLogger.Info("Initializing MetricsConfig controller")
-			metricsConfigController := mcc.New(mgr.GetClient(), mgr.GetScheme(), metricsModule)
+			metricsConfigController := mcc.New(mgr.GetClient(), mgr.GetScheme(), metricsModule, os.Getenv(nodeNameEnvKey))
 			if err := metricsConfigController.SetupWithManager(mgr); err != nil {
 				mainLogger.Fatal("unable to create metricsConfigController", zap.Error(err))
 			}
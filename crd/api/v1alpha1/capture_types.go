@@ -47,6 +47,71 @@ type CaptureStatus struct {
 	// The number of failed jobs.
 	// +optional
 	Failed int32 `json:"failed,omitempty" protobuf:"varint,6,opt,name=failed"`
+
+	// NodeStatuses reports the progress and result of the capture job on each node.
+	// +optional
+	// +listType=map
+	// +listMapKey=nodeName
+	NodeStatuses []CaptureNodeStatus `json:"nodeStatuses,omitempty"`
+}
+
+// CaptureNodePhase is the phase of the capture job on a node.
+type CaptureNodePhase string
+
+const (
+	// CaptureNodePending indicates the capture pod on the node has not started yet.
+	CaptureNodePending CaptureNodePhase = "Pending"
+	// CaptureNodeRunning indicates the capture is in progress on the node.
+	CaptureNodeRunning CaptureNodePhase = "Running"
+	// CaptureNodeSucceeded indicates the capture on the node completed and its artifact was uploaded.
+	CaptureNodeSucceeded CaptureNodePhase = "Succeeded"
+	// CaptureNodeFailed indicates the capture on the node failed.
+	CaptureNodeFailed CaptureNodePhase = "Failed"
+)
+
+// CaptureNodeStatus describes the capture job running on a single node.
+type CaptureNodeStatus struct {
+	// NodeName is the name of the node the capture runs on.
+	NodeName string `json:"nodeName"`
+
+	// JobName is the name of the capture job for the node.
+	// +optional
+	JobName string `json:"jobName,omitempty"`
+
+	// Phase is the phase of the capture on the node.
+	// +optional
+	Phase CaptureNodePhase `json:"phase,omitempty"`
+
+	// StartTime is the time the capture pod started on the node.
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is the time the capture pod on the node terminated.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// BytesCaptured is the total size of the capture files written on the node, reported when the capture finishes on
+	// the node.
+	// +optional
+	BytesCaptured int64 `json:"bytesCaptured,omitempty"`
+
+	// PacketsCaptured is the number of packets written to the capture files, as reported by tcpdump.
+	// +optional
+	PacketsCaptured int64 `json:"packetsCaptured,omitempty"`
+
+	// PacketsDroppedByKernel is the number of packets dropped by the kernel because the capture could not keep up,
+	// as reported by tcpdump.
+	// +optional
+	PacketsDroppedByKernel int64 `json:"packetsDroppedByKernel,omitempty"`
+
+	// ArtifactLocations lists where the capture artifact of the node was stored: the path on the node, the path in the
+	// persistent volume claim as <claim>:<path>, or the URL of the uploaded blob or S3 object.
+	// +optional
+	ArtifactLocations []string `json:"artifactLocations,omitempty"`
+
+	// Error describes why the capture on the node failed.
+	// +optional
+	Error string `json:"error,omitempty"`
 }
 
 // CaptureOption lists the options of the capture.
@@ -10,6 +10,8 @@ package v1alpha1
 
 import (
 	"reflect"
+	"slices"
+	"sort"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -24,6 +26,21 @@ const (
 	StateWarning     string = "Warning"
 )
 
+const (
+	// OverflowPolicyAggregate collapses the label combinations over the series budget of a metric into a single
+	// series with every label set to "other".
+	OverflowPolicyAggregate string = "Aggregate"
+	// OverflowPolicyDrop drops the label combinations over the series budget of a metric.
+	OverflowPolicyDrop string = "Drop"
+)
+
+const (
+	// AggregationWorkload rolls flows up to the source and destination workloads.
+	AggregationWorkload string = "Workload"
+	// AggregationService rolls flows up to the source workload and the destination Service.
+	AggregationService string = "Service"
+)
+
 // MetricsContextOptions indicates the configuration for retina plugin metrics
 type MetricsContextOptions struct {
 	// MetricName indicates the name of the metric
@@ -45,6 +62,39 @@ type MetricsContextOptions struct {
 	// Metrics which have not been updated within the TTL will be removed from export
 	// +optional
 	TTL string `json:"ttl,omitempty"`
+	// MaxSeries is the series budget of the metric on each node, the maximum number of label combinations exported.
+	// Label combinations over the budget are handled according to the OverflowPolicy. Zero means no budget.
+	// A budget requires a positive TTL, expired label combinations free room in the budget.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxSeries int `json:"maxSeries,omitempty"`
+	// OverflowPolicy defines how label combinations over the series budget are handled.
+	// Aggregate collapses them into a single series with every label set to "other", Drop drops them.
+	// Defaults to Aggregate.
+	// +optional
+	// +kubebuilder:validation:Enum=Aggregate;Drop
+	OverflowPolicy string `json:"overflowPolicy,omitempty"`
+	// Aggregation rolls flows up before they are counted, instead of labeling them with SourceLabels and
+	// DestinationLabels. Workload labels the metric with the namespace and workload of the source and destination.
+	// Service labels the metric with the namespace and workload of the source, and the namespace and name of the
+	// destination Service.
+	// +optional
+	// +kubebuilder:validation:Enum=Workload;Service
+	Aggregation string `json:"aggregation,omitempty"`
+	// CrossZoneOnly only counts the traffic between different zones.
+	// Only applies to the zone_traffic_count and zone_traffic_bytes metrics.
+	// +optional
+	CrossZoneOnly bool `json:"crossZoneOnly,omitempty"`
+	// DNSDomains are the domains the queries are reduced to, such as "*.internal.corp" for its subdomains or
+	// "api.example.com" for this name only. Queries of other domains are labeled "other".
+	// Only applies to the dns_failure_count metric.
+	// +optional
+	// +listType=set
+	DNSDomains []string `json:"dnsDomains,omitempty"`
+	// Buckets are the upper bounds of the histogram buckets, in bytes and in increasing order.
+	// Only applies to the packet_size and connection_size metrics, which have default buckets.
+	// +optional
+	Buckets []int64 `json:"buckets,omitempty"`
 }
 
 // MetricsNamespaces indicates the namespaces to include or exclude in metric collection
@@ -67,6 +117,20 @@ type MetricsStatus struct {
 	State         string       `json:"state"`
 	Reason        string       `json:"reason"`
 	LastKnownSpec *MetricsSpec `json:"lastKnownSpec,omitempty"`
+	// ExceededSeriesBudgets lists the metrics which reached their series budget, with the nodes reporting it.
+	// +optional
+	// +listType=map
+	// +listMapKey=metricName
+	ExceededSeriesBudgets []ExceededSeriesBudget `json:"exceededSeriesBudgets,omitempty"`
+}
+
+// ExceededSeriesBudget reports the nodes on which a metric reached its series budget.
+type ExceededSeriesBudget struct {
+	// MetricName indicates the name of the metric
+	MetricName string `json:"metricName"`
+	// Nodes are the names of the nodes on which the metric reached its series budget
+	// +listType=set
+	Nodes []string `json:"nodes"`
 }
 
 // +kubebuilder:object:root=true
@@ -101,7 +165,7 @@ func init() {
 func (m *MetricsContextOptions) IsAdvanced() bool {
 	return m != nil &&
 		m.MetricName != "" && (len(m.SourceLabels) > 0 ||
-		len(m.DestinationLabels) > 0)
+		len(m.DestinationLabels) > 0 || m.Aggregation != "")
 }
 
 func (m *MetricsSpec) WithIncludedNamespaces(namespaces []string) *MetricsSpec {
@@ -123,3 +187,33 @@ func (m *MetricsSpec) WithMetricsContextOptions(metrics, srcLabels, dstLabels []
 func (m *MetricsSpec) Equals(other *MetricsSpec) bool {
 	return reflect.DeepEqual(m, other)
 }
+
+// SetSeriesBudgetExceeded records whether the series budget of a metric is exceeded on a node,
+// and returns whether the status changed.
+func (s *MetricsStatus) SetSeriesBudgetExceeded(metricName, node string, exceeded bool) bool {
+	for i := range s.ExceededSeriesBudgets {
+		budget := &s.ExceededSeriesBudgets[i]
+		if budget.MetricName != metricName {
+			continue
+		}
+		j := slices.Index(budget.Nodes, node)
+		switch {
+		case exceeded && j < 0:
+			budget.Nodes = append(budget.Nodes, node)
+			sort.Strings(budget.Nodes)
+		case !exceeded && j >= 0:
+			budget.Nodes = slices.Delete(budget.Nodes, j, j+1)
+			if len(budget.Nodes) == 0 {
+				s.ExceededSeriesBudgets = slices.Delete(s.ExceededSeriesBudgets, i, i+1)
+			}
+		default:
+			return false
+		}
+		return true
+	}
+	if !exceeded {
+		return false
+	}
+	s.ExceededSeriesBudgets = append(s.ExceededSeriesBudgets, ExceededSeriesBudget{MetricName: metricName, Nodes: []string{node}})
+	return true
+}
@@ -0,0 +1,170 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the MIT license.
+*/
+
+package validations
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/microsoft/retina/crd/api/v1alpha1"
+)
+
+// MergeResult describes which context options of a MetricsConfiguration are part of a merged spec.
+type MergeResult struct {
+	// Applied are the metrics which are applied as configured.
+	Applied []string
+	// Conflicts maps the metrics which are configured differently by a MetricsConfiguration with precedence
+	// to the name of that MetricsConfiguration. These metrics are applied as configured by the other one.
+	Conflicts map[string]string
+}
+
+// Status returns the status of the MetricsConfiguration, keeping the last known spec of the current status.
+// Series budgets reported as exceeded by the nodes are kept for the applied metrics and put the MetricsConfiguration
+// in the Warning state.
+func (r MergeResult) Status(current v1alpha1.MetricsStatus) v1alpha1.MetricsStatus {
+	status := current
+	status.ExceededSeriesBudgets = nil
+	for _, budget := range current.ExceededSeriesBudgets {
+		if len(budget.Nodes) > 0 && slices.Contains(r.Applied, budget.MetricName) {
+			status.ExceededSeriesBudgets = append(status.ExceededSeriesBudgets, budget)
+		}
+	}
+	exceeded := make([]string, 0, len(status.ExceededSeriesBudgets))
+	for _, budget := range status.ExceededSeriesBudgets {
+		exceeded = append(exceeded, fmt.Sprintf("%s (on %d nodes)", budget.MetricName, len(budget.Nodes)))
+	}
+
+	if len(r.Conflicts) == 0 {
+		status.State = v1alpha1.StateAccepted
+		status.Reason = fmt.Sprintf("CRD is Accepted, applied metrics: %s", strings.Join(r.Applied, ", "))
+		if len(exceeded) > 0 {
+			status.State = v1alpha1.StateWarning
+			status.Reason += "; series budget reached: " + strings.Join(exceeded, ", ")
+		}
+		return status
+	}
+
+	metrics := make([]string, 0, len(r.Conflicts))
+	for metric := range r.Conflicts {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+	conflicts := make([]string, 0, len(metrics))
+	for _, metric := range metrics {
+		conflicts = append(conflicts, fmt.Sprintf("%s (configured by %s)", metric, r.Conflicts[metric]))
+	}
+
+	status.State = v1alpha1.StateWarning
+	status.Reason = fmt.Sprintf("CRD is partially applied, applied metrics: %s; not applied as configured: %s",
+		strings.Join(r.Applied, ", "), strings.Join(conflicts, ", "))
+	if len(r.Applied) == 0 {
+		status.Reason = "CRD is not applied, all metrics are configured differently by other MetricsConfigurations: " + strings.Join(conflicts, ", ")
+	}
+	if len(exceeded) > 0 {
+		status.Reason += "; series budget reached: " + strings.Join(exceeded, ", ")
+	}
+	return status
+}
+
+// MergeMetricsConfigurations merges valid MetricsConfigurations into a single spec for the metrics module.
+//
+// MetricsConfigurations take precedence by creation time, then by name. A metric is applied with the context
+// options of the first MetricsConfiguration which configures it; other MetricsConfigurations with different options
+// for the same metric are reported as conflicting in their result.
+//
+// Namespaces are merged so that a namespace is observed if any MetricsConfiguration observes it: included namespaces
+// are united, and a namespace is only excluded if every MetricsConfiguration with an exclude list excludes it and no
+// MetricsConfiguration includes it. The merged exclude list may be empty, which observes all namespaces.
+func MergeMetricsConfigurations(mcs []*v1alpha1.MetricsConfiguration) (*v1alpha1.MetricsSpec, map[string]MergeResult) {
+	ordered := make([]*v1alpha1.MetricsConfiguration, len(mcs))
+	copy(ordered, mcs)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if !ordered[i].CreationTimestamp.Equal(&ordered[j].CreationTimestamp) {
+			return ordered[i].CreationTimestamp.Before(&ordered[j].CreationTimestamp)
+		}
+		return ordered[i].Name < ordered[j].Name
+	})
+
+	spec := &v1alpha1.MetricsSpec{ContextOptions: []v1alpha1.MetricsContextOptions{}}
+	results := make(map[string]MergeResult, len(ordered))
+	owners := make(map[string]string)
+	for _, mc := range ordered {
+		result := MergeResult{Applied: []string{}, Conflicts: map[string]string{}}
+		for i := range mc.Spec.ContextOptions {
+			option := mc.Spec.ContextOptions[i]
+			owner, ok := owners[option.MetricName]
+			if !ok {
+				owners[option.MetricName] = mc.Name
+				spec.ContextOptions = append(spec.ContextOptions, option)
+				result.Applied = append(result.Applied, option.MetricName)
+				continue
+			}
+			for _, applied := range spec.ContextOptions {
+				if applied.MetricName != option.MetricName {
+					continue
+				}
+				if MetricsContextOptionsCompare([]v1alpha1.MetricsContextOptions{applied}, []v1alpha1.MetricsContextOptions{option}) {
+					result.Applied = append(result.Applied, option.MetricName)
+				} else {
+					result.Conflicts[option.MetricName] = owner
+				}
+			}
+		}
+		results[mc.Name] = result
+	}
+	sort.SliceStable(spec.ContextOptions, func(i, j int) bool {
+		return spec.ContextOptions[i].MetricName < spec.ContextOptions[j].MetricName
+	})
+
+	spec.Namespaces = mergeMetricsNamespaces(ordered)
+	return spec, results
+}
+
+func mergeMetricsNamespaces(mcs []*v1alpha1.MetricsConfiguration) v1alpha1.MetricsNamespaces {
+	included := map[string]struct{}{}
+	var excluded map[string]struct{}
+	for _, mc := range mcs {
+		for _, ns := range mc.Spec.Namespaces.Include {
+			included[ns] = struct{}{}
+		}
+		if mc.Spec.Namespaces.Exclude == nil {
+			continue
+		}
+		if excluded == nil {
+			excluded = map[string]struct{}{}
+			for _, ns := range mc.Spec.Namespaces.Exclude {
+				excluded[ns] = struct{}{}
+			}
+			continue
+		}
+		current := map[string]struct{}{}
+		for _, ns := range mc.Spec.Namespaces.Exclude {
+			if _, ok := excluded[ns]; ok {
+				current[ns] = struct{}{}
+			}
+		}
+		excluded = current
+	}
+
+	if excluded == nil {
+		return v1alpha1.MetricsNamespaces{Include: sortedKeys(included)}
+	}
+	for ns := range included {
+		delete(excluded, ns)
+	}
+	return v1alpha1.MetricsNamespaces{Exclude: sortedKeys(excluded)}
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
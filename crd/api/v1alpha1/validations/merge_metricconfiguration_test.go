@@ -0,0 +1,137 @@
+/*
+Copyright (c) Microsoft Corporation.
+Licensed under the MIT license.
+*/
+
+package validations
+
+import (
+	"testing"
+	"time"
+
+	"github.com/microsoft/retina/crd/api/v1alpha1"
+	"gotest.tools/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func metricsConfig(name string, created time.Time, namespaces v1alpha1.MetricsNamespaces, options ...v1alpha1.MetricsContextOptions) *v1alpha1.MetricsConfiguration {
+	return &v1alpha1.MetricsConfiguration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Spec: v1alpha1.MetricsSpec{
+			ContextOptions: options,
+			Namespaces:     namespaces,
+		},
+	}
+}
+
+// TestMergeMetricsConfigurations tests the merging of context options and the per configuration results
+func TestMergeMetricsConfigurations(t *testing.T) {
+	now := time.Now()
+	drop := v1alpha1.MetricsContextOptions{MetricName: "drop_count", SourceLabels: []string{"ip", "podname"}}
+	dropReordered := v1alpha1.MetricsContextOptions{MetricName: "drop_count", SourceLabels: []string{"podname", "ip"}}
+	dropPort := v1alpha1.MetricsContextOptions{MetricName: "drop_count", SourceLabels: []string{"port"}}
+	forward := v1alpha1.MetricsContextOptions{MetricName: "forward_count", SourceLabels: []string{"podname"}}
+	include := v1alpha1.MetricsNamespaces{Include: []string{"default"}}
+
+	teamA := metricsConfig("team-a", now, include, drop)
+	teamB := metricsConfig("team-b", now.Add(time.Minute), include, dropPort, forward)
+	teamC := metricsConfig("team-c", now.Add(time.Minute), include, dropReordered)
+
+	// The order of the input does not matter, the oldest configuration takes precedence.
+	spec, results := MergeMetricsConfigurations([]*v1alpha1.MetricsConfiguration{teamC, teamB, teamA})
+	assert.DeepEqual(t, []v1alpha1.MetricsContextOptions{drop, forward}, spec.ContextOptions)
+	assert.DeepEqual(t, MergeResult{Applied: []string{"drop_count"}, Conflicts: map[string]string{}}, results["team-a"])
+	assert.DeepEqual(t, MergeResult{Applied: []string{"forward_count"}, Conflicts: map[string]string{"drop_count": "team-a"}}, results["team-b"])
+	assert.DeepEqual(t, MergeResult{Applied: []string{"drop_count"}, Conflicts: map[string]string{}}, results["team-c"])
+
+	assert.Equal(t, v1alpha1.StateAccepted, results["team-a"].Status(teamA.Status).State)
+	status := results["team-b"].Status(teamB.Status)
+	assert.Equal(t, v1alpha1.StateWarning, status.State)
+	assert.Equal(t, "CRD is partially applied, applied metrics: forward_count; not applied as configured: drop_count (configured by team-a)", status.Reason)
+
+	// Configurations created at the same time take precedence by name.
+	teamB.CreationTimestamp = teamA.CreationTimestamp
+	spec, results = MergeMetricsConfigurations([]*v1alpha1.MetricsConfiguration{teamB, teamA})
+	assert.DeepEqual(t, []v1alpha1.MetricsContextOptions{drop, forward}, spec.ContextOptions)
+	assert.DeepEqual(t, map[string]string{"drop_count": "team-a"}, results["team-b"].Conflicts)
+}
+
+// TestMergeResultStatusSeriesBudgets tests that exceeded series budgets of applied metrics put a configuration in the Warning state
+func TestMergeResultStatusSeriesBudgets(t *testing.T) {
+	result := MergeResult{Applied: []string{"drop_count"}, Conflicts: map[string]string{}}
+	current := v1alpha1.MetricsStatus{}
+	assert.Assert(t, current.SetSeriesBudgetExceeded("drop_count", "node-b", true))
+	assert.Assert(t, current.SetSeriesBudgetExceeded("drop_count", "node-a", true))
+	assert.Assert(t, !current.SetSeriesBudgetExceeded("drop_count", "node-a", true))
+	// The budget of a metric which is no longer applied is not reported.
+	assert.Assert(t, current.SetSeriesBudgetExceeded("forward_count", "node-a", true))
+
+	status := result.Status(current)
+	assert.Equal(t, v1alpha1.StateWarning, status.State)
+	assert.Equal(t, "CRD is Accepted, applied metrics: drop_count; series budget reached: drop_count (on 2 nodes)", status.Reason)
+	assert.DeepEqual(t, []v1alpha1.ExceededSeriesBudget{{MetricName: "drop_count", Nodes: []string{"node-a", "node-b"}}}, status.ExceededSeriesBudgets)
+
+	assert.Assert(t, status.SetSeriesBudgetExceeded("drop_count", "node-a", false))
+	assert.Assert(t, status.SetSeriesBudgetExceeded("drop_count", "node-b", false))
+	assert.Assert(t, !status.SetSeriesBudgetExceeded("drop_count", "node-b", false))
+	status = result.Status(status)
+	assert.Equal(t, v1alpha1.StateAccepted, status.State)
+	assert.Equal(t, 0, len(status.ExceededSeriesBudgets))
+}
+
+// TestMergeMetricsNamespaces tests that a namespace is observed if any configuration observes it
+func TestMergeMetricsNamespaces(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name       string
+		namespaces []v1alpha1.MetricsNamespaces
+		want       v1alpha1.MetricsNamespaces
+	}{
+		{
+			name: "includes are united",
+			namespaces: []v1alpha1.MetricsNamespaces{
+				{Include: []string{"team-b", "shared"}},
+				{Include: []string{"team-a", "shared"}},
+			},
+			want: v1alpha1.MetricsNamespaces{Include: []string{"shared", "team-a", "team-b"}},
+		},
+		{
+			name: "only namespaces excluded by all are excluded",
+			namespaces: []v1alpha1.MetricsNamespaces{
+				{Exclude: []string{"kube-system", "monitoring"}},
+				{Exclude: []string{"kube-system"}},
+			},
+			want: v1alpha1.MetricsNamespaces{Exclude: []string{"kube-system"}},
+		},
+		{
+			name: "included namespaces are not excluded",
+			namespaces: []v1alpha1.MetricsNamespaces{
+				{Exclude: []string{"kube-system", "monitoring"}},
+				{Include: []string{"monitoring"}},
+			},
+			want: v1alpha1.MetricsNamespaces{Exclude: []string{"kube-system"}},
+		},
+		{
+			name: "disjoint excludes observe all namespaces",
+			namespaces: []v1alpha1.MetricsNamespaces{
+				{Exclude: []string{"kube-system"}},
+				{Exclude: []string{"monitoring"}},
+			},
+			want: v1alpha1.MetricsNamespaces{Exclude: []string{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mcs := make([]*v1alpha1.MetricsConfiguration, 0, len(tt.namespaces))
+			for i, namespaces := range tt.namespaces {
+				mcs = append(mcs, metricsConfig(string(rune('a'+i)), now, namespaces, v1alpha1.MetricsContextOptions{MetricName: "drop_count"}))
+			}
+			spec, _ := MergeMetricsConfigurations(mcs)
+			assert.DeepEqual(t, tt.want, spec.Namespaces)
+		})
+	}
+}
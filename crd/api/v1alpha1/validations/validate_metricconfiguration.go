@@ -8,13 +8,27 @@ package validations
 import (
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/microsoft/retina/crd/api/v1alpha1"
 	"github.com/microsoft/retina/pkg/utils"
 )
 
-var ErrNegativeTTL = errors.New("TTL cannot be negative")
+var (
+	ErrNegativeTTL           = errors.New("TTL cannot be negative")
+	ErrNegativeMaxSeries     = errors.New("maxSeries cannot be negative")
+	ErrMaxSeriesWithoutTTL   = errors.New("maxSeries requires a positive TTL")
+	ErrInvalidOverflowPolicy = errors.New("invalid overflowPolicy")
+	ErrInvalidAggregation    = errors.New("invalid aggregation")
+	ErrAggregationWithLabels = errors.New("aggregation cannot be combined with sourceLabels or destinationLabels")
+	ErrCrossZoneOnly         = errors.New("crossZoneOnly only applies to the zone traffic metrics")
+	ErrDNSDomains            = errors.New("dnsDomains only applies to the dns_failure_count metric")
+	ErrInvalidDNSDomain      = errors.New("invalid DNS domain")
+	ErrBuckets               = errors.New("buckets only applies to the packet_size and connection_size metrics")
+	ErrInvalidBuckets        = errors.New("buckets must be positive and in increasing order")
+)
 
 // MetricsConfiguration validates the metrics configuration
 func MetricsCRD(metricsConfig *v1alpha1.MetricsConfiguration) error {
@@ -44,8 +58,10 @@ func MetricsSpec(metricsSpec v1alpha1.MetricsSpec) error {
 		if !utils.IsAdvancedMetric(contextOption.MetricName) {
 			return fmt.Errorf("%s is not a valid metric", contextOption.MetricName)
 		}
+		var ttl time.Duration
 		if contextOption.TTL != "" {
-			ttl, err := time.ParseDuration(contextOption.TTL)
+			var err error
+			ttl, err = time.ParseDuration(contextOption.TTL)
 			if err != nil {
 				return fmt.Errorf("invalid TTL format for metric %s: %w", contextOption.MetricName, err)
 			}
@@ -53,6 +69,46 @@ func MetricsSpec(metricsSpec v1alpha1.MetricsSpec) error {
 				return fmt.Errorf("%w for metric %s", ErrNegativeTTL, contextOption.MetricName)
 			}
 		}
+		if contextOption.MaxSeries < 0 {
+			return fmt.Errorf("%w for metric %s", ErrNegativeMaxSeries, contextOption.MetricName)
+		}
+		// Series only leave the budget when they expire, without a TTL a reached budget is never freed.
+		if contextOption.MaxSeries > 0 && ttl <= 0 {
+			return fmt.Errorf("%w for metric %s", ErrMaxSeriesWithoutTTL, contextOption.MetricName)
+		}
+		switch contextOption.OverflowPolicy {
+		case "", v1alpha1.OverflowPolicyAggregate, v1alpha1.OverflowPolicyDrop:
+		default:
+			return fmt.Errorf("%w %q for metric %s", ErrInvalidOverflowPolicy, contextOption.OverflowPolicy, contextOption.MetricName)
+		}
+		switch contextOption.Aggregation {
+		case "":
+		case v1alpha1.AggregationWorkload, v1alpha1.AggregationService:
+			if len(contextOption.SourceLabels) > 0 || len(contextOption.DestinationLabels) > 0 {
+				return fmt.Errorf("%w for metric %s", ErrAggregationWithLabels, contextOption.MetricName)
+			}
+		default:
+			return fmt.Errorf("%w %q for metric %s", ErrInvalidAggregation, contextOption.Aggregation, contextOption.MetricName)
+		}
+		if contextOption.CrossZoneOnly && contextOption.MetricName != utils.ZoneTrafficCountName && contextOption.MetricName != utils.ZoneTrafficBytesName {
+			return fmt.Errorf("%w, not to metric %s", ErrCrossZoneOnly, contextOption.MetricName)
+		}
+		if len(contextOption.DNSDomains) > 0 && contextOption.MetricName != utils.DNSFailureCounterName {
+			return fmt.Errorf("%w, not to metric %s", ErrDNSDomains, contextOption.MetricName)
+		}
+		for _, domain := range contextOption.DNSDomains {
+			if !validDNSDomain(domain) {
+				return fmt.Errorf("%w %q for metric %s", ErrInvalidDNSDomain, domain, contextOption.MetricName)
+			}
+		}
+		if len(contextOption.Buckets) > 0 && contextOption.MetricName != utils.PacketSizeName && contextOption.MetricName != utils.ConnectionSizeName {
+			return fmt.Errorf("%w, not to metric %s", ErrBuckets, contextOption.MetricName)
+		}
+		for i, bucket := range contextOption.Buckets {
+			if bucket <= 0 || (i > 0 && bucket <= contextOption.Buckets[i-1]) {
+				return fmt.Errorf("%w for metric %s", ErrInvalidBuckets, contextOption.MetricName)
+			}
+		}
 	}
 
 	err := MetricsNamespaces(metricsSpec.Namespaces)
@@ -63,6 +119,20 @@ func MetricsSpec(metricsSpec v1alpha1.MetricsSpec) error {
 	return nil
 }
 
+// validDNSDomain returns true if the domain is a DNS name, optionally prefixed by "*." to match its subdomains.
+func validDNSDomain(domain string) bool {
+	name := strings.TrimPrefix(domain, "*.")
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || strings.ContainsAny(label, "* \t") {
+			return false
+		}
+	}
+	return true
+}
+
 // MetricsNamespaces validates the metrics namespaces
 func MetricsNamespaces(mn v1alpha1.MetricsNamespaces) error {
 	if mn.Include == nil && mn.Exclude == nil {
@@ -169,9 +239,25 @@ func MetricsContextOptionsCompare(old, new []v1alpha1.MetricsContextOptions) boo
 			return false
 		}
 
+		if oldContextOption.MaxSeries != newContextOption.MaxSeries || oldContextOption.OverflowPolicy != newContextOption.OverflowPolicy {
+			return false
+		}
+
+		if oldContextOption.Aggregation != newContextOption.Aggregation || oldContextOption.CrossZoneOnly != newContextOption.CrossZoneOnly {
+			return false
+		}
+
 		if !utils.CompareStringSlice(oldContextOption.AdditionalLabels, newContextOption.AdditionalLabels) {
 			return false
 		}
+
+		if !utils.CompareStringSlice(oldContextOption.DNSDomains, newContextOption.DNSDomains) {
+			return false
+		}
+
+		if !slices.Equal(oldContextOption.Buckets, newContextOption.Buckets) {
+			return false
+		}
 	}
 
 	return true
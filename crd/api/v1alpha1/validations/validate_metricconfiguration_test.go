@@ -197,6 +197,292 @@ func TestMetricsConfiguration(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "valid metrics crd with series budget",
+			obj: &v1alpha1.MetricsConfiguration{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "metricsconfig",
+				},
+				Spec: v1alpha1.MetricsSpec{
+					ContextOptions: []v1alpha1.MetricsContextOptions{
+						{
+							MetricName:     "drop_count",
+							SourceLabels:   []string{"ip", "podname"},
+							TTL:            "10m",
+							MaxSeries:      1000,
+							OverflowPolicy: v1alpha1.OverflowPolicyDrop,
+						},
+					},
+					Namespaces: v1alpha1.MetricsNamespaces{
+						Include: []string{"default"},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid metrics crd with negative series budget",
+			obj: &v1alpha1.MetricsConfiguration{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "metricsconfig",
+				},
+				Spec: v1alpha1.MetricsSpec{
+					ContextOptions: []v1alpha1.MetricsContextOptions{
+						{
+							MetricName: "drop_count",
+							MaxSeries:  -1,
+						},
+					},
+					Namespaces: v1alpha1.MetricsNamespaces{
+						Include: []string{"default"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid metrics crd with series budget and no ttl",
+			obj: &v1alpha1.MetricsConfiguration{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "metricsconfig",
+				},
+				Spec: v1alpha1.MetricsSpec{
+					ContextOptions: []v1alpha1.MetricsContextOptions{
+						{
+							MetricName: "drop_count",
+							MaxSeries:  1000,
+						},
+					},
+					Namespaces: v1alpha1.MetricsNamespaces{
+						Include: []string{"default"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid metrics crd with unknown overflow policy",
+			obj: &v1alpha1.MetricsConfiguration{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "metricsconfig",
+				},
+				Spec: v1alpha1.MetricsSpec{
+					ContextOptions: []v1alpha1.MetricsContextOptions{
+						{
+							MetricName:     "drop_count",
+							TTL:            "10m",
+							MaxSeries:      1000,
+							OverflowPolicy: "Evict",
+						},
+					},
+					Namespaces: v1alpha1.MetricsNamespaces{
+						Include: []string{"default"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid metrics crd with aggregation",
+			obj: &v1alpha1.MetricsConfiguration{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "metricsconfig",
+				},
+				Spec: v1alpha1.MetricsSpec{
+					ContextOptions: []v1alpha1.MetricsContextOptions{
+						{
+							MetricName:  "forward_count",
+							Aggregation: v1alpha1.AggregationService,
+						},
+					},
+					Namespaces: v1alpha1.MetricsNamespaces{
+						Include: []string{"default"},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid metrics crd with aggregation and labels",
+			obj: &v1alpha1.MetricsConfiguration{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "metricsconfig",
+				},
+				Spec: v1alpha1.MetricsSpec{
+					ContextOptions: []v1alpha1.MetricsContextOptions{
+						{
+							MetricName:   "forward_count",
+							SourceLabels: []string{"podname"},
+							Aggregation:  v1alpha1.AggregationWorkload,
+						},
+					},
+					Namespaces: v1alpha1.MetricsNamespaces{
+						Include: []string{"default"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid metrics crd with cross zone traffic",
+			obj: &v1alpha1.MetricsConfiguration{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "metricsconfig",
+				},
+				Spec: v1alpha1.MetricsSpec{
+					ContextOptions: []v1alpha1.MetricsContextOptions{
+						{
+							MetricName:    "zone_traffic_bytes",
+							CrossZoneOnly: true,
+						},
+					},
+					Namespaces: v1alpha1.MetricsNamespaces{
+						Include: []string{"default"},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid metrics crd with crossZoneOnly on another metric",
+			obj: &v1alpha1.MetricsConfiguration{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "metricsconfig",
+				},
+				Spec: v1alpha1.MetricsSpec{
+					ContextOptions: []v1alpha1.MetricsContextOptions{
+						{
+							MetricName:    "forward_bytes",
+							CrossZoneOnly: true,
+						},
+					},
+					Namespaces: v1alpha1.MetricsNamespaces{
+						Include: []string{"default"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid metrics crd with dns domains",
+			obj: &v1alpha1.MetricsConfiguration{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "metricsconfig",
+				},
+				Spec: v1alpha1.MetricsSpec{
+					ContextOptions: []v1alpha1.MetricsContextOptions{
+						{
+							MetricName: "dns_failure_count",
+							DNSDomains: []string{"*.internal.corp", "api.example.com"},
+						},
+					},
+					Namespaces: v1alpha1.MetricsNamespaces{
+						Include: []string{"default"},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid metrics crd with dns domains on another metric",
+			obj: &v1alpha1.MetricsConfiguration{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "metricsconfig",
+				},
+				Spec: v1alpha1.MetricsSpec{
+					ContextOptions: []v1alpha1.MetricsContextOptions{
+						{
+							MetricName: "dns_response_count",
+							DNSDomains: []string{"*.internal.corp"},
+						},
+					},
+					Namespaces: v1alpha1.MetricsNamespaces{
+						Include: []string{"default"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid metrics crd with invalid dns domain",
+			obj: &v1alpha1.MetricsConfiguration{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "metricsconfig",
+				},
+				Spec: v1alpha1.MetricsSpec{
+					ContextOptions: []v1alpha1.MetricsContextOptions{
+						{
+							MetricName: "dns_failure_count",
+							DNSDomains: []string{"api.*.corp"},
+						},
+					},
+					Namespaces: v1alpha1.MetricsNamespaces{
+						Include: []string{"default"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid metrics crd with packet size buckets",
+			obj: &v1alpha1.MetricsConfiguration{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "metricsconfig",
+				},
+				Spec: v1alpha1.MetricsSpec{
+					ContextOptions: []v1alpha1.MetricsContextOptions{
+						{
+							MetricName: "packet_size",
+							Buckets:    []int64{64, 512, 1500, 9000},
+						},
+					},
+					Namespaces: v1alpha1.MetricsNamespaces{
+						Include: []string{"default"},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid metrics crd with buckets on another metric",
+			obj: &v1alpha1.MetricsConfiguration{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "metricsconfig",
+				},
+				Spec: v1alpha1.MetricsSpec{
+					ContextOptions: []v1alpha1.MetricsContextOptions{
+						{
+							MetricName: "forward_count",
+							Buckets:    []int64{64, 512},
+						},
+					},
+					Namespaces: v1alpha1.MetricsNamespaces{
+						Include: []string{"default"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid metrics crd with decreasing buckets",
+			obj: &v1alpha1.MetricsConfiguration{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "metricsconfig",
+				},
+				Spec: v1alpha1.MetricsSpec{
+					ContextOptions: []v1alpha1.MetricsContextOptions{
+						{
+							MetricName: "connection_size",
+							Buckets:    []int64{1024, 512},
+						},
+					},
+					Namespaces: v1alpha1.MetricsNamespaces{
+						Include: []string{"default"},
+					},
+				},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -120,6 +120,34 @@ func (in *CaptureList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CaptureNodeStatus) DeepCopyInto(out *CaptureNodeStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.ArtifactLocations != nil {
+		in, out := &in.ArtifactLocations, &out.ArtifactLocations
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CaptureNodeStatus.
+func (in *CaptureNodeStatus) DeepCopy() *CaptureNodeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CaptureNodeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CaptureOption) DeepCopyInto(out *CaptureOption) {
 	*out = *in
@@ -270,6 +298,13 @@ func (in *CaptureStatus) DeepCopyInto(out *CaptureStatus) {
 		in, out := &in.CompletionTime, &out.CompletionTime
 		*out = (*in).DeepCopy()
 	}
+	if in.NodeStatuses != nil {
+		in, out := &in.NodeStatuses, &out.NodeStatuses
+		*out = make([]CaptureNodeStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CaptureStatus.
@@ -332,6 +367,26 @@ func (in *Containers) DeepCopy() *Containers {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExceededSeriesBudget) DeepCopyInto(out *ExceededSeriesBudget) {
+	*out = *in
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExceededSeriesBudget.
+func (in *ExceededSeriesBudget) DeepCopy() *ExceededSeriesBudget {
+	if in == nil {
+		return nil
+	}
+	out := new(ExceededSeriesBudget)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IPBlock) DeepCopyInto(out *IPBlock) {
 	*out = *in
@@ -429,6 +484,16 @@ func (in *MetricsContextOptions) DeepCopyInto(out *MetricsContextOptions) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.DNSDomains != nil {
+		in, out := &in.DNSDomains, &out.DNSDomains
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Buckets != nil {
+		in, out := &in.Buckets, &out.Buckets
+		*out = make([]int64, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetricsContextOptions.
@@ -497,6 +562,13 @@ func (in *MetricsStatus) DeepCopyInto(out *MetricsStatus) {
 		*out = new(MetricsSpec)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.ExceededSeriesBudgets != nil {
+		in, out := &in.ExceededSeriesBudgets, &out.ExceededSeriesBudgets
+		*out = make([]ExceededSeriesBudget, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetricsStatus.
@@ -19,7 +19,10 @@ func TestGetConfig(t *testing.T) {
 		c.LogLevel != "info" ||
 		!c.EnableRetinaEndpoint ||
 		!c.RemoteContext ||
-		c.TelemetryInterval != 15*time.Minute {
+		c.TelemetryInterval != 15*time.Minute ||
+		c.CaptureTTLAfterFinished != 24*time.Hour ||
+		c.CaptureMaxPerNamespace != 10 ||
+		!c.CaptureCleanupArtifacts {
 		t.Errorf("Expeted config should be same as ./testwith/config.yaml; instead got %+v", c)
 	}
 }
@@ -0,0 +1,84 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package capture
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	captureConstants "github.com/microsoft/retina/pkg/capture/constants"
+	captureUtils "github.com/microsoft/retina/pkg/capture/utils"
+	"github.com/microsoft/retina/pkg/label"
+)
+
+const (
+	artifactCleanupJobSuffix = "-cleanup"
+	// maxJobNameLength keeps the job name usable as the value of the job-name label of its pods.
+	maxJobNameLength = 63
+	// jobNameHashLength is the length of the hex encoded hash of the capture job name kept in truncated names.
+	jobNameHashLength = 8
+
+	artifactCleanupJobTTLSecondsAfterFinished int32 = 300
+	artifactCleanupJobActiveDeadlineSeconds   int64 = 600
+)
+
+// NewArtifactCleanupJob returns a job removing the artifact of a capture job from its output locations. It reuses the
+// pod template of the capture job so that the cleanup runs on the same node with the same output locations and
+// credentials, and locates the artifact the same way the capture workload output it.
+func NewArtifactCleanupJob(captureJob *batchv1.Job) *batchv1.Job {
+	captureName := captureJob.Labels[label.CaptureNameLabel]
+
+	backoffLimit := int32(0)
+	ttlSecondsAfterFinished := artifactCleanupJobTTLSecondsAfterFinished
+	activeDeadlineSeconds := artifactCleanupJobActiveDeadlineSeconds
+
+	template := captureJob.Spec.Template.DeepCopy()
+	template.Labels = captureUtils.GetCleanupLabelsFromCaptureName(captureName)
+	template.Spec.TerminationGracePeriodSeconds = nil
+	template.Spec.RestartPolicy = corev1.RestartPolicyNever
+	for i := range template.Spec.Containers {
+		if template.Spec.Containers[i].Name != captureConstants.CaptureContainername {
+			continue
+		}
+		template.Spec.Containers[i].Env = append(template.Spec.Containers[i].Env, corev1.EnvVar{
+			Name:  captureConstants.CaptureCleanupEnvKey,
+			Value: "true",
+		})
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      artifactCleanupJobName(captureJob.Name),
+			Namespace: captureJob.Namespace,
+			Labels:    captureUtils.GetCleanupLabelsFromCaptureName(captureName),
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &backoffLimit,
+			TTLSecondsAfterFinished: &ttlSecondsAfterFinished,
+			ActiveDeadlineSeconds:   &activeDeadlineSeconds,
+			Template:                *template,
+		},
+	}
+}
+
+// artifactCleanupJobName returns the name of the cleanup job of a capture job. Capture job names end with a random
+// suffix, so a name that is too long keeps a hash of the full capture job name instead of its end, and the cleanup
+// jobs of the capture jobs of a Capture stay distinct.
+func artifactCleanupJobName(captureJobName string) string {
+	name := captureJobName + artifactCleanupJobSuffix
+	if len(name) <= maxJobNameLength {
+		return name
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(captureJobName))
+	hash := fmt.Sprintf("%0*x", jobNameHashLength, h.Sum32())
+
+	prefix := captureJobName[:maxJobNameLength-len(artifactCleanupJobSuffix)-len(hash)-1]
+	return prefix + "-" + hash + artifactCleanupJobSuffix
+}
@@ -0,0 +1,47 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package capture
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/microsoft/retina/pkg/label"
+)
+
+func TestNewArtifactCleanupJobName(t *testing.T) {
+	captureJob := func(name string) *batchv1.Job {
+		return &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    map[string]string{label.CaptureNameLabel: "capture"},
+		}}
+	}
+
+	t.Run("short capture name", func(t *testing.T) {
+		job := NewArtifactCleanupJob(captureJob("capture-abcde"))
+		assert.Equal(t, "capture-abcde-cleanup", job.Name)
+	})
+
+	t.Run("long capture name", func(t *testing.T) {
+		captureName := strings.Repeat("a", 60)
+		names := map[string]struct{}{}
+		for _, suffix := range []string{"abcde", "fghij", "klmno"} {
+			job := NewArtifactCleanupJob(captureJob(captureName + "-" + suffix))
+			require.Empty(t, validation.IsDNS1123Label(job.Name), "invalid job name %q", job.Name)
+			assert.True(t, strings.HasSuffix(job.Name, artifactCleanupJobSuffix))
+			names[job.Name] = struct{}{}
+		}
+		assert.Len(t, names, 3, "cleanup jobs of different capture jobs must have distinct names")
+
+		again := NewArtifactCleanupJob(captureJob(captureName + "-abcde"))
+		assert.Contains(t, names, again.Name, "cleanup job name must be stable")
+	})
+}
@@ -33,6 +33,9 @@ type CaptureManager struct {
 	l                      *log.ZapLogger
 	networkCaptureProvider captureProvider.NetworkCaptureProviderInterface
 	tel                    telemetry.Telemetry
+
+	// artifactLocations records where the capture tarball was output successfully.
+	artifactLocations []string
 }
 
 var errNegativeFileCount = errors.New("file count must be >= 0")
@@ -194,9 +197,12 @@ func (cm *CaptureManager) OutputCapture(ctx context.Context, srcDir string) erro
 	}
 
 	for _, location := range cm.enabledOutputLocations() {
-		if err := location.Output(ctx, dstTarGz); err != nil {
+		artifact, err := location.Output(ctx, dstTarGz)
+		if err != nil {
 			errs = fmt.Errorf("%w; location %q output error: %w", errs, location.Name(), err)
+			continue
 		}
+		cm.artifactLocations = append(cm.artifactLocations, artifact)
 	}
 
 	if errs != nil {
@@ -211,6 +217,45 @@ func (cm *CaptureManager) OutputCapture(ctx context.Context, srcDir string) erro
 	return nil
 }
 
+// RemoveOutput removes the artifact of the capture from the output locations that support removal. It is run by the
+// cleanup job of an expired capture, with the same environment as the capture job so that the artifact is located the
+// same way it was output.
+func (cm *CaptureManager) RemoveOutput(ctx context.Context) error {
+	startTimestamp, err := cm.captureStartTimestamp()
+	if err != nil {
+		return err
+	}
+	filename := file.CaptureFilename{CaptureName: cm.captureName(), NodeHostname: cm.captureNodeHostName(), StartTimestamp: startTimestamp}
+	tarballPath := filepath.Join(os.TempDir(), filename.String()) + ".tar.gz"
+
+	var errs error
+	for _, location := range cm.enabledOutputLocations() {
+		remover, ok := location.(captureOutput.Remover)
+		if !ok {
+			continue
+		}
+		if err := remover.Remove(ctx, tarballPath); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("location %q remove error: %w", location.Name(), err))
+		}
+	}
+	return errs
+}
+
+// Result summarizes the capture in srcDir and the outcome of outputting it. captureErr is the error, if any, that
+// stopped the capture workload.
+func (cm *CaptureManager) Result(srcDir string, captureErr error) *Result {
+	result := &Result{ArtifactLocations: cm.artifactLocations}
+	if srcDir != "" {
+		if err := collectCaptureStats(srcDir, result); err != nil {
+			cm.l.Warn("Failed to collect capture stats", zap.Error(err))
+		}
+	}
+	if captureErr != nil {
+		result.Error = captureErr.Error()
+	}
+	return result
+}
+
 func (cm *CaptureManager) enabledOutputLocations() []captureOutput.Location {
 	locations := []captureOutput.Location{}
 	if hostPath := captureOutput.NewHostPath(cm.l); hostPath.Enabled() {
@@ -8,4 +8,6 @@ const (
 	CaptureFilenameAnnotationKey  string = "retina-capture-filename"
 	CaptureTimestampAnnotationKey string = "retina-capture-timestamp"
 	CaptureHostPathAnnotationKey  string = "retina-capture-hostpath"
+	// CaptureExpiredAnnotationKey records why the operator expired a Capture under the retention policy.
+	CaptureExpiredAnnotationKey string = "retina-capture-expired"
 )
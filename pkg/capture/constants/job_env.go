@@ -42,4 +42,8 @@ const (
 	CaptureInterfacesEnvKey string = "CAPTURE_INTERFACES"
 
 	ApiserverEnvKey = "APISERVER"
+
+	// CaptureCleanupEnvKey switches the capture workload to removing the artifacts of the capture instead of
+	// capturing network traffic.
+	CaptureCleanupEnvKey = "CAPTURE_CLEANUP"
 )
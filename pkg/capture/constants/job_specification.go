@@ -23,8 +23,13 @@ const (
 	CaptureAppname        string = "capture"
 	CaptureContainername  string = "capture"
 	DownloadAppname       string = "download"
+	CleanupAppname        string = "capture-cleanup"
 	DownloadContainerName string = "download"
 
+	// CaptureTerminationMessagePath is the file the capture container writes its result to. The result is surfaced
+	// by the kubelet as the termination message of the container.
+	CaptureTerminationMessagePath string = "/dev/termination-log"
+
 	// CaptureOutputLocationBlobUploadSecretName is the name of the secret that stores the blob upload url.
 	CaptureOutputLocationBlobUploadSecretName string = "capture-blob-upload-secret"
 	// CaptureOutputLocationBlobUploadSecretPath is the path of the secret that stores the blob upload url.
@@ -185,9 +185,11 @@ func (translator *CaptureToPodTranslator) initJobTemplate(ctx context.Context, c
 					TerminationGracePeriodSeconds: &captureTerminationGracePeriodSeconds,
 					Containers: []corev1.Container{
 						{
-							Name:            captureConstants.CaptureContainername,
-							Image:           translator.captureWorkloadImage,
-							ImagePullPolicy: corev1.PullIfNotPresent,
+							Name:                     captureConstants.CaptureContainername,
+							Image:                    translator.captureWorkloadImage,
+							ImagePullPolicy:          corev1.PullIfNotPresent,
+							TerminationMessagePath:   captureConstants.CaptureTerminationMessagePath,
+							TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
 							SecurityContext: &corev1.SecurityContext{
 								Capabilities: &corev1.Capabilities{
 									Add: []corev1.Capability{
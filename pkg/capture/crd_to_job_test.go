@@ -1369,9 +1369,11 @@ func Test_CaptureToPodTranslator_TranslateCaptureToJobs(t *testing.T) {
 					TerminationGracePeriodSeconds: pointerUtil.Int64(1800),
 					Containers: []corev1.Container{
 						{
-							Name:            captureConstants.CaptureContainername,
-							Image:           retinaAgentImageForTest,
-							ImagePullPolicy: corev1.PullIfNotPresent,
+							Name:                     captureConstants.CaptureContainername,
+							Image:                    retinaAgentImageForTest,
+							ImagePullPolicy:          corev1.PullIfNotPresent,
+							TerminationMessagePath:   captureConstants.CaptureTerminationMessagePath,
+							TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
 							SecurityContext: &corev1.SecurityContext{
 								RunAsUser: &rootUser,
 								Capabilities: &corev1.Capabilities{
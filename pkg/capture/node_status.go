@@ -0,0 +1,159 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package capture
+
+import (
+	"sort"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	retinav1alpha1 "github.com/microsoft/retina/crd/api/v1alpha1"
+	captureConstants "github.com/microsoft/retina/pkg/capture/constants"
+)
+
+// legacyJobNameLabel is the pod label set by the job controller before batch.kubernetes.io/job-name was introduced.
+const legacyJobNameLabel = "job-name"
+
+// NodeStatusesFromJobs derives the per-node status of a capture from its jobs and their pods. The statistics of a
+// finished capture are read from the termination message of the capture container, see Result.
+func NodeStatusesFromJobs(jobs []batchv1.Job, pods []corev1.Pod) []retinav1alpha1.CaptureNodeStatus {
+	podsByJob := make(map[string][]*corev1.Pod, len(jobs))
+	for i := range pods {
+		jobName := pods[i].Labels[batchv1.JobNameLabel]
+		if jobName == "" {
+			jobName = pods[i].Labels[legacyJobNameLabel]
+		}
+		podsByJob[jobName] = append(podsByJob[jobName], &pods[i])
+	}
+
+	statuses := make([]retinav1alpha1.CaptureNodeStatus, 0, len(jobs))
+	for i := range jobs {
+		job := &jobs[i]
+		status := retinav1alpha1.CaptureNodeStatus{
+			NodeName: jobNodeName(job),
+			JobName:  job.Name,
+			Phase:    retinav1alpha1.CaptureNodePending,
+		}
+
+		if pod := latestPod(podsByJob[job.Name]); pod != nil {
+			if status.NodeName == "" {
+				status.NodeName = pod.Spec.NodeName
+			}
+			updateNodeStatusFromPod(&status, pod)
+		}
+
+		for _, c := range job.Status.Conditions {
+			if c.Status != corev1.ConditionTrue {
+				continue
+			}
+			switch c.Type { //nolint:exhaustive // only terminal conditions are relevant
+			case batchv1.JobComplete:
+				status.Phase = retinav1alpha1.CaptureNodeSucceeded
+			case batchv1.JobFailed:
+				status.Phase = retinav1alpha1.CaptureNodeFailed
+				if status.Error == "" {
+					status.Error = c.Message
+				}
+			}
+		}
+		if status.CompletionTime == nil && job.Status.CompletionTime != nil {
+			status.CompletionTime = job.Status.CompletionTime.DeepCopy()
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].NodeName < statuses[j].NodeName
+	})
+	return statuses
+}
+
+// jobNodeName returns the node a capture job is pinned to.
+func jobNodeName(job *batchv1.Job) string {
+	for _, container := range job.Spec.Template.Spec.Containers {
+		for _, env := range container.Env {
+			if env.Name == captureConstants.NodeHostNameEnvKey {
+				return env.Value
+			}
+		}
+	}
+	return ""
+}
+
+// latestPod returns the most recently created pod, as a job may have recreated its pod.
+func latestPod(pods []*corev1.Pod) *corev1.Pod {
+	var latest *corev1.Pod
+	for _, pod := range pods {
+		if latest == nil || latest.CreationTimestamp.Before(&pod.CreationTimestamp) {
+			latest = pod
+		}
+	}
+	return latest
+}
+
+func updateNodeStatusFromPod(status *retinav1alpha1.CaptureNodeStatus, pod *corev1.Pod) {
+	if pod.Status.StartTime != nil {
+		status.StartTime = pod.Status.StartTime.DeepCopy()
+	}
+	if pod.Status.Phase == corev1.PodRunning {
+		status.Phase = retinav1alpha1.CaptureNodeRunning
+	}
+
+	for i := range pod.Status.ContainerStatuses {
+		containerStatus := &pod.Status.ContainerStatuses[i]
+		if containerStatus.Name != captureConstants.CaptureContainername {
+			continue
+		}
+
+		if waiting := containerStatus.State.Waiting; waiting != nil && isContainerWaitingError(waiting.Reason) {
+			status.Error = strings.TrimSpace(waiting.Reason + ": " + waiting.Message)
+		}
+
+		terminated := containerStatus.State.Terminated
+		if terminated == nil {
+			continue
+		}
+		status.CompletionTime = terminated.FinishedAt.DeepCopy()
+		if terminated.ExitCode == 0 {
+			status.Phase = retinav1alpha1.CaptureNodeSucceeded
+		} else {
+			status.Phase = retinav1alpha1.CaptureNodeFailed
+		}
+
+		result, err := ParseResult(terminated.Message)
+		if err != nil {
+			// The container did not write a result, e.g. it crashed before the capture started, in which case the
+			// termination message holds the tail of its log.
+			if terminated.ExitCode != 0 {
+				status.Error = strings.TrimSpace(terminated.Reason + ": " + lastLine(terminated.Message))
+			}
+			continue
+		}
+		status.BytesCaptured = result.BytesCaptured
+		status.PacketsCaptured = result.PacketsCaptured
+		status.PacketsDroppedByKernel = result.PacketsDroppedByKernel
+		status.ArtifactLocations = result.ArtifactLocations
+		status.Error = result.Error
+	}
+}
+
+// isContainerWaitingError reports whether a waiting container is unlikely to start without intervention.
+func isContainerWaitingError(reason string) bool {
+	switch reason {
+	case "ErrImagePull", "ImagePullBackOff", "CrashLoopBackOff", "CreateContainerConfigError", "CreateContainerError", "InvalidImageName":
+		return true
+	}
+	return false
+}
+
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndex(s, "\n"); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
@@ -0,0 +1,112 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package capture
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	retinav1alpha1 "github.com/microsoft/retina/crd/api/v1alpha1"
+	captureConstants "github.com/microsoft/retina/pkg/capture/constants"
+)
+
+func captureJobOnNode(name, node string, conditions ...batchv1.JobCondition) batchv1.Job {
+	return batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name: captureConstants.CaptureContainername,
+						Env:  []corev1.EnvVar{{Name: captureConstants.NodeHostNameEnvKey, Value: node}},
+					}},
+				},
+			},
+		},
+		Status: batchv1.JobStatus{Conditions: conditions},
+	}
+}
+
+func capturePodOfJob(jobName string, phase corev1.PodPhase, state corev1.ContainerState) corev1.Pod {
+	start := metav1.NewTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: jobName + "-abcde", Labels: map[string]string{batchv1.JobNameLabel: jobName}},
+		Status: corev1.PodStatus{
+			Phase:     phase,
+			StartTime: &start,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  captureConstants.CaptureContainername,
+				State: state,
+			}},
+		},
+	}
+}
+
+func TestNodeStatusesFromJobs(t *testing.T) {
+	finishedAt := metav1.NewTime(time.Date(2024, 1, 1, 0, 1, 0, 0, time.UTC))
+	jobs := []batchv1.Job{
+		captureJobOnNode("capture-c", "node-c"),
+		captureJobOnNode("capture-b", "node-b", batchv1.JobCondition{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}),
+		captureJobOnNode("capture-a", "node-a", batchv1.JobCondition{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "Job has reached the specified backoff limit"}),
+		captureJobOnNode("capture-d", "node-d"),
+	}
+	pods := []corev1.Pod{
+		capturePodOfJob("capture-c", corev1.PodRunning, corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}),
+		capturePodOfJob("capture-b", corev1.PodSucceeded, corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+			FinishedAt: finishedAt,
+			Message:    `{"bytesCaptured":2048,"packetsCaptured":20,"packetsDroppedByKernel":2,"artifactLocations":["HostPath/b.tar.gz"]}`,
+		}}),
+		capturePodOfJob("capture-a", corev1.PodFailed, corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+			ExitCode:   1,
+			Reason:     "Error",
+			FinishedAt: finishedAt,
+			Message:    "starting capture\ntcpdump: eth9: No such device exists",
+		}}),
+	}
+
+	statuses := NodeStatusesFromJobs(jobs, pods)
+	require.Len(t, statuses, 4)
+
+	failed := statuses[0]
+	assert.Equal(t, "node-a", failed.NodeName)
+	assert.Equal(t, retinav1alpha1.CaptureNodeFailed, failed.Phase)
+	assert.Equal(t, "Error: tcpdump: eth9: No such device exists", failed.Error)
+
+	succeeded := statuses[1]
+	assert.Equal(t, "node-b", succeeded.NodeName)
+	assert.Equal(t, "capture-b", succeeded.JobName)
+	assert.Equal(t, retinav1alpha1.CaptureNodeSucceeded, succeeded.Phase)
+	assert.Equal(t, int64(2048), succeeded.BytesCaptured)
+	assert.Equal(t, int64(20), succeeded.PacketsCaptured)
+	assert.Equal(t, int64(2), succeeded.PacketsDroppedByKernel)
+	assert.Equal(t, []string{"HostPath/b.tar.gz"}, succeeded.ArtifactLocations)
+	assert.Equal(t, finishedAt, *succeeded.CompletionTime)
+
+	running := statuses[2]
+	assert.Equal(t, retinav1alpha1.CaptureNodeRunning, running.Phase)
+	require.NotNil(t, running.StartTime)
+	assert.Nil(t, running.CompletionTime)
+
+	pending := statuses[3]
+	assert.Equal(t, "node-d", pending.NodeName)
+	assert.Equal(t, retinav1alpha1.CaptureNodePending, pending.Phase)
+}
+
+func TestNodeStatusesFromJobsImagePullError(t *testing.T) {
+	jobs := []batchv1.Job{captureJobOnNode("capture-a", "node-a")}
+	pods := []corev1.Pod{capturePodOfJob("capture-a", corev1.PodPending, corev1.ContainerState{
+		Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "Back-off pulling image"},
+	})}
+
+	statuses := NodeStatusesFromJobs(jobs, pods)
+	require.Len(t, statuses, 1)
+	assert.Equal(t, retinav1alpha1.CaptureNodePending, statuses[0].Phase)
+	assert.Equal(t, "ImagePullBackOff: Back-off pulling image", statuses[0].Error)
+}
@@ -13,6 +13,7 @@ import (
 	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
 	"go.uber.org/zap"
 
 	captureConstants "github.com/microsoft/retina/pkg/capture/constants"
@@ -23,7 +24,10 @@ type BlobUpload struct {
 	l *log.ZapLogger
 }
 
-var _ Location = &BlobUpload{}
+var (
+	_ Location = &BlobUpload{}
+	_ Remover  = &BlobUpload{}
+)
 
 func NewBlobUpload(logger *log.ZapLogger) Location {
 	return &BlobUpload{l: logger}
@@ -42,30 +46,30 @@ func (bu *BlobUpload) Enabled() bool {
 	return true
 }
 
-func (bu *BlobUpload) Output(ctx context.Context, srcFilePath string) error {
+func (bu *BlobUpload) Output(ctx context.Context, srcFilePath string) (string, error) {
 	bu.l.Info("Upload capture file to blob.", zap.String("location", bu.Name()))
 	blobURL, err := readBlobSASURL()
 	if err != nil {
 		bu.l.Error("Failed to read blob url", zap.Error(err))
-		return err
+		return "", err
 	}
 
 	if err = validateBlobSASURL(blobURL); err != nil {
 		bu.l.Error("Failed to validate blob url", zap.Error(err))
-		return err
+		return "", err
 	}
 
 	// TODO: add retry policy
 	azClient, err := azblob.NewClientWithNoCredential(blobURL, nil)
 	if err != nil {
 		bu.l.Error("Failed to create blob client", zap.String("location", bu.Name()), zap.Error(err))
-		return err
+		return "", err
 	}
 
 	blobFile, err := os.Open(srcFilePath)
 	if err != nil {
 		bu.l.Error("Failed to open capture file", zap.Error(err))
-		return err
+		return "", err
 	}
 	defer blobFile.Close()
 
@@ -79,9 +83,46 @@ func (bu *BlobUpload) Output(ctx context.Context, srcFilePath string) error {
 		&azblob.UploadFileOptions{})
 	if err != nil {
 		bu.l.Error("Failed to upload file to storage account", zap.String("location", bu.Name()), zap.Error(err))
-		return err
+		return "", err
 	}
 	bu.l.Info("Done for uploading capture file to storage account", zap.String("location", bu.Name()))
+	return blobLocation(blobURL, blobName)
+}
+
+// blobLocation returns the URL of a blob in the container of the blob SAS URL, without the SAS token.
+func blobLocation(blobSASURL, blobName string) (string, error) {
+	u, err := url.Parse(blobSASURL)
+	if err != nil {
+		return "", err //nolint:wrapcheck // the URL is validated before the upload
+	}
+	u = u.JoinPath(blobName)
+	u.RawQuery = ""
+	return u.String(), nil
+}
+
+// Remove deletes the blob uploaded for srcFilePath, which requires the SAS token to grant the delete permission.
+func (bu *BlobUpload) Remove(ctx context.Context, srcFilePath string) error {
+	blobURL, err := readBlobSASURL()
+	if err != nil {
+		return err
+	}
+	if err = validateBlobSASURL(blobURL); err != nil {
+		return err
+	}
+
+	azClient, err := azblob.NewClientWithNoCredential(blobURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create blob client: %w", err)
+	}
+
+	blobName := filepath.Base(srcFilePath)
+	bu.l.Info("Delete blob", zap.String("location", bu.Name()), zap.String("blob name", blobName))
+	if _, err = azClient.DeleteBlob(ctx, "", blobName, nil); err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to delete blob %s: %w", blobName, err)
+	}
 	return nil
 }
 
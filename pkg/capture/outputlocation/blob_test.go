@@ -94,3 +94,13 @@ func TestValidateBlobSASURL(t *testing.T) {
 		})
 	}
 }
+
+func TestBlobLocation(t *testing.T) {
+	location, err := blobLocation("https://retina.blob.core.windows.net/container?sv=2022&sig=secret", "capture.tar.gz")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := "https://retina.blob.core.windows.net/container/capture.tar.gz"; location != expected {
+		t.Errorf("Expected %s without the SAS token, got %s", expected, location)
+	}
+}
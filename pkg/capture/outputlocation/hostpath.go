@@ -5,7 +5,6 @@ package outputlocation
 
 import (
 	"context"
-	"io"
 	"os"
 	"path/filepath"
 
@@ -19,7 +18,10 @@ type HostPath struct {
 	l *log.ZapLogger
 }
 
-var _ Location = &HostPath{}
+var (
+	_ Location = &HostPath{}
+	_ Remover  = &HostPath{}
+)
 
 func NewHostPath(logger *log.ZapLogger) Location {
 	return &HostPath{l: logger}
@@ -38,7 +40,7 @@ func (hp *HostPath) Enabled() bool {
 	return true
 }
 
-func (hp *HostPath) Output(_ context.Context, srcFilePath string) error {
+func (hp *HostPath) Output(_ context.Context, srcFilePath string) (string, error) {
 	hostPath := os.Getenv(string(captureConstants.CaptureOutputLocationEnvKeyHostPath))
 	hp.l.Info("Copy file",
 		zap.String("location", hp.Name()),
@@ -46,20 +48,16 @@ func (hp *HostPath) Output(_ context.Context, srcFilePath string) error {
 		zap.String("destination file path", hostPath),
 	)
 
-	srcFile, err := os.Open(srcFilePath)
-	if err != nil {
-		return err
-	}
-	defer srcFile.Close()
-
-	fileName := filepath.Base(srcFilePath)
-	fileHostPath := filepath.Join(hostPath, fileName)
-	destFile, err := os.Create(fileHostPath)
-	if err != nil {
-		return err
+	fileHostPath := filepath.Join(hostPath, filepath.Base(srcFilePath))
+	if err := copyFile(srcFilePath, fileHostPath); err != nil {
+		return "", err
 	}
-	defer destFile.Close()
+	return fileHostPath, nil
+}
 
-	_, err = io.Copy(destFile, srcFile)
-	return err
+func (hp *HostPath) Remove(_ context.Context, srcFilePath string) error {
+	hostPath := os.Getenv(string(captureConstants.CaptureOutputLocationEnvKeyHostPath))
+	fileHostPath := filepath.Join(hostPath, filepath.Base(srcFilePath))
+	hp.l.Info("Remove file", zap.String("location", hp.Name()), zap.String("file path", fileHostPath))
+	return removeIfExists(fileHostPath)
 }
@@ -3,13 +3,52 @@
 
 package outputlocation
 
-import "context"
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+)
 
 type Location interface {
 	// Name returns the name of the output location.
 	Name() string
 	// Enabled checks whether a output location is enabled.
 	Enabled() bool
-	// Output outputs source file to the location specified by the users.
-	Output(ctx context.Context, srcFilePath string) error
+	// Output outputs source file to the location specified by the users, and returns where it was written: the path on
+	// the node, the path in the persistent volume claim as <claim>:<path>, or the URL of the uploaded object.
+	Output(ctx context.Context, srcFilePath string) (string, error)
+}
+
+// Remover is implemented by output locations that can remove the artifact they stored, which is used to clean up the
+// artifacts of expired captures.
+type Remover interface {
+	// Remove removes the artifact stored for srcFilePath by Output.
+	Remove(ctx context.Context, srcFilePath string) error
+}
+
+// copyFile copies the file at src to dst, which is created or truncated.
+func copyFile(src, dst string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err //nolint:wrapcheck // the path is part of the error
+	}
+	defer srcFile.Close()
+
+	destFile, err := os.Create(dst)
+	if err != nil {
+		return err //nolint:wrapcheck // the path is part of the error
+	}
+	defer destFile.Close()
+
+	_, err = io.Copy(destFile, srcFile)
+	return err //nolint:wrapcheck // the paths are logged by the callers
+}
+
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err //nolint:wrapcheck // the path is part of the error
+	}
+	return nil
 }
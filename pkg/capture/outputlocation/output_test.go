@@ -6,9 +6,11 @@ package outputlocation
 import (
 	"context"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	captureConstants "github.com/microsoft/retina/pkg/capture/constants"
 	"github.com/microsoft/retina/pkg/log"
@@ -126,8 +128,39 @@ func TestOutput(t *testing.T) {
 				}
 			}()
 
-			err := tt.outputLocation.Output(ctx, tt.srcPath)
+			_, err := tt.outputLocation.Output(ctx, tt.srcPath)
 			assert.Equal(t, tt.hasError, err != nil, "Output check failed on source file open")
 		})
 	}
 }
+
+func TestHostPathRemove(t *testing.T) {
+	log.SetupZapLogger(log.GetDefaultLogOpts())
+	hostPath := t.TempDir()
+	t.Setenv(string(captureConstants.CaptureOutputLocationEnvKeyHostPath), hostPath)
+
+	artifact := filepath.Join(hostPath, "capture.tar.gz")
+	require.NoError(t, os.WriteFile(artifact, []byte("capture"), 0o600))
+
+	remover, ok := NewHostPath(log.Logger().Named(string(captureConstants.CaptureOutputLocationEnvKeyHostPath))).(Remover)
+	require.True(t, ok)
+	require.NoError(t, remover.Remove(context.Background(), "/tmp/capture.tar.gz"))
+	assert.NoFileExists(t, artifact)
+
+	// Removing an artifact which does not exist is not an error.
+	require.NoError(t, remover.Remove(context.Background(), "/tmp/capture.tar.gz"))
+}
+
+func TestHostPathOutput(t *testing.T) {
+	log.SetupZapLogger(log.GetDefaultLogOpts())
+	hostPath := t.TempDir()
+	t.Setenv(string(captureConstants.CaptureOutputLocationEnvKeyHostPath), hostPath)
+
+	src := filepath.Join(t.TempDir(), "capture.tar.gz")
+	require.NoError(t, os.WriteFile(src, []byte("capture"), 0o600))
+
+	location, err := NewHostPath(log.Logger().Named(string(captureConstants.CaptureOutputLocationEnvKeyHostPath))).Output(context.Background(), src)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(hostPath, "capture.tar.gz"), location, "should return the path of the artifact on the node")
+	assert.FileExists(t, location)
+}
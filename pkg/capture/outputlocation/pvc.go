@@ -5,7 +5,6 @@ package outputlocation
 
 import (
 	"context"
-	"io"
 	"os"
 	"path/filepath"
 
@@ -19,7 +18,10 @@ type PersistentVolumeClaim struct {
 	l *log.ZapLogger
 }
 
-var _ Location = &PersistentVolumeClaim{}
+var (
+	_ Location = &PersistentVolumeClaim{}
+	_ Remover  = &PersistentVolumeClaim{}
+)
 
 func NewPersistentVolumeClaim(logger *log.ZapLogger) Location {
 	return &PersistentVolumeClaim{l: logger}
@@ -38,27 +40,23 @@ func (pvc *PersistentVolumeClaim) Enabled() bool {
 	return true
 }
 
-func (pvc *PersistentVolumeClaim) Output(_ context.Context, srcFilePath string) error {
+func (pvc *PersistentVolumeClaim) Output(_ context.Context, srcFilePath string) (string, error) {
 	dstDir := captureConstants.PersistentVolumeClaimVolumeMountPathLinux
 	pvc.l.Info("Copy file",
 		zap.String("location", pvc.Name()),
 		zap.String("source file path", srcFilePath),
 		zap.String("destination file path", dstDir),
 	)
-	srcFile, err := os.Open(srcFilePath)
-	if err != nil {
-		return err
-	}
-	defer srcFile.Close()
-
 	fileName := filepath.Base(srcFilePath)
-	fileHostPath := filepath.Join(dstDir, fileName)
-	destFile, err := os.Create(fileHostPath)
-	if err != nil {
-		return err
+	if err := copyFile(srcFilePath, filepath.Join(dstDir, fileName)); err != nil {
+		return "", err
 	}
-	defer destFile.Close()
+	claim := os.Getenv(string(captureConstants.CaptureOutputLocationEnvKeyPersistentVolumeClaim))
+	return claim + ":/" + fileName, nil
+}
 
-	_, err = io.Copy(destFile, srcFile)
-	return err
+func (pvc *PersistentVolumeClaim) Remove(_ context.Context, srcFilePath string) error {
+	filePath := filepath.Join(captureConstants.PersistentVolumeClaimVolumeMountPathLinux, filepath.Base(srcFilePath))
+	pvc.l.Info("Remove file", zap.String("location", pvc.Name()), zap.String("file path", filePath))
+	return removeIfExists(filePath)
 }
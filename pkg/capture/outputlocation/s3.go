@@ -34,6 +34,7 @@ type S3Upload struct {
 
 var (
 	_                           Location = &S3Upload{}
+	_                           Remover  = &S3Upload{}
 	ErrSandboxMountPathNotFound          = errors.New("failed to find sandbox mount path")
 )
 
@@ -77,7 +78,7 @@ func (su *S3Upload) Enabled() bool {
 	return true
 }
 
-func (su *S3Upload) Output(ctx context.Context, srcFilePath string) error {
+func (su *S3Upload) Output(ctx context.Context, srcFilePath string) (string, error) {
 	objectKey := path.Join(su.path, srcFilePath)
 
 	su.l.Info("Upload capture file to s3",
@@ -90,14 +91,14 @@ func (su *S3Upload) Output(ctx context.Context, srcFilePath string) error {
 	s3Client, err := su.getClient(ctx)
 	if err != nil {
 		su.l.Error("Failed to get AWS client", zap.Error(err))
-		return err
+		return "", err
 	}
 
 	s3File, err := os.Open(srcFilePath)
 	if err != nil {
 		wrappedErr := fmt.Errorf("failed to open src file %s: %w", srcFilePath, err)
 		su.l.Error("Failed to open capture file", zap.Error(wrappedErr))
-		return wrappedErr
+		return "", wrappedErr
 	}
 	defer s3File.Close()
 
@@ -113,6 +114,30 @@ func (su *S3Upload) Output(ctx context.Context, srcFilePath string) error {
 			zap.String("bucketName", su.bucket),
 			zap.String("objectKey", objectKey),
 			zap.Error(wrappedErr))
+		return "", wrappedErr
+	}
+	return "s3://" + path.Join(su.bucket, objectKey), nil
+}
+
+// Remove deletes the object uploaded for srcFilePath, which requires the credentials to grant s3:DeleteObject.
+func (su *S3Upload) Remove(ctx context.Context, srcFilePath string) error {
+	objectKey := path.Join(su.path, srcFilePath)
+	su.l.Info("Delete capture file from s3",
+		zap.String("location", su.Name()),
+		zap.String("bucketName", su.bucket),
+		zap.String("objectKey", objectKey),
+	)
+
+	s3Client, err := su.getClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err = s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(su.bucket),
+		Key:    aws.String(objectKey),
+	}); err != nil {
+		return fmt.Errorf("failed to delete object %s from S3: %w", objectKey, err)
 	}
 	return nil
 }
@@ -0,0 +1,103 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package capture
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// tcpdumpLogFileName is the file in the capture folder holding the output of tcpdump.
+const tcpdumpLogFileName = "tcpdump.log"
+
+var (
+	tcpdumpPacketsCapturedRegex = regexp.MustCompile(`(?m)^(\d+) packets? captured`)
+	tcpdumpPacketsDroppedRegex  = regexp.MustCompile(`(?m)^(\d+) packets? dropped by kernel`)
+)
+
+// Result is the outcome of a capture on a single node.
+// The capture workload writes it as the termination message of its container so that the operator and the CLI can
+// report per-node results without access to the node.
+type Result struct {
+	BytesCaptured          int64    `json:"bytesCaptured,omitempty"`
+	PacketsCaptured        int64    `json:"packetsCaptured,omitempty"`
+	PacketsDroppedByKernel int64    `json:"packetsDroppedByKernel,omitempty"`
+	ArtifactLocations      []string `json:"artifactLocations,omitempty"`
+	Error                  string   `json:"error,omitempty"`
+}
+
+// WriteResult writes the result of the capture to the termination message file of the container.
+func WriteResult(path string, result *Result) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to marshal capture result: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil { //nolint:gosec // termination message is read by the kubelet
+		return fmt.Errorf("failed to write capture result to %s: %w", path, err)
+	}
+	return nil
+}
+
+// ParseResult parses the termination message of a capture container.
+func ParseResult(message string) (*Result, error) {
+	result := &Result{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(message)), result); err != nil {
+		return nil, fmt.Errorf("failed to parse capture result: %w", err)
+	}
+	return result, nil
+}
+
+// collectCaptureStats fills the size of the capture files in srcDir and, when available, the packet counters
+// tcpdump prints on exit.
+func collectCaptureStats(srcDir string, result *Result) error {
+	entries, err := os.ReadDir(srcDir)
+	if err != nil {
+		return fmt.Errorf("failed to read capture folder %s: %w", srcDir, err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !isCaptureFile(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("failed to get info of capture file %s: %w", entry.Name(), err)
+		}
+		result.BytesCaptured += info.Size()
+	}
+
+	tcpdumpLog, err := os.ReadFile(filepath.Join(srcDir, tcpdumpLogFileName))
+	if err != nil {
+		// netsh on Windows does not produce tcpdump.log, leave packet counters unset.
+		return nil //nolint:nilerr // packet counters are optional
+	}
+	result.PacketsCaptured, result.PacketsDroppedByKernel = parseTcpdumpStats(string(tcpdumpLog))
+	return nil
+}
+
+// isCaptureFile reports whether the file holds captured packets, including the rotated tcpdump files
+// (e.g. x.pcap0, x.pcap1) and netsh trace files.
+func isCaptureFile(name string) bool {
+	ext := filepath.Ext(name)
+	return strings.HasPrefix(ext, ".pcap") || ext == ".etl"
+}
+
+// parseTcpdumpStats extracts the packet counters tcpdump prints when it exits, e.g.
+//
+//	42 packets captured
+//	45 packets received by filter
+//	3 packets dropped by kernel
+func parseTcpdumpStats(tcpdumpLog string) (captured, dropped int64) {
+	if m := tcpdumpPacketsCapturedRegex.FindStringSubmatch(tcpdumpLog); m != nil {
+		captured, _ = strconv.ParseInt(m[1], 10, 64)
+	}
+	if m := tcpdumpPacketsDroppedRegex.FindStringSubmatch(tcpdumpLog); m != nil {
+		dropped, _ = strconv.ParseInt(m[1], 10, 64)
+	}
+	return captured, dropped
+}
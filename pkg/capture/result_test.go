@@ -0,0 +1,64 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package capture
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTcpdumpStats(t *testing.T) {
+	tcpdumpLog := `tcpdump -w /tmp/capture.pcap --relinquish-privileges=root
+
+tcpdump: listening on eth0, link-type EN10MB (Ethernet), snapshot length 262144 bytes
+42 packets captured
+45 packets received by filter
+3 packets dropped by kernel
+`
+	captured, dropped := parseTcpdumpStats(tcpdumpLog)
+	assert.Equal(t, int64(42), captured)
+	assert.Equal(t, int64(3), dropped)
+
+	captured, dropped = parseTcpdumpStats("tcpdump: listening on eth0\n")
+	assert.Zero(t, captured)
+	assert.Zero(t, dropped)
+}
+
+func TestCollectCaptureStats(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "capture.pcap0"), make([]byte, 100), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "capture.pcap1"), make([]byte, 50), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ip-resources.txt"), make([]byte, 1000), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, tcpdumpLogFileName), []byte("1 packet captured\n0 packets dropped by kernel\n"), 0o600))
+
+	result := &Result{}
+	require.NoError(t, collectCaptureStats(dir, result))
+	assert.Equal(t, int64(150), result.BytesCaptured)
+	assert.Equal(t, int64(1), result.PacketsCaptured)
+	assert.Zero(t, result.PacketsDroppedByKernel)
+}
+
+func TestWriteAndParseResult(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "termination-log")
+	want := &Result{
+		BytesCaptured:          1024,
+		PacketsCaptured:        10,
+		PacketsDroppedByKernel: 1,
+		ArtifactLocations:      []string{"HostPath/capture.tar.gz"},
+	}
+	require.NoError(t, WriteResult(path, want))
+
+	message, err := os.ReadFile(path)
+	require.NoError(t, err)
+	got, err := ParseResult(string(message))
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	_, err = ParseResult("panic: runtime error")
+	require.Error(t, err)
+}
@@ -35,3 +35,10 @@ func GetDownloadLabelsFromCaptureName(captureName string) map[string]string {
 		label.CaptureNameLabel: captureName,
 	}
 }
+
+func GetCleanupLabelsFromCaptureName(captureName string) map[string]string {
+	return map[string]string{
+		label.AppLabel:         captureConstants.CleanupAppname,
+		label.CaptureNameLabel: captureName,
+	}
+}
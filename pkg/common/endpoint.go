@@ -147,10 +147,7 @@ func (ep *RetinaEndpoint) SetAnnotations(annotations map[string]string) {
 	ep.Lock()
 	defer ep.Unlock()
 	if annotations != nil {
-		ep.annotations = make(map[string]string)
-		if _, ok := annotations[RetinaPodAnnotation]; ok {
-			ep.annotations[RetinaPodAnnotation] = annotations[RetinaPodAnnotation]
-		}
+		ep.annotations = RetinaAnnotations(annotations)
 	}
 }
 
@@ -16,8 +16,23 @@ const (
 	// default value for annotations
 	RetinaPodAnnotation      = "retina.sh"
 	RetinaPodAnnotationValue = "observe"
+	// RetinaMetricsAnnotation selects the advanced metrics of a pod or namespace, e.g. "dns,tcpretrans"
+	RetinaMetricsAnnotation = "retina.sh/metrics"
+	// RetinaLabelsAnnotation selects the context labels of the advanced metrics of a pod or namespace, e.g. "workload,port"
+	RetinaLabelsAnnotation = "retina.sh/labels"
 )
 
+// RetinaAnnotations returns the retina annotations among the given annotations.
+func RetinaAnnotations(annotations map[string]string) map[string]string {
+	retinaAnnotations := make(map[string]string)
+	for _, k := range []string{RetinaPodAnnotation, RetinaMetricsAnnotation, RetinaLabelsAnnotation} {
+		if v, ok := annotations[k]; ok {
+			retinaAnnotations[k] = v
+		}
+	}
+	return retinaAnnotations
+}
+
 // Important note: any changes to these structs must be reflected in the DeepCopy() method.
 
 // PublishObj is an interface that all objects that are published
@@ -59,7 +74,7 @@ func RetinaEndpointCommonFromAPI(retinaEndpoint *retinav1alpha1.RetinaEndpoint)
 		ownerRefs:   []*OwnerReference{},
 		containers:  []*RetinaContainer{},
 		labels:      retinaEndpoint.Labels,
-		annotations: make(map[string]string),
+		annotations: RetinaAnnotations(retinaEndpoint.Spec.Annotations),
 		nodeIP:      retinaEndpoint.Spec.NodeIP,
 	}
 
@@ -100,12 +115,6 @@ func RetinaEndpointCommonFromAPI(retinaEndpoint *retinav1alpha1.RetinaEndpoint)
 	retinaEndpointCommon.ips.OtherIPv4s = OtherIPv4s
 	retinaEndpointCommon.ips.OtherIPv6s = OtherIPv6s
 
-	for k, v := range retinaEndpoint.Spec.Annotations {
-		if k == RetinaPodAnnotation {
-			retinaEndpointCommon.annotations[k] = v
-		}
-	}
-
 	return retinaEndpointCommon
 }
 
@@ -120,7 +129,7 @@ func RetinaEndpointCommonFromPod(pod *corev1.Pod) *RetinaEndpoint {
 		ownerRefs:   []*OwnerReference{},
 		containers:  []*RetinaContainer{},
 		labels:      pod.Labels,
-		annotations: make(map[string]string),
+		annotations: RetinaAnnotations(pod.GetAnnotations()),
 	}
 
 	for _, ownerRef := range pod.ObjectMeta.OwnerReferences {
@@ -160,12 +169,6 @@ func RetinaEndpointCommonFromPod(pod *corev1.Pod) *RetinaEndpoint {
 	retinaEndpointCommon.ips.OtherIPv4s = OtherIPv4s
 	retinaEndpointCommon.ips.OtherIPv6s = OtherIPv6s
 
-	for k, v := range pod.GetAnnotations() {
-		if k == RetinaPodAnnotation {
-			retinaEndpointCommon.annotations[k] = v
-		}
-	}
-
 	return retinaEndpointCommon
 }
 
@@ -187,8 +187,9 @@ func TestRetinaEndpointCommonFromPod(t *testing.T) {
 						ownerReference,
 					},
 					Annotations: map[string]string{
-						RetinaPodAnnotation: RetinaPodAnnotationValue,
-						"test":              "test",
+						RetinaPodAnnotation:     RetinaPodAnnotationValue,
+						RetinaMetricsAnnotation: "dns,tcpretrans",
+						"test":                  "test",
 					},
 					Labels: map[string]string{
 						"test": "test",
@@ -231,7 +232,8 @@ func TestRetinaEndpointCommonFromPod(t *testing.T) {
 					},
 				},
 				annotations: map[string]string{
-					RetinaPodAnnotation: RetinaPodAnnotationValue,
+					RetinaPodAnnotation:     RetinaPodAnnotationValue,
+					RetinaMetricsAnnotation: "dns,tcpretrans",
 				},
 				labels: map[string]string{
 					"test": "test",
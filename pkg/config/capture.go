@@ -3,6 +3,8 @@
 package config
 
 import (
+	"time"
+
 	captureUtils "github.com/microsoft/retina/pkg/capture/utils"
 )
 
@@ -35,4 +37,16 @@ type CaptureConfig struct {
 	// place artifacts anywhere else on the node filesystem.
 	// If unset, the operator defaults to /var/log/retina/captures.
 	CaptureHostPathBaseDir string `yaml:"captureHostPathBaseDir"`
+
+	// Retention policy of Captures.
+	//
+	// CaptureTTLAfterFinished is how long a finished Capture is kept before the operator deletes it together with its
+	// jobs. Zero disables the TTL.
+	CaptureTTLAfterFinished time.Duration `yaml:"captureTTLAfterFinished"`
+	// CaptureMaxPerNamespace is the maximum number of Captures kept in a namespace. When it is exceeded, the oldest
+	// finished Captures are deleted. Zero disables the limit.
+	CaptureMaxPerNamespace int `yaml:"captureMaxPerNamespace"`
+	// CaptureCleanupArtifacts indicates whether the artifacts of Captures deleted by the retention policy are removed
+	// from their output locations as well.
+	CaptureCleanupArtifacts bool `yaml:"captureCleanupArtifacts"`
 }
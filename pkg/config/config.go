@@ -27,6 +27,16 @@ const (
 	TCXModeOff TCXMode = "off"
 )
 
+// TCPInfoAggregation controls how the tcpinfo plugin aggregates the statistics of the sockets.
+type TCPInfoAggregation string
+
+const (
+	// TCPInfoAggregationPod aggregates the statistics of the sockets by pod.
+	TCPInfoAggregationPod TCPInfoAggregation = "pod"
+	// TCPInfoAggregationWorkload aggregates the statistics of the sockets by workload, to bound the cardinality.
+	TCPInfoAggregationWorkload TCPInfoAggregation = "workload"
+)
+
 const MinTelemetryInterval time.Duration = 2 * time.Minute
 
 const (
@@ -44,6 +54,8 @@ const (
 
 var (
 	ErrEnableTCXInvalid                       = errors.New("enableTCX must be \"auto\" or \"off\"")
+	ErrConntrackTableWarningThresholdInvalid  = errors.New("conntrackTableWarningThreshold must be between 0 and 1")
+	ErrTCPInfoAggregationInvalid              = errors.New("tcpInfoAggregation must be \"pod\" or \"workload\"")
 	ErrPacketParserRingBufferAutoNotSupported = errors.New("packetParserRingBuffer mode auto is not supported yet")
 	ErrPacketParserRingBufferInvalid          = errors.New("packetParserRingBuffer must be set to enabled or disabled")
 	ErrPacketParserRingBufferInvalidBool      = errors.New(
@@ -62,6 +74,11 @@ var (
 	DefaultConntrackReportInterval    = 30 * time.Second
 )
 
+const (
+	DefaultFlowRecordingMaxFileSizeMB = 10
+	DefaultFlowRecordingMaxFiles      = 5
+)
+
 func (l *Level) UnmarshalText(text []byte) error {
 	s := strings.ToLower(string(text))
 	switch s {
@@ -137,6 +154,21 @@ type Config struct {
 	PacketParserRingBufferSize uint32                     `yaml:"packetParserRingBufferSize"`
 	FilterMapMaxEntries        uint32                     `yaml:"filterMapMaxEntries"`
 	EnableTCX                  TCXMode                    `yaml:"enableTCX"`
+	// ConntrackTableTopPods is the number of source pods with the most nf_conntrack entries exported by the
+	// nfconntrack plugin, 0 disables the dumps of the table.
+	ConntrackTableTopPods int `yaml:"conntrackTableTopPods"`
+	// ConntrackTableWarningThreshold is the fill ratio of the nf_conntrack table above which the nfconntrack plugin
+	// logs a warning and posts an event on the node, 0 disables the warning.
+	ConntrackTableWarningThreshold float64 `yaml:"conntrackTableWarningThreshold"`
+	// TCPInfoAggregation is the aggregation of the socket statistics exported by the tcpinfo plugin.
+	TCPInfoAggregation TCPInfoAggregation `yaml:"tcpInfoAggregation"`
+	// FlowRecordingDir is the directory where the flows written to the enricher are recorded for offline replay, empty
+	// disables the recording.
+	FlowRecordingDir string `yaml:"flowRecordingDir"`
+	// FlowRecordingMaxFileSizeMB is the size in MiB at which a flow recording is rotated.
+	FlowRecordingMaxFileSizeMB int `yaml:"flowRecordingMaxFileSizeMB"`
+	// FlowRecordingMaxFiles is the number of flow recordings kept in FlowRecordingDir.
+	FlowRecordingMaxFiles int `yaml:"flowRecordingMaxFiles"`
 }
 
 func GetConfig(cfgFilename string) (*Config, error) {
@@ -213,6 +245,27 @@ func GetConfig(cfgFilename string) (*Config, error) {
 		return nil, fmt.Errorf("invalid enableTCX %q: %w", config.EnableTCX, ErrEnableTCXInvalid)
 	}
 
+	if config.ConntrackTableWarningThreshold < 0 || config.ConntrackTableWarningThreshold > 1 {
+		return nil, fmt.Errorf("invalid conntrackTableWarningThreshold %v: %w", config.ConntrackTableWarningThreshold, ErrConntrackTableWarningThresholdInvalid)
+	}
+
+	// Default TCPInfoAggregation to "pod" if unset, reject unknown values.
+	switch config.TCPInfoAggregation {
+	case "":
+		config.TCPInfoAggregation = TCPInfoAggregationPod
+	case TCPInfoAggregationPod, TCPInfoAggregationWorkload:
+		// valid
+	default:
+		return nil, fmt.Errorf("invalid tcpInfoAggregation %q: %w", config.TCPInfoAggregation, ErrTCPInfoAggregationInvalid)
+	}
+
+	if config.FlowRecordingMaxFileSizeMB <= 0 {
+		config.FlowRecordingMaxFileSizeMB = DefaultFlowRecordingMaxFileSizeMB
+	}
+	if config.FlowRecordingMaxFiles <= 0 {
+		config.FlowRecordingMaxFiles = DefaultFlowRecordingMaxFiles
+	}
+
 	switch config.PacketParserRingBuffer { //nolint:exhaustive // we only care about Auto and empty (default) here
 	case "":
 		config.PacketParserRingBuffer = PacketParserRingBufferDisabled
@@ -112,6 +112,53 @@ func TestGetConfig_EnableTCX(t *testing.T) {
 	}
 }
 
+func TestGetConfig_ConntrackTable(t *testing.T) {
+	cfg, err := GetConfig("./testwith/config-conntrack-table.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, 10, cfg.ConntrackTableTopPods)
+	assert.InDelta(t, 0.9, cfg.ConntrackTableWarningThreshold, 0)
+
+	_, err = GetConfig("./testwith/config-conntrack-table-invalid.yaml")
+	require.ErrorIs(t, err, ErrConntrackTableWarningThresholdInvalid)
+}
+
+func TestGetConfig_TCPInfoAggregation(t *testing.T) {
+	tests := []struct {
+		name          string
+		configFile    string
+		expected      TCPInfoAggregation
+		expectedError error
+	}{
+		{
+			name:       "workload",
+			configFile: "./testwith/config-tcpinfo-workload.yaml",
+			expected:   TCPInfoAggregationWorkload,
+		},
+		{
+			name:       "empty defaults to pod",
+			configFile: "./testwith/config-tcx-auto.yaml",
+			expected:   TCPInfoAggregationPod,
+		},
+		{
+			name:          "invalid value rejected",
+			configFile:    "./testwith/config-tcpinfo-invalid.yaml",
+			expectedError: ErrTCPInfoAggregationInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := GetConfig(tt.configFile)
+			if tt.expectedError != nil {
+				require.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cfg.TCPInfoAggregation)
+		})
+	}
+}
+
 func TestDecodePacketParserRingBufferModeHook(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -4,6 +4,7 @@ package cache
 
 import (
 	"fmt"
+	"maps"
 	"net"
 	"sort"
 	"sync"
@@ -20,6 +21,10 @@ type Cache struct {
 	// endpointMap is a map of pod key (namespace/name) to RetinaEndpoint
 	epMap map[string]*common.RetinaEndpoint
 
+	// hostNetworkEpMap is a map of pod key (namespace/name) to RetinaEndpoint of the pods in the host network, which
+	// share the IP of the node and are not indexed by IP
+	hostNetworkEpMap map[string]*common.RetinaEndpoint
+
 	// svcMap is a map of service key (namespace/name) to RetinaSvc
 	svcMap map[string]*common.RetinaSvc
 
@@ -41,22 +46,27 @@ type Cache struct {
 	// nsAnnotated is a map of annotated namespaces to watch
 	nsAnnotated map[string]bool
 
+	// nsAnnotations is a map of annotated namespaces to their retina annotations
+	nsAnnotations map[string]map[string]string
+
 	pubsub pubsub.PubSubInterface
 }
 
 // NewCache returns a new instance of Cache.
 func New(p pubsub.PubSubInterface) *Cache {
 	c := &Cache{
-		l:            log.Logger().Named(string("Cache")),
-		epMap:        make(map[string]*common.RetinaEndpoint),
-		svcMap:       make(map[string]*common.RetinaSvc),
-		ipToEpKey:    make(map[string]string),
-		ipToSvcKey:   make(map[string]string),
-		nodeMap:      make(map[string]*common.RetinaNode),
-		ipToNodeName: make(map[string]string),
-		nsMap:        make(map[string]int),
-		nsAnnotated:  make(map[string]bool),
-		pubsub:       p,
+		l:                log.Logger().Named(string("Cache")),
+		epMap:            make(map[string]*common.RetinaEndpoint),
+		hostNetworkEpMap: make(map[string]*common.RetinaEndpoint),
+		svcMap:           make(map[string]*common.RetinaSvc),
+		ipToEpKey:        make(map[string]string),
+		ipToSvcKey:       make(map[string]string),
+		nodeMap:          make(map[string]*common.RetinaNode),
+		ipToNodeName:     make(map[string]string),
+		nsMap:            make(map[string]int),
+		nsAnnotated:      make(map[string]bool),
+		nsAnnotations:    make(map[string]map[string]string),
+		pubsub:           p,
 	}
 
 	cbFunc := pubsub.CallBackFunc(c.SubscribeAPIServerFn)
@@ -184,6 +194,21 @@ func (c *Cache) GetAllNamespaces() []string {
 	return namespaces
 }
 
+// GetPods returns the pods in the cache, including the pods in the host network.
+func (c *Cache) GetPods() []*common.RetinaEndpoint {
+	c.RLock()
+	defer c.RUnlock()
+
+	pods := make([]*common.RetinaEndpoint, 0, len(c.epMap)+len(c.hostNetworkEpMap))
+	for _, ep := range c.epMap {
+		pods = append(pods, ep)
+	}
+	for _, ep := range c.hostNetworkEpMap {
+		pods = append(pods, ep)
+	}
+	return pods
+}
+
 func (c *Cache) GetIPsByNamespace(ns string) []net.IP {
 	c.RLock()
 	defer c.RUnlock()
@@ -248,6 +273,16 @@ func (c *Cache) updateEndpoint(ep *common.RetinaEndpoint) error {
 	return nil
 }
 
+// UpdateHostNetworkRetinaEndpoint updates the cache with the given retina endpoint of a pod in the host network. It is
+// not indexed by IP, as it shares the IP of the node, and no event is published.
+func (c *Cache) UpdateHostNetworkRetinaEndpoint(ep *common.RetinaEndpoint) error {
+	c.Lock()
+	defer c.Unlock()
+
+	c.hostNetworkEpMap[ep.Key()] = ep
+	return nil
+}
+
 // UpdateRetinaSvc updates the cache with the given retina service.
 func (c *Cache) UpdateRetinaSvc(svc *common.RetinaSvc) error {
 	c.Lock()
@@ -329,6 +364,8 @@ func (c *Cache) DeleteRetinaEndpoint(epKey string) error {
 
 // deleteEndpoint deletes the given retina endpoint from the cache.
 func (c *Cache) deleteEndpoint(epKey string) error {
+	delete(c.hostNetworkEpMap, epKey)
+
 	ep, ok := c.epMap[epKey]
 	if !ok {
 		c.l.Debug("endpoint not found in cache", zap.String("endpoint", epKey))
@@ -490,6 +527,7 @@ func (c *Cache) DeleteAnnotatedNamespace(ns string) {
 	defer c.Unlock()
 
 	delete(c.nsAnnotated, ns)
+	delete(c.nsAnnotations, ns)
 }
 
 func (c *Cache) AddAnnotatedNamespace(ns string) {
@@ -509,3 +547,20 @@ func (c *Cache) GetAnnotatedNamespaces() []string {
 	sort.Strings(ns)
 	return ns
 }
+
+func (c *Cache) SetNamespaceAnnotations(ns string, annotations map[string]string) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.nsAnnotations[ns] = common.RetinaAnnotations(annotations)
+}
+
+func (c *Cache) GetNamespaceAnnotations() map[string]map[string]string {
+	c.RLock()
+	defer c.RUnlock()
+	annotations := make(map[string]map[string]string, len(c.nsAnnotations))
+	for ns, a := range c.nsAnnotations {
+		annotations[ns] = maps.Clone(a)
+	}
+	return annotations
+}
@@ -375,12 +375,18 @@ func TestCachingNamespace(t *testing.T) {
 	ns := "test-ns"
 
 	c.AddAnnotatedNamespace(ns)
+	c.SetNamespaceAnnotations(ns, map[string]string{
+		common.RetinaMetricsAnnotation: "dns",
+		"other":                        "value",
+	})
 	namespaces := c.GetAnnotatedNamespaces()
 	assert.Equal(t, 1, len(namespaces))
 	assert.Equal(t, ns, namespaces[0])
+	assert.Equal(t, map[string]map[string]string{ns: {common.RetinaMetricsAnnotation: "dns"}}, c.GetNamespaceAnnotations())
 	c.DeleteAnnotatedNamespace(ns)
 	namespaces = c.GetAnnotatedNamespaces()
 	assert.Equal(t, 0, len(namespaces))
+	assert.Empty(t, c.GetNamespaceAnnotations())
 }
 
 func TestGetAllNamespaces(t *testing.T) {
@@ -411,3 +417,38 @@ func TestGetAllNamespaces(t *testing.T) {
 	assert.Len(t, namespaces, 2)
 	assert.ElementsMatch(t, []string{"ns1", "ns2"}, namespaces)
 }
+
+func TestHostNetworkPods(t *testing.T) {
+	_, _ = log.SetupZapLogger(log.GetDefaultLogOpts())
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	p := pubsub.NewMockPubSubInterface(ctrl)
+	p.EXPECT().Subscribe(common.PubSubAPIServer, gomock.Any()).Times(1)
+	p.EXPECT().Publish(gomock.Any(), gomock.Any()).AnyTimes()
+	c := New(p)
+
+	pod := common.NewRetinaEndpoint("pod1", "ns1", &common.IPAddresses{IPv4: net.IPv4(10, 0, 0, 1)})
+	require.NoError(t, c.UpdateRetinaEndpoint(pod))
+	node := common.NewRetinaNode("node1", net.IPv4(10, 0, 1, 1), "")
+	require.NoError(t, c.UpdateRetinaNode(node))
+
+	// the pods in the host network share the IP of the node, which still resolves to the node
+	hostPod := common.NewRetinaEndpoint("pod2", "ns2", &common.IPAddresses{IPv4: net.IPv4(10, 0, 1, 1)})
+	require.NoError(t, c.UpdateHostNetworkRetinaEndpoint(hostPod))
+	assert.Nil(t, c.GetPodByIP("10.0.1.1"))
+	assert.NotNil(t, c.GetNodeByIP("10.0.1.1"))
+	assert.ElementsMatch(t, []string{"ns1"}, c.GetAllNamespaces())
+
+	keys := func() []string {
+		var k []string
+		for _, ep := range c.GetPods() {
+			k = append(k, ep.Key())
+		}
+		return k
+	}
+	assert.ElementsMatch(t, []string{"ns1/pod1", "ns2/pod2"}, keys())
+
+	require.NoError(t, c.DeleteRetinaEndpoint(hostPod.Key()))
+	assert.ElementsMatch(t, []string{"ns1/pod1"}, keys())
+	assert.NotNil(t, c.GetNodeByIP("10.0.1.1"))
+}
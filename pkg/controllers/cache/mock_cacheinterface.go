@@ -154,6 +154,20 @@ func (mr *MockCacheInterfaceMockRecorder) GetIPsByNamespace(arg0 any) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetIPsByNamespace", reflect.TypeOf((*MockCacheInterface)(nil).GetIPsByNamespace), arg0)
 }
 
+// GetNamespaceAnnotations mocks base method.
+func (m *MockCacheInterface) GetNamespaceAnnotations() map[string]map[string]string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetNamespaceAnnotations")
+	ret0, _ := ret[0].(map[string]map[string]string)
+	return ret0
+}
+
+// GetNamespaceAnnotations indicates an expected call of GetNamespaceAnnotations.
+func (mr *MockCacheInterfaceMockRecorder) GetNamespaceAnnotations() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNamespaceAnnotations", reflect.TypeOf((*MockCacheInterface)(nil).GetNamespaceAnnotations))
+}
+
 // GetNodeByIP mocks base method.
 func (m *MockCacheInterface) GetNodeByIP(arg0 string) *common.RetinaNode {
 	m.ctrl.T.Helper()
@@ -196,6 +210,20 @@ func (mr *MockCacheInterfaceMockRecorder) GetPodByIP(arg0 any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPodByIP", reflect.TypeOf((*MockCacheInterface)(nil).GetPodByIP), arg0)
 }
 
+// GetPods mocks base method.
+func (m *MockCacheInterface) GetPods() []*common.RetinaEndpoint {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPods")
+	ret0, _ := ret[0].([]*common.RetinaEndpoint)
+	return ret0
+}
+
+// GetPods indicates an expected call of GetPods.
+func (mr *MockCacheInterfaceMockRecorder) GetPods() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPods", reflect.TypeOf((*MockCacheInterface)(nil).GetPods))
+}
+
 // GetSvcByIP mocks base method.
 func (m *MockCacheInterface) GetSvcByIP(arg0 string) *common.RetinaSvc {
 	m.ctrl.T.Helper()
@@ -210,6 +238,32 @@ func (mr *MockCacheInterfaceMockRecorder) GetSvcByIP(arg0 any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSvcByIP", reflect.TypeOf((*MockCacheInterface)(nil).GetSvcByIP), arg0)
 }
 
+// SetNamespaceAnnotations mocks base method.
+func (m *MockCacheInterface) SetNamespaceAnnotations(arg0 string, arg1 map[string]string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetNamespaceAnnotations", arg0, arg1)
+}
+
+// SetNamespaceAnnotations indicates an expected call of SetNamespaceAnnotations.
+func (mr *MockCacheInterfaceMockRecorder) SetNamespaceAnnotations(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetNamespaceAnnotations", reflect.TypeOf((*MockCacheInterface)(nil).SetNamespaceAnnotations), arg0, arg1)
+}
+
+// UpdateHostNetworkRetinaEndpoint mocks base method.
+func (m *MockCacheInterface) UpdateHostNetworkRetinaEndpoint(arg0 *common.RetinaEndpoint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateHostNetworkRetinaEndpoint", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateHostNetworkRetinaEndpoint indicates an expected call of UpdateHostNetworkRetinaEndpoint.
+func (mr *MockCacheInterfaceMockRecorder) UpdateHostNetworkRetinaEndpoint(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateHostNetworkRetinaEndpoint", reflect.TypeOf((*MockCacheInterface)(nil).UpdateHostNetworkRetinaEndpoint), arg0)
+}
+
 // UpdateRetinaEndpoint mocks base method.
 func (m *MockCacheInterface) UpdateRetinaEndpoint(arg0 *common.RetinaEndpoint) error {
 	m.ctrl.T.Helper()
@@ -24,14 +24,22 @@ type CacheInterface interface {
 	GetAllNamespaces() []string
 	// GetAnnotatedNamespaces returns list of namespaces that are annotated with retina to observe.
 	GetAnnotatedNamespaces() []string
+	// GetNamespaceAnnotations returns the retina annotations of the annotated namespaces.
+	GetNamespaceAnnotations() map[string]map[string]string
+	// GetPods returns the pods in the cache, including the pods in the host network.
+	GetPods() []*common.RetinaEndpoint
 
 	// UpdateRetinaEndpoint updates the retina endpoint in the cache.
 	UpdateRetinaEndpoint(ep *common.RetinaEndpoint) error
+	// UpdateHostNetworkRetinaEndpoint updates the retina endpoint of a pod in the host network in the cache.
+	UpdateHostNetworkRetinaEndpoint(ep *common.RetinaEndpoint) error
 	// UpdateRetinaSvc updates the retina service in the cache.
 	UpdateRetinaSvc(svc *common.RetinaSvc) error
 	// UpdateRetinaNode updates the retina node in the cache.
 	UpdateRetinaNode(node *common.RetinaNode) error
 	AddAnnotatedNamespace(ns string)
+	// SetNamespaceAnnotations sets the retina annotations of an annotated namespace.
+	SetNamespaceAnnotations(ns string, annotations map[string]string)
 
 	// DeleteRetinaEndpoint deletes the retina endpoint from the cache.
 	DeleteRetinaEndpoint(epKey string) error
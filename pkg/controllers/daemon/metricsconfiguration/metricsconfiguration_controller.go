@@ -15,13 +15,16 @@ package metricsconfigurationcontroller
 
 import (
 	"context"
+	"errors"
 	"sync"
+	"time"
 
 	"go.uber.org/zap"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	retinav1alpha1 "github.com/microsoft/retina/crd/api/v1alpha1"
 	"github.com/microsoft/retina/crd/api/v1alpha1/validations"
@@ -29,24 +32,35 @@ import (
 	mm "github.com/microsoft/retina/pkg/module/metrics"
 )
 
+// seriesBudgetCheckInterval is the interval at which the series budgets of the metrics are checked and reported
+const seriesBudgetCheckInterval = time.Minute
+
+type metricsModule interface {
+	Reconcile(spec *retinav1alpha1.MetricsSpec) error
+	ExceededSeriesBudgets() []string
+}
+
 // MetricsConfigurationReconciler reconciles a MetricsConfiguration object
 type MetricsConfigurationReconciler struct {
 	*sync.Mutex
 	client.Client
 	Scheme        *runtime.Scheme
-	mcCache       map[string]*retinav1alpha1.MetricsConfiguration
-	metricsModule *mm.Module
-	l             *log.ZapLogger
+	metricsModule metricsModule
+	// currentSpec is the merged spec the metrics module was last reconciled with
+	currentSpec *retinav1alpha1.MetricsSpec
+	// nodeName is the node reported in the status when a series budget is exceeded
+	nodeName string
+	l        *log.ZapLogger
 }
 
-func New(client client.Client, scheme *runtime.Scheme, metricsModule *mm.Module) *MetricsConfigurationReconciler {
+func New(client client.Client, scheme *runtime.Scheme, metricsModule *mm.Module, nodeName string) *MetricsConfigurationReconciler {
 	return &MetricsConfigurationReconciler{
 		Mutex:         &sync.Mutex{},
 		l:             log.Logger().Named(string("metricsconfiguration-controller")),
 		Client:        client,
 		Scheme:        scheme,
-		mcCache:       make(map[string]*retinav1alpha1.MetricsConfiguration),
 		metricsModule: metricsModule,
+		nodeName:      nodeName,
 	}
 }
 
@@ -54,56 +68,124 @@ func New(client client.Client, scheme *runtime.Scheme, metricsModule *mm.Module)
 //+kubebuilder:rbac:groups=operator.retina.sh,resources=metricsconfiguration/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=operator.retina.sh,resources=metricsconfiguration/finalizers,verbs=update
 
+// Reconcile merges the specs last accepted by the operator of all MetricsConfigurations and reconciles the metrics
+// module with the merged spec. The series budgets exceeded on this node are reported in the status of the MetricsConfigurations
+// applying the metrics.
 func (r *MetricsConfigurationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	mcc := &retinav1alpha1.MetricsConfiguration{}
-	if err := r.Client.Get(ctx, req.NamespacedName, mcc); err != nil {
-		if apierrors.IsNotFound(err) {
-			// Object not found, it has probably been deleted
-			r.l.Info("deleted", zap.String("name", req.NamespacedName.String()))
-			r.Lock()
-			if _, ok := r.mcCache[req.NamespacedName.String()]; ok {
-				delete(r.mcCache, req.NamespacedName.String())
-				r.l.Info("deleted from cache", zap.String("name", req.NamespacedName.String()))
-			}
-			r.Unlock()
-			return ctrl.Result{}, nil
-		} else {
-			r.l.Info("error getting metricsconfiguration", zap.String("name", req.NamespacedName.String()))
-			return ctrl.Result{}, err
-		}
-	}
-
 	r.l.Info("reconciled", zap.String("name", req.NamespacedName.String()))
 	r.Lock()
 	defer r.Unlock()
-	if len(r.mcCache) == 0 || r.mcCache[req.NamespacedName.String()] != nil {
-		if mcc.Status.State != retinav1alpha1.StateAccepted {
-			r.l.Info("ignoring this CRD as it is not configured and accepted by operator")
-		} else {
-			r.l.Info("adding to cache", zap.String("name", req.NamespacedName.String()))
-			currentMcc := r.mcCache[req.NamespacedName.String()]
-
-			if validations.CompareMetricsConfig(currentMcc, mcc) {
-				r.l.Info("no change in metrics configuration, skipping reconcile", zap.String("name", req.NamespacedName.String()))
-				return ctrl.Result{}, nil
-			}
 
-			err := r.metricsModule.Reconcile(&mcc.Spec)
-			if err != nil {
-				r.l.Info("error reconciling metrics configurations", zap.String("name", req.NamespacedName.String()))
-			}
-			r.mcCache[req.NamespacedName.String()] = mcc
+	mcs := &retinav1alpha1.MetricsConfigurationList{}
+	if err := r.Client.List(ctx, mcs); err != nil {
+		r.l.Info("error listing metricsconfigurations", zap.Error(err))
+		return ctrl.Result{}, err
+	}
+
+	accepted := make([]*retinav1alpha1.MetricsConfiguration, 0, len(mcs.Items))
+	acceptedSpecs := make([]*retinav1alpha1.MetricsConfiguration, 0, len(mcs.Items))
+	for i := range mcs.Items {
+		mcc := &mcs.Items[i]
+		// Partially applied configurations are in the Warning state.
+		if !mcc.DeletionTimestamp.IsZero() || (mcc.Status.State != retinav1alpha1.StateAccepted && mcc.Status.State != retinav1alpha1.StateWarning) {
+			continue
 		}
+		// The spec may have changed since the operator validated it, only the spec it accepted is applied.
+		if mcc.Status.LastKnownSpec == nil {
+			continue
+		}
+		accepted = append(accepted, mcc)
+		acceptedSpecs = append(acceptedSpecs, &retinav1alpha1.MetricsConfiguration{
+			ObjectMeta: mcc.ObjectMeta,
+			Spec:       *mcc.Status.LastKnownSpec,
+		})
+	}
+	if len(accepted) == 0 {
+		r.l.Info("no metrics configuration is configured and accepted by operator")
+		return ctrl.Result{}, nil
+	}
+
+	spec, results := validations.MergeMetricsConfigurations(acceptedSpecs)
+	if r.currentSpec.Equals(spec) {
+		r.l.Info("no change in merged metrics configuration, skipping reconcile", zap.String("name", req.NamespacedName.String()))
 	} else {
-		r.l.Error("Metrics Configuration is already configured on this cluster, cannot reconcile this new config.", zap.String("name", req.NamespacedName.String()))
+		if err := r.metricsModule.Reconcile(spec); err != nil {
+			r.l.Info("error reconciling metrics configurations", zap.String("name", req.NamespacedName.String()))
+		}
+		r.currentSpec = spec
+	}
+
+	if !hasSeriesBudget(spec) {
+		return ctrl.Result{}, nil
 	}
+	return ctrl.Result{RequeueAfter: seriesBudgetCheckInterval}, r.reportSeriesBudgets(ctx, accepted, results)
+}
+
+// reportSeriesBudgets records on every MetricsConfiguration whether the series budgets of its applied metrics are
+// exceeded on this node. The operator sets the state of the MetricsConfigurations accordingly.
+func (r *MetricsConfigurationReconciler) reportSeriesBudgets(ctx context.Context, mcs []*retinav1alpha1.MetricsConfiguration, results map[string]validations.MergeResult) error {
+	if r.nodeName == "" {
+		return nil
+	}
+
+	exceeded := map[string]bool{}
+	for _, metricName := range r.metricsModule.ExceededSeriesBudgets() {
+		exceeded[metricName] = true
+	}
+
+	var errs []error
+	for _, mcc := range mcs {
+		patch := client.MergeFromWithOptions(mcc.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		var changed bool
+		for _, metricName := range results[mcc.Name].Applied {
+			if mcc.Status.SetSeriesBudgetExceeded(metricName, r.nodeName, exceeded[metricName]) {
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		r.l.Info("reporting series budgets", zap.String("name", mcc.Name), zap.Any("exceededSeriesBudgets", mcc.Status.ExceededSeriesBudgets))
+		if err := r.Client.Status().Patch(ctx, mcc, patch); err != nil {
+			r.l.Info("error reporting series budgets", zap.String("name", mcc.Name), zap.Error(err))
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func hasSeriesBudget(spec *retinav1alpha1.MetricsSpec) bool {
+	for _, ctxOption := range spec.ContextOptions {
+		if ctxOption.MaxSeries > 0 {
+			return true
+		}
+	}
+	return false
+}
 
-	return ctrl.Result{}, nil
+// acceptedSpecChanged passes the events changing the spec, or the state or spec accepted by the operator. Other
+// status updates, e.g. the series budgets reported by the other nodes, are ignored: the budgets of this node are
+// checked periodically instead.
+func acceptedSpecChanged() predicate.Predicate {
+	return predicate.Or(
+		predicate.GenerationChangedPredicate{},
+		predicate.Funcs{
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				oldMcc, okOld := e.ObjectOld.(*retinav1alpha1.MetricsConfiguration)
+				newMcc, okNew := e.ObjectNew.(*retinav1alpha1.MetricsConfiguration)
+				if !okOld || !okNew {
+					return true
+				}
+				return oldMcc.Status.State != newMcc.Status.State || !oldMcc.Status.LastKnownSpec.Equals(newMcc.Status.LastKnownSpec)
+			},
+		},
+	)
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *MetricsConfigurationReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&retinav1alpha1.MetricsConfiguration{}).
+		WithEventFilter(acceptedSpecChanged()).
 		Complete(r)
 }
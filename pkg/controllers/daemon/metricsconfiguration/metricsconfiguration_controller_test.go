@@ -26,6 +26,7 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 
 	retinav1alpha1 "github.com/microsoft/retina/crd/api/v1alpha1"
 	"github.com/microsoft/retina/pkg/log"
@@ -102,7 +103,7 @@ func TestMetricsConfigurationReconciler_Reconcile(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			client := fake.NewClientBuilder().WithScheme(fakescheme).WithObjects(tt.fields.existingObjects...).Build()
 
-			r := New(client, fakescheme, nil)
+			r := New(client, fakescheme, nil, "")
 
 			_, err := r.Reconcile(tt.args.ctx, tt.args.req)
 			if (err != nil) != tt.wantErr {
@@ -127,3 +128,134 @@ func TestMetricsConfigurationReconciler_Reconcile(t *testing.T) {
 		})
 	}
 }
+
+type fakeMetricsModule struct {
+	spec     *retinav1alpha1.MetricsSpec
+	exceeded []string
+}
+
+func (f *fakeMetricsModule) Reconcile(spec *retinav1alpha1.MetricsSpec) error {
+	f.spec = spec
+	return nil
+}
+
+func (f *fakeMetricsModule) ExceededSeriesBudgets() []string {
+	return f.exceeded
+}
+
+func TestMetricsConfigurationReconciler_ReportSeriesBudgets(t *testing.T) {
+	log.SetupZapLogger(log.GetDefaultLogOpts())
+	mc := &retinav1alpha1.MetricsConfiguration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test",
+		},
+		Spec: retinav1alpha1.MetricsSpec{
+			ContextOptions: []retinav1alpha1.MetricsContextOptions{
+				{
+					MetricName:   "drop_count",
+					SourceLabels: []string{"ip"},
+					MaxSeries:    10,
+				},
+			},
+			Namespaces: retinav1alpha1.MetricsNamespaces{
+				Include: []string{"default"},
+			},
+		},
+		Status: retinav1alpha1.MetricsStatus{
+			State: retinav1alpha1.StateAccepted,
+		},
+	}
+	mc.Status.LastKnownSpec = mc.Spec.DeepCopy()
+	client := fake.NewClientBuilder().WithScheme(fakescheme).WithObjects(mc).WithStatusSubresource(mc).Build()
+	module := &fakeMetricsModule{exceeded: []string{"drop_count"}}
+	r := New(client, fakescheme, nil, "node-1")
+	r.metricsModule = module
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "test"}}
+
+	result, err := r.Reconcile(context.TODO(), req)
+	require.NoError(t, err)
+	require.Equal(t, seriesBudgetCheckInterval, result.RequeueAfter)
+	require.NotNil(t, module.spec)
+
+	got := &retinav1alpha1.MetricsConfiguration{}
+	require.NoError(t, client.Get(context.TODO(), req.NamespacedName, got))
+	require.Equal(t, []retinav1alpha1.ExceededSeriesBudget{{MetricName: "drop_count", Nodes: []string{"node-1"}}}, got.Status.ExceededSeriesBudgets)
+
+	// The node is removed once the series budget is no longer exceeded.
+	module.exceeded = nil
+	_, err = r.Reconcile(context.TODO(), req)
+	require.NoError(t, err)
+	require.NoError(t, client.Get(context.TODO(), req.NamespacedName, got))
+	require.Empty(t, got.Status.ExceededSeriesBudgets)
+}
+
+func TestMetricsConfigurationReconciler_AppliesLastKnownSpec(t *testing.T) {
+	log.SetupZapLogger(log.GetDefaultLogOpts())
+	accepted := retinav1alpha1.MetricsSpec{
+		ContextOptions: []retinav1alpha1.MetricsContextOptions{
+			{MetricName: "drop_count", SourceLabels: []string{"ip"}},
+		},
+		Namespaces: retinav1alpha1.MetricsNamespaces{Include: []string{"default"}},
+	}
+	mc := &retinav1alpha1.MetricsConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "test"},
+		// The spec was changed after the operator accepted it.
+		Spec: retinav1alpha1.MetricsSpec{
+			ContextOptions: []retinav1alpha1.MetricsContextOptions{
+				{MetricName: "forward_count", SourceLabels: []string{"podname"}},
+			},
+		},
+		Status: retinav1alpha1.MetricsStatus{
+			State:         retinav1alpha1.StateAccepted,
+			LastKnownSpec: &accepted,
+		},
+	}
+	client := fake.NewClientBuilder().WithScheme(fakescheme).WithObjects(mc).WithStatusSubresource(mc).Build()
+	module := &fakeMetricsModule{}
+	r := New(client, fakescheme, nil, "node-1")
+	r.metricsModule = module
+
+	_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "test"}})
+	require.NoError(t, err)
+	require.NotNil(t, module.spec)
+	require.Equal(t, accepted.ContextOptions, module.spec.ContextOptions)
+}
+
+func TestAcceptedSpecChanged(t *testing.T) {
+	accepted := retinav1alpha1.MetricsSpec{
+		ContextOptions: []retinav1alpha1.MetricsContextOptions{
+			{MetricName: "drop_count", SourceLabels: []string{"ip"}},
+		},
+	}
+	old := &retinav1alpha1.MetricsConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Generation: 1},
+		Spec:       accepted,
+		Status: retinav1alpha1.MetricsStatus{
+			State:         retinav1alpha1.StateAccepted,
+			Reason:        "CRD is Accepted",
+			LastKnownSpec: accepted.DeepCopy(),
+		},
+	}
+	p := acceptedSpecChanged()
+
+	// Updates of the reason or of the series budgets reported by the nodes are ignored.
+	reasonOnly := old.DeepCopy()
+	reasonOnly.Status.Reason = "CRD is Accepted, applied metrics: drop_count"
+	require.False(t, p.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: reasonOnly}))
+
+	budgetReported := old.DeepCopy()
+	budgetReported.Status.SetSeriesBudgetExceeded("drop_count", "node-2", true)
+	require.False(t, p.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: budgetReported}))
+
+	specChanged := old.DeepCopy()
+	specChanged.Generation = 2
+	require.True(t, p.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: specChanged}))
+
+	lastKnownSpecChanged := old.DeepCopy()
+	lastKnownSpecChanged.Status.LastKnownSpec.ContextOptions[0].SourceLabels = []string{"podname"}
+	require.True(t, p.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: lastKnownSpecChanged}))
+
+	stateChanged := old.DeepCopy()
+	stateChanged.Status.State = retinav1alpha1.StateWarning
+	require.True(t, p.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: stateChanged}))
+}
@@ -52,9 +52,10 @@ func (r *NamespaceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		namespace.Namespace = req.Namespace
 	}
 	// if the namespace has an annotation and was not deleted
-	if namespace.GetAnnotations()[common.RetinaPodAnnotation] == common.RetinaPodAnnotationValue && namespace.DeletionTimestamp.IsZero() {
+	if annotated(namespace.GetAnnotations()) && namespace.DeletionTimestamp.IsZero() {
 		r.l.Info("Namespace has annotation", zap.String("namespace", namespace.Name))
 		r.cache.AddAnnotatedNamespace(namespace.Name)
+		r.cache.SetNamespaceAnnotations(namespace.Name, namespace.GetAnnotations())
 	} else {
 		// namespace updated with annotation removed or the namespace was deleted
 		r.l.Info("Namespace does not have annotation", zap.String("namespace", namespace.Name), zap.Any("annotations", namespace.GetAnnotations()))
@@ -83,20 +84,26 @@ func (r *NamespaceReconciler) Start(ctx context.Context) {
 	}
 }
 
+// annotated returns whether the namespace is observed, with the observe annotation or by selecting metrics.
+func annotated(annotations map[string]string) bool {
+	if _, ok := annotations[common.RetinaMetricsAnnotation]; ok {
+		return true
+	}
+	return annotations[common.RetinaPodAnnotation] == common.RetinaPodAnnotationValue
+}
+
 func getPredicateFuncs() predicate.Predicate {
 	return predicate.Funcs{
 		CreateFunc: func(e event.CreateEvent) bool {
-			_, hasAnnotation := e.Object.GetAnnotations()[common.RetinaPodAnnotation]
-			return hasAnnotation
+			return len(common.RetinaAnnotations(e.Object.GetAnnotations())) > 0
 		},
 		UpdateFunc: func(e event.UpdateEvent) bool {
-			_, annotOld := e.ObjectNew.GetAnnotations()[common.RetinaPodAnnotation]
-			_, annotNew := e.ObjectOld.GetAnnotations()[common.RetinaPodAnnotation]
+			annotOld := len(common.RetinaAnnotations(e.ObjectOld.GetAnnotations())) > 0
+			annotNew := len(common.RetinaAnnotations(e.ObjectNew.GetAnnotations())) > 0
 			return annotOld || annotNew
 		},
 		DeleteFunc: func(e event.DeleteEvent) bool {
-			_, hasAnnotation := e.Object.GetAnnotations()[common.RetinaPodAnnotation]
-			return hasAnnotation
+			return len(common.RetinaAnnotations(e.Object.GetAnnotations())) > 0
 		},
 	}
 }
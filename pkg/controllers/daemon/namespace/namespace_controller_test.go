@@ -95,6 +95,31 @@ func TestNamespaceControllerReconcile(t *testing.T) {
 			deleteCalls: 0,
 			addCalls:    1,
 		},
+		{
+			name: "Test Namespace Controller Reconcile with metrics annotation",
+			fields: fields{
+				existingObjects: []client.Object{
+					&corev1.Namespace{
+						ObjectMeta: metav1.ObjectMeta{
+							Name: "test",
+							Annotations: map[string]string{
+								common.RetinaMetricsAnnotation: "dns,tcpretrans",
+							},
+						},
+					},
+				},
+			},
+			args: args{
+				req: ctrl.Request{
+					NamespacedName: client.ObjectKey{
+						Name: "test",
+					},
+				},
+			},
+			wantErr:     false,
+			deleteCalls: 0,
+			addCalls:    1,
+		},
 		{
 			name: "Test Namespace Controller Reconcile without annotation delete",
 			fields: fields{
@@ -127,6 +152,7 @@ func TestNamespaceControllerReconcile(t *testing.T) {
 			cache := cache.NewMockCacheInterface(ctrl) //nolint:typecheck
 			cache.EXPECT().AddAnnotatedNamespace(gomock.Any()).Return().Times(tt.addCalls)
 			cache.EXPECT().DeleteAnnotatedNamespace(gomock.Any()).Return().Times(tt.deleteCalls)
+			cache.EXPECT().SetNamespaceAnnotations(gomock.Any(), gomock.Any()).Return().Times(tt.addCalls)
 			r := New(client, cache, &metrics.Module{})
 			_, err := r.Reconcile(tt.args.ctx, tt.args.req)
 			if (err != nil) != tt.wantErr {
@@ -165,6 +191,16 @@ func TestPredicateFuncs(t *testing.T) {
 			},
 		},
 	}))
+	assert.True(t, funcs.Create(event.CreateEvent{
+		Object: &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "test",
+				Annotations: map[string]string{
+					common.RetinaLabelsAnnotation: "workload,port",
+				},
+			},
+		},
+	}))
 	assert.True(t, funcs.Delete(event.DeleteEvent{
 		Object: &corev1.Namespace{
 			ObjectMeta: metav1.ObjectMeta{
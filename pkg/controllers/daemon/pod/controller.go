@@ -58,7 +58,19 @@ func (r *PodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 	}
 
 	if pod.Spec.HostNetwork {
-		r.l.Debug("Ignoring host network pod", zap.String("Pod", req.NamespacedName.String()))
+		// The pods in the host network share the IP of the node, so they are cached apart from the pods with their own
+		// IPs, for the cgroupskb plugin which attributes their traffic by cgroup.
+		if !pod.ObjectMeta.DeletionTimestamp.IsZero() {
+			if err := r.cache.DeleteRetinaEndpoint(req.NamespacedName.String()); err != nil {
+				r.l.Warn("Failed to delete RetinaEndpoint in Cache from Pod", zap.Error(err), zap.String("Pod", req.NamespacedName.String()))
+			}
+			return ctrl.Result{}, nil
+		}
+		r.l.Debug("Caching host network pod", zap.String("Pod", req.NamespacedName.String()))
+		if err := r.cache.UpdateHostNetworkRetinaEndpoint(retinaCommon.RetinaEndpointCommonFromPod(pod)); err != nil {
+			r.l.Error("Failed to update host network RetinaEndpoint in Cache", zap.Error(err), zap.String("Pod", req.NamespacedName.String()))
+			return ctrl.Result{}, err
+		}
 		return ctrl.Result{}, nil
 	}
 
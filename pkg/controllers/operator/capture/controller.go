@@ -20,6 +20,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/events"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -56,8 +57,16 @@ type CaptureReconciler struct {
 	client.Client
 	scheme *runtime.Scheme
 
+	// kubeClient reads capture pods without caching all pods of the cluster in the manager.
+	kubeClient kubernetes.Interface
+
 	logger *log.ZapLogger
 
+	// captureConfig holds the retention policy of Captures.
+	captureConfig config.CaptureConfig
+	// recorder records the deletions made by the retention policy as Kubernetes events.
+	recorder events.EventRecorder
+
 	captureToPodTranslator *pkgcapture.CaptureToPodTranslator
 
 	managedStorageAccountManager *managedOutputLocation.StorageAccountManager
@@ -65,9 +74,11 @@ type CaptureReconciler struct {
 
 func NewCaptureReconciler(c client.Client, scheme *runtime.Scheme, kubeClient kubernetes.Interface, captureConfig config.CaptureConfig) (*CaptureReconciler, error) {
 	cr := &CaptureReconciler{
-		Client: c,
-		scheme: scheme,
-		logger: log.Logger().Named("Capture"),
+		Client:        c,
+		scheme:        scheme,
+		kubeClient:    kubeClient,
+		logger:        log.Logger().Named("Capture"),
+		captureConfig: captureConfig,
 	}
 
 	cr.captureToPodTranslator = pkgcapture.NewCaptureToPodTranslator(kubeClient, cr.logger, captureConfig)
@@ -93,6 +104,7 @@ func NewCaptureReconciler(c client.Client, scheme *runtime.Scheme, kubeClient ku
 //+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list
 //+kubebuilder:rbac:groups="",resources=pods,verbs=get;list
 //+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list
+//+kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -135,7 +147,22 @@ func (cr *CaptureReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		}
 	}
 
-	return cr.handleUpdate(ctx, &capture)
+	if cr.retentionEnabled() {
+		deleted, err := cr.applyRetentionPolicy(ctx, &capture)
+		if err != nil {
+			cr.logger.Error("Failed to apply Capture retention policy", zap.Error(err), zap.String("Capture", captureRef.String()))
+			return ctrl.Result{}, err
+		}
+		if deleted {
+			return ctrl.Result{}, nil
+		}
+	}
+
+	result, err := cr.handleUpdate(ctx, &capture)
+	if err != nil {
+		return result, err
+	}
+	return cr.requeueForTTL(&capture, result), nil
 }
 
 // Capture status condition types are mutually exclusive, and there can be only one condition in given time.
@@ -176,6 +203,7 @@ func (cr *CaptureReconciler) updateCaptureStatusFromJobs(ctx context.Context, ca
 	capture.Status.Active = int32(len(activeJobs))
 	capture.Status.Failed = int32(len(failedJobs))
 	capture.Status.Succeeded = int32(len(successfulJobs))
+	capture.Status.NodeStatuses = cr.nodeStatusesFromJobs(ctx, capture, captureJobs)
 	// Once we detect jobs are in failed state, we'll update the status of the Capture to error, meanwhile we keep
 	// updating the status of the Capture to inProgress if there are still active jobs.
 	if len(failedJobs) != 0 {
@@ -242,6 +270,23 @@ func (cr *CaptureReconciler) updateCaptureStatusFromJobs(ctx context.Context, ca
 	return ctrl.Result{}, nil
 }
 
+// nodeStatusesFromJobs reports the per-node progress of the Capture. Failing to list the capture pods is not fatal,
+// the node statuses are then derived from the jobs alone.
+func (cr *CaptureReconciler) nodeStatusesFromJobs(ctx context.Context, capture *retinav1alpha1.Capture, captureJobs []batchv1.Job) []retinav1alpha1.CaptureNodeStatus {
+	var pods []corev1.Pod
+	if cr.kubeClient != nil {
+		podList, err := cr.kubeClient.CoreV1().Pods(capture.Namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: labels.SelectorFromSet(captureUtils.GetContainerLabelsFromCaptureName(capture.Name)).String(),
+		})
+		if err != nil {
+			cr.logger.Warn("Failed to list Capture pods", zap.Error(err), zap.String("Capture", capture.Namespace+"/"+capture.Name))
+		} else {
+			pods = podList.Items
+		}
+	}
+	return pkgcapture.NodeStatusesFromJobs(captureJobs, pods)
+}
+
 func (cr *CaptureReconciler) createJobsFromCapture(ctx context.Context, capture *retinav1alpha1.Capture) (ctrl.Result, error) {
 	captureRef := types.NamespacedName{
 		Namespace: capture.Namespace,
@@ -401,6 +446,13 @@ func (cr *CaptureReconciler) handleDelete(ctx context.Context, capture *retinav1
 
 	cr.logger.Info("Removing Capture", zap.String("Capture", captureRef.String()))
 
+	// Start the artifact cleanup before deleting the Capture jobs, whose pod templates the cleanup jobs are built from.
+	cleanupJobs, err := cr.cleanupArtifacts(ctx, capture)
+	if err != nil {
+		cr.logger.Error("Failed to clean up Capture artifacts", zap.Error(err), zap.String("Capture", captureRef.String()))
+		return ctrl.Result{}, err
+	}
+
 	deletePropagationBackground := metav1.DeletePropagationBackground
 	if err := apiretry.Do(
 		func() error {
@@ -426,6 +478,10 @@ func (cr *CaptureReconciler) handleDelete(ctx context.Context, capture *retinav1
 		if capture.Spec.OutputConfiguration.BlobUpload != nil && *capture.Spec.OutputConfiguration.BlobUpload == managedSecret.Name {
 			err := apiretry.Do(
 				func() error {
+					// The artifact cleanup jobs still need the secret, hand it over to them for garbage collection.
+					if len(cleanupJobs) != 0 {
+						return cr.setSecretOwnerToJobs(ctx, &managedSecret, cleanupJobs)
+					}
 					return cr.Client.Delete(ctx, &managedSecret) //nolint:wrapcheck // no wrapped, detailed explanation is required for the internal error
 				},
 			)
@@ -462,8 +518,26 @@ func getSecretFromCapture(capture *retinav1alpha1.Capture, sasURL string) corev1
 	return secret
 }
 
+// setSecretOwnerToJobs makes the jobs the owners of the secret, so that the secret is garbage collected with them.
+func (cr *CaptureReconciler) setSecretOwnerToJobs(ctx context.Context, secret *corev1.Secret, jobs []batchv1.Job) error {
+	if err := cr.Client.Get(ctx, client.ObjectKeyFromObject(secret), secret); err != nil {
+		return err //nolint:wrapcheck // no wrapped, detailed explanation is required for the internal error
+	}
+	secret.OwnerReferences = make([]metav1.OwnerReference, 0, len(jobs))
+	for i := range jobs {
+		secret.OwnerReferences = append(secret.OwnerReferences, metav1.OwnerReference{
+			APIVersion: batchv1.SchemeGroupVersion.String(),
+			Kind:       "Job",
+			Name:       jobs[i].Name,
+			UID:        jobs[i].UID,
+		})
+	}
+	return cr.Client.Update(ctx, secret) //nolint:wrapcheck // no wrapped, detailed explanation is required for the internal error
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (cr *CaptureReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	cr.recorder = mgr.GetEventRecorder("retina-capture-controller")
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&retinav1alpha1.Capture{}).
 		Owns(&batchv1.Job{}). // Once the job owned by capture is created /deleted/updated, the capture will be reconciled.
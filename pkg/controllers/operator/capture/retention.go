@@ -0,0 +1,224 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package capture
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	retinav1alpha1 "github.com/microsoft/retina/crd/api/v1alpha1"
+	pkgcapture "github.com/microsoft/retina/pkg/capture"
+	captureConstants "github.com/microsoft/retina/pkg/capture/constants"
+	captureUtils "github.com/microsoft/retina/pkg/capture/utils"
+	"github.com/microsoft/retina/pkg/common/apiretry"
+)
+
+const (
+	captureExpiredReasonTTL             = "TTLExpired"
+	captureExpiredReasonMaxPerNamespace = "MaxPerNamespaceExceeded"
+
+	captureEventReasonArtifactCleanup       = "ArtifactCleanup"
+	captureEventReasonArtifactCleanupFailed = "ArtifactCleanupFailed"
+	captureEventActionDelete                = "Delete"
+)
+
+// retentionEnabled reports whether any retention policy is configured.
+func (cr *CaptureReconciler) retentionEnabled() bool {
+	return cr.captureConfig.CaptureTTLAfterFinished > 0 || cr.captureConfig.CaptureMaxPerNamespace > 0
+}
+
+// applyRetentionPolicy deletes Captures of the namespace which are expired by the retention policy. It returns true
+// when the given Capture itself is deleted.
+func (cr *CaptureReconciler) applyRetentionPolicy(ctx context.Context, capture *retinav1alpha1.Capture) (bool, error) {
+	if ttl := cr.captureConfig.CaptureTTLAfterFinished; ttl > 0 {
+		if finishedAt := captureFinishedTime(capture); finishedAt != nil && time.Since(finishedAt.Time) >= ttl {
+			message := fmt.Sprintf("Capture finished at %s and exceeded the TTL of %s", finishedAt.UTC().Format(time.RFC3339), ttl)
+			return true, cr.expireCapture(ctx, capture, captureExpiredReasonTTL, message)
+		}
+	}
+
+	maxPerNamespace := cr.captureConfig.CaptureMaxPerNamespace
+	if maxPerNamespace <= 0 {
+		return false, nil
+	}
+
+	captureList := &retinav1alpha1.CaptureList{}
+	if err := cr.List(ctx, captureList, client.InNamespace(capture.Namespace)); err != nil {
+		return false, fmt.Errorf("failed to list Captures: %w", err)
+	}
+	expired := capturesExceedingLimit(captureList.Items, maxPerNamespace)
+
+	captureDeleted := false
+	for i := range expired {
+		message := fmt.Sprintf("Namespace %s has more than %d Captures, deleting the oldest finished Capture", capture.Namespace, maxPerNamespace)
+		if err := cr.expireCapture(ctx, expired[i], captureExpiredReasonMaxPerNamespace, message); err != nil {
+			return false, err
+		}
+		if expired[i].Name == capture.Name {
+			captureDeleted = true
+		}
+	}
+	return captureDeleted, nil
+}
+
+// requeueForTTL makes sure the Capture is reconciled again when its TTL expires.
+func (cr *CaptureReconciler) requeueForTTL(capture *retinav1alpha1.Capture, result ctrl.Result) ctrl.Result {
+	ttl := cr.captureConfig.CaptureTTLAfterFinished
+	if ttl <= 0 {
+		return result
+	}
+	finishedAt := captureFinishedTime(capture)
+	if finishedAt == nil {
+		return result
+	}
+	remaining := time.Until(finishedAt.Add(ttl))
+	if remaining <= 0 {
+		remaining = time.Second
+	}
+	if result.RequeueAfter == 0 || remaining < result.RequeueAfter {
+		result.RequeueAfter = remaining
+	}
+	return result
+}
+
+// expireCapture deletes a Capture under the retention policy. The reason is recorded as an annotation so that the
+// artifacts of the Capture are cleaned up when it is finalized.
+func (cr *CaptureReconciler) expireCapture(ctx context.Context, capture *retinav1alpha1.Capture, reason, message string) error {
+	captureRef := types.NamespacedName{Namespace: capture.Namespace, Name: capture.Name}
+	cr.logger.Info("Deleting expired Capture", zap.String("Capture", captureRef.String()), zap.String("reason", reason))
+
+	patch := client.MergeFrom(capture.DeepCopy())
+	if capture.Annotations == nil {
+		capture.Annotations = map[string]string{}
+	}
+	capture.Annotations[captureConstants.CaptureExpiredAnnotationKey] = reason
+	if err := cr.Patch(ctx, capture, patch); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to annotate expired Capture: %w", err)
+	}
+
+	if err := cr.Delete(ctx, capture); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("failed to delete expired Capture: %w", err)
+	}
+	cr.recordEvent(capture, corev1.EventTypeNormal, reason, message)
+	return nil
+}
+
+// cleanupArtifacts starts a job on every node the Capture ran on to remove its artifacts, if the Capture was expired by
+// the retention policy and artifact cleanup is enabled.
+func (cr *CaptureReconciler) cleanupArtifacts(ctx context.Context, capture *retinav1alpha1.Capture) ([]batchv1.Job, error) {
+	if !cr.captureConfig.CaptureCleanupArtifacts {
+		return nil, nil
+	}
+	if _, expired := capture.Annotations[captureConstants.CaptureExpiredAnnotationKey]; !expired {
+		return nil, nil
+	}
+
+	captureJobList := &batchv1.JobList{}
+	if err := apiretry.Do(
+		func() error {
+			return cr.Client.List(ctx, captureJobList, client.InNamespace(capture.Namespace), client.MatchingLabels(captureUtils.GetJobLabelsFromCaptureName(capture.Name)))
+		},
+	); err != nil {
+		return nil, fmt.Errorf("failed to list Capture jobs: %w", err)
+	}
+
+	cleanupJobs := make([]batchv1.Job, 0, len(captureJobList.Items))
+	for i := range captureJobList.Items {
+		cleanupJob := pkgcapture.NewArtifactCleanupJob(&captureJobList.Items[i])
+		err := cr.Create(ctx, cleanupJob)
+		if apierrors.IsAlreadyExists(err) {
+			err = cr.Get(ctx, client.ObjectKeyFromObject(cleanupJob), cleanupJob)
+		}
+		if err != nil {
+			cr.recordEvent(capture, corev1.EventTypeWarning, captureEventReasonArtifactCleanupFailed, fmt.Sprintf("Failed to create artifact cleanup job %s: %v", cleanupJob.Name, err))
+			return nil, fmt.Errorf("failed to create artifact cleanup job: %w", err)
+		}
+		cleanupJobs = append(cleanupJobs, *cleanupJob)
+	}
+
+	if len(cleanupJobs) != 0 {
+		cr.recordEvent(capture, corev1.EventTypeNormal, captureEventReasonArtifactCleanup, fmt.Sprintf("Created %d jobs to remove the artifacts of the Capture", len(cleanupJobs)))
+	}
+	return cleanupJobs, nil
+}
+
+func (cr *CaptureReconciler) recordEvent(capture *retinav1alpha1.Capture, eventType, reason, message string) {
+	if cr.recorder == nil {
+		return
+	}
+	cr.recorder.Eventf(capture, nil, eventType, reason, captureEventActionDelete, "%s", message)
+}
+
+// captureFinishedTime returns the time all jobs of the Capture finished, or nil if the Capture is still running.
+func captureFinishedTime(capture *retinav1alpha1.Capture) *metav1.Time {
+	status := &capture.Status
+	if status.Active != 0 || status.Succeeded+status.Failed == 0 {
+		return nil
+	}
+	if status.CompletionTime != nil {
+		return status.CompletionTime
+	}
+
+	var finishedAt *metav1.Time
+	for i := range status.NodeStatuses {
+		completionTime := status.NodeStatuses[i].CompletionTime
+		if completionTime != nil && (finishedAt == nil || finishedAt.Before(completionTime)) {
+			finishedAt = completionTime
+		}
+	}
+	if finishedAt == nil {
+		if c := meta.FindStatusCondition(status.Conditions, string(retinav1alpha1.CaptureError)); c != nil {
+			finishedAt = &c.LastTransitionTime
+		}
+	}
+	return finishedAt
+}
+
+// capturesExceedingLimit returns the oldest finished Captures to delete to keep at most limit Captures. Running
+// Captures are never selected.
+func capturesExceedingLimit(captures []retinav1alpha1.Capture, limit int) []*retinav1alpha1.Capture {
+	var kept int
+	finished := make([]*retinav1alpha1.Capture, 0, len(captures))
+	for i := range captures {
+		if captures[i].DeletionTimestamp != nil {
+			continue
+		}
+		kept++
+		if captureFinishedTime(&captures[i]) != nil {
+			finished = append(finished, &captures[i])
+		}
+	}
+	if kept <= limit {
+		return nil
+	}
+
+	sort.SliceStable(finished, func(i, j int) bool {
+		fi, fj := captureFinishedTime(finished[i]), captureFinishedTime(finished[j])
+		if !fi.Equal(fj) {
+			return fi.Before(fj)
+		}
+		return finished[i].CreationTimestamp.Before(&finished[j].CreationTimestamp)
+	})
+
+	excess := kept - limit
+	if excess > len(finished) {
+		excess = len(finished)
+	}
+	return finished[:excess]
+}
@@ -0,0 +1,172 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package capture
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	retinav1alpha1 "github.com/microsoft/retina/crd/api/v1alpha1"
+	captureConstants "github.com/microsoft/retina/pkg/capture/constants"
+	captureUtils "github.com/microsoft/retina/pkg/capture/utils"
+	"github.com/microsoft/retina/pkg/config"
+)
+
+func finishedCapture(name string, finishedAgo time.Duration) *retinav1alpha1.Capture {
+	completionTime := metav1.NewTime(time.Now().Add(-finishedAgo))
+	return &retinav1alpha1.Capture{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       name,
+			Namespace:  "default",
+			Finalizers: []string{captureFinalizer},
+		},
+		Status: retinav1alpha1.CaptureStatus{
+			Succeeded:      1,
+			CompletionTime: &completionTime,
+		},
+	}
+}
+
+func runningCapture(name string) *retinav1alpha1.Capture {
+	return &retinav1alpha1.Capture{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       name,
+			Namespace:  "default",
+			Finalizers: []string{captureFinalizer},
+		},
+		Status: retinav1alpha1.CaptureStatus{Active: 1},
+	}
+}
+
+func newRetentionTestReconciler(captureConfig config.CaptureConfig, objects ...client.Object) (*CaptureReconciler, *events.FakeRecorder) {
+	runtimeObjects := make([]runtime.Object, 0, len(objects))
+	for _, obj := range objects {
+		runtimeObjects = append(runtimeObjects, obj.DeepCopyObject())
+	}
+	reconciler := newTestReconciler(runtimeObjects...)
+	reconciler.captureConfig = captureConfig
+	recorder := events.NewFakeRecorder(10)
+	reconciler.recorder = recorder
+	return reconciler, recorder
+}
+
+func captureIsDeleted(t *testing.T, c client.Client, name string) bool {
+	t.Helper()
+	capture := &retinav1alpha1.Capture{}
+	err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: name}, capture)
+	if apierrors.IsNotFound(err) {
+		return true
+	}
+	require.NoError(t, err)
+	return capture.DeletionTimestamp != nil
+}
+
+func TestApplyRetentionPolicyTTL(t *testing.T) {
+	expired := finishedCapture("expired", 2*time.Hour)
+	fresh := finishedCapture("fresh", 10*time.Minute)
+	running := runningCapture("running")
+	reconciler, recorder := newRetentionTestReconciler(config.CaptureConfig{CaptureTTLAfterFinished: time.Hour}, expired, fresh, running)
+	ctx := context.Background()
+
+	deleted, err := reconciler.applyRetentionPolicy(ctx, expired)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	assert.True(t, captureIsDeleted(t, reconciler.Client, "expired"))
+	assert.Equal(t, captureExpiredReasonTTL, expired.Annotations[captureConstants.CaptureExpiredAnnotationKey])
+	require.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "Normal "+captureExpiredReasonTTL)
+
+	deleted, err = reconciler.applyRetentionPolicy(ctx, fresh)
+	require.NoError(t, err)
+	assert.False(t, deleted)
+	result := reconciler.requeueForTTL(fresh, ctrl.Result{})
+	assert.InDelta(t, 50*time.Minute, result.RequeueAfter, float64(time.Minute))
+
+	deleted, err = reconciler.applyRetentionPolicy(ctx, running)
+	require.NoError(t, err)
+	assert.False(t, deleted)
+	assert.Zero(t, reconciler.requeueForTTL(running, ctrl.Result{}).RequeueAfter)
+}
+
+func TestApplyRetentionPolicyMaxPerNamespace(t *testing.T) {
+	oldest := finishedCapture("oldest", 3*time.Hour)
+	older := finishedCapture("older", 2*time.Hour)
+	newest := finishedCapture("newest", time.Hour)
+	running := runningCapture("running")
+	reconciler, recorder := newRetentionTestReconciler(config.CaptureConfig{CaptureMaxPerNamespace: 2}, oldest, older, newest, running)
+
+	deleted, err := reconciler.applyRetentionPolicy(context.Background(), running)
+	require.NoError(t, err)
+	assert.False(t, deleted)
+
+	assert.True(t, captureIsDeleted(t, reconciler.Client, "oldest"))
+	assert.True(t, captureIsDeleted(t, reconciler.Client, "older"))
+	assert.False(t, captureIsDeleted(t, reconciler.Client, "newest"))
+	assert.False(t, captureIsDeleted(t, reconciler.Client, "running"))
+	assert.Len(t, recorder.Events, 2)
+}
+
+func TestCleanupArtifacts(t *testing.T) {
+	capture := finishedCapture("expired", 2*time.Hour)
+	capture.Annotations = map[string]string{captureConstants.CaptureExpiredAnnotationKey: captureExpiredReasonTTL}
+	captureJob := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "expired-abcde",
+			Namespace: "default",
+			Labels:    captureUtils.GetJobLabelsFromCaptureName("expired"),
+		},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: captureConstants.CaptureContainername}},
+				},
+			},
+		},
+	}
+	ctx := context.Background()
+
+	t.Run("disabled", func(t *testing.T) {
+		reconciler, _ := newRetentionTestReconciler(config.CaptureConfig{}, capture, captureJob)
+		cleanupJobs, err := reconciler.cleanupArtifacts(ctx, capture)
+		require.NoError(t, err)
+		assert.Empty(t, cleanupJobs)
+	})
+
+	t.Run("not expired", func(t *testing.T) {
+		notExpired := finishedCapture("expired", time.Minute)
+		reconciler, _ := newRetentionTestReconciler(config.CaptureConfig{CaptureCleanupArtifacts: true}, notExpired, captureJob)
+		cleanupJobs, err := reconciler.cleanupArtifacts(ctx, notExpired)
+		require.NoError(t, err)
+		assert.Empty(t, cleanupJobs)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		reconciler, recorder := newRetentionTestReconciler(config.CaptureConfig{CaptureCleanupArtifacts: true}, capture, captureJob)
+		cleanupJobs, err := reconciler.cleanupArtifacts(ctx, capture)
+		require.NoError(t, err)
+		require.Len(t, cleanupJobs, 1)
+		assert.Equal(t, "expired-abcde-cleanup", cleanupJobs[0].Name)
+		assert.Equal(t, captureUtils.GetCleanupLabelsFromCaptureName("expired"), cleanupJobs[0].Labels)
+		assert.Contains(t, cleanupJobs[0].Spec.Template.Spec.Containers[0].Env, corev1.EnvVar{Name: captureConstants.CaptureCleanupEnvKey, Value: "true"})
+		assert.Contains(t, <-recorder.Events, captureEventReasonArtifactCleanup)
+
+		// Cleanup is idempotent when the Capture is reconciled again before its finalizer is removed.
+		cleanupJobs, err = reconciler.cleanupArtifacts(ctx, capture)
+		require.NoError(t, err)
+		assert.Len(t, cleanupJobs, 1)
+	})
+}
@@ -15,14 +15,24 @@ package metricsconfigurationcontroller
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"reflect"
+	"slices"
 	"sync"
 
 	"go.uber.org/zap"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	retinav1alpha1 "github.com/microsoft/retina/crd/api/v1alpha1"
 	validate "github.com/microsoft/retina/crd/api/v1alpha1/validations"
@@ -33,85 +43,136 @@ import (
 type MetricsConfigurationReconciler struct {
 	*sync.Mutex
 	client.Client
-	Scheme  *runtime.Scheme
-	mcCache map[string]*retinav1alpha1.MetricsConfiguration
-	l       *log.ZapLogger
+	Scheme *runtime.Scheme
+	l      *log.ZapLogger
 }
 
 func New(client client.Client, scheme *runtime.Scheme) *MetricsConfigurationReconciler {
 	return &MetricsConfigurationReconciler{
-		Mutex:   &sync.Mutex{},
-		l:       log.Logger().Named(string("metricsconfiguration-controller")),
-		Client:  client,
-		Scheme:  scheme,
-		mcCache: make(map[string]*retinav1alpha1.MetricsConfiguration),
+		Mutex:  &sync.Mutex{},
+		l:      log.Logger().Named(string("metricsconfiguration-controller")),
+		Client: client,
+		Scheme: scheme,
 	}
 }
 
 //+kubebuilder:rbac:groups=operator.retina.sh,resources=metricsconfigurations,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=operator.retina.sh,resources=metricsconfigurations/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=operator.retina.sh,resources=metricsconfigurations/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
 
+// Reconcile validates all MetricsConfigurations and merges the valid ones, as any change to one of them can change
+// what is applied from the others. The status of every MetricsConfiguration explains which of its metrics are applied,
+// and warns about the metrics which reached their series budget on some nodes.
 func (r *MetricsConfigurationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	mcc := &retinav1alpha1.MetricsConfiguration{}
-	if err := r.Client.Get(ctx, req.NamespacedName, mcc); err != nil {
-		if apierrors.IsNotFound(err) {
-			// Object not found, it has probably been deleted
-			r.l.Info("deleted", zap.String("name", req.NamespacedName.String()))
-			r.Lock()
-			_, ok := r.mcCache[req.NamespacedName.String()]
-			if ok {
-				delete(r.mcCache, req.NamespacedName.String())
-				r.l.Info("deleted from cache", zap.String("name", req.NamespacedName.String()))
-			}
-			r.Unlock()
-			return ctrl.Result{}, nil
-		} else {
-			r.l.Info("error getting metricsconfiguration", zap.String("name", req.NamespacedName.String()))
-			return ctrl.Result{}, err
-		}
-	}
-
-	r.l.Info("reconciled", zap.String("name", req.NamespacedName.String()))
+	r.l.Info("reconciling", zap.String("name", req.NamespacedName.String()))
 	r.Lock()
 	defer r.Unlock()
-	if len(r.mcCache) == 0 || r.mcCache[req.NamespacedName.String()] != nil {
-		err := validate.MetricsCRD(mcc)
-		if err != nil {
-			r.l.Error("Error validating metrics configuration", zap.Error(err))
-
-			mcc.Status = retinav1alpha1.MetricsStatus{
-				State:  retinav1alpha1.StateErrored,
-				Reason: fmt.Sprintf("Validation of CRD failed with: %s", err.Error()),
-			}
-		} else {
-			r.l.Info("metrics configuration is valid", zap.String("crd Name", mcc.Name))
-			mcc.Status = retinav1alpha1.MetricsStatus{
-				State:  retinav1alpha1.StateAccepted,
-				Reason: "CRD is Accepted",
+
+	mcs := &retinav1alpha1.MetricsConfigurationList{}
+	if err := r.Client.List(ctx, mcs); err != nil {
+		r.l.Error("Error listing metrics configurations", zap.Error(err))
+		return ctrl.Result{}, err
+	}
+
+	statuses := make(map[string]retinav1alpha1.MetricsStatus, len(mcs.Items))
+	valid := make([]*retinav1alpha1.MetricsConfiguration, 0, len(mcs.Items))
+	for i := range mcs.Items {
+		mcc := &mcs.Items[i]
+		if !mcc.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if err := validate.MetricsCRD(mcc); err != nil {
+			r.l.Error("Error validating metrics configuration", zap.String("crd Name", mcc.Name), zap.Error(err))
+			statuses[mcc.Name] = retinav1alpha1.MetricsStatus{
+				State:         retinav1alpha1.StateErrored,
+				Reason:        fmt.Sprintf("Validation of CRD failed with: %s", err.Error()),
+				LastKnownSpec: mcc.Status.LastKnownSpec,
 			}
-			r.mcCache[req.NamespacedName.String()] = mcc
+			continue
 		}
-	} else {
-		r.l.Info("Metrics Conguration is already configured on this cluster, cannot reconcile this new config.")
+		valid = append(valid, mcc)
+	}
+
+	nodes, err := r.nodeNames(ctx)
+	if err != nil {
+		r.l.Error("Error listing nodes", zap.Error(err))
+		return ctrl.Result{}, err
+	}
+
+	_, results := validate.MergeMetricsConfigurations(valid)
+	for _, mcc := range valid {
+		current := mcc.Status
+		current.ExceededSeriesBudgets = existingNodesOnly(current.ExceededSeriesBudgets, nodes)
+		status := results[mcc.Name].Status(current)
+		status.LastKnownSpec = mcc.Spec.DeepCopy()
+		statuses[mcc.Name] = status
+	}
 
-		mcc.Status = retinav1alpha1.MetricsStatus{
-			State:  retinav1alpha1.StateErrored,
-			Reason: "Metrics Configuration is already configured on this cluster, cannot reconcile this new config.",
+	var errs []error
+	for i := range mcs.Items {
+		mcc := &mcs.Items[i]
+		status, ok := statuses[mcc.Name]
+		if !ok || (status.State == mcc.Status.State && status.Reason == mcc.Status.Reason && status.LastKnownSpec.Equals(mcc.Status.LastKnownSpec) &&
+			reflect.DeepEqual(status.ExceededSeriesBudgets, mcc.Status.ExceededSeriesBudgets)) {
+			continue
+		}
+		r.l.Info("updating metrics configuration status", zap.String("crd Name", mcc.Name), zap.String("state", status.State), zap.String("reason", status.Reason))
+		mcc.Status = status
+		if err := r.Client.Status().Update(ctx, mcc); err != nil {
+			r.l.Error("Error updating metrics configuration", zap.String("crd Name", mcc.Name), zap.Error(err))
+			errs = append(errs, err)
 		}
 	}
 
-	if err := r.Client.Status().Update(ctx, mcc); err != nil {
-		r.l.Error("Error updating metrics configuration", zap.Error(err))
-		return ctrl.Result{}, err
+	return ctrl.Result{}, errors.Join(errs...)
+}
+
+// nodeNames returns the names of the nodes of the cluster.
+func (r *MetricsConfigurationReconciler) nodeNames(ctx context.Context) (map[string]struct{}, error) {
+	nodes := &metav1.PartialObjectMetadataList{}
+	nodes.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("NodeList"))
+	if err := r.Client.List(ctx, nodes); err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	names := make(map[string]struct{}, len(nodes.Items))
+	for i := range nodes.Items {
+		names[nodes.Items[i].Name] = struct{}{}
 	}
+	return names, nil
+}
 
-	return ctrl.Result{}, nil
+// existingNodesOnly removes the nodes which no longer exist from the series budgets reported by the nodes, as a deleted
+// node can no longer remove itself.
+func existingNodesOnly(budgets []retinav1alpha1.ExceededSeriesBudget, nodes map[string]struct{}) []retinav1alpha1.ExceededSeriesBudget {
+	var existing []retinav1alpha1.ExceededSeriesBudget
+	for _, budget := range budgets {
+		budgetNodes := slices.DeleteFunc(slices.Clone(budget.Nodes), func(node string) bool {
+			_, ok := nodes[node]
+			return !ok
+		})
+		if len(budgetNodes) > 0 {
+			existing = append(existing, retinav1alpha1.ExceededSeriesBudget{MetricName: budget.MetricName, Nodes: budgetNodes})
+		}
+	}
+	return existing
 }
 
-// SetupWithManager sets up the controller with the Manager.
+// SetupWithManager sets up the controller with the Manager. The deletion of a node reconciles the MetricsConfigurations,
+// to remove the node from the series budgets it reported.
 func (r *MetricsConfigurationReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&retinav1alpha1.MetricsConfiguration{}).
+		WatchesMetadata(
+			&corev1.Node{},
+			handler.EnqueueRequestsFromMapFunc(func(_ context.Context, obj client.Object) []reconcile.Request {
+				return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: obj.GetName()}}}
+			}),
+			builder.WithPredicates(predicate.Funcs{
+				CreateFunc:  func(event.CreateEvent) bool { return false },
+				UpdateFunc:  func(event.UpdateEvent) bool { return false },
+				GenericFunc: func(event.GenericEvent) bool { return false },
+			}),
+		).
 		Complete(r)
 }
@@ -16,9 +16,11 @@ package metricsconfigurationcontroller
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/microsoft/retina/pkg/log"
 	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -129,3 +131,97 @@ func TestMetricsConfigurationReconciler_Reconcile(t *testing.T) {
 		})
 	}
 }
+
+func TestMetricsConfigurationReconciler_ReconcileMultiple(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+
+	created := metav1.Now()
+	newMC := func(name string, created metav1.Time, labels ...string) *retinav1alpha1.MetricsConfiguration {
+		return &retinav1alpha1.MetricsConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: created},
+			Spec: retinav1alpha1.MetricsSpec{
+				ContextOptions: []retinav1alpha1.MetricsContextOptions{
+					{MetricName: "drop_count", SourceLabels: labels},
+				},
+				Namespaces: retinav1alpha1.MetricsNamespaces{Include: []string{name}},
+			},
+		}
+	}
+	teamA := newMC("team-a", created, "podname")
+	teamB := newMC("team-b", metav1.NewTime(created.Add(time.Minute)), "ip")
+	invalid := newMC("invalid", created)
+	invalid.Spec.ContextOptions[0].MetricName = "unknown"
+
+	client := fake.NewClientBuilder().
+		WithScheme(fakescheme).
+		WithObjects(teamA, teamB, invalid).
+		WithStatusSubresource(&retinav1alpha1.MetricsConfiguration{}).
+		Build()
+	r := New(client, fakescheme)
+
+	_, err = r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "team-b"}})
+	require.NoError(t, err)
+
+	state := func(name string) retinav1alpha1.MetricsStatus {
+		mc := &retinav1alpha1.MetricsConfiguration{}
+		require.NoError(t, client.Get(context.TODO(), types.NamespacedName{Name: name}, mc))
+		return mc.Status
+	}
+	require.Equal(t, retinav1alpha1.StateAccepted, state("team-a").State)
+	require.Equal(t, retinav1alpha1.StateWarning, state("team-b").State)
+	require.Contains(t, state("team-b").Reason, "drop_count (configured by team-a)")
+	require.Equal(t, retinav1alpha1.StateErrored, state("invalid").State)
+	// The daemons apply the specs accepted by the operator.
+	require.Equal(t, &teamA.Spec, state("team-a").LastKnownSpec)
+	require.Equal(t, &teamB.Spec, state("team-b").LastKnownSpec)
+	require.Nil(t, state("invalid").LastKnownSpec)
+
+	// Once team-a is deleted, the metric of team-b is applied.
+	require.NoError(t, client.Delete(context.TODO(), teamA))
+	_, err = r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "team-a"}})
+	require.NoError(t, err)
+	require.Equal(t, retinav1alpha1.StateAccepted, state("team-b").State)
+}
+
+func TestMetricsConfigurationReconciler_SeriesBudgets(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+
+	mc := &retinav1alpha1.MetricsConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "test"},
+		Spec: retinav1alpha1.MetricsSpec{
+			ContextOptions: []retinav1alpha1.MetricsContextOptions{
+				{MetricName: "drop_count", SourceLabels: []string{"ip"}, MaxSeries: 10, TTL: "10m"},
+			},
+			Namespaces: retinav1alpha1.MetricsNamespaces{Include: []string{"default"}},
+		},
+	}
+	// The agents of node-1 and of the deleted node-2 reported the series budget.
+	mc.Status.SetSeriesBudgetExceeded("drop_count", "node-1", true)
+	mc.Status.SetSeriesBudgetExceeded("drop_count", "node-2", true)
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}
+	client := fake.NewClientBuilder().
+		WithScheme(fakescheme).
+		WithObjects(mc, node).
+		WithStatusSubresource(&retinav1alpha1.MetricsConfiguration{}).
+		Build()
+	r := New(client, fakescheme)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "test"}}
+
+	_, err = r.Reconcile(context.TODO(), req)
+	require.NoError(t, err)
+	got := &retinav1alpha1.MetricsConfiguration{}
+	require.NoError(t, client.Get(context.TODO(), req.NamespacedName, got))
+	require.Equal(t, retinav1alpha1.StateWarning, got.Status.State)
+	require.Equal(t, "CRD is Accepted, applied metrics: drop_count; series budget reached: drop_count (on 1 nodes)", got.Status.Reason)
+	require.Equal(t, []retinav1alpha1.ExceededSeriesBudget{{MetricName: "drop_count", Nodes: []string{"node-1"}}}, got.Status.ExceededSeriesBudgets)
+
+	// Once node-1 is deleted too, no node reports the series budget.
+	require.NoError(t, client.Delete(context.TODO(), node))
+	_, err = r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "node-1"}})
+	require.NoError(t, err)
+	require.NoError(t, client.Get(context.TODO(), req.NamespacedName, got))
+	require.Equal(t, retinav1alpha1.StateAccepted, got.Status.State)
+	require.Empty(t, got.Status.ExceededSeriesBudgets)
+}
@@ -39,6 +39,9 @@ type Enricher struct {
 	Reader *container.RingReader
 
 	outputRing *container.Ring
+
+	// recorders receive the events written to the enricher, see AddRecorder
+	recorders
 }
 
 func New(ctx context.Context, c cache.CacheInterface) *Enricher {
@@ -63,6 +66,16 @@ func newEnricher(ctx context.Context, c cache.CacheInterface) *Enricher {
 	return enricher
 }
 
+// NewStandalone returns an enricher which is not shared with the plugins, to enrich events synchronously with Enrich,
+// e.g. when replaying recorded events.
+func NewStandalone(ctx context.Context, c cache.CacheInterface) *Enricher {
+	return &Enricher{
+		ctx:   ctx,
+		l:     log.Logger().Named("enricher"),
+		cache: c,
+	}
+}
+
 func Instance() *Enricher {
 	return e
 }
@@ -106,20 +119,28 @@ func (e *Enricher) Run() {
 
 // enrich takes the flow and enriches it with the information from the cache
 func (e *Enricher) enrich(ev *v1.Event) {
+	if e.Enrich(ev) {
+		e.export(ev)
+	}
+}
+
+// Enrich enriches the flow of the event in place with the information from the cache. It returns false if the event
+// cannot be enriched and must not be exported.
+func (e *Enricher) Enrich(ev *v1.Event) bool {
 	if ev == nil {
 		e.l.Debug("received nil event to enrich")
-		return
+		return false
 	}
 
 	flow := ev.Event.(*flow.Flow)
 	if flow == nil {
 		e.l.Debug("received nil flow to enrich", zap.Any("event", ev))
-		return
+		return false
 	}
 
 	if flow.GetIP() == nil {
 		e.l.Debug("flow IP is nil", zap.Any("flow", flow))
-		return
+		return false
 	}
 
 	// IPversion is a enum in the flow proto
@@ -128,25 +149,27 @@ func (e *Enricher) enrich(ev *v1.Event) {
 	// 2: IPVersion_IPv6
 	if flow.GetIP().GetIpVersion() > 1 {
 		e.l.Debug("IP version is not supported", zap.Any("IPVersion", flow.GetIP().GetIpVersion()))
-		return
+		return false
 	}
 	if flow.IP.Source == "" {
 		e.l.Debug("source IP is empty")
-		return
+		return false
 	}
 	srcObj := e.cache.GetObjByIP(flow.IP.Source)
 	if srcObj != nil {
 		flow.Source = e.getEndpoint(srcObj)
+		flow.SourceService = getService(srcObj)
 	}
 
 	if flow.IP.Destination == "" {
 		e.l.Debug("destination IP is empty")
-		return
+		return false
 	}
 
 	dstObj := e.cache.GetObjByIP(flow.IP.Destination)
 	if dstObj != nil {
 		flow.Destination = e.getEndpoint(dstObj)
+		flow.DestinationService = getService(dstObj)
 	}
 
 	// Resolve zones lazily from the node cache using the pod's nodeIP.
@@ -162,7 +185,17 @@ func (e *Enricher) enrich(ev *v1.Event) {
 
 	ev.Event = flow
 	e.l.Debug("enriched flow", zap.Any("flow", flow))
-	e.export(ev)
+	return true
+}
+
+// EndpointByIP returns the endpoint of the pod with the given IP, or nil if the IP is not of a known pod.
+func (e *Enricher) EndpointByIP(ip string) *flow.Endpoint {
+	return e.getEndpoint(e.cache.GetObjByIP(ip))
+}
+
+// Pods returns the pods in the cache, including the pods in the host network.
+func (e *Enricher) Pods() []*common.RetinaEndpoint {
+	return e.cache.GetPods()
 }
 
 // export forwards the flow to other modules
@@ -178,12 +211,7 @@ func (e *Enricher) getEndpoint(obj interface{}) *flow.Endpoint {
 	switch o := obj.(type) {
 	case *common.RetinaEndpoint:
 		// TODO add service type
-		return &flow.Endpoint{
-			Namespace: o.Namespace(),
-			PodName:   o.Name(),
-			Labels:    o.FormattedLabels(),
-			Workloads: e.getWorkloads(o.OwnerRefs()),
-		}
+		return PodEndpoint(o)
 
 	case *common.RetinaSvc:
 		// todo
@@ -195,7 +223,30 @@ func (e *Enricher) getEndpoint(obj interface{}) *flow.Endpoint {
 	}
 }
 
-func (e *Enricher) getWorkloads(ownerRefs []*common.OwnerReference) []*flow.Workload {
+// getService returns the Service of a flow IP which is the IP of a Service, e.g. the cluster IP before the
+// destination is translated to a backend pod.
+func getService(obj interface{}) *flow.Service {
+	svc, ok := obj.(*common.RetinaSvc)
+	if !ok {
+		return nil
+	}
+	return &flow.Service{
+		Name:      svc.Name(),
+		Namespace: svc.Namespace(),
+	}
+}
+
+// PodEndpoint returns the flow endpoint of a pod.
+func PodEndpoint(ep *common.RetinaEndpoint) *flow.Endpoint {
+	return &flow.Endpoint{
+		Namespace: ep.Namespace(),
+		PodName:   ep.Name(),
+		Labels:    ep.FormattedLabels(),
+		Workloads: getWorkloads(ep.OwnerRefs()),
+	}
+}
+
+func getWorkloads(ownerRefs []*common.OwnerReference) []*flow.Workload {
 	if ownerRefs == nil {
 		return nil
 	}
@@ -214,6 +265,7 @@ func (e *Enricher) getWorkloads(ownerRefs []*common.OwnerReference) []*flow.Work
 }
 
 func (e *Enricher) Write(ev *v1.Event) {
+	e.record(ev)
 	e.inputRing.Write(ev)
 }
 
@@ -227,7 +279,8 @@ func (e *Enricher) zoneFromObj(obj interface{}) string {
 	if obj == nil {
 		return "unknown"
 	}
-	if o, ok := obj.(*common.RetinaEndpoint); ok {
+	switch o := obj.(type) {
+	case *common.RetinaEndpoint:
 		if nodeIP := o.NodeIP(); nodeIP != "" {
 			node := e.cache.GetNodeByIP(nodeIP)
 			if node != nil {
@@ -236,6 +289,11 @@ func (e *Enricher) zoneFromObj(obj interface{}) string {
 				}
 			}
 		}
+	case *common.RetinaNode:
+		// host network traffic
+		if z := o.Zone(); z != "" {
+			return z
+		}
 	}
 	return "unknown"
 }
@@ -357,3 +357,68 @@ func TestEnricherZoneResolution_NoNode(t *testing.T) {
 	assert.Equal(t, "unknown", utils.SourceZone(enrichedFlow))
 	assert.Equal(t, "unknown", utils.DestinationZone(enrichedFlow))
 }
+
+func TestEnricherRecorder(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	e := newEnricher(context.Background(), cache.New(pubsub.New()))
+
+	var recorded []*v1.Event
+	remove := e.AddRecorder(func(ev *v1.Event) {
+		recorded = append(recorded, ev)
+	})
+	ev := &v1.Event{Event: &flow.Flow{}}
+	e.Write(ev)
+	remove()
+	remove()
+	e.Write(&v1.Event{Event: &flow.Flow{}})
+
+	assert.Equal(t, []*v1.Event{ev}, recorded)
+}
+
+func TestEnricherService(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+
+	c := cache.New(pubsub.New())
+	require.NoError(t, c.UpdateRetinaEndpoint(common.NewRetinaEndpoint("client", "ns1", &common.IPAddresses{IPv4: net.IPv4(1, 1, 1, 1)})))
+	require.NoError(t, c.UpdateRetinaSvc(common.NewRetinaSvc("backend", "ns2", &common.IPAddresses{IPv4: net.IPv4(10, 0, 0, 10)}, nil, nil)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e := NewStandalone(ctx, c)
+
+	f := &flow.Flow{
+		IP: &flow.IP{
+			IpVersion:   1,
+			Source:      "1.1.1.1",
+			Destination: "10.0.0.10",
+		},
+	}
+	require.True(t, e.Enrich(&v1.Event{Event: f}))
+	assert.Equal(t, "client", f.GetSource().GetPodName())
+	assert.Nil(t, f.GetSourceService())
+	assert.Nil(t, f.GetDestination())
+	assert.Equal(t, "backend", f.GetDestinationService().GetName())
+	assert.Equal(t, "ns2", f.GetDestinationService().GetNamespace())
+}
+
+func TestEnricherEndpointByIP(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+
+	c := cache.New(pubsub.New())
+	require.NoError(t, c.UpdateRetinaEndpoint(common.NewRetinaEndpoint("client", "ns1", &common.IPAddresses{IPv4: net.IPv4(1, 1, 1, 1)})))
+	require.NoError(t, c.UpdateRetinaSvc(common.NewRetinaSvc("backend", "ns2", &common.IPAddresses{IPv4: net.IPv4(10, 0, 0, 10)}, nil, nil)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e := NewStandalone(ctx, c)
+
+	ep := e.EndpointByIP("1.1.1.1")
+	require.NotNil(t, ep)
+	assert.Equal(t, "client", ep.GetPodName())
+	assert.Equal(t, "ns1", ep.GetNamespace())
+	assert.Nil(t, e.EndpointByIP("10.0.0.10"))
+	assert.Nil(t, e.EndpointByIP("3.3.3.3"))
+}
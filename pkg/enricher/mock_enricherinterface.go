@@ -18,8 +18,10 @@ package enricher
 import (
 	reflect "reflect"
 
+	flow "github.com/cilium/cilium/api/v1/flow"
 	v1 "github.com/cilium/cilium/pkg/hubble/api/v1"
 	container "github.com/cilium/cilium/pkg/hubble/container"
+	common "github.com/microsoft/retina/pkg/common"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -46,6 +48,20 @@ func (m *MockEnricherInterface) EXPECT() *MockEnricherInterfaceMockRecorder {
 	return m.recorder
 }
 
+// EndpointByIP mocks base method.
+func (m *MockEnricherInterface) EndpointByIP(arg0 string) *flow.Endpoint {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EndpointByIP", arg0)
+	ret0, _ := ret[0].(*flow.Endpoint)
+	return ret0
+}
+
+// EndpointByIP indicates an expected call of EndpointByIP.
+func (mr *MockEnricherInterfaceMockRecorder) EndpointByIP(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EndpointByIP", reflect.TypeOf((*MockEnricherInterface)(nil).EndpointByIP), arg0)
+}
+
 // ExportReader mocks base method.
 func (m *MockEnricherInterface) ExportReader() *container.RingReader {
 	m.ctrl.T.Helper()
@@ -60,6 +76,20 @@ func (mr *MockEnricherInterfaceMockRecorder) ExportReader() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportReader", reflect.TypeOf((*MockEnricherInterface)(nil).ExportReader))
 }
 
+// Pods mocks base method.
+func (m *MockEnricherInterface) Pods() []*common.RetinaEndpoint {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Pods")
+	ret0, _ := ret[0].([]*common.RetinaEndpoint)
+	return ret0
+}
+
+// Pods indicates an expected call of Pods.
+func (mr *MockEnricherInterfaceMockRecorder) Pods() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Pods", reflect.TypeOf((*MockEnricherInterface)(nil).Pods))
+}
+
 // Run mocks base method.
 func (m *MockEnricherInterface) Run() {
 	m.ctrl.T.Helper()
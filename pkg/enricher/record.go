@@ -0,0 +1,59 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package enricher
+
+import (
+	"sync"
+	"sync/atomic"
+
+	v1 "github.com/cilium/cilium/pkg/hubble/api/v1"
+)
+
+// Recorder is called with every event written to the enricher, before it is enriched. It is called on the goroutine of
+// the plugin writing the event, so it must not block and must copy what it keeps, as the event is enriched in place
+// afterwards.
+type Recorder func(ev *v1.Event)
+
+type recorders struct {
+	recordersMu sync.RWMutex
+	// recorderCount avoids taking the lock for every event while nothing is recorded
+	recorderCount atomic.Int32
+	recorderMap   map[int]Recorder
+	nextRecorder  int
+}
+
+// AddRecorder registers a recorder for the events written to the enricher. The returned function removes it.
+func (r *recorders) AddRecorder(rec Recorder) (remove func()) {
+	r.recordersMu.Lock()
+	defer r.recordersMu.Unlock()
+
+	if r.recorderMap == nil {
+		r.recorderMap = make(map[int]Recorder)
+	}
+	id := r.nextRecorder
+	r.nextRecorder++
+	r.recorderMap[id] = rec
+	r.recorderCount.Add(1)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.recordersMu.Lock()
+			defer r.recordersMu.Unlock()
+			delete(r.recorderMap, id)
+			r.recorderCount.Add(-1)
+		})
+	}
+}
+
+func (r *recorders) record(ev *v1.Event) {
+	if r.recorderCount.Load() == 0 {
+		return
+	}
+
+	r.recordersMu.RLock()
+	defer r.recordersMu.RUnlock()
+	for _, rec := range r.recorderMap {
+		rec(ev)
+	}
+}
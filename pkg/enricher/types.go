@@ -3,8 +3,10 @@
 package enricher
 
 import (
+	"github.com/cilium/cilium/api/v1/flow"
 	v1 "github.com/cilium/cilium/pkg/hubble/api/v1"
 	"github.com/cilium/cilium/pkg/hubble/container"
+	"github.com/microsoft/retina/pkg/common"
 )
 
 //go:generate go run go.uber.org/mock/mockgen@v0.4.0 -destination=mock_enricherinterface.go  -copyright_file=../lib/ignore_headers.txt -package=enricher github.com/microsoft/retina/pkg/enricher EnricherInterface
@@ -13,4 +15,6 @@ type EnricherInterface interface {
 	Run()
 	Write(ev *v1.Event)
 	ExportReader() *container.RingReader
+	EndpointByIP(ip string) *flow.Endpoint
+	Pods() []*common.RetinaEndpoint
 }
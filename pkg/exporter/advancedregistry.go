@@ -0,0 +1,90 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package exporter
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// AdvancedMetricsRegistry is the registry of the advanced metrics. Every collector is registered in a registry of its
+// own, so that a metric can be unregistered and registered again with different labels without resetting the series
+// of the other advanced metrics. A prometheus.Registry keeps the labels of unregistered metrics for its lifetime.
+type AdvancedMetricsRegistry struct {
+	mu         sync.RWMutex
+	registries map[prometheus.Collector]*prometheus.Registry
+}
+
+func NewAdvancedMetricsRegistry() *AdvancedMetricsRegistry {
+	return &AdvancedMetricsRegistry{
+		registries: make(map[prometheus.Collector]*prometheus.Registry),
+	}
+}
+
+// Register implements prometheus.Registerer.
+func (r *AdvancedMetricsRegistry) Register(c prometheus.Collector) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.registries[c]; ok {
+		return prometheus.AlreadyRegisteredError{ExistingCollector: c, NewCollector: c}
+	}
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(c); err != nil {
+		return err //nolint:wrapcheck // returned as a prometheus.Registry would
+	}
+	r.registries[c] = registry
+	return nil
+}
+
+// MustRegister implements prometheus.Registerer.
+func (r *AdvancedMetricsRegistry) MustRegister(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Unregister implements prometheus.Registerer.
+func (r *AdvancedMetricsRegistry) Unregister(c prometheus.Collector) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.registries[c]; !ok {
+		return false
+	}
+	delete(r.registries, c)
+	return true
+}
+
+// Reset unregisters all collectors.
+func (r *AdvancedMetricsRegistry) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.registries = make(map[prometheus.Collector]*prometheus.Registry)
+}
+
+// Gather implements prometheus.Gatherer.
+func (r *AdvancedMetricsRegistry) Gather() ([]*dto.MetricFamily, error) {
+	r.mu.RLock()
+	gatherers := make(prometheus.Gatherers, 0, len(r.registries))
+	for _, registry := range r.registries {
+		gatherers = append(gatherers, registry)
+	}
+	r.mu.RUnlock()
+	return gatherers.Gather() //nolint:wrapcheck // returned as a prometheus.Registry would
+}
+
+// Describe implements prometheus.Collector. It describes no metrics, so that the registry is registered as an
+// unchecked collector whose metrics may change.
+func (r *AdvancedMetricsRegistry) Describe(chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector.
+func (r *AdvancedMetricsRegistry) Collect(ch chan<- prometheus.Metric) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, registry := range r.registries {
+		registry.Collect(ch)
+	}
+}
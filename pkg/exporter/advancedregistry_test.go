@@ -0,0 +1,51 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package exporter
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdvancedMetricsRegistry(t *testing.T) {
+	r := NewAdvancedMetricsRegistry()
+	opts := prometheus.GaugeOpts{Name: "adv_drop_count", Help: "drop count"}
+
+	drop := prometheus.NewGaugeVec(opts, []string{"ip"})
+	forward := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "adv_forward_count", Help: "forward count"}, []string{"ip"})
+	r.MustRegister(drop, forward)
+	require.Error(t, r.Register(drop))
+
+	drop.WithLabelValues("10.0.0.1").Set(1)
+	forward.WithLabelValues("10.0.0.1").Set(2)
+	families, err := r.Gather()
+	require.NoError(t, err)
+	assert.Len(t, families, 2)
+
+	// The metric is registered again with different labels, without resetting the other metric.
+	assert.True(t, r.Unregister(drop))
+	assert.False(t, r.Unregister(drop))
+	relabeled := prometheus.NewGaugeVec(opts, []string{"ip", "podname"})
+	require.NoError(t, r.Register(relabeled))
+	relabeled.WithLabelValues("10.0.0.1", "pod-1").Set(3)
+
+	families, err = r.Gather()
+	require.NoError(t, err)
+	require.Len(t, families, 2)
+	for _, family := range families {
+		require.Len(t, family.GetMetric(), 1)
+		if family.GetName() == "adv_drop_count" {
+			assert.Len(t, family.GetMetric()[0].GetLabel(), 2)
+		} else {
+			assert.InDelta(t, 2, family.GetMetric()[0].GetGauge().GetValue(), 0)
+		}
+	}
+
+	r.Reset()
+	families, err = r.Gather()
+	require.NoError(t, err)
+	assert.Empty(t, families)
+}
@@ -17,15 +17,16 @@ type CallBackFunc func()
 var (
 	// CombinedGatherer is the combined registry for all metrics to be exposed by promhttp
 	CombinedGatherer *prometheus.Registry
-	// AdvancedRegistry is used for advanced metrics. This registry can be reset upon metrics config reconciliation
-	AdvancedRegistry     *prometheus.Registry
+	// AdvancedRegistry is used for advanced metrics. Metrics are unregistered when they are removed or changed upon
+	// metrics config reconciliation.
+	AdvancedRegistry     *AdvancedMetricsRegistry
 	DefaultRegistry      *prometheus.Registry
 	MetricsServeCallback CallBackFunc
 )
 
 func init() {
 	DefaultRegistry = prometheus.DefaultRegisterer.(*prometheus.Registry)
-	AdvancedRegistry = prometheus.NewRegistry()
+	AdvancedRegistry = NewAdvancedMetricsRegistry()
 	CombinedGatherer = prometheus.NewRegistry()
 	CombinedGatherer.MustRegister(AdvancedRegistry)
 	CombinedGatherer.MustRegister(DefaultRegistry)
@@ -33,9 +34,7 @@ func init() {
 }
 
 func ResetAdvancedMetricsRegistry() {
-	CombinedGatherer.Unregister(AdvancedRegistry)
-	AdvancedRegistry = prometheus.NewRegistry()
-	CombinedGatherer.MustRegister(AdvancedRegistry)
+	AdvancedRegistry.Reset()
 	MetricsServeCallback()
 }
 
@@ -76,6 +75,17 @@ func CreatePrometheusCounterVecForControlPlaneMetric(r prometheus.Registerer, na
 	)
 }
 
+func CreatePrometheusGaugeVecForControlPlaneMetric(r prometheus.Registerer, name, desc string, labels ...string) *prometheus.GaugeVec {
+	return promauto.With(r).NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: retinaControlPlaneNamespace,
+			Name:      name,
+			Help:      desc,
+		},
+		labels,
+	)
+}
+
 func CreatePrometheusHistogramWithLinearBucketsForMetric(r prometheus.Registerer, name, desc string, start, width float64, count int) prometheus.Histogram {
 	opts := prometheus.HistogramOpts{
 		Namespace: RetinaNamespace,
@@ -86,6 +96,18 @@ func CreatePrometheusHistogramWithLinearBucketsForMetric(r prometheus.Registerer
 	return promauto.With(r).NewHistogram(opts)
 }
 
+func CreatePrometheusHistogramVecForMetric(r prometheus.Registerer, name, desc string, buckets []float64, labels ...string) *prometheus.HistogramVec {
+	return promauto.With(r).NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: RetinaNamespace,
+			Name:      name,
+			Help:      desc,
+			Buckets:   buckets,
+		},
+		labels,
+	)
+}
+
 func UnregisterMetric(r prometheus.Registerer, metric prometheus.Collector) {
 	if metric != nil {
 		r.Unregister(metric)
@@ -25,6 +25,12 @@ type GaugeVec interface {
 	GetMetricWithLabelValues(lvs ...string) (prometheus.Gauge, error)
 }
 
+type HistogramVec interface {
+	MetricVec
+	WithLabelValues(lvs ...string) prometheus.Observer
+	GetMetricWithLabelValues(lvs ...string) (prometheus.Observer, error)
+}
+
 type Histogram interface {
 	Observe(float64)
 	// Keep the Write method for testing purposes.
@@ -115,6 +115,40 @@ func InitializeMetrics(logger *slog.Logger) {
 		utils.StatName,
 	)
 
+	// Softnet Stats
+	SoftnetStatsGauge = exporter.CreatePrometheusGaugeVecForMetric(
+		exporter.DefaultRegistry,
+		utils.SoftnetStatsName,
+		softnetStatsGaugeDescription,
+		utils.CPU,
+		utils.StatName,
+	)
+
+	// Qdisc Stats
+	QdiscStatsGauge = exporter.CreatePrometheusGaugeVecForMetric(
+		exporter.DefaultRegistry,
+		utils.QdiscStatsName,
+		qdiscStatsGaugeDescription,
+		utils.InterfaceName,
+		utils.Namespace,
+		utils.PodName,
+		utils.Kind,
+		utils.Handle,
+		utils.StatName,
+	)
+
+	QdiscClassStatsGauge = exporter.CreatePrometheusGaugeVecForMetric(
+		exporter.DefaultRegistry,
+		utils.QdiscClassStatsName,
+		qdiscClassStatsGaugeDescription,
+		utils.InterfaceName,
+		utils.Namespace,
+		utils.PodName,
+		utils.Kind,
+		utils.Handle,
+		utils.StatName,
+	)
+
 	// Control Plane Metrics
 	PluginManagerFailedToReconcileCounter = exporter.CreatePrometheusCounterVecForControlPlaneMetric(
 		exporter.DefaultRegistry,
@@ -162,6 +196,35 @@ func InitializeMetrics(logger *slog.Logger) {
 		utils.InterfaceName,
 	)
 
+	InfinibandHWCounterStatsGauge = exporter.CreatePrometheusGaugeVecForMetric(
+		exporter.DefaultRegistry,
+		utils.InfinibandHWCounterStatsName,
+		infinibandHWCounterStatsGaugeDescription,
+		utils.StatName,
+		utils.Device,
+		utils.Port,
+	)
+
+	InfinibandQueuePairsGauge = exporter.CreatePrometheusGaugeVecForMetric(
+		exporter.DefaultRegistry,
+		utils.InfinibandQueuePairsName,
+		infinibandQueuePairsGaugeDescription,
+		utils.Device,
+		utils.Port,
+		utils.State,
+		utils.Type,
+	)
+
+	InfinibandPodResourcesGauge = exporter.CreatePrometheusGaugeVecForMetric(
+		exporter.DefaultRegistry,
+		utils.InfinibandPodResourcesName,
+		infinibandPodResourcesGaugeDescription,
+		utils.Device,
+		utils.Namespace,
+		utils.PodName,
+		utils.Resource,
+	)
+
 	ConntrackPacketsTx = exporter.CreatePrometheusGaugeVecForMetric(
 		exporter.DefaultRegistry,
 		utils.ConntrackPacketsTxGaugeName,
@@ -192,6 +255,174 @@ func InitializeMetrics(logger *slog.Logger) {
 		ConntrackTotalConnectionsDescription,
 	)
 
+	// Netfilter conntrack table
+	NfConntrackEntriesGauge = exporter.CreatePrometheusGaugeVecForMetric(
+		exporter.DefaultRegistry,
+		utils.NfConntrackEntriesName,
+		nfConntrackEntriesDescription,
+	)
+
+	NfConntrackMaxEntriesGauge = exporter.CreatePrometheusGaugeVecForMetric(
+		exporter.DefaultRegistry,
+		utils.NfConntrackMaxEntriesName,
+		nfConntrackMaxEntriesDescription,
+	)
+
+	NfConntrackCPUStatsGauge = exporter.CreatePrometheusGaugeVecForMetric(
+		exporter.DefaultRegistry,
+		utils.NfConntrackCPUStatsName,
+		nfConntrackCPUStatsDescription,
+		utils.CPU,
+		utils.StatName,
+	)
+
+	NfConntrackPodEntriesGauge = exporter.CreatePrometheusGaugeVecForMetric(
+		exporter.DefaultRegistry,
+		utils.NfConntrackPodEntriesName,
+		nfConntrackPodEntriesDescription,
+		utils.Namespace,
+		utils.PodName,
+	)
+
+	// TCP sockets of the pods
+	TCPSocketRTTHistogram = exporter.CreatePrometheusHistogramVecForMetric(
+		exporter.DefaultRegistry,
+		utils.TCPSocketRTTName,
+		tcpSocketRTTDescription,
+		tcpSocketRTTBuckets,
+		utils.Namespace,
+		utils.WorkloadKind,
+		utils.WorkloadName,
+		utils.PodName,
+	)
+
+	TCPSocketRTTVarHistogram = exporter.CreatePrometheusHistogramVecForMetric(
+		exporter.DefaultRegistry,
+		utils.TCPSocketRTTVarName,
+		tcpSocketRTTVarDescription,
+		tcpSocketRTTBuckets,
+		utils.Namespace,
+		utils.WorkloadKind,
+		utils.WorkloadName,
+		utils.PodName,
+	)
+
+	TCPSocketCwndHistogram = exporter.CreatePrometheusHistogramVecForMetric(
+		exporter.DefaultRegistry,
+		utils.TCPSocketCwndName,
+		tcpSocketCwndDescription,
+		tcpSocketCwndBuckets,
+		utils.Namespace,
+		utils.WorkloadKind,
+		utils.WorkloadName,
+		utils.PodName,
+	)
+
+	TCPSocketDeliveryRateHistogram = exporter.CreatePrometheusHistogramVecForMetric(
+		exporter.DefaultRegistry,
+		utils.TCPSocketDeliveryRateName,
+		tcpSocketDeliveryRateDescription,
+		tcpSocketDeliveryRateBuckets,
+		utils.Namespace,
+		utils.WorkloadKind,
+		utils.WorkloadName,
+		utils.PodName,
+	)
+
+	TCPSocketStatsGauge = exporter.CreatePrometheusGaugeVecForMetric(
+		exporter.DefaultRegistry,
+		utils.TCPSocketStatsName,
+		tcpSocketStatsDescription,
+		utils.Namespace,
+		utils.WorkloadKind,
+		utils.WorkloadName,
+		utils.PodName,
+		utils.StatName,
+	)
+
+	// TCP listen queues of the pods
+	ListenQueueOverflowsGauge = exporter.CreatePrometheusGaugeVecForMetric(
+		exporter.DefaultRegistry,
+		utils.ListenQueueOverflowsName,
+		listenQueueOverflowsDescription,
+		utils.Namespace,
+		utils.PodName,
+		utils.Port,
+		utils.Queue,
+	)
+
+	ListenAcceptQueueGauge = exporter.CreatePrometheusGaugeVecForMetric(
+		exporter.DefaultRegistry,
+		utils.ListenAcceptQueueName,
+		listenAcceptQueueDescription,
+		utils.Namespace,
+		utils.PodName,
+		utils.Port,
+		utils.StatName,
+	)
+
+	// ICMP errors and PMTU black holes
+	ICMPErrorCounter = exporter.CreatePrometheusCounterVecForMetric(
+		exporter.DefaultRegistry,
+		utils.ICMPErrorCounterName,
+		icmpErrorCounterDescription,
+		utils.Type,
+	)
+
+	PMTUBlackholeSuspectedGauge = exporter.CreatePrometheusGaugeVecForMetric(
+		exporter.DefaultRegistry,
+		utils.PMTUBlackholeSuspectedName,
+		pmtuBlackholeSuspectedDescription,
+		utils.Namespace,
+		utils.PodName,
+	)
+
+	// UDP receive drops of the pods
+	UDPSocketReceiveDropsGauge = exporter.CreatePrometheusGaugeVecForMetric(
+		exporter.DefaultRegistry,
+		utils.UDPSocketReceiveDropsName,
+		udpSocketReceiveDropsDescription,
+		utils.Namespace,
+		utils.PodName,
+		utils.Port,
+		utils.Reason,
+	)
+
+	// Neighbor table, route and link changes of the node
+	NeighborEntriesGauge = exporter.CreatePrometheusGaugeVecForMetric(
+		exporter.DefaultRegistry,
+		utils.NeighborEntriesName,
+		neighborEntriesDescription,
+		utils.Family,
+		utils.State,
+	)
+
+	NeighborGCThreshGauge = exporter.CreatePrometheusGaugeVecForMetric(
+		exporter.DefaultRegistry,
+		utils.NeighborGCThreshName,
+		neighborGCThreshDescription,
+		utils.Family,
+		utils.Threshold,
+	)
+
+	RouteChangeCounter = exporter.CreatePrometheusCounterVecForMetric(
+		exporter.DefaultRegistry,
+		utils.RouteChangeCounterName,
+		routeChangeCounterDescription,
+		utils.Family,
+		utils.Type,
+	)
+
+	LinkStateChangeCounter = exporter.CreatePrometheusCounterVecForMetric(
+		exporter.DefaultRegistry,
+		utils.LinkStateChangeCounterName,
+		linkStateChangeCounterDescription,
+		utils.InterfaceName,
+		utils.Namespace,
+		utils.PodName,
+		utils.State,
+	)
+
 	ParsedPacketsCounter = exporter.CreatePrometheusCounterVecForControlPlaneMetric(
 		exporter.DefaultRegistry,
 		parsedPacketsCounterName,
@@ -205,6 +436,29 @@ func InitializeMetrics(logger *slog.Logger) {
 		utils.Metric,
 	)
 
+	// Series budget of the advanced metrics
+	AdvancedMetricSeriesGauge = exporter.CreatePrometheusGaugeVecForControlPlaneMetric(
+		exporter.DefaultRegistry,
+		advancedMetricSeriesGaugeName,
+		advancedMetricSeriesGaugeDescription,
+		utils.Metric,
+	)
+
+	AdvancedMetricOverflowCounter = exporter.CreatePrometheusCounterVecForControlPlaneMetric(
+		exporter.DefaultRegistry,
+		advancedMetricOverflowCounterName,
+		advancedMetricOverflowCounterDescription,
+		utils.Metric,
+		utils.Reason,
+	)
+
+	AdvancedMetricEvictionsCounter = exporter.CreatePrometheusCounterVecForControlPlaneMetric(
+		exporter.DefaultRegistry,
+		advancedMetricEvictionsCounterName,
+		advancedMetricEvictionsCounterDescription,
+		utils.Metric,
+	)
+
 	isInitialized = true
 	metricsLogger.Info("Metrics initialized")
 }
@@ -21,6 +21,7 @@ import (
 type MockMetricVec struct {
 	ctrl     *gomock.Controller
 	recorder *MockMetricVecMockRecorder
+	isgomock struct{}
 }
 
 // MockMetricVecMockRecorder is the mock recorder for MockMetricVec.
@@ -62,6 +63,7 @@ func (mr *MockMetricVecMockRecorder) DeleteLabelValues(lvs ...any) *gomock.Call
 type MockCounterVec struct {
 	ctrl     *gomock.Controller
 	recorder *MockCounterVecMockRecorder
+	isgomock struct{}
 }
 
 // MockCounterVecMockRecorder is the mock recorder for MockCounterVec.
@@ -140,6 +142,7 @@ func (mr *MockCounterVecMockRecorder) WithLabelValues(lvs ...any) *gomock.Call {
 type MockGaugeVec struct {
 	ctrl     *gomock.Controller
 	recorder *MockGaugeVecMockRecorder
+	isgomock struct{}
 }
 
 // MockGaugeVecMockRecorder is the mock recorder for MockGaugeVec.
@@ -214,10 +217,90 @@ func (mr *MockGaugeVecMockRecorder) WithLabelValues(lvs ...any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithLabelValues", reflect.TypeOf((*MockGaugeVec)(nil).WithLabelValues), lvs...)
 }
 
+// MockHistogramVec is a mock of HistogramVec interface.
+type MockHistogramVec struct {
+	ctrl     *gomock.Controller
+	recorder *MockHistogramVecMockRecorder
+	isgomock struct{}
+}
+
+// MockHistogramVecMockRecorder is the mock recorder for MockHistogramVec.
+type MockHistogramVecMockRecorder struct {
+	mock *MockHistogramVec
+}
+
+// NewMockHistogramVec creates a new mock instance.
+func NewMockHistogramVec(ctrl *gomock.Controller) *MockHistogramVec {
+	mock := &MockHistogramVec{ctrl: ctrl}
+	mock.recorder = &MockHistogramVecMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockHistogramVec) EXPECT() *MockHistogramVecMockRecorder {
+	return m.recorder
+}
+
+// DeleteLabelValues mocks base method.
+func (m *MockHistogramVec) DeleteLabelValues(lvs ...string) bool {
+	m.ctrl.T.Helper()
+	varargs := []any{}
+	for _, a := range lvs {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "DeleteLabelValues", varargs...)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// DeleteLabelValues indicates an expected call of DeleteLabelValues.
+func (mr *MockHistogramVecMockRecorder) DeleteLabelValues(lvs ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteLabelValues", reflect.TypeOf((*MockHistogramVec)(nil).DeleteLabelValues), lvs...)
+}
+
+// GetMetricWithLabelValues mocks base method.
+func (m *MockHistogramVec) GetMetricWithLabelValues(lvs ...string) (prometheus.Observer, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{}
+	for _, a := range lvs {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "GetMetricWithLabelValues", varargs...)
+	ret0, _ := ret[0].(prometheus.Observer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMetricWithLabelValues indicates an expected call of GetMetricWithLabelValues.
+func (mr *MockHistogramVecMockRecorder) GetMetricWithLabelValues(lvs ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMetricWithLabelValues", reflect.TypeOf((*MockHistogramVec)(nil).GetMetricWithLabelValues), lvs...)
+}
+
+// WithLabelValues mocks base method.
+func (m *MockHistogramVec) WithLabelValues(lvs ...string) prometheus.Observer {
+	m.ctrl.T.Helper()
+	varargs := []any{}
+	for _, a := range lvs {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "WithLabelValues", varargs...)
+	ret0, _ := ret[0].(prometheus.Observer)
+	return ret0
+}
+
+// WithLabelValues indicates an expected call of WithLabelValues.
+func (mr *MockHistogramVecMockRecorder) WithLabelValues(lvs ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithLabelValues", reflect.TypeOf((*MockHistogramVec)(nil).WithLabelValues), lvs...)
+}
+
 // MockHistogram is a mock of Histogram interface.
 type MockHistogram struct {
 	ctrl     *gomock.Controller
 	recorder *MockHistogramMockRecorder
+	isgomock struct{}
 }
 
 // MockHistogramMockRecorder is the mock recorder for MockHistogram.
@@ -14,6 +14,9 @@ const (
 	lostEventsCounterName                     = "lost_events_counter"
 	parsedPacketsCounterName                  = "parsed_packets_counter"
 	expiredMetricsCounterName                 = "expired_metrics_counter"
+	advancedMetricSeriesGaugeName             = "advanced_metric_series"
+	advancedMetricOverflowCounterName         = "advanced_metric_overflow_counter"
+	advancedMetricEvictionsCounterName        = "advanced_metric_evictions_counter"
 
 	// Windows
 	hnsStats            = "windows_hns_stats"
@@ -36,17 +39,26 @@ const (
 	ipConnectionStatsGaugeDescription              = "IP connections statistics"
 	udpConnectionStatsGaugeDescription             = "UDP connections statistics"
 	interfaceStatsGaugeDescription                 = "Interface statistics"
+	softnetStatsGaugeDescription                   = "Packet receive processing statistics by CPU"
+	qdiscStatsGaugeDescription                     = "Queueing discipline statistics by interface"
+	qdiscClassStatsGaugeDescription                = "Traffic control class statistics by interface"
 	nodeAPIServerHandshakeLatencyDesc              = "Histogram depicting latency of the TCP handshake between nodes and Kubernetes API server measured in milliseconds"
 	dnsRequestCounterDescription                   = "DNS requests by statistics"
 	dnsResponseCounterDescription                  = "DNS responses by statistics"
 	infinibandStatsGaugeDescription                = "InfiniBand statistics gauge"
 	infinibandStatusParamsGaugeDescription         = "InfiniBand Status Parameters gauge"
+	infinibandHWCounterStatsGaugeDescription       = "InfiniBand hardware counters by port"
+	infinibandQueuePairsGaugeDescription           = "InfiniBand queue pairs by port, state and type"
+	infinibandPodResourcesGaugeDescription         = "InfiniBand queue pairs and memory regions by pod"
 
 	// Control plane metrics
 	pluginManagerFailedToReconcileCounterDescription = "Number of times the plugin manager failed to reconcile the plugins"
 	lostEventsCounterDescription                     = "Number of events lost in control plane"
 	parsedPacketsCounterDescription                  = "Number of packets parsed by the packetparser plugin"
 	expiredMetricsCounterDescription                 = "Number of metrics expired due to lack of updates and no longer exported"
+	advancedMetricSeriesGaugeDescription             = "Number of series tracked by an advanced metric"
+	advancedMetricOverflowCounterDescription         = "Number of updates of an advanced metric with label combinations over its series budget"
+	advancedMetricEvictionsCounterDescription        = "Number of series of an advanced metric evicted after their TTL, freeing room in its series budget"
 
 	// Conntrack metrics
 	ConntrackPacketTxDescription         = "Number of tx packets"
@@ -54,6 +66,45 @@ const (
 	ConntrackBytesTxDescription          = "Number of tx bytes"
 	ConntrackBytesRxDescription          = "Number of rx bytes"
 	ConntrackTotalConnectionsDescription = "Total number of connections"
+
+	// Netfilter conntrack table metrics
+	nfConntrackEntriesDescription    = "Number of entries in the nf_conntrack table"
+	nfConntrackMaxEntriesDescription = "Maximum number of entries of the nf_conntrack table"
+	nfConntrackCPUStatsDescription   = "nf_conntrack statistics by CPU"
+	nfConntrackPodEntriesDescription = "Number of nf_conntrack entries of the source pods with the most entries"
+
+	// TCP socket metrics
+	tcpSocketRTTDescription          = "Smoothed round trip time of the established TCP sockets of the pods in seconds, sampled every interval"
+	tcpSocketRTTVarDescription       = "Round trip time variance of the established TCP sockets of the pods in seconds, sampled every interval"
+	tcpSocketCwndDescription         = "Congestion window of the established TCP sockets of the pods in segments, sampled every interval"
+	tcpSocketDeliveryRateDescription = "Delivery rate of the established TCP sockets of the pods in bytes per second, sampled every interval"
+	tcpSocketStatsDescription        = "Statistics of the established TCP sockets of the pods"
+
+	// TCP listen queue metrics
+	listenQueueOverflowsDescription = "Number of SYNs and connections dropped by the full SYN or accept queues of the listening sockets of the pods"
+	listenAcceptQueueDescription    = "Length and maximum length of the accept queues of the listening sockets of the pods"
+
+	// ICMP error metrics
+	icmpErrorCounterDescription       = "Number of ICMP and ICMPv6 errors received by the node, by type"
+	pmtuBlackholeSuspectedDescription = "Number of established TCP sockets of the pods suspected to be stuck in a Path MTU black hole"
+
+	// UDP receive drop metrics
+	udpSocketReceiveDropsDescription = "Number of datagrams dropped by the full receive buffers of the UDP sockets of the pods or by UDP memory pressure"
+
+	// Neighbor table, route and link change metrics
+	neighborEntriesDescription        = "Number of entries in the neighbor (ARP and NDP) table of the node, by state"
+	neighborGCThreshDescription       = "Garbage collection thresholds of the neighbor table of the node"
+	routeChangeCounterDescription     = "Number of routes added to and deleted from the routing tables of the node"
+	linkStateChangeCounterDescription = "Number of times the interfaces of the node and the veths of the pods went up or down"
+)
+
+var (
+	// tcpSocketRTTBuckets range from 100us to about 3.3s
+	tcpSocketRTTBuckets = prometheus.ExponentialBuckets(0.0001, 2, 16)
+	// tcpSocketCwndBuckets range from 1 to 4096 segments
+	tcpSocketCwndBuckets = prometheus.ExponentialBuckets(1, 2, 13)
+	// tcpSocketDeliveryRateBuckets range from 1kB/s to about 4GB/s
+	tcpSocketDeliveryRateBuckets = prometheus.ExponentialBuckets(1000, 4, 12)
 )
 
 // Metric Counters
@@ -89,6 +140,13 @@ var (
 	// Interface Stats
 	InterfaceStatsGauge GaugeVec
 
+	// Softnet Stats
+	SoftnetStatsGauge GaugeVec
+
+	// Qdisc Stats
+	QdiscStatsGauge      GaugeVec
+	QdiscClassStatsGauge GaugeVec
+
 	metricsLogger *slog.Logger
 
 	// Control Plane Metrics
@@ -96,13 +154,19 @@ var (
 	LostEventsCounter                     CounterVec
 	ParsedPacketsCounter                  CounterVec
 	MetricsExpiredCounter                 CounterVec
+	AdvancedMetricSeriesGauge             GaugeVec
+	AdvancedMetricOverflowCounter         CounterVec
+	AdvancedMetricEvictionsCounter        CounterVec
 
 	// DNS Metrics.
 	DNSRequestCounter  CounterVec
 	DNSResponseCounter CounterVec
 
-	InfinibandStatsGauge        GaugeVec
-	InfinibandStatusParamsGauge GaugeVec
+	InfinibandStatsGauge          GaugeVec
+	InfinibandStatusParamsGauge   GaugeVec
+	InfinibandHWCounterStatsGauge GaugeVec
+	InfinibandQueuePairsGauge     GaugeVec
+	InfinibandPodResourcesGauge   GaugeVec
 
 	// Conntrack
 	ConntrackPacketsTx        GaugeVec
@@ -110,17 +174,45 @@ var (
 	ConntrackBytesTx          GaugeVec
 	ConntrackBytesRx          GaugeVec
 	ConntrackTotalConnections GaugeVec
+
+	// Netfilter conntrack table
+	NfConntrackEntriesGauge    GaugeVec
+	NfConntrackMaxEntriesGauge GaugeVec
+	NfConntrackCPUStatsGauge   GaugeVec
+	NfConntrackPodEntriesGauge GaugeVec
+
+	// TCP sockets of the pods
+	TCPSocketRTTHistogram          HistogramVec
+	TCPSocketRTTVarHistogram       HistogramVec
+	TCPSocketCwndHistogram         HistogramVec
+	TCPSocketDeliveryRateHistogram HistogramVec
+	TCPSocketStatsGauge            GaugeVec
+
+	// TCP listen queues of the pods
+	ListenQueueOverflowsGauge GaugeVec
+	ListenAcceptQueueGauge    GaugeVec
+
+	// ICMP errors and PMTU black holes
+	ICMPErrorCounter            CounterVec
+	PMTUBlackholeSuspectedGauge GaugeVec
+
+	// UDP receive drops of the pods
+	UDPSocketReceiveDropsGauge GaugeVec
+
+	// Neighbor table, route and link changes of the node
+	NeighborEntriesGauge   GaugeVec
+	NeighborGCThreshGauge  GaugeVec
+	RouteChangeCounter     CounterVec
+	LinkStateChangeCounter CounterVec
 )
 
 func ToPrometheusType(metric interface{}) prometheus.Collector {
-	if metric != nil {
+	if metric == nil {
 		return nil
 	}
 	switch m := metric.(type) {
-	case GaugeVec:
-		return m.(*prometheus.GaugeVec)
-	case CounterVec:
-		return m.(*prometheus.CounterVec)
+	case prometheus.Collector:
+		return m
 	default:
 		if metricsLogger != nil {
 			metricsLogger.Error("error converting unknown metric type", slog.Any("metric", m))
@@ -0,0 +1,391 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package metrics
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	api "github.com/microsoft/retina/crd/api/v1alpha1"
+	"github.com/microsoft/retina/pkg/common"
+	"github.com/microsoft/retina/pkg/utils"
+)
+
+// annotationMetricGroups are the groups of advanced metrics which can be selected by name in the metrics annotation.
+var annotationMetricGroups = map[string][]string{
+	forward:      {utils.ForwardPacketsGaugeName, utils.ForwardBytesGaugeName},
+	drop:         {utils.DroppedPacketsGaugeName, utils.DropBytesGaugeName},
+	"tcpflags":   {utils.TCPFlagGauge},
+	"tcpretrans": {utils.TCPRetransCount},
+	dns:          {utils.DNSRequestCounterName, utils.DNSResponseCounterName},
+}
+
+// annotationLabels are the context options which can be selected in the labels annotation, in the order of the labels.
+var annotationLabels = []string{
+	ipCtxOption,
+	namespaceCtxOption,
+	podCtxOption,
+	workloadCtxOption,
+	serviceCtxOption,
+	portCtxOption,
+	zoneCtxOption,
+}
+
+// metricsAnnotation is the selection of advanced metrics and context labels of a pod or namespace.
+type metricsAnnotation struct {
+	// metrics are the selected metrics, nil when the metrics of the cluster spec are selected
+	metrics map[string]struct{}
+	// labels are the selected context options, nil when the labels of the cluster spec are selected
+	labels []string
+	// options are the context options of the labels
+	options *ContextOptions
+}
+
+// parseMetricsAnnotation returns the selection of the retina metrics and labels annotations, and the values of the
+// annotations which are not known metrics or context options.
+func parseMetricsAnnotation(annotations map[string]string) (*metricsAnnotation, []string) {
+	a := &metricsAnnotation{}
+	var unknown []string
+
+	if value := strings.TrimSpace(annotations[common.RetinaMetricsAnnotation]); value != "" {
+		a.metrics = make(map[string]struct{})
+		for _, name := range strings.Split(value, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			switch {
+			case name == "":
+			case annotationMetricGroups[name] != nil:
+				for _, metric := range annotationMetricGroups[name] {
+					a.metrics[metric] = struct{}{}
+				}
+			case utils.IsAdvancedMetric(name) && !strings.Contains(name, nodeApiserver):
+				a.metrics[name] = struct{}{}
+			default:
+				unknown = append(unknown, name)
+			}
+		}
+	}
+
+	if value := strings.TrimSpace(annotations[common.RetinaLabelsAnnotation]); value != "" {
+		selected := make(map[string]struct{})
+		for _, label := range strings.Split(value, ",") {
+			label = strings.ToLower(strings.TrimSpace(label))
+			switch {
+			case label == "":
+			case contains(annotationLabels, label):
+				selected[label] = struct{}{}
+			default:
+				unknown = append(unknown, label)
+			}
+		}
+		a.labels = orderedLabels(selected)
+		a.options = NewCtxOption(a.labels, 0)
+	}
+
+	return a, unknown
+}
+
+// selective returns whether the selection changes the metrics or their labels.
+func (a *metricsAnnotation) selective() bool {
+	return a != nil && (a.metrics != nil || a.labels != nil)
+}
+
+// wants returns whether the metric is selected, given the context options of the cluster spec.
+func (a *metricsAnnotation) wants(metric string, cluster map[string]api.MetricsContextOptions) bool {
+	if a == nil {
+		return false
+	}
+	if a.metrics == nil {
+		_, ok := cluster[metric]
+		return ok
+	}
+	_, ok := a.metrics[metric]
+	return ok
+}
+
+// annotationConfigs are the metrics and labels selected by the annotations of the pods and namespaces. They are
+// applied on top of the cluster spec: the metrics selected by a pod are only recorded for the flows of the pods which
+// select them, and the labels of a pod are added to its metrics, while its side of the flows of the other metrics
+// keeps the labels of the cluster spec.
+type annotationConfigs struct {
+	sync.RWMutex
+	// pods are the selections of the annotated pods, by namespaced name
+	pods map[string]*metricsAnnotation
+	// namespaces are the selections of the annotated namespaces
+	namespaces map[string]*metricsAnnotation
+	// cluster are the context options of the cluster spec, by metric name
+	cluster map[string]api.MetricsContextOptions
+	// selective is set when a pod or namespace selects its metrics, so that flows are checked against the selections
+	selective bool
+	// changed is set when a selection changed since the context options were last computed
+	changed bool
+}
+
+func newAnnotationConfigs() *annotationConfigs {
+	return &annotationConfigs{
+		pods:       make(map[string]*metricsAnnotation),
+		namespaces: make(map[string]*metricsAnnotation),
+		cluster:    make(map[string]api.MetricsContextOptions),
+	}
+}
+
+// setPod sets the selection of an annotated pod, or removes it when nil.
+func (a *annotationConfigs) setPod(name string, selection *metricsAnnotation) {
+	a.Lock()
+	defer a.Unlock()
+
+	current, ok := a.pods[name]
+	if selection == nil {
+		if ok {
+			delete(a.pods, name)
+			a.changed = a.changed || current.selective()
+		}
+		return
+	}
+	a.pods[name] = selection
+	if (current.selective() || selection.selective()) && !reflect.DeepEqual(current, selection) {
+		a.changed = true
+	}
+}
+
+// setNamespaces sets the selections of the annotated namespaces from their retina annotations.
+func (a *annotationConfigs) setNamespaces(annotations map[string]map[string]string) {
+	namespaces := make(map[string]*metricsAnnotation, len(annotations))
+	for ns, nsAnnotations := range annotations {
+		namespaces[ns], _ = parseMetricsAnnotation(nsAnnotations)
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	for ns, selection := range namespaces {
+		current := a.namespaces[ns]
+		if (current.selective() || selection.selective()) && !reflect.DeepEqual(current, selection) {
+			a.changed = true
+		}
+	}
+	for ns, current := range a.namespaces {
+		if _, ok := namespaces[ns]; !ok && current.selective() {
+			a.changed = true
+		}
+	}
+	a.namespaces = namespaces
+}
+
+// hasChanged returns whether a selection changed since the context options were last computed.
+func (a *annotationConfigs) hasChanged() bool {
+	a.RLock()
+	defer a.RUnlock()
+	return a.changed
+}
+
+// contextOptions returns the context options of the cluster spec, with the labels selected by the pods and
+// namespaces added to their metrics, and the metrics they select which are not in the cluster spec.
+func (a *annotationConfigs) contextOptions(cluster []api.MetricsContextOptions) []api.MetricsContextOptions {
+	if a == nil {
+		return cluster
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	a.changed = false
+	a.selective = false
+	a.cluster = make(map[string]api.MetricsContextOptions, len(cluster))
+	for _, ctxOption := range cluster {
+		a.cluster[ctxOption.MetricName] = ctxOption
+	}
+
+	selections := make([]*metricsAnnotation, 0, len(a.pods)+len(a.namespaces))
+	for _, selection := range a.pods {
+		selections = append(selections, selection)
+	}
+	for _, selection := range a.namespaces {
+		selections = append(selections, selection)
+	}
+
+	options := make([]api.MetricsContextOptions, 0, len(cluster))
+	for _, ctxOption := range cluster {
+		ctxOption = *ctxOption.DeepCopy()
+		// aggregated metrics have fixed labels
+		if ctxOption.Aggregation == "" && registryKey(ctxOption.MetricName) == ctxOption.MetricName {
+			added := make(map[string]struct{})
+			for _, selection := range selections {
+				if selection.labels != nil && selection.wants(ctxOption.MetricName, a.cluster) {
+					for _, label := range selection.labels {
+						added[label] = struct{}{}
+					}
+				}
+			}
+			if len(added) > 0 {
+				if ctxOption.SourceLabels != nil {
+					ctxOption.SourceLabels = mergeLabels(ctxOption.SourceLabels, added)
+				}
+				if ctxOption.DestinationLabels != nil {
+					ctxOption.DestinationLabels = mergeLabels(ctxOption.DestinationLabels, added)
+				}
+			}
+		}
+		options = append(options, ctxOption)
+	}
+
+	requested := make(map[string]map[string]struct{})
+	for _, selection := range selections {
+		if selection.metrics != nil {
+			a.selective = true
+		}
+		for metric := range selection.metrics {
+			if _, ok := a.cluster[metric]; ok {
+				continue
+			}
+			if requested[metric] == nil {
+				requested[metric] = make(map[string]struct{})
+			}
+			labels := selection.labels
+			if labels == nil {
+				labels = DefaultCtxOptions()
+			}
+			for _, label := range labels {
+				requested[metric][label] = struct{}{}
+			}
+		}
+	}
+	metrics := make([]string, 0, len(requested))
+	for metric := range requested {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+	for _, metric := range metrics {
+		options = append(options, api.MetricsContextOptions{
+			MetricName:        metric,
+			SourceLabels:      orderedLabels(requested[metric]),
+			DestinationLabels: orderedLabels(requested[metric]),
+		})
+	}
+
+	return options
+}
+
+// selects returns whether the flow is recorded by the metric of the registry key. When pods or namespaces select
+// their metrics, a flow is recorded by the metrics selected by its source or destination, and by the metrics of the
+// cluster spec when neither of them is annotated.
+func (a *annotationConfigs) selects(key string, f *flow.Flow) bool {
+	if a == nil {
+		return true
+	}
+
+	a.RLock()
+	defer a.RUnlock()
+
+	if !a.selective || key == nodeApiserver {
+		return true
+	}
+	src, dst := a.lookup(f.GetSource()), a.lookup(f.GetDestination())
+	if src == nil && dst == nil {
+		_, ok := a.cluster[key]
+		return ok
+	}
+	return src.wants(key, a.cluster) || dst.wants(key, a.cluster)
+}
+
+// lookup returns the selection of the pod of the endpoint, or else of its namespace. The caller must hold the lock.
+func (a *annotationConfigs) lookup(ep *flow.Endpoint) *metricsAnnotation {
+	if ep == nil {
+		return nil
+	}
+	if selection, ok := a.pods[ep.GetNamespace()+"/"+ep.GetPodName()]; ok && ep.GetPodName() != "" {
+		return selection
+	}
+	return a.namespaces[ep.GetNamespace()]
+}
+
+// setMasks sets the masks of the context options of the metric, so that the labels which are not selected for the
+// pod of an endpoint are left empty on its side of the flows.
+func (a *annotationConfigs) setMasks(ctxOption api.MetricsContextOptions, metricObj AdvMetricsInterface) {
+	if a == nil || ctxOption.Aggregation != "" || registryKey(ctxOption.MetricName) != ctxOption.MetricName {
+		return
+	}
+	b, ok := metricObj.(baseMetricInterface)
+	if !ok {
+		return
+	}
+	for _, ctx := range []ContextOptionsInterface{b.sourceCtx(), b.destinationCtx()} {
+		if c, ok := ctx.(*ContextOptions); ok && c != nil {
+			labels := ctxOption.SourceLabels
+			if c.isDest() {
+				labels = ctxOption.DestinationLabels
+			}
+			c.mask = a.mask(ctxOption.MetricName, c, labels)
+		}
+	}
+}
+
+// mask returns the mask of the context options of the metric with the given labels, or nil when the labels are the
+// ones of the cluster spec.
+func (a *annotationConfigs) mask(metric string, c *ContextOptions, labels []string) func(ep *flow.Endpoint) *ContextOptions {
+	a.RLock()
+	clusterOption, inCluster := a.cluster[metric]
+	a.RUnlock()
+
+	base := DefaultCtxOptions()
+	if inCluster {
+		base = clusterOption.SourceLabels
+		if c.isDest() {
+			base = clusterOption.DestinationLabels
+		}
+		if utils.CompareStringSlice(base, labels) {
+			return nil
+		}
+	}
+	baseOptions := NewCtxOption(base, c.option)
+
+	return func(ep *flow.Endpoint) *ContextOptions {
+		a.RLock()
+		defer a.RUnlock()
+
+		// endpoints which are not annotated, or do not select the metric, keep the labels of the cluster spec.
+		selection := a.lookup(ep)
+		switch {
+		case selection == nil, selection.labels == nil || !selection.wants(metric, a.cluster):
+			return baseOptions
+		case inCluster:
+			return baseOptions.union(selection.options)
+		default:
+			return selection.options
+		}
+	}
+}
+
+// mergeLabels returns the labels followed by the added labels they do not have.
+func mergeLabels(labels []string, added map[string]struct{}) []string {
+	merged := append([]string{}, labels...)
+	for _, label := range orderedLabels(added) {
+		if !contains(labels, label) {
+			merged = append(merged, label)
+		}
+	}
+	return merged
+}
+
+// orderedLabels returns the selected context options in the order of the labels.
+func orderedLabels(selected map[string]struct{}) []string {
+	labels := make([]string, 0, len(selected))
+	for _, label := range annotationLabels {
+		if _, ok := selected[label]; ok {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+func contains(labels []string, label string) bool {
+	for _, l := range labels {
+		if strings.EqualFold(l, label) {
+			return true
+		}
+	}
+	return false
+}
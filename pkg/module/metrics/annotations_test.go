@@ -0,0 +1,184 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package metrics
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	api "github.com/microsoft/retina/crd/api/v1alpha1"
+	"github.com/microsoft/retina/pkg/common"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func annotationFlow(l *log.ZapLogger, src, dst *flow.Endpoint) *flow.Flow {
+	f := utils.ToFlow(l, time.Now().UnixNano(), net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 40000, 80, 6, 1, flow.Verdict_FORWARDED)
+	f.Source = src
+	f.Destination = dst
+	return f
+}
+
+func TestParseMetricsAnnotation(t *testing.T) {
+	selection, unknown := parseMetricsAnnotation(map[string]string{
+		common.RetinaMetricsAnnotation: "dns, tcpretrans,zone_traffic_count,node_apiserver_latency,bogus",
+		common.RetinaLabelsAnnotation:  "port,Workload,pod",
+	})
+	assert.Equal(t, map[string]struct{}{
+		utils.DNSRequestCounterName:  {},
+		utils.DNSResponseCounterName: {},
+		utils.TCPRetransCount:        {},
+		utils.ZoneTrafficCountName:   {},
+	}, selection.metrics)
+	assert.Equal(t, []string{"workload", "port"}, selection.labels)
+	assert.True(t, selection.options.Workload)
+	assert.Equal(t, []string{"node_apiserver_latency", "bogus", "pod"}, unknown)
+
+	selection, unknown = parseMetricsAnnotation(map[string]string{
+		common.RetinaPodAnnotation: common.RetinaPodAnnotationValue,
+	})
+	assert.Nil(t, selection.metrics)
+	assert.Nil(t, selection.labels)
+	assert.False(t, selection.selective())
+	assert.Empty(t, unknown)
+}
+
+func TestAnnotationConfigs(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	l := log.Logger().Named("test")
+
+	cluster := []api.MetricsContextOptions{
+		{MetricName: utils.ForwardPacketsGaugeName, SourceLabels: []string{"ip"}, DestinationLabels: []string{"ip"}},
+		{MetricName: utils.DroppedPacketsGaugeName, SourceLabels: []string{"ip"}, Aggregation: api.AggregationWorkload},
+	}
+	a := newAnnotationConfigs()
+	selection := func(annotations map[string]string) *metricsAnnotation {
+		s, _ := parseMetricsAnnotation(annotations)
+		return s
+	}
+
+	t.Run("cluster spec only", func(t *testing.T) {
+		a.setPod("ns1/observed", selection(map[string]string{common.RetinaPodAnnotation: common.RetinaPodAnnotationValue}))
+		assert.False(t, a.hasChanged())
+		assert.Equal(t, cluster, a.contextOptions(cluster))
+		assert.True(t, a.selects(utils.ForwardPacketsGaugeName, annotationFlow(l, nil, nil)))
+	})
+
+	t.Run("pods select metrics and labels", func(t *testing.T) {
+		a.setPod("ns1/dns", selection(map[string]string{common.RetinaMetricsAnnotation: "dns", common.RetinaLabelsAnnotation: "port"}))
+		a.setPod("ns1/labels", selection(map[string]string{common.RetinaPodAnnotation: common.RetinaPodAnnotationValue, common.RetinaLabelsAnnotation: "podname"}))
+		a.setNamespaces(map[string]map[string]string{"ns2": {common.RetinaMetricsAnnotation: "dns"}})
+		assert.True(t, a.hasChanged())
+
+		options := a.contextOptions(cluster)
+		assert.False(t, a.hasChanged())
+		assert.Equal(t, []api.MetricsContextOptions{
+			// only the pods selecting the cluster metric add their labels, and aggregated metrics keep theirs
+			{MetricName: utils.ForwardPacketsGaugeName, SourceLabels: []string{"ip", "podname"}, DestinationLabels: []string{"ip", "podname"}},
+			cluster[1],
+			{MetricName: utils.DNSRequestCounterName, SourceLabels: []string{"ip", "namespace", "podname", "workload", "port"}, DestinationLabels: []string{"ip", "namespace", "podname", "workload", "port"}},
+			{MetricName: utils.DNSResponseCounterName, SourceLabels: []string{"ip", "namespace", "podname", "workload", "port"}, DestinationLabels: []string{"ip", "namespace", "podname", "workload", "port"}},
+		}, options)
+		// the cluster spec is not modified
+		assert.Equal(t, []string{"ip"}, cluster[0].SourceLabels)
+	})
+
+	t.Run("flows are recorded by the metrics of their pods", func(t *testing.T) {
+		dnsPod := &flow.Endpoint{Namespace: "ns1", PodName: "dns"}
+		observed := &flow.Endpoint{Namespace: "ns1", PodName: "observed"}
+		ns2Pod := &flow.Endpoint{Namespace: "ns2", PodName: "any"}
+		other := &flow.Endpoint{Namespace: "ns3", PodName: "other"}
+
+		assert.True(t, a.selects(utils.DNSRequestCounterName, annotationFlow(l, dnsPod, other)))
+		assert.False(t, a.selects(utils.ForwardPacketsGaugeName, annotationFlow(l, dnsPod, other)))
+		assert.True(t, a.selects(utils.ForwardPacketsGaugeName, annotationFlow(l, dnsPod, observed)))
+		assert.False(t, a.selects(utils.DNSRequestCounterName, annotationFlow(l, observed, other)))
+		assert.True(t, a.selects(utils.DNSRequestCounterName, annotationFlow(l, other, ns2Pod)))
+		assert.False(t, a.selects(utils.ForwardPacketsGaugeName, annotationFlow(l, ns2Pod, nil)))
+		// flows without annotated pods are recorded by the metrics of the cluster spec
+		assert.True(t, a.selects(utils.ForwardPacketsGaugeName, annotationFlow(l, other, nil)))
+		assert.False(t, a.selects(utils.DNSRequestCounterName, annotationFlow(l, other, nil)))
+		assert.True(t, a.selects(nodeApiserver, annotationFlow(l, dnsPod, nil)))
+	})
+
+	t.Run("pods without selections", func(t *testing.T) {
+		a.setPod("ns1/dns", nil)
+		a.setPod("ns1/labels", nil)
+		a.setNamespaces(nil)
+		assert.True(t, a.hasChanged())
+		assert.Equal(t, cluster, a.contextOptions(cluster))
+		a.setPod("ns1/observed", nil)
+		assert.False(t, a.hasChanged())
+	})
+}
+
+func TestContextOptionsMask(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	l := log.Logger().Named("test")
+
+	a := newAnnotationConfigs()
+	for name, annotations := range map[string]map[string]string{
+		"ns1/port":  {common.RetinaMetricsAnnotation: "forward_count,dns", common.RetinaLabelsAnnotation: "port"},
+		"ns1/dns":   {common.RetinaMetricsAnnotation: "dns"},
+		"ns1/plain": {common.RetinaPodAnnotation: common.RetinaPodAnnotationValue},
+	} {
+		s, _ := parseMetricsAnnotation(annotations)
+		a.setPod(name, s)
+	}
+	options := a.contextOptions([]api.MetricsContextOptions{
+		{MetricName: utils.ForwardPacketsGaugeName, SourceLabels: []string{"podname"}, DestinationLabels: []string{"podname"}},
+	})
+	require.Len(t, options, 3)
+	port := &flow.Endpoint{Namespace: "ns1", PodName: "port"}
+	dnsPod := &flow.Endpoint{Namespace: "ns1", PodName: "dns"}
+	plain := &flow.Endpoint{Namespace: "ns1", PodName: "plain"}
+	other := &flow.Endpoint{Namespace: "ns2", PodName: "other"}
+
+	t.Run("cluster metric", func(t *testing.T) {
+		assert.Equal(t, []string{"podname", "port"}, options[0].SourceLabels)
+		src := NewCtxOption(options[0].SourceLabels, source)
+		src.mask = a.mask(utils.ForwardPacketsGaugeName, src, options[0].SourceLabels)
+		require.NotNil(t, src.mask)
+
+		assert.Equal(t, []string{"port", "40000"}, src.getValues(annotationFlow(l, port, nil)))
+		assert.Equal(t, []string{"plain", ""}, src.getValues(annotationFlow(l, plain, nil)))
+		assert.Equal(t, []string{"other", ""}, src.getValues(annotationFlow(l, other, nil)))
+	})
+
+	t.Run("metric selected by annotations", func(t *testing.T) {
+		assert.Equal(t, utils.DNSRequestCounterName, options[1].MetricName)
+		assert.Equal(t, []string{"ip", "namespace", "podname", "workload", "port"}, options[1].DestinationLabels)
+		dst := NewCtxOption(options[1].DestinationLabels, destination)
+		dst.mask = a.mask(utils.DNSRequestCounterName, dst, options[1].DestinationLabels)
+
+		assert.Equal(t, []string{"", "", "", "", "", "80"}, dst.getValues(annotationFlow(l, nil, port)))
+		assert.Equal(t, []string{"10.0.0.2", "ns1", "dns", "unknown", "unknown", ""}, dst.getValues(annotationFlow(l, nil, dnsPod)))
+	})
+
+	t.Run("icmp flow", func(t *testing.T) {
+		dst := NewCtxOption(options[1].DestinationLabels, destination)
+		dst.mask = a.mask(utils.DNSRequestCounterName, dst, options[1].DestinationLabels)
+		icmpFlow := func(ep *flow.Endpoint) *flow.Flow {
+			f := annotationFlow(l, nil, ep)
+			f.L4 = &flow.Layer4{Protocol: &flow.Layer4_ICMPv4{ICMPv4: &flow.ICMPv4{Type: 8}}}
+			return f
+		}
+
+		// ICMP flows have a value for every label, and the labels which are not selected stay empty.
+		assert.Equal(t, []string{"", "", "", "", "", "unknown"}, dst.getValues(icmpFlow(port)))
+		assert.Equal(t, []string{"10.0.0.2", "ns1", "dns", "unknown", "unknown", ""}, dst.getValues(icmpFlow(dnsPod)))
+	})
+
+	t.Run("unchanged labels", func(t *testing.T) {
+		labels := []string{"podname"}
+		b := newAnnotationConfigs()
+		b.contextOptions([]api.MetricsContextOptions{{MetricName: utils.ForwardPacketsGaugeName, SourceLabels: labels}})
+		assert.Nil(t, b.mask(utils.ForwardPacketsGaugeName, NewCtxOption(labels, source), labels))
+	})
+}
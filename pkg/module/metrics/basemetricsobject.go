@@ -8,11 +8,17 @@ import (
 	"sync"
 	"time"
 
+	v1 "github.com/cilium/cilium/api/v1/flow"
 	api "github.com/microsoft/retina/crd/api/v1alpha1"
 	"github.com/microsoft/retina/pkg/log"
+	metricsinit "github.com/microsoft/retina/pkg/metrics"
 	"go.uber.org/zap"
 )
 
+// overflowLabelValue is the value of every label of the series collecting the label combinations over the series
+// budget of a metric.
+const overflowLabelValue = "other"
+
 type expireFn func(lbs []string) bool
 
 type updated struct {
@@ -29,8 +35,15 @@ type baseMetricInterface interface {
 	destinationCtx() ContextOptionsInterface
 	additionalLabels() []string
 	isLocalContext() bool
+	// Returns the values of the context labels of the flow, by direction
+	contextValues(flow *v1.Flow) map[string][]string
 	// This func is used to track updates to the metric labels. It is called by the child metric object whenever the metric is updated
 	updated(lbs []string)
+	// This func is called by the child metric object before updating the metric. It returns the label values to update
+	// the metric with, or nil if the update is dropped because the series budget of the metric is exceeded
+	admit(lbs []string) []string
+	// Returns whether the series budget of the metric is exceeded
+	seriesBudgetExceeded() bool
 	getLogger() *log.ZapLogger
 	// Returns the full set of tracked metric labels, this is expensive so should only be used for testing and debugging purposes
 	trackedMetricLabels() [][]string
@@ -48,6 +61,10 @@ type baseMetricObject struct {
 	expireFn    expireFn
 	cancelFn    context.CancelFunc
 	ctx         context.Context
+	// maxSeries is the series budget of the metric, 0 if the metric has no budget
+	maxSeries      int
+	dropOverflow   bool
+	budgetExceeded bool
 }
 
 func (b *baseMetricObject) additionalLabels() []string {
@@ -59,7 +76,7 @@ func (b *baseMetricObject) additionalLabels() []string {
 }
 
 func (b *baseMetricObject) trackedMetricLabels() [][]string {
-	if b.expireFn == nil {
+	if b.lastUpdated == nil {
 		return nil
 	}
 
@@ -113,13 +130,20 @@ func (b *baseMetricObject) expire(ttl time.Duration) int {
 	}
 
 	b.lastUpdated = n
+	if expired > 0 && metricsinit.AdvancedMetricEvictionsCounter != nil {
+		metricsinit.AdvancedMetricEvictionsCounter.WithLabelValues(b.ctxOptions.MetricName).Add(float64(expired))
+	}
+	if len(n) < b.maxSeries {
+		b.budgetExceeded = false
+	}
+	b.setSeriesGauge()
 
 	return expired
 }
 
 func (b *baseMetricObject) updated(lbs []string) {
-	// no expiration function is defined, so we don't need to track updates
-	if b.expireFn == nil {
+	// no expiration function or series budget is defined, so we don't need to track updates
+	if b.lastUpdated == nil {
 		return
 	}
 
@@ -128,10 +152,78 @@ func (b *baseMetricObject) updated(lbs []string) {
 	b.Lock()
 	defer b.Unlock()
 
+	_, ok := b.lastUpdated[k]
 	b.lastUpdated[k] = updated{
 		t:   time.Now(),
 		lbs: lbs,
 	}
+	if !ok {
+		b.setSeriesGauge()
+	}
+}
+
+// admit collapses label combinations over the series budget into the overflow series, or drops them with the Drop
+// overflow policy. The overflow series is not counted in the budget.
+func (b *baseMetricObject) admit(lbs []string) []string {
+	if b.maxSeries <= 0 {
+		return lbs
+	}
+
+	k := strings.Join(lbs, "")
+
+	b.Lock()
+	defer b.Unlock()
+
+	if _, ok := b.lastUpdated[k]; ok {
+		return lbs
+	}
+	series := len(b.lastUpdated)
+	if _, ok := b.lastUpdated[strings.Repeat(overflowLabelValue, len(lbs))]; ok {
+		series--
+	}
+	if series < b.maxSeries {
+		return lbs
+	}
+
+	if !b.budgetExceeded {
+		b.l.Warn("Series budget exceeded: "+b.ctxOptions.MetricName, zap.Int("maxSeries", b.maxSeries))
+	}
+	b.budgetExceeded = true
+
+	reason := "aggregated"
+	if b.dropOverflow {
+		reason = "dropped"
+	}
+	if metricsinit.AdvancedMetricOverflowCounter != nil {
+		metricsinit.AdvancedMetricOverflowCounter.WithLabelValues(b.ctxOptions.MetricName, reason).Inc()
+	}
+	if b.dropOverflow {
+		return nil
+	}
+
+	overflow := make([]string, len(lbs))
+	for i := range overflow {
+		overflow[i] = overflowLabelValue
+	}
+	return overflow
+}
+
+func (b *baseMetricObject) seriesBudgetExceeded() bool {
+	if b.maxSeries <= 0 {
+		return false
+	}
+
+	b.RLock()
+	defer b.RUnlock()
+
+	return b.budgetExceeded
+}
+
+// setSeriesGauge sets the number of tracked series, the caller must hold the lock.
+func (b *baseMetricObject) setSeriesGauge() {
+	if metricsinit.AdvancedMetricSeriesGauge != nil {
+		metricsinit.AdvancedMetricSeriesGauge.WithLabelValues(b.ctxOptions.MetricName).Set(float64(len(b.lastUpdated)))
+	}
 }
 
 func newBaseMetricsObject(ctxOptions *api.MetricsContextOptions, fl *log.ZapLogger, isLocalContext enrichmentContext, expire expireFn, ttl time.Duration) *baseMetricObject {
@@ -147,12 +239,18 @@ func newBaseMetricsObject(ctxOptions *api.MetricsContextOptions, fl *log.ZapLogg
 		l:           fl,
 		contextMode: isLocalContext,
 		expireFn:    expireOrInfiniteTTL,
+		maxSeries:   ctxOptions.MaxSeries,
+		// the Aggregate overflow policy is the default
+		dropOverflow: ctxOptions.OverflowPolicy == api.OverflowPolicyDrop,
 	}
 
-	if expireOrInfiniteTTL != nil {
-		// only initialize these if we have a valid expiration function to save some memory
+	if expireOrInfiniteTTL != nil || b.maxSeries > 0 {
+		// only initialize these if we have to track the series to save some memory
 		b.RWMutex = &sync.RWMutex{}
 		b.lastUpdated = make(map[string]updated)
+	}
+
+	if expireOrInfiniteTTL != nil {
 		ctx, cancel := context.WithCancel(context.Background())
 		b.ctx = ctx
 		b.cancelFn = cancel
@@ -186,6 +284,17 @@ func newBaseMetricsObject(ctxOptions *api.MetricsContextOptions, fl *log.ZapLogg
 }
 
 func (b *baseMetricObject) populateCtxOptions(ctxOptions *api.MetricsContextOptions) {
+	if ctxOptions.Aggregation != "" {
+		// with local context, flows are rolled up to the workload of the pod on this node.
+		if b.isLocalContext() {
+			b.srcCtx = newAggregatedCtxOption(ctxOptions.Aggregation, localCtx)
+		} else {
+			b.srcCtx = newAggregatedCtxOption(ctxOptions.Aggregation, source)
+			b.dstCtx = newAggregatedCtxOption(ctxOptions.Aggregation, destination)
+		}
+		return
+	}
+
 	if b.isLocalContext() {
 		// when localcontext is enabled, we do not need the context options for both src and dst
 		// metrics aggregation will be on a single pod basis and not the src/dst pod combination basis.
@@ -209,8 +318,85 @@ func (b *baseMetricObject) isLocalContext() bool {
 	return b.contextMode == localContext
 }
 
+// contextValues returns the values of the context labels of the flow, by direction. In local context, the values are
+// those of the local pod in each direction, otherwise those of the source and destination in the direction of the flow.
+func (b *baseMetricObject) contextValues(flow *v1.Flow) map[string][]string {
+	if b.isLocalContext() {
+		// when localcontext is enabled, we do not need the context options for both src and dst
+		// metrics aggregation will be on a single pod basis and not the src/dst pod combination basis.
+		return b.sourceCtx().getLocalCtxValues(flow)
+	}
+
+	values := make([]string, 0)
+	if b.sourceCtx() != nil {
+		values = append(values, b.sourceCtx().getValues(flow)...)
+	}
+
+	if b.destinationCtx() != nil {
+		values = append(values, b.destinationCtx().getValues(flow)...)
+	}
+
+	return map[string][]string{flow.GetTrafficDirection().String(): values}
+}
+
 func (b *baseMetricObject) clean() {
 	if b.cancelFn != nil {
 		b.cancelFn()
 	}
+	if b.lastUpdated != nil && metricsinit.AdvancedMetricSeriesGauge != nil {
+		metricsinit.AdvancedMetricSeriesGauge.DeleteLabelValues(b.ctxOptions.MetricName)
+	}
+}
+
+// pendingFlows tracks what a metric waits on across flows, e.g. the open connections or the connection attempts
+// without answer, by key. It holds at most maxEntries entries, and sweeps the expired ones at most once per second.
+type pendingFlows[T any] struct {
+	sync.Mutex
+	entries    map[string]T
+	maxEntries int
+	lastSweep  time.Time
+	now        func() time.Time
+}
+
+func newPendingFlows[T any](maxEntries int) *pendingFlows[T] {
+	return &pendingFlows[T]{
+		entries:    make(map[string]T),
+		maxEntries: maxEntries,
+		now:        time.Now,
+	}
+}
+
+// add adds the entry unless the maximum number of entries is reached, and returns whether it was added.
+// The caller must hold the lock.
+func (p *pendingFlows[T]) add(key string, entry T) bool {
+	if len(p.entries) >= p.maxEntries {
+		return false
+	}
+	p.entries[key] = entry
+	return true
+}
+
+// sweep removes and returns the entries which expired, at most once per second.
+// The caller must hold the lock.
+func (p *pendingFlows[T]) sweep(now time.Time, expired func(entry T) bool) []T {
+	if now.Sub(p.lastSweep) < time.Second {
+		return nil
+	}
+	p.lastSweep = now
+
+	var removed []T
+	for k, entry := range p.entries {
+		if expired(entry) {
+			removed = append(removed, entry)
+			delete(p.entries, k)
+		}
+	}
+	return removed
+}
+
+// reset removes all entries.
+func (p *pendingFlows[T]) reset() {
+	p.Lock()
+	defer p.Unlock()
+	p.entries = make(map[string]T)
 }
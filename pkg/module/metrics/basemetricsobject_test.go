@@ -10,6 +10,7 @@ import (
 
 	api "github.com/microsoft/retina/crd/api/v1alpha1"
 	"github.com/microsoft/retina/pkg/log"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestBaseMetricObject(t *testing.T) {
@@ -102,3 +103,67 @@ func TestBaseMetricObject(t *testing.T) {
 		})
 	}
 }
+
+func TestBaseMetricObjectSeriesBudget(t *testing.T) {
+	l, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	if err != nil {
+		t.Fatalf("failed to set up logger: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		overflowPolicy string
+		wantOverflow   []string
+	}{
+		{
+			name:         "aggregate overflow",
+			wantOverflow: []string{overflowLabelValue, overflowLabelValue},
+		},
+		{
+			name:           "drop overflow",
+			overflowPolicy: api.OverflowPolicyDrop,
+			wantOverflow:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBaseMetricsObject(
+				&api.MetricsContextOptions{
+					MetricName:     "test_metric",
+					MaxSeries:      2,
+					OverflowPolicy: tt.overflowPolicy,
+				},
+				l,
+				localContext,
+				func([]string) bool { return true },
+				time.Hour,
+			)
+			defer b.clean()
+
+			admitAndUpdate := func(lbs ...string) []string {
+				admitted := b.admit(lbs)
+				if admitted != nil {
+					b.updated(admitted)
+				}
+				return admitted
+			}
+
+			assert.Equal(t, []string{"a", "1"}, admitAndUpdate("a", "1"))
+			assert.Equal(t, []string{"b", "1"}, admitAndUpdate("b", "1"))
+			assert.False(t, b.seriesBudgetExceeded())
+
+			// New label combinations over the budget overflow, known ones are still updated.
+			assert.Equal(t, tt.wantOverflow, admitAndUpdate("c", "1"))
+			assert.Equal(t, tt.wantOverflow, admitAndUpdate("d", "1"))
+			assert.Equal(t, []string{"a", "1"}, admitAndUpdate("a", "1"))
+			assert.True(t, b.seriesBudgetExceeded())
+			assert.LessOrEqual(t, len(b.trackedMetricLabels()), 3)
+
+			// Expired series free room in the budget.
+			b.expire(0)
+			assert.False(t, b.seriesBudgetExceeded())
+			assert.Equal(t, []string{"c", "1"}, admitAndUpdate("c", "1"))
+		})
+	}
+}
@@ -247,6 +247,9 @@ func (d *DNSMetrics) expire(labels []string) bool {
 }
 
 func (d *DNSMetrics) update(labels []string) {
+	if labels = d.admit(labels); labels == nil {
+		return
+	}
 	d.dnsMetrics.WithLabelValues(labels...).Inc()
 	d.updated(labels)
 }
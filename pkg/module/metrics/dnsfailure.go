@@ -0,0 +1,160 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "github.com/cilium/cilium/api/v1/flow"
+	api "github.com/microsoft/retina/crd/api/v1alpha1"
+	"github.com/microsoft/retina/pkg/exporter"
+	"github.com/microsoft/retina/pkg/log"
+	metricsinit "github.com/microsoft/retina/pkg/metrics"
+	"github.com/microsoft/retina/pkg/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	// Metric descriptions
+	DNSFailureCountDesc = "Total number of failed DNS responses by return code, querying workload and domain"
+
+	// otherDNSDomain is the domain of the queries which do not match any configured domain.
+	otherDNSDomain = "other"
+)
+
+var DNSFailureCountName = fmt.Sprintf("adv_%s", utils.DNSFailureCounterName)
+
+// DNSFailureMetrics counts the DNS responses with an error return code, by the namespace and workload of the pod
+// which sent the query and the domain of the query. The source and destination labels of the context options are
+// not used.
+type DNSFailureMetrics struct {
+	baseMetricInterface
+	dnsFailureMetrics metricsinit.CounterVec
+	// clientCtx labels the metric with the pod which sent the query, the destination of the response.
+	clientCtx *ContextOptions
+	domains   *dnsDomainMatcher
+}
+
+func NewDNSFailureMetrics(ctxOptions *api.MetricsContextOptions, fl *log.ZapLogger, isLocalContext enrichmentContext, ttl time.Duration) *DNSFailureMetrics {
+	if ctxOptions == nil || ctxOptions.MetricName != utils.DNSFailureCounterName {
+		return nil
+	}
+
+	fl = fl.Named("dnsfailure-metricsmodule")
+	fl.Info("Creating DNS failure count metrics", zap.Any("options", ctxOptions))
+	d := &DNSFailureMetrics{
+		clientCtx: NewCtxOption([]string{namespaceCtxOption, workloadCtxOption}, source),
+		domains:   newDNSDomainMatcher(ctxOptions.DNSDomains),
+	}
+	d.clientCtx.aggregated = true
+	d.baseMetricInterface = newBaseMetricsObject(ctxOptions, fl, isLocalContext, d.expire, ttl)
+	return d
+}
+
+func (d *DNSFailureMetrics) Init(_ string) {
+	d.dnsFailureMetrics = exporter.CreatePrometheusCounterVecForMetric(
+		exporter.AdvancedRegistry,
+		DNSFailureCountName,
+		DNSFailureCountDesc,
+		d.getLabels()...,
+	)
+}
+
+func (d *DNSFailureMetrics) getLabels() []string {
+	labels := []string{"return_code", "domain"}
+	return append(labels, d.clientCtx.getLabels()...)
+}
+
+func (d *DNSFailureMetrics) ProcessFlow(flow *v1.Flow) {
+	if flow == nil || flow.Verdict != utils.Verdict_DNS {
+		return
+	}
+
+	flowDNS, dnsType, _ := utils.GetDNS(flow)
+	if flowDNS == nil || dnsType != utils.DNSType_RESPONSE || flowDNS.GetRcode() == 0 {
+		return
+	}
+
+	// in local context, only the responses to the pods on this node are counted.
+	if d.isLocalContext() && flow.GetDestination() == nil {
+		return
+	}
+
+	rcode := utils.DNSRcodeToString(flow)
+	if rcode == "" {
+		rcode = strconv.FormatUint(uint64(flowDNS.GetRcode()), 10)
+	}
+
+	labels := []string{rcode, d.domains.domain(flowDNS.GetQuery())}
+	labels = append(labels, d.clientCtx.getByDirectionValues(flow, true)...)
+	d.update(labels)
+	d.getLogger().Debug("Update dns failure metric", zap.Strings("labels", labels))
+}
+
+func (d *DNSFailureMetrics) expire(labels []string) bool {
+	var del bool
+	if d.dnsFailureMetrics != nil {
+		del = d.dnsFailureMetrics.DeleteLabelValues(labels...)
+		if del {
+			metricsinit.MetricsExpiredCounter.WithLabelValues(utils.DNSFailureCounterName).Inc()
+		}
+	}
+	return del
+}
+
+func (d *DNSFailureMetrics) update(labels []string) {
+	if labels = d.admit(labels); labels == nil {
+		return
+	}
+	d.dnsFailureMetrics.WithLabelValues(labels...).Inc()
+	d.updated(labels)
+}
+
+func (d *DNSFailureMetrics) Clean() {
+	exporter.UnregisterMetric(exporter.AdvancedRegistry, metricsinit.ToPrometheusType(d.dnsFailureMetrics))
+	d.clean()
+}
+
+// dnsDomainMatcher reduces query names to the configured domains, so that the domain label has a bounded number of
+// values.
+type dnsDomainMatcher struct {
+	names map[string]struct{}
+	// wildcards are the "*." domains, the most specific first.
+	wildcards []string
+}
+
+func newDNSDomainMatcher(domains []string) *dnsDomainMatcher {
+	m := &dnsDomainMatcher{names: make(map[string]struct{})}
+	for _, domain := range domains {
+		domain = strings.ToLower(domain)
+		if strings.HasPrefix(domain, "*.") {
+			m.wildcards = append(m.wildcards, domain)
+		} else {
+			m.names[domain] = struct{}{}
+		}
+	}
+	sort.Slice(m.wildcards, func(i, j int) bool {
+		return len(m.wildcards[i]) > len(m.wildcards[j])
+	})
+	return m
+}
+
+// domain returns the configured domain matching the query, or "other".
+func (m *dnsDomainMatcher) domain(query string) string {
+	query = strings.TrimSuffix(strings.ToLower(query), ".")
+	if _, ok := m.names[query]; ok {
+		return query
+	}
+	for _, wildcard := range m.wildcards {
+		// "*.internal.corp" matches "a.internal.corp" and not "internal.corp".
+		if strings.HasSuffix(query, wildcard[1:]) {
+			return wildcard
+		}
+	}
+	return otherDNSDomain
+}
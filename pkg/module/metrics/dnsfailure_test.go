@@ -0,0 +1,107 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package metrics
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	api "github.com/microsoft/retina/crd/api/v1alpha1"
+	"github.com/microsoft/retina/pkg/exporter"
+	"github.com/microsoft/retina/pkg/log"
+	metricsinit "github.com/microsoft/retina/pkg/metrics"
+	"github.com/microsoft/retina/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSDomainMatcher(t *testing.T) {
+	m := newDNSDomainMatcher([]string{"*.corp", "*.internal.corp", "api.example.com"})
+
+	assert.Equal(t, "*.internal.corp", m.domain("db.payments.internal.corp."))
+	assert.Equal(t, "*.internal.corp", m.domain("DB.Internal.Corp"))
+	assert.Equal(t, "*.corp", m.domain("internal.corp"))
+	assert.Equal(t, "api.example.com", m.domain("api.example.com."))
+	assert.Equal(t, otherDNSDomain, m.domain("www.api.example.com."))
+	assert.Equal(t, otherDNSDomain, m.domain("corp."))
+	assert.Equal(t, otherDNSDomain, newDNSDomainMatcher(nil).domain("bing.com."))
+}
+
+func TestDNSFailureMetrics(t *testing.T) {
+	l, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+
+	payments := &flow.Endpoint{
+		Namespace: "payments",
+		PodName:   "api-7d9f8c6b5-x2x4z",
+		Labels:    []string{"pod-template-hash=7d9f8c6b5"},
+		Workloads: []*flow.Workload{{Kind: "ReplicaSet", Name: "api-7d9f8c6b5"}},
+	}
+	coreDNS := &flow.Endpoint{Namespace: "kube-system", PodName: "coredns-0"}
+	dnsFlow := func(qType string, rcode uint32, query string, src, dst *flow.Endpoint) *flow.Flow {
+		f := utils.ToFlow(l, time.Now().UnixNano(), net.ParseIP("10.0.0.10"), net.ParseIP("10.0.0.1"), 53, 40000, 17, 0, utils.Verdict_DNS)
+		ext := utils.NewExtensions()
+		utils.AddDNSInfo(f, ext, qType, rcode, query, []string{"A"}, 0, nil)
+		utils.SetExtensions(f, ext)
+		f.Source, f.Destination = src, dst
+		return f
+	}
+
+	tests := []struct {
+		name    string
+		context enrichmentContext
+		want    map[string]float64
+	}{
+		{
+			name:    "remote context",
+			context: remoteContext,
+			want: map[string]float64{
+				"SERVFAIL|*.internal.corp|payments|Deployment|api": 2,
+				"NXDOMAIN|other|payments|Deployment|api":           1,
+				"REFUSED|*.internal.corp|unknown|unknown|unknown":  1,
+			},
+		},
+		{
+			name:    "local context",
+			context: localContext,
+			want: map[string]float64{
+				"SERVFAIL|*.internal.corp|payments|Deployment|api": 2,
+				"NXDOMAIN|other|payments|Deployment|api":           1,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter.ResetAdvancedMetricsRegistry()
+			d := NewDNSFailureMetrics(&api.MetricsContextOptions{
+				MetricName: utils.DNSFailureCounterName,
+				DNSDomains: []string{"*.internal.corp"},
+			}, l, tt.context, 0)
+			require.NotNil(t, d)
+			d.Init(utils.DNSFailureCounterName)
+			defer d.Clean()
+			assert.Equal(t, []string{"return_code", "domain", "source_namespace", "source_workload_kind", "source_workload_name"}, d.getLabels())
+
+			d.ProcessFlow(dnsFlow("Q", 0, "db.internal.corp.", payments, coreDNS))
+			d.ProcessFlow(dnsFlow("R", 0, "db.internal.corp.", coreDNS, payments))
+			d.ProcessFlow(dnsFlow("R", 2, "db.internal.corp.", coreDNS, payments))
+			d.ProcessFlow(dnsFlow("R", 2, "cache.internal.corp.", coreDNS, payments))
+			d.ProcessFlow(dnsFlow("R", 3, "bing.com.", coreDNS, payments))
+			// response to a pod on another node
+			d.ProcessFlow(dnsFlow("R", 5, "db.internal.corp.", coreDNS, nil))
+
+			assert.Equal(t, len(tt.want), testutil.CollectAndCount(metricsinit.ToPrometheusType(d.dnsFailureMetrics)))
+			for _, labels := range d.trackedMetricLabels() {
+				key := labels[0]
+				for _, l := range labels[1:] {
+					key += "|" + l
+				}
+				assert.InDelta(t, tt.want[key], testutil.ToFloat64(d.dnsFailureMetrics.WithLabelValues(labels...)), 0, key)
+			}
+		})
+	}
+}
@@ -4,6 +4,8 @@
 package metrics
 
 import (
+	"slices"
+	"sort"
 	"strings"
 	"time"
 
@@ -22,6 +24,9 @@ const (
 
 	TotalDropCountDesc = "Total number of dropped packets"
 	TotalDropBytesDesc = "Total number of dropped bytes"
+
+	// unknownPolicy is the policy label of the drops which are not attributed to a network policy.
+	unknownPolicy = "unknown"
 )
 
 type DropCountMetrics struct {
@@ -78,7 +83,9 @@ func (d *DropCountMetrics) getLabels() []string {
 		d.getLogger().Info("dst labels", zap.Any("labels", labels))
 	}
 
-	// No additional context options
+	if slices.Contains(d.additionalLabels(), utils.Policy) {
+		labels = append(labels, utils.Policy)
+	}
 
 	return labels
 }
@@ -132,7 +139,14 @@ func (d *DropCountMetrics) ProcessFlow(flow *v1.Flow) {
 		}
 	}
 
-	// No additional context options
+	if slices.Contains(d.additionalLabels(), utils.Policy) {
+		// a drop is attributed to the policies of a single direction.
+		deniedBy := flow.GetIngressDeniedBy()
+		if len(deniedBy) == 0 {
+			deniedBy = flow.GetEgressDeniedBy()
+		}
+		labels = append(labels, policyLabel(deniedBy))
+	}
 
 	d.update(flow, labels)
 	d.getLogger().Debug("drop count metric is added", zap.Any("labels", labels))
@@ -144,25 +158,49 @@ func (d *DropCountMetrics) processLocalCtxFlow(flow *v1.Flow) {
 		return
 	}
 	dropReason := utils.DropReasonDescription(flow)
+	withPolicy := slices.Contains(d.additionalLabels(), utils.Policy)
 
 	// Ingress values
 	if l := len(labelValuesMap[ingress]); l > 0 {
-		labels := make([]string, 0, l+2)
+		labels := make([]string, 0, l+3)
 		labels = append(labels, dropReason, ingress)
 		labels = append(labels, labelValuesMap[ingress]...)
+		if withPolicy {
+			labels = append(labels, policyLabel(flow.GetIngressDeniedBy()))
+		}
 		d.update(flow, labels)
 		d.getLogger().Debug("drop count metric is added in INGRESS in local ctx", zap.Any("labels", labels))
 	}
 
 	if l := len(labelValuesMap[egress]); l > 0 {
-		labels := make([]string, 0, l+2)
+		labels := make([]string, 0, l+3)
 		labels = append(labels, dropReason, egress)
 		labels = append(labels, labelValuesMap[egress]...)
+		if withPolicy {
+			labels = append(labels, policyLabel(flow.GetEgressDeniedBy()))
+		}
 		d.update(flow, labels)
 		d.getLogger().Debug("drop count metric is added in EGRESS in local ctx", zap.Any("labels", labels))
 	}
 }
 
+// policyLabel returns the namespace/name of the candidate network policies of the drop, separated by commas, or
+// "unknown" when the drop is not attributed to any policy.
+func policyLabel(deniedBy []*v1.Policy) string {
+	var names []string
+	for _, p := range deniedBy {
+		name := p.GetNamespace() + "/" + p.GetName()
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return unknownPolicy
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
 func (d *DropCountMetrics) expire(labels []string) bool {
 	var del bool
 	if d.dropMetric != nil {
@@ -175,6 +213,9 @@ func (d *DropCountMetrics) expire(labels []string) bool {
 }
 
 func (d *DropCountMetrics) update(fl *v1.Flow, labels []string) {
+	if labels = d.admit(labels); labels == nil {
+		return
+	}
 	var updated bool
 	switch d.metricName {
 	case utils.DroppedPacketsGaugeName:
@@ -13,6 +13,7 @@ import (
 	"github.com/microsoft/retina/pkg/log"
 	metricsinit "github.com/microsoft/retina/pkg/metrics"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/mock/gomock"
 	"go.uber.org/zap"
@@ -275,6 +276,29 @@ func TestNewDrop(t *testing.T) {
 			nilObj:         false,
 			localContext:   localContext,
 		},
+		{
+			name: "drop dest opts with policy label",
+			opts: &v1alpha1.MetricsContextOptions{
+				MetricName:        "drop",
+				DestinationLabels: []string{"namespace", "podName"},
+				AdditionalLabels:  []string{"policy"},
+			},
+			f: &flow.Flow{
+				Destination:     &flow.Endpoint{},
+				Verdict:         flow.Verdict_DROPPED,
+				IngressDeniedBy: []*flow.Policy{{Namespace: "default", Name: "deny-all"}},
+			},
+			checkIsAdvance: true,
+			exepectedLabels: []string{
+				"reason",
+				"direction",
+				"destination_namespace",
+				"destination_podname",
+				"policy",
+			},
+			metricCall:     1,
+			trackedMetrics: 1,
+		},
 	}
 
 	for _, tc := range tt {
@@ -337,3 +361,54 @@ func TestNewDrop(t *testing.T) {
 		}
 	}
 }
+
+func TestDropPolicyLabel(t *testing.T) {
+	log.SetupZapLogger(log.GetDefaultLogOpts())
+
+	assert.Equal(t, "unknown", policyLabel(nil))
+	assert.Equal(t, "default/allow-dns,default/deny-all", policyLabel(
+		[]*flow.Policy{{Namespace: "default", Name: "deny-all"}, {Namespace: "default", Name: "allow-dns"}, {Namespace: "default", Name: "deny-all"}},
+	))
+
+	d := NewDropCountMetrics(&v1alpha1.MetricsContextOptions{
+		MetricName:       "drop_count",
+		SourceLabels:     []string{"podName"},
+		AdditionalLabels: []string{"policy"},
+	}, log.Logger(), localContext, 0)
+	d.dropMetric = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_drop_policy"}, d.getLabels())
+	d.metricName = "drop_count"
+
+	d.ProcessFlow(&flow.Flow{
+		Verdict:         flow.Verdict_DROPPED,
+		Source:          &flow.Endpoint{PodName: "client"},
+		Destination:     &flow.Endpoint{PodName: "server"},
+		IngressDeniedBy: []*flow.Policy{{Namespace: "default", Name: "deny-all"}},
+	})
+
+	assert.InDelta(t, 1, testutil.ToFloat64(d.dropMetric.WithLabelValues("", ingress, "server", "default/deny-all")), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(d.dropMetric.WithLabelValues("", egress, "client", "unknown")), 0)
+
+	// In remote context, the label has the policies of a single direction.
+	r := NewDropCountMetrics(&v1alpha1.MetricsContextOptions{
+		MetricName:       "drop_count",
+		SourceLabels:     []string{"podName"},
+		AdditionalLabels: []string{"policy"},
+	}, log.Logger(), remoteContext, 0)
+	r.dropMetric = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_drop_policy_remote"}, r.getLabels())
+	r.metricName = "drop_count"
+
+	r.ProcessFlow(&flow.Flow{
+		Verdict:         flow.Verdict_DROPPED,
+		Source:          &flow.Endpoint{PodName: "client"},
+		IngressDeniedBy: []*flow.Policy{{Namespace: "default", Name: "deny-all"}},
+		EgressDeniedBy:  []*flow.Policy{{Namespace: "web", Name: "deny-egress"}},
+	})
+	r.ProcessFlow(&flow.Flow{
+		Verdict:        flow.Verdict_DROPPED,
+		Source:         &flow.Endpoint{PodName: "client"},
+		EgressDeniedBy: []*flow.Policy{{Namespace: "web", Name: "deny-egress"}},
+	})
+
+	assert.InDelta(t, 1, testutil.ToFloat64(r.dropMetric.WithLabelValues("", flow.TrafficDirection_TRAFFIC_DIRECTION_UNKNOWN.String(), "client", "default/deny-all")), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(r.dropMetric.WithLabelValues("", flow.TrafficDirection_TRAFFIC_DIRECTION_UNKNOWN.String(), "client", "web/deny-egress")), 0)
+}
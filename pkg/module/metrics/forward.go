@@ -181,6 +181,9 @@ func (f *ForwardMetrics) expire(labels []string) bool {
 }
 
 func (f *ForwardMetrics) update(fl *v1.Flow, labels []string) {
+	if labels = f.admit(labels); labels == nil {
+		return
+	}
 	var updated bool
 	switch f.metricName {
 	case utils.ForwardPacketsGaugeName:
@@ -67,7 +67,7 @@ func TestInit(t *testing.T) {
 	log.SetupZapLogger(log.GetDefaultLogOpts())
 	l := log.Logger().Named("test")
 
-	exporter.AdvancedRegistry = prometheus.NewRegistry()
+	exporter.ResetAdvancedMetricsRegistry()
 	lm := &LatencyMetrics{l: l}
 
 	lm.Init("latency")
@@ -90,7 +90,7 @@ func TestProcessFlow(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	exporter.AdvancedRegistry = prometheus.NewRegistry()
+	exporter.ResetAdvancedMetricsRegistry()
 	lm := &LatencyMetrics{l: l}
 
 	lm.Init("latency")
@@ -17,7 +17,6 @@ import (
 	kcfg "github.com/microsoft/retina/pkg/config"
 	"github.com/microsoft/retina/pkg/controllers/cache"
 	"github.com/microsoft/retina/pkg/enricher"
-	"github.com/microsoft/retina/pkg/exporter"
 	"github.com/microsoft/retina/pkg/log"
 	"github.com/microsoft/retina/pkg/managers/filtermanager"
 	"github.com/microsoft/retina/pkg/metrics"
@@ -33,6 +32,7 @@ const (
 	nodeApiserver string = "node_apiserver"
 	dns           string = "dns"
 	pktmon        string = "pktmon"
+	zoneTraffic   string = "zone_traffic"
 
 	metricModuleReq filtermanager.Requestor = "metricModule"
 	interval        time.Duration           = 1 * time.Second
@@ -75,6 +75,13 @@ type Module struct {
 	// current metrics spec for metrics module
 	currentSpec *api.MetricsSpec
 
+	// appliedOptions are the context options the registry is built from, the ones of the current spec with the
+	// metrics and labels selected by annotations
+	appliedOptions []api.MetricsContextOptions
+
+	// annotations are the metrics and labels selected by the annotations of pods and namespaces
+	annotations *annotationConfigs
+
 	// pubsub is the pubsub client
 	pubsub pubsub.PubSubInterface
 
@@ -93,6 +100,9 @@ type Module struct {
 	// excludedNamespaces for metrics
 	excludedNamespaces map[string]struct{}
 
+	// excludeMode is set when namespaces are selected by an exclude list, which selects all namespaces when empty
+	excludeMode bool
+
 	// metrics registry
 	registry map[string]AdvMetricsInterface
 
@@ -134,6 +144,7 @@ func InitModule(ctx context.Context,
 			dirtyPods:     common.NewDirtyCache(),
 			pubsubPodSub:  "",
 			daemonConfig:  conf,
+			annotations:   newAnnotationConfigs(),
 		}
 	})
 
@@ -181,30 +192,107 @@ func (m *Module) updateNamespaceLists(spec *api.MetricsSpec) {
 		return
 	}
 
+	// Within the same mode, the lists are updated with the namespaces added or removed. When the mode changes,
+	// the IPs of the namespaces which are no longer or newly of interest are applied to the filter manager.
 	if len(spec.Namespaces.Include) > 0 {
 		m.l.Info("Including namespaces", zap.Strings("namespaces", spec.Namespaces.Include))
-		m.appendExcludeList([]string{})
+		if m.excludeMode {
+			m.setNamespaceFilters(spec.Namespaces.Include, nil, false)
+			return
+		}
 		m.appendIncludeList(spec.Namespaces.Include)
-	} else if len(spec.Namespaces.Exclude) > 0 {
+	} else if spec.Namespaces.Exclude != nil {
+		// An empty exclude list, as merged from MetricsConfigurations excluding different namespaces,
+		// selects all namespaces.
 		m.l.Info("Excluding namespaces", zap.Strings("namespaces", spec.Namespaces.Exclude))
-		m.appendIncludeList([]string{})
+		if !m.excludeMode {
+			m.setNamespaceFilters(nil, spec.Namespaces.Exclude, true)
+			return
+		}
 		m.appendExcludeList(spec.Namespaces.Exclude)
 	} else {
+		if m.excludeMode {
+			m.setNamespaceFilters(nil, nil, false)
+			return
+		}
 		m.appendIncludeList([]string{})
-		m.appendExcludeList([]string{})
 	}
 }
 
+// setNamespaceFilters replaces the namespace filters, adding the IPs of the namespaces which are newly of interest to
+// the filter manager and removing the IPs of the namespaces which are no longer of interest.
+func (m *Module) setNamespaceFilters(included, excluded []string, excludeMode bool) {
+	before := m.namespacesOfInterest()
+	m.includedNamespaces = toSet(included)
+	m.excludedNamespaces = toSet(excluded)
+	m.excludeMode = excludeMode
+	after := m.namespacesOfInterest()
+
+	for ns := range after {
+		if _, ok := before[ns]; ok {
+			continue
+		}
+		ips := m.daemonCache.GetIPsByNamespace(ns)
+		m.l.Info("Adding IPs to filter manager", zap.String("namespace", ns), zap.String("ips", fmt.Sprint(ips)))
+		if err := m.filterManager.AddIPs(ips, metricModuleReq, moduleReqMetadata); err != nil {
+			m.l.Error("Error adding IPs to filter manager", zap.Error(err))
+		}
+	}
+	for ns := range before {
+		if _, ok := after[ns]; ok {
+			continue
+		}
+		ips := m.daemonCache.GetIPsByNamespace(ns)
+		m.l.Info("Removing IPs from filter manager", zap.String("namespace", ns), zap.String("ips", fmt.Sprint(ips)))
+		if err := m.filterManager.DeleteIPs(ips, metricModuleReq, moduleReqMetadata); err != nil {
+			m.l.Error("Error removing IPs from filter manager", zap.Error(err))
+		}
+	}
+}
+
+// namespacesOfInterest returns the namespaces selected by the namespace filters.
+func (m *Module) namespacesOfInterest() map[string]struct{} {
+	namespaces := make(map[string]struct{})
+	if !m.excludeMode && len(m.excludedNamespaces) == 0 {
+		for ns := range m.includedNamespaces {
+			namespaces[ns] = struct{}{}
+		}
+		return namespaces
+	}
+	for _, ns := range m.daemonCache.GetAllNamespaces() {
+		if m.nsOfInterest(ns) {
+			namespaces[ns] = struct{}{}
+		}
+	}
+	return namespaces
+}
+
+// updateMetricsContexts rebuilds only the metrics which are added, removed or whose context options changed, so the
+// series of unchanged metrics are kept.
 func (m *Module) updateMetricsContexts(spec *api.MetricsSpec) {
-	// clean old metrics from registry (remove prometheus collectors and remove map entry)
-	// reset the advanced metrics registry
+	options := m.annotations.contextOptions(spec.ContextOptions)
+	current := make(map[string]api.MetricsContextOptions)
+	for _, ctxOption := range m.contextOptions() {
+		current[ctxOption.MetricName] = ctxOption
+	}
+	unchanged := make(map[string]struct{})
+	for _, ctxOption := range options {
+		currentOption, ok := current[ctxOption.MetricName]
+		if ok && validations.MetricsContextOptionsCompare([]api.MetricsContextOptions{currentOption}, []api.MetricsContextOptions{ctxOption}) {
+			unchanged[registryKey(ctxOption.MetricName)] = struct{}{}
+		}
+	}
+
+	// clean removed and changed metrics from registry (remove prometheus collectors and remove map entry)
 	for key, metricObj := range m.registry {
+		if _, ok := unchanged[key]; ok {
+			continue
+		}
+		m.l.Info("Removing metric", zap.String("metricName", key))
 		metricObj.Clean()
 		delete(m.registry, key)
 	}
 
-	exporter.ResetAdvancedMetricsRegistry()
-
 	ctxType := remoteContext
 	if m.daemonConfig != nil && !m.daemonConfig.RemoteContext {
 		// when localcontext is enabled, we do not need the context options for both src and dst
@@ -213,7 +301,12 @@ func (m *Module) updateMetricsContexts(spec *api.MetricsSpec) {
 		ctxType = localContext
 	}
 
-	for _, ctxOption := range spec.ContextOptions {
+	added := make(map[string]struct{})
+	for _, ctxOption := range options {
+		if _, ok := m.registry[registryKey(ctxOption.MetricName)]; ok {
+			continue
+		}
+		added[registryKey(ctxOption.MetricName)] = struct{}{}
 		var ttl time.Duration
 		var err error
 		if ctxOption.TTL != "" {
@@ -225,6 +318,11 @@ func (m *Module) updateMetricsContexts(spec *api.MetricsSpec) {
 			}
 		}
 		switch {
+		case strings.Contains(ctxOption.MetricName, zoneTraffic):
+			zm := NewZoneTrafficMetrics(&ctxOption, m.l, ctxType, ttl)
+			if zm != nil {
+				m.registry[ctxOption.MetricName] = zm
+			}
 		case strings.Contains(ctxOption.MetricName, forward):
 			fm := NewForwardCountMetrics(&ctxOption, m.l, ctxType, ttl)
 			if fm != nil {
@@ -244,6 +342,10 @@ func (m *Module) updateMetricsContexts(spec *api.MetricsSpec) {
 			if tr != nil {
 				m.registry[ctxOption.MetricName] = tr
 			}
+			th := NewTCPHealthMetrics(&ctxOption, m.l, ctxType, ttl)
+			if th != nil {
+				m.registry[ctxOption.MetricName] = th
+			}
 		case strings.Contains(ctxOption.MetricName, nodeApiserver):
 			// Uses the pattern we will follow in future where each base metric has one instance.
 			// Example - tcp, latency, dns, etc.
@@ -251,6 +353,16 @@ func (m *Module) updateMetricsContexts(spec *api.MetricsSpec) {
 			if lm != nil {
 				m.registry[nodeApiserver] = lm
 			}
+		case ctxOption.MetricName == utils.DNSFailureCounterName:
+			df := NewDNSFailureMetrics(&ctxOption, m.l, ctxType, ttl)
+			if df != nil {
+				m.registry[ctxOption.MetricName] = df
+			}
+		case ctxOption.MetricName == utils.PacketSizeName || ctxOption.MetricName == utils.ConnectionSizeName:
+			sm := NewSizeMetrics(&ctxOption, m.l, ctxType, ttl)
+			if sm != nil {
+				m.registry[ctxOption.MetricName] = sm
+			}
 		case strings.Contains(ctxOption.MetricName, dns) || strings.Contains(ctxOption.MetricName, pktmon):
 			dm := NewDNSMetrics(&ctxOption, m.l, ctxType, ttl)
 			if dm != nil {
@@ -261,9 +373,53 @@ func (m *Module) updateMetricsContexts(spec *api.MetricsSpec) {
 		}
 	}
 
+	for _, ctxOption := range options {
+		if _, ok := added[ctxOption.MetricName]; ok {
+			m.annotations.setMasks(ctxOption, m.registry[ctxOption.MetricName])
+		}
+	}
+
 	for metricName, metricObj := range m.registry {
-		metricObj.Init(metricName)
+		if _, ok := added[metricName]; ok {
+			m.l.Info("Adding metric", zap.String("metricName", metricName))
+			metricObj.Init(metricName)
+		}
 	}
+	m.appliedOptions = options
+}
+
+// contextOptions returns the context options the registry is built from. The caller must hold the lock.
+func (m *Module) contextOptions() []api.MetricsContextOptions {
+	if m.appliedOptions != nil {
+		return m.appliedOptions
+	}
+	if m.currentSpec != nil {
+		return m.currentSpec.ContextOptions
+	}
+	return nil
+}
+
+// registryKey returns the key of the metric in the registry.
+func registryKey(metricName string) string {
+	if strings.Contains(metricName, nodeApiserver) {
+		return nodeApiserver
+	}
+	return metricName
+}
+
+// ExceededSeriesBudgets returns the names of the metrics which exceeded their series budget on this node.
+func (m *Module) ExceededSeriesBudgets() []string {
+	m.RLock()
+	defer m.RUnlock()
+
+	exceeded := []string{}
+	for _, ctxOption := range m.contextOptions() {
+		metricObj, ok := m.registry[registryKey(ctxOption.MetricName)].(baseMetricInterface)
+		if ok && metricObj.seriesBudgetExceeded() {
+			exceeded = append(exceeded, ctxOption.MetricName)
+		}
+	}
+	return exceeded
 }
 
 func (m *Module) run(newCtx context.Context) {
@@ -275,13 +431,13 @@ func (m *Module) run(newCtx context.Context) {
 	cbFunc := pubsub.CallBackFunc(m.PodCallBackFn)
 	m.pubsubPodSub = m.pubsub.Subscribe(common.PubSubPods, &cbFunc)
 
+	// The module is marked as running before the goroutines start, so that a following Reconcile always stops them.
+	// The caller holds the lock.
+	m.isRunning = true
+	m.ctx = newCtx
+
 	m.wg.Add(1)
 	go func() {
-		m.Lock()
-		m.isRunning = true
-		m.ctx = newCtx
-		m.Unlock()
-
 		evReader := m.enricher.ExportReader()
 		for {
 			ev := evReader.NextFollow(newCtx)
@@ -294,8 +450,10 @@ func (m *Module) run(newCtx context.Context) {
 				m.RLock()
 				f := ev.Event.(*flow.Flow)
 				m.l.Debug("converted flow object", zap.Any("flow l4", f.IP))
-				for _, metricObj := range m.registry {
-					metricObj.ProcessFlow(f)
+				for key, metricObj := range m.registry {
+					if m.annotations.selects(key, f) {
+						metricObj.ProcessFlow(f)
+					}
 				}
 				m.RUnlock()
 			case *flow.LostEvent:
@@ -328,6 +486,7 @@ func (m *Module) run(newCtx context.Context) {
 			case <-ticker.C:
 				m.l.Debug("Processing dirty pods")
 				m.applyDirtyPods()
+				m.applyAnnotations()
 			case <-newCtx.Done():
 				m.l.Info("Context cancelled. Exiting.")
 				err := m.pubsub.Unsubscribe(common.PubSubPods, m.pubsubPodSub)
@@ -461,22 +620,6 @@ func (m *Module) appendExcludeList(ns []string) {
 			m.l.Error("Error adding IPs to filter manager", zap.Error(err))
 		}
 	}
-
-	// When transitioning to exclude mode, add IPs for all non-excluded namespaces
-	if len(newlyExcluded) > 0 && len(newlyUnexcluded) == 0 && len(newlyExcluded) == len(ns) {
-		allNs := m.daemonCache.GetAllNamespaces()
-		for _, n := range allNs {
-			if _, excluded := m.excludedNamespaces[n]; !excluded {
-				ips := m.daemonCache.GetIPsByNamespace(n)
-				m.l.Info("Adding IPs to filter manager (non-excluded)", zap.String("namespace", n), zap.Any("ips", ips))
-
-				err := m.filterManager.AddIPs(ips, metricModuleReq, moduleReqMetadata)
-				if err != nil {
-					m.l.Error("Error adding IPs to filter manager", zap.Error(err))
-				}
-			}
-		}
-	}
 }
 
 func (m *Module) PodCallBackFn(obj interface{}) {
@@ -503,6 +646,8 @@ func (m *Module) PodCallBackFn(obj interface{}) {
 	namespaced := m.nsOfInterest(pod.Namespace())
 	m.RUnlock()
 
+	m.setPodAnnotations(event, pod, annotated)
+
 	if event.Type != cache.EventTypePodDeleted && !namespaced && !m.filterManager.HasIP(ip) && !annotated {
 		return
 	}
@@ -556,6 +701,40 @@ func handlePodEvent(
 	}
 }
 
+// setPodAnnotations records the metrics and labels selected by the annotations of the pod.
+func (m *Module) setPodAnnotations(event *cache.CacheEvent, pod *common.RetinaEndpoint, annotated bool) {
+	if m.annotations == nil || m.daemonConfig == nil || !m.daemonConfig.EnableAnnotations {
+		return
+	}
+	if event.Type == cache.EventTypePodDeleted || !annotated {
+		m.annotations.setPod(pod.NamespacedName(), nil)
+		return
+	}
+	selection, unknown := parseMetricsAnnotation(pod.Annotations())
+	if len(unknown) > 0 {
+		m.l.Warn("Ignoring unknown metrics or labels in pod annotations", zap.String("pod name", pod.NamespacedName()), zap.Strings("values", unknown))
+	}
+	m.annotations.setPod(pod.NamespacedName(), selection)
+}
+
+// applyAnnotations rebuilds the metrics whose selection by the annotations of pods and namespaces changed.
+func (m *Module) applyAnnotations() {
+	if m.annotations == nil || m.daemonConfig == nil || !m.daemonConfig.EnableAnnotations {
+		return
+	}
+	m.annotations.setNamespaces(m.daemonCache.GetNamespaceAnnotations())
+	if !m.annotations.hasChanged() {
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if m.currentSpec != nil {
+		m.l.Info("Metrics selected by annotations changed")
+		m.updateMetricsContexts(m.currentSpec)
+	}
+}
+
 // Adds or removes pod ips from filtermanager
 func (m *Module) applyDirtyPods() {
 	m.Lock()
@@ -630,7 +809,7 @@ func (m *Module) applyDirtyPodsDelete() {
 
 // nsOfInterest checks if the namespace is in the included or excluded list.
 // Included namespaces can be defined by CRD or automatically applied by annotated namespaces.
-// When no namespace filters are configured (both lists empty), returns false — pods must be
+// When no namespace filters are configured (both lists empty, outside of exclude mode), returns false — pods must be
 // individually annotated or already present in the filtermap to be tracked.
 func (m *Module) nsOfInterest(ns string) bool {
 	if len(m.includedNamespaces) > 0 {
@@ -640,7 +819,7 @@ func (m *Module) nsOfInterest(ns string) bool {
 		return false
 	}
 
-	if len(m.excludedNamespaces) > 0 {
+	if m.excludeMode || len(m.excludedNamespaces) > 0 {
 		if _, ok := m.excludedNamespaces[ns]; ok {
 			return false
 		}
@@ -664,6 +843,11 @@ func (m *Module) podAnnotated(annotations map[string]string) bool {
 		return true
 	}
 
+	if _, ok := annotations[common.RetinaMetricsAnnotation]; ok {
+		m.l.Debug("Pod is annotated with retina metrics annotation", zap.Any("annotations", annotations))
+		return true
+	}
+
 	return false
 }
 
@@ -14,9 +14,11 @@ import (
 	kcfg "github.com/microsoft/retina/pkg/config"
 	"github.com/microsoft/retina/pkg/controllers/cache"
 	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/exporter"
 	"github.com/microsoft/retina/pkg/log"
 	"github.com/microsoft/retina/pkg/managers/filtermanager"
 	"github.com/microsoft/retina/pkg/pubsub"
+	"github.com/microsoft/retina/pkg/utils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
@@ -589,6 +591,8 @@ func TestModule_Reconcile(t *testing.T) {
 
 	for _, tt := range tests {
 		log.Logger().Info("***** Running test *****", zap.String("name", tt.name))
+		// Metrics are only rebuilt when changed, so every module starts with its own registry.
+		exporter.ResetAdvancedMetricsRegistry()
 		p := pubsub.NewMockPubSubInterface(ctrl)        //nolint:typecheck
 		e := enricher.NewMockEnricherInterface(ctrl)    //nolint:typecheck
 		fm := filtermanager.NewMockIFilterManager(ctrl) //nolint:typecheck
@@ -600,6 +604,7 @@ func TestModule_Reconcile(t *testing.T) {
 		testRing := container.NewRing(container.Capacity1)
 		testRingReader := container.NewRingReader(testRing, 0)
 		p.EXPECT().Subscribe(gomock.Any(), gomock.Any()).Return("test").AnyTimes()
+		p.EXPECT().Unsubscribe(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 		e.EXPECT().ExportReader().AnyTimes().Return(testRingReader)
 
 		if tt.expectNoCalls {
@@ -611,7 +616,131 @@ func TestModule_Reconcile(t *testing.T) {
 		if err != nil && !tt.expectErr {
 			t.Errorf("unexpected error: %v", err)
 		}
+		if tt.m.ctxCancel != nil {
+			tt.m.ctxCancel()
+			tt.m.wg.Wait()
+		}
+	}
+}
+
+func TestModule_ReconcileIncremental(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	p := pubsub.NewMockPubSubInterface(ctrl)
+	e := enricher.NewMockEnricherInterface(ctrl)
+	fm := filtermanager.NewMockIFilterManager(ctrl)
+	c := cache.NewMockCacheInterface(ctrl)
+	p.EXPECT().Subscribe(gomock.Any(), gomock.Any()).Return("test").AnyTimes()
+	p.EXPECT().Unsubscribe(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	e.EXPECT().ExportReader().DoAndReturn(func() *container.RingReader {
+		return container.NewRingReader(container.NewRing(container.Capacity1), 0)
+	}).AnyTimes()
+	c.EXPECT().GetIPsByNamespace(gomock.Any()).Return([]net.IP{}).AnyTimes()
+	c.EXPECT().GetAllNamespaces().Return([]string{"ns1", "ns2", "ns3"}).AnyTimes()
+
+	exporter.ResetAdvancedMetricsRegistry()
+	m := &Module{
+		RWMutex:       &sync.RWMutex{},
+		l:             log.Logger().Named("MetricModule"),
+		pubsub:        p,
+		enricher:      e,
+		registry:      make(map[string]AdvMetricsInterface),
+		moduleCtx:     context.Background(),
+		filterManager: fm,
+		daemonCache:   c,
+		dirtyPods:     common.NewDirtyCache(),
 	}
+	defer func() {
+		m.ctxCancel()
+		m.wg.Wait()
+	}()
+
+	drop := api.MetricsContextOptions{MetricName: "drop_count", SourceLabels: []string{"ip"}}
+	forward := api.MetricsContextOptions{MetricName: "forward_count", SourceLabels: []string{"ip"}}
+
+	fm.EXPECT().AddIPs(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(1)
+	require.NoError(t, m.Reconcile(&api.MetricsSpec{
+		ContextOptions: []api.MetricsContextOptions{drop},
+		Namespaces:     api.MetricsNamespaces{Include: []string{"ns1"}},
+	}))
+	dropMetric := m.registry["drop_count"]
+	require.NotNil(t, dropMetric)
+
+	// Adding a metric and a namespace keeps the drop metric and only adds the IPs of the new namespace.
+	fm.EXPECT().AddIPs(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(1)
+	require.NoError(t, m.Reconcile(&api.MetricsSpec{
+		ContextOptions: []api.MetricsContextOptions{drop, forward},
+		Namespaces:     api.MetricsNamespaces{Include: []string{"ns1", "ns2"}},
+	}))
+	assert.Same(t, dropMetric, m.registry["drop_count"])
+	assert.NotNil(t, m.registry["forward_count"])
+
+	// Relabeling the drop metric rebuilds it. Switching to exclude ns1 adds the IPs of ns3 and keeps the others.
+	relabeled := api.MetricsContextOptions{MetricName: "drop_count", SourceLabels: []string{"ip", "podname"}}
+	fm.EXPECT().AddIPs(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(1)
+	fm.EXPECT().DeleteIPs(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(1)
+	require.NoError(t, m.Reconcile(&api.MetricsSpec{
+		ContextOptions: []api.MetricsContextOptions{relabeled, forward},
+		Namespaces:     api.MetricsNamespaces{Exclude: []string{"ns1"}},
+	}))
+	assert.NotSame(t, dropMetric, m.registry["drop_count"])
+	assert.Len(t, m.registry, 2)
+}
+
+func TestModule_AnnotationMetrics(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c := cache.NewMockCacheInterface(ctrl)
+	c.EXPECT().GetNamespaceAnnotations().Return(map[string]map[string]string{}).AnyTimes()
+
+	exporter.ResetAdvancedMetricsRegistry()
+	m := &Module{
+		RWMutex:      &sync.RWMutex{},
+		l:            log.Logger().Named("MetricModule"),
+		registry:     make(map[string]AdvMetricsInterface),
+		daemonCache:  c,
+		daemonConfig: &kcfg.Config{EnableAnnotations: true},
+		annotations:  newAnnotationConfigs(),
+		currentSpec: &api.MetricsSpec{
+			ContextOptions: []api.MetricsContextOptions{
+				{MetricName: utils.ForwardPacketsGaugeName, SourceLabels: []string{"podname"}},
+			},
+		},
+	}
+	m.updateMetricsContexts(m.currentSpec)
+	forwardMetric := m.registry[utils.ForwardPacketsGaugeName]
+	require.NotNil(t, forwardMetric)
+	defer func() {
+		for _, metricObj := range m.registry {
+			metricObj.Clean()
+		}
+	}()
+
+	// Selecting metrics rebuilds only the added ones.
+	pod := common.NewRetinaEndpoint("pod1", "ns1", &common.IPAddresses{IPv4: net.IPv4(10, 0, 0, 1)})
+	pod.SetAnnotations(map[string]string{common.RetinaMetricsAnnotation: "dns"})
+	require.True(t, m.podAnnotated(pod.Annotations()))
+	m.setPodAnnotations(&cache.CacheEvent{Type: cache.EventTypePodAdded, Obj: pod}, pod, true)
+	m.applyAnnotations()
+	assert.Same(t, forwardMetric, m.registry[utils.ForwardPacketsGaugeName])
+	assert.NotNil(t, m.registry[utils.DNSRequestCounterName])
+	assert.NotNil(t, m.registry[utils.DNSResponseCounterName])
+	assert.Len(t, m.contextOptions(), 3)
+
+	// Nothing changed.
+	m.applyAnnotations()
+	assert.Len(t, m.registry, 3)
+
+	m.setPodAnnotations(&cache.CacheEvent{Type: cache.EventTypePodDeleted, Obj: pod}, pod, true)
+	m.applyAnnotations()
+	assert.Len(t, m.registry, 1)
+	assert.Same(t, forwardMetric, m.registry[utils.ForwardPacketsGaugeName])
 }
 
 func TestPodAnnotated(t *testing.T) {
@@ -645,6 +774,32 @@ func TestPodAnnotated(t *testing.T) {
 			},
 			expected: true,
 		},
+		{
+			name: "pod annotated with metrics",
+			annotations: map[string]string{
+				common.RetinaMetricsAnnotation: "dns",
+			},
+			m: &Module{
+				daemonConfig: &kcfg.Config{
+					EnableAnnotations: true,
+				},
+				l: l,
+			},
+			expected: true,
+		},
+		{
+			name: "pod annotated with labels only",
+			annotations: map[string]string{
+				common.RetinaLabelsAnnotation: "port",
+			},
+			m: &Module{
+				daemonConfig: &kcfg.Config{
+					EnableAnnotations: true,
+				},
+				l: l,
+			},
+			expected: false,
+		},
 		{
 			name: "pod not annotated",
 			annotations: map[string]string{
@@ -832,6 +987,7 @@ func TestUpdateNamespaceListsExclude(t *testing.T) {
 		spec                   *api.MetricsSpec
 		wantIncludedNamespaces map[string]struct{}
 		wantExcludedNamespaces map[string]struct{}
+		wantNs2OfInterest      bool
 	}{
 		{
 			"exclude only - should populate excludedNamespaces",
@@ -842,12 +998,25 @@ func TestUpdateNamespaceListsExclude(t *testing.T) {
 			},
 			map[string]struct{}{},
 			map[string]struct{}{"ns1": {}},
+			true,
+		},
+		{
+			"empty exclude list - all namespaces of interest",
+			&api.MetricsSpec{
+				Namespaces: api.MetricsNamespaces{
+					Exclude: []string{},
+				},
+			},
+			map[string]struct{}{},
+			map[string]struct{}{},
+			true,
 		},
 		{
 			"neither set - both empty",
 			&api.MetricsSpec{},
 			map[string]struct{}{},
 			map[string]struct{}{},
+			false,
 		},
 	}
 
@@ -856,6 +1025,7 @@ func TestUpdateNamespaceListsExclude(t *testing.T) {
 			me.updateNamespaceLists(test.spec)
 			assert.Equal(t, test.wantIncludedNamespaces, me.includedNamespaces)
 			assert.Equal(t, test.wantExcludedNamespaces, me.excludedNamespaces)
+			assert.Equal(t, test.wantNs2OfInterest, me.nsOfInterest("ns2"))
 		})
 	}
 }
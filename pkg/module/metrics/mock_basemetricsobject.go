@@ -12,6 +12,7 @@ package metrics
 import (
 	reflect "reflect"
 
+	flow "github.com/cilium/cilium/api/v1/flow"
 	log "github.com/microsoft/retina/pkg/log"
 	gomock "go.uber.org/mock/gomock"
 )
@@ -53,6 +54,20 @@ func (mr *MockbaseMetricInterfaceMockRecorder) additionalLabels() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "additionalLabels", reflect.TypeOf((*MockbaseMetricInterface)(nil).additionalLabels))
 }
 
+// admit mocks base method.
+func (m *MockbaseMetricInterface) admit(lbs []string) []string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "admit", lbs)
+	ret0, _ := ret[0].([]string)
+	return ret0
+}
+
+// admit indicates an expected call of admit.
+func (mr *MockbaseMetricInterfaceMockRecorder) admit(lbs any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "admit", reflect.TypeOf((*MockbaseMetricInterface)(nil).admit), lbs)
+}
+
 // clean mocks base method.
 func (m *MockbaseMetricInterface) clean() {
 	m.ctrl.T.Helper()
@@ -65,6 +80,20 @@ func (mr *MockbaseMetricInterfaceMockRecorder) clean() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "clean", reflect.TypeOf((*MockbaseMetricInterface)(nil).clean))
 }
 
+// contextValues mocks base method.
+func (m *MockbaseMetricInterface) contextValues(arg0 *flow.Flow) map[string][]string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "contextValues", arg0)
+	ret0, _ := ret[0].(map[string][]string)
+	return ret0
+}
+
+// contextValues indicates an expected call of contextValues.
+func (mr *MockbaseMetricInterfaceMockRecorder) contextValues(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "contextValues", reflect.TypeOf((*MockbaseMetricInterface)(nil).contextValues), arg0)
+}
+
 // destinationCtx mocks base method.
 func (m *MockbaseMetricInterface) destinationCtx() ContextOptionsInterface {
 	m.ctrl.T.Helper()
@@ -121,6 +150,20 @@ func (mr *MockbaseMetricInterfaceMockRecorder) isLocalContext() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "isLocalContext", reflect.TypeOf((*MockbaseMetricInterface)(nil).isLocalContext))
 }
 
+// seriesBudgetExceeded mocks base method.
+func (m *MockbaseMetricInterface) seriesBudgetExceeded() bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "seriesBudgetExceeded")
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// seriesBudgetExceeded indicates an expected call of seriesBudgetExceeded.
+func (mr *MockbaseMetricInterfaceMockRecorder) seriesBudgetExceeded() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "seriesBudgetExceeded", reflect.TypeOf((*MockbaseMetricInterface)(nil).seriesBudgetExceeded))
+}
+
 // sourceCtx mocks base method.
 func (m *MockbaseMetricInterface) sourceCtx() ContextOptionsInterface {
 	m.ctrl.T.Helper()
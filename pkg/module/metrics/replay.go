@@ -0,0 +1,84 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package metrics
+
+import (
+	"sync"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	api "github.com/microsoft/retina/crd/api/v1alpha1"
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/controllers/cache"
+	"github.com/microsoft/retina/pkg/exporter"
+	"github.com/microsoft/retina/pkg/log"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Replayer processes flows synchronously with the metrics of a MetricsSpec, without subscribing to the enricher, the
+// pubsub or the filter manager. It is used to replay recorded flows offline and must not be used in the agent, as it
+// resets the advanced metrics registry.
+type Replayer struct {
+	m *Module
+}
+
+// NewReplayer creates the metrics of the spec as the module would when reconciling it, in a new advanced metrics
+// registry.
+func NewReplayer(conf *kcfg.Config, spec *api.MetricsSpec, c cache.CacheInterface) *Replayer {
+	m := &Module{
+		RWMutex:      &sync.RWMutex{},
+		l:            log.Logger().Named("MetricModuleReplay"),
+		daemonConfig: conf,
+		registry:     make(map[string]AdvMetricsInterface),
+		daemonCache:  c,
+		currentSpec:  spec,
+	}
+	m.includedNamespaces = toSet(spec.Namespaces.Include)
+	m.excludedNamespaces = toSet(spec.Namespaces.Exclude)
+	m.excludeMode = len(spec.Namespaces.Include) == 0 && spec.Namespaces.Exclude != nil
+	exporter.ResetAdvancedMetricsRegistry()
+	m.updateMetricsContexts(spec)
+	return &Replayer{m: m}
+}
+
+// ProcessFlow updates the metrics with an enriched flow. Without namespace filters in the spec, all flows are
+// processed as they were already filtered by the agent when they were recorded. Otherwise, flows are processed only if
+// the source or destination pod is in a namespace of interest or annotated to be observed, like the filter manager of
+// the agent would select them.
+func (r *Replayer) ProcessFlow(f *flow.Flow) bool {
+	if len(r.m.includedNamespaces) > 0 || r.m.excludeMode {
+		if !r.endpointOfInterest(f.GetIP().GetSource(), f.GetSource()) && !r.endpointOfInterest(f.GetIP().GetDestination(), f.GetDestination()) {
+			return false
+		}
+	}
+
+	for _, metricObj := range r.m.registry {
+		metricObj.ProcessFlow(f)
+	}
+	return true
+}
+
+func (r *Replayer) endpointOfInterest(ip string, ep *flow.Endpoint) bool {
+	if ep == nil || ep.GetNamespace() == "" {
+		return false
+	}
+	if r.m.nsOfInterest(ep.GetNamespace()) {
+		return true
+	}
+	if pod := r.m.daemonCache.GetPodByIP(ip); pod != nil {
+		return r.m.podAnnotated(pod.Annotations())
+	}
+	return false
+}
+
+// Gather returns the series of the advanced metrics.
+func (r *Replayer) Gather() ([]*dto.MetricFamily, error) {
+	return exporter.AdvancedRegistry.Gather() //nolint:wrapcheck // returned as is
+}
+
+func toSet(values []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(values))
+	for _, v := range values {
+		set[v] = struct{}{}
+	}
+	return set
+}
@@ -0,0 +1,305 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package metrics
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"time"
+
+	v1 "github.com/cilium/cilium/api/v1/flow"
+	api "github.com/microsoft/retina/crd/api/v1alpha1"
+	"github.com/microsoft/retina/pkg/exporter"
+	"github.com/microsoft/retina/pkg/log"
+	metricsinit "github.com/microsoft/retina/pkg/metrics"
+	"github.com/microsoft/retina/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	// Metric names
+	PacketSizeBytesName     = "adv_packet_size_bytes"
+	ConnectionSizeBytesName = "adv_connection_size_bytes"
+
+	// Metric descriptions
+	PacketSizeBytesDesc     = "Distribution of the size of the observed packets"
+	ConnectionSizeBytesDesc = "Distribution of the total bytes of the connections, in both directions, when they close"
+
+	// connectionIdleTimeout is the time after which a connection without packets is considered closed.
+	connectionIdleTimeout = 2 * time.Minute
+	// connectionSweepInterval is how often the idle connections are closed when no flow arrives.
+	connectionSweepInterval = 30 * time.Second
+	// maxTrackedConnections bounds the number of connections tracked at once.
+	maxTrackedConnections = 65536
+)
+
+var (
+	// defaultPacketSizeBuckets are around the usual MTUs.
+	defaultPacketSizeBuckets = []float64{64, 128, 256, 512, 1024, 1500, 4096, 9000, 65535}
+	// defaultConnectionSizeBuckets go from 1KiB to 1GiB.
+	defaultConnectionSizeBuckets = prometheus.ExponentialBuckets(1024, 4, 11)
+)
+
+// connection is the total size of a connection seen so far.
+type connection struct {
+	bytes    uint64
+	lastSeen time.Time
+	// values are the values of the context labels of the first packet, by direction in local context.
+	values map[string][]string
+	// source is the source of the first packet, the packets from it are counted in points[0] and the replies in
+	// points[1].
+	source string
+	// points are the observation points the packets of each direction are counted at, the first one they are seen at,
+	// since a packet can be observed at several points, e.g. leaving a pod and entering another one on the same node.
+	points [2]v1.TraceObservationPoint
+}
+
+// countedAt returns whether the packets from the source are counted at the observation point.
+func (c *connection) countedAt(source string, point v1.TraceObservationPoint) bool {
+	i := 0
+	if source != c.source {
+		i = 1
+	}
+	if c.points[i] == v1.TraceObservationPoint_UNKNOWN_POINT {
+		c.points[i] = point
+	}
+	return c.points[i] == point
+}
+
+// SizeMetrics observes the size distribution of packets, and of connections when they close.
+type SizeMetrics struct {
+	baseMetricInterface
+	sizeMetric metricsinit.HistogramVec
+	metricName string
+	buckets    []float64
+
+	// connections are the open connections, for the connection size.
+	connections *pendingFlows[*connection]
+	// cancelFn stops the periodic sweep of the idle connections.
+	cancelFn context.CancelFunc
+}
+
+func NewSizeMetrics(ctxOptions *api.MetricsContextOptions, fl *log.ZapLogger, isLocalContext enrichmentContext, ttl time.Duration) *SizeMetrics {
+	if ctxOptions == nil {
+		return nil
+	}
+	var buckets []float64
+	switch ctxOptions.MetricName {
+	case utils.PacketSizeName:
+		buckets = defaultPacketSizeBuckets
+	case utils.ConnectionSizeName:
+		buckets = defaultConnectionSizeBuckets
+	default:
+		return nil
+	}
+	if len(ctxOptions.Buckets) > 0 {
+		buckets = make([]float64, 0, len(ctxOptions.Buckets))
+		for _, b := range ctxOptions.Buckets {
+			buckets = append(buckets, float64(b))
+		}
+	}
+
+	fl = fl.Named("sizes-metricsmodule")
+	fl.Info("Creating size metrics", zap.Any("options", ctxOptions))
+	s := &SizeMetrics{
+		buckets:     buckets,
+		connections: newPendingFlows[*connection](maxTrackedConnections),
+	}
+	s.baseMetricInterface = newBaseMetricsObject(ctxOptions, fl, isLocalContext, s.expire, ttl)
+
+	if ctxOptions.MetricName == utils.ConnectionSizeName {
+		// the idle connections are also closed without new flows, e.g. on a quiet node.
+		ctx, cancel := context.WithCancel(context.Background())
+		s.cancelFn = cancel
+		go s.sweepConnections(ctx)
+	}
+	return s
+}
+
+func (s *SizeMetrics) Init(metricName string) {
+	switch metricName {
+	case utils.PacketSizeName:
+		s.sizeMetric = exporter.CreatePrometheusHistogramVecForMetric(
+			exporter.AdvancedRegistry,
+			PacketSizeBytesName,
+			PacketSizeBytesDesc,
+			s.buckets,
+			s.getLabels()...,
+		)
+	case utils.ConnectionSizeName:
+		s.sizeMetric = exporter.CreatePrometheusHistogramVecForMetric(
+			exporter.AdvancedRegistry,
+			ConnectionSizeBytesName,
+			ConnectionSizeBytesDesc,
+			s.buckets,
+			s.getLabels()...,
+		)
+	default:
+		s.getLogger().Error("unknown metric name", zap.String("name", metricName))
+	}
+	s.metricName = metricName
+}
+
+func (s *SizeMetrics) getLabels() []string {
+	labels := []string{utils.Direction}
+	if s.sourceCtx() != nil {
+		labels = append(labels, s.sourceCtx().getLabels()...)
+	}
+
+	if s.destinationCtx() != nil {
+		labels = append(labels, s.destinationCtx().getLabels()...)
+	}
+
+	return labels
+}
+
+func (s *SizeMetrics) ProcessFlow(flow *v1.Flow) {
+	if flow == nil || flow.Verdict != v1.Verdict_FORWARDED {
+		return
+	}
+
+	switch s.metricName {
+	case utils.PacketSizeName:
+		// the packets seen since the last packet of a sampled connection have no size of their own.
+		if size := utils.PacketSize(flow); size > 0 {
+			s.observe(s.contextValues(flow), float64(size))
+		}
+	case utils.ConnectionSizeName:
+		s.processConnection(flow)
+	}
+}
+
+// processConnection adds the bytes of the flow to its connection, and observes the total size of the connections
+// which close with a FIN or RST, or which are idle for the connection idle timeout. Each packet is counted at a single
+// observation point per direction.
+func (s *SizeMetrics) processConnection(flow *v1.Flow) {
+	key, source, ok := connectionKey(flow)
+	if !ok {
+		return
+	}
+	bytes := uint64(utils.PacketSize(flow)) + uint64(utils.PreviouslyObservedBytes(flow))
+	flags := flow.GetL4().GetTCP().GetFlags()
+	now := s.connections.now()
+
+	var closed []*connection
+	s.connections.Lock()
+	c, ok := s.connections.entries[key]
+	// the packets closing a connection, e.g. the same FIN observed at another point, do not open a new one.
+	if !ok && !flags.GetFIN() && !flags.GetRST() {
+		c = &connection{values: s.contextValues(flow), source: source}
+		ok = s.connections.add(key, c)
+	}
+	if ok && c.countedAt(source, flow.GetTraceObservationPoint()) {
+		c.bytes += bytes
+		c.lastSeen = now
+		if flags.GetFIN() || flags.GetRST() {
+			closed = append(closed, c)
+			delete(s.connections.entries, key)
+		}
+	}
+	closed = append(closed, s.connections.sweep(now, idleConnection(now))...)
+	s.connections.Unlock()
+
+	for _, c := range closed {
+		s.observe(c.values, float64(c.bytes))
+	}
+}
+
+// sweepConnections closes the idle connections every connectionSweepInterval until the context is done.
+func (s *SizeMetrics) sweepConnections(ctx context.Context) {
+	ticker := time.NewTicker(connectionSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.closeIdleConnections()
+		}
+	}
+}
+
+// closeIdleConnections observes the total size of the connections which are idle for the connection idle timeout.
+func (s *SizeMetrics) closeIdleConnections() {
+	now := s.connections.now()
+	s.connections.Lock()
+	closed := s.connections.sweep(now, idleConnection(now))
+	s.connections.Unlock()
+
+	for _, c := range closed {
+		s.observe(c.values, float64(c.bytes))
+	}
+}
+
+func idleConnection(now time.Time) func(c *connection) bool {
+	return func(c *connection) bool {
+		return now.Sub(c.lastSeen) >= connectionIdleTimeout
+	}
+}
+
+// connectionKey returns the same key for the packets of both directions of a TCP or UDP connection, and the source of
+// the packet.
+func connectionKey(flow *v1.Flow) (key, source string, ok bool) {
+	var proto string
+	var srcPort, dstPort uint32
+	switch {
+	case flow.GetL4().GetTCP() != nil:
+		proto = "tcp"
+		srcPort, dstPort = flow.GetL4().GetTCP().GetSourcePort(), flow.GetL4().GetTCP().GetDestinationPort()
+	case flow.GetL4().GetUDP() != nil:
+		proto = "udp"
+		srcPort, dstPort = flow.GetL4().GetUDP().GetSourcePort(), flow.GetL4().GetUDP().GetDestinationPort()
+	default:
+		return "", "", false
+	}
+	src := net.JoinHostPort(flow.GetIP().GetSource(), strconv.Itoa(int(srcPort)))
+	dst := net.JoinHostPort(flow.GetIP().GetDestination(), strconv.Itoa(int(dstPort)))
+	source = src
+	if src > dst {
+		src, dst = dst, src
+	}
+	return proto + "-" + src + "-" + dst, source, true
+}
+
+// observe adds the size to the histogram of the context label values of each direction.
+func (s *SizeMetrics) observe(values map[string][]string, size float64) {
+	for direction, v := range values {
+		if s.isLocalContext() && len(v) == 0 {
+			continue
+		}
+		labels := append([]string{direction}, v...)
+		s.update(labels, size)
+		s.getLogger().Debug("size metric", zap.String("metric", s.metricName), zap.Strings("labels", labels))
+	}
+}
+
+func (s *SizeMetrics) expire(labels []string) bool {
+	var d bool
+	if s.sizeMetric != nil {
+		d = s.sizeMetric.DeleteLabelValues(labels...)
+		if d {
+			metricsinit.MetricsExpiredCounter.WithLabelValues(s.metricName).Inc()
+		}
+	}
+	return d
+}
+
+func (s *SizeMetrics) update(labels []string, size float64) {
+	if labels = s.admit(labels); labels == nil {
+		return
+	}
+	s.sizeMetric.WithLabelValues(labels...).Observe(size)
+	s.updated(labels)
+}
+
+func (s *SizeMetrics) Clean() {
+	if s.cancelFn != nil {
+		s.cancelFn()
+	}
+	exporter.UnregisterMetric(exporter.AdvancedRegistry, metricsinit.ToPrometheusType(s.sizeMetric))
+	s.clean()
+	s.connections.reset()
+}
@@ -0,0 +1,145 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package metrics
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	api "github.com/microsoft/retina/crd/api/v1alpha1"
+	"github.com/microsoft/retina/pkg/exporter"
+	"github.com/microsoft/retina/pkg/log"
+	metricsinit "github.com/microsoft/retina/pkg/metrics"
+	"github.com/microsoft/retina/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sizeFlow(l *log.ZapLogger, src, dst string, srcPort, dstPort, size, prevBytes uint32, fin uint16) *flow.Flow {
+	f := utils.ToFlow(l, time.Now().UnixNano(), net.ParseIP(src), net.ParseIP(dst), srcPort, dstPort, 6, 1, flow.Verdict_FORWARDED)
+	utils.AddTCPFlags(f, 0, 1, fin, 0, 0, 0, 0, 0, 0)
+	ext := utils.NewExtensions()
+	utils.AddPacketSize(ext, size)
+	utils.AddPreviouslyObservedBytes(ext, prevBytes)
+	utils.SetExtensions(f, ext)
+	f.Source = &flow.Endpoint{PodName: "pod-" + src}
+	f.Destination = &flow.Endpoint{PodName: "pod-" + dst}
+	return f
+}
+
+func TestSizeMetrics(t *testing.T) {
+	l, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+
+	newMetric := func(t *testing.T, name string, buckets []int64) *SizeMetrics {
+		exporter.ResetAdvancedMetricsRegistry()
+		s := NewSizeMetrics(&api.MetricsContextOptions{
+			MetricName:        name,
+			SourceLabels:      []string{"podname"},
+			DestinationLabels: []string{"podname"},
+			Buckets:           buckets,
+		}, l, remoteContext, 0)
+		require.NotNil(t, s)
+		s.Init(name)
+		t.Cleanup(s.Clean)
+		return s
+	}
+	histogram := func(t *testing.T, s *SizeMetrics, labels ...string) *dto.Histogram {
+		m := &dto.Metric{}
+		require.NoError(t, s.sizeMetric.WithLabelValues(labels...).(prometheus.Metric).Write(m))
+		return m.GetHistogram()
+	}
+
+	t.Run("not a size metric", func(t *testing.T) {
+		assert.Nil(t, NewSizeMetrics(&api.MetricsContextOptions{MetricName: utils.ForwardBytesGaugeName}, l, remoteContext, 0))
+	})
+
+	t.Run("packet size", func(t *testing.T) {
+		s := newMetric(t, utils.PacketSizeName, []int64{100, 1500})
+		assert.Equal(t, []string{"direction", "source_podname", "destination_podname"}, s.getLabels())
+		s.ProcessFlow(sizeFlow(l, "10.0.0.1", "10.0.0.9", 40000, 80, 60, 0, 0))
+		s.ProcessFlow(sizeFlow(l, "10.0.0.1", "10.0.0.9", 40000, 80, 1400, 0, 0))
+		s.ProcessFlow(sizeFlow(l, "10.0.0.1", "10.0.0.9", 40000, 80, 9000, 0, 0))
+		// no size of its own
+		s.ProcessFlow(sizeFlow(l, "10.0.0.1", "10.0.0.9", 40000, 80, 0, 3000, 0))
+
+		assert.Equal(t, 1, testutil.CollectAndCount(metricsinit.ToPrometheusType(s.sizeMetric)))
+		h := histogram(t, s, "INGRESS", "pod-10.0.0.1", "pod-10.0.0.9")
+		assert.Equal(t, uint64(3), h.GetSampleCount())
+		assert.InDelta(t, 10460, h.GetSampleSum(), 0)
+		assert.Equal(t, uint64(1), h.GetBucket()[0].GetCumulativeCount())
+		assert.Equal(t, uint64(2), h.GetBucket()[1].GetCumulativeCount())
+	})
+
+	t.Run("connection size", func(t *testing.T) {
+		s := newMetric(t, utils.ConnectionSizeName, nil)
+		now := time.Now()
+		s.connections.now = func() time.Time { return now }
+
+		s.ProcessFlow(sizeFlow(l, "10.0.0.1", "10.0.0.9", 40000, 80, 100, 0, 0))
+		s.ProcessFlow(sizeFlow(l, "10.0.0.9", "10.0.0.1", 80, 40000, 1000, 4000, 0))
+		s.ProcessFlow(sizeFlow(l, "10.0.0.2", "10.0.0.9", 40000, 80, 100, 0, 0))
+		assert.Equal(t, 0, testutil.CollectAndCount(metricsinit.ToPrometheusType(s.sizeMetric)))
+
+		// closed by the server, labeled by the first packet of the connection
+		s.ProcessFlow(sizeFlow(l, "10.0.0.9", "10.0.0.1", 80, 40000, 100, 0, 1))
+		h := histogram(t, s, "INGRESS", "pod-10.0.0.1", "pod-10.0.0.9")
+		assert.Equal(t, uint64(1), h.GetSampleCount())
+		assert.InDelta(t, 5200, h.GetSampleSum(), 0)
+		assert.Len(t, s.connections.entries, 1)
+
+		// idle connection
+		now = now.Add(connectionIdleTimeout)
+		s.ProcessFlow(sizeFlow(l, "10.0.0.3", "10.0.0.9", 40000, 80, 100, 0, 1))
+		h = histogram(t, s, "INGRESS", "pod-10.0.0.2", "pod-10.0.0.9")
+		assert.Equal(t, uint64(1), h.GetSampleCount())
+		assert.InDelta(t, 100, h.GetSampleSum(), 0)
+		assert.Empty(t, s.connections.entries)
+	})
+
+	t.Run("connection observed at several points", func(t *testing.T) {
+		s := newMetric(t, utils.ConnectionSizeName, nil)
+		// the packets between two pods of the node leave one pod and enter the other one.
+		at := func(f *flow.Flow, point flow.TraceObservationPoint) *flow.Flow {
+			f.TraceObservationPoint = point
+			return f
+		}
+		for _, point := range []flow.TraceObservationPoint{flow.TraceObservationPoint_TO_STACK, flow.TraceObservationPoint_TO_ENDPOINT} {
+			s.ProcessFlow(at(sizeFlow(l, "10.0.0.1", "10.0.0.9", 40000, 80, 100, 0, 0), point))
+		}
+		for _, point := range []flow.TraceObservationPoint{flow.TraceObservationPoint_TO_STACK, flow.TraceObservationPoint_TO_ENDPOINT} {
+			s.ProcessFlow(at(sizeFlow(l, "10.0.0.9", "10.0.0.1", 80, 40000, 1000, 0, 0), point))
+		}
+		assert.Equal(t, 0, testutil.CollectAndCount(metricsinit.ToPrometheusType(s.sizeMetric)))
+		for _, point := range []flow.TraceObservationPoint{flow.TraceObservationPoint_TO_STACK, flow.TraceObservationPoint_TO_ENDPOINT} {
+			s.ProcessFlow(at(sizeFlow(l, "10.0.0.1", "10.0.0.9", 40000, 80, 100, 0, 1), point))
+		}
+
+		h := histogram(t, s, "INGRESS", "pod-10.0.0.1", "pod-10.0.0.9")
+		assert.Equal(t, uint64(1), h.GetSampleCount())
+		assert.InDelta(t, 1200, h.GetSampleSum(), 0)
+		assert.Empty(t, s.connections.entries)
+	})
+
+	t.Run("idle connection without new flows", func(t *testing.T) {
+		s := newMetric(t, utils.ConnectionSizeName, nil)
+		now := time.Now()
+		s.connections.now = func() time.Time { return now }
+
+		s.ProcessFlow(sizeFlow(l, "10.0.0.1", "10.0.0.9", 40000, 80, 100, 0, 0))
+		s.closeIdleConnections()
+		assert.Equal(t, 0, testutil.CollectAndCount(metricsinit.ToPrometheusType(s.sizeMetric)))
+
+		now = now.Add(connectionIdleTimeout)
+		s.closeIdleConnections()
+		h := histogram(t, s, "INGRESS", "pod-10.0.0.1", "pod-10.0.0.9")
+		assert.Equal(t, uint64(1), h.GetSampleCount())
+		assert.InDelta(t, 100, h.GetSampleSum(), 0)
+		assert.Empty(t, s.connections.entries)
+	})
+}
@@ -168,6 +168,9 @@ func (t *TCPMetrics) expire(labels []string) bool {
 }
 
 func (t *TCPMetrics) update(labels []string, count uint32) {
+	if labels = t.admit(labels); labels == nil {
+		return
+	}
 	t.tcpFlagsMetrics.WithLabelValues(labels...).Add(float64(count))
 	t.updated(labels)
 }
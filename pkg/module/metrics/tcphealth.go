@@ -0,0 +1,284 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package metrics
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"time"
+
+	v1 "github.com/cilium/cilium/api/v1/flow"
+	api "github.com/microsoft/retina/crd/api/v1alpha1"
+	"github.com/microsoft/retina/pkg/exporter"
+	"github.com/microsoft/retina/pkg/log"
+	metricsinit "github.com/microsoft/retina/pkg/metrics"
+	"github.com/microsoft/retina/pkg/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	// Metric names
+	TCPHandshakeFailuresCountName = "adv_tcp_handshake_failures_count"
+	TCPResetsCountName            = "adv_tcp_resets_count"
+	TCPZeroWindowCountName        = "adv_tcp_zero_window_count"
+
+	// Metric descriptions
+	TCPHandshakeFailuresCountDesc = "Total number of TCP connection attempts which did not complete the handshake"
+	TCPResetsCountDesc            = "Total number of TCP resets by the side of the connection sending them"
+	TCPZeroWindowCountDesc        = "Total number of TCP zero window advertisements"
+
+	// handshakeTimeout is the time after which a SYN without SYN-ACK is counted as a failed handshake.
+	handshakeTimeout = 10 * time.Second
+	// handshakeSweepInterval is how often the timed out handshakes are counted when no flow arrives.
+	handshakeSweepInterval = 5 * time.Second
+	// maxPendingHandshakes bounds the number of connection attempts tracked at once.
+	maxPendingHandshakes = 65536
+
+	handshakeTimeoutReason = "timeout"
+	handshakeResetReason   = "reset"
+
+	clientSide  = "client"
+	serverSide  = "server"
+	unknownSide = "unknown"
+)
+
+// handshake is a connection attempt waiting for a SYN-ACK.
+type handshake struct {
+	started time.Time
+	// values are the values of the context labels of the SYN, by direction in local context.
+	values map[string][]string
+}
+
+// TCPHealthMetrics derives the health of TCP connections from their flags: handshakes which fail,
+// resets by the side sending them, and zero window advertisements.
+type TCPHealthMetrics struct {
+	baseMetricInterface
+	tcpHealthMetrics metricsinit.GaugeVec
+	metricName       string
+
+	// handshakes are the pending connection attempts.
+	handshakes *pendingFlows[*handshake]
+	// cancelFn stops the periodic sweep of the timed out handshakes.
+	cancelFn context.CancelFunc
+}
+
+func NewTCPHealthMetrics(ctxOptions *api.MetricsContextOptions, fl *log.ZapLogger, isLocalContext enrichmentContext, ttl time.Duration) *TCPHealthMetrics {
+	if ctxOptions == nil {
+		return nil
+	}
+	switch ctxOptions.MetricName {
+	case utils.TCPHandshakeFailuresName, utils.TCPResetsName, utils.TCPZeroWindowName:
+	default:
+		return nil
+	}
+
+	fl = fl.Named("tcphealth-metricsmodule")
+	fl.Info("Creating TCP connection health metrics", zap.Any("options", ctxOptions))
+	t := &TCPHealthMetrics{
+		handshakes: newPendingFlows[*handshake](maxPendingHandshakes),
+	}
+	t.baseMetricInterface = newBaseMetricsObject(ctxOptions, fl, isLocalContext, t.expire, ttl)
+
+	if ctxOptions.MetricName == utils.TCPHandshakeFailuresName {
+		// the timed out handshakes are also counted without new flows, e.g. on a quiet node.
+		ctx, cancel := context.WithCancel(context.Background())
+		t.cancelFn = cancel
+		go t.sweepHandshakes(ctx)
+	}
+	return t
+}
+
+func (t *TCPHealthMetrics) Init(metricName string) {
+	switch metricName {
+	case utils.TCPHandshakeFailuresName:
+		t.tcpHealthMetrics = exporter.CreatePrometheusGaugeVecForMetric(
+			exporter.AdvancedRegistry,
+			TCPHandshakeFailuresCountName,
+			TCPHandshakeFailuresCountDesc,
+			t.getLabels(utils.Reason)...,
+		)
+	case utils.TCPResetsName:
+		t.tcpHealthMetrics = exporter.CreatePrometheusGaugeVecForMetric(
+			exporter.AdvancedRegistry,
+			TCPResetsCountName,
+			TCPResetsCountDesc,
+			t.getLabels(utils.Side)...,
+		)
+	case utils.TCPZeroWindowName:
+		t.tcpHealthMetrics = exporter.CreatePrometheusGaugeVecForMetric(
+			exporter.AdvancedRegistry,
+			TCPZeroWindowCountName,
+			TCPZeroWindowCountDesc,
+			t.getLabels(utils.Direction)...,
+		)
+	default:
+		t.getLogger().Error("unknown metric name", zap.String("name", metricName))
+	}
+	t.metricName = metricName
+}
+
+func (t *TCPHealthMetrics) getLabels(first string) []string {
+	labels := []string{first}
+	if t.sourceCtx() != nil {
+		labels = append(labels, t.sourceCtx().getLabels()...)
+	}
+
+	if t.destinationCtx() != nil {
+		labels = append(labels, t.destinationCtx().getLabels()...)
+	}
+
+	return labels
+}
+
+func (t *TCPHealthMetrics) ProcessFlow(flow *v1.Flow) {
+	if flow == nil || flow.Verdict != v1.Verdict_FORWARDED {
+		return
+	}
+
+	tcp := flow.GetL4().GetTCP()
+	if tcp == nil {
+		return
+	}
+
+	switch t.metricName {
+	case utils.TCPHandshakeFailuresName:
+		t.processHandshake(flow, tcp)
+	case utils.TCPResetsName:
+		if tcp.GetFlags().GetRST() {
+			t.count(t.contextValues(flow), resetSide(flow))
+		}
+	case utils.TCPZeroWindowName:
+		if utils.IsTCPZeroWindow(flow) {
+			t.count(t.contextValues(flow), "")
+		}
+	}
+}
+
+// processHandshake tracks the connection attempts from their SYN, and counts the ones which are reset by the
+// server or not answered by a SYN-ACK within the handshake timeout.
+func (t *TCPHealthMetrics) processHandshake(flow *v1.Flow, tcp *v1.TCP) {
+	flags := tcp.GetFlags()
+	now := t.handshakes.now()
+	src := net.JoinHostPort(flow.GetIP().GetSource(), strconv.Itoa(int(tcp.GetSourcePort())))
+	dst := net.JoinHostPort(flow.GetIP().GetDestination(), strconv.Itoa(int(tcp.GetDestinationPort())))
+	// connection attempts are keyed by client and server address, packets from the server match the reverse key.
+	key, reverseKey := src+"-"+dst, dst+"-"+src
+
+	var failed map[string][]string
+	t.handshakes.Lock()
+	switch {
+	case flags.GetSYN() && !flags.GetACK():
+		// retransmitted SYNs keep the time of the first one.
+		if _, ok := t.handshakes.entries[key]; !ok {
+			t.handshakes.add(key, &handshake{started: now, values: t.contextValues(flow)})
+		}
+	case flags.GetSYN() && flags.GetACK():
+		delete(t.handshakes.entries, reverseKey)
+	case flags.GetRST():
+		if h, ok := t.handshakes.entries[reverseKey]; ok {
+			failed = h.values
+			delete(t.handshakes.entries, reverseKey)
+		}
+		// the client aborted the connection attempt.
+		delete(t.handshakes.entries, key)
+	}
+	timedOut := t.handshakes.sweep(now, handshakeTimedOut(now))
+	t.handshakes.Unlock()
+
+	if failed != nil {
+		t.count(failed, handshakeResetReason)
+	}
+	for _, h := range timedOut {
+		t.count(h.values, handshakeTimeoutReason)
+	}
+}
+
+// sweepHandshakes counts the timed out handshakes every handshakeSweepInterval until the context is done.
+func (t *TCPHealthMetrics) sweepHandshakes(ctx context.Context) {
+	ticker := time.NewTicker(handshakeSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.countTimedOutHandshakes()
+		}
+	}
+}
+
+// countTimedOutHandshakes counts the connection attempts not answered within the handshake timeout.
+func (t *TCPHealthMetrics) countTimedOutHandshakes() {
+	now := t.handshakes.now()
+	t.handshakes.Lock()
+	timedOut := t.handshakes.sweep(now, handshakeTimedOut(now))
+	t.handshakes.Unlock()
+
+	for _, h := range timedOut {
+		t.count(h.values, handshakeTimeoutReason)
+	}
+}
+
+func handshakeTimedOut(now time.Time) func(h *handshake) bool {
+	return func(h *handshake) bool {
+		return now.Sub(h.started) >= handshakeTimeout
+	}
+}
+
+// resetSide returns the side of the connection sending the reset of the flow.
+func resetSide(flow *v1.Flow) string {
+	if flow.GetIsReply() == nil {
+		return unknownSide
+	}
+	if flow.GetIsReply().GetValue() {
+		return serverSide
+	}
+	return clientSide
+}
+
+// count increments the metric for the context label values, with the first label set to first,
+// or to the direction if first is empty.
+func (t *TCPHealthMetrics) count(values map[string][]string, first string) {
+	for direction, v := range values {
+		if t.isLocalContext() && len(v) == 0 {
+			continue
+		}
+		label := first
+		if label == "" {
+			label = direction
+		}
+		labels := append([]string{label}, v...)
+		t.update(labels)
+		t.getLogger().Debug("TCP health metric", zap.String("metric", t.metricName), zap.Strings("labels", labels))
+	}
+}
+
+func (t *TCPHealthMetrics) expire(labels []string) bool {
+	var d bool
+	if t.tcpHealthMetrics != nil {
+		d = t.tcpHealthMetrics.DeleteLabelValues(labels...)
+		if d {
+			metricsinit.MetricsExpiredCounter.WithLabelValues(t.metricName).Inc()
+		}
+	}
+	return d
+}
+
+func (t *TCPHealthMetrics) update(labels []string) {
+	if labels = t.admit(labels); labels == nil {
+		return
+	}
+	t.tcpHealthMetrics.WithLabelValues(labels...).Inc()
+	t.updated(labels)
+}
+
+func (t *TCPHealthMetrics) Clean() {
+	if t.cancelFn != nil {
+		t.cancelFn()
+	}
+	exporter.UnregisterMetric(exporter.AdvancedRegistry, metricsinit.ToPrometheusType(t.tcpHealthMetrics))
+	t.clean()
+	t.handshakes.reset()
+}
@@ -0,0 +1,125 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package metrics
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	api "github.com/microsoft/retina/crd/api/v1alpha1"
+	"github.com/microsoft/retina/pkg/exporter"
+	"github.com/microsoft/retina/pkg/log"
+	metricsinit "github.com/microsoft/retina/pkg/metrics"
+	"github.com/microsoft/retina/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func tcpHealthFlow(l *log.ZapLogger, src, dst string, srcPort, dstPort uint32, syn, ack, rst uint16) *flow.Flow {
+	f := utils.ToFlow(l, time.Now().UnixNano(), net.ParseIP(src), net.ParseIP(dst), srcPort, dstPort, 6, 1, flow.Verdict_FORWARDED)
+	utils.AddTCPFlags(f, syn, ack, 0, rst, 0, 0, 0, 0, 0)
+	f.Source = &flow.Endpoint{PodName: "pod-" + src}
+	f.Destination = &flow.Endpoint{PodName: "pod-" + dst}
+	return f
+}
+
+func TestTCPHealthMetrics(t *testing.T) {
+	l, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+
+	newMetric := func(t *testing.T, name string) *TCPHealthMetrics {
+		exporter.ResetAdvancedMetricsRegistry()
+		th := NewTCPHealthMetrics(&api.MetricsContextOptions{
+			MetricName:        name,
+			SourceLabels:      []string{"podname"},
+			DestinationLabels: []string{"podname"},
+		}, l, remoteContext, 0)
+		require.NotNil(t, th)
+		th.Init(name)
+		t.Cleanup(th.Clean)
+		return th
+	}
+	value := func(th *TCPHealthMetrics, labels ...string) float64 {
+		return testutil.ToFloat64(th.tcpHealthMetrics.WithLabelValues(labels...))
+	}
+
+	t.Run("not a health metric", func(t *testing.T) {
+		assert.Nil(t, NewTCPHealthMetrics(&api.MetricsContextOptions{MetricName: utils.TCPRetransCount}, l, remoteContext, 0))
+	})
+
+	t.Run("handshake failures", func(t *testing.T) {
+		th := newMetric(t, utils.TCPHandshakeFailuresName)
+		assert.Equal(t, []string{"reason", "source_podname", "destination_podname"}, th.getLabels(utils.Reason))
+		now := time.Now()
+		th.handshakes.now = func() time.Time { return now }
+
+		// completed handshake
+		th.ProcessFlow(tcpHealthFlow(l, "10.0.0.1", "10.0.0.9", 40000, 80, 1, 0, 0))
+		th.ProcessFlow(tcpHealthFlow(l, "10.0.0.9", "10.0.0.1", 80, 40000, 1, 1, 0))
+		// SYN answered by RST
+		th.ProcessFlow(tcpHealthFlow(l, "10.0.0.2", "10.0.0.9", 40000, 81, 1, 0, 0))
+		th.ProcessFlow(tcpHealthFlow(l, "10.0.0.9", "10.0.0.2", 81, 40000, 0, 1, 1))
+		// SYN retransmitted without answer
+		th.ProcessFlow(tcpHealthFlow(l, "10.0.0.3", "10.0.0.9", 40000, 80, 1, 0, 0))
+		now = now.Add(5 * time.Second)
+		th.ProcessFlow(tcpHealthFlow(l, "10.0.0.3", "10.0.0.9", 40000, 80, 1, 0, 0))
+
+		assert.Equal(t, 1, testutil.CollectAndCount(metricsinit.ToPrometheusType(th.tcpHealthMetrics)))
+		assert.InDelta(t, 1, value(th, "reset", "pod-10.0.0.2", "pod-10.0.0.9"), 0)
+
+		now = now.Add(handshakeTimeout)
+		th.ProcessFlow(tcpHealthFlow(l, "10.0.0.4", "10.0.0.9", 40000, 80, 0, 1, 0))
+		assert.Equal(t, 2, testutil.CollectAndCount(metricsinit.ToPrometheusType(th.tcpHealthMetrics)))
+		assert.InDelta(t, 1, value(th, "timeout", "pod-10.0.0.3", "pod-10.0.0.9"), 0)
+		assert.Empty(t, th.handshakes.entries)
+	})
+
+	t.Run("handshake timeout without new flows", func(t *testing.T) {
+		th := newMetric(t, utils.TCPHandshakeFailuresName)
+		now := time.Now()
+		th.handshakes.now = func() time.Time { return now }
+
+		th.ProcessFlow(tcpHealthFlow(l, "10.0.0.1", "10.0.0.9", 40000, 80, 1, 0, 0))
+		th.countTimedOutHandshakes()
+		assert.Equal(t, 0, testutil.CollectAndCount(metricsinit.ToPrometheusType(th.tcpHealthMetrics)))
+
+		now = now.Add(handshakeTimeout)
+		th.countTimedOutHandshakes()
+		assert.InDelta(t, 1, value(th, "timeout", "pod-10.0.0.1", "pod-10.0.0.9"), 0)
+		assert.Empty(t, th.handshakes.entries)
+	})
+
+	t.Run("resets by side", func(t *testing.T) {
+		th := newMetric(t, utils.TCPResetsName)
+		th.ProcessFlow(tcpHealthFlow(l, "10.0.0.1", "10.0.0.9", 40000, 80, 0, 1, 1))
+		reply := tcpHealthFlow(l, "10.0.0.9", "10.0.0.1", 80, 40000, 0, 1, 1)
+		reply.IsReply = &wrapperspb.BoolValue{Value: true}
+		th.ProcessFlow(reply)
+		unknown := tcpHealthFlow(l, "10.0.0.9", "10.0.0.1", 80, 40000, 0, 0, 1)
+		unknown.IsReply = nil
+		th.ProcessFlow(unknown)
+		th.ProcessFlow(tcpHealthFlow(l, "10.0.0.1", "10.0.0.9", 40000, 80, 0, 1, 0))
+
+		assert.InDelta(t, 1, value(th, "client", "pod-10.0.0.1", "pod-10.0.0.9"), 0)
+		assert.InDelta(t, 1, value(th, "server", "pod-10.0.0.9", "pod-10.0.0.1"), 0)
+		assert.InDelta(t, 1, value(th, "unknown", "pod-10.0.0.9", "pod-10.0.0.1"), 0)
+	})
+
+	t.Run("zero windows", func(t *testing.T) {
+		th := newMetric(t, utils.TCPZeroWindowName)
+		f := tcpHealthFlow(l, "10.0.0.1", "10.0.0.9", 40000, 80, 0, 1, 0)
+		th.ProcessFlow(f)
+		ext := utils.NewExtensions()
+		utils.AddTCPZeroWindow(ext)
+		utils.SetExtensions(f, ext)
+		th.ProcessFlow(f)
+		th.ProcessFlow(f)
+
+		assert.Equal(t, 1, testutil.CollectAndCount(metricsinit.ToPrometheusType(th.tcpHealthMetrics)))
+		assert.InDelta(t, 2, value(th, "INGRESS", "pod-10.0.0.1", "pod-10.0.0.9"), 0)
+	})
+}
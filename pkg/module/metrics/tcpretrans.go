@@ -131,6 +131,9 @@ func (t *TCPRetransMetrics) expire(labels []string) bool {
 }
 
 func (t *TCPRetransMetrics) update(labels []string) {
+	if labels = t.admit(labels); labels == nil {
+		return
+	}
 	t.tcpRetransMetrics.WithLabelValues(labels...).Inc()
 	t.updated(labels)
 }
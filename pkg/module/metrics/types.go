@@ -99,6 +99,12 @@ type ContextOptions struct {
 	Service   bool
 	Port      bool
 	Zone      bool
+	// aggregated rolls flows up to workloads and Services: ReplicaSets of Deployments are labeled with the
+	// Deployment, and Services with their namespace
+	aggregated bool
+	// mask returns the context options selected for the pod of an endpoint by its annotations, nil to keep the values
+	// of all the labels
+	mask func(ep *flow.Endpoint) *ContextOptions
 }
 
 type DirtyCachePod struct {
@@ -141,6 +147,18 @@ func NewCtxOption(opts []string, option ctxOptionType) *ContextOptions {
 	return c
 }
 
+// newAggregatedCtxOption returns the context options rolling flows up to the namespace and workload of the endpoint,
+// or to the namespace and name of the destination Service with the Service aggregation.
+func newAggregatedCtxOption(aggregation string, option ctxOptionType) *ContextOptions {
+	opts := []string{namespaceCtxOption, workloadCtxOption}
+	if aggregation == api.AggregationService && option == destination {
+		opts = []string{namespaceCtxOption, serviceCtxOption}
+	}
+	c := NewCtxOption(opts, option)
+	c.aggregated = true
+	return c
+}
+
 func (c *ContextOptions) getLabels() []string {
 	// Note: order of append here of labels should match the order of values
 	prefix := ""
@@ -253,14 +271,19 @@ func (c *ContextOptions) getByDirectionValues(f *flow.Flow, dest bool) []string
 	}
 
 	ep := f.Source
+	svc := f.SourceService
 	if dest {
 		ep = f.Destination
+		svc = f.DestinationService
 	}
 
 	if c.Namespace {
-		if ep != nil {
+		switch {
+		case ep != nil:
 			values = append(values, ep.Namespace)
-		} else {
+		case c.aggregated && svc != nil:
+			values = append(values, svc.Namespace)
+		default:
 			values = append(values, "unknown")
 		}
 	}
@@ -275,10 +298,14 @@ func (c *ContextOptions) getByDirectionValues(f *flow.Flow, dest bool) []string
 
 	if c.Workload {
 		wk := ep.GetWorkloads()
-		if len(wk) > 0 {
-			values = append(values, wk[0].Kind, wk[0].Name)
-		} else {
+		switch {
+		case len(wk) == 0:
 			values = append(values, "unknown", "unknown")
+		case c.aggregated:
+			kind, name := utils.TopLevelWorkload(ep)
+			values = append(values, kind, name)
+		default:
+			values = append(values, wk[0].Kind, wk[0].Name)
 		}
 	}
 
@@ -314,6 +341,9 @@ func (c *ContextOptions) getByDirectionValues(f *flow.Flow, dest bool) []string
 				} else {
 					values = append(values, fmt.Sprintf("%d", udp.GetSourcePort()))
 				}
+			} else {
+				// e.g. ICMP flows have no port
+				values = append(values, "unknown")
 			}
 		} else {
 			values = append(values, "unknown")
@@ -328,9 +358,56 @@ func (c *ContextOptions) getByDirectionValues(f *flow.Flow, dest bool) []string
 		}
 	}
 
+	return c.applyMask(ep, values)
+}
+
+// applyMask empties the values of the labels which are not selected for the endpoint by the mask.
+func (c *ContextOptions) applyMask(ep *flow.Endpoint, values []string) []string {
+	if c.mask == nil {
+		return values
+	}
+	selected := c.mask(ep)
+	if selected == nil {
+		return values
+	}
+
+	kept := make([]bool, 0, len(values))
+	keep := func(enabled, isSelected bool, n int) {
+		for i := 0; enabled && i < n; i++ {
+			kept = append(kept, isSelected)
+		}
+	}
+	keep(c.IP, selected.IP, 1)
+	keep(c.Namespace, selected.Namespace, 1)
+	keep(c.Podname, selected.Podname, 1)
+	keep(c.Workload, selected.Workload, 2)
+	keep(c.Service, selected.Service, 1)
+	keep(c.Port, selected.Port, 1)
+	keep(c.Zone, selected.Zone, 1)
+
+	for i := range values {
+		// the values are expected to match the labels, a value without a label is not selected.
+		if i >= len(kept) || !kept[i] {
+			values[i] = ""
+		}
+	}
 	return values
 }
 
+// union returns the context options selected by either of the context options.
+func (c *ContextOptions) union(o *ContextOptions) *ContextOptions {
+	return &ContextOptions{
+		option:    c.option,
+		IP:        c.IP || o.IP,
+		Namespace: c.Namespace || o.Namespace,
+		Podname:   c.Podname || o.Podname,
+		Workload:  c.Workload || o.Workload,
+		Service:   c.Service || o.Service,
+		Port:      c.Port || o.Port,
+		Zone:      c.Zone || o.Zone,
+	}
+}
+
 // DefaultCtxOptions used for enableAnnotations where it sets the source and destination labels
 // so users will not have to manually define.
 func DefaultCtxOptions() []string {
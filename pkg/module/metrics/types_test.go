@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/cilium/cilium/api/v1/flow"
+	api "github.com/microsoft/retina/crd/api/v1alpha1"
 	"github.com/microsoft/retina/pkg/utils"
 	"github.com/stretchr/testify/assert"
 )
@@ -177,3 +178,37 @@ func flowWithZones(srcZone, dstZone string) *flow.Flow {
 	utils.SetExtensions(f, ext)
 	return f
 }
+
+func TestAggregatedCtxOptions(t *testing.T) {
+	f := &flow.Flow{
+		Source: &flow.Endpoint{
+			Namespace: "shop",
+			PodName:   "frontend-7d9f8c6b5-x2x4z",
+			Labels:    []string{"app=frontend", "pod-template-hash=7d9f8c6b5"},
+			Workloads: []*flow.Workload{{Kind: "ReplicaSet", Name: "frontend-7d9f8c6b5"}},
+		},
+		Destination: &flow.Endpoint{
+			Namespace: "shop",
+			PodName:   "db-0",
+			Workloads: []*flow.Workload{{Kind: "StatefulSet", Name: "db"}},
+		},
+		DestinationService: &flow.Service{Namespace: "shop", Name: "db"},
+	}
+
+	src := newAggregatedCtxOption(api.AggregationWorkload, source)
+	assert.Equal(t, []string{"source_namespace", "source_workload_kind", "source_workload_name"}, src.getLabels())
+	assert.Equal(t, []string{"shop", "Deployment", "frontend"}, src.getValues(f))
+
+	dst := newAggregatedCtxOption(api.AggregationWorkload, destination)
+	assert.Equal(t, []string{"shop", "StatefulSet", "db"}, dst.getValues(f))
+
+	// The destination of a flow to a cluster IP is only known as a Service.
+	f.Destination = nil
+	dst = newAggregatedCtxOption(api.AggregationService, destination)
+	assert.Equal(t, []string{"destination_namespace", "destination_service"}, dst.getLabels())
+	assert.Equal(t, []string{"shop", "db"}, dst.getValues(f))
+
+	// ReplicaSets which are not created by a Deployment are kept.
+	f.Source.Labels = []string{"app=frontend"}
+	assert.Equal(t, []string{"shop", "ReplicaSet", "frontend-7d9f8c6b5"}, src.getValues(f))
+}
@@ -0,0 +1,137 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package metrics
+
+import (
+	"strings"
+	"time"
+
+	v1 "github.com/cilium/cilium/api/v1/flow"
+	api "github.com/microsoft/retina/crd/api/v1alpha1"
+	"github.com/microsoft/retina/pkg/exporter"
+	"github.com/microsoft/retina/pkg/log"
+	metricsinit "github.com/microsoft/retina/pkg/metrics"
+	"github.com/microsoft/retina/pkg/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	ZoneTrafficCountName = "adv_zone_traffic_count"
+	ZoneTrafficBytesName = "adv_zone_traffic_bytes"
+
+	ZoneTrafficCountDesc = "Total number of forwarded packets by source and destination zone"
+	ZoneTrafficBytesDesc = "Total number of forwarded bytes by source and destination zone"
+)
+
+// ZoneTrafficMetrics counts the forwarded traffic between zones, by the namespace and workload of the source and
+// destination. The source and destination labels of the context options are not used.
+type ZoneTrafficMetrics struct {
+	baseMetricInterface
+	zoneMetric    metricsinit.GaugeVec
+	srcCtx        *ContextOptions
+	dstCtx        *ContextOptions
+	crossZoneOnly bool
+	metricName    string
+}
+
+func NewZoneTrafficMetrics(ctxOptions *api.MetricsContextOptions, fl *log.ZapLogger, isLocalContext enrichmentContext, ttl time.Duration) *ZoneTrafficMetrics {
+	if ctxOptions == nil || !strings.Contains(strings.ToLower(ctxOptions.MetricName), zoneTraffic) {
+		return nil
+	}
+
+	l := fl.Named("zone-metricsmodule")
+	l.Info("Creating zone traffic metrics", zap.Any("options", ctxOptions))
+	z := &ZoneTrafficMetrics{
+		srcCtx:        newZoneCtxOption(source),
+		dstCtx:        newZoneCtxOption(destination),
+		crossZoneOnly: ctxOptions.CrossZoneOnly,
+	}
+	z.baseMetricInterface = newBaseMetricsObject(ctxOptions, fl, isLocalContext, z.expire, ttl)
+	return z
+}
+
+// newZoneCtxOption returns the context options of the zone, namespace and workload of an endpoint.
+func newZoneCtxOption(option ctxOptionType) *ContextOptions {
+	c := NewCtxOption([]string{zoneCtxOption, namespaceCtxOption, workloadCtxOption}, option)
+	c.aggregated = true
+	return c
+}
+
+func (z *ZoneTrafficMetrics) Init(metricName string) {
+	switch metricName {
+	case utils.ZoneTrafficCountName:
+		z.zoneMetric = exporter.CreatePrometheusGaugeVecForMetric(
+			exporter.AdvancedRegistry,
+			ZoneTrafficCountName,
+			ZoneTrafficCountDesc,
+			z.getLabels()...)
+	case utils.ZoneTrafficBytesName:
+		z.zoneMetric = exporter.CreatePrometheusGaugeVecForMetric(
+			exporter.AdvancedRegistry,
+			ZoneTrafficBytesName,
+			ZoneTrafficBytesDesc,
+			z.getLabels()...)
+	default:
+		z.getLogger().Error("unknown metric name", zap.String("name", metricName))
+	}
+	z.metricName = metricName
+}
+
+func (z *ZoneTrafficMetrics) getLabels() []string {
+	labels := []string{utils.Direction}
+	labels = append(labels, z.srcCtx.getLabels()...)
+	return append(labels, z.dstCtx.getLabels()...)
+}
+
+func (z *ZoneTrafficMetrics) Clean() {
+	exporter.UnregisterMetric(exporter.AdvancedRegistry, metricsinit.ToPrometheusType(z.zoneMetric))
+	z.clean()
+}
+
+func (z *ZoneTrafficMetrics) ProcessFlow(flow *v1.Flow) {
+	if flow == nil || flow.Verdict != v1.Verdict_FORWARDED {
+		return
+	}
+
+	srcZone, dstZone := utils.SourceZone(flow), utils.DestinationZone(flow)
+	// traffic with an endpoint in an unknown zone cannot be attributed to a pair of zones.
+	if z.crossZoneOnly && (srcZone == "unknown" || dstZone == "unknown" || srcZone == dstZone) {
+		return
+	}
+
+	labels := []string{flow.TrafficDirection.String()}
+	labels = append(labels, z.srcCtx.getValues(flow)...)
+	labels = append(labels, z.dstCtx.getValues(flow)...)
+	z.update(flow, labels)
+	z.getLogger().Debug("zone traffic metric is added", zap.Any("labels", labels))
+}
+
+func (z *ZoneTrafficMetrics) expire(labels []string) bool {
+	var d bool
+	if z.zoneMetric != nil {
+		d = z.zoneMetric.DeleteLabelValues(labels...)
+		if d {
+			metricsinit.MetricsExpiredCounter.WithLabelValues(z.metricName).Inc()
+		}
+	}
+	return d
+}
+
+func (z *ZoneTrafficMetrics) update(fl *v1.Flow, labels []string) {
+	if labels = z.admit(labels); labels == nil {
+		return
+	}
+	var updated bool
+	switch z.metricName {
+	case utils.ZoneTrafficCountName:
+		updated = true
+		z.zoneMetric.WithLabelValues(labels...).Add(float64(utils.PreviouslyObservedPackets(fl) + 1))
+	case utils.ZoneTrafficBytesName:
+		updated = true
+		z.zoneMetric.WithLabelValues(labels...).Add(float64(utils.PacketSize(fl) + utils.PreviouslyObservedBytes(fl)))
+	}
+	if updated {
+		z.updated(labels)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package metrics
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	v1 "github.com/cilium/cilium/pkg/hubble/api/v1"
+	api "github.com/microsoft/retina/crd/api/v1alpha1"
+	"github.com/microsoft/retina/pkg/common"
+	"github.com/microsoft/retina/pkg/controllers/cache"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/exporter"
+	"github.com/microsoft/retina/pkg/log"
+	metricsinit "github.com/microsoft/retina/pkg/metrics"
+	"github.com/microsoft/retina/pkg/pubsub"
+	"github.com/microsoft/retina/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func zoneTestEndpoint(name, podIP, nodeIP string) *common.RetinaEndpoint {
+	ep := common.RetinaEndpointCommonFromAPI(&api.RetinaEndpoint{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "shop"},
+		Spec: api.RetinaEndpointSpec{
+			NodeIP:          nodeIP,
+			OwnerReferences: []api.OwnerReference{{Kind: "StatefulSet", Name: name}},
+		},
+	})
+	ep.SetIPs(&common.IPAddresses{IPv4: net.ParseIP(podIP)})
+	return ep
+}
+
+func TestZoneTrafficMetrics(t *testing.T) {
+	l, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+
+	// frontend and cache run in zone-1, db in zone-2.
+	c := cache.New(pubsub.New())
+	require.NoError(t, c.UpdateRetinaNode(common.NewRetinaNode("node-1", net.ParseIP("10.0.0.1"), "zone-1")))
+	require.NoError(t, c.UpdateRetinaNode(common.NewRetinaNode("node-2", net.ParseIP("10.0.0.2"), "zone-2")))
+	require.NoError(t, c.UpdateRetinaEndpoint(zoneTestEndpoint("frontend", "10.1.0.1", "10.0.0.1")))
+	require.NoError(t, c.UpdateRetinaEndpoint(zoneTestEndpoint("cache", "10.1.0.2", "10.0.0.1")))
+	require.NoError(t, c.UpdateRetinaEndpoint(zoneTestEndpoint("db", "10.2.0.1", "10.0.0.2")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e := enricher.NewStandalone(ctx, c)
+
+	newFlow := func(src, dst string, size uint32) *flow.Flow {
+		f := utils.ToFlow(l, time.Now().UnixNano(), net.ParseIP(src), net.ParseIP(dst), 443, 8080, 6, 1, flow.Verdict_FORWARDED)
+		ext := utils.NewExtensions()
+		utils.AddPacketSize(ext, size)
+		utils.SetExtensions(f, ext)
+		require.True(t, e.Enrich(&v1.Event{Event: f}))
+		return f
+	}
+
+	crossZone := []string{"INGRESS", "shop", "StatefulSet", "frontend", "zone-1", "shop", "StatefulSet", "db", "zone-2"}
+	sameZone := []string{"INGRESS", "shop", "StatefulSet", "frontend", "zone-1", "shop", "StatefulSet", "cache", "zone-1"}
+	external := []string{"INGRESS", "shop", "StatefulSet", "frontend", "zone-1", "unknown", "unknown", "unknown", "unknown"}
+
+	tests := []struct {
+		name          string
+		metricName    string
+		crossZoneOnly bool
+		want          map[string]float64
+	}{
+		{
+			name:       "bytes of all pairs",
+			metricName: utils.ZoneTrafficBytesName,
+			want:       map[string]float64{"cross": 300, "same": 50, "external": 10},
+		},
+		{
+			name:          "packets of cross zone pairs",
+			metricName:    utils.ZoneTrafficCountName,
+			crossZoneOnly: true,
+			want:          map[string]float64{"cross": 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter.ResetAdvancedMetricsRegistry()
+			z := NewZoneTrafficMetrics(&api.MetricsContextOptions{MetricName: tt.metricName, CrossZoneOnly: tt.crossZoneOnly}, l, remoteContext, 0)
+			require.NotNil(t, z)
+			z.Init(tt.metricName)
+			defer z.Clean()
+
+			assert.Equal(t, []string{
+				"direction",
+				"source_namespace", "source_workload_kind", "source_workload_name", "source_zone",
+				"destination_namespace", "destination_workload_kind", "destination_workload_name", "destination_zone",
+			}, z.getLabels())
+
+			z.ProcessFlow(newFlow("10.1.0.1", "10.2.0.1", 100))
+			z.ProcessFlow(newFlow("10.1.0.1", "10.2.0.1", 200))
+			z.ProcessFlow(newFlow("10.1.0.1", "10.1.0.2", 50))
+			z.ProcessFlow(newFlow("10.1.0.1", "8.8.8.8", 10))
+
+			series := map[string][]string{"cross": crossZone, "same": sameZone, "external": external}
+			assert.Equal(t, len(tt.want), testutil.CollectAndCount(metricsinit.ToPrometheusType(z.zoneMetric)))
+			for name, want := range tt.want {
+				assert.InDelta(t, want, testutil.ToFloat64(z.zoneMetric.WithLabelValues(series[name]...)), 0, name)
+			}
+		})
+	}
+}
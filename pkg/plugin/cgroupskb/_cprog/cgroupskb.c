@@ -0,0 +1,68 @@
+//go:build ignore
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+// cgroup_skb programs attached to the cgroups of the pods, counting the packets and bytes of the cgroups of their
+// sockets. The cgroup is the one of the container, the programs being attached to the cgroup of its pod. The programs
+// only read the length of the packets from struct __sk_buff, whose layout is stable.
+
+#include "vmlinux.h"
+#include "bpf_helpers.h"
+#include "cgroupskb.h"
+
+char __license[] SEC("license") = "Dual MIT/GPL";
+
+// Needed by bpf2go's -type flag to generate the Go struct.
+const struct counter_value *unused_counter_value __attribute__((unused));
+
+struct
+{
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __type(key, __u64);
+    __type(value, struct counter_value);
+    __uint(max_entries, COUNTERS_MAX_ENTRIES);
+} retina_cgskb_cnt SEC(".maps");
+
+// counters returns the counters of the cgroup of the socket of the packet, inserted if they do not exist, or NULL
+// without a full socket.
+static __always_inline struct counter_value *counters(struct __sk_buff *skb)
+{
+    // the cgroup v2 ID of the socket, 0 without a full socket
+    __u64 cgroup_id = bpf_skb_cgroup_id(skb);
+    if (!cgroup_id)
+        return NULL;
+
+    struct counter_value *value = bpf_map_lookup_elem(&retina_cgskb_cnt, &cgroup_id);
+    if (!value)
+    {
+        struct counter_value init = {};
+        bpf_map_update_elem(&retina_cgskb_cnt, &cgroup_id, &init, BPF_NOEXIST);
+        value = bpf_map_lookup_elem(&retina_cgskb_cnt, &cgroup_id);
+    }
+    return value;
+}
+
+SEC("cgroup_skb/ingress")
+int retina_cgskb_ingress(struct __sk_buff *skb)
+{
+    struct counter_value *value = counters(skb);
+    if (value)
+    {
+        __sync_fetch_and_add(&value->ingress_packets, 1);
+        __sync_fetch_and_add(&value->ingress_bytes, skb->len);
+    }
+    return SK_PASS;
+}
+
+SEC("cgroup_skb/egress")
+int retina_cgskb_egress(struct __sk_buff *skb)
+{
+    struct counter_value *value = counters(skb);
+    if (value)
+    {
+        __sync_fetch_and_add(&value->egress_packets, 1);
+        __sync_fetch_and_add(&value->egress_bytes, skb->len);
+    }
+    return SK_PASS;
+}
@@ -0,0 +1,19 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+#include "vmlinux.h"
+
+// Number of cgroups tracked, the entries of the cgroups which are gone are deleted by the plugin.
+#define COUNTERS_MAX_ENTRIES 16384
+
+// Verdict letting the packet through, the programs only count.
+#define SK_PASS 1
+
+// Counters of the packets and bytes of a cgroup.
+struct counter_value
+{
+    __u64 ingress_packets;
+    __u64 ingress_bytes;
+    __u64 egress_packets;
+    __u64 egress_bytes;
+};
@@ -0,0 +1,302 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package cgroupskb
+
+import (
+	"io"
+	"io/fs"
+	"math"
+	"net"
+	"path/filepath"
+	"time"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+	plugincommon "github.com/microsoft/retina/pkg/plugin/common"
+	"github.com/microsoft/retina/pkg/utils"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// maxFlowPackets and maxFlowBytes are the most packets and bytes a flow carries, as the forward metrics read them
+	// from uint32 extensions: the packets are the previously observed packets + 1, and the bytes the previously
+	// observed bytes, since the flows have no packet size of their own.
+	maxFlowPackets = math.MaxUint32 + 1
+	maxFlowBytes   = math.MaxUint32
+)
+
+var errNoCgroup2 = errors.New("cgroup v2 is not mounted")
+
+// ebpfCounterMap reads the counters from the eBPF map.
+type ebpfCounterMap struct {
+	m *ebpf.Map
+}
+
+func (e *ebpfCounterMap) Counters() (map[uint64]counterValue, error) {
+	var (
+		k uint64
+		v counterValue
+	)
+	counters := make(map[uint64]counterValue)
+	iter := e.m.Iterate()
+	for iter.Next(&k, &v) {
+		counters[k] = v
+	}
+	if err := iter.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to iterate cgroup counters")
+	}
+	return counters, nil
+}
+
+func (e *ebpfCounterMap) Delete(cgroupID uint64) error {
+	return e.m.Delete(cgroupID) //nolint:wrapcheck // wrapped by the caller
+}
+
+// attachPrograms returns the attachFunc of the ingress and egress programs of coll.
+func attachPrograms(coll *ebpf.Collection) attachFunc {
+	return func(path string) ([]io.Closer, error) {
+		links := make([]io.Closer, 0, 2) //nolint:gomnd // ingress and egress
+		for _, a := range []struct {
+			program string
+			attach  ebpf.AttachType
+		}{
+			{cgroupskbProgRetinaCgskbIngress, ebpf.AttachCGroupInetIngress},
+			{cgroupskbProgRetinaCgskbEgress, ebpf.AttachCGroupInetEgress},
+		} {
+			l, err := link.AttachCgroup(link.CgroupOptions{Path: path, Attach: a.attach, Program: coll.Programs[a.program]})
+			if err != nil {
+				for _, l := range links {
+					l.Close()
+				}
+				return nil, errors.Wrapf(err, "failed to attach %s", a.program)
+			}
+			links = append(links, l)
+		}
+		return links, nil
+	}
+}
+
+// findCgroup2Root returns the root of the cgroup v2 hierarchy mounted at root, or at root/unified on the hosts in the
+// hybrid mode of systemd.
+func findCgroup2Root(root string) (string, error) {
+	for _, path := range []string{root, filepath.Join(root, "unified")} {
+		var st unix.Statfs_t
+		if err := unix.Statfs(path, &st); err == nil && st.Type == unix.CGROUP2_SUPER_MAGIC {
+			return path, nil
+		}
+	}
+	return "", errors.Wrapf(errNoCgroup2, "in %s", root)
+}
+
+// PodAccountant attaches the programs to the cgroups of the pods, and turns their counters into flows.
+type PodAccountant struct {
+	l          *log.ZapLogger
+	enricher   enricher.EnricherInterface
+	counters   counterMap
+	attach     attachFunc
+	cgroupRoot string
+
+	// pods are the pods whose cgroups have the programs attached, by key (namespace/name)
+	pods map[string]*podCgroup
+}
+
+// NewPodAccountant creates an accountant of the pods in the cache of the enricher, including the pods in the host
+// network, whose cgroups are found in the cgroup v2 hierarchy at cgroupRoot from the IDs of their containers.
+func NewPodAccountant(e enricher.EnricherInterface, counters counterMap, attach attachFunc, cgroupRoot string) *PodAccountant {
+	return &PodAccountant{
+		l:          log.Logger().Named(string("PodAccountant")),
+		enricher:   e,
+		counters:   counters,
+		attach:     attach,
+		cgroupRoot: cgroupRoot,
+		pods:       make(map[string]*podCgroup),
+	}
+}
+
+// reconcile attaches the programs to the cgroups of the new pods, and detaches them from the cgroups of the pods
+// which are gone.
+func (pa *PodAccountant) reconcile() error {
+	byContainer := make(map[string]string)
+	endpoints := make(map[string]*flow.Endpoint)
+	for _, ep := range pa.enricher.Pods() {
+		for _, c := range ep.Containers() {
+			if id := plugincommon.ContainerID(c.ID); id != "" {
+				byContainer[id] = ep.Key()
+			}
+		}
+		endpoints[ep.Key()] = enricher.PodEndpoint(ep)
+	}
+
+	// The cgroup of a pod is the parent of the cgroups of its containers.
+	paths := make(map[string]string)
+	err := filepath.WalkDir(pa.cgroupRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// A cgroup may have been removed since the listing of its parent.
+			return nil
+		}
+		if !d.IsDir() || path == pa.cgroupRoot {
+			return nil
+		}
+		if key, ok := byContainer[plugincommon.CgroupContainerID(d.Name())]; ok {
+			paths[key] = filepath.Dir(path)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to walk cgroups in %s", pa.cgroupRoot)
+	}
+
+	for key, pod := range pa.pods {
+		if path, ok := paths[key]; !ok || path != pod.path {
+			pa.detach(key, pod)
+		}
+	}
+	for key, path := range paths {
+		pod, ok := pa.pods[key]
+		if !ok {
+			links, err := pa.attach(path)
+			if err != nil {
+				pa.l.Warn("Failed to attach to cgroup of pod", zap.String("pod", key), zap.String("cgroup", path), zap.Error(err))
+				continue
+			}
+			pod = &podCgroup{path: path, links: links, accounted: make(map[uint64]counterValue)}
+			pa.pods[key] = pod
+			pa.l.Debug("Attached to cgroup of pod", zap.String("pod", key), zap.String("cgroup", path))
+		}
+		pod.endpoint = endpoints[key]
+		pod.cgroupIDs = cgroupIDs(path)
+	}
+	return nil
+}
+
+// detach detaches the programs from the cgroup of a pod, and deletes its counters.
+func (pa *PodAccountant) detach(key string, pod *podCgroup) {
+	for _, l := range pod.links {
+		if err := l.Close(); err != nil {
+			pa.l.Debug("Error while detaching from cgroup of pod", zap.String("pod", key), zap.Error(err))
+		}
+	}
+	for id := range pod.cgroupIDs {
+		if err := pa.counters.Delete(id); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+			pa.l.Debug("Error while deleting counters of cgroup", zap.Uint64("cgroup", id), zap.Error(err))
+		}
+	}
+	delete(pa.pods, key)
+}
+
+// cgroupIDs returns the IDs of a cgroup and of its descendants, which are the inodes of their directories.
+func cgroupIDs(path string) map[uint64]struct{} {
+	ids := make(map[uint64]struct{})
+	_ = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		var st unix.Stat_t
+		if err := unix.Stat(p, &st); err == nil {
+			ids[st.Ino] = struct{}{}
+		}
+		return nil
+	})
+	return ids
+}
+
+// account reads the counters, and returns the flows of the packets counted since the last call. The counters of the
+// cgroups which are not of a pod are deleted.
+func (pa *PodAccountant) account(now time.Time) ([]*flow.Flow, error) {
+	counters, err := pa.counters.Counters()
+	if err != nil {
+		return nil, err
+	}
+
+	byCgroup := make(map[uint64]*podCgroup)
+	for _, pod := range pa.pods {
+		for id := range pod.cgroupIDs {
+			byCgroup[id] = pod
+		}
+	}
+
+	var flows []*flow.Flow
+	for id, v := range counters {
+		pod, ok := byCgroup[id]
+		if !ok {
+			// The cgroup is gone, or is not a pod's anymore, so its counters are deleted so that the map does not fill
+			// up. The cgroups created since the reconcile above lose the packets counted until the next one.
+			if err := pa.counters.Delete(id); err != nil {
+				pa.l.Debug("Error while deleting counters of cgroup", zap.Uint64("cgroup", id), zap.Error(err))
+			}
+			continue
+		}
+		prev := pod.accounted[id]
+		pod.accounted[id] = v
+		flows = append(flows, toFlows(pa.l, now, pod.endpoint, flow.TrafficDirection_INGRESS, v.IngressPackets-prev.IngressPackets, v.IngressBytes-prev.IngressBytes)...)
+		flows = append(flows, toFlows(pa.l, now, pod.endpoint, flow.TrafficDirection_EGRESS, v.EgressPackets-prev.EgressPackets, v.EgressBytes-prev.EgressBytes)...)
+	}
+
+	// The cgroups which are gone are not accounted anymore.
+	for _, pod := range pa.pods {
+		for id := range pod.accounted {
+			if _, ok := counters[id]; !ok {
+				delete(pod.accounted, id)
+			}
+		}
+	}
+	return flows, nil
+}
+
+// toFlows returns the forwarded flows of the packets of a pod in a direction. A flow carries the packets and bytes in
+// its extensions, and the traffic of an interval is split in several flows if they do not fit.
+func toFlows(l *log.ZapLogger, now time.Time, ep *flow.Endpoint, direction flow.TrafficDirection, packets, bytes uint64) []*flow.Flow {
+	if packets == 0 || ep == nil {
+		return nil
+	}
+	n := max((packets+maxFlowPackets-1)/maxFlowPackets, (bytes+maxFlowBytes-1)/maxFlowBytes, 1)
+	n = min(n, packets)
+
+	// The observation points of the veths of the pods, so that the flows have the direction of the pod.
+	observationPoint := uint8(0) // TO_STACK, egress
+	if direction == flow.TrafficDirection_INGRESS {
+		observationPoint = 1 // TO_ENDPOINT, ingress
+	}
+
+	flows := make([]*flow.Flow, 0, n)
+	for i := range n {
+		p, b := packets/n, bytes/n
+		if i == 0 {
+			p += packets % n
+			b += bytes % n
+		}
+		// The flows have no remote side, and the pods in the host network share the IP of the node, so the addresses
+		// are unspecified and the pod is set here, as the enricher keeps the endpoints of the addresses it does not
+		// know.
+		fl := utils.ToFlow(l, now.UnixNano(), net.IPv4zero, net.IPv4zero, 0, 0, 0, observationPoint, flow.Verdict_FORWARDED)
+		if fl == nil {
+			continue
+		}
+		if direction == flow.TrafficDirection_INGRESS {
+			fl.Destination = ep
+		} else {
+			fl.Source = ep
+		}
+
+		// The bytes of the interval are not the size of a packet, so that the packet size metric does not observe them.
+		ext := utils.NewExtensions()
+		utils.AddPreviouslyObservedPackets(ext, uint32(p-1)) //nolint:gosec // bounded by maxFlowPackets
+		utils.AddPreviouslyObservedBytes(ext, uint32(b))     //nolint:gosec // bounded by maxFlowBytes
+		utils.SetExtensions(fl, ext)
+		flows = append(flows, fl)
+	}
+	return flows
+}
+
+// close detaches the programs from the cgroups of all the pods.
+func (pa *PodAccountant) close() {
+	for key, pod := range pa.pods {
+		pa.detach(key, pod)
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package cgroupskb
+
+import (
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	api "github.com/microsoft/retina/crd/api/v1alpha1"
+	"github.com/microsoft/retina/pkg/common"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/exporter"
+	"github.com/microsoft/retina/pkg/log"
+	metricsmodule "github.com/microsoft/retina/pkg/module/metrics"
+	"github.com/microsoft/retina/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gomock "go.uber.org/mock/gomock"
+	"golang.org/x/sys/unix"
+)
+
+type fakeCounterMap struct {
+	counters map[uint64]counterValue
+	deleted  []uint64
+}
+
+func (f *fakeCounterMap) Counters() (map[uint64]counterValue, error) {
+	return f.counters, nil
+}
+
+func (f *fakeCounterMap) Delete(cgroupID uint64) error {
+	f.deleted = append(f.deleted, cgroupID)
+	delete(f.counters, cgroupID)
+	return nil
+}
+
+type fakeLink struct {
+	closed bool
+}
+
+func (f *fakeLink) Close() error {
+	f.closed = true
+	return nil
+}
+
+type fakeAttacher struct {
+	links map[string]*fakeLink
+}
+
+func (f *fakeAttacher) attach(path string) ([]io.Closer, error) {
+	l := &fakeLink{}
+	f.links[path] = l
+	return []io.Closer{l}, nil
+}
+
+func inode(t *testing.T, path string) uint64 {
+	t.Helper()
+	var st unix.Stat_t
+	require.NoError(t, unix.Stat(path, &st))
+	return st.Ino
+}
+
+func testPod(name string, containerIDs ...string) *common.RetinaEndpoint {
+	ep := common.NewRetinaEndpoint(name, "default", nil)
+	containers := make([]*common.RetinaContainer, 0, len(containerIDs))
+	for _, id := range containerIDs {
+		containers = append(containers, &common.RetinaContainer{Name: "c", ID: id})
+	}
+	ep.SetContainers(containers)
+	return ep
+}
+
+func TestAccount(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+
+	// the systemd and cgroupfs layouts of the cgroups of the pods
+	root := t.TempDir()
+	podA := filepath.Join(root, "kubepods.slice", "kubepods-pod1.slice")
+	ctrA := filepath.Join(podA, "cri-containerd-aaa.scope")
+	podB := filepath.Join(root, "kubepods", "besteffort", "pod2")
+	ctrB := filepath.Join(podB, "bbb")
+	for _, dir := range []string{ctrA, ctrB, filepath.Join(root, "system.slice", "other.scope")} {
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+	}
+
+	ctrl := gomock.NewController(t)
+	e := enricher.NewMockEnricherInterface(ctrl)
+	pods := []*common.RetinaEndpoint{
+		testPod("a", "containerd://aaa"),
+		testPod("b", "containerd://bbb"),
+		testPod("pending"),
+	}
+	e.EXPECT().Pods().DoAndReturn(func() []*common.RetinaEndpoint { return pods }).AnyTimes()
+
+	counters := &fakeCounterMap{counters: map[uint64]counterValue{
+		inode(t, ctrA): {IngressPackets: 2, IngressBytes: 200, EgressPackets: 1, EgressBytes: 50},
+		inode(t, ctrB): {EgressPackets: 3, EgressBytes: 300},
+		12345:          {IngressPackets: 1, IngressBytes: 1},
+	}}
+	attacher := &fakeAttacher{links: make(map[string]*fakeLink)}
+	pa := NewPodAccountant(e, counters, attacher.attach, root)
+
+	require.NoError(t, pa.reconcile())
+	require.Len(t, attacher.links, 2)
+	assert.Contains(t, attacher.links, podA)
+	assert.Contains(t, attacher.links, podB)
+
+	flows, err := pa.account(time.Now())
+	require.NoError(t, err)
+	// the counters of the unknown cgroup are deleted
+	assert.Equal(t, []uint64{12345}, counters.deleted)
+	byPod := func(flows []*flow.Flow) map[string][2]uint64 {
+		got := make(map[string][2]uint64)
+		for _, fl := range flows {
+			require.Equal(t, flow.Verdict_FORWARDED, fl.GetVerdict())
+			ep, dir := fl.GetSource(), "egress"
+			if fl.GetTraceObservationPoint() == flow.TraceObservationPoint_TO_ENDPOINT {
+				ep, dir = fl.GetDestination(), "ingress"
+			}
+			packets := uint64(utils.PreviouslyObservedPackets(fl)) + 1
+			bytes := uint64(utils.PacketSize(fl)) + uint64(utils.PreviouslyObservedBytes(fl))
+			k := ep.GetPodName() + "/" + dir
+			got[k] = [2]uint64{got[k][0] + packets, got[k][1] + bytes}
+		}
+		return got
+	}
+	assert.Equal(t, map[string][2]uint64{
+		"a/ingress": {2, 200},
+		"a/egress":  {1, 50},
+		"b/egress":  {3, 300},
+	}, byPod(flows))
+
+	// only the packets counted since the last call are sent
+	counters.counters[inode(t, ctrA)] = counterValue{IngressPackets: 5, IngressBytes: 500, EgressPackets: 1, EgressBytes: 50}
+	require.NoError(t, pa.reconcile())
+	flows, err = pa.account(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, map[string][2]uint64{"a/ingress": {3, 300}}, byPod(flows))
+
+	// the programs are detached from the pods which are gone, and their counters deleted
+	pods = pods[:1]
+	require.NoError(t, pa.reconcile())
+	assert.False(t, attacher.links[podA].closed)
+	assert.True(t, attacher.links[podB].closed)
+	assert.Contains(t, counters.deleted, inode(t, ctrB))
+
+	pa.close()
+	assert.True(t, attacher.links[podA].closed)
+	assert.Empty(t, pa.pods)
+}
+
+func TestToFlows(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	l := log.Logger().Named(name)
+	ep := &flow.Endpoint{Namespace: "default", PodName: "a"}
+
+	assert.Empty(t, toFlows(l, time.Now(), ep, flow.TrafficDirection_EGRESS, 0, 0))
+	assert.Empty(t, toFlows(l, time.Now(), nil, flow.TrafficDirection_EGRESS, 1, 100))
+
+	// the bytes which do not fit in the extensions of a flow are split in several flows
+	packets, bytes := uint64(10), uint64(5*math.MaxUint32)
+	flows := toFlows(l, time.Now(), ep, flow.TrafficDirection_INGRESS, packets, bytes)
+	require.Len(t, flows, 5)
+	var gotPackets, gotBytes uint64
+	for _, fl := range flows {
+		assert.Equal(t, ep, fl.GetDestination())
+		assert.Zero(t, utils.PacketSize(fl))
+		gotPackets += uint64(utils.PreviouslyObservedPackets(fl)) + 1
+		gotBytes += uint64(utils.PreviouslyObservedBytes(fl))
+	}
+	assert.Equal(t, packets, gotPackets)
+	assert.Equal(t, bytes, gotBytes)
+}
+
+func TestToFlowsMetrics(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	l := log.Logger().Named(name)
+	exporter.ResetAdvancedMetricsRegistry()
+
+	forward := metricsmodule.NewForwardCountMetrics(&api.MetricsContextOptions{
+		MetricName:        utils.ForwardBytesGaugeName,
+		DestinationLabels: []string{"podname"},
+	}, l, "remote", 0)
+	forward.Init(utils.ForwardBytesGaugeName)
+	t.Cleanup(forward.Clean)
+	sizes := metricsmodule.NewSizeMetrics(&api.MetricsContextOptions{
+		MetricName:        utils.PacketSizeName,
+		DestinationLabels: []string{"podname"},
+	}, l, "remote", 0)
+	sizes.Init(utils.PacketSizeName)
+	t.Cleanup(sizes.Clean)
+
+	// the bytes of an interval are forwarded bytes, not the size of a packet
+	ep := &flow.Endpoint{Namespace: "default", PodName: "a"}
+	for _, fl := range toFlows(l, time.Now(), ep, flow.TrafficDirection_INGRESS, 10, 15000) {
+		forward.ProcessFlow(fl)
+		sizes.ProcessFlow(fl)
+	}
+
+	n, err := testutil.GatherAndCount(exporter.AdvancedRegistry, "networkobservability_"+metricsmodule.PacketSizeBytesName)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	expected := `
+# HELP networkobservability_adv_forward_bytes Total number of forwarded bytes
+# TYPE networkobservability_adv_forward_bytes gauge
+networkobservability_adv_forward_bytes{destination_podname="a",direction="INGRESS"} 15000
+`
+	require.NoError(t, testutil.GatherAndCompare(exporter.AdvancedRegistry, strings.NewReader(expected), "networkobservability_"+metricsmodule.TotalBytesName))
+}
@@ -0,0 +1,144 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+//go:build ebpf && linux
+
+// Tests for the cgroupskb programs.
+//
+// These load the programs, verify they pass the kernel verifier and attach to the cgroup v2 of the test process, then
+// send datagrams on the loopback and read the counters of the cgroup.
+//
+// Requires: root (or CAP_BPF+CAP_SYS_ADMIN), cgroup v2.
+// Run: sudo go test -tags=ebpf -v -count=1 ./pkg/plugin/cgroupskb/...
+
+package cgroupskb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/plugin/ebpftest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func loadTestCollection(t *testing.T) *ebpf.Collection {
+	t.Helper()
+	ebpftest.RequirePrivileged(t)
+
+	spec, err := loadCgroupskb()
+	require.NoError(t, err)
+	coll, err := ebpf.NewCollection(spec)
+	require.NoError(t, err)
+	t.Cleanup(func() { coll.Close() })
+	return coll
+}
+
+// selfCgroup returns the cgroup v2 of the test process.
+func selfCgroup(t *testing.T) string {
+	t.Helper()
+	root, err := findCgroup2Root(cgroupRoot)
+	if err != nil {
+		t.Skipf("cgroup v2 is not available: %v", err)
+	}
+	b, err := os.ReadFile("/proc/self/cgroup")
+	require.NoError(t, err)
+	for _, line := range strings.Split(string(b), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			return filepath.Join(root, path)
+		}
+	}
+	t.Skip("the test process is not in a cgroup v2")
+	return ""
+}
+
+// TestPrograms verifies the compiled object has the cgroup skb programs and the counters map.
+func TestPrograms(t *testing.T) {
+	spec, err := loadCgroupskb()
+	require.NoError(t, err)
+	require.Contains(t, spec.Maps, cgroupskbMapRetinaCgskbCnt)
+	assert.EqualValues(t, 8, spec.Maps[cgroupskbMapRetinaCgskbCnt].KeySize)
+	assert.EqualValues(t, 32, spec.Maps[cgroupskbMapRetinaCgskbCnt].ValueSize)
+
+	for program, attach := range map[string]ebpf.AttachType{
+		cgroupskbProgRetinaCgskbIngress: ebpf.AttachCGroupInetIngress,
+		cgroupskbProgRetinaCgskbEgress:  ebpf.AttachCGroupInetEgress,
+	} {
+		p := spec.Programs[program]
+		require.NotNil(t, p)
+		assert.Equal(t, ebpf.CGroupSKB, p.Type)
+		assert.Equal(t, attach, p.AttachType)
+	}
+}
+
+// TestBPFLoadAndVerify verifies the assembled programs pass the kernel verifier and all expected objects are created.
+func TestBPFLoadAndVerify(t *testing.T) {
+	coll := loadTestCollection(t)
+
+	assert.NotNil(t, coll.Programs[cgroupskbProgRetinaCgskbIngress], "ingress program should be loaded")
+	assert.NotNil(t, coll.Programs[cgroupskbProgRetinaCgskbEgress], "egress program should be loaded")
+	assert.NotNil(t, coll.Maps[cgroupskbMapRetinaCgskbCnt], "counters map should be created")
+}
+
+// TestBPFCount verifies the packets and bytes sent and received by the sockets of a cgroup are counted.
+func TestBPFCount(t *testing.T) {
+	coll := loadTestCollection(t)
+	path := selfCgroup(t)
+	links, err := attachPrograms(coll)(path)
+	require.NoError(t, err, "should attach to %s", path)
+	t.Cleanup(func() {
+		for _, l := range links {
+			l.Close()
+		}
+	})
+
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM, 0)
+	require.NoError(t, err)
+	t.Cleanup(func() { unix.Close(fd) })
+	require.NoError(t, unix.Bind(fd, &unix.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}))
+	sa, err := unix.Getsockname(fd)
+	require.NoError(t, err)
+
+	sender, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM, 0)
+	require.NoError(t, err)
+	t.Cleanup(func() { unix.Close(sender) })
+	payload := make([]byte, 100)
+	for range 4 {
+		require.NoError(t, unix.Sendto(sender, payload, 0, sa))
+	}
+
+	var st unix.Stat_t
+	require.NoError(t, unix.Stat(path, &st))
+	counters, err := (&ebpfCounterMap{m: coll.Maps[cgroupskbMapRetinaCgskbCnt]}).Counters()
+	require.NoError(t, err)
+	v, ok := counters[st.Ino]
+	require.True(t, ok, "should count the packets of the cgroup")
+	// Other processes in the cgroup may send and receive packets too.
+	assert.GreaterOrEqual(t, v.EgressPackets, uint64(4))
+	assert.GreaterOrEqual(t, v.IngressPackets, uint64(4))
+	// skb->len includes the IP and UDP headers.
+	assert.GreaterOrEqual(t, v.EgressBytes, uint64(4*(len(payload)+28)))
+	assert.GreaterOrEqual(t, v.IngressBytes, uint64(4*(len(payload)+28)))
+}
+
+// TestBPFStopAfterInitWithoutStart verifies Stop() releases the kernel resources loaded by Init() when Start() is never
+// called.
+func TestBPFStopAfterInitWithoutStart(t *testing.T) {
+	ebpftest.RequirePrivileged(t)
+	if _, err := findCgroup2Root(cgroupRoot); err != nil {
+		t.Skipf("cgroup v2 is not available: %v", err)
+	}
+
+	log.SetupZapLogger(log.GetDefaultLogOpts())
+
+	p := New(&kcfg.Config{EnablePodLevel: true})
+	require.NoError(t, p.Init())
+	// Start() deliberately not called.
+	require.NoError(t, p.Stop(), "Stop() must clean up even without Start()")
+}
@@ -0,0 +1,157 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+// Package cgroupskb contains the Retina cgroupskb plugin. It utilizes cgroup_skb eBPF programs attached to the cgroups
+// of the pods to count their packets and bytes, including the pods in the host network, and feeds the forward metrics.
+package cgroupskb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "github.com/cilium/cilium/pkg/hubble/api/v1"
+	"github.com/cilium/ebpf"
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/metrics"
+	_ "github.com/microsoft/retina/pkg/plugin/cgroupskb/_cprog" // nolint // This is needed so cprog is included when vendoring
+	"github.com/microsoft/retina/pkg/plugin/registry"
+	"github.com/microsoft/retina/pkg/utils"
+	"go.uber.org/zap"
+)
+
+//go:generate go run github.com/cilium/ebpf/cmd/bpf2go@master -cflags "-g -O2 -Wall -D__TARGET_ARCH_${GOARCH} -Wall" -target ${GOARCH} -type counter_value cgroupskb ./_cprog/cgroupskb.c -- -I../lib/_${GOARCH} -I../lib/common/libbpf/_src
+
+func init() {
+	registry.Add(name, New)
+}
+
+// New creates a cgroupskb plugin.
+func New(cfg *kcfg.Config) registry.Plugin {
+	return &cgroupskb{
+		cfg: cfg,
+		l:   log.Logger().Named(name),
+	}
+}
+
+func (c *cgroupskb) Name() string {
+	return name
+}
+
+// Generate and Compile are no-ops, the programs are compiled with bpf2go and embedded in the binary.
+func (c *cgroupskb) Generate(context.Context) error { return nil }
+func (c *cgroupskb) Compile(context.Context) error  { return nil }
+
+func (c *cgroupskb) Init() error {
+	// The cgroups are found from the containers of the pods in the cache.
+	if !c.cfg.EnablePodLevel {
+		c.l.Warn("cgroupskb will not init because pod level is disabled")
+		return nil
+	}
+	if _, err := findCgroup2Root(cgroupRoot); err != nil {
+		return fmt.Errorf("failed to find cgroup v2 hierarchy: %w", err)
+	}
+
+	spec, err := loadCgroupskb()
+	if err != nil {
+		return fmt.Errorf("failed to load eBPF spec: %w", err)
+	}
+	// The counters are read by the plugin only, so there's nothing to pin.
+	coll, err := ebpf.NewCollection(spec)
+	if err != nil {
+		return fmt.Errorf("failed to load eBPF objects: %w", err)
+	}
+	c.coll = coll
+
+	c.l.Info("cgroupskb plugin initialized")
+	return nil
+}
+
+func (c *cgroupskb) Start(ctx context.Context) error {
+	if !c.cfg.EnablePodLevel {
+		c.l.Warn("cgroupskb will not start because pod level is disabled")
+		return nil
+	}
+	if !enricher.IsInitialized() {
+		c.l.Warn("retina enricher is not initialized, pod traffic will not be accounted")
+		<-ctx.Done()
+		return nil
+	}
+	root, err := findCgroup2Root(cgroupRoot)
+	if err != nil {
+		return fmt.Errorf("failed to find cgroup v2 hierarchy: %w", err)
+	}
+	c.enricher = enricher.Instance()
+	c.accountant = NewPodAccountant(c.enricher, &ebpfCounterMap{m: c.coll.Maps[cgroupskbMapRetinaCgskbCnt]}, attachPrograms(c.coll), root)
+
+	return c.run(ctx)
+}
+
+func (c *cgroupskb) run(ctx context.Context) error {
+	// The accountant is only used by this loop, and detaches the programs when it returns.
+	defer c.accountant.close()
+
+	ticker := time.NewTicker(c.cfg.MetricsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			c.l.Info("Context is done, cgroupskb will stop running")
+			return nil
+		case now := <-ticker.C:
+			c.update(now)
+		}
+	}
+}
+
+// update attaches the programs to the cgroups of the new pods, and sends the flows of the packets counted since the
+// last update.
+func (c *cgroupskb) update(now time.Time) {
+	if err := c.accountant.reconcile(); err != nil {
+		c.l.Error("Reconciling pod cgroups failed", zap.Error(err))
+	}
+	flows, err := c.accountant.account(now)
+	if err != nil {
+		c.l.Error("Reading cgroup counters failed", zap.Error(err))
+		return
+	}
+	for _, fl := range flows {
+		e := &v1.Event{
+			Event:     fl,
+			Timestamp: fl.Time,
+		}
+
+		if c.enricher != nil {
+			c.enricher.Write(e)
+		}
+
+		if c.externalChannel != nil {
+			select {
+			case c.externalChannel <- e:
+			default:
+				metrics.LostEventsCounter.WithLabelValues(utils.ExternalChannel, name).Inc()
+			}
+		}
+	}
+}
+
+func (c *cgroupskb) Stop() error {
+	if !c.cfg.EnablePodLevel {
+		return nil
+	}
+	// Init() loads the eBPF objects, which must be released even if Start() was not called. The links to the cgroups
+	// are closed by run().
+	if c.coll != nil {
+		c.coll.Close()
+		c.coll = nil
+	}
+	return nil
+}
+
+func (c *cgroupskb) SetupChannel(ch chan *v1.Event) error {
+	c.externalChannel = ch
+	return nil
+}
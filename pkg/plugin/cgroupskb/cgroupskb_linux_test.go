@@ -0,0 +1,67 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package cgroupskb
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	v1 "github.com/cilium/cilium/pkg/hubble/api/v1"
+	"github.com/microsoft/retina/pkg/common"
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gomock "go.uber.org/mock/gomock"
+)
+
+func TestPodLevelDisabled(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+
+	c := New(&kcfg.Config{EnablePodLevel: false}).(*cgroupskb)
+	require.NoError(t, c.Init())
+	assert.Nil(t, c.coll)
+	require.NoError(t, c.Start(context.Background()))
+	assert.Nil(t, c.accountant)
+	require.NoError(t, c.Stop())
+}
+
+func TestUpdate(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	metrics.InitializeMetrics(slog.Default())
+
+	root := t.TempDir()
+	ctr := filepath.Join(root, "kubepods", "pod1", "aaa")
+	require.NoError(t, os.MkdirAll(ctr, 0o755))
+
+	ctrl := gomock.NewController(t)
+	e := enricher.NewMockEnricherInterface(ctrl)
+	e.EXPECT().Pods().Return([]*common.RetinaEndpoint{testPod("a", "containerd://aaa")}).AnyTimes()
+	e.EXPECT().Write(gomock.Any()).Times(2)
+
+	c := New(&kcfg.Config{EnablePodLevel: true}).(*cgroupskb)
+	ch := make(chan *v1.Event, 1)
+	require.NoError(t, c.SetupChannel(ch))
+	c.enricher = e
+	counters := &fakeCounterMap{counters: map[uint64]counterValue{
+		inode(t, ctr): {IngressPackets: 1, IngressBytes: 100, EgressPackets: 1, EgressBytes: 100},
+	}}
+	c.accountant = NewPodAccountant(e, counters, (&fakeAttacher{links: make(map[string]*fakeLink)}).attach, root)
+
+	// the flows which do not fit in the external channel are dropped
+	c.update(time.Now())
+	require.Len(t, ch, 1)
+	fl := (<-ch).GetFlow()
+	assert.Equal(t, flow.Verdict_FORWARDED, fl.GetVerdict())
+	assert.Contains(t, []string{fl.GetSource().GetPodName(), fl.GetDestination().GetPodName()}, "a")
+}
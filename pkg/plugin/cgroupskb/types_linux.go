@@ -0,0 +1,52 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package cgroupskb
+
+import (
+	"io"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	v1 "github.com/cilium/cilium/pkg/hubble/api/v1"
+	"github.com/cilium/ebpf"
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+)
+
+const name = "cgroupskb"
+
+// cgroupRoot is the root of the cgroup v2 hierarchy of the host, mounted by the Helm chart.
+const cgroupRoot = "/sys/fs/cgroup"
+
+type cgroupskb struct {
+	cfg             *kcfg.Config
+	l               *log.ZapLogger
+	enricher        enricher.EnricherInterface
+	externalChannel chan *v1.Event
+	coll            *ebpf.Collection
+	accountant      *PodAccountant
+}
+
+// counterValue are the counters of a cgroup.
+type counterValue = cgroupskbCounterValue
+
+// counterMap is the map of the counters, by cgroup ID.
+type counterMap interface {
+	Counters() (map[uint64]counterValue, error)
+	Delete(cgroupID uint64) error
+}
+
+// attachFunc attaches the ingress and egress programs to a cgroup, and returns the links which detach them.
+type attachFunc func(path string) ([]io.Closer, error)
+
+// podCgroup is a pod whose cgroup has the programs attached.
+type podCgroup struct {
+	endpoint *flow.Endpoint
+	// path is the cgroup of the pod, the parent of the cgroups of its containers
+	path string
+	// cgroupIDs are the IDs of the cgroup of the pod and of its descendants, which the counters are keyed by
+	cgroupIDs map[uint64]struct{}
+	links     []io.Closer
+	// accounted are the counters of the cgroups of the pod already sent as flows
+	accounted map[uint64]counterValue
+}
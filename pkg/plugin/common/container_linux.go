@@ -0,0 +1,23 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package common
+
+import "strings"
+
+// ContainerID returns the ID of a container from the ID in its status, <runtime>://<id>.
+func ContainerID(id string) string {
+	if i := strings.Index(id, "://"); i >= 0 {
+		return id[i+3:]
+	}
+	return id
+}
+
+// CgroupContainerID returns the ID of the container of a cgroup from its name: <id> with the cgroupfs driver, or
+// <prefix>-<id>.scope with the systemd driver, e.g. cri-containerd-<id>.scope.
+func CgroupContainerID(name string) string {
+	name = strings.TrimSuffix(name, ".scope")
+	if i := strings.LastIndexByte(name, '-'); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
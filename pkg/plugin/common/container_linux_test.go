@@ -0,0 +1,17 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainerID(t *testing.T) {
+	assert.Equal(t, "abc", ContainerID("containerd://abc"))
+	assert.Equal(t, "abc", ContainerID("abc"))
+	assert.Equal(t, "abc", CgroupContainerID("cri-containerd-abc.scope"))
+	assert.Equal(t, "abc", CgroupContainerID("docker-abc.scope"))
+	assert.Equal(t, "abc", CgroupContainerID("abc"))
+}
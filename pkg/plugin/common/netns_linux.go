@@ -0,0 +1,48 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package common
+
+import (
+	"github.com/cilium/cilium/api/v1/flow"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+// PathNetns is the directory of the network namespaces bind mounted by the CNI plugins, e.g. /var/run/netns/cni-<id>.
+const PathNetns = "/var/run/netns"
+
+// AddrLister lists the addresses of a network namespace, as the netlink handle of the namespace does.
+type AddrLister interface {
+	AddrList(link netlink.Link, family int) ([]netlink.Addr, error)
+}
+
+// OpenNetns opens netlink sockets of the given families in the network namespace bind mounted at path. The requests
+// of a family missing from the handle are sent from the network namespace of the caller, e.g. the families must
+// include inet_diag for socket diagnostics.
+func OpenNetns(path string, families ...int) (*netlink.Handle, error) {
+	ns, err := netns.GetFromPath(path)
+	if err != nil {
+		return nil, err //nolint:wrapcheck // wrapped by the caller
+	}
+	defer ns.Close()
+	return netlink.NewHandleAt(ns, families...) //nolint:wrapcheck // wrapped by the caller
+}
+
+// NetnsEndpoint returns the pod of a network namespace from its global unicast addresses, or nil if none is a pod.
+func NetnsEndpoint(e enricher.EnricherInterface, h AddrLister) (*flow.Endpoint, error) {
+	addrs, err := h.AddrList(nil, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list addresses")
+	}
+	for _, addr := range addrs {
+		if addr.IP == nil || !addr.IP.IsGlobalUnicast() {
+			continue
+		}
+		if ep := e.EndpointByIP(addr.IP.String()); ep != nil {
+			return ep, nil
+		}
+	}
+	return nil, nil
+}
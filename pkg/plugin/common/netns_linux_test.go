@@ -0,0 +1,50 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package common
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+	"go.uber.org/mock/gomock"
+)
+
+type fakeAddrLister struct {
+	addrs []netlink.Addr
+	err   error
+}
+
+func (f *fakeAddrLister) AddrList(netlink.Link, int) ([]netlink.Addr, error) {
+	return f.addrs, f.err
+}
+
+func addr(ip string) netlink.Addr {
+	return netlink.Addr{IPNet: &net.IPNet{IP: net.ParseIP(ip)}}
+}
+
+func TestNetnsEndpoint(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	e := enricher.NewMockEnricherInterface(ctrl)
+	e.EXPECT().EndpointByIP("10.0.0.8").Return(nil)
+	e.EXPECT().EndpointByIP("10.0.0.5").Return(&flow.Endpoint{Namespace: "ns1", PodName: "pod1"})
+
+	// The loopback and link local addresses are not looked up.
+	ep, err := NetnsEndpoint(e, &fakeAddrLister{addrs: []netlink.Addr{addr("127.0.0.1"), addr("fe80::1"), addr("10.0.0.8"), addr("10.0.0.5")}})
+	require.NoError(t, err)
+	assert.Equal(t, "pod1", ep.GetPodName())
+
+	ep, err = NetnsEndpoint(e, &fakeAddrLister{addrs: []netlink.Addr{addr("127.0.0.1")}})
+	require.NoError(t, err)
+	assert.Nil(t, ep)
+
+	_, err = NetnsEndpoint(e, &fakeAddrLister{err: errors.New("netlink")})
+	require.Error(t, err)
+}
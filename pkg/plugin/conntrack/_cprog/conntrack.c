@@ -14,6 +14,7 @@ struct tcpmetadata {
 	__u32 ack_num; // TCP ack number
 	__u32 tsval; // TCP timestamp value
 	__u32 tsecr; // TCP timestamp echo reply
+	__u16 window; // TCP receive window, in host byte order
 };
 
 struct conntrackmetadata {
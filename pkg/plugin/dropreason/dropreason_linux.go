@@ -204,6 +204,8 @@ func (dr *dropReason) Start(ctx context.Context) error {
 		} else {
 			dr.l.Warn("retina enricher is not initialized")
 		}
+		dr.policies = newPolicyResolver(dr.l)
+		go dr.policies.run(ctx)
 	} else {
 		dr.l.Info("will not set up enricher since pod level is disabled")
 	}
@@ -341,6 +343,11 @@ func (dr *dropReason) processRecord(ctx context.Context, id int) {
 			// Set extensions on the flow.
 			utils.SetExtensions(fl, ext)
 
+			// Attribute the drops by iptables rules to the network policies.
+			if dr.policies != nil && utils.DropReason(bpfEvent.DropType) == utils.DropReason_IPTABLE_RULE_DROP {
+				dr.policies.attribute(fl)
+			}
+
 			// This is only for development purposes.
 			// Removing this makes logs way too chatter-y.
 			dr.l.Debug("DropReason Packet Received", zap.Any("flow", fl), zap.Any("Raw Bpf Event", bpfEvent), zap.Uint16("drop type", bpfEvent.DropType))
@@ -0,0 +1,479 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package dropreason
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/vishvananda/netlink"
+	"go.uber.org/zap"
+)
+
+const (
+	// policyRulesRefreshInterval is how often the iptables rules and ipsets are read again, to follow policy changes.
+	policyRulesRefreshInterval = 30 * time.Second
+	iptablesSaveTimeout        = 10 * time.Second
+
+	networkPolicyKind = "NetworkPolicy"
+
+	kubeRouterPodChainPrefix = "KUBE-POD-FW-"
+	azureNPMIngressChain     = "AZURE-NPM-INGRESS"
+	azureNPMEgressChain      = "AZURE-NPM-EGRESS"
+)
+
+var (
+	// kube-router jumps to the firewall chain of a pod with the comment
+	// "rule to jump traffic destined to POD name:<name> namespace: <namespace> to chain KUBE-POD-FW-<hash>".
+	kubeRouterPodNamespaceRegex = regexp.MustCompile(`namespace: ?(\S+)`)
+	// kube-router runs the policies selecting a pod from its firewall chain with the comment
+	// "run through nw policy <name>".
+	kubeRouterPolicyRegex = regexp.MustCompile(`^run through nw policy (\S+)$`)
+	// Azure NPM jumps to the chain of a policy with the comment "<INGRESS|EGRESS>-POLICY-<namespace>/<name>-TO-...",
+	// policy names are lower case so the upper case suffix cannot be part of the name.
+	azureNPMPolicyRegex = regexp.MustCompile(`^(INGRESS|EGRESS)-POLICY-([^/]+)/([a-z0-9.-]+?)(?:-[A-Z]+-.*)?$`)
+)
+
+// setMatch is a "-m set --match-set" match on the address of the pod.
+type setMatch struct {
+	name    string
+	negated bool
+}
+
+// policyRule is a jump from the iptables rules to the rules generated for a NetworkPolicy, for the traffic to
+// (ingress) or from (egress) the pods the policy selects. The pods are matched by address or by ipset.
+type policyRule struct {
+	policy  *flow.Policy
+	ingress bool
+	cidr    *net.IPNet
+	sets    []setMatch
+}
+
+// policyResolver attributes the packets dropped by iptables to the candidate NetworkPolicies of one direction: the
+// policies selecting the pod which would have received the packet (ingress) or, if there are none, the pod which sent
+// it (egress). The rule which dropped the packet is not known, so these are the policies which could have dropped it.
+// The policies are found in the rules of the network policy managers, kube-router and Azure NPM, which are read with
+// iptables-save, so that both iptables-legacy and iptables-nft rules are supported. The native nftables tables are
+// not read, the drops by their rules are not attributed.
+type policyResolver struct {
+	l *log.ZapLogger
+
+	// snapshot holds the rules and ipsets last read by run, nil until they are read.
+	snapshot atomic.Pointer[policySnapshot]
+
+	save    func() ([]byte, error)
+	listSet func(name string) ([]*net.IPNet, error)
+}
+
+// policySnapshot is the state of the rules at a refresh. It is not modified once stored, except for the cache.
+type policySnapshot struct {
+	rules []policyRule
+	// sets holds the members of the ipsets matched by the rules.
+	sets map[string][]*net.IPNet
+	// cache holds the policies of the addresses looked up since the refresh.
+	cache sync.Map
+}
+
+func newPolicyResolver(l *log.ZapLogger) *policyResolver {
+	return &policyResolver{
+		l:       l,
+		save:    iptablesSave,
+		listSet: ipsetMembers,
+	}
+}
+
+// run reads the rules and ipsets every policyRulesRefreshInterval until the context is done.
+func (p *policyResolver) run(ctx context.Context) {
+	p.refresh()
+	ticker := time.NewTicker(policyRulesRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.refresh()
+		}
+	}
+}
+
+func (p *policyResolver) refresh() {
+	out, err := p.save()
+	if err != nil {
+		p.l.Warn("Failed to read iptables rules for network policy attribution", zap.Error(err))
+	}
+	s := &policySnapshot{
+		rules: parsePolicyRules(bytes.NewReader(out)),
+		sets:  make(map[string][]*net.IPNet),
+	}
+	for i := range s.rules {
+		for _, set := range s.rules[i].sets {
+			if _, ok := s.sets[set.name]; ok {
+				continue
+			}
+			members, err := p.listSet(set.name)
+			if err != nil {
+				p.l.Debug("Failed to list ipset members", zap.String("set", set.name), zap.Error(err))
+			}
+			s.sets[set.name] = members
+		}
+	}
+	p.snapshot.Store(s)
+}
+
+// attribute sets the candidate policies of the dropped flow in its IngressDeniedBy field, or in its EgressDeniedBy
+// field if no ingress policy selects the destination. Only one direction is attributed: ingress policies are the most
+// common cause of policy drops, and a packet is dropped once.
+func (p *policyResolver) attribute(fl *flow.Flow) {
+	if fl == nil || fl.GetIP() == nil {
+		return
+	}
+	s := p.snapshot.Load()
+	if s == nil || len(s.rules) == 0 {
+		return
+	}
+	if ingress := s.deniedBy(net.ParseIP(fl.GetIP().GetDestination()), true); len(ingress) > 0 {
+		fl.IngressDeniedBy = ingress
+		return
+	}
+	fl.EgressDeniedBy = s.deniedBy(net.ParseIP(fl.GetIP().GetSource()), false)
+}
+
+// deniedBy returns the policies applying to the traffic to or from the address, sorted by namespace and name.
+func (s *policySnapshot) deniedBy(ip net.IP, ingress bool) []*flow.Policy {
+	if ip == nil {
+		return nil
+	}
+	key := ip.String()
+	if ingress {
+		key = "ingress/" + key
+	} else {
+		key = "egress/" + key
+	}
+	if policies, ok := s.cache.Load(key); ok {
+		return policies.([]*flow.Policy)
+	}
+
+	var policies []*flow.Policy
+	seen := make(map[string]struct{})
+	for i := range s.rules {
+		r := &s.rules[i]
+		if r.ingress != ingress || !s.matches(r, ip) {
+			continue
+		}
+		name := r.policy.GetNamespace() + "/" + r.policy.GetName()
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		policies = append(policies, r.policy)
+	}
+	sort.Slice(policies, func(i, j int) bool {
+		if policies[i].GetNamespace() != policies[j].GetNamespace() {
+			return policies[i].GetNamespace() < policies[j].GetNamespace()
+		}
+		return policies[i].GetName() < policies[j].GetName()
+	})
+	s.cache.Store(key, policies)
+	return policies
+}
+
+func (s *policySnapshot) matches(r *policyRule, ip net.IP) bool {
+	if r.cidr != nil && !r.cidr.Contains(ip) {
+		return false
+	}
+	for _, set := range r.sets {
+		in := false
+		for _, member := range s.sets[set.name] {
+			if member.Contains(ip) {
+				in = true
+				break
+			}
+		}
+		if in == set.negated {
+			return false
+		}
+	}
+	return true
+}
+
+// parsePolicyRules parses the output of iptables-save for the jumps to the rules of NetworkPolicies.
+//
+// kube-router jumps from its chains to a firewall chain per pod, KUBE-POD-FW-<hash>, matching the address of the
+// pod with -d for ingress and -s for egress. The firewall chain of the pod jumps to a chain per policy, with -d for
+// ingress policies, -s for egress policies and no address for the policies of both types.
+//
+// Azure NPM jumps from AZURE-NPM-INGRESS and AZURE-NPM-EGRESS to a chain per policy, matching the selected pods with
+// ipsets, and names the policy in the comment of the jump.
+func parsePolicyRules(r io.Reader) []policyRule {
+	type podChain struct {
+		namespace string
+		ingress   []*net.IPNet
+		egress    []*net.IPNet
+	}
+	type podChainPolicy struct {
+		chain   string
+		name    string
+		ingress bool
+		egress  bool
+	}
+	podChains := make(map[string]*podChain)
+	var podChainPolicies []podChainPolicy
+	var rules []policyRule
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "-A ") {
+			continue
+		}
+		rule := parseIptablesRule(line)
+
+		switch {
+		case strings.HasPrefix(rule.target, kubeRouterPodChainPrefix) && !strings.HasPrefix(rule.chain, kubeRouterPodChainPrefix):
+			pc, ok := podChains[rule.target]
+			if !ok {
+				pc = &podChain{}
+				podChains[rule.target] = pc
+			}
+			if m := kubeRouterPodNamespaceRegex.FindStringSubmatch(rule.comment); m != nil {
+				pc.namespace = m[1]
+			}
+			if rule.destination != nil {
+				pc.ingress = append(pc.ingress, rule.destination)
+			}
+			if rule.source != nil {
+				pc.egress = append(pc.egress, rule.source)
+			}
+
+		case strings.HasPrefix(rule.chain, kubeRouterPodChainPrefix):
+			m := kubeRouterPolicyRegex.FindStringSubmatch(rule.comment)
+			if m == nil {
+				continue
+			}
+			both := rule.source == nil && rule.destination == nil
+			podChainPolicies = append(podChainPolicies, podChainPolicy{
+				chain:   rule.chain,
+				name:    m[1],
+				ingress: both || rule.destination != nil,
+				egress:  both || rule.source != nil,
+			})
+
+		case rule.chain == azureNPMIngressChain || rule.chain == azureNPMEgressChain:
+			m := azureNPMPolicyRegex.FindStringSubmatch(rule.comment)
+			if m == nil {
+				continue
+			}
+			ingress := m[1] == "INGRESS"
+			pr := policyRule{
+				policy:  &flow.Policy{Namespace: m[2], Name: m[3], Kind: networkPolicyKind},
+				ingress: ingress,
+			}
+			for _, s := range rule.sets {
+				// the address of the selected pods is the destination of ingress and the source of egress.
+				if (ingress && s.flags == "dst") || (!ingress && s.flags == "src") {
+					pr.sets = append(pr.sets, s.setMatch)
+				}
+			}
+			if len(pr.sets) == 0 {
+				continue
+			}
+			rules = append(rules, pr)
+		}
+	}
+
+	for _, pcp := range podChainPolicies {
+		pc, ok := podChains[pcp.chain]
+		if !ok {
+			continue
+		}
+		policy := &flow.Policy{Namespace: pc.namespace, Name: pcp.name, Kind: networkPolicyKind}
+		if pcp.ingress {
+			for _, cidr := range pc.ingress {
+				rules = append(rules, policyRule{policy: policy, ingress: true, cidr: cidr})
+			}
+		}
+		if pcp.egress {
+			for _, cidr := range pc.egress {
+				rules = append(rules, policyRule{policy: policy, cidr: cidr})
+			}
+		}
+	}
+	return rules
+}
+
+type iptablesSetMatch struct {
+	setMatch
+	flags string
+}
+
+// iptablesRule is the part of an iptables-save rule used for the attribution.
+type iptablesRule struct {
+	chain       string
+	target      string
+	comment     string
+	source      *net.IPNet
+	destination *net.IPNet
+	sets        []iptablesSetMatch
+}
+
+func parseIptablesRule(line string) *iptablesRule {
+	args := splitIptablesArgs(line)
+	rule := &iptablesRule{}
+	negated := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		next := ""
+		if i+1 < len(args) {
+			next = args[i+1]
+		}
+		switch arg {
+		case "!":
+			negated = true
+			continue
+		case "-A":
+			rule.chain = next
+			i++
+		case "-j", "-g":
+			rule.target = next
+			i++
+		case "--comment":
+			rule.comment = next
+			i++
+		case "-s":
+			if !negated {
+				rule.source = parseIPNet(next)
+			}
+			i++
+		case "-d":
+			if !negated {
+				rule.destination = parseIPNet(next)
+			}
+			i++
+		case "--match-set":
+			if i+2 < len(args) {
+				rule.sets = append(rule.sets, iptablesSetMatch{setMatch: setMatch{name: next, negated: negated}, flags: args[i+2]})
+				i += 2
+			}
+		}
+		negated = false
+	}
+	return rule
+}
+
+// splitIptablesArgs splits a rule of iptables-save into its arguments, keeping the quoted arguments together.
+func splitIptablesArgs(line string) []string {
+	var args []string
+	var current strings.Builder
+	quoted, inArg := false, false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && quoted && i+1 < len(line):
+			i++
+			current.WriteByte(line[i])
+		case c == '"':
+			quoted = !quoted
+			inArg = true
+		case (c == ' ' || c == '\t') && !quoted:
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteByte(c)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args
+}
+
+func parseIPNet(s string) *net.IPNet {
+	if !strings.Contains(s, "/") {
+		if ip := net.ParseIP(s); ip != nil {
+			if ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+	}
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil
+	}
+	return ipNet
+}
+
+// iptablesSave returns the filter rules of both iptables-legacy and iptables-nft when they are available, since the
+// network policy manager can use either, and falls back to iptables-save.
+func iptablesSave() ([]byte, error) {
+	var cmds []string
+	for _, cmd := range []string{"iptables-legacy-save", "iptables-nft-save"} {
+		if _, err := exec.LookPath(cmd); err == nil {
+			cmds = append(cmds, cmd)
+		}
+	}
+	if len(cmds) == 0 {
+		cmds = []string{"iptables-save"}
+	}
+
+	var out []byte
+	var errs []error
+	for _, cmd := range cmds {
+		ctx, cancel := context.WithTimeout(context.Background(), iptablesSaveTimeout)
+		o, err := exec.CommandContext(ctx, cmd, "-t", "filter").Output()
+		cancel()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to run %s: %w", cmd, err))
+			continue
+		}
+		out = append(out, o...)
+	}
+	return out, errors.Join(errs...)
+}
+
+// ipsetMembers returns the addresses and networks of an ipset of the hash:ip or hash:net types used by the network
+// policy managers to match pods.
+func ipsetMembers(name string) ([]*net.IPNet, error) {
+	res, err := netlink.IpsetList(name)
+	if err != nil {
+		return nil, err //nolint:wrapcheck // returned as is to the resolver
+	}
+	members := make([]*net.IPNet, 0, len(res.Entries))
+	for i := range res.Entries {
+		ip := res.Entries[i].IP
+		if ip == nil {
+			continue
+		}
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		ones := int(res.Entries[i].CIDR)
+		if ones == 0 || ones > bits {
+			ones = bits
+		}
+		members = append(members, &net.IPNet{IP: ip.Mask(net.CIDRMask(ones, bits)), Mask: net.CIDRMask(ones, bits)})
+	}
+	return members, nil
+}
@@ -0,0 +1,136 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package dropreason
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const kubeRouterRules = `# Generated by iptables-nft-save v1.8.7 on Mon Oct 12 10:00:00 2026
+*filter
+:KUBE-POD-FW-A2B3C4D5E6F7G8H9 - [0:0]
+:KUBE-NWPLCY-QWERTYUIOPASDFGH - [0:0]
+:KUBE-NWPLCY-ZXCVBNMLKJHGFDSA - [0:0]
+-A KUBE-ROUTER-FORWARD -d 10.244.1.5/32 -m comment --comment "rule to jump traffic destined to POD name:web-0 namespace: shop to chain KUBE-POD-FW-A2B3C4D5E6F7G8H9" -j KUBE-POD-FW-A2B3C4D5E6F7G8H9
+-A KUBE-ROUTER-OUTPUT -d 10.244.1.5/32 -m comment --comment "rule to jump traffic destined to POD name:web-0 namespace: shop to chain KUBE-POD-FW-A2B3C4D5E6F7G8H9" -j KUBE-POD-FW-A2B3C4D5E6F7G8H9
+-A KUBE-ROUTER-FORWARD -s 10.244.1.5/32 -m comment --comment "rule to jump traffic from POD name:web-0 namespace: shop to chain KUBE-POD-FW-A2B3C4D5E6F7G8H9" -j KUBE-POD-FW-A2B3C4D5E6F7G8H9
+-A KUBE-POD-FW-A2B3C4D5E6F7G8H9 -d 10.244.1.5/32 -m comment --comment "run through nw policy allow-frontend" -j KUBE-NWPLCY-QWERTYUIOPASDFGH
+-A KUBE-POD-FW-A2B3C4D5E6F7G8H9 -m comment --comment "run through nw policy default-deny" -j KUBE-NWPLCY-ZXCVBNMLKJHGFDSA
+-A KUBE-POD-FW-A2B3C4D5E6F7G8H9 -m comment --comment "rule to REJECT traffic destined for POD name:web-0 namespace: shop" -m mark ! --mark 0x10000/0x10000 -j REJECT --reject-with icmp-port-unreachable
+COMMIT
+`
+
+const azureNPMRules = `*filter
+:AZURE-NPM-INGRESS - [0:0]
+:AZURE-NPM-EGRESS - [0:0]
+-A AZURE-NPM-INGRESS -m set --match-set azure-npm-3922407721 dst -m set --match-set azure-npm-2837910840 dst -m comment --comment "INGRESS-POLICY-payments/allow-api-TO-podlabel-app:api-IN-ns-payments" -j AZURE-NPM-INGRESS-1151532011
+-A AZURE-NPM-INGRESS -m set --match-set azure-npm-2837910840 dst -m set ! --match-set azure-npm-4272224941 dst -m comment --comment "INGRESS-POLICY-payments/deny-all-but-jobs-TO-ns-payments" -j AZURE-NPM-INGRESS-2064349730
+-A AZURE-NPM-EGRESS -m set --match-set azure-npm-3922407721 src -m comment --comment "EGRESS-POLICY-payments/restrict-egress-FROM-podlabel-app:api-IN-ns-payments" -j AZURE-NPM-EGRESS-3618314628
+-A AZURE-NPM-INGRESS -m mark --mark 0x2000 -m comment --comment "ACCEPT-on-INGRESS-allow-mark-0x2000" -j AZURE-NPM-ACCEPT
+COMMIT
+`
+
+func policyNames(policies []*flow.Policy) []string {
+	names := make([]string, 0, len(policies))
+	for _, p := range policies {
+		names = append(names, p.GetNamespace()+"/"+p.GetName())
+	}
+	return names
+}
+
+func TestPolicyResolver(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+
+	ipsets := map[string][]string{
+		"azure-npm-3922407721": {"10.244.2.7"},
+		"azure-npm-2837910840": {"10.244.2.7", "10.244.2.8", "10.244.2.9"},
+		"azure-npm-4272224941": {"10.244.2.9"},
+	}
+	saves := 0
+	rules := kubeRouterRules + azureNPMRules
+	now := time.Now()
+	p := newPolicyResolver(log.Logger().Named("test"))
+	p.save = func() ([]byte, error) {
+		saves++
+		return []byte(rules), nil
+	}
+	p.listSet = func(name string) ([]*net.IPNet, error) {
+		members, ok := ipsets[name]
+		if !ok {
+			return nil, errors.New("no such set")
+		}
+		nets := make([]*net.IPNet, 0, len(members))
+		for _, m := range members {
+			nets = append(nets, parseIPNet(m))
+		}
+		return nets, nil
+	}
+	dropped := func(src, dst string) *flow.Flow {
+		fl := utils.ToFlow(log.Logger(), now.UnixNano(), net.ParseIP(src), net.ParseIP(dst), 40000, 80, 6, 2, flow.Verdict_DROPPED)
+		p.attribute(fl)
+		return fl
+	}
+
+	// Nothing is attributed until the rules are read.
+	fl := dropped("10.244.3.3", "10.244.1.5")
+	assert.Empty(t, fl.GetIngressDeniedBy())
+	p.refresh()
+
+	t.Run("kube-router", func(t *testing.T) {
+		fl := dropped("10.244.3.3", "10.244.1.5")
+		assert.Equal(t, []string{"shop/allow-frontend", "shop/default-deny"}, policyNames(fl.GetIngressDeniedBy()))
+		assert.Empty(t, fl.GetEgressDeniedBy())
+		assert.Equal(t, "NetworkPolicy", fl.GetIngressDeniedBy()[0].GetKind())
+
+		fl = dropped("10.244.1.5", "10.244.3.3")
+		assert.Equal(t, []string{"shop/default-deny"}, policyNames(fl.GetEgressDeniedBy()))
+		assert.Empty(t, fl.GetIngressDeniedBy())
+	})
+
+	t.Run("azure npm", func(t *testing.T) {
+		// Only the ingress policies of the destination are attributed when there are some.
+		fl := dropped("10.244.2.7", "10.244.2.7")
+		assert.Equal(t, []string{"payments/allow-api", "payments/deny-all-but-jobs"}, policyNames(fl.GetIngressDeniedBy()))
+		assert.Empty(t, fl.GetEgressDeniedBy())
+
+		fl = dropped("10.244.2.7", "10.244.3.3")
+		assert.Empty(t, fl.GetIngressDeniedBy())
+		assert.Equal(t, []string{"payments/restrict-egress"}, policyNames(fl.GetEgressDeniedBy()))
+
+		fl = dropped("10.244.2.8", "10.244.2.9")
+		assert.Empty(t, fl.GetIngressDeniedBy())
+		assert.Empty(t, fl.GetEgressDeniedBy())
+
+		fl = dropped("10.244.3.3", "10.244.2.8")
+		assert.Equal(t, []string{"payments/deny-all-but-jobs"}, policyNames(fl.GetIngressDeniedBy()))
+	})
+
+	t.Run("refresh", func(t *testing.T) {
+		assert.Equal(t, 1, saves)
+		rules = ""
+		p.refresh()
+		assert.Equal(t, 2, saves)
+		fl := dropped("10.244.3.3", "10.244.1.5")
+		assert.Empty(t, fl.GetIngressDeniedBy())
+	})
+}
+
+func TestParseIptablesRule(t *testing.T) {
+	rule := parseIptablesRule(`-A KUBE-POD-FW-X ! -s 10.0.0.0/8 -d 10.244.1.5 -m comment --comment "run through nw policy \"x\"" -m set ! --match-set s1 src -j KUBE-NWPLCY-Y`)
+	assert.Equal(t, "KUBE-POD-FW-X", rule.chain)
+	assert.Equal(t, "KUBE-NWPLCY-Y", rule.target)
+	assert.Equal(t, `run through nw policy "x"`, rule.comment)
+	assert.Nil(t, rule.source)
+	assert.Equal(t, "10.244.1.5/32", rule.destination.String())
+	assert.Equal(t, []iptablesSetMatch{{setMatch: setMatch{name: "s1", negated: true}, flags: "src"}}, rule.sets)
+}
@@ -40,6 +40,8 @@ type dropReason struct {
 	recordsChannel  chan perf.Record
 	wg              sync.WaitGroup
 	externalChannel chan *hubblev1.Event
+	// policies attributes the drops by iptables rules to network policies, when pod level is enabled.
+	policies *policyResolver
 }
 
 type allFexitObjects struct {
@@ -0,0 +1,236 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package icmperror
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/metrics"
+	plugincommon "github.com/microsoft/retina/pkg/plugin/common"
+	"github.com/microsoft/retina/pkg/utils"
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+type podKey struct {
+	namespace string
+	podName   string
+}
+
+func (k podKey) labels() []string {
+	return []string{k.namespace, k.podName}
+}
+
+// socketKey identifies a socket across the network namespaces.
+type socketKey struct {
+	pod              podKey
+	src, dst         string
+	srcPort, dstPort uint16
+}
+
+// BlackholeDetector finds the established TCP sockets of the pods which repeatedly time out retransmitting large
+// segments while no ICMP packet too big error was received from their remote address, which suggests that the errors
+// are dropped on the path and the sockets are stuck in a Path MTU black hole.
+type BlackholeDetector struct {
+	l        *log.ZapLogger
+	enricher enricher.EnricherInterface
+	netnsDir string
+	sockets  []SuspectedSocket
+
+	// the last packet too big error received from each remote address
+	mu           sync.Mutex
+	packetTooBig map[string]time.Time
+
+	// the sockets suspected by the last detection, to send a flow only for the new ones
+	suspected map[socketKey]struct{}
+	// the pods exported by the last update, to delete the ones which are gone
+	exportedPods map[podKey]struct{}
+}
+
+// NewBlackholeDetector creates a detector of the PMTU black holes of the pods whose network namespaces are bind
+// mounted in netnsDir. The enricher resolves the pods of the network namespaces from their addresses.
+func NewBlackholeDetector(e enricher.EnricherInterface, netnsDir string) *BlackholeDetector {
+	return &BlackholeDetector{
+		l:            log.Logger().Named(string("BlackholeDetector")),
+		enricher:     e,
+		netnsDir:     netnsDir,
+		packetTooBig: make(map[string]time.Time),
+		suspected:    make(map[socketKey]struct{}),
+		exportedPods: make(map[podKey]struct{}),
+	}
+}
+
+// recordPacketTooBig records a packet too big error about a packet sent to remote.
+func (d *BlackholeDetector) recordPacketTooBig(remote string, ts time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.packetTooBig[remote] = ts
+}
+
+// recentPacketTooBig returns whether a packet too big error was received from remote since the given time.
+func (d *BlackholeDetector) recentPacketTooBig(remote string, since time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ts, ok := d.packetTooBig[remote]
+	return ok && ts.After(since)
+}
+
+func (d *BlackholeDetector) expirePacketTooBig(before time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for remote, ts := range d.packetTooBig {
+		if !ts.After(before) {
+			delete(d.packetTooBig, remote)
+		}
+	}
+}
+
+// detect reads the suspected sockets of each network namespace which belongs to a pod, and returns the ones which
+// were not suspected by the previous detection.
+func (d *BlackholeDetector) detect(now time.Time) ([]SuspectedSocket, error) {
+	entries, err := os.ReadDir(d.netnsDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list network namespaces in %s", d.netnsDir)
+	}
+	since := now.Add(-packetTooBigTTL)
+	d.expirePacketTooBig(since)
+
+	d.sockets = d.sockets[:0]
+	for _, entry := range entries {
+		path := filepath.Join(d.netnsDir, entry.Name())
+		// A pod may have been deleted since the listing, its namespace is skipped.
+		if err := d.readNetns(path, since); err != nil {
+			d.l.Debug("Error while reading TCP sockets of network namespace", zap.String("netns", path), zap.Error(err))
+		}
+	}
+
+	var newSockets []SuspectedSocket
+	suspected := make(map[socketKey]struct{}, len(d.sockets))
+	for _, s := range d.sockets {
+		k := s.key()
+		suspected[k] = struct{}{}
+		if _, ok := d.suspected[k]; !ok {
+			newSockets = append(newSockets, s)
+		}
+	}
+	d.suspected = suspected
+	return newSockets, nil
+}
+
+func (d *BlackholeDetector) readNetns(path string, since time.Time) error {
+	h, err := openNetns(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to open network namespace")
+	}
+	defer h.Close()
+
+	ep, err := plugincommon.NetnsEndpoint(d.enricher, h)
+	if err != nil {
+		return err
+	}
+	if ep == nil {
+		// not the network namespace of a pod known to the cache
+		return nil
+	}
+
+	for _, family := range []uint8{unix.AF_INET, unix.AF_INET6} {
+		resps, err := h.SocketDiagTCPInfo(family)
+		// An interrupted dump misses sockets, which are checked again at the next detection.
+		if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+			return errors.Wrap(err, "failed to dump TCP sockets")
+		}
+		for _, resp := range resps {
+			if !d.suspect(resp, since) {
+				continue
+			}
+			id := resp.InetDiagMsg.ID
+			d.sockets = append(d.sockets, SuspectedSocket{
+				Namespace:   ep.GetNamespace(),
+				PodName:     ep.GetPodName(),
+				Src:         id.Source,
+				Dst:         id.Destination,
+				SrcPort:     id.SourcePort,
+				DstPort:     id.DestinationPort,
+				Retransmits: resp.TCPInfo.Retransmits,
+				MSS:         resp.TCPInfo.Snd_mss,
+			})
+		}
+	}
+	return nil
+}
+
+// suspect returns whether an established socket is suspected to be in a black hole: the peer answered before, so the
+// path works for small packets, but the socket now times out retransmitting segments which may be larger than the MTU
+// of the path, and no packet too big error was received from the peer recently. A peer which became unreachable meets
+// the same conditions, which is why the sockets are only suspected.
+func (d *BlackholeDetector) suspect(resp *netlink.InetDiagTCPInfoResp, since time.Time) bool {
+	if resp == nil || resp.InetDiagMsg == nil || resp.TCPInfo == nil || resp.InetDiagMsg.State != tcpEstablished {
+		return false
+	}
+	info := resp.TCPInfo
+	if info.Retransmits < minRetransmits || info.Snd_mss < minLargeMSS || info.Unacked == 0 {
+		return false
+	}
+	// bytes_acked counts the SYN
+	if info.Bytes_received == 0 && info.Bytes_acked <= 1 {
+		return false
+	}
+	return !d.recentPacketTooBig(resp.InetDiagMsg.ID.Destination.String(), since)
+}
+
+func (d *BlackholeDetector) updateMetrics() {
+	counts := make(map[podKey]int)
+	for _, s := range d.sockets {
+		counts[podKey{namespace: s.Namespace, podName: s.PodName}]++
+	}
+
+	exported := make(map[podKey]struct{}, len(counts))
+	for k, n := range counts {
+		exported[k] = struct{}{}
+		metrics.PMTUBlackholeSuspectedGauge.WithLabelValues(k.labels()...).Set(float64(n))
+	}
+	// The series of the pods which have no suspected socket anymore are deleted.
+	for k := range d.exportedPods {
+		if _, ok := exported[k]; !ok {
+			metrics.PMTUBlackholeSuspectedGauge.DeleteLabelValues(k.labels()...)
+		}
+	}
+	d.exportedPods = exported
+}
+
+func (s *SuspectedSocket) key() socketKey {
+	return socketKey{
+		pod:     podKey{namespace: s.Namespace, podName: s.PodName},
+		src:     s.Src.String(),
+		dst:     s.Dst.String(),
+		srcPort: s.SrcPort,
+		dstPort: s.DstPort,
+	}
+}
+
+// toFlow returns the dropped flow of a suspected socket, from the pod to the remote address.
+func (s *SuspectedSocket) toFlow(l *log.ZapLogger, ts time.Time) *flow.Flow {
+	fl := utils.ToFlow(
+		l,
+		ts.UnixNano(),
+		s.Src, s.Dst,
+		uint32(s.SrcPort), uint32(s.DstPort),
+		unix.IPPROTO_TCP, 0,
+		flow.Verdict_DROPPED,
+	)
+	// IsReply is not applicable for DROPPED verdicts.
+	fl.IsReply = nil
+
+	ext := utils.NewExtensions()
+	utils.AddDropReasonName(fl, ext, dropReasonPMTUBlackhole)
+	utils.SetExtensions(fl, ext)
+	return fl
+}
@@ -0,0 +1,197 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package icmperror
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/metrics"
+	"github.com/microsoft/retina/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+	gomock "go.uber.org/mock/gomock"
+	"golang.org/x/sys/unix"
+)
+
+var errNetlink = errors.New("netlink error")
+
+type fakeSockDiag struct {
+	addrs   []netlink.Addr
+	sockets map[uint8][]*netlink.InetDiagTCPInfoResp
+	closed  bool
+}
+
+func (f *fakeSockDiag) AddrList(netlink.Link, int) ([]netlink.Addr, error) {
+	return f.addrs, nil
+}
+
+func (f *fakeSockDiag) SocketDiagTCPInfo(family uint8) ([]*netlink.InetDiagTCPInfoResp, error) {
+	return f.sockets[family], nil
+}
+
+func (f *fakeSockDiag) Close() error {
+	f.closed = true
+	return nil
+}
+
+func addr(ip string) netlink.Addr {
+	return netlink.Addr{IPNet: &net.IPNet{IP: net.ParseIP(ip)}}
+}
+
+// socket returns an established socket from src to dst which timed out retransmitting segments of mss bytes.
+func socket(src, dst string, dport uint16, retransmits uint8, mss uint32) *netlink.InetDiagTCPInfoResp {
+	msg := &netlink.Socket{State: tcpEstablished}
+	msg.ID.Source, msg.ID.Destination = net.ParseIP(src), net.ParseIP(dst)
+	msg.ID.SourcePort, msg.ID.DestinationPort = 40000, dport
+	return &netlink.InetDiagTCPInfoResp{
+		InetDiagMsg: msg,
+		TCPInfo:     &netlink.TCPInfo{Retransmits: retransmits, Snd_mss: mss, Unacked: 10, Bytes_acked: 1, Bytes_received: 300},
+	}
+}
+
+// setupNetnsDir creates a directory with an entry for each fake network namespace.
+func setupNetnsDir(t *testing.T, handles map[string]*fakeSockDiag) string {
+	t.Helper()
+	dir := t.TempDir()
+	for ns := range handles {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, ns), nil, 0o600))
+	}
+	oldOpenNetns := openNetns
+	t.Cleanup(func() { openNetns = oldOpenNetns })
+	openNetns = func(path string) (sockDiag, error) {
+		h, ok := handles[filepath.Base(path)]
+		if !ok {
+			return nil, errNetlink
+		}
+		return h, nil
+	}
+	return dir
+}
+
+func TestDetect(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	notStarted := socket("10.0.0.5", "203.0.113.13", 443, 5, 1448)
+	notStarted.TCPInfo.Bytes_received = 0
+	closing := socket("10.0.0.5", "203.0.113.14", 443, 5, 1448)
+	closing.InetDiagMsg.State = 8
+
+	handles := map[string]*fakeSockDiag{
+		"cni-1": {
+			addrs: []netlink.Addr{addr("127.0.0.1"), addr("fe80::1"), addr("10.0.0.5")},
+			sockets: map[uint8][]*netlink.InetDiagTCPInfoResp{
+				unix.AF_INET: {
+					socket("10.0.0.5", "203.0.113.10", 443, 4, 1448),
+					// too few retransmits, small segments
+					socket("10.0.0.5", "203.0.113.11", 443, 1, 1448),
+					socket("10.0.0.5", "203.0.113.12", 443, 5, 536),
+					notStarted,
+					closing,
+					// a packet too big error was received from the remote address
+					socket("10.0.0.5", "203.0.113.20", 443, 5, 1448),
+				},
+				unix.AF_INET6: {socket("fd00::5", "2001:db8::10", 443, 3, 1428)},
+			},
+		},
+		// not a pod
+		"cni-2": {
+			addrs: []netlink.Addr{addr("10.0.0.8")},
+			sockets: map[uint8][]*netlink.InetDiagTCPInfoResp{
+				unix.AF_INET: {socket("10.0.0.8", "203.0.113.10", 443, 5, 1448)},
+			},
+		},
+	}
+	dir := setupNetnsDir(t, handles)
+
+	e := enricher.NewMockEnricherInterface(ctrl)
+	e.EXPECT().EndpointByIP("10.0.0.5").Return(&flow.Endpoint{Namespace: "ns1", PodName: "pod1"}).Times(2)
+	e.EXPECT().EndpointByIP("10.0.0.8").Return(nil).Times(2)
+
+	now := time.Now()
+	d := NewBlackholeDetector(e, dir)
+	d.recordPacketTooBig("203.0.113.20", now.Add(-time.Minute))
+	d.recordPacketTooBig("203.0.113.21", now.Add(-packetTooBigTTL))
+
+	newSockets, err := d.detect(now)
+	require.NoError(t, err)
+	want := []SuspectedSocket{
+		{Namespace: "ns1", PodName: "pod1", Src: net.ParseIP("10.0.0.5"), Dst: net.ParseIP("203.0.113.10"), SrcPort: 40000, DstPort: 443, Retransmits: 4, MSS: 1448},
+		{Namespace: "ns1", PodName: "pod1", Src: net.ParseIP("fd00::5"), Dst: net.ParseIP("2001:db8::10"), SrcPort: 40000, DstPort: 443, Retransmits: 3, MSS: 1428},
+	}
+	assert.Equal(t, want, d.sockets)
+	assert.Equal(t, want, newSockets)
+	assert.NotContains(t, d.packetTooBig, "203.0.113.21", "expired errors are forgotten")
+	for _, h := range handles {
+		assert.True(t, h.closed)
+	}
+
+	// the sockets still suspected are not new
+	newSockets, err = d.detect(now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Len(t, d.sockets, 2)
+	assert.Empty(t, newSockets)
+
+	d = NewBlackholeDetector(e, filepath.Join(dir, "nonexistent"))
+	_, err = d.detect(now)
+	require.Error(t, err)
+}
+
+func TestSuspectedSocketToFlow(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+
+	s := SuspectedSocket{Src: net.ParseIP("10.0.0.5"), Dst: net.ParseIP("203.0.113.10"), SrcPort: 40000, DstPort: 443}
+	fl := s.toFlow(log.Logger(), time.Now())
+	assert.Equal(t, "10.0.0.5", fl.GetIP().GetSource())
+	assert.Equal(t, "203.0.113.10", fl.GetIP().GetDestination())
+	assert.EqualValues(t, 40000, fl.GetL4().GetTCP().GetSourcePort())
+	assert.EqualValues(t, 443, fl.GetL4().GetTCP().GetDestinationPort())
+	assert.Equal(t, flow.Verdict_DROPPED, fl.GetVerdict())
+	assert.Equal(t, dropReasonPMTUBlackhole, utils.DropReasonDescription(fl))
+}
+
+func TestBlackholeUpdateMetrics(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	gauge := metrics.NewMockGaugeVec(ctrl)
+	oldGauge := metrics.PMTUBlackholeSuspectedGauge
+	metrics.PMTUBlackholeSuspectedGauge = gauge
+	defer func() { metrics.PMTUBlackholeSuspectedGauge = oldGauge }()
+
+	testmetric := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "testmetric",
+		Help: "testmetric",
+	})
+	gauge.EXPECT().WithLabelValues("ns1", "pod1").Return(testmetric)
+	gauge.EXPECT().WithLabelValues("ns2", "pod2").Return(testmetric)
+
+	d := NewBlackholeDetector(nil, "")
+	d.sockets = []SuspectedSocket{
+		{Namespace: "ns1", PodName: "pod1", DstPort: 443},
+		{Namespace: "ns1", PodName: "pod1", DstPort: 8443},
+		{Namespace: "ns2", PodName: "pod2", DstPort: 443},
+	}
+	d.updateMetrics()
+
+	// the sockets of pod1 recovered, its series is deleted
+	gauge.EXPECT().WithLabelValues("ns2", "pod2").Return(testmetric)
+	gauge.EXPECT().DeleteLabelValues("ns1", "pod1").Return(true)
+	d.sockets = d.sockets[2:]
+	d.updateMetrics()
+}
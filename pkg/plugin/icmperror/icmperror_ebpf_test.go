@@ -0,0 +1,80 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+//go:build ebpf && linux
+
+// Tests for the icmperror capture socket.
+//
+// These attach the classic BPF filter to a packet socket on the loopback, send a UDP datagram to a closed port and
+// read the ICMP port unreachable error sent back by the kernel.
+//
+// Requires: root (or CAP_NET_RAW).
+// Run: sudo go test -tags=ebpf -v -count=1 ./pkg/plugin/icmperror/...
+
+package icmperror
+
+import (
+	"net"
+	"testing"
+
+	"github.com/microsoft/retina/pkg/plugin/ebpftest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// closedPort returns a UDP port of the loopback on which nothing listens.
+func closedPort(t *testing.T, network string, ip net.IP) int {
+	t.Helper()
+	conn, err := net.ListenUDP(network, &net.UDPAddr{IP: ip})
+	require.NoError(t, err)
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	require.NoError(t, conn.Close())
+	return port
+}
+
+// TestCaptureICMPError verifies the filter accepts the ICMP and ICMPv6 errors and the capture decodes the original
+// packet.
+func TestCaptureICMPError(t *testing.T) {
+	ebpftest.RequirePrivileged(t)
+
+	lo, err := net.InterfaceByName("lo")
+	require.NoError(t, err)
+	sock, err := openSocket(lo.Index)
+	require.NoError(t, err, "should attach the filter")
+	t.Cleanup(func() { unix.Close(sock) })
+
+	for _, tt := range []struct {
+		network string
+		ip      net.IP
+	}{
+		{network: "udp4", ip: net.IPv4(127, 0, 0, 1)},
+		{network: "udp6", ip: net.IPv6loopback},
+	} {
+		t.Run(tt.network, func(t *testing.T) {
+			port := closedPort(t, tt.network, tt.ip)
+			conn, err := net.DialUDP(tt.network, nil, &net.UDPAddr{IP: tt.ip, Port: port})
+			if err != nil {
+				t.Skipf("%s is not available: %v", tt.network, err)
+			}
+			t.Cleanup(func() { conn.Close() })
+			_, err = conn.Write([]byte("ping"))
+			require.NoError(t, err)
+
+			// The datagram itself is filtered out, the first packet read is the error, seen once.
+			buf := make([]byte, snapLen)
+			n, _, err := unix.Recvfrom(sock, buf, 0)
+			require.NoError(t, err, "should receive the port unreachable error")
+			e, ok := parseICMPError(buf[:n])
+			require.True(t, ok)
+			assert.Equal(t, typeDestUnreachable, e.errType)
+			assert.True(t, tt.ip.Equal(e.srcIP))
+			assert.EqualValues(t, unix.IPPROTO_UDP, e.proto)
+			assert.EqualValues(t, conn.LocalAddr().(*net.UDPAddr).Port, e.srcPort)
+			assert.EqualValues(t, port, e.dstPort)
+
+			_, _, err = unix.Recvfrom(sock, buf, 0)
+			require.ErrorIs(t, err, unix.EAGAIN, "the error should only be captured on receive")
+		})
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+// Package icmperror contains the Retina icmperror plugin. It captures the ICMP and ICMPv6 errors received by the node,
+// attributing them to the flows of the original packets they embed, and detects the TCP sockets of the pods stuck in a
+// Path MTU black hole, which retransmit large segments without receiving any error.
+package icmperror
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	v1 "github.com/cilium/cilium/pkg/hubble/api/v1"
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/metrics"
+	plugincommon "github.com/microsoft/retina/pkg/plugin/common"
+	"github.com/microsoft/retina/pkg/plugin/registry"
+	"github.com/microsoft/retina/pkg/utils"
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+func init() {
+	registry.Add(name, New)
+}
+
+// New creates an icmperror plugin.
+func New(cfg *kcfg.Config) registry.Plugin {
+	return &icmperror{
+		cfg:  cfg,
+		l:    log.Logger().Named(name),
+		sock: -1,
+	}
+}
+
+func (ie *icmperror) Name() string {
+	return name
+}
+
+// Generate and Compile are no-ops, the errors are captured by a classic BPF socket filter.
+func (ie *icmperror) Generate(context.Context) error { return nil }
+func (ie *icmperror) Compile(context.Context) error  { return nil }
+
+func (ie *icmperror) Init() error {
+	// Bind to all interfaces (ifindex=0), the filter only captures PACKET_HOST.
+	sock, err := openSocket(0)
+	if err != nil {
+		return err
+	}
+	ie.sock = sock
+
+	ie.l.Info("icmperror plugin initialized")
+	return nil
+}
+
+func (ie *icmperror) Start(ctx context.Context) error {
+	// The flows are enriched and the pods of the sockets are resolved from the addresses of their network namespaces,
+	// which requires pod level.
+	if ie.cfg.EnablePodLevel && enricher.IsInitialized() {
+		ie.enricher = enricher.Instance()
+		ie.detector = NewBlackholeDetector(ie.enricher, plugincommon.PathNetns)
+	} else {
+		ie.l.Warn("icmperror plugin requires pod level to detect PMTU black holes")
+	}
+
+	return ie.run(ctx)
+}
+
+func (ie *icmperror) run(ctx context.Context) error {
+	// readPackets returns within readTimeout once the context is done.
+	ie.wg.Add(1)
+	go func(sock int) {
+		defer ie.wg.Done()
+		ie.readPackets(ctx, sock)
+	}(ie.sock)
+
+	if ie.detector == nil {
+		<-ctx.Done()
+		ie.wg.Wait()
+		return nil
+	}
+
+	ticker := time.NewTicker(ie.cfg.MetricsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			ie.l.Info("Context is done, icmperror will stop running")
+			ie.wg.Wait()
+			return nil
+		case <-ticker.C:
+			ie.detectBlackholes(time.Now())
+		}
+	}
+}
+
+func (ie *icmperror) readPackets(ctx context.Context, sock int) {
+	buf := make([]byte, snapLen)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			n, _, err := unix.Recvfrom(sock, buf, 0)
+			if err != nil {
+				if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+					continue
+				}
+				if errors.Is(err, unix.EBADF) {
+					return
+				}
+				ie.l.Error("Error reading packet", zap.Error(err))
+				continue
+			}
+			ie.handlePacket(buf[:n], time.Now())
+		}
+	}
+}
+
+func (ie *icmperror) handlePacket(pkt []byte, ts time.Time) {
+	e, ok := parseICMPError(pkt)
+	if !ok {
+		return
+	}
+	metrics.ICMPErrorCounter.WithLabelValues(e.errType).Inc()
+	if e.errType == typePacketTooBig && ie.detector != nil {
+		ie.detector.recordPacketTooBig(e.dstIP.String(), ts)
+	}
+	ie.send(e.toFlow(ie.l, ts))
+}
+
+func (ie *icmperror) detectBlackholes(now time.Time) {
+	newSockets, err := ie.detector.detect(now)
+	if err != nil {
+		ie.l.Error("Detecting PMTU black holes failed", zap.Error(err))
+		return
+	}
+	ie.detector.updateMetrics()
+	for i := range newSockets {
+		ie.send(newSockets[i].toFlow(ie.l, now))
+	}
+}
+
+func (ie *icmperror) send(fl *flow.Flow) {
+	e := &v1.Event{
+		Event:     fl,
+		Timestamp: fl.GetTime(),
+	}
+
+	if ie.enricher != nil {
+		ie.enricher.Write(e)
+	}
+
+	if ie.externalChannel != nil {
+		select {
+		case ie.externalChannel <- e:
+		default:
+			metrics.LostEventsCounter.WithLabelValues(utils.ExternalChannel, name).Inc()
+		}
+	}
+}
+
+func (ie *icmperror) Stop() error {
+	// Init() opens the socket, which must be closed even if Start() was not called.
+	if ie.sock >= 0 {
+		if err := unix.Close(ie.sock); err != nil {
+			ie.l.Warn("failed to close packet socket", zap.Error(err))
+		}
+		ie.sock = -1
+	}
+	return nil
+}
+
+func (ie *icmperror) SetupChannel(ch chan *v1.Event) error {
+	ie.externalChannel = ch
+	return nil
+}
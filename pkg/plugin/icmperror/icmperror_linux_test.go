@@ -0,0 +1,70 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package icmperror
+
+import (
+	"testing"
+	"time"
+
+	v1 "github.com/cilium/cilium/pkg/hubble/api/v1"
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/metrics"
+	"github.com/microsoft/retina/pkg/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gomock "go.uber.org/mock/gomock"
+	"golang.org/x/sys/unix"
+)
+
+func TestHandlePacket(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	counter := metrics.NewMockCounterVec(ctrl)
+	oldCounter := metrics.ICMPErrorCounter
+	metrics.ICMPErrorCounter = counter
+	defer func() { metrics.ICMPErrorCounter = oldCounter }()
+
+	testmetric := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "testmetric",
+		Help: "testmetric",
+	})
+	counter.EXPECT().WithLabelValues(typePacketTooBig).Return(testmetric)
+	counter.EXPECT().WithLabelValues(typeTimeExceeded).Return(testmetric)
+
+	ie := New(&kcfg.Config{EnablePodLevel: true}).(*icmperror)
+	ie.detector = NewBlackholeDetector(nil, "")
+	ch := make(chan *v1.Event, 3)
+	require.NoError(t, ie.SetupChannel(ch))
+
+	now := time.Now()
+	udp4 := ipPacket("10.0.0.5", "203.0.113.10", unix.IPPROTO_UDP, ports(50000, 4500))
+	ie.handlePacket(icmpPacket("192.168.1.1", "10.0.0.5", icmpDestUnreachable, icmpFragNeeded, 1400, udp4), now)
+	require.Len(t, ch, 1)
+	fl := (<-ch).GetFlow()
+	assert.Equal(t, "10.0.0.5", fl.GetIP().GetSource())
+	assert.EqualValues(t, 4500, fl.GetL4().GetUDP().GetDestinationPort())
+	assert.Equal(t, dropReasonPacketTooBig, utils.DropReasonDescription(fl))
+	// the remote address of the packet too big errors is not a black hole
+	assert.True(t, ie.detector.recentPacketTooBig("203.0.113.10", now.Add(-time.Second)))
+
+	ie.handlePacket(icmpPacket("192.168.1.1", "10.0.0.5", icmpTimeExceeded, 0, 0, udp4), now)
+	require.Len(t, ch, 1)
+	assert.Equal(t, dropReasonTimeExceeded, utils.DropReasonDescription((<-ch).GetFlow()))
+
+	// the packets which are not errors are skipped
+	ie.handlePacket(udp4, now)
+	assert.Empty(t, ch)
+}
+
+func TestStopWithoutInit(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+
+	ie := New(&kcfg.Config{})
+	require.NoError(t, ie.Stop())
+}
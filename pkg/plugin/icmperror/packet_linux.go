@@ -0,0 +1,202 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package icmperror
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/utils"
+	"golang.org/x/sys/unix"
+)
+
+// Ancillary data loaded by the classic BPF filters, see include/uapi/linux/filter.h
+const (
+	skfAdOff      = 0xfffff000 // -0x1000
+	skfAdProtocol = 0
+	skfAdPktType  = 4
+)
+
+// icmpFilter is the classic BPF filter of the capture socket. The packets start at the IP header, as the socket is
+// SOCK_DGRAM. It accepts the ICMP destination unreachable and time exceeded errors, and the ICMPv6 destination
+// unreachable, packet too big and time exceeded errors, received by the host (PACKET_HOST), so that an error forwarded
+// to a pod is not captured a second time on its veth.
+var icmpFilter = []unix.SockFilter{
+	// 0: only the packets received by the host
+	{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: skfAdOff + skfAdPktType},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, K: unix.PACKET_HOST, Jt: 0, Jf: 18},
+	// 2: IPv6 at 13, IPv4 below
+	{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: skfAdOff + skfAdProtocol},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, K: unix.ETH_P_IPV6, Jt: 9, Jf: 0},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, K: unix.ETH_P_IP, Jt: 0, Jf: 15},
+	// 5: ICMP, not a fragment
+	{Code: unix.BPF_LD | unix.BPF_B | unix.BPF_ABS, K: 9},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, K: unix.IPPROTO_ICMP, Jt: 0, Jf: 13},
+	{Code: unix.BPF_LD | unix.BPF_H | unix.BPF_ABS, K: 6},
+	{Code: unix.BPF_JMP | unix.BPF_JSET | unix.BPF_K, K: 0x1fff, Jt: 11, Jf: 0},
+	// 9: ICMP type after the IPv4 header and its options
+	{Code: unix.BPF_LDX | unix.BPF_B | unix.BPF_MSH, K: 0},
+	{Code: unix.BPF_LD | unix.BPF_B | unix.BPF_IND, K: 0},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, K: icmpDestUnreachable, Jt: 7, Jf: 0},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, K: icmpTimeExceeded, Jt: 6, Jf: 7},
+	// 13: ICMPv6 right after the IPv6 header, the extension headers are not followed
+	{Code: unix.BPF_LD | unix.BPF_B | unix.BPF_ABS, K: 6},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, K: unix.IPPROTO_ICMPV6, Jt: 0, Jf: 5},
+	{Code: unix.BPF_LD | unix.BPF_B | unix.BPF_ABS, K: ipv6HdrLen},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, K: icmpv6DestUnreachable, Jt: 2, Jf: 0},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, K: icmpv6PacketTooBig, Jt: 1, Jf: 0},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, K: icmpv6TimeExceeded, Jt: 0, Jf: 1},
+	// 19: accept
+	{Code: unix.BPF_RET | unix.BPF_K, K: snapLen},
+	// 20: drop
+	{Code: unix.BPF_RET | unix.BPF_K, K: 0},
+}
+
+const (
+	ipv4HdrLen = 20
+	ipv6HdrLen = 40
+	// icmpHdrLen is the length of the ICMP and ICMPv6 headers, before the original packet
+	icmpHdrLen = 8
+)
+
+// openSocket opens a packet socket capturing the ICMP errors received on the interface with the given index, or on
+// all the interfaces with 0.
+func openSocket(ifindex int) (int, error) {
+	// The socket is created without protocol so that it receives nothing until the filter is attached.
+	sock, err := unix.Socket(unix.AF_PACKET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return -1, fmt.Errorf("failed to create packet socket: %w", err)
+	}
+	fprog := unix.SockFprog{Len: uint16(len(icmpFilter)), Filter: &icmpFilter[0]}
+	if err := unix.SetsockoptSockFprog(sock, unix.SOL_SOCKET, unix.SO_ATTACH_FILTER, &fprog); err != nil {
+		unix.Close(sock) //nolint:errcheck // best-effort cleanup
+		return -1, fmt.Errorf("failed to attach filter: %w", err)
+	}
+	// The reads time out so that the capture loop can return when the plugin is stopped.
+	tv := unix.NsecToTimeval(readTimeout.Nanoseconds())
+	if err := unix.SetsockoptTimeval(sock, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+		unix.Close(sock) //nolint:errcheck // best-effort cleanup
+		return -1, fmt.Errorf("failed to set read timeout: %w", err)
+	}
+	sll := unix.SockaddrLinklayer{Ifindex: ifindex, Protocol: utils.HostToNetShort(unix.ETH_P_ALL)}
+	if err := unix.Bind(sock, &sll); err != nil {
+		unix.Close(sock) //nolint:errcheck // best-effort cleanup
+		return -1, fmt.Errorf("failed to bind packet socket: %w", err)
+	}
+	return sock, nil
+}
+
+// parseICMPError decodes an ICMP or ICMPv6 error and the header of the original packet it embeds, starting at the IP
+// header. It returns false if the packet is not an error, or is truncated before the addresses of the original packet.
+func parseICMPError(pkt []byte) (*icmpError, bool) {
+	if len(pkt) == 0 {
+		return nil, false
+	}
+	var (
+		e    icmpError
+		icmp []byte
+	)
+	switch pkt[0] >> 4 {
+	case 4:
+		ihl := int(pkt[0]&0x0f) * 4
+		if ihl < ipv4HdrLen || len(pkt) < ihl+icmpHdrLen || pkt[9] != unix.IPPROTO_ICMP {
+			return nil, false
+		}
+		e.source = net.IP(pkt[12:16])
+		icmp = pkt[ihl:]
+		switch {
+		case icmp[0] == icmpDestUnreachable && icmp[1] == icmpFragNeeded:
+			e.errType, e.dropReason = typePacketTooBig, dropReasonPacketTooBig
+			e.mtu = uint32(binary.BigEndian.Uint16(icmp[6:8]))
+		case icmp[0] == icmpDestUnreachable:
+			e.errType, e.dropReason = typeDestUnreachable, dropReasonDestUnreachable
+		case icmp[0] == icmpTimeExceeded:
+			e.errType, e.dropReason = typeTimeExceeded, dropReasonTimeExceeded
+		default:
+			return nil, false
+		}
+	case 6:
+		if len(pkt) < ipv6HdrLen+icmpHdrLen || pkt[6] != unix.IPPROTO_ICMPV6 {
+			return nil, false
+		}
+		e.source = net.IP(pkt[8:24])
+		icmp = pkt[ipv6HdrLen:]
+		switch icmp[0] {
+		case icmpv6DestUnreachable:
+			e.errType, e.dropReason = typeDestUnreachable, dropReasonDestUnreachable
+		case icmpv6PacketTooBig:
+			e.errType, e.dropReason = typePacketTooBig, dropReasonPacketTooBig
+			e.mtu = binary.BigEndian.Uint32(icmp[4:8])
+		case icmpv6TimeExceeded:
+			e.errType, e.dropReason = typeTimeExceeded, dropReasonTimeExceeded
+		default:
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+
+	if !e.parseOriginal(icmp[icmpHdrLen:]) {
+		return nil, false
+	}
+	return &e, true
+}
+
+// parseOriginal decodes the addresses, protocol and ports of the original packet embedded in an error. The ports are
+// left to 0 if they were truncated, or the original packet is not the first fragment.
+func (e *icmpError) parseOriginal(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	var l4 []byte
+	switch b[0] >> 4 {
+	case 4:
+		ihl := int(b[0]&0x0f) * 4
+		if ihl < ipv4HdrLen || len(b) < ipv4HdrLen {
+			return false
+		}
+		e.proto = b[9]
+		e.srcIP, e.dstIP = net.IP(b[12:16]), net.IP(b[16:20])
+		if binary.BigEndian.Uint16(b[6:8])&0x1fff == 0 && len(b) >= ihl {
+			l4 = b[ihl:]
+		}
+	case 6:
+		if len(b) < ipv6HdrLen {
+			return false
+		}
+		e.proto = b[6]
+		e.srcIP, e.dstIP = net.IP(b[8:24]), net.IP(b[24:40])
+		l4 = b[ipv6HdrLen:]
+	default:
+		return false
+	}
+	if (e.proto == unix.IPPROTO_TCP || e.proto == unix.IPPROTO_UDP) && len(l4) >= 4 {
+		e.srcPort = binary.BigEndian.Uint16(l4[0:2])
+		e.dstPort = binary.BigEndian.Uint16(l4[2:4])
+	}
+	return true
+}
+
+// toFlow returns the dropped flow of the original packet of an error, from the pod which sent it.
+func (e *icmpError) toFlow(l *log.ZapLogger, ts time.Time) *flow.Flow {
+	fl := utils.ToFlow(
+		l,
+		ts.UnixNano(),
+		e.srcIP, e.dstIP,
+		uint32(e.srcPort), uint32(e.dstPort),
+		e.proto, 0,
+		flow.Verdict_DROPPED,
+	)
+	// IsReply is not applicable for DROPPED verdicts.
+	fl.IsReply = nil
+
+	ext := utils.NewExtensions()
+	utils.AddDropReasonName(fl, ext, e.dropReason)
+	utils.AddICMPError(ext, e.source.String(), e.mtu)
+	utils.SetExtensions(fl, ext)
+	return fl
+}
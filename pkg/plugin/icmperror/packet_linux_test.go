@@ -0,0 +1,167 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package icmperror
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// ipPacket returns an IPv4 or IPv6 header from src to dst followed by payload.
+func ipPacket(src, dst string, proto uint8, payload []byte) []byte {
+	srcIP, dstIP := net.ParseIP(src), net.ParseIP(dst)
+	if ip4 := srcIP.To4(); ip4 != nil {
+		hdr := make([]byte, ipv4HdrLen)
+		hdr[0] = 0x45
+		binary.BigEndian.PutUint16(hdr[6:8], 0x4000) // don't fragment
+		hdr[8] = 64
+		hdr[9] = proto
+		copy(hdr[12:16], ip4)
+		copy(hdr[16:20], dstIP.To4())
+		return append(hdr, payload...)
+	}
+	hdr := make([]byte, ipv6HdrLen)
+	hdr[0] = 0x60
+	hdr[6] = proto
+	hdr[7] = 64
+	copy(hdr[8:24], srcIP)
+	copy(hdr[24:40], dstIP)
+	return append(hdr, payload...)
+}
+
+// ports returns the first bytes of a TCP or UDP header.
+func ports(sport, dport uint16) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint16(b[0:2], sport)
+	binary.BigEndian.PutUint16(b[2:4], dport)
+	return b
+}
+
+// icmpPacket returns an ICMP or ICMPv6 error sent by router about the original packet.
+func icmpPacket(router, pod string, typ, code uint8, mtu uint32, original []byte) []byte {
+	hdr := make([]byte, icmpHdrLen)
+	hdr[0], hdr[1] = typ, code
+	proto := uint8(unix.IPPROTO_ICMPV6)
+	if net.ParseIP(router).To4() != nil {
+		proto = unix.IPPROTO_ICMP
+		binary.BigEndian.PutUint16(hdr[6:8], uint16(mtu)) //nolint:gosec // test MTUs fit
+	} else {
+		binary.BigEndian.PutUint32(hdr[4:8], mtu)
+	}
+	return ipPacket(router, pod, proto, append(hdr, original...))
+}
+
+func TestParseICMPError(t *testing.T) {
+	tcp4 := ipPacket("10.0.0.5", "203.0.113.10", unix.IPPROTO_TCP, ports(40000, 443))
+	udp6 := ipPacket("fd00::5", "2001:db8::10", unix.IPPROTO_UDP, ports(50000, 53))
+
+	tests := []struct {
+		name       string
+		pkt        []byte
+		want       *icmpError
+		wantParsed bool
+	}{
+		{
+			name: "fragmentation needed",
+			pkt:  icmpPacket("192.168.1.1", "10.0.0.5", icmpDestUnreachable, icmpFragNeeded, 1400, tcp4),
+			want: &icmpError{
+				source: net.ParseIP("192.168.1.1").To4(), errType: typePacketTooBig, dropReason: dropReasonPacketTooBig, mtu: 1400,
+				srcIP: net.ParseIP("10.0.0.5").To4(), dstIP: net.ParseIP("203.0.113.10").To4(),
+				proto: unix.IPPROTO_TCP, srcPort: 40000, dstPort: 443,
+			},
+			wantParsed: true,
+		},
+		{
+			name: "port unreachable",
+			pkt:  icmpPacket("203.0.113.10", "10.0.0.5", icmpDestUnreachable, 3, 0, tcp4),
+			want: &icmpError{
+				source: net.ParseIP("203.0.113.10").To4(), errType: typeDestUnreachable, dropReason: dropReasonDestUnreachable,
+				srcIP: net.ParseIP("10.0.0.5").To4(), dstIP: net.ParseIP("203.0.113.10").To4(),
+				proto: unix.IPPROTO_TCP, srcPort: 40000, dstPort: 443,
+			},
+			wantParsed: true,
+		},
+		{
+			name: "TTL exceeded with truncated ports",
+			pkt:  icmpPacket("192.168.1.1", "10.0.0.5", icmpTimeExceeded, 0, 0, tcp4[:ipv4HdrLen+2]),
+			want: &icmpError{
+				source: net.ParseIP("192.168.1.1").To4(), errType: typeTimeExceeded, dropReason: dropReasonTimeExceeded,
+				srcIP: net.ParseIP("10.0.0.5").To4(), dstIP: net.ParseIP("203.0.113.10").To4(),
+				proto: unix.IPPROTO_TCP,
+			},
+			wantParsed: true,
+		},
+		{
+			name: "packet too big",
+			pkt:  icmpPacket("fd00::1", "fd00::5", icmpv6PacketTooBig, 0, 1280, udp6),
+			want: &icmpError{
+				source: net.ParseIP("fd00::1"), errType: typePacketTooBig, dropReason: dropReasonPacketTooBig, mtu: 1280,
+				srcIP: net.ParseIP("fd00::5"), dstIP: net.ParseIP("2001:db8::10"),
+				proto: unix.IPPROTO_UDP, srcPort: 50000, dstPort: 53,
+			},
+			wantParsed: true,
+		},
+		{
+			name: "ICMPv6 time exceeded",
+			pkt:  icmpPacket("fd00::1", "fd00::5", icmpv6TimeExceeded, 0, 0, udp6),
+			want: &icmpError{
+				source: net.ParseIP("fd00::1"), errType: typeTimeExceeded, dropReason: dropReasonTimeExceeded,
+				srcIP: net.ParseIP("fd00::5"), dstIP: net.ParseIP("2001:db8::10"),
+				proto: unix.IPPROTO_UDP, srcPort: 50000, dstPort: 53,
+			},
+			wantParsed: true,
+		},
+		{
+			name: "echo request",
+			pkt:  icmpPacket("192.168.1.1", "10.0.0.5", 8, 0, 0, tcp4),
+		},
+		{
+			name: "not ICMP",
+			pkt:  tcp4,
+		},
+		{
+			name: "original header truncated",
+			pkt:  icmpPacket("fd00::1", "fd00::5", icmpv6DestUnreachable, 0, 0, udp6[:ipv6HdrLen-1]),
+		},
+		{
+			name: "empty",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseICMPError(tt.pkt)
+			require.Equal(t, tt.wantParsed, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestICMPErrorToFlow(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+
+	tcp4 := ipPacket("10.0.0.5", "203.0.113.10", unix.IPPROTO_TCP, ports(40000, 443))
+	e, ok := parseICMPError(icmpPacket("192.168.1.1", "10.0.0.5", icmpDestUnreachable, icmpFragNeeded, 1400, tcp4))
+	require.True(t, ok)
+
+	fl := e.toFlow(log.Logger(), time.Now())
+	// the flow is the one of the original packet, sent by the pod
+	assert.Equal(t, "10.0.0.5", fl.GetIP().GetSource())
+	assert.Equal(t, "203.0.113.10", fl.GetIP().GetDestination())
+	assert.EqualValues(t, 40000, fl.GetL4().GetTCP().GetSourcePort())
+	assert.EqualValues(t, 443, fl.GetL4().GetTCP().GetDestinationPort())
+	assert.Equal(t, flow.Verdict_DROPPED, fl.GetVerdict())
+	assert.Nil(t, fl.GetIsReply())
+	assert.Equal(t, dropReasonPacketTooBig, utils.DropReasonDescription(fl))
+	assert.Equal(t, "192.168.1.1", utils.ICMPSource(fl))
+	assert.EqualValues(t, 1400, utils.MTU(fl))
+}
@@ -0,0 +1,120 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package icmperror
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	v1 "github.com/cilium/cilium/pkg/hubble/api/v1"
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+	plugincommon "github.com/microsoft/retina/pkg/plugin/common"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+const name = "icmperror"
+
+// tcpEstablished is the TCP_ESTABLISHED state of the sockets, see include/net/tcp_states.h
+const tcpEstablished = 1
+
+const (
+	// snapLen is the length of the packets captured, which covers the outer IP and ICMP headers, and the inner IP
+	// header and ports with IPv4 options.
+	snapLen = 256
+	// readTimeout is how often the capture loop checks if the plugin is stopped.
+	readTimeout = time.Second
+)
+
+const (
+	// ICMP types, see RFC 792.
+	icmpDestUnreachable = 3
+	icmpTimeExceeded    = 11
+	// icmpFragNeeded is the code of the destination unreachable errors sent when the packet is larger than the MTU of
+	// the next hop and has the don't fragment bit set.
+	icmpFragNeeded = 4
+
+	// ICMPv6 types, see RFC 4443.
+	icmpv6DestUnreachable = 1
+	icmpv6PacketTooBig    = 2
+	icmpv6TimeExceeded    = 3
+)
+
+const (
+	// Values of the type label of the icmp_error_count metric
+	typeDestUnreachable = "dest_unreachable"
+	typePacketTooBig    = "packet_too_big"
+	typeTimeExceeded    = "time_exceeded"
+
+	// Drop reasons of the flows
+	dropReasonDestUnreachable = "ICMP_DEST_UNREACHABLE"
+	dropReasonPacketTooBig    = "ICMP_PACKET_TOO_BIG"
+	dropReasonTimeExceeded    = "ICMP_TIME_EXCEEDED"
+	dropReasonPMTUBlackhole   = "PMTU_BLACKHOLE_SUSPECTED"
+)
+
+const (
+	// minRetransmits is the number of consecutive retransmission timeouts of a socket from which it is suspected to
+	// be stuck in a PMTU black hole.
+	minRetransmits = 3
+	// minLargeMSS is the segment size from which the segments may exceed the MTU of a path, below the IPv6 minimum
+	// MTU of 1280 the retransmits are not caused by the path MTU.
+	minLargeMSS = 1200
+	// packetTooBigTTL is how long a packet too big error is remembered for a remote address. A socket retransmitting
+	// to an address which sent one within this time is not in a black hole, the kernel lowers its MSS instead.
+	packetTooBigTTL = 10 * time.Minute
+)
+
+// openNetns opens netlink sockets in the network namespace bind mounted at path.
+var openNetns = func(path string) (sockDiag, error) {
+	return plugincommon.OpenNetns(path, unix.NETLINK_ROUTE, unix.NETLINK_INET_DIAG)
+}
+
+type icmperror struct {
+	cfg             *kcfg.Config
+	l               *log.ZapLogger
+	enricher        enricher.EnricherInterface
+	externalChannel chan *v1.Event
+	sock            int
+	detector        *BlackholeDetector
+	wg              sync.WaitGroup
+}
+
+// icmpError is an ICMP or ICMPv6 error decoded from a packet.
+type icmpError struct {
+	// source is the address of the router or host which sent the error
+	source net.IP
+	// errType is the value of the type label of the icmp_error_count metric
+	errType    string
+	dropReason string
+	// mtu is the MTU of the next hop of the packet too big errors
+	mtu uint32
+
+	// The header of the original packet embedded in the error, sent by the pod.
+	srcIP, dstIP     net.IP
+	proto            uint8
+	srcPort, dstPort uint16
+}
+
+// SuspectedSocket is an established TCP socket of a pod which is suspected to be stuck in a PMTU black hole.
+type SuspectedSocket struct {
+	Namespace string
+	PodName   string
+	Src, Dst  net.IP
+	// SrcPort is the local port of the socket, DstPort the remote one
+	SrcPort, DstPort uint16
+	// Retransmits is the number of consecutive retransmission timeouts
+	Retransmits uint8
+	// MSS is the segment size of the socket
+	MSS uint32
+}
+
+// sockDiag is the netlink handle of a network namespace.
+type sockDiag interface {
+	plugincommon.AddrLister
+	SocketDiagTCPInfo(family uint8) ([]*netlink.InetDiagTCPInfoResp, error)
+	Close() error
+}
@@ -33,4 +33,13 @@ var testFS = fstest.MapFS{ // nolint unused
 	"net/docker0/debug/lro_timeout": &fstest.MapFile{
 		Data: []byte("1"),
 	},
+	"proc/1234/cgroup": &fstest.MapFile{
+		Data: []byte("0::/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod1.slice/cri-containerd-abc.scope\n"),
+	},
+	"proc/5678/cgroup": &fstest.MapFile{
+		Data: []byte("12:memory:/kubepods/burstable/pod2/def\n1:name=systemd:/kubepods/burstable/pod2/def\n0::/\n"),
+	},
+	"proc/4321/cgroup": &fstest.MapFile{
+		Data: []byte("0::/system.slice/sshd.service\n"),
+	},
 }
@@ -1,7 +1,8 @@
 // Copyright (c) Microsoft Corporation.
 // Licensed under the MIT license.
 
-// Package infiniband contains the Retina infiniband plugin. It gathers infiniband statistics and debug status parameters.
+// Package infiniband contains the Retina infiniband plugin. It gathers infiniband statistics and debug status parameters,
+// and the hardware counters and resources of the RDMA devices through RDMA netlink.
 package infiniband
 
 import (
@@ -11,6 +12,7 @@ import (
 
 	hubblev1 "github.com/cilium/cilium/pkg/hubble/api/v1"
 	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/enricher"
 	"github.com/microsoft/retina/pkg/log"
 	"github.com/microsoft/retina/pkg/plugin/registry"
 	"go.uber.org/zap"
@@ -67,13 +69,20 @@ func (ib *infiniband) run(ctx context.Context) error {
 	ticker := time.NewTicker(ib.cfg.MetricsInterval)
 	defer ticker.Stop()
 
+	// Pods owning RDMA resources are only resolved when pod level is enabled.
+	var e enricher.EnricherInterface
+	if ib.cfg.EnablePodLevel && enricher.IsInitialized() {
+		e = enricher.Instance()
+	}
+	// The reader is kept across ticks to delete the label sets of the RDMA resources which are gone.
+	infinibandReader := NewInfinibandReader(rdmaHandle{}, e)
+
 	for {
 		select {
 		case <-ctx.Done():
 			ib.l.Info("Context is done, infiniband will stop running")
 			return nil
 		case <-ticker.C:
-			infinibandReader := NewInfinibandReader()
 			err := infinibandReader.readAndUpdate()
 			if err != nil {
 				ib.l.Error("Reading infiniband stats failed", zap.Error(err))
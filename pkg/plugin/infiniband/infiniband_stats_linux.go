@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/microsoft/retina/pkg/enricher"
 	"github.com/microsoft/retina/pkg/log"
 	"github.com/microsoft/retina/pkg/metrics"
 	"github.com/pkg/errors"
@@ -19,6 +20,7 @@ import (
 const (
 	pathInfiniband            = "/sys/class/infiniband"
 	pathDebugStatusParameters = "/sys/class/net"
+	pathProc                  = "/proc"
 )
 
 const (
@@ -26,18 +28,52 @@ const (
 	InfinibandIfacePrefix  = "ib"
 )
 
-func NewInfinibandReader() *InfinibandReader {
+const (
+	resourceQueuePair    = "qp"
+	resourceMemoryRegion = "mr"
+)
+
+// hwCounters are the hardware counters of the ports which are exported, the transport errors of the queue pairs.
+var hwCounters = map[string]struct{}{
+	"out_of_sequence":       {},
+	"packet_seq_err":        {},
+	"rnr_nak_retry_err":     {},
+	"local_ack_timeout_err": {},
+}
+
+// NewInfinibandReader creates a reader of the infiniband statistics. The RDMA netlink reader is optional and reads the
+// hardware counters and the resources of the RDMA devices. The enricher is optional and resolves the pods owning the
+// resources.
+func NewInfinibandReader(rdma rdmaNetlink, e enricher.EnricherInterface) *InfinibandReader {
 	return &InfinibandReader{
-		l:                log.Logger().Named(string("InfinibandReader")),
-		counterStats:     make(map[CounterStat]uint64),
-		statusParamStats: make(map[StatusParam]uint64),
+		l:                  log.Logger().Named(string("InfinibandReader")),
+		rdma:               rdma,
+		enricher:           e,
+		counterStats:       make(map[CounterStat]uint64),
+		statusParamStats:   make(map[StatusParam]uint64),
+		hwCounterStats:     make(map[CounterStat]uint64),
+		queuePairStats:     make(map[QueuePairStat]uint64),
+		podResourceStats:   make(map[PodResource]uint64),
+		exportedHWCounters: make(map[CounterStat]struct{}),
+		exportedQueuePairs: make(map[QueuePairStat]struct{}),
+		exportedResources:  make(map[PodResource]struct{}),
 	}
 }
 
 type InfinibandReader struct { // nolint // clearer naming
 	l                *log.ZapLogger
+	rdma             rdmaNetlink
+	enricher         enricher.EnricherInterface
 	counterStats     map[CounterStat]uint64
 	statusParamStats map[StatusParam]uint64
+	hwCounterStats   map[CounterStat]uint64
+	queuePairStats   map[QueuePairStat]uint64
+	podResourceStats map[PodResource]uint64
+
+	// the label sets exported by the last update, to delete the ones of removed ports, queue pairs and pods
+	exportedHWCounters map[CounterStat]struct{}
+	exportedQueuePairs map[QueuePairStat]struct{}
+	exportedResources  map[PodResource]struct{}
 }
 
 func (ir *InfinibandReader) readAndUpdate() error {
@@ -48,6 +84,11 @@ func (ir *InfinibandReader) readAndUpdate() error {
 	netFS := os.DirFS(pathDebugStatusParameters)
 	g.Go(func() error { return ir.readStatusParamStats(netFS) })
 
+	if ir.rdma != nil {
+		procFS := os.DirFS(pathProc)
+		g.Go(func() error { return ir.readRdmaStats(procFS) })
+	}
+
 	err := g.Wait()
 	ir.updateMetrics()
 	ir.l.Debug("Done reading and updating stats")
@@ -130,6 +171,72 @@ func (ir *InfinibandReader) readStatusParamStats(fsys fs.FS) error {
 	return nil
 }
 
+// readRdmaStats reads the hardware counters, queue pairs and memory regions of the RDMA devices through RDMA netlink,
+// and resolves the pods of the processes owning the resources from their cgroups in procFS.
+func (ir *InfinibandReader) readRdmaStats(procFS fs.FS) error {
+	links, err := ir.rdma.LinkList()
+	if err != nil {
+		ir.l.Error("error listing RDMA devices:", zap.Error(err))
+		return err // nolint std. fmt.
+	}
+
+	var pods *podResolver
+	if ir.enricher != nil {
+		pods = newPodResolver(procFS, ir.enricher)
+	}
+	ir.hwCounterStats = make(map[CounterStat]uint64)
+	ir.queuePairStats = make(map[QueuePairStat]uint64)
+	ir.podResourceStats = make(map[PodResource]uint64)
+	for _, link := range links {
+		device := link.Attrs.Name
+		for port := uint32(1); port <= link.Attrs.NumPorts; port++ {
+			stats, err := ir.rdma.PortStatistics(link, port)
+			if err != nil {
+				ir.l.Error("error reading RDMA port statistics:", zap.Error(err))
+				continue
+			}
+			for name, val := range stats.Statistics {
+				if _, ok := hwCounters[name]; ok {
+					ir.hwCounterStats[CounterStat{Name: name, Device: device, Port: strconv.FormatUint(uint64(port), 10)}] = val
+				}
+			}
+		}
+
+		qps, err := ir.rdma.QueuePairs(link)
+		if err != nil {
+			ir.l.Error("error reading RDMA queue pairs:", zap.Error(err))
+		}
+		for _, qp := range qps {
+			ir.queuePairStats[QueuePairStat{
+				Device: device,
+				Port:   strconv.FormatUint(uint64(qp.Port), 10),
+				State:  qpStateName(qp.State),
+				Type:   qpTypeName(qp.Type),
+			}]++
+			ir.countPodResource(pods, device, resourceQueuePair, qp.PID)
+		}
+
+		mrs, err := ir.rdma.MemoryRegions(link)
+		if err != nil {
+			ir.l.Error("error reading RDMA memory regions:", zap.Error(err))
+		}
+		for _, mr := range mrs {
+			ir.countPodResource(pods, device, resourceMemoryRegion, mr.PID)
+		}
+	}
+	return nil
+}
+
+// countPodResource counts a resource of a device owned by a process in its pod, when pods are resolved. The resources
+// of the kernel and of the processes outside pods are counted without pod.
+func (ir *InfinibandReader) countPodResource(pods *podResolver, device, resource string, pid uint32) {
+	if pods == nil {
+		return
+	}
+	p := pods.resolve(pid)
+	ir.podResourceStats[PodResource{Device: device, Namespace: p.namespace, PodName: p.name, Resource: resource}]++
+}
+
 func (ir *InfinibandReader) updateMetrics() {
 	// Adding counter stats
 	for counter, val := range ir.counterStats {
@@ -140,4 +247,26 @@ func (ir *InfinibandReader) updateMetrics() {
 	for statusParam, val := range ir.statusParamStats {
 		metrics.InfinibandStatusParamsGauge.WithLabelValues(statusParam.Name, statusParam.Iface).Set(float64(val))
 	}
+
+	ir.exportedHWCounters = export(metrics.InfinibandHWCounterStatsGauge, ir.hwCounterStats, ir.exportedHWCounters,
+		func(k CounterStat) []string { return []string{k.Name, k.Device, k.Port} })
+	ir.exportedQueuePairs = export(metrics.InfinibandQueuePairsGauge, ir.queuePairStats, ir.exportedQueuePairs,
+		func(k QueuePairStat) []string { return []string{k.Device, k.Port, k.State, k.Type} })
+	ir.exportedResources = export(metrics.InfinibandPodResourcesGauge, ir.podResourceStats, ir.exportedResources,
+		func(k PodResource) []string { return []string{k.Device, k.Namespace, k.PodName, k.Resource} })
+}
+
+// export sets the statistics in the gauge, and deletes the label sets of the previous export which are gone.
+func export[K comparable](gauge metrics.GaugeVec, stats map[K]uint64, previous map[K]struct{}, labels func(K) []string) map[K]struct{} {
+	exported := make(map[K]struct{}, len(stats))
+	for k, val := range stats {
+		gauge.WithLabelValues(labels(k)...).Set(float64(val))
+		exported[k] = struct{}{}
+	}
+	for k := range previous {
+		if _, ok := exported[k]; !ok {
+			gauge.DeleteLabelValues(labels(k)...)
+		}
+	}
+	return exported
 }
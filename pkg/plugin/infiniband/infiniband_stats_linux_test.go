@@ -3,12 +3,18 @@
 package infiniband
 
 import (
+	"errors"
 	"testing"
 
+	"github.com/microsoft/retina/pkg/common"
+	"github.com/microsoft/retina/pkg/enricher"
 	"github.com/microsoft/retina/pkg/log"
 	"github.com/microsoft/retina/pkg/metrics"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -22,7 +28,7 @@ func TestNewInfinibandReader(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	nr := NewInfinibandReader()
+	nr := NewInfinibandReader(nil, nil)
 	assert.NotNil(t, nr)
 }
 
@@ -62,7 +68,7 @@ func TestReadCounterStats(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
-			nr := NewInfinibandReader()
+			nr := NewInfinibandReader(nil, nil)
 			InitalizeMetricsForTesting(ctrl)
 
 			testmetric := prometheus.NewGauge(prometheus.GaugeOpts{
@@ -119,7 +125,7 @@ func TestReadStatusParamStats(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 
-			nr := NewInfinibandReader()
+			nr := NewInfinibandReader(nil, nil)
 			assert.NotNil(t, nr)
 
 			InitalizeMetricsForTesting(ctrl)
@@ -151,3 +157,119 @@ func TestReadStatusParamStats(t *testing.T) {
 		})
 	}
 }
+
+// fakeRdma is a fake RDMA netlink, with the statistics of the ports and the resources of the devices by device name.
+type fakeRdma struct {
+	links []*netlink.RdmaLink
+	stats map[string]map[uint32]map[string]uint64
+	qps   map[string][]rdmaResource
+	mrs   map[string][]rdmaResource
+	err   error
+}
+
+func (f *fakeRdma) LinkList() ([]*netlink.RdmaLink, error) {
+	return f.links, f.err
+}
+
+func (f *fakeRdma) PortStatistics(link *netlink.RdmaLink, port uint32) (*netlink.RdmaPortStatistic, error) {
+	return &netlink.RdmaPortStatistic{PortIndex: port, Statistics: f.stats[link.Attrs.Name][port]}, nil
+}
+
+func (f *fakeRdma) QueuePairs(link *netlink.RdmaLink) ([]rdmaResource, error) {
+	return f.qps[link.Attrs.Name], nil
+}
+
+func (f *fakeRdma) MemoryRegions(link *netlink.RdmaLink) ([]rdmaResource, error) {
+	return f.mrs[link.Attrs.Name], nil
+}
+
+func testPod(name string, containerIDs ...string) *common.RetinaEndpoint {
+	ep := common.NewRetinaEndpoint(name, "default", nil)
+	containers := make([]*common.RetinaContainer, 0, len(containerIDs))
+	for _, id := range containerIDs {
+		containers = append(containers, &common.RetinaContainer{Name: "c", ID: id})
+	}
+	ep.SetContainers(containers)
+	return ep
+}
+
+func TestReadRdmaStats(t *testing.T) {
+	log.SetupZapLogger(log.GetDefaultLogOpts()) //nolint std.
+	ctrl := gomock.NewController(t)
+
+	labels := map[string][]string{
+		"hw":        {"statistic_name", "device", "port"},
+		"qp":        {"device", "port", "state", "type"},
+		"resources": {"device", "namespace", "podname", "resource"},
+	}
+	gauges := make(map[string]*prometheus.GaugeVec, len(labels))
+	for n, l := range labels {
+		gauges[n] = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: n, Help: n}, l)
+	}
+	metrics.InfinibandHWCounterStatsGauge = gauges["hw"]
+	metrics.InfinibandQueuePairsGauge = gauges["qp"]
+	metrics.InfinibandPodResourcesGauge = gauges["resources"]
+	MockGaugeVec = metrics.NewMockGaugeVec(ctrl)
+	metrics.InfinibandStatsGauge = MockGaugeVec
+	metrics.InfinibandStatusParamsGauge = MockGaugeVec
+
+	e := enricher.NewMockEnricherInterface(ctrl)
+	e.EXPECT().Pods().Return([]*common.RetinaEndpoint{
+		testPod("trainer-0", "containerd://abc"),
+		testPod("trainer-1", "containerd://def"),
+	}).Times(2)
+
+	rdma := &fakeRdma{
+		links: []*netlink.RdmaLink{{Attrs: netlink.RdmaLinkAttrs{Name: "mlx5_0", NumPorts: 1}}},
+		stats: map[string]map[uint32]map[string]uint64{
+			"mlx5_0": {1: {"out_of_sequence": 3, "packet_seq_err": 1, "rx_write_requests": 100}},
+		},
+		qps: map[string][]rdmaResource{
+			"mlx5_0": {
+				{Port: 1, Type: 2, State: 3, PID: 1234},
+				{Port: 1, Type: 2, State: 3, PID: 1234},
+				{Port: 1, Type: 2, State: 6, PID: 5678},
+				{Port: 1, Type: 1, State: 3},
+			},
+		},
+		mrs: map[string][]rdmaResource{
+			"mlx5_0": {{PID: 1234}, {PID: 4321}, {PID: 9999}},
+		},
+	}
+	procFS, err := testFS.Sub("proc")
+	require.NoError(t, err)
+
+	ir := NewInfinibandReader(rdma, e)
+	require.NoError(t, ir.readRdmaStats(procFS))
+	ir.updateMetrics()
+
+	hw := gauges["hw"]
+	assert.Equal(t, 2, testutil.CollectAndCount(hw), "should only export the selected hardware counters")
+	assert.InDelta(t, 3, testutil.ToFloat64(hw.WithLabelValues("out_of_sequence", "mlx5_0", "1")), 0)
+
+	qp := gauges["qp"]
+	assert.Equal(t, 3, testutil.CollectAndCount(qp))
+	assert.InDelta(t, 2, testutil.ToFloat64(qp.WithLabelValues("mlx5_0", "1", "RTS", "RC")), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(qp.WithLabelValues("mlx5_0", "1", "ERR", "RC")), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(qp.WithLabelValues("mlx5_0", "1", "RTS", "GSI")), 0)
+
+	res := gauges["resources"]
+	assert.Equal(t, 5, testutil.CollectAndCount(res))
+	assert.InDelta(t, 2, testutil.ToFloat64(res.WithLabelValues("mlx5_0", "default", "trainer-0", "qp")), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(res.WithLabelValues("mlx5_0", "default", "trainer-1", "qp")), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(res.WithLabelValues("mlx5_0", "", "", "qp")), 0, "kernel queue pairs have no pod")
+	assert.InDelta(t, 1, testutil.ToFloat64(res.WithLabelValues("mlx5_0", "default", "trainer-0", "mr")), 0)
+	assert.InDelta(t, 2, testutil.ToFloat64(res.WithLabelValues("mlx5_0", "", "", "mr")), 0,
+		"memory regions of host and exited processes have no pod")
+
+	// The queue pairs of trainer-1 are destroyed.
+	rdma.qps["mlx5_0"] = rdma.qps["mlx5_0"][:2]
+	require.NoError(t, ir.readRdmaStats(procFS))
+	ir.updateMetrics()
+	assert.Equal(t, 1, testutil.CollectAndCount(qp), "should delete the queue pairs which are gone")
+	assert.Equal(t, 3, testutil.CollectAndCount(res), "should delete the resources of the pods which are gone")
+
+	// The devices can not be listed.
+	rdma.err = errors.New("protocol not supported")
+	require.Error(t, ir.readRdmaStats(procFS))
+}
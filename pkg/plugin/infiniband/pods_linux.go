@@ -0,0 +1,77 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package infiniband
+
+import (
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/microsoft/retina/pkg/enricher"
+	plugincommon "github.com/microsoft/retina/pkg/plugin/common"
+)
+
+// podRef is the namespace and name of a pod.
+type podRef struct {
+	namespace string
+	name      string
+}
+
+// podResolver resolves the pods of processes from the containers of their cgroups.
+type podResolver struct {
+	procFS      fs.FS
+	byContainer map[string]podRef
+	byPID       map[uint32]podRef
+}
+
+// newPodResolver creates a resolver of the pods in the cache of the enricher, which reads the cgroups of the processes
+// in procFS.
+func newPodResolver(procFS fs.FS, e enricher.EnricherInterface) *podResolver {
+	r := &podResolver{
+		procFS:      procFS,
+		byContainer: make(map[string]podRef),
+		byPID:       make(map[uint32]podRef),
+	}
+	for _, ep := range e.Pods() {
+		for _, c := range ep.Containers() {
+			if id := plugincommon.ContainerID(c.ID); id != "" {
+				r.byContainer[id] = podRef{namespace: ep.Namespace(), name: ep.Name()}
+			}
+		}
+	}
+	return r
+}
+
+// resolve returns the pod of a process, or no pod for the kernel (PID 0) and the processes outside pods.
+func (r *podResolver) resolve(pid uint32) podRef {
+	if pid == 0 {
+		return podRef{}
+	}
+	if p, ok := r.byPID[pid]; ok {
+		return p
+	}
+	p := r.lookup(pid)
+	r.byPID[pid] = p
+	return p
+}
+
+// lookup reads the cgroups of a process, whose lines are <hierarchy>:<controllers>:<path>, and returns the pod of the
+// first one which is the cgroup of a container.
+func (r *podResolver) lookup(pid uint32) podRef {
+	b, err := fs.ReadFile(r.procFS, path.Join(strconv.FormatUint(uint64(pid), 10), "cgroup"))
+	if err != nil {
+		// The process may have exited since its resources were dumped.
+		return podRef{}
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if p, ok := r.byContainer[plugincommon.CgroupContainerID(path.Base(fields[2]))]; ok {
+			return p
+		}
+	}
+	return podRef{}
+}
@@ -0,0 +1,192 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package infiniband
+
+import (
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+// Commands and attributes of RDMA netlink (include/uapi/rdma/rdma_netlink.h) which are not defined by the netlink
+// package.
+const (
+	rdmaNldevCmdResQPGet = 10
+	rdmaNldevCmdResMRGet = 13
+
+	rdmaNldevAttrResQP      = 19
+	rdmaNldevAttrResQPEntry = 20
+	rdmaNldevAttrResType    = 26
+	rdmaNldevAttrResState   = 27
+	rdmaNldevAttrResPID     = 28
+	rdmaNldevAttrResMR      = 40
+	rdmaNldevAttrResMREntry = 41
+)
+
+// rdmaNetlink reads the devices, hardware counters and resources of the RDMA subsystem.
+type rdmaNetlink interface {
+	LinkList() ([]*netlink.RdmaLink, error)
+	PortStatistics(link *netlink.RdmaLink, port uint32) (*netlink.RdmaPortStatistic, error)
+	QueuePairs(link *netlink.RdmaLink) ([]rdmaResource, error)
+	MemoryRegions(link *netlink.RdmaLink) ([]rdmaResource, error)
+}
+
+// rdmaResource is a queue pair or memory region of a device, as tracked by the RDMA subsystem.
+type rdmaResource struct {
+	// Port is the port of a queue pair, 0 until the queue pair is bound to a port.
+	Port uint32
+	// Type and State are the type and state of a queue pair.
+	Type  uint8
+	State uint8
+	// PID is the process owning the resource in the PID namespace of the reader, 0 for the resources of the kernel.
+	PID uint32
+}
+
+// rdmaHandle reads the RDMA subsystem through RDMA netlink.
+type rdmaHandle struct{}
+
+func (rdmaHandle) LinkList() ([]*netlink.RdmaLink, error) {
+	links, err := netlink.RdmaLinkList()
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return nil, errors.Wrap(err, "failed to list RDMA devices")
+	}
+	return links, nil
+}
+
+func (rdmaHandle) PortStatistics(link *netlink.RdmaLink, port uint32) (*netlink.RdmaPortStatistic, error) {
+	stats, err := netlink.RdmaPortStatisticList(link, port)
+	return stats, errors.Wrapf(err, "failed to read statistics of RDMA device %s port %d", link.Attrs.Name, port)
+}
+
+func (rdmaHandle) QueuePairs(link *netlink.RdmaLink) ([]rdmaResource, error) {
+	return dumpResources(link, rdmaNldevCmdResQPGet, rdmaNldevAttrResQP, rdmaNldevAttrResQPEntry)
+}
+
+func (rdmaHandle) MemoryRegions(link *netlink.RdmaLink) ([]rdmaResource, error) {
+	return dumpResources(link, rdmaNldevCmdResMRGet, rdmaNldevAttrResMR, rdmaNldevAttrResMREntry)
+}
+
+// dumpResources dumps the resources of a device, as `rdma resource show qp|mr dev <device>` does. The kernel only
+// dumps the resources of the processes visible in the PID namespace of the reader, and the resources of the kernel
+// in the initial PID namespace.
+func dumpResources(link *netlink.RdmaLink, cmd int, table, entry uint16) ([]rdmaResource, error) {
+	req := nl.NewNetlinkRequest(nl.RDMA_NL_NLDEV<<nl.RDMA_NL_GET_CLIENT_SHIFT|cmd, unix.NLM_F_DUMP)
+	b := make([]byte, 4)
+	nl.NativeEndian().PutUint32(b, link.Attrs.Index)
+	req.AddData(nl.NewRtAttr(nl.RDMA_NLDEV_ATTR_DEV_INDEX, b))
+
+	msgs, err := req.Execute(unix.NETLINK_RDMA, 0)
+	if err != nil && !errors.Is(err, nl.ErrDumpInterrupted) {
+		return nil, errors.Wrapf(err, "failed to dump resources of RDMA device %s", link.Attrs.Name)
+	}
+
+	var resources []rdmaResource
+	for _, m := range msgs {
+		res, err := parseResources(m, table, entry)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse resources of RDMA device %s", link.Attrs.Name)
+		}
+		resources = append(resources, res...)
+	}
+	return resources, nil
+}
+
+// parseResources parses the resources in the nested table of a message, e.g. the queue pair entries of
+// RDMA_NLDEV_ATTR_RES_QP.
+func parseResources(msg []byte, table, entry uint16) ([]rdmaResource, error) {
+	attrs, err := nl.ParseRouteAttr(msg)
+	if err != nil {
+		return nil, err //nolint:wrapcheck // wrapped by the caller
+	}
+
+	var resources []rdmaResource
+	for i := range attrs {
+		if attrs[i].Attr.Type&nl.NLA_TYPE_MASK != table {
+			continue
+		}
+		entries, err := nl.ParseRouteAttr(attrs[i].Value)
+		if err != nil {
+			return nil, err //nolint:wrapcheck // wrapped by the caller
+		}
+		for j := range entries {
+			if entries[j].Attr.Type&nl.NLA_TYPE_MASK != entry {
+				continue
+			}
+			fields, err := nl.ParseRouteAttr(entries[j].Value)
+			if err != nil {
+				return nil, err //nolint:wrapcheck // wrapped by the caller
+			}
+			resources = append(resources, newRdmaResource(fields))
+		}
+	}
+	return resources, nil
+}
+
+func newRdmaResource(fields []syscall.NetlinkRouteAttr) rdmaResource {
+	var res rdmaResource
+	for i := range fields {
+		v := fields[i].Value
+		switch fields[i].Attr.Type & nl.NLA_TYPE_MASK {
+		case nl.RDMA_NLDEV_ATTR_PORT_INDEX:
+			if len(v) >= 4 {
+				res.Port = nl.NativeEndian().Uint32(v)
+			}
+		case rdmaNldevAttrResType:
+			if len(v) >= 1 {
+				res.Type = v[0]
+			}
+		case rdmaNldevAttrResState:
+			if len(v) >= 1 {
+				res.State = v[0]
+			}
+		case rdmaNldevAttrResPID:
+			if len(v) >= 4 {
+				res.PID = nl.NativeEndian().Uint32(v)
+			}
+		}
+	}
+	return res
+}
+
+// qpStates are the names of the states of queue pairs (enum ib_qp_state), as shown by the rdma tool.
+var qpStates = map[uint8]string{
+	0: "RESET",
+	1: "INIT",
+	2: "RTR",
+	3: "RTS",
+	4: "SQD",
+	5: "SQE",
+	6: "ERR",
+}
+
+// qpTypes are the names of the types of queue pairs (enum ib_qp_type), as shown by the rdma tool.
+var qpTypes = map[uint8]string{
+	0:    "SMI",
+	1:    "GSI",
+	2:    "RC",
+	3:    "UC",
+	4:    "UD",
+	5:    "RAW_IPV6",
+	6:    "RAW_ETHERTYPE",
+	8:    "RAW_PACKET",
+	9:    "XRC_INI",
+	10:   "XRC_TGT",
+	0xff: "DRIVER",
+}
+
+func qpStateName(state uint8) string {
+	if s, ok := qpStates[state]; ok {
+		return s
+	}
+	return "UNKNOWN"
+}
+
+func qpTypeName(typ uint8) string {
+	if s, ok := qpTypes[typ]; ok {
+		return s
+	}
+	return "UNKNOWN"
+}
@@ -0,0 +1,55 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package infiniband
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+func qpEntry(port uint32, typ, state uint8, pid uint32) *nl.RtAttr {
+	entry := nl.NewRtAttr(unix.NLA_F_NESTED|rdmaNldevAttrResQPEntry, nil)
+	entry.AddRtAttr(nl.RDMA_NLDEV_ATTR_PORT_INDEX, nl.Uint32Attr(port))
+	entry.AddRtAttr(rdmaNldevAttrResType, nl.Uint8Attr(typ))
+	entry.AddRtAttr(rdmaNldevAttrResState, nl.Uint8Attr(state))
+	if pid != 0 {
+		entry.AddRtAttr(rdmaNldevAttrResPID, nl.Uint32Attr(pid))
+	} else {
+		entry.AddRtAttr(29, nl.ZeroTerminated("ib_core")) // RDMA_NLDEV_ATTR_RES_KERN_NAME
+	}
+	return entry
+}
+
+func TestParseResources(t *testing.T) {
+	table := nl.NewRtAttr(unix.NLA_F_NESTED|rdmaNldevAttrResQP, nil)
+	table.AddChild(qpEntry(1, 2, 3, 1234))
+	table.AddChild(qpEntry(0, 1, 0, 0))
+	var msg []byte
+	msg = append(msg, nl.NewRtAttr(nl.RDMA_NLDEV_ATTR_DEV_INDEX, nl.Uint32Attr(0)).Serialize()...)
+	msg = append(msg, nl.NewRtAttr(nl.RDMA_NLDEV_ATTR_DEV_NAME, nl.ZeroTerminated("mlx5_0")).Serialize()...)
+	msg = append(msg, table.Serialize()...)
+
+	resources, err := parseResources(msg, rdmaNldevAttrResQP, rdmaNldevAttrResQPEntry)
+	require.NoError(t, err)
+	assert.Equal(t, []rdmaResource{
+		{Port: 1, Type: 2, State: 3, PID: 1234},
+		{Port: 0, Type: 1, State: 0},
+	}, resources)
+
+	resources, err = parseResources(msg, rdmaNldevAttrResMR, rdmaNldevAttrResMREntry)
+	require.NoError(t, err)
+	assert.Empty(t, resources, "should only parse the entries of the table")
+}
+
+func TestQPNames(t *testing.T) {
+	assert.Equal(t, "RTS", qpStateName(3))
+	assert.Equal(t, "ERR", qpStateName(6))
+	assert.Equal(t, "UNKNOWN", qpStateName(42))
+	assert.Equal(t, "RC", qpTypeName(2))
+	assert.Equal(t, "DRIVER", qpTypeName(0xff))
+	assert.Equal(t, "UNKNOWN", qpTypeName(42))
+}
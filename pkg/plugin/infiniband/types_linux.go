@@ -29,3 +29,19 @@ type StatusParam struct {
 	Name  string
 	Iface string
 }
+
+// QueuePairStat are the labels of the queue pairs of a port in a state.
+type QueuePairStat struct {
+	Device string
+	Port   string
+	State  string
+	Type   string
+}
+
+// PodResource are the labels of the queue pairs or memory regions of a device owned by the processes of a pod.
+type PodResource struct {
+	Device    string
+	Namespace string
+	PodName   string
+	Resource  string
+}
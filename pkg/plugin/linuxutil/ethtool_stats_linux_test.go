@@ -195,5 +195,6 @@ func InitalizeMetricsForTesting(ctrl *gomock.Controller) {
 	metrics.IPConnectionStatsGauge = MockGaugeVec
 	metrics.UDPConnectionStatsGauge = MockGaugeVec
 	metrics.InterfaceStatsGauge = MockGaugeVec
+	metrics.SoftnetStatsGauge = MockGaugeVec
 	metrics.PluginManagerFailedToReconcileCounter = MockCounterVec
 }
@@ -1,7 +1,7 @@
 // Copyright (c) Microsoft Corporation.
 // Licensed under the MIT license.
 
-// Package linuxutil contains the Retina linuxutil plugin. It gathers TCP/UDP statistics and network interface statistics from the netstats and ethtool node utilities (respectively).
+// Package linuxutil contains the Retina linuxutil plugin. It gathers TCP/UDP statistics, network interface statistics and per-CPU packet receive processing statistics from the netstats and ethtool node utilities and /proc/net/softnet_stat (respectively).
 package linuxutil
 
 import (
@@ -99,6 +99,16 @@ func (lu *linuxUtil) run(ctx context.Context) error {
 				}
 			}()
 
+			snReader := NewSoftnetReader()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := snReader.readAndUpdate()
+				if err != nil {
+					lu.l.Error("Reading softnet_stat failed", zap.Error(err))
+				}
+			}()
+
 			ethtoolOpts := &EthtoolOpts{
 				errOrDropKeysOnly: true,
 				addZeroVal:        false,
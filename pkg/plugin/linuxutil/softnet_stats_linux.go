@@ -0,0 +1,117 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package linuxutil
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+const (
+	pathNetSoftnetStat = "/proc/net/softnet_stat"
+
+	// Statistic names of the softnet_stats metric
+	softnetProcessed      = "processed"
+	softnetDropped        = "dropped"
+	softnetTimeSqueeze    = "time_squeeze"
+	softnetFlowLimitCount = "flow_limit_count"
+
+	// Columns of /proc/net/softnet_stat, see softnet_seq_show in net/core/net-procfs.c
+	softnetProcessedColumn      = 0
+	softnetDroppedColumn        = 1
+	softnetTimeSqueezeColumn    = 2
+	softnetFlowLimitCountColumn = 10
+	// the CPU column is only present since Linux 5.10, before that a line is printed for each online CPU in order
+	softnetCPUColumn = 12
+)
+
+var errNoSoftnetStats = errors.New("no softnet statistics found")
+
+type SoftnetReader struct {
+	l     *log.ZapLogger
+	stats []SoftnetStats
+}
+
+func NewSoftnetReader() *SoftnetReader {
+	return &SoftnetReader{
+		l: log.Logger().Named(string("SoftnetReader")),
+	}
+}
+
+func (sr *SoftnetReader) readAndUpdate() error {
+	if err := sr.readSoftnetStats(pathNetSoftnetStat); err != nil {
+		return err
+	}
+
+	sr.updateMetrics()
+	sr.l.Debug("Done reading and updating softnet stats")
+
+	return nil
+}
+
+// readSoftnetStats reads the statistics of each CPU. Each line of the file is the statistics of a CPU, as hexadecimal
+// columns, and the kernel added columns over time, so the columns which are not present are left at 0.
+func (sr *SoftnetReader) readSoftnetStats(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		sr.l.Error("Error while reading softnet_stat path file", zap.Error(err))
+		return err
+	}
+
+	sr.stats = sr.stats[:0]
+	for i, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) <= softnetTimeSqueezeColumn {
+			continue
+		}
+
+		values := make([]uint64, len(fields))
+		valid := true
+		for j, f := range fields {
+			values[j], err = strconv.ParseUint(f, 16, 32)
+			if err != nil {
+				valid = false
+				break
+			}
+		}
+		if !valid {
+			sr.l.Debug("Invalid softnet_stat line", zap.String("line", line))
+			continue
+		}
+
+		stats := SoftnetStats{
+			CPU:         i,
+			Processed:   values[softnetProcessedColumn],
+			Dropped:     values[softnetDroppedColumn],
+			TimeSqueeze: values[softnetTimeSqueezeColumn],
+		}
+		if len(values) > softnetFlowLimitCountColumn {
+			stats.FlowLimitCount = values[softnetFlowLimitCountColumn]
+		}
+		if len(values) > softnetCPUColumn {
+			stats.CPU = int(values[softnetCPUColumn])
+		}
+		sr.stats = append(sr.stats, stats)
+	}
+
+	if len(sr.stats) == 0 {
+		return errNoSoftnetStats
+	}
+	return nil
+}
+
+func (sr *SoftnetReader) updateMetrics() {
+	for _, stats := range sr.stats {
+		cpu := strconv.Itoa(stats.CPU)
+		metrics.SoftnetStatsGauge.WithLabelValues(cpu, softnetProcessed).Set(float64(stats.Processed))
+		metrics.SoftnetStatsGauge.WithLabelValues(cpu, softnetDropped).Set(float64(stats.Dropped))
+		metrics.SoftnetStatsGauge.WithLabelValues(cpu, softnetTimeSqueeze).Set(float64(stats.TimeSqueeze))
+		metrics.SoftnetStatsGauge.WithLabelValues(cpu, softnetFlowLimitCount).Set(float64(stats.FlowLimitCount))
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package linuxutil
+
+import (
+	"testing"
+
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gomock "go.uber.org/mock/gomock"
+)
+
+func TestReadSoftnetStats(t *testing.T) {
+	log.SetupZapLogger(log.GetDefaultLogOpts())
+	tests := []struct {
+		name     string
+		filePath string
+		result   []SoftnetStats
+		wantErr  bool
+	}{
+		{
+			name:     "test correct",
+			filePath: "testdata/correct-softnet_stat",
+			result: []SoftnetStats{
+				{CPU: 0, Processed: 240461, Dropped: 0, TimeSqueeze: 2},
+				// the CPU column is used when CPUs are offline
+				{CPU: 2, Processed: 127648, Dropped: 17, TimeSqueeze: 27, FlowLimitCount: 4},
+			},
+		},
+		{
+			name:     "test kernel without cpu column",
+			filePath: "testdata/old-softnet_stat",
+			result: []SoftnetStats{
+				{CPU: 0, Processed: 255, Dropped: 1, TimeSqueeze: 2, FlowLimitCount: 3},
+				{CPU: 1, Processed: 256},
+			},
+		},
+		{
+			name:     "test wrong",
+			filePath: "testdata/wrong-softnet_stat",
+			wantErr:  true,
+		},
+		{
+			name:     "test missing file",
+			filePath: "testdata/nonexistent-softnet_stat",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sr := NewSoftnetReader()
+			require.NotNil(t, sr)
+
+			err := sr.readSoftnetStats(tt.filePath)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.result, sr.stats)
+		})
+	}
+}
+
+func TestSoftnetUpdateMetrics(t *testing.T) {
+	log.SetupZapLogger(log.GetDefaultLogOpts())
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	InitalizeMetricsForTesting(ctrl)
+
+	sr := NewSoftnetReader()
+	require.NoError(t, sr.readSoftnetStats("testdata/correct-softnet_stat"))
+
+	testmetric := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "testmetric",
+		Help: "testmetric",
+	})
+	// each CPU exports all of its statistics, including the zero ones
+	for _, stat := range []string{softnetProcessed, softnetDropped, softnetTimeSqueeze, softnetFlowLimitCount} {
+		MockGaugeVec.EXPECT().WithLabelValues("0", stat).Return(testmetric).Times(1)
+		MockGaugeVec.EXPECT().WithLabelValues("2", stat).Return(testmetric).Times(1)
+	}
+
+	sr.updateMetrics()
+}
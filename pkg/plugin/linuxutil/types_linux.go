@@ -79,6 +79,19 @@ type SocketStats struct {
 	socketByRemoteAddr map[string]int
 }
 
+// SoftnetStats are the statistics of the packet receive processing of a CPU, from /proc/net/softnet_stat.
+type SoftnetStats struct {
+	CPU int
+	// Processed is the number of packets processed
+	Processed uint64
+	// Dropped is the number of packets dropped because the receive backlog of the CPU was full
+	Dropped uint64
+	// TimeSqueeze is the number of times the processing ran out of budget or time with work remaining
+	TimeSqueeze uint64
+	// FlowLimitCount is the number of packets dropped by the flow limit of the receive backlog
+	FlowLimitCount uint64
+}
+
 type NetstatOpts struct {
 	// when true only includes curated list of keys
 	CuratedKeys bool
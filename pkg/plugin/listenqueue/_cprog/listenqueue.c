@@ -0,0 +1,117 @@
+//go:build ignore
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+// Kprobes on the TCP functions which drop the packets of a listening socket when its SYN queue or accept queue is full
+// (or answer them with a SYN cookie for the SYN queue). The overflows are counted by network namespace and port, and
+// sent to the plugin with the headers of the packet. The fields of the kernel structures are read with CO-RE, so the
+// program loads on the kernels whose layouts differ from vmlinux.h.
+
+#include "vmlinux.h"
+#include "bpf_helpers.h"
+#include "bpf_core_read.h"
+#include "bpf_tracing.h"
+#include "listenqueue.h"
+
+char __license[] SEC("license") = "Dual MIT/GPL";
+
+// Needed by bpf2go's -type flag to generate the Go structs.
+const struct overflow_key *unused_overflow_key __attribute__((unused));
+const struct overflow_value *unused_overflow_value __attribute__((unused));
+const struct event *unused_event __attribute__((unused));
+
+struct
+{
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __type(key, struct overflow_key);
+    __type(value, struct overflow_value);
+    __uint(max_entries, OVERFLOWS_MAX_ENTRIES);
+} retina_lq_ovf SEC(".maps");
+
+struct
+{
+    __uint(type, BPF_MAP_TYPE_PERF_EVENT_ARRAY);
+    __uint(key_size, sizeof(__u32));
+    __uint(value_size, sizeof(__u32));
+} retina_lq_evts SEC(".maps");
+
+static __always_inline void record_overflow(void *ctx, struct sock *sk, struct sk_buff *skb, __u8 queue, __u32 backlog,
+                                            __u32 max_backlog)
+{
+    struct event ev;
+    // The padding is sent to the plugin too.
+    __builtin_memset(&ev, 0, sizeof(ev));
+    ev.timestamp = bpf_ktime_get_ns();
+    ev.netns = BPF_CORE_READ(sk, __sk_common.skc_net.net, ns.inum);
+    ev.port = BPF_CORE_READ(sk, __sk_common.skc_num);
+    ev.queue = queue;
+    ev.backlog = backlog;
+    ev.max_backlog = max_backlog;
+
+    unsigned char *head = BPF_CORE_READ(skb, head);
+    bpf_probe_read_kernel(ev.hdr, sizeof(ev.hdr), head + BPF_CORE_READ(skb, network_header));
+    bpf_probe_read_kernel(ev.th, sizeof(ev.th), head + BPF_CORE_READ(skb, transport_header));
+
+    struct overflow_key key = {.netns = ev.netns, .port = ev.port};
+    struct overflow_value *value = bpf_map_lookup_elem(&retina_lq_ovf, &key);
+    if (!value)
+    {
+        struct overflow_value zero = {};
+        bpf_map_update_elem(&retina_lq_ovf, &key, &zero, BPF_NOEXIST);
+        value = bpf_map_lookup_elem(&retina_lq_ovf, &key);
+    }
+    if (value)
+    {
+        if (queue == QUEUE_SYN)
+            __sync_fetch_and_add(&value->syn_queue, 1);
+        else
+            __sync_fetch_and_add(&value->accept_queue, 1);
+    }
+
+    bpf_perf_event_output(ctx, &retina_lq_evts, BPF_F_CURRENT_CPU, &ev, sizeof(ev));
+}
+
+// check_queues records an overflow if the accept queue of the listening socket is full, as sk_acceptq_is_full(), or
+// with syn_queue if its SYN queue is full, as inet_csk_reqsk_queue_is_full().
+static __always_inline void check_queues(void *ctx, struct sock *sk, struct sk_buff *skb, bool syn_queue)
+{
+    __u32 max_backlog = BPF_CORE_READ(sk, sk_max_ack_backlog);
+
+    if (syn_queue)
+    {
+        struct inet_connection_sock *icsk = (struct inet_connection_sock *)sk;
+        __u32 qlen = BPF_CORE_READ(icsk, icsk_accept_queue.qlen.counter);
+        if (qlen >= max_backlog)
+        {
+            record_overflow(ctx, sk, skb, QUEUE_SYN, qlen, max_backlog);
+            return;
+        }
+    }
+
+    __u32 backlog = BPF_CORE_READ(sk, sk_ack_backlog);
+    if (backlog > max_backlog)
+        record_overflow(ctx, sk, skb, QUEUE_ACCEPT, backlog, max_backlog);
+}
+
+SEC("kprobe/tcp_conn_request")
+int BPF_KPROBE(retina_lq_conn_request, struct request_sock_ops *rsk_ops, const struct tcp_request_sock_ops *af_ops,
+               struct sock *sk, struct sk_buff *skb)
+{
+    check_queues(ctx, sk, skb, true);
+    return 0;
+}
+
+SEC("kprobe/tcp_v4_syn_recv_sock")
+int BPF_KPROBE(retina_lq_syn_recv_v4, struct sock *sk, struct sk_buff *skb)
+{
+    check_queues(ctx, sk, skb, false);
+    return 0;
+}
+
+SEC("kprobe/tcp_v6_syn_recv_sock")
+int BPF_KPROBE(retina_lq_syn_recv_v6, struct sock *sk, struct sk_buff *skb)
+{
+    check_queues(ctx, sk, skb, false);
+    return 0;
+}
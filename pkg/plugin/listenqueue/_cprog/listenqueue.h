@@ -0,0 +1,42 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+#include "vmlinux.h"
+
+// Length of the IP header copied in the events, the IPv6 header or the IPv4 header with options.
+#define HDR_LEN 40
+// Length of the TCP header copied in the events, the ports.
+#define TH_LEN 4
+
+// Number of listening ports tracked, the entries of the network namespaces which are gone are deleted by the plugin.
+#define OVERFLOWS_MAX_ENTRIES 4096
+
+#define QUEUE_SYN 0
+#define QUEUE_ACCEPT 1
+
+// Key of the overflow counters, a listening port of a network namespace.
+struct overflow_key
+{
+    __u32 netns;
+    __u32 port;
+};
+
+// Overflow counters of a listening port.
+struct overflow_value
+{
+    __u64 syn_queue;
+    __u64 accept_queue;
+};
+
+// Overflow sent to the plugin, with the headers of the dropped packet.
+struct event
+{
+    __u64 timestamp;
+    __u32 netns;
+    __u16 port;
+    __u8 queue;
+    __u32 backlog;
+    __u32 max_backlog;
+    __u8 hdr[HDR_LEN];
+    __u8 th[TH_LEN];
+};
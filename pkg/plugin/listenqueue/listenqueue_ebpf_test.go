@@ -0,0 +1,149 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+//go:build ebpf && linux
+
+// Tests for the listenqueue kprobe programs.
+//
+// These load the compiled programs, verify they pass the kernel verifier and attach to the TCP functions, then overflow
+// the queues of a listening socket on the loopback and read the events and counters.
+//
+// Requires: root (or CAP_BPF+CAP_SYS_ADMIN), a kernel with BTF and kprobes.
+// Run: sudo go test -tags=ebpf -v -count=1 ./pkg/plugin/listenqueue/...
+
+package listenqueue
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"github.com/cilium/ebpf/perf"
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/plugin/ebpftest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func loadTestCollection(t *testing.T) *ebpf.Collection {
+	t.Helper()
+	ebpftest.RequirePrivileged(t)
+
+	spec, err := loadListenqueue()
+	require.NoError(t, err)
+	coll, err := ebpf.NewCollection(spec)
+	require.NoError(t, err)
+	t.Cleanup(func() { coll.Close() })
+	return coll
+}
+
+// attachTestKprobes attaches the programs, skipping the optional ones whose function does not exist.
+func attachTestKprobes(t *testing.T, coll *ebpf.Collection) {
+	t.Helper()
+	for _, h := range hooks {
+		l, err := link.Kprobe(h.fn, coll.Programs[h.program], nil)
+		if h.optional && err != nil {
+			continue
+		}
+		require.NoError(t, err, "should attach kprobe to %s", h.fn)
+		t.Cleanup(func() { l.Close() })
+	}
+}
+
+// TestHooks verifies the compiled object has a kprobe program for each hook and the maps.
+func TestHooks(t *testing.T) {
+	spec, err := loadListenqueue()
+	require.NoError(t, err)
+	require.Len(t, spec.Programs, len(hooks))
+	for _, h := range hooks {
+		p, ok := spec.Programs[h.program]
+		require.True(t, ok, h.program)
+		assert.Equal(t, "kprobe/"+h.fn, p.SectionName)
+	}
+	assert.Contains(t, spec.Maps, listenqueueMapRetinaLqOvf)
+	assert.Contains(t, spec.Maps, listenqueueMapRetinaLqEvts)
+}
+
+// TestBPFLoadAndVerify verifies the assembled programs pass the kernel verifier and all expected objects are created.
+func TestBPFLoadAndVerify(t *testing.T) {
+	coll := loadTestCollection(t)
+
+	for _, h := range hooks {
+		assert.NotNil(t, coll.Programs[h.program], "program %s should be loaded", h.program)
+	}
+	assert.NotNil(t, coll.Maps[listenqueueMapRetinaLqOvf], "overflow map should be created")
+	assert.NotNil(t, coll.Maps[listenqueueMapRetinaLqEvts], "perf event array map should be created")
+}
+
+// listen listens on the loopback with a backlog of 0, so that the queues overflow from the second connection.
+func listen(t *testing.T) uint16 {
+	t.Helper()
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_STREAM, 0)
+	require.NoError(t, err)
+	t.Cleanup(func() { unix.Close(fd) })
+	require.NoError(t, unix.Bind(fd, &unix.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}))
+	require.NoError(t, unix.Listen(fd, 0))
+	sa, err := unix.Getsockname(fd)
+	require.NoError(t, err)
+	return uint16(sa.(*unix.SockaddrInet4).Port) //nolint:gosec // ports are 16 bits
+}
+
+// TestBPFListenQueueOverflow verifies the overflows of the queues of a listening socket are counted and sent.
+func TestBPFListenQueueOverflow(t *testing.T) {
+	coll := loadTestCollection(t)
+	attachTestKprobes(t, coll)
+
+	reader, err := perf.NewReader(coll.Maps[listenqueueMapRetinaLqEvts], os.Getpagesize()*4)
+	require.NoError(t, err, "should create perf reader")
+	t.Cleanup(func() { reader.Close() })
+
+	port := listen(t)
+	for range 4 {
+		go func() {
+			conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(int(port))), time.Second)
+			if err == nil {
+				defer conn.Close()
+				time.Sleep(2 * time.Second)
+			}
+		}()
+	}
+
+	ev, ok := ebpftest.ReadPerfEvent[listenqueueEvent](t, reader, 5*time.Second)
+	require.True(t, ok, "should receive an overflow event")
+	assert.Equal(t, port, ev.Port)
+	assert.Zero(t, ev.MaxBacklog)
+
+	fl := toFlow(nil, &ev)
+	require.NotNil(t, fl)
+	assert.Equal(t, "127.0.0.1", fl.GetIP().GetSource())
+	assert.Equal(t, "127.0.0.1", fl.GetIP().GetDestination())
+	assert.EqualValues(t, port, fl.GetL4().GetTCP().GetDestinationPort())
+
+	inode, err := netnsInode(pathHostNetns)
+	require.NoError(t, err)
+	assert.Equal(t, inode, ev.Netns)
+	counters, err := (&ebpfOverflowMap{m: coll.Maps[listenqueueMapRetinaLqOvf]}).Counters()
+	require.NoError(t, err)
+	v, ok := counters[overflowKey{Netns: inode, Port: uint32(port)}]
+	require.True(t, ok, "should count the overflows of the port")
+	assert.Positive(t, v.SynQueue+v.AcceptQueue)
+}
+
+// TestBPFStopAfterInitWithoutStart verifies Stop() releases the kernel resources loaded by Init() when Start() is never
+// called.
+func TestBPFStopAfterInitWithoutStart(t *testing.T) {
+	ebpftest.RequirePrivileged(t)
+
+	log.SetupZapLogger(log.GetDefaultLogOpts())
+
+	p := New(&kcfg.Config{EnablePodLevel: true})
+	require.NoError(t, p.Init())
+	// Start() deliberately not called.
+	require.NoError(t, p.Stop(), "Stop() must clean up even without Start()")
+}
@@ -0,0 +1,276 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+// Package listenqueue contains the Retina listenqueue plugin. It utilizes eBPF to trace the overflows of the SYN and
+// accept queues of the TCP listening sockets, and samples the accept queues through netlink inet_diag, attributing both
+// to the pods and ports of the listening sockets.
+package listenqueue
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	v1 "github.com/cilium/cilium/pkg/hubble/api/v1"
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"github.com/cilium/ebpf/perf"
+	"github.com/microsoft/retina/internal/ktime"
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/metrics"
+	plugincommon "github.com/microsoft/retina/pkg/plugin/common"
+	_ "github.com/microsoft/retina/pkg/plugin/listenqueue/_cprog" // nolint // This is needed so cprog is included when vendoring
+	"github.com/microsoft/retina/pkg/plugin/registry"
+	"github.com/microsoft/retina/pkg/utils"
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+//go:generate go run github.com/cilium/ebpf/cmd/bpf2go@master -cflags "-g -O2 -Wall -D__TARGET_ARCH_${GOARCH} -Wall" -target ${GOARCH} -type overflow_key -type overflow_value -type event listenqueue ./_cprog/listenqueue.c -- -I../lib/_${GOARCH} -I../lib/common/libbpf/_src
+
+func init() {
+	registry.Add(name, New)
+}
+
+// New creates a listenqueue plugin.
+func New(cfg *kcfg.Config) registry.Plugin {
+	return &listenqueue{
+		cfg: cfg,
+		l:   log.Logger().Named(name),
+	}
+}
+
+func (lq *listenqueue) Name() string {
+	return name
+}
+
+// Generate and Compile are no-ops, the programs are compiled with bpf2go and embedded in the binary.
+func (lq *listenqueue) Generate(context.Context) error { return nil }
+func (lq *listenqueue) Compile(context.Context) error  { return nil }
+
+func (lq *listenqueue) Init() error {
+	// The pods of the listening sockets are resolved from the addresses of their network namespaces.
+	if !lq.cfg.EnablePodLevel {
+		lq.l.Warn("listenqueue will not init because pod level is disabled")
+		return nil
+	}
+
+	spec, err := loadListenqueue()
+	if err != nil {
+		return fmt.Errorf("failed to load eBPF spec: %w", err)
+	}
+	// The overflow counters are read by the plugin only, so there's nothing to pin.
+	coll, err := ebpf.NewCollection(spec)
+	if err != nil {
+		return fmt.Errorf("failed to load eBPF objects: %w", err)
+	}
+	// Clean up loaded objects if a later step fails.
+	ok := false
+	defer func() {
+		if !ok {
+			for _, h := range lq.hooks {
+				h.Close()
+			}
+			lq.hooks = nil
+			coll.Close()
+		}
+	}()
+
+	for _, h := range hooks {
+		l, err := link.Kprobe(h.fn, coll.Programs[h.program], nil)
+		if err != nil {
+			if h.optional {
+				lq.l.Info("Skipping optional kprobe", zap.String("function", h.fn), zap.Error(err))
+				continue
+			}
+			return fmt.Errorf("failed to attach kprobe to %s: %w", h.fn, err)
+		}
+		lq.hooks = append(lq.hooks, l)
+	}
+
+	reader, err := plugincommon.NewPerfReader(lq.l, coll.Maps[listenqueueMapRetinaLqEvts], perCPUBuffer, 1)
+	if err != nil {
+		return fmt.Errorf("failed to create perf reader: %w", err)
+	}
+
+	lq.coll = coll
+	lq.perfReader = reader
+	ok = true
+
+	lq.l.Info("listenqueue plugin initialized")
+	return nil
+}
+
+func (lq *listenqueue) Start(ctx context.Context) error {
+	if !lq.cfg.EnablePodLevel {
+		lq.l.Warn("listenqueue will not start because pod level is disabled")
+		return nil
+	}
+	if !enricher.IsInitialized() {
+		lq.l.Warn("retina enricher is not initialized, listen queue overflows will not be exported")
+		<-ctx.Done()
+		return nil
+	}
+	lq.enricher = enricher.Instance()
+	lq.reader = NewListenQueueReader(lq.enricher, &ebpfOverflowMap{m: lq.coll.Maps[listenqueueMapRetinaLqOvf]}, plugincommon.PathNetns, pathHostNetns)
+
+	return lq.run(ctx)
+}
+
+func (lq *listenqueue) run(ctx context.Context) error {
+	// readEvents returns once the perf reader is closed below, as its Read() blocks until then.
+	lq.wg.Add(1)
+	go func() {
+		defer lq.wg.Done()
+		lq.readEvents(ctx)
+	}()
+
+	ticker := time.NewTicker(lq.cfg.MetricsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			lq.l.Info("Context is done, listenqueue will stop running")
+			if err := lq.perfReader.Close(); err != nil {
+				lq.l.Warn("failed to close perf reader", zap.Error(err))
+			}
+			lq.wg.Wait()
+			return nil
+		case <-ticker.C:
+			if err := lq.reader.readAndUpdate(); err != nil {
+				lq.l.Error("Reading listen queue stats failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (lq *listenqueue) readEvents(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			record, err := lq.perfReader.Read()
+			if err != nil {
+				if errors.Is(err, perf.ErrClosed) {
+					return
+				}
+				lq.l.Error("Error reading perf event", zap.Error(err))
+				continue
+			}
+
+			if record.LostSamples > 0 {
+				metrics.LostEventsCounter.WithLabelValues(utils.Kernel, name).Add(float64(record.LostSamples))
+				continue
+			}
+
+			lq.handleEvent(record.RawSample)
+		}
+	}
+}
+
+func (lq *listenqueue) handleEvent(sample []byte) {
+	var ev listenqueueEvent
+	if err := binary.Read(bytes.NewReader(sample), binary.NativeEndian, &ev); err != nil {
+		lq.l.Error("Error reading bpf event", zap.Error(err), zap.Int("expected", binary.Size(ev)), zap.Int("actual", len(sample)))
+		return
+	}
+
+	fl := toFlow(lq.l, &ev)
+	if fl == nil {
+		return
+	}
+	e := &v1.Event{
+		Event:     fl,
+		Timestamp: fl.Time,
+	}
+
+	if lq.enricher != nil {
+		lq.enricher.Write(e)
+	}
+
+	if lq.externalChannel != nil {
+		select {
+		case lq.externalChannel <- e:
+		default:
+			metrics.LostEventsCounter.WithLabelValues(utils.ExternalChannel, name).Inc()
+		}
+	}
+}
+
+// toFlow returns the dropped flow of an overflow, from the client to the listening socket, or nil if the headers of
+// the packet cannot be parsed.
+func toFlow(l *log.ZapLogger, ev *listenqueueEvent) *flow.Flow {
+	var srcIP, dstIP net.IP
+	switch ev.Hdr[0] >> 4 {
+	case 4:
+		srcIP, dstIP = net.IP(ev.Hdr[12:16]), net.IP(ev.Hdr[16:20])
+	case 6:
+		srcIP, dstIP = net.IP(ev.Hdr[8:24]), net.IP(ev.Hdr[24:40])
+	default:
+		return nil
+	}
+	srcPort := binary.BigEndian.Uint16(ev.Th[0:2])
+	dstPort := binary.BigEndian.Uint16(ev.Th[2:4])
+
+	fl := utils.ToFlow(
+		l,
+		ktime.MonotonicOffset.Nanoseconds()+int64(ev.Timestamp), //nolint:gosec // timestamp fits in int64
+		srcIP, dstIP,
+		uint32(srcPort), uint32(dstPort),
+		unix.IPPROTO_TCP, 0,
+		flow.Verdict_DROPPED,
+	)
+	if fl == nil {
+		return nil
+	}
+	// IsReply is not applicable for DROPPED verdicts.
+	fl.IsReply = nil
+
+	ext := utils.NewExtensions()
+	if ev.Queue == 0 {
+		utils.AddDropReasonName(fl, ext, dropReasonSynQueueFull)
+	} else {
+		utils.AddDropReasonName(fl, ext, dropReasonAcceptQueueFull)
+	}
+	utils.SetExtensions(fl, ext)
+	return fl
+}
+
+func (lq *listenqueue) Stop() error {
+	if !lq.cfg.EnablePodLevel {
+		return nil
+	}
+	// Init() loads the eBPF objects, attaches the programs and creates the perf reader, which must be released even if
+	// Start() was not called.
+	if lq.perfReader != nil {
+		// Idempotent: run() already closes the reader on normal shutdown.
+		if err := lq.perfReader.Close(); err != nil {
+			lq.l.Warn("failed to close perf reader", zap.Error(err))
+		}
+	}
+	for _, h := range lq.hooks {
+		if err := h.Close(); err != nil {
+			lq.l.Warn("failed to close hook", zap.Error(err))
+		}
+	}
+	lq.hooks = nil
+	if lq.coll != nil {
+		lq.coll.Close()
+		lq.coll = nil
+	}
+	return nil
+}
+
+func (lq *listenqueue) SetupChannel(ch chan *v1.Event) error {
+	lq.externalChannel = ch
+	return nil
+}
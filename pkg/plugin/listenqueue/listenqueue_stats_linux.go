@@ -0,0 +1,263 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package listenqueue
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/cilium/ebpf"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/metrics"
+	plugincommon "github.com/microsoft/retina/pkg/plugin/common"
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+type listenerKey struct {
+	namespace string
+	podName   string
+	port      uint16
+}
+
+func (k listenerKey) labels() []string {
+	return []string{k.namespace, k.podName, strconv.Itoa(int(k.port))}
+}
+
+// netnsInfo is a network namespace whose listening sockets are exported, a pod or the host.
+type netnsInfo struct {
+	namespace string
+	podName   string
+	sockets   []*netlink.Socket
+}
+
+// ebpfOverflowMap reads the overflow counters from the eBPF map.
+type ebpfOverflowMap struct {
+	m *ebpf.Map
+}
+
+func (e *ebpfOverflowMap) Counters() (map[overflowKey]overflowValue, error) {
+	var (
+		k overflowKey
+		v overflowValue
+	)
+	counters := make(map[overflowKey]overflowValue)
+	iter := e.m.Iterate()
+	for iter.Next(&k, &v) {
+		counters[k] = v
+	}
+	if err := iter.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to iterate overflow counters")
+	}
+	return counters, nil
+}
+
+func (e *ebpfOverflowMap) Delete(k overflowKey) error {
+	return e.m.Delete(k) //nolint:wrapcheck // wrapped by the caller
+}
+
+type ListenQueueReader struct {
+	l         *log.ZapLogger
+	enricher  enricher.EnricherInterface
+	overflows overflowMap
+	netnsDir  string
+	hostNetns string
+	listeners []Listener
+
+	// the listeners exported by the last update, to delete the ones which are gone
+	exportedListeners map[listenerKey]struct{}
+}
+
+// NewListenQueueReader creates a reader of the listening sockets of the pods whose network namespaces are bind mounted
+// in netnsDir, and of the host network namespace at hostNetns. The enricher resolves the pods of the network namespaces
+// from their addresses.
+func NewListenQueueReader(e enricher.EnricherInterface, overflows overflowMap, netnsDir, hostNetns string) *ListenQueueReader {
+	return &ListenQueueReader{
+		l:                 log.Logger().Named(string("ListenQueueReader")),
+		enricher:          e,
+		overflows:         overflows,
+		netnsDir:          netnsDir,
+		hostNetns:         hostNetns,
+		exportedListeners: make(map[listenerKey]struct{}),
+	}
+}
+
+func (lr *ListenQueueReader) readAndUpdate() error {
+	if err := lr.readListeners(); err != nil {
+		return err
+	}
+
+	lr.updateMetrics()
+	lr.l.Debug("Done reading and updating listen queue stats")
+
+	return nil
+}
+
+// readListeners reads the overflow counters and the accept queues of the listening sockets of each network namespace
+// which belongs to a pod, and of the host.
+func (lr *ListenQueueReader) readListeners() error {
+	namespaces, err := lr.readNamespaces()
+	if err != nil {
+		return err
+	}
+
+	byKey := make(map[listenerKey]int)
+	lr.listeners = lr.listeners[:0]
+	listener := func(ns *netnsInfo, port uint16) *Listener {
+		k := listenerKey{namespace: ns.namespace, podName: ns.podName, port: port}
+		i, ok := byKey[k]
+		if !ok {
+			i = len(lr.listeners)
+			byKey[k] = i
+			lr.listeners = append(lr.listeners, Listener{Namespace: k.namespace, PodName: k.podName, Port: port})
+		}
+		return &lr.listeners[i]
+	}
+
+	for _, ns := range namespaces {
+		if ns == nil {
+			continue
+		}
+		for _, s := range ns.sockets {
+			l := listener(ns, s.ID.SourcePort)
+			l.AcceptQueue += s.RQueue
+			l.MaxAcceptQueue += s.WQueue
+		}
+	}
+
+	counters, err := lr.overflows.Counters()
+	if err != nil {
+		return err
+	}
+	for k, v := range counters {
+		ns, ok := namespaces[k.Netns]
+		if !ok {
+			// The network namespace is gone, its counters are deleted so that the map does not fill up.
+			if err := lr.overflows.Delete(k); err != nil {
+				lr.l.Debug("Error while deleting overflow counters", zap.Uint32("netns", k.Netns), zap.Error(err))
+			}
+			continue
+		}
+		if ns == nil {
+			// not the network namespace of a pod known to the cache
+			continue
+		}
+		l := listener(ns, uint16(k.Port)) //nolint:gosec // ports are 16 bits
+		l.SynQueueOverflows += v.SynQueue
+		l.AcceptQueueOverflows += v.AcceptQueue
+	}
+	return nil
+}
+
+// readNamespaces returns the network namespaces by inode, with their listening sockets. The namespaces which are not
+// pods known to the cache are nil, so that their counters are kept until the pods are.
+func (lr *ListenQueueReader) readNamespaces() (map[uint32]*netnsInfo, error) {
+	entries, err := os.ReadDir(lr.netnsDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list network namespaces in %s", lr.netnsDir)
+	}
+
+	namespaces := make(map[uint32]*netnsInfo, len(entries)+1)
+	paths := make([]string, 0, len(entries)+1)
+	paths = append(paths, lr.hostNetns)
+	for _, entry := range entries {
+		paths = append(paths, filepath.Join(lr.netnsDir, entry.Name()))
+	}
+	for i, path := range paths {
+		// A pod may have been deleted since the listing, its namespace is skipped.
+		inode, err := netnsInode(path)
+		if err != nil {
+			lr.l.Debug("Error while reading network namespace", zap.String("netns", path), zap.Error(err))
+			continue
+		}
+		if _, ok := namespaces[inode]; ok {
+			continue
+		}
+		ns, err := lr.readNetns(path, i == 0)
+		if err != nil {
+			lr.l.Debug("Error while reading listening sockets of network namespace", zap.String("netns", path), zap.Error(err))
+		}
+		namespaces[inode] = ns
+	}
+	return namespaces, nil
+}
+
+// netnsInode returns the inode of a network namespace, which is net.ns.inum in the kernel.
+func netnsInode(path string) (uint32, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return 0, errors.Wrapf(err, "failed to stat %s", path)
+	}
+	return uint32(st.Ino), nil //nolint:gosec // namespace inodes are 32 bits
+}
+
+// readNetns returns the pod of a network namespace, or the host, with its listening sockets. It returns nil if the
+// namespace is not a pod.
+func (lr *ListenQueueReader) readNetns(path string, host bool) (*netnsInfo, error) {
+	h, err := openNetns(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open network namespace")
+	}
+	defer h.Close()
+
+	ns := &netnsInfo{}
+	if !host {
+		ep, err := plugincommon.NetnsEndpoint(lr.enricher, h)
+		if err != nil {
+			return nil, err
+		}
+		if ep == nil {
+			return nil, nil
+		}
+		ns.namespace, ns.podName = ep.GetNamespace(), ep.GetPodName()
+	}
+
+	// For the listening sockets, the receive queue of inet_diag is the length of the accept queue, and the send queue
+	// its maximum length.
+	for _, family := range []uint8{unix.AF_INET, unix.AF_INET6} {
+		sockets, err := h.SocketDiagTCP(family)
+		// An interrupted dump is inconsistent but still useful for statistics.
+		if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+			// The overflows of the namespace are still exported, with the sockets read so far.
+			return ns, errors.Wrap(err, "failed to dump TCP sockets")
+		}
+		for _, s := range sockets {
+			if s != nil && s.State == tcpListen {
+				ns.sockets = append(ns.sockets, s)
+			}
+		}
+	}
+	return ns, nil
+}
+
+func (lr *ListenQueueReader) updateMetrics() {
+	exported := make(map[listenerKey]struct{}, len(lr.listeners))
+	for _, l := range lr.listeners {
+		k := listenerKey{namespace: l.Namespace, podName: l.PodName, port: l.Port}
+		exported[k] = struct{}{}
+		labels := k.labels()
+
+		metrics.ListenQueueOverflowsGauge.WithLabelValues(append(labels, queueSyn)...).Set(float64(l.SynQueueOverflows))
+		metrics.ListenQueueOverflowsGauge.WithLabelValues(append(labels, queueAccept)...).Set(float64(l.AcceptQueueOverflows))
+		metrics.ListenAcceptQueueGauge.WithLabelValues(append(labels, statLength)...).Set(float64(l.AcceptQueue))
+		metrics.ListenAcceptQueueGauge.WithLabelValues(append(labels, statMax)...).Set(float64(l.MaxAcceptQueue))
+	}
+
+	for k := range lr.exportedListeners {
+		if _, ok := exported[k]; ok {
+			continue
+		}
+		labels := k.labels()
+		for _, queue := range []string{queueSyn, queueAccept} {
+			metrics.ListenQueueOverflowsGauge.DeleteLabelValues(append(labels, queue)...)
+		}
+		for _, stat := range []string{statLength, statMax} {
+			metrics.ListenAcceptQueueGauge.DeleteLabelValues(append(labels, stat)...)
+		}
+	}
+	lr.exportedListeners = exported
+}
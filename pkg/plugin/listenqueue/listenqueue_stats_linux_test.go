@@ -0,0 +1,208 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package listenqueue
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+	gomock "go.uber.org/mock/gomock"
+	"golang.org/x/sys/unix"
+)
+
+var errNetlink = errors.New("netlink error")
+
+type fakeSockDiag struct {
+	addrs   []netlink.Addr
+	sockets map[uint8][]*netlink.Socket
+	err     error
+	closed  bool
+}
+
+func (f *fakeSockDiag) AddrList(netlink.Link, int) ([]netlink.Addr, error) {
+	return f.addrs, nil
+}
+
+func (f *fakeSockDiag) SocketDiagTCP(family uint8) ([]*netlink.Socket, error) {
+	return f.sockets[family], f.err
+}
+
+func (f *fakeSockDiag) Close() error {
+	f.closed = true
+	return nil
+}
+
+type fakeOverflowMap struct {
+	counters map[overflowKey]overflowValue
+	deleted  []overflowKey
+}
+
+func (f *fakeOverflowMap) Counters() (map[overflowKey]overflowValue, error) {
+	return f.counters, nil
+}
+
+func (f *fakeOverflowMap) Delete(k overflowKey) error {
+	f.deleted = append(f.deleted, k)
+	return nil
+}
+
+func anys(lvs []string) []any {
+	a := make([]any, len(lvs))
+	for i, lv := range lvs {
+		a[i] = lv
+	}
+	return a
+}
+
+func addr(ip string) netlink.Addr {
+	return netlink.Addr{IPNet: &net.IPNet{IP: net.ParseIP(ip)}}
+}
+
+func socket(state uint8, port uint16, rqueue, wqueue uint32) *netlink.Socket {
+	s := &netlink.Socket{State: state, RQueue: rqueue, WQueue: wqueue}
+	s.ID.SourcePort = port
+	return s
+}
+
+// setupNetnsDir creates a directory with the entries of the fake network namespaces in netns, and the host one next
+// to it, and returns it with the inodes of the entries.
+func setupNetnsDir(t *testing.T, handles map[string]*fakeSockDiag) (string, map[string]uint32) {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "netns"), 0o700))
+	inodes := make(map[string]uint32, len(handles))
+	for ns := range handles {
+		path := filepath.Join(dir, "netns", ns)
+		if ns == "host" {
+			path = filepath.Join(dir, ns)
+		}
+		require.NoError(t, os.WriteFile(path, nil, 0o600))
+		inode, err := netnsInode(path)
+		require.NoError(t, err)
+		inodes[ns] = inode
+	}
+	oldOpenNetns := openNetns
+	t.Cleanup(func() { openNetns = oldOpenNetns })
+	openNetns = func(path string) (sockDiag, error) {
+		h, ok := handles[filepath.Base(path)]
+		if !ok {
+			return nil, errNetlink
+		}
+		return h, nil
+	}
+	return dir, inodes
+}
+
+func TestReadListeners(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	handles := map[string]*fakeSockDiag{
+		"host": {
+			sockets: map[uint8][]*netlink.Socket{unix.AF_INET: {socket(tcpListen, 22, 0, 128)}},
+		},
+		"cni-1": {
+			addrs: []netlink.Addr{addr("127.0.0.1"), addr("fe80::1"), addr("10.0.0.5")},
+			sockets: map[uint8][]*netlink.Socket{
+				// the IPv4 and IPv6 listening sockets of a port are summed, the established ones are skipped
+				unix.AF_INET:  {socket(tcpListen, 8080, 3, 4), socket(1, 8080, 0, 0)},
+				unix.AF_INET6: {socket(tcpListen, 8080, 1, 4)},
+			},
+		},
+		// not a pod
+		"cni-2": {addrs: []netlink.Addr{addr("10.0.0.8")}},
+		// the overflows are exported without the accept queues
+		"cni-3": {addrs: []netlink.Addr{addr("10.0.0.9")}, err: errNetlink},
+	}
+	dir, inodes := setupNetnsDir(t, handles)
+
+	overflows := &fakeOverflowMap{counters: map[overflowKey]overflowValue{
+		{Netns: inodes["cni-1"], Port: 8080}: {SynQueue: 1, AcceptQueue: 2},
+		{Netns: inodes["cni-2"], Port: 80}:   {AcceptQueue: 5},
+		{Netns: inodes["cni-3"], Port: 443}:  {SynQueue: 7},
+		{Netns: inodes["host"], Port: 22}:    {AcceptQueue: 1},
+		// gone
+		{Netns: 1, Port: 80}: {AcceptQueue: 5},
+	}}
+
+	e := enricher.NewMockEnricherInterface(ctrl)
+	e.EXPECT().EndpointByIP("10.0.0.5").Return(&flow.Endpoint{Namespace: "ns1", PodName: "pod1"})
+	e.EXPECT().EndpointByIP("10.0.0.8").Return(nil)
+	e.EXPECT().EndpointByIP("10.0.0.9").Return(&flow.Endpoint{Namespace: "ns3", PodName: "pod3"})
+
+	lr := NewListenQueueReader(e, overflows, filepath.Join(dir, "netns"), filepath.Join(dir, "host"))
+	require.NoError(t, lr.readListeners())
+	assert.ElementsMatch(t, []Listener{
+		{Port: 22, AcceptQueueOverflows: 1, MaxAcceptQueue: 128},
+		{Namespace: "ns1", PodName: "pod1", Port: 8080, SynQueueOverflows: 1, AcceptQueueOverflows: 2, AcceptQueue: 4, MaxAcceptQueue: 8},
+		{Namespace: "ns3", PodName: "pod3", Port: 443, SynQueueOverflows: 7},
+	}, lr.listeners)
+	assert.Equal(t, []overflowKey{{Netns: 1, Port: 80}}, overflows.deleted)
+	for _, h := range handles {
+		assert.True(t, h.closed)
+	}
+
+	lr = NewListenQueueReader(e, overflows, filepath.Join(dir, "nonexistent"), filepath.Join(dir, "host"))
+	require.Error(t, lr.readListeners())
+}
+
+func TestListenQueueUpdateMetrics(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	overflowsGauge := metrics.NewMockGaugeVec(ctrl)
+	acceptQueueGauge := metrics.NewMockGaugeVec(ctrl)
+	oldOverflows, oldAcceptQueue := metrics.ListenQueueOverflowsGauge, metrics.ListenAcceptQueueGauge
+	metrics.ListenQueueOverflowsGauge, metrics.ListenAcceptQueueGauge = overflowsGauge, acceptQueueGauge
+	defer func() {
+		metrics.ListenQueueOverflowsGauge, metrics.ListenAcceptQueueGauge = oldOverflows, oldAcceptQueue
+	}()
+
+	testmetric := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "testmetric",
+		Help: "testmetric",
+	})
+	pod1 := []string{"ns1", "pod1", "8080"}
+	host := []string{"", "", "22"}
+	for _, labels := range [][]string{pod1, host} {
+		overflowsGauge.EXPECT().WithLabelValues(anys(append(labels, queueSyn))...).Return(testmetric)
+		overflowsGauge.EXPECT().WithLabelValues(anys(append(labels, queueAccept))...).Return(testmetric)
+		acceptQueueGauge.EXPECT().WithLabelValues(anys(append(labels, statLength))...).Return(testmetric)
+		acceptQueueGauge.EXPECT().WithLabelValues(anys(append(labels, statMax))...).Return(testmetric)
+	}
+
+	lr := NewListenQueueReader(nil, nil, "", "")
+	lr.listeners = []Listener{
+		{Namespace: "ns1", PodName: "pod1", Port: 8080, SynQueueOverflows: 1, AcceptQueueOverflows: 2, AcceptQueue: 4, MaxAcceptQueue: 8},
+		{Port: 22, MaxAcceptQueue: 128},
+	}
+	lr.updateMetrics()
+
+	// the listener of pod1 is gone, its series are deleted
+	overflowsGauge.EXPECT().WithLabelValues(anys(append(host, queueSyn))...).Return(testmetric)
+	overflowsGauge.EXPECT().WithLabelValues(anys(append(host, queueAccept))...).Return(testmetric)
+	acceptQueueGauge.EXPECT().WithLabelValues(anys(append(host, statLength))...).Return(testmetric)
+	acceptQueueGauge.EXPECT().WithLabelValues(anys(append(host, statMax))...).Return(testmetric)
+	overflowsGauge.EXPECT().DeleteLabelValues(anys(append(pod1, queueSyn))...).Return(true)
+	overflowsGauge.EXPECT().DeleteLabelValues(anys(append(pod1, queueAccept))...).Return(true)
+	acceptQueueGauge.EXPECT().DeleteLabelValues(anys(append(pod1, statLength))...).Return(true)
+	acceptQueueGauge.EXPECT().DeleteLabelValues(anys(append(pod1, statMax))...).Return(true)
+
+	lr.listeners = lr.listeners[1:]
+	lr.updateMetrics()
+}
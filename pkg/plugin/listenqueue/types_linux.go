@@ -0,0 +1,106 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package listenqueue
+
+import (
+	"sync"
+
+	v1 "github.com/cilium/cilium/pkg/hubble/api/v1"
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/perf"
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+	plugincommon "github.com/microsoft/retina/pkg/plugin/common"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+const name = "listenqueue"
+
+// pathHostNetns is the network namespace of the host, as Retina runs in the host network.
+const pathHostNetns = "/proc/self/ns/net"
+
+// tcpListen is the TCP_LISTEN state of the sockets, see include/net/tcp_states.h
+const tcpListen = 10
+
+const (
+	// Values of the queue label of the listen_queue_overflows metric
+	queueSyn    = "syn"
+	queueAccept = "accept"
+
+	// Statistic names of the listen_accept_queue metric
+	statLength = "length"
+	statMax    = "max"
+
+	// Drop reasons of the flows
+	dropReasonSynQueueFull    = "TCP_SYN_QUEUE_FULL"
+	dropReasonAcceptQueueFull = "TCP_ACCEPT_QUEUE_FULL"
+)
+
+const perCPUBuffer = 16
+
+// openNetns opens netlink sockets in the network namespace bind mounted at path.
+var openNetns = func(path string) (sockDiag, error) {
+	return plugincommon.OpenNetns(path, unix.NETLINK_ROUTE, unix.NETLINK_INET_DIAG)
+}
+
+type listenqueue struct {
+	cfg             *kcfg.Config
+	l               *log.ZapLogger
+	enricher        enricher.EnricherInterface
+	externalChannel chan *v1.Event
+	coll            *ebpf.Collection
+	perfReader      *perf.Reader
+	hooks           []interface{ Close() error }
+	reader          *ListenQueueReader
+	wg              sync.WaitGroup
+}
+
+// overflowKey is the key of the overflow counters, a listening port of a network namespace.
+type overflowKey = listenqueueOverflowKey
+
+// overflowValue are the overflow counters of a listening port.
+type overflowValue = listenqueueOverflowValue
+
+// hook is a kernel function traced by a program of the plugin.
+type hook struct {
+	program string
+	fn      string
+	// optional hooks are skipped if the function does not exist, e.g. when IPv6 is a module which is not loaded
+	optional bool
+}
+
+var hooks = []hook{
+	{program: listenqueueProgRetinaLqConnRequest, fn: "tcp_conn_request"},
+	{program: listenqueueProgRetinaLqSynRecvV4, fn: "tcp_v4_syn_recv_sock"},
+	{program: listenqueueProgRetinaLqSynRecvV6, fn: "tcp_v6_syn_recv_sock", optional: true},
+}
+
+// Listener is the state of the listening sockets of a port of a pod, or of the host for empty Namespace and PodName.
+type Listener struct {
+	Namespace string
+	PodName   string
+	Port      uint16
+	// SynQueueOverflows is the number of SYNs which overflowed the SYN queue
+	SynQueueOverflows uint64
+	// AcceptQueueOverflows is the number of connections which overflowed the accept queue
+	AcceptQueueOverflows uint64
+	// AcceptQueue is the number of connections waiting to be accepted, sampled through inet_diag
+	AcceptQueue uint32
+	// MaxAcceptQueue is the backlog of the listening sockets
+	MaxAcceptQueue uint32
+}
+
+// sockDiag is the netlink handle of a network namespace.
+type sockDiag interface {
+	plugincommon.AddrLister
+	SocketDiagTCP(family uint8) ([]*netlink.Socket, error)
+	Close() error
+}
+
+// overflowMap is the map of the overflow counters.
+type overflowMap interface {
+	Counters() (map[overflowKey]overflowValue, error)
+	Delete(k overflowKey) error
+}
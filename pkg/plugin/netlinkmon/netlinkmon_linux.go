@@ -0,0 +1,264 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+// Package netlinkmon contains the Retina netlinkmon plugin. It subscribes to the netlink notifications of the neighbor
+// table, routes and interfaces of the node to export the size of the neighbor table by state, and the changes of the
+// routes and of the states of the interfaces, correlated to the pods of the veths.
+package netlinkmon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	hubblev1 "github.com/cilium/cilium/pkg/hubble/api/v1"
+	"github.com/microsoft/retina/pkg/common"
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/plugin/registry"
+	"github.com/microsoft/retina/pkg/pubsub"
+	"github.com/microsoft/retina/pkg/watchers/endpoint"
+	"github.com/vishvananda/netlink"
+	"go.uber.org/zap"
+)
+
+var ErrAlreadyRunning = errors.New("netlinkmon plugin is already running")
+
+func init() {
+	registry.Add(name, New)
+}
+
+// New creates a netlinkmon plugin.
+func New(cfg *kcfg.Config) registry.Plugin {
+	return &netlinkmon{
+		cfg: cfg,
+		l:   log.Logger().Named(name),
+	}
+}
+
+func (n *netlinkmon) Name() string {
+	return name
+}
+
+func (n *netlinkmon) Generate(context.Context) error {
+	return nil
+}
+
+func (n *netlinkmon) Compile(context.Context) error {
+	return nil
+}
+
+func (n *netlinkmon) Init() error {
+	return nil
+}
+
+func (n *netlinkmon) Start(ctx context.Context) error {
+	n.l.Info("Starting netlinkmon plugin")
+	n.startLock.Lock()
+	if n.isRunning {
+		n.startLock.Unlock()
+		return ErrAlreadyRunning
+	}
+	n.isRunning = true
+	n.startLock.Unlock()
+
+	// Pods of veths are only resolved when pod level is enabled.
+	var e enricher.EnricherInterface
+	if n.cfg.EnablePodLevel && enricher.IsInitialized() {
+		e = enricher.Instance()
+	}
+	n.monitor = NewNetlinkMonitor(e, procSysNet)
+
+	// Track the pod veths published by the endpoint watcher.
+	fn := pubsub.CallBackFunc(n.endpointWatcherCallbackFn)
+	if n.callbackID == "" {
+		n.callbackID = pubsub.New().Subscribe(common.PubSubEndpoints, &fn)
+	}
+
+	return n.run(ctx)
+}
+
+func (n *netlinkmon) SetupChannel(chan *hubblev1.Event) error {
+	n.l.Warn("Plugin does not support SetupChannel", zap.String("plugin", name))
+	return nil
+}
+
+// subscription are the netlink subscriptions to the neighbor, route and link notifications. The channels are closed
+// by netlink when a subscription fails.
+type subscription struct {
+	neighs chan netlink.NeighUpdate
+	routes chan netlink.RouteUpdate
+	links  chan netlink.LinkUpdate
+	done   chan struct{}
+}
+
+// subscribe subscribes to the notifications, listing the existing neighbors and interfaces.
+func (n *netlinkmon) subscribe() (*subscription, error) {
+	s := &subscription{done: make(chan struct{})}
+	errorCallback := func(err error) {
+		n.l.Debug("netlink subscription error", zap.Error(err))
+	}
+
+	neighs := make(chan netlink.NeighUpdate, updatesBuffer)
+	if err := neighSubscribe(neighs, s.done, netlink.NeighSubscribeOptions{ErrorCallback: errorCallback, ListExisting: true}); err != nil {
+		s.close()
+		return nil, fmt.Errorf("failed to subscribe to neighbor notifications: %w", err)
+	}
+	s.neighs = neighs
+
+	routes := make(chan netlink.RouteUpdate, updatesBuffer)
+	if err := routeSubscribe(routes, s.done, netlink.RouteSubscribeOptions{ErrorCallback: errorCallback}); err != nil {
+		s.close()
+		return nil, fmt.Errorf("failed to subscribe to route notifications: %w", err)
+	}
+	s.routes = routes
+
+	links := make(chan netlink.LinkUpdate, updatesBuffer)
+	if err := linkSubscribe(links, s.done, netlink.LinkSubscribeOptions{ErrorCallback: errorCallback, ListExisting: true}); err != nil {
+		s.close()
+		return nil, fmt.Errorf("failed to subscribe to link notifications: %w", err)
+	}
+	s.links = links
+
+	return s, nil
+}
+
+// close closes the subscriptions, and drains their channels until netlink closes them, so that their goroutines
+// blocked on sending the notifications return.
+func (s *subscription) close() {
+	if s == nil {
+		return
+	}
+	close(s.done)
+	if s.neighs != nil {
+		go func() {
+			for range s.neighs { //nolint:revive // draining
+			}
+		}()
+	}
+	if s.routes != nil {
+		go func() {
+			for range s.routes { //nolint:revive // draining
+			}
+		}()
+	}
+	if s.links != nil {
+		go func() {
+			for range s.links { //nolint:revive // draining
+			}
+		}()
+	}
+}
+
+// resubscribe subscribes again after a subscription failed, e.g. because notifications were lost when the socket
+// buffer was full. The neighbor table is listed again.
+func (n *netlinkmon) resubscribe() *subscription {
+	n.monitor.resetNeighbors()
+	s, err := n.subscribe()
+	if err != nil {
+		n.l.Error("Failed to subscribe to netlink notifications", zap.Error(err))
+		return nil
+	}
+	return s
+}
+
+func (n *netlinkmon) run(ctx context.Context) error {
+	n.l.Info("Running netlinkmon plugin...")
+	s, err := n.subscribe()
+	if err != nil {
+		return err
+	}
+	defer func() { s.close() }()
+
+	ticker := time.NewTicker(n.cfg.MetricsInterval)
+	defer ticker.Stop()
+
+	for {
+		// A nil channel blocks, so the notifications are not read until the subscriptions are retried.
+		var (
+			neighs <-chan netlink.NeighUpdate
+			routes <-chan netlink.RouteUpdate
+			links  <-chan netlink.LinkUpdate
+		)
+		if s != nil {
+			neighs, routes, links = s.neighs, s.routes, s.links
+		}
+
+		select {
+		case <-ctx.Done():
+			n.l.Info("Context is done, netlinkmon will stop running")
+			return nil
+		case u, ok := <-neighs:
+			if !ok {
+				s = n.dropSubscription(s)
+				continue
+			}
+			n.monitor.handleNeigh(&u)
+		case u, ok := <-routes:
+			if !ok {
+				s = n.dropSubscription(s)
+				continue
+			}
+			n.monitor.handleRoute(&u)
+		case u, ok := <-links:
+			if !ok {
+				s = n.dropSubscription(s)
+				continue
+			}
+			n.monitor.handleLink(&u)
+		case <-ticker.C:
+			if s == nil {
+				s = n.resubscribe()
+			}
+			n.monitor.updateMetrics()
+		}
+	}
+}
+
+// dropSubscription closes the subscriptions after one of them failed. They are retried at the next tick, so that a
+// failing subscription is not retried in a loop.
+func (n *netlinkmon) dropSubscription(s *subscription) *subscription {
+	n.l.Warn("netlink subscription closed, subscribing again at the next interval")
+	s.close()
+	return nil
+}
+
+func (n *netlinkmon) endpointWatcherCallbackFn(obj interface{}) {
+	// Contract is that we will receive an endpoint event pointer.
+	event := obj.(*endpoint.EndpointEvent)
+	if event == nil {
+		return
+	}
+
+	iface := event.Obj.(netlink.LinkAttrs)
+	switch event.Type {
+	case endpoint.EndpointCreated:
+		n.l.Debug("Endpoint created", zap.String("name", iface.Name))
+		n.monitor.addVeth(iface.Index, iface.Name)
+	case endpoint.EndpointDeleted:
+		n.l.Debug("Endpoint deleted", zap.String("name", iface.Name))
+		n.monitor.deleteVeth(iface.Index, iface.Name)
+	default:
+		// Unknown.
+		n.l.Debug("Unknown event", zap.String("type", event.Type.String()))
+	}
+}
+
+func (n *netlinkmon) Stop() error {
+	if !n.isRunning {
+		return nil
+	}
+	n.l.Info("Stopping netlinkmon plugin...")
+
+	if n.callbackID != "" {
+		if err := pubsub.New().Unsubscribe(common.PubSubEndpoints, n.callbackID); err != nil {
+			n.l.Error("Error unregistering callback for netlinkmon", zap.Error(err))
+		}
+		n.callbackID = ""
+	}
+
+	n.isRunning = false
+	return nil
+}
@@ -0,0 +1,140 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package netlinkmon
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/metrics"
+	"github.com/microsoft/retina/pkg/watchers/endpoint"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sys/unix"
+)
+
+func TestEndpointWatcherCallbackFn(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	n := New(&kcfg.Config{}).(*netlinkmon)
+	n.monitor = NewNetlinkMonitor(nil, "")
+
+	n.endpointWatcherCallbackFn(endpoint.NewEndpointEvent(endpoint.EndpointCreated, netlink.LinkAttrs{Index: 10, Name: "azv1"}))
+	n.endpointWatcherCallbackFn(endpoint.NewEndpointEvent(endpoint.EndpointCreated, netlink.LinkAttrs{Index: 11, Name: "azv2"}))
+	assert.Equal(t, map[int]string{10: "azv1", 11: "azv2"}, n.monitor.veths)
+
+	// the index of a deleted veth reused by a new veth
+	n.endpointWatcherCallbackFn(endpoint.NewEndpointEvent(endpoint.EndpointCreated, netlink.LinkAttrs{Index: 11, Name: "azv3"}))
+	n.endpointWatcherCallbackFn(endpoint.NewEndpointEvent(endpoint.EndpointDeleted, netlink.LinkAttrs{Index: 11, Name: "azv2"}))
+	n.endpointWatcherCallbackFn(endpoint.NewEndpointEvent(endpoint.EndpointDeleted, netlink.LinkAttrs{Index: 10, Name: "azv1"}))
+	assert.Equal(t, map[int]string{11: "azv3"}, n.monitor.veths)
+}
+
+// fakeNotifications counts the notifications of the fake subscriptions read by the plugin.
+type fakeNotifications struct {
+	neighSubscriptions atomic.Int32
+	neighs             atomic.Int32
+	links              atomic.Int32
+}
+
+// deliver sends a notification, and counts it in read once the plugin read it. The notifications are buffered, and the
+// plugin handles one before it reads the next or sees the end of the context, so the tests can wait for it.
+func deliver[T any](ch chan<- T, done <-chan struct{}, u T, read *atomic.Int32) {
+	ch <- u
+	for len(ch) > 0 {
+		select {
+		case <-done:
+			return
+		case <-time.After(time.Millisecond):
+		}
+	}
+	read.Add(1)
+}
+
+// fakeSubscriptions replaces the netlink subscriptions. The first neighbor subscription fails after sending an entry,
+// the other subscriptions send their notifications until they are closed.
+func fakeSubscriptions(t *testing.T) *fakeNotifications {
+	t.Helper()
+	oldNeigh, oldRoute, oldLink := neighSubscribe, routeSubscribe, linkSubscribe
+	t.Cleanup(func() { neighSubscribe, routeSubscribe, linkSubscribe = oldNeigh, oldRoute, oldLink })
+
+	var f fakeNotifications
+	neighSubscribe = func(ch chan<- netlink.NeighUpdate, done <-chan struct{}, options netlink.NeighSubscribeOptions) error {
+		assert.True(t, options.ListExisting)
+		first := f.neighSubscriptions.Add(1) == 1
+		go func() {
+			defer close(ch)
+			deliver(ch, done, *neighUpdate(unix.RTM_NEWNEIGH, unix.AF_INET, 2, "10.0.0.1", netlink.NUD_REACHABLE), &f.neighs)
+			if first {
+				return
+			}
+			<-done
+		}()
+		return nil
+	}
+	routeSubscribe = func(ch chan<- netlink.RouteUpdate, done <-chan struct{}, _ netlink.RouteSubscribeOptions) error {
+		go func() {
+			defer close(ch)
+			<-done
+		}()
+		return nil
+	}
+	linkSubscribe = func(ch chan<- netlink.LinkUpdate, done <-chan struct{}, options netlink.LinkSubscribeOptions) error {
+		assert.True(t, options.ListExisting)
+		go func() {
+			defer close(ch)
+			deliver(ch, done, *linkUpdate(unix.RTM_NEWLINK, 2, "eth0", netlink.OperUp), &f.links)
+			<-done
+		}()
+		return nil
+	}
+	return &f
+}
+
+func TestStartStop(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	metrics.InitializeMetrics(slog.Default())
+	notifications := fakeSubscriptions(t)
+
+	n := New(&kcfg.Config{MetricsInterval: 10 * time.Millisecond}).(*netlinkmon)
+	ctx, cancel := context.WithCancel(context.Background())
+	g, errctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		return n.Start(errctx)
+	})
+
+	// the failed subscription is retried at the next interval, and lists the neighbor table again
+	require.Eventually(t, func() bool {
+		return notifications.neighSubscriptions.Load() >= 2 && notifications.neighs.Load() >= 2 && notifications.links.Load() >= 1
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+	require.NoError(t, g.Wait())
+	assert.Len(t, n.monitor.neighbors, 1)
+	assert.Contains(t, n.monitor.links, 2)
+
+	require.NoError(t, n.Stop())
+	assert.False(t, n.isRunning)
+	assert.Empty(t, n.callbackID)
+}
+
+func TestSubscribeError(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	fakeSubscriptions(t)
+	linkSubscribe = func(chan<- netlink.LinkUpdate, <-chan struct{}, netlink.LinkSubscribeOptions) error {
+		return unix.EPERM
+	}
+
+	n := New(&kcfg.Config{MetricsInterval: time.Second}).(*netlinkmon)
+	require.ErrorIs(t, n.Start(context.Background()), unix.EPERM)
+	require.NoError(t, n.Stop())
+}
@@ -0,0 +1,283 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package netlinkmon
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/metrics"
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+// NetlinkMonitor keeps the neighbor table of the node from the netlink notifications, and counts the changes of the
+// routes and of the states of the interfaces.
+type NetlinkMonitor struct {
+	l        *log.ZapLogger
+	enricher enricher.EnricherInterface
+	sysNet   string
+
+	// neighbors are the states of the neighbor entries
+	neighbors map[neighKey]int
+	// links are the states of the interfaces, by index
+	links map[int]*linkState
+
+	// veths are the names of the pod interfaces published by the endpoint watcher, by index
+	vethsLock sync.Mutex
+	veths     map[int]string
+}
+
+// NewNetlinkMonitor creates a monitor of the neighbor table, routes and interfaces of the node, whose sysctls are in
+// sysNet. The enricher is optional and resolves the pods of the veths.
+func NewNetlinkMonitor(e enricher.EnricherInterface, sysNet string) *NetlinkMonitor {
+	return &NetlinkMonitor{
+		l:         log.Logger().Named(string("NetlinkMonitor")),
+		enricher:  e,
+		sysNet:    sysNet,
+		neighbors: make(map[neighKey]int),
+		links:     make(map[int]*linkState),
+		veths:     make(map[int]string),
+	}
+}
+
+func familyName(family int) (string, bool) {
+	switch family {
+	case unix.AF_INET:
+		return familyIPv4, true
+	case unix.AF_INET6:
+		return familyIPv6, true
+	default:
+		return "", false
+	}
+}
+
+func neighStateName(state int) string {
+	if s, ok := neighStates[state]; ok {
+		return s
+	}
+	return stateNone
+}
+
+// resetNeighbors forgets the neighbor entries, before they are listed again by a new subscription.
+func (nm *NetlinkMonitor) resetNeighbors() {
+	nm.neighbors = make(map[neighKey]int)
+}
+
+func (nm *NetlinkMonitor) handleNeigh(u *netlink.NeighUpdate) {
+	// The bridge FDB entries and the proxy entries are not in the neighbor tables.
+	if _, ok := familyName(u.Family); !ok || u.Flags&netlink.NTF_PROXY != 0 {
+		return
+	}
+	k := neighKey{linkIndex: u.LinkIndex, family: u.Family, ip: u.IP.String()}
+	switch u.Type {
+	case unix.RTM_NEWNEIGH:
+		if prev, ok := nm.neighbors[k]; ok && prev != u.State && u.State == netlink.NUD_FAILED {
+			nm.l.Info("Neighbor failed", zap.String("ip", k.ip), zap.Int("ifindex", k.linkIndex))
+		}
+		nm.neighbors[k] = u.State
+	case unix.RTM_DELNEIGH:
+		delete(nm.neighbors, k)
+	}
+}
+
+func (nm *NetlinkMonitor) handleRoute(u *netlink.RouteUpdate) {
+	family, ok := familyName(u.Family)
+	if !ok || u.Table == unix.RT_TABLE_LOCAL {
+		// The local table follows the addresses of the node.
+		return
+	}
+	var change string
+	switch u.Type {
+	case unix.RTM_NEWROUTE:
+		change = routeAdded
+	case unix.RTM_DELROUTE:
+		change = routeDeleted
+	default:
+		return
+	}
+	metrics.RouteChangeCounter.WithLabelValues(family, change).Inc()
+	nm.l.Info("Route changed",
+		zap.String("change", change),
+		zap.Stringer("dst", u.Dst),
+		zap.Stringer("gw", u.Gw),
+		zap.Int("ifindex", u.LinkIndex),
+		zap.Int("table", u.Table),
+	)
+}
+
+// isUp tells if an interface is up. The interfaces without operational state, e.g. loopback or tun, are up when
+// administratively up.
+func isUp(attrs *netlink.LinkAttrs) bool {
+	return attrs.OperState == netlink.OperUp || (attrs.OperState == netlink.OperUnknown && attrs.Flags&net.FlagUp != 0)
+}
+
+func (nm *NetlinkMonitor) handleLink(u *netlink.LinkUpdate) {
+	attrs := u.Attrs()
+	if attrs == nil {
+		return
+	}
+	if u.Header.Type == unix.RTM_DELLINK {
+		nm.deleteLink(attrs.Index)
+		return
+	}
+
+	up := isUp(attrs)
+	link, ok := nm.links[attrs.Index]
+	if !ok || link.name != attrs.Name {
+		// A new interface, or a new one with the index of a deleted one whose notification was missed.
+		if ok {
+			nm.deleteLink(attrs.Index)
+		}
+		nm.links[attrs.Index] = &linkState{name: attrs.Name, up: up, wasUp: up}
+		return
+	}
+	if link.up == up {
+		return
+	}
+	link.up = up
+	if up && !link.wasUp {
+		link.wasUp = true
+		return
+	}
+
+	state := linkDown
+	if up {
+		state = linkUp
+	}
+	ep := nm.podOf(attrs.Index)
+	labels := []string{attrs.Name, ep.GetNamespace(), ep.GetPodName(), state}
+	metrics.LinkStateChangeCounter.WithLabelValues(labels...).Inc()
+	link.labels = appendLabels(link.labels, labels)
+	nm.l.Info("Link state changed",
+		zap.String("interface", attrs.Name),
+		zap.String("namespace", ep.GetNamespace()),
+		zap.String("podname", ep.GetPodName()),
+		zap.String("state", state),
+		zap.String("operstate", attrs.OperState.String()),
+	)
+}
+
+func appendLabels(all [][]string, labels []string) [][]string {
+	for _, l := range all {
+		if slices.Equal(l, labels) {
+			return all
+		}
+	}
+	return append(all, labels)
+}
+
+// deleteLink forgets a deleted interface and deletes its counters.
+func (nm *NetlinkMonitor) deleteLink(index int) {
+	link, ok := nm.links[index]
+	if !ok {
+		return
+	}
+	for _, labels := range link.labels {
+		metrics.LinkStateChangeCounter.DeleteLabelValues(labels...)
+	}
+	delete(nm.links, index)
+}
+
+func (nm *NetlinkMonitor) addVeth(index int, name string) {
+	nm.vethsLock.Lock()
+	defer nm.vethsLock.Unlock()
+	nm.veths[index] = name
+}
+
+func (nm *NetlinkMonitor) deleteVeth(index int, name string) {
+	nm.vethsLock.Lock()
+	defer nm.vethsLock.Unlock()
+	// The index may have been reused by a veth created in the same refresh.
+	if nm.veths[index] == name {
+		delete(nm.veths, index)
+	}
+}
+
+// podOf returns the pod of a veth through the host routes to its IPs, or nil if the interface is not a known veth.
+func (nm *NetlinkMonitor) podOf(index int) *flow.Endpoint {
+	nm.vethsLock.Lock()
+	_, ok := nm.veths[index]
+	nm.vethsLock.Unlock()
+	if !ok || nm.enricher == nil {
+		return nil
+	}
+
+	routes, err := routeListFiltered(netlink.FAMILY_ALL, &netlink.Route{LinkIndex: index}, netlink.RT_FILTER_OIF)
+	if err != nil {
+		nm.l.Debug("Failed to list routes of veth", zap.Int("ifindex", index), zap.Error(err))
+		return nil
+	}
+	for i := range routes {
+		if routes[i].Dst == nil {
+			continue
+		}
+		if ones, bits := routes[i].Dst.Mask.Size(); ones != bits {
+			continue
+		}
+		if ep := nm.enricher.EndpointByIP(routes[i].Dst.IP.String()); ep != nil {
+			return ep
+		}
+	}
+	return nil
+}
+
+// readGCThresholds reads the garbage collection thresholds of the neighbor table of a family.
+func (nm *NetlinkMonitor) readGCThresholds(family string) (map[string]uint64, error) {
+	thresholds := make(map[string]uint64, len(gcThresholds))
+	for _, threshold := range gcThresholds {
+		path := filepath.Join(nm.sysNet, family, "neigh", "default", threshold)
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read %s", path)
+		}
+		v, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s", path)
+		}
+		thresholds[threshold] = v
+	}
+	return thresholds, nil
+}
+
+// updateMetrics exports the number of neighbor entries of each state and the garbage collection thresholds.
+func (nm *NetlinkMonitor) updateMetrics() {
+	counts := make(map[string]map[string]int)
+	for _, family := range []string{familyIPv4, familyIPv6} {
+		// All the states are exported, so that the absence of failed entries is 0.
+		counts[family] = map[string]int{stateNone: 0}
+		for _, state := range neighStates {
+			counts[family][state] = 0
+		}
+	}
+	for k, state := range nm.neighbors {
+		family, _ := familyName(k.family)
+		counts[family][neighStateName(state)]++
+	}
+	for family, states := range counts {
+		for state, n := range states {
+			metrics.NeighborEntriesGauge.WithLabelValues(family, state).Set(float64(n))
+		}
+
+		thresholds, err := nm.readGCThresholds(family)
+		if err != nil {
+			// IPv6 may be disabled.
+			nm.l.Debug("Failed to read neighbor table thresholds", zap.String("family", family), zap.Error(err))
+			continue
+		}
+		for threshold, v := range thresholds {
+			metrics.NeighborGCThreshGauge.WithLabelValues(family, threshold).Set(float64(v))
+		}
+	}
+	nm.l.Debug("Done updating neighbor table metrics", zap.Int("entries", len(nm.neighbors)))
+}
@@ -0,0 +1,188 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package netlinkmon
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+	gomock "go.uber.org/mock/gomock"
+	"golang.org/x/sys/unix"
+)
+
+func neighUpdate(typ uint16, family, index int, ip string, state int) *netlink.NeighUpdate {
+	return &netlink.NeighUpdate{
+		Type:  typ,
+		Neigh: netlink.Neigh{LinkIndex: index, Family: family, IP: net.ParseIP(ip), State: state},
+	}
+}
+
+func linkUpdate(typ uint16, index int, name string, operState netlink.LinkOperState) *netlink.LinkUpdate {
+	return &netlink.LinkUpdate{
+		Header: unix.NlMsghdr{Type: typ},
+		Link:   &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Index: index, Name: name, OperState: operState}},
+	}
+}
+
+func writeThresholds(t *testing.T, dir, family string, values ...string) {
+	t.Helper()
+	path := filepath.Join(dir, family, "neigh", "default")
+	require.NoError(t, os.MkdirAll(path, 0o755))
+	for i, threshold := range gcThresholds {
+		require.NoError(t, os.WriteFile(filepath.Join(path, threshold), []byte(values[i]+"\n"), 0o600))
+	}
+}
+
+func TestNeighbors(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	ctrl := gomock.NewController(t)
+
+	entriesGauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "testmetric", Help: "testmetric"}, []string{"family", "state"})
+	threshGauge := metrics.NewMockGaugeVec(ctrl)
+	oldEntries, oldThresh := metrics.NeighborEntriesGauge, metrics.NeighborGCThreshGauge
+	metrics.NeighborEntriesGauge, metrics.NeighborGCThreshGauge = entriesGauge, threshGauge
+	defer func() { metrics.NeighborEntriesGauge, metrics.NeighborGCThreshGauge = oldEntries, oldThresh }()
+
+	dir := t.TempDir()
+	writeThresholds(t, dir, familyIPv4, "128", "512", "1024")
+
+	nm := NewNetlinkMonitor(nil, dir)
+	nm.handleNeigh(neighUpdate(unix.RTM_NEWNEIGH, unix.AF_INET, 2, "10.0.0.1", netlink.NUD_REACHABLE))
+	nm.handleNeigh(neighUpdate(unix.RTM_NEWNEIGH, unix.AF_INET, 2, "10.0.0.2", netlink.NUD_INCOMPLETE))
+	nm.handleNeigh(neighUpdate(unix.RTM_NEWNEIGH, unix.AF_INET, 2, "10.0.0.2", netlink.NUD_FAILED))
+	nm.handleNeigh(neighUpdate(unix.RTM_NEWNEIGH, unix.AF_INET, 2, "10.0.0.3", netlink.NUD_STALE))
+	nm.handleNeigh(neighUpdate(unix.RTM_DELNEIGH, unix.AF_INET, 2, "10.0.0.3", netlink.NUD_STALE))
+	nm.handleNeigh(neighUpdate(unix.RTM_NEWNEIGH, unix.AF_INET6, 2, "fe80::1", netlink.NUD_STALE))
+	// the bridge FDB entries are not neighbors
+	nm.handleNeigh(neighUpdate(unix.RTM_NEWNEIGH, unix.AF_BRIDGE, 2, "", netlink.NUD_PERMANENT))
+
+	threshGauge.EXPECT().WithLabelValues(familyIPv4, "gc_thresh1").Return(testGauge())
+	threshGauge.EXPECT().WithLabelValues(familyIPv4, "gc_thresh2").Return(testGauge())
+	threshGauge.EXPECT().WithLabelValues(familyIPv4, "gc_thresh3").Return(testGauge())
+	// the thresholds of IPv6 are missing, as when it is disabled
+	nm.updateMetrics()
+
+	// all the states are exported
+	assert.Equal(t, 2*(len(neighStates)+1), testutil.CollectAndCount(entriesGauge))
+	assert.InDelta(t, 1, testutil.ToFloat64(entriesGauge.WithLabelValues(familyIPv4, "reachable")), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(entriesGauge.WithLabelValues(familyIPv4, "failed")), 0)
+	assert.InDelta(t, 0, testutil.ToFloat64(entriesGauge.WithLabelValues(familyIPv4, "stale")), 0)
+	assert.InDelta(t, 0, testutil.ToFloat64(entriesGauge.WithLabelValues(familyIPv4, "incomplete")), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(entriesGauge.WithLabelValues(familyIPv6, "stale")), 0)
+
+	nm.resetNeighbors()
+	assert.Empty(t, nm.neighbors)
+}
+
+func testGauge() prometheus.Gauge {
+	return prometheus.NewGauge(prometheus.GaugeOpts{Name: "testmetric", Help: "testmetric"})
+}
+
+func testCounter() prometheus.Counter {
+	return prometheus.NewCounter(prometheus.CounterOpts{Name: "testmetric", Help: "testmetric"})
+}
+
+func TestReadGCThresholds(t *testing.T) {
+	dir := t.TempDir()
+	writeThresholds(t, dir, familyIPv6, "128", "512", "1024")
+	nm := NewNetlinkMonitor(nil, dir)
+
+	thresholds, err := nm.readGCThresholds(familyIPv6)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"gc_thresh1": 128, "gc_thresh2": 512, "gc_thresh3": 1024}, thresholds)
+
+	_, err = nm.readGCThresholds(familyIPv4)
+	require.Error(t, err)
+
+	writeThresholds(t, dir, familyIPv4, "128", "invalid", "1024")
+	_, err = nm.readGCThresholds(familyIPv4)
+	require.Error(t, err)
+}
+
+func TestHandleRoute(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	ctrl := gomock.NewController(t)
+
+	routeCounter := metrics.NewMockCounterVec(ctrl)
+	oldRoute := metrics.RouteChangeCounter
+	metrics.RouteChangeCounter = routeCounter
+	defer func() { metrics.RouteChangeCounter = oldRoute }()
+
+	_, dst, _ := net.ParseCIDR("10.1.0.0/16")
+	routeCounter.EXPECT().WithLabelValues(familyIPv4, routeAdded).Return(testCounter())
+	routeCounter.EXPECT().WithLabelValues(familyIPv6, routeDeleted).Return(testCounter())
+
+	nm := NewNetlinkMonitor(nil, "")
+	nm.handleRoute(&netlink.RouteUpdate{Type: unix.RTM_NEWROUTE, Route: netlink.Route{Family: unix.AF_INET, Dst: dst, Table: unix.RT_TABLE_MAIN}})
+	nm.handleRoute(&netlink.RouteUpdate{Type: unix.RTM_DELROUTE, Route: netlink.Route{Family: unix.AF_INET6, Table: unix.RT_TABLE_MAIN}})
+	// the local table follows the addresses of the node
+	nm.handleRoute(&netlink.RouteUpdate{Type: unix.RTM_NEWROUTE, Route: netlink.Route{Family: unix.AF_INET, Dst: dst, Table: unix.RT_TABLE_LOCAL}})
+}
+
+func TestHandleLink(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	ctrl := gomock.NewController(t)
+
+	linkCounter := metrics.NewMockCounterVec(ctrl)
+	oldLink := metrics.LinkStateChangeCounter
+	metrics.LinkStateChangeCounter = linkCounter
+	defer func() { metrics.LinkStateChangeCounter = oldLink }()
+
+	oldRouteListFiltered := routeListFiltered
+	defer func() { routeListFiltered = oldRouteListFiltered }()
+	routeListFiltered = func(_ int, filter *netlink.Route, _ uint64) ([]netlink.Route, error) {
+		if filter.LinkIndex != 10 {
+			return nil, nil
+		}
+		_, dst, _ := net.ParseCIDR("10.0.0.5/32")
+		return []netlink.Route{{LinkIndex: 10, Dst: dst}}, nil
+	}
+
+	e := enricher.NewMockEnricherInterface(ctrl)
+	e.EXPECT().EndpointByIP("10.0.0.5").Return(&flow.Endpoint{Namespace: "ns1", PodName: "pod1"}).AnyTimes()
+
+	nm := NewNetlinkMonitor(e, "")
+	nm.addVeth(10, "azv1")
+
+	// the existing interfaces, and a new veth going up, are not counted
+	nm.handleLink(linkUpdate(unix.RTM_NEWLINK, 2, "eth0", netlink.OperUp))
+	nm.handleLink(linkUpdate(unix.RTM_NEWLINK, 10, "azv1", netlink.OperDown))
+	nm.handleLink(linkUpdate(unix.RTM_NEWLINK, 10, "azv1", netlink.OperUp))
+
+	pod1Down := []string{"azv1", "ns1", "pod1", linkDown}
+	pod1Up := []string{"azv1", "ns1", "pod1", linkUp}
+	eth0Down := []string{"eth0", "", "", linkDown}
+	linkCounter.EXPECT().WithLabelValues(pod1Down[0], pod1Down[1], pod1Down[2], pod1Down[3]).Return(testCounter()).Times(2)
+	linkCounter.EXPECT().WithLabelValues(pod1Up[0], pod1Up[1], pod1Up[2], pod1Up[3]).Return(testCounter())
+	linkCounter.EXPECT().WithLabelValues(eth0Down[0], eth0Down[1], eth0Down[2], eth0Down[3]).Return(testCounter())
+
+	nm.handleLink(linkUpdate(unix.RTM_NEWLINK, 10, "azv1", netlink.OperDown))
+	nm.handleLink(linkUpdate(unix.RTM_NEWLINK, 10, "azv1", netlink.OperDown))
+	nm.handleLink(linkUpdate(unix.RTM_NEWLINK, 10, "azv1", netlink.OperUp))
+	nm.handleLink(linkUpdate(unix.RTM_NEWLINK, 10, "azv1", netlink.OperLowerLayerDown))
+	nm.handleLink(linkUpdate(unix.RTM_NEWLINK, 2, "eth0", netlink.OperDown))
+
+	// the counters of a deleted interface are deleted
+	linkCounter.EXPECT().DeleteLabelValues(pod1Down[0], pod1Down[1], pod1Down[2], pod1Down[3]).Return(true)
+	linkCounter.EXPECT().DeleteLabelValues(pod1Up[0], pod1Up[1], pod1Up[2], pod1Up[3]).Return(true)
+	nm.handleLink(linkUpdate(unix.RTM_DELLINK, 10, "azv1", netlink.OperDown))
+	assert.NotContains(t, nm.links, 10)
+
+	// the interfaces without operational state are up when administratively up
+	assert.True(t, isUp(&netlink.LinkAttrs{OperState: netlink.OperUnknown, Flags: net.FlagUp}))
+	assert.False(t, isUp(&netlink.LinkAttrs{OperState: netlink.OperUnknown}))
+}
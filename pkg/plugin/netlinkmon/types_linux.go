@@ -0,0 +1,85 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package netlinkmon
+
+import (
+	"sync"
+
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/vishvananda/netlink"
+)
+
+const name = "netlinkmon"
+
+// procSysNet is the root of the sysctls of the host network namespace, Retina running in the host network.
+const procSysNet = "/proc/sys/net"
+
+const (
+	// Values of the family label
+	familyIPv4 = "ipv4"
+	familyIPv6 = "ipv6"
+
+	// Values of the type label of route_change_count
+	routeAdded   = "added"
+	routeDeleted = "deleted"
+
+	// Values of the state label of link_state_change_count
+	linkUp   = "up"
+	linkDown = "down"
+
+	// stateNone is the state of the neighbor entries in no other state
+	stateNone = "none"
+
+	// updatesBuffer is the size of the channels of the netlink subscriptions
+	updatesBuffer = 1024
+)
+
+var (
+	neighSubscribe    = netlink.NeighSubscribeWithOptions
+	routeSubscribe    = netlink.RouteSubscribeWithOptions
+	linkSubscribe     = netlink.LinkSubscribeWithOptions
+	routeListFiltered = netlink.RouteListFiltered
+
+	// neighStates are the values of the state label of neighbor_entries, by NUD state
+	neighStates = map[int]string{
+		netlink.NUD_INCOMPLETE: "incomplete",
+		netlink.NUD_REACHABLE:  "reachable",
+		netlink.NUD_STALE:      "stale",
+		netlink.NUD_DELAY:      "delay",
+		netlink.NUD_PROBE:      "probe",
+		netlink.NUD_FAILED:     "failed",
+		netlink.NUD_NOARP:      "noarp",
+		netlink.NUD_PERMANENT:  "permanent",
+	}
+
+	// gcThresholds are the sysctls of the garbage collection thresholds of the neighbor tables, and the values of the
+	// threshold label of neighbor_gc_thresh
+	gcThresholds = []string{"gc_thresh1", "gc_thresh2", "gc_thresh3"}
+)
+
+type netlinkmon struct {
+	cfg        *kcfg.Config
+	l          *log.ZapLogger
+	isRunning  bool
+	startLock  sync.Mutex
+	callbackID string
+	monitor    *NetlinkMonitor
+}
+
+// neighKey identifies a neighbor entry.
+type neighKey struct {
+	linkIndex int
+	family    int
+	ip        string
+}
+
+// linkState is the state of an interface, to count its changes.
+type linkState struct {
+	name string
+	up   bool
+	// wasUp tells if the interface has been up since it was seen, so that the new interfaces going up are not counted
+	wasUp bool
+	// labels are the label values of the changes counted, to delete them with the interface
+	labels [][]string
+}
@@ -0,0 +1,164 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+// Package nfconntrack contains the Retina nfconntrack plugin. It monitors the pressure on the netfilter conntrack
+// table: its size versus its maximum, the per-CPU conntrack statistics through ctnetlink, and the source pods with the
+// most entries.
+package nfconntrack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	hubblev1 "github.com/cilium/cilium/pkg/hubble/api/v1"
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/plugin/registry"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+	crconfig "sigs.k8s.io/controller-runtime/pkg/client/config"
+)
+
+var (
+	ErrAlreadyRunning = errors.New("nfconntrack plugin is already running")
+	errNoNodeName     = errors.New("node name is not set in " + nodeNameEnvKey)
+)
+
+func init() {
+	registry.Add(name, New)
+}
+
+// New creates a nfconntrack plugin.
+func New(cfg *kcfg.Config) registry.Plugin {
+	return &nfconntrack{
+		cfg: cfg,
+		l:   log.Logger().Named(name),
+	}
+}
+
+func (n *nfconntrack) Name() string {
+	return name
+}
+
+func (n *nfconntrack) Generate(context.Context) error {
+	return nil
+}
+
+func (n *nfconntrack) Compile(context.Context) error {
+	return nil
+}
+
+func (n *nfconntrack) Init() error {
+	return nil
+}
+
+func (n *nfconntrack) Start(ctx context.Context) error {
+	n.l.Info("Starting nfconntrack plugin")
+	n.startLock.Lock()
+	if n.isRunning {
+		n.startLock.Unlock()
+		return ErrAlreadyRunning
+	}
+	n.isRunning = true
+	n.startLock.Unlock()
+
+	conn, err := dial()
+	if err != nil {
+		n.l.Error("Error while opening ctnetlink socket", zap.Error(err))
+		return fmt.Errorf("failed to open ctnetlink socket: %w", err)
+	}
+	n.conn = conn
+
+	// Source pods of the entries are only resolved when pod level is enabled.
+	var e enricher.EnricherInterface
+	if n.cfg.EnablePodLevel && enricher.IsInitialized() {
+		e = enricher.Instance()
+	} else if n.cfg.ConntrackTableTopPods > 0 {
+		n.l.Warn("Top pods by conntrack entries require pod level, they will not be exported")
+	}
+	n.reader = NewNfConntrackReader(conn, e, n.cfg.ConntrackTableTopPods, n.cfg.ConntrackTableWarningThreshold)
+	if n.cfg.ConntrackTableWarningThreshold > 0 {
+		// The warning is still logged when it cannot be posted on the node.
+		if err := n.setupNodeEvents(ctx); err != nil {
+			n.l.Warn("Conntrack table warnings will not be posted as node events", zap.Error(err))
+		}
+	}
+
+	return n.run(ctx)
+}
+
+// setupNodeEvents makes the reader post the threshold warning as an event on the node of the agent.
+func (n *nfconntrack) setupNodeEvents(ctx context.Context) error {
+	nodeName := os.Getenv(nodeNameEnvKey)
+	if nodeName == "" {
+		return errNoNodeName
+	}
+	cfg, err := crconfig.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get kubeconfig: %w", err)
+	}
+	cl, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	n.broadcaster = events.NewBroadcaster(&events.EventSinkImpl{Interface: cl.EventsV1()})
+	n.broadcaster.StartRecordingToSink(ctx.Done())
+	n.reader.recorder = n.broadcaster.NewRecorder(scheme.Scheme, "retina-agent")
+	// The kubelet also uses the node name as the UID in the events of the node.
+	n.reader.node = &corev1.ObjectReference{Kind: "Node", Name: nodeName, UID: types.UID(nodeName)}
+	return nil
+}
+
+func (n *nfconntrack) SetupChannel(chan *hubblev1.Event) error {
+	n.l.Warn("Plugin does not support SetupChannel", zap.String("plugin", name))
+	return nil
+}
+
+func (n *nfconntrack) run(ctx context.Context) error {
+	n.l.Info("Running nfconntrack plugin...")
+	ticker := time.NewTicker(n.cfg.MetricsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			n.l.Info("Context is done, nfconntrack will stop running")
+			return nil
+		case <-ticker.C:
+			err := n.reader.readAndUpdate()
+			if err != nil {
+				n.l.Error("Reading conntrack stats failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (n *nfconntrack) Stop() error {
+	if !n.isRunning {
+		return nil
+	}
+	n.l.Info("Stopping nfconntrack plugin...")
+
+	if n.conn != nil {
+		if err := n.conn.Close(); err != nil {
+			n.l.Error("Error closing ctnetlink socket", zap.Error(err))
+		}
+		n.conn = nil
+	}
+	if n.broadcaster != nil {
+		n.broadcaster.Shutdown()
+		n.broadcaster = nil
+	}
+
+	n.isRunning = false
+	return nil
+}
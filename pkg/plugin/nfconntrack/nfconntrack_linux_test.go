@@ -0,0 +1,58 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package nfconntrack
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestStartStop(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+
+	conn := &fakeConn{}
+	oldDial := dial
+	defer func() { dial = oldDial }()
+	dial = func() (ctnetlink, error) { return conn, nil }
+
+	n := New(&kcfg.Config{MetricsInterval: 100 * time.Second, ConntrackTableTopPods: 10}).(*nfconntrack)
+	ctx, cancel := context.WithCancel(context.Background())
+	g, errctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		return n.Start(errctx)
+	})
+	require.Eventually(t, func() bool {
+		n.startLock.Lock()
+		defer n.startLock.Unlock()
+		return n.isRunning
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+	require.NoError(t, g.Wait())
+	// pods are not resolved without pod level
+	assert.Nil(t, n.reader.enricher)
+
+	require.NoError(t, n.Stop())
+	assert.True(t, conn.closed)
+	assert.False(t, n.isRunning)
+}
+
+func TestSetupNodeEventsWithoutNodeName(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	t.Setenv(nodeNameEnvKey, "")
+
+	n := New(&kcfg.Config{ConntrackTableWarningThreshold: 0.9}).(*nfconntrack)
+	n.reader = NewNfConntrackReader(&fakeConn{}, nil, 0, 0.9)
+	require.ErrorIs(t, n.setupNodeEvents(context.Background()), errNoNodeName)
+	assert.Nil(t, n.reader.recorder)
+	assert.Nil(t, n.broadcaster)
+}
@@ -0,0 +1,341 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package nfconntrack
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mdlayher/netlink"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/metrics"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/events"
+)
+
+// nfgenmsgLen is the length of the header of the nfnetlink messages.
+const nfgenmsgLen = 4
+
+const (
+	eventReasonTableFilling = "ConntrackTableFilling"
+	// eventTopPods is the maximum number of top pods listed in the note of the event, which is limited to 1kB
+	eventTopPods = 5
+)
+
+type podKey struct {
+	namespace string
+	podName   string
+}
+
+type NfConntrackReader struct {
+	l        *log.ZapLogger
+	conn     ctnetlink
+	enricher enricher.EnricherInterface
+	// topPods is the number of source pods with the most entries to export, 0 disables the dumps of the table
+	topPods int
+	// threshold is the fill ratio of the table above which a warning is logged, 0 disables the warning
+	threshold float64
+	// aboveThreshold is true while the fill ratio stays above the threshold, to only warn when it crosses it
+	aboveThreshold bool
+	// recorder posts the warning as an event on the node, the warning is only logged if it is nil
+	recorder events.EventRecorder
+	node     *corev1.ObjectReference
+
+	count      uint64
+	maxEntries uint64
+	cpuStats   []CPUStats
+	podEntries []PodEntries
+
+	// the pods exported by the last update, to delete the ones which are no longer in the top
+	exportedPods map[podKey]struct{}
+}
+
+// NewNfConntrackReader creates a reader of the conntrack table. The enricher is optional and resolves the source pods
+// of the entries.
+func NewNfConntrackReader(conn ctnetlink, e enricher.EnricherInterface, topPods int, threshold float64) *NfConntrackReader {
+	return &NfConntrackReader{
+		l:            log.Logger().Named(string("NfConntrackReader")),
+		conn:         conn,
+		enricher:     e,
+		topPods:      topPods,
+		threshold:    threshold,
+		exportedPods: make(map[podKey]struct{}),
+	}
+}
+
+func (nr *NfConntrackReader) readAndUpdate() error {
+	if err := nr.readTableSize(pathConntrackCount, pathConntrackMax); err != nil {
+		return err
+	}
+	// The statistics and the pods are best effort, the size of the table is exported without them.
+	if err := nr.readCPUStats(); err != nil {
+		nr.l.Error("Error while reading conntrack CPU stats", zap.Error(err))
+	}
+	if nr.topPods > 0 && nr.enricher != nil {
+		if err := nr.readPodEntries(); err != nil {
+			nr.l.Error("Error while dumping conntrack table", zap.Error(err))
+		}
+	}
+
+	nr.updateMetrics()
+	nr.checkThreshold()
+	nr.l.Debug("Done reading and updating conntrack stats")
+
+	return nil
+}
+
+func (nr *NfConntrackReader) readTableSize(countPath, maxPath string) error {
+	count, err := readUint(countPath)
+	if err != nil {
+		nr.l.Error("Error while reading nf_conntrack_count", zap.Error(err))
+		return err
+	}
+	maxEntries, err := readUint(maxPath)
+	if err != nil {
+		nr.l.Error("Error while reading nf_conntrack_max", zap.Error(err))
+		return err
+	}
+	nr.count, nr.maxEntries = count, maxEntries
+	return nil
+}
+
+func readUint(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to read %s", path)
+	}
+	v, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to parse %s", path)
+	}
+	return v, nil
+}
+
+// readCPUStats reads the statistics of each CPU, as `conntrack -S` does. Each message is the statistics of a CPU, with
+// the CPU in the resource ID of its header.
+func (nr *NfConntrackReader) readCPUStats() error {
+	msgs, err := nr.conn.Execute(request(ipctnlMsgCtGetStatsCPU, unix.AF_UNSPEC))
+	if err != nil {
+		return errors.Wrap(err, "failed to get conntrack CPU stats")
+	}
+
+	nr.cpuStats = nr.cpuStats[:0]
+	for _, msg := range msgs {
+		if len(msg.Data) < nfgenmsgLen {
+			continue
+		}
+		ad, err := netlink.NewAttributeDecoder(msg.Data[nfgenmsgLen:])
+		if err != nil {
+			nr.l.Debug("Invalid conntrack CPU stats message", zap.Error(err))
+			continue
+		}
+		ad.ByteOrder = binary.BigEndian
+
+		stats := CPUStats{CPU: int(binary.BigEndian.Uint16(msg.Data[2:nfgenmsgLen]))}
+		for ad.Next() {
+			switch ad.Type() {
+			case ctaStatsInsertFailed:
+				stats.InsertFailed = ad.Uint32()
+			case ctaStatsDrop:
+				stats.Drop = ad.Uint32()
+			case ctaStatsEarlyDrop:
+				stats.EarlyDrop = ad.Uint32()
+			case ctaStatsSearchRestart:
+				stats.SearchRestart = ad.Uint32()
+			}
+		}
+		if err := ad.Err(); err != nil {
+			nr.l.Debug("Invalid conntrack CPU stats attributes", zap.Error(err))
+			continue
+		}
+		nr.cpuStats = append(nr.cpuStats, stats)
+	}
+	return nil
+}
+
+// readPodEntries dumps the IPv4 and IPv6 entries of the table and counts them by the pod of their original source. The
+// dumps are streamed, as the table may have millions of entries.
+func (nr *NfConntrackReader) readPodEntries() error {
+	bySource := make(map[string]uint64)
+	for _, family := range []uint8{unix.AF_INET, unix.AF_INET6} {
+		if err := nr.dumpSources(family, bySource); err != nil {
+			return err
+		}
+	}
+
+	byPod := make(map[podKey]uint64)
+	for ip, entries := range bySource {
+		if ep := nr.enricher.EndpointByIP(ip); ep != nil {
+			byPod[podKey{namespace: ep.GetNamespace(), podName: ep.GetPodName()}] += entries
+		}
+	}
+
+	nr.podEntries = nr.podEntries[:0]
+	for k, entries := range byPod {
+		nr.podEntries = append(nr.podEntries, PodEntries{Namespace: k.namespace, PodName: k.podName, Entries: entries})
+	}
+	sort.Slice(nr.podEntries, func(i, j int) bool {
+		a, b := nr.podEntries[i], nr.podEntries[j]
+		if a.Entries != b.Entries {
+			return a.Entries > b.Entries
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.PodName < b.PodName
+	})
+	if len(nr.podEntries) > nr.topPods {
+		nr.podEntries = nr.podEntries[:nr.topPods]
+	}
+	return nil
+}
+
+// dumpSources dumps the entries of the table of an address family and counts them by their original source.
+func (nr *NfConntrackReader) dumpSources(family uint8, bySource map[string]uint64) error {
+	if _, err := nr.conn.Send(request(ipctnlMsgCtGet, family)); err != nil {
+		return errors.Wrap(err, "failed to request conntrack table dump")
+	}
+	for msg, err := range nr.conn.ReceiveIter() {
+		if err != nil {
+			return errors.Wrap(err, "failed to dump conntrack table")
+		}
+		if src := sourceIP(msg.Data); src != "" {
+			bySource[src]++
+		}
+	}
+	return nil
+}
+
+// sourceIP returns the source of the original direction of a conntrack entry, or "" if the message has none.
+func sourceIP(data []byte) string {
+	if len(data) < nfgenmsgLen {
+		return ""
+	}
+	ad, err := netlink.NewAttributeDecoder(data[nfgenmsgLen:])
+	if err != nil {
+		return ""
+	}
+
+	var src string
+	for ad.Next() {
+		if ad.Type() != ctaTupleOrig {
+			continue
+		}
+		ad.Nested(func(tad *netlink.AttributeDecoder) error {
+			for tad.Next() {
+				if tad.Type() != ctaTupleIP {
+					continue
+				}
+				tad.Nested(func(iad *netlink.AttributeDecoder) error {
+					for iad.Next() {
+						switch b := iad.Bytes(); {
+						case iad.Type() == ctaIPv4Src && len(b) == net.IPv4len,
+							iad.Type() == ctaIPv6Src && len(b) == net.IPv6len:
+							src = net.IP(b).String()
+						}
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+	}
+	if ad.Err() != nil {
+		return ""
+	}
+	return src
+}
+
+// request returns a ctnetlink dump request.
+func request(msgType uint16, family uint8) netlink.Message {
+	return netlink.Message{
+		Header: netlink.Header{
+			Type:  netlink.HeaderType(unix.NFNL_SUBSYS_CTNETLINK<<8 | msgType),
+			Flags: netlink.Request | netlink.Dump,
+		},
+		Data: []byte{family, unix.NFNETLINK_V0, 0, 0},
+	}
+}
+
+func (nr *NfConntrackReader) updateMetrics() {
+	metrics.NfConntrackEntriesGauge.WithLabelValues().Set(float64(nr.count))
+	metrics.NfConntrackMaxEntriesGauge.WithLabelValues().Set(float64(nr.maxEntries))
+
+	for _, stats := range nr.cpuStats {
+		cpu := strconv.Itoa(stats.CPU)
+		metrics.NfConntrackCPUStatsGauge.WithLabelValues(cpu, statInsertFailed).Set(float64(stats.InsertFailed))
+		metrics.NfConntrackCPUStatsGauge.WithLabelValues(cpu, statDrop).Set(float64(stats.Drop))
+		metrics.NfConntrackCPUStatsGauge.WithLabelValues(cpu, statEarlyDrop).Set(float64(stats.EarlyDrop))
+		metrics.NfConntrackCPUStatsGauge.WithLabelValues(cpu, statSearchRestart).Set(float64(stats.SearchRestart))
+	}
+
+	exported := make(map[podKey]struct{}, len(nr.podEntries))
+	for _, pod := range nr.podEntries {
+		exported[podKey{namespace: pod.Namespace, podName: pod.PodName}] = struct{}{}
+		metrics.NfConntrackPodEntriesGauge.WithLabelValues(pod.Namespace, pod.PodName).Set(float64(pod.Entries))
+	}
+	for k := range nr.exportedPods {
+		if _, ok := exported[k]; !ok {
+			metrics.NfConntrackPodEntriesGauge.DeleteLabelValues(k.namespace, k.podName)
+		}
+	}
+	nr.exportedPods = exported
+}
+
+// checkThreshold logs a warning, and posts it as an event on the node, when the fill ratio of the table crosses the threshold.
+func (nr *NfConntrackReader) checkThreshold() {
+	if nr.threshold == 0 || nr.maxEntries == 0 {
+		return
+	}
+
+	ratio := float64(nr.count) / float64(nr.maxEntries)
+	if ratio < nr.threshold {
+		nr.aboveThreshold = false
+		return
+	}
+	if nr.aboveThreshold {
+		return
+	}
+	nr.aboveThreshold = true
+
+	fields := []zap.Field{
+		zap.Uint64("count", nr.count),
+		zap.Uint64("max", nr.maxEntries),
+		zap.Float64("ratio", ratio),
+		zap.Float64("threshold", nr.threshold),
+	}
+	if len(nr.podEntries) > 0 {
+		fields = append(fields, zap.Any("topPods", nr.podEntries))
+	}
+	nr.l.Warn("nf_conntrack table fill ratio crossed the warning threshold, new connections are dropped when it is full", fields...)
+
+	if nr.recorder != nil {
+		nr.recorder.Eventf(nr.node, nil, corev1.EventTypeWarning, eventReasonTableFilling, "CheckThreshold",
+			"nf_conntrack table is %.0f%% full (%d/%d entries), new connections are dropped when it is full%s",
+			ratio*100, nr.count, nr.maxEntries, topPodsNote(nr.podEntries))
+	}
+}
+
+// topPodsNote lists the first pods with the most entries for the note of the event.
+func topPodsNote(pods []PodEntries) string {
+	if len(pods) == 0 {
+		return ""
+	}
+	if len(pods) > eventTopPods {
+		pods = pods[:eventTopPods]
+	}
+	top := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		top = append(top, fmt.Sprintf("%s/%s (%d)", pod.Namespace, pod.PodName, pod.Entries))
+	}
+	return ", top pods: " + strings.Join(top, ", ")
+}
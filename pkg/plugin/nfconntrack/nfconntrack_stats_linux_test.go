@@ -0,0 +1,267 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package nfconntrack
+
+import (
+	"encoding/binary"
+	"errors"
+	"iter"
+	"net"
+	"testing"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	"github.com/mdlayher/netlink"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gomock "go.uber.org/mock/gomock"
+	"golang.org/x/sys/unix"
+	"k8s.io/client-go/tools/events"
+)
+
+var errNetlink = errors.New("netlink error")
+
+type fakeConn struct {
+	stats []netlink.Message
+	// entries of the table dumps, by address family
+	entries map[uint8][]netlink.Message
+	err     error
+	sent    []netlink.Message
+	closed  bool
+}
+
+func (f *fakeConn) Execute(m netlink.Message) ([]netlink.Message, error) {
+	f.sent = append(f.sent, m)
+	return f.stats, f.err
+}
+
+func (f *fakeConn) Send(m netlink.Message) (netlink.Message, error) {
+	f.sent = append(f.sent, m)
+	return m, f.err
+}
+
+func (f *fakeConn) ReceiveIter() iter.Seq2[netlink.Message, error] {
+	family := f.sent[len(f.sent)-1].Data[0]
+	return func(yield func(netlink.Message, error) bool) {
+		for _, m := range f.entries[family] {
+			if !yield(m, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (f *fakeConn) Close() error {
+	f.closed = true
+	return nil
+}
+
+func nfMessage(t *testing.T, resID uint16, encode func(ae *netlink.AttributeEncoder)) netlink.Message {
+	t.Helper()
+	ae := netlink.NewAttributeEncoder()
+	ae.ByteOrder = binary.BigEndian
+	encode(ae)
+	attrs, err := ae.Encode()
+	require.NoError(t, err)
+
+	data := []byte{unix.AF_INET, unix.NFNETLINK_V0, 0, 0}
+	binary.BigEndian.PutUint16(data[2:], resID)
+	return netlink.Message{Data: append(data, attrs...)}
+}
+
+func cpuStatsMessage(t *testing.T, cpu uint16, insertFailed, drop, earlyDrop, searchRestart uint32) netlink.Message {
+	t.Helper()
+	return nfMessage(t, cpu, func(ae *netlink.AttributeEncoder) {
+		// found, not exported
+		ae.Uint32(2, 100)
+		ae.Uint32(ctaStatsInsertFailed, insertFailed)
+		ae.Uint32(ctaStatsDrop, drop)
+		ae.Uint32(ctaStatsEarlyDrop, earlyDrop)
+		ae.Uint32(ctaStatsSearchRestart, searchRestart)
+	})
+}
+
+func entryMessage(t *testing.T, src, dst string) netlink.Message {
+	t.Helper()
+	// IPv6 addresses are encoded in the attributes following those of IPv4
+	srcType, srcIP, dstIP := uint16(ctaIPv4Src), net.ParseIP(src).To4(), net.ParseIP(dst).To4()
+	if srcIP == nil {
+		srcType, srcIP, dstIP = ctaIPv6Src, net.ParseIP(src), net.ParseIP(dst)
+	}
+	return nfMessage(t, 0, func(ae *netlink.AttributeEncoder) {
+		ae.Nested(ctaTupleOrig, func(tae *netlink.AttributeEncoder) error {
+			tae.Nested(ctaTupleIP, func(iae *netlink.AttributeEncoder) error {
+				iae.Bytes(srcType, srcIP)
+				iae.Bytes(srcType+1, dstIP)
+				return nil
+			})
+			return nil
+		})
+		// the reply tuple has the pod as destination
+		ae.Nested(2, func(tae *netlink.AttributeEncoder) error {
+			tae.Nested(ctaTupleIP, func(iae *netlink.AttributeEncoder) error {
+				iae.Bytes(srcType, dstIP)
+				return nil
+			})
+			return nil
+		})
+	})
+}
+
+func TestReadTableSize(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+
+	nr := NewNfConntrackReader(&fakeConn{}, nil, 0, 0)
+	require.NoError(t, nr.readTableSize("testdata/nf_conntrack_count", "testdata/nf_conntrack_max"))
+	assert.Equal(t, uint64(1523), nr.count)
+	assert.Equal(t, uint64(262144), nr.maxEntries)
+
+	require.Error(t, nr.readTableSize("testdata/wrong-nf_conntrack_count", "testdata/nf_conntrack_max"))
+	require.Error(t, nr.readTableSize("testdata/nf_conntrack_count", "testdata/nonexistent"))
+}
+
+func TestReadCPUStats(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+
+	conn := &fakeConn{stats: []netlink.Message{
+		cpuStatsMessage(t, 0, 1, 2, 3, 4),
+		cpuStatsMessage(t, 3, 5, 6, 7, 8),
+		// truncated
+		{Data: []byte{unix.AF_INET}},
+	}}
+	nr := NewNfConntrackReader(conn, nil, 0, 0)
+	require.NoError(t, nr.readCPUStats())
+	assert.Equal(t, []CPUStats{
+		{CPU: 0, InsertFailed: 1, Drop: 2, EarlyDrop: 3, SearchRestart: 4},
+		{CPU: 3, InsertFailed: 5, Drop: 6, EarlyDrop: 7, SearchRestart: 8},
+	}, nr.cpuStats)
+	require.Len(t, conn.sent, 1)
+	assert.Equal(t, netlink.HeaderType(unix.NFNL_SUBSYS_CTNETLINK<<8|ipctnlMsgCtGetStatsCPU), conn.sent[0].Header.Type)
+
+	conn.err = errNetlink
+	require.ErrorIs(t, nr.readCPUStats(), errNetlink)
+}
+
+func TestReadPodEntries(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	conn := &fakeConn{entries: map[uint8][]netlink.Message{
+		unix.AF_INET: {
+			entryMessage(t, "10.0.0.5", "1.1.1.1"),
+			entryMessage(t, "10.0.0.5", "1.1.1.2"),
+			entryMessage(t, "10.0.0.7", "1.1.1.1"),
+			entryMessage(t, "10.0.0.7", "1.1.1.3"),
+			entryMessage(t, "10.0.0.8", "1.1.1.1"),
+			entryMessage(t, "192.168.0.1", "10.0.0.5"),
+			// no tuple
+			nfMessage(t, 0, func(ae *netlink.AttributeEncoder) { ae.Uint32(3, 1) }),
+		},
+		unix.AF_INET6: {
+			entryMessage(t, "fd00::6", "2001:db8::1"),
+			entryMessage(t, "fd00::6", "2001:db8::2"),
+		},
+	}}
+
+	e := enricher.NewMockEnricherInterface(ctrl)
+	// both IPs of the dual-stack pod1
+	e.EXPECT().EndpointByIP("10.0.0.5").Return(&flow.Endpoint{Namespace: "ns1", PodName: "pod1"})
+	e.EXPECT().EndpointByIP("fd00::6").Return(&flow.Endpoint{Namespace: "ns1", PodName: "pod1"})
+	e.EXPECT().EndpointByIP("10.0.0.7").Return(&flow.Endpoint{Namespace: "ns2", PodName: "pod2"})
+	e.EXPECT().EndpointByIP("10.0.0.8").Return(&flow.Endpoint{Namespace: "ns2", PodName: "pod3"})
+	e.EXPECT().EndpointByIP("192.168.0.1").Return(nil)
+
+	nr := NewNfConntrackReader(conn, e, 2, 0)
+	require.NoError(t, nr.readPodEntries())
+	assert.Equal(t, []PodEntries{
+		{Namespace: "ns1", PodName: "pod1", Entries: 4},
+		{Namespace: "ns2", PodName: "pod2", Entries: 2},
+	}, nr.podEntries)
+	require.Len(t, conn.sent, 2)
+	for i, family := range []byte{unix.AF_INET, unix.AF_INET6} {
+		assert.Equal(t, netlink.HeaderType(unix.NFNL_SUBSYS_CTNETLINK<<8|ipctnlMsgCtGet), conn.sent[i].Header.Type)
+		assert.Equal(t, family, conn.sent[i].Data[0])
+	}
+}
+
+func TestNfConntrackUpdateMetrics(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	entriesGauge := metrics.NewMockGaugeVec(ctrl)
+	maxGauge := metrics.NewMockGaugeVec(ctrl)
+	cpuGauge := metrics.NewMockGaugeVec(ctrl)
+	podGauge := metrics.NewMockGaugeVec(ctrl)
+	oldEntries, oldMax, oldCPU, oldPod := metrics.NfConntrackEntriesGauge, metrics.NfConntrackMaxEntriesGauge, metrics.NfConntrackCPUStatsGauge, metrics.NfConntrackPodEntriesGauge
+	metrics.NfConntrackEntriesGauge, metrics.NfConntrackMaxEntriesGauge, metrics.NfConntrackCPUStatsGauge, metrics.NfConntrackPodEntriesGauge = entriesGauge, maxGauge, cpuGauge, podGauge
+	defer func() {
+		metrics.NfConntrackEntriesGauge, metrics.NfConntrackMaxEntriesGauge, metrics.NfConntrackCPUStatsGauge, metrics.NfConntrackPodEntriesGauge = oldEntries, oldMax, oldCPU, oldPod
+	}()
+
+	testmetric := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "testmetric",
+		Help: "testmetric",
+	})
+	entriesGauge.EXPECT().WithLabelValues().Return(testmetric).Times(2)
+	maxGauge.EXPECT().WithLabelValues().Return(testmetric).Times(2)
+	for _, stat := range []string{statInsertFailed, statDrop, statEarlyDrop, statSearchRestart} {
+		cpuGauge.EXPECT().WithLabelValues("1", stat).Return(testmetric).Times(2)
+	}
+	podGauge.EXPECT().WithLabelValues("ns1", "pod1").Return(testmetric).Times(2)
+	podGauge.EXPECT().WithLabelValues("ns2", "pod2").Return(testmetric).Times(1)
+
+	nr := NewNfConntrackReader(&fakeConn{}, nil, 2, 0)
+	nr.count, nr.maxEntries = 10, 100
+	nr.cpuStats = []CPUStats{{CPU: 1}}
+	nr.podEntries = []PodEntries{{Namespace: "ns1", PodName: "pod1", Entries: 3}, {Namespace: "ns2", PodName: "pod2", Entries: 2}}
+	nr.updateMetrics()
+
+	// pods which are no longer in the top are deleted
+	podGauge.EXPECT().DeleteLabelValues("ns2", "pod2").Return(true).Times(1)
+	nr.podEntries = nr.podEntries[:1]
+	nr.updateMetrics()
+}
+
+func TestCheckThreshold(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+
+	recorder := events.NewFakeRecorder(10)
+	nr := NewNfConntrackReader(&fakeConn{}, nil, 0, 0.9)
+	nr.recorder = recorder
+	nr.count, nr.maxEntries = 80, 100
+	nr.checkThreshold()
+	assert.False(t, nr.aboveThreshold)
+	assert.Empty(t, recorder.Events)
+
+	nr.count = 95
+	nr.podEntries = []PodEntries{{Namespace: "ns1", PodName: "pod1", Entries: 40}}
+	nr.checkThreshold()
+	assert.True(t, nr.aboveThreshold)
+	require.Len(t, recorder.Events, 1)
+	assert.Equal(t, "Warning ConntrackTableFilling nf_conntrack table is 95% full (95/100 entries), "+
+		"new connections are dropped when it is full, top pods: ns1/pod1 (40)", <-recorder.Events)
+	nr.checkThreshold()
+	assert.True(t, nr.aboveThreshold)
+	assert.Empty(t, recorder.Events)
+
+	nr.count = 50
+	nr.checkThreshold()
+	assert.False(t, nr.aboveThreshold)
+	assert.Empty(t, recorder.Events)
+
+	// disabled
+	nr = NewNfConntrackReader(&fakeConn{}, nil, 0, 0)
+	nr.count, nr.maxEntries = 100, 100
+	nr.checkThreshold()
+	assert.False(t, nr.aboveThreshold)
+}
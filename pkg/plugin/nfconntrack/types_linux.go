@@ -0,0 +1,91 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package nfconntrack
+
+import (
+	"iter"
+	"sync"
+
+	"github.com/mdlayher/netlink"
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/log"
+	"golang.org/x/sys/unix"
+	"k8s.io/client-go/tools/events"
+)
+
+const name = "nfconntrack"
+
+const (
+	pathConntrackCount = "/proc/sys/net/netfilter/nf_conntrack_count"
+	pathConntrackMax   = "/proc/sys/net/netfilter/nf_conntrack_max"
+)
+
+// nodeNameEnvKey is the environment variable with the name of the node of the agent.
+const nodeNameEnvKey = "NODE_NAME"
+
+// ctnetlink messages and attributes, see include/uapi/linux/netfilter/nfnetlink_conntrack.h
+const (
+	ipctnlMsgCtGet         = 1
+	ipctnlMsgCtGetStatsCPU = 4
+
+	ctaTupleOrig = 1
+	ctaTupleIP   = 1
+	ctaIPv4Src   = 1
+	ctaIPv6Src   = 3
+
+	ctaStatsInsertFailed  = 9
+	ctaStatsDrop          = 10
+	ctaStatsEarlyDrop     = 11
+	ctaStatsSearchRestart = 13
+)
+
+const (
+	// Statistic names of the nf_conntrack_cpu_stats metric
+	statInsertFailed  = "insert_failed"
+	statDrop          = "drop"
+	statEarlyDrop     = "early_drop"
+	statSearchRestart = "search_restart"
+)
+
+var dial = func() (ctnetlink, error) {
+	return netlink.Dial(unix.NETLINK_NETFILTER, nil)
+}
+
+type nfconntrack struct {
+	cfg       *kcfg.Config
+	l         *log.ZapLogger
+	isRunning bool
+	startLock sync.Mutex
+	conn      ctnetlink
+	reader    *NfConntrackReader
+	// broadcaster sends the events of the threshold warning, nil if the warning is disabled
+	broadcaster events.EventBroadcaster
+}
+
+// CPUStats are the conntrack statistics of a CPU.
+type CPUStats struct {
+	CPU int
+	// InsertFailed is the number of entries which could not be inserted in the table, e.g. when it is full
+	InsertFailed uint32
+	// Drop is the number of packets dropped because their entry could not be created
+	Drop uint32
+	// EarlyDrop is the number of entries dropped to make room for new ones when the table is full
+	EarlyDrop uint32
+	// SearchRestart is the number of lookups restarted because of a hash resize
+	SearchRestart uint32
+}
+
+// PodEntries is the number of conntrack entries of a source pod.
+type PodEntries struct {
+	Namespace string
+	PodName   string
+	Entries   uint64
+}
+
+// ctnetlink is the netlink connection to the conntrack subsystem.
+type ctnetlink interface {
+	Execute(m netlink.Message) ([]netlink.Message, error)
+	Send(m netlink.Message) (netlink.Message, error)
+	ReceiveIter() iter.Seq2[netlink.Message, error]
+	Close() error
+}
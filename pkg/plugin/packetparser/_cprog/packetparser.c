@@ -185,6 +185,7 @@ static void parse(struct __sk_buff *skb, __u8 obs)
 
 		tcp_metadata.seq = tcp->seq;
 		tcp_metadata.ack_num = tcp->ack_seq;
+		tcp_metadata.window = bpf_ntohs(tcp->window);
 		p.tcp_metadata = tcp_metadata;
 
 		// Get TSval/TSecr from TCP header.
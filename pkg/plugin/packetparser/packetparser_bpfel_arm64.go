@@ -8,11 +8,13 @@ import (
 	_ "embed"
 	"fmt"
 	"io"
+	"structs"
 
 	"github.com/cilium/ebpf"
 )
 
 type packetparserCtEntry struct {
+	_                               structs.HostLayout
 	EvictionTime                    uint32
 	LastReportTxDir                 uint32
 	LastReportRxDir                 uint32
@@ -21,6 +23,7 @@ type packetparserCtEntry struct {
 	PacketsSeenSinceLastReportTxDir uint32
 	PacketsSeenSinceLastReportRxDir uint32
 	FlagsSeenSinceLastReportTxDir   struct {
+		_   structs.HostLayout
 		Syn uint32
 		Ack uint32
 		Fin uint32
@@ -32,6 +35,7 @@ type packetparserCtEntry struct {
 		Ns  uint32
 	}
 	FlagsSeenSinceLastReportRxDir struct {
+		_   structs.HostLayout
 		Syn uint32
 		Ack uint32
 		Fin uint32
@@ -47,6 +51,7 @@ type packetparserCtEntry struct {
 	FlagsSeenRxDir     uint8
 	IsDirectionUnknown bool
 	ConntrackMetadata  struct {
+		_              structs.HostLayout
 		BytesTxCount   uint64
 		BytesRxCount   uint64
 		PacketsTxCount uint32
@@ -55,6 +60,7 @@ type packetparserCtEntry struct {
 }
 
 type packetparserCtV4Key struct {
+	_       structs.HostLayout
 	SrcIp   uint32
 	DstIp   uint32
 	SrcPort uint16
@@ -64,11 +70,13 @@ type packetparserCtV4Key struct {
 }
 
 type packetparserMapKey struct {
+	_         structs.HostLayout
 	Prefixlen uint32
 	Data      uint32
 }
 
 type packetparserPacket struct {
+	_           structs.HostLayout
 	T_nsec      uint64
 	Bytes       uint32
 	SrcIp       uint32
@@ -76,10 +84,13 @@ type packetparserPacket struct {
 	SrcPort     uint16
 	DstPort     uint16
 	TcpMetadata struct {
+		_      structs.HostLayout
 		Seq    uint32
 		AckNum uint32
 		Tsval  uint32
 		Tsecr  uint32
+		Window uint16
+		_      [2]byte
 	}
 	ObservationPoint          uint8
 	TrafficDirection          uint8
@@ -91,6 +102,7 @@ type packetparserPacket struct {
 	PreviouslyObservedPackets uint32
 	PreviouslyObservedBytes   uint32
 	PreviouslyObservedFlags   struct {
+		_   structs.HostLayout
 		Syn uint32
 		Ack uint32
 		Fin uint32
@@ -101,8 +113,8 @@ type packetparserPacket struct {
 		Cwr uint32
 		Ns  uint32
 	}
-	_                 [4]byte
 	ConntrackMetadata struct {
+		_              structs.HostLayout
 		BytesTxCount   uint64
 		BytesRxCount   uint64
 		PacketsTxCount uint32
@@ -110,6 +122,20 @@ type packetparserPacket struct {
 	}
 }
 
+// Names of all BPF objects in the ELF.
+//
+// Used for safe lookups in a Collection or CollectionSpec.
+const (
+	packetparserMapRetinaConntrack          = "retina_conntrack"
+	packetparserMapRetinaFilter             = "retina_filter"
+	packetparserMapRetinaPacketparserEvents = "retina_packetparser_events"
+	packetparserProgEndpointEgressFilter    = "endpoint_egress_filter"
+	packetparserProgEndpointIngressFilter   = "endpoint_ingress_filter"
+	packetparserProgHostEgressFilter        = "host_egress_filter"
+	packetparserProgHostIngressFilter       = "host_ingress_filter"
+	packetparserVarUnused                   = "unused"
+)
+
 // loadPacketparser returns the embedded CollectionSpec for packetparser.
 func loadPacketparser() (*ebpf.CollectionSpec, error) {
 	reader := bytes.NewReader(_PacketparserBytes)
@@ -130,7 +156,7 @@ func loadPacketparser() (*ebpf.CollectionSpec, error) {
 //	*packetparserMaps
 //
 // See ebpf.CollectionSpec.LoadAndAssign documentation for details.
-func loadPacketparserObjects(obj interface{}, opts *ebpf.CollectionOptions) error {
+func loadPacketparserObjects(obj any, opts *ebpf.CollectionOptions) error {
 	spec, err := loadPacketparser()
 	if err != nil {
 		return err
@@ -145,9 +171,10 @@ func loadPacketparserObjects(obj interface{}, opts *ebpf.CollectionOptions) erro
 type packetparserSpecs struct {
 	packetparserProgramSpecs
 	packetparserMapSpecs
+	packetparserVariableSpecs
 }
 
-// packetparserSpecs contains programs before they are loaded into the kernel.
+// packetparserProgramSpecs contains programs before they are loaded into the kernel.
 //
 // It can be passed ebpf.CollectionSpec.Assign.
 type packetparserProgramSpecs struct {
@@ -166,12 +193,20 @@ type packetparserMapSpecs struct {
 	RetinaPacketparserEvents *ebpf.MapSpec `ebpf:"retina_packetparser_events"`
 }
 
+// packetparserVariableSpecs contains global variables before they are loaded into the kernel.
+//
+// It can be passed ebpf.CollectionSpec.Assign.
+type packetparserVariableSpecs struct {
+	Unused *ebpf.VariableSpec `ebpf:"unused"`
+}
+
 // packetparserObjects contains all objects after they have been loaded into the kernel.
 //
 // It can be passed to loadPacketparserObjects or ebpf.CollectionSpec.LoadAndAssign.
 type packetparserObjects struct {
 	packetparserPrograms
 	packetparserMaps
+	packetparserVariables
 }
 
 func (o *packetparserObjects) Close() error {
@@ -198,6 +233,13 @@ func (m *packetparserMaps) Close() error {
 	)
 }
 
+// packetparserVariables contains all global variables after they have been loaded into the kernel.
+//
+// It can be passed to loadPacketparserObjects or ebpf.CollectionSpec.LoadAndAssign.
+type packetparserVariables struct {
+	Unused *ebpf.Variable `ebpf:"unused"`
+}
+
 // packetparserPrograms contains all programs after they have been loaded into the kernel.
 //
 // It can be passed to loadPacketparserObjects or ebpf.CollectionSpec.LoadAndAssign.
@@ -855,6 +855,10 @@ func (p *packetParser) processRecord(ctx context.Context, id int) {
 				uint16((bpfEvent.Flags&TCPFlagCWR)>>7), // nolint:gomnd // 7 is the offset for CWR.
 				uint16((bpfEvent.Flags&TCPFlagNS)>>8),  // nolint:gomnd // 8 is the offset for NS.
 			)
+			// A zero window on anything but a SYN or RST is advertised by a receiver which ran out of buffer space.
+			if bpfEvent.Proto == unix.IPPROTO_TCP && tcpMetadata.Window == 0 && bpfEvent.Flags&(TCPFlagSYN|TCPFlagRST) == 0 {
+				utils.AddTCPZeroWindow(ext)
+			}
 			utils.AddPreviouslyObservedTCPFlags(
 				ext,
 				bpfEvent.PreviouslyObservedFlags.Syn,
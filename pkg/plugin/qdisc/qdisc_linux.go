@@ -0,0 +1,185 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+// Package qdisc contains the Retina qdisc plugin. It gathers the statistics of the qdiscs and traffic control classes
+// of the host and pod veth interfaces through netlink.
+package qdisc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	hubblev1 "github.com/cilium/cilium/pkg/hubble/api/v1"
+	tc "github.com/florianl/go-tc"
+	"github.com/microsoft/retina/pkg/common"
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/plugin/registry"
+	"github.com/microsoft/retina/pkg/pubsub"
+	"github.com/microsoft/retina/pkg/utils"
+	"github.com/microsoft/retina/pkg/watchers/endpoint"
+	"github.com/vishvananda/netlink"
+	"go.uber.org/zap"
+)
+
+var ErrAlreadyRunning = errors.New("qdisc plugin is already running")
+
+var getDefaultOutgoingLinks = utils.GetDefaultOutgoingLinks
+
+func init() {
+	registry.Add(name, New)
+}
+
+// New creates a qdisc plugin.
+func New(cfg *kcfg.Config) registry.Plugin {
+	return &qdiscPlugin{
+		cfg: cfg,
+		l:   log.Logger().Named(name),
+	}
+}
+
+func (q *qdiscPlugin) Name() string {
+	return name
+}
+
+func (q *qdiscPlugin) Generate(context.Context) error {
+	return nil
+}
+
+func (q *qdiscPlugin) Compile(context.Context) error {
+	return nil
+}
+
+func (q *qdiscPlugin) Init() error {
+	return nil
+}
+
+func (q *qdiscPlugin) Start(ctx context.Context) error {
+	q.l.Info("Starting qdisc plugin")
+	q.startLock.Lock()
+	if q.isRunning {
+		q.startLock.Unlock()
+		return ErrAlreadyRunning
+	}
+	q.isRunning = true
+	q.startLock.Unlock()
+
+	tcnl, err := tcOpen(&tc.Config{})
+	if err != nil {
+		q.l.Error("Error while opening tc netlink socket", zap.Error(err))
+		return fmt.Errorf("failed to open tc netlink socket: %w", err)
+	}
+	q.tcnl = tcnl
+
+	// Pods of veths are only resolved when pod level is enabled.
+	var e enricher.EnricherInterface
+	if q.cfg.EnablePodLevel && enricher.IsInitialized() {
+		e = enricher.Instance()
+	}
+	q.reader = NewQdiscReader(tcnl, e)
+
+	// Track the pod veths published by the endpoint watcher.
+	fn := pubsub.CallBackFunc(q.endpointWatcherCallbackFn)
+	if q.callbackID == "" {
+		q.callbackID = pubsub.New().Subscribe(common.PubSubEndpoints, &fn)
+	}
+
+	return q.run(ctx)
+}
+
+func (q *qdiscPlugin) SetupChannel(chan *hubblev1.Event) error {
+	q.l.Warn("Plugin does not support SetupChannel", zap.String("plugin", name))
+	return nil
+}
+
+func (q *qdiscPlugin) run(ctx context.Context) error {
+	q.l.Info("Running qdisc plugin...")
+	ticker := time.NewTicker(q.cfg.MetricsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			q.l.Info("Context is done, qdisc will stop running")
+			return nil
+		case <-ticker.C:
+			err := q.reader.readAndUpdate(q.hostLinks(), q.podVeths())
+			if err != nil {
+				q.l.Error("Reading qdisc stats failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// hostLinks returns the default outgoing interfaces of the node.
+func (q *qdiscPlugin) hostLinks() []netlink.LinkAttrs {
+	links, err := getDefaultOutgoingLinks()
+	if err != nil {
+		q.l.Warn("Failed to get default outgoing links", zap.Error(err))
+		return nil
+	}
+	attrs := make([]netlink.LinkAttrs, 0, len(links))
+	for _, link := range links {
+		attrs = append(attrs, *link.Attrs())
+	}
+	return attrs
+}
+
+func (q *qdiscPlugin) podVeths() []netlink.LinkAttrs {
+	var veths []netlink.LinkAttrs
+	q.veths.Range(func(_, value any) bool {
+		veths = append(veths, value.(netlink.LinkAttrs))
+		return true
+	})
+	return veths
+}
+
+func (q *qdiscPlugin) endpointWatcherCallbackFn(obj interface{}) {
+	// Contract is that we will receive an endpoint event pointer.
+	event := obj.(*endpoint.EndpointEvent)
+	if event == nil {
+		return
+	}
+
+	iface := event.Obj.(netlink.LinkAttrs)
+	switch event.Type {
+	case endpoint.EndpointCreated:
+		q.l.Debug("Endpoint created", zap.String("name", iface.Name))
+		q.veths.Store(iface.Index, iface)
+	case endpoint.EndpointDeleted:
+		q.l.Debug("Endpoint deleted", zap.String("name", iface.Name))
+		// The index may have been reused by a veth created in the same refresh.
+		if value, ok := q.veths.Load(iface.Index); ok && value.(netlink.LinkAttrs).Name == iface.Name {
+			q.veths.Delete(iface.Index)
+		}
+	default:
+		// Unknown.
+		q.l.Debug("Unknown event", zap.String("type", event.Type.String()))
+	}
+}
+
+func (q *qdiscPlugin) Stop() error {
+	if !q.isRunning {
+		return nil
+	}
+	q.l.Info("Stopping qdisc plugin...")
+
+	if q.callbackID != "" {
+		if err := pubsub.New().Unsubscribe(common.PubSubEndpoints, q.callbackID); err != nil {
+			q.l.Error("Error unregistering callback for qdisc", zap.Error(err))
+		}
+		q.callbackID = ""
+	}
+	if q.tcnl != nil {
+		if err := q.tcnl.Close(); err != nil {
+			q.l.Error("Error closing tc netlink socket", zap.Error(err))
+		}
+		q.tcnl = nil
+	}
+
+	q.isRunning = false
+	return nil
+}
@@ -0,0 +1,77 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package qdisc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	tc "github.com/florianl/go-tc"
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/watchers/endpoint"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sync/errgroup"
+)
+
+type fakeNltc struct {
+	closed bool
+}
+
+func (f *fakeNltc) Qdisc() *tc.Qdisc { return nil }
+
+func (f *fakeNltc) Class() *tc.Class { return nil }
+
+func (f *fakeNltc) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestEndpointWatcherCallbackFn(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	q := New(&kcfg.Config{}).(*qdiscPlugin)
+
+	q.endpointWatcherCallbackFn(endpoint.NewEndpointEvent(endpoint.EndpointCreated, netlink.LinkAttrs{Index: 10, Name: "azv1"}))
+	q.endpointWatcherCallbackFn(endpoint.NewEndpointEvent(endpoint.EndpointCreated, netlink.LinkAttrs{Index: 11, Name: "azv2"}))
+	assert.ElementsMatch(t, []netlink.LinkAttrs{{Index: 10, Name: "azv1"}, {Index: 11, Name: "azv2"}}, q.podVeths())
+
+	// the index of a deleted veth reused by a new veth
+	q.endpointWatcherCallbackFn(endpoint.NewEndpointEvent(endpoint.EndpointCreated, netlink.LinkAttrs{Index: 11, Name: "azv3"}))
+	q.endpointWatcherCallbackFn(endpoint.NewEndpointEvent(endpoint.EndpointDeleted, netlink.LinkAttrs{Index: 11, Name: "azv2"}))
+	q.endpointWatcherCallbackFn(endpoint.NewEndpointEvent(endpoint.EndpointDeleted, netlink.LinkAttrs{Index: 10, Name: "azv1"}))
+	assert.Equal(t, []netlink.LinkAttrs{{Index: 11, Name: "azv3"}}, q.podVeths())
+}
+
+func TestStartStop(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+
+	tcnl := &fakeNltc{}
+	oldTcOpen := tcOpen
+	defer func() { tcOpen = oldTcOpen }()
+	tcOpen = func(*tc.Config) (nltc, error) { return tcnl, nil }
+
+	q := New(&kcfg.Config{MetricsInterval: 100 * time.Second}).(*qdiscPlugin)
+	ctx, cancel := context.WithCancel(context.Background())
+	g, errctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		return q.Start(errctx)
+	})
+	require.Eventually(t, func() bool {
+		q.startLock.Lock()
+		defer q.startLock.Unlock()
+		return q.isRunning
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+	require.NoError(t, g.Wait())
+
+	require.NoError(t, q.Stop())
+	assert.True(t, tcnl.closed)
+	assert.False(t, q.isRunning)
+	assert.Empty(t, q.callbackID)
+}
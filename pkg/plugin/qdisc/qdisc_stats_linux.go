@@ -0,0 +1,218 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package qdisc
+
+import (
+	"fmt"
+
+	tc "github.com/florianl/go-tc"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/metrics"
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+// qdiscKey are the labels of a qdisc or class, without the statistic name.
+type qdiscKey struct {
+	iface     string
+	namespace string
+	podName   string
+	kind      string
+	handle    string
+}
+
+type QdiscReader struct {
+	l        *log.ZapLogger
+	tcnl     nltc
+	enricher enricher.EnricherInterface
+
+	qdiscStats []QdiscStats
+	classStats []QdiscStats
+
+	// the label sets exported by the last update, to delete the ones of removed qdiscs and classes
+	exportedQdiscs  map[qdiscKey]struct{}
+	exportedClasses map[qdiscKey]struct{}
+}
+
+// NewQdiscReader creates a reader of the qdisc and class statistics of interfaces. The enricher is optional and
+// resolves the pods of veth interfaces.
+func NewQdiscReader(tcnl nltc, e enricher.EnricherInterface) *QdiscReader {
+	return &QdiscReader{
+		l:               log.Logger().Named(string("QdiscReader")),
+		tcnl:            tcnl,
+		enricher:        e,
+		exportedQdiscs:  make(map[qdiscKey]struct{}),
+		exportedClasses: make(map[qdiscKey]struct{}),
+	}
+}
+
+func (qr *QdiscReader) readAndUpdate(hostLinks, veths []netlink.LinkAttrs) error {
+	ifaces := qr.interfaces(hostLinks, veths)
+	if err := qr.readQdiscStats(ifaces); err != nil {
+		return err
+	}
+	qr.readClassStats(ifaces)
+
+	qr.updateMetrics()
+	qr.l.Debug("Done reading and updating qdisc stats")
+
+	return nil
+}
+
+// interfaces returns the interfaces to read, resolving the pods of the veths through the host routes to their IPs.
+func (qr *QdiscReader) interfaces(hostLinks, veths []netlink.LinkAttrs) map[int]tcInterface {
+	ifaces := make(map[int]tcInterface, len(hostLinks)+len(veths))
+	for i := range hostLinks {
+		ifaces[hostLinks[i].Index] = tcInterface{index: hostLinks[i].Index, name: hostLinks[i].Name}
+	}
+	for i := range veths {
+		ifaces[veths[i].Index] = tcInterface{index: veths[i].Index, name: veths[i].Name}
+	}
+
+	if qr.enricher == nil || len(veths) == 0 {
+		return ifaces
+	}
+	routes, err := routeList(nil, netlink.FAMILY_V4)
+	if err != nil {
+		qr.l.Warn("Failed to list routes, pods of veths are unknown", zap.Error(err))
+		return ifaces
+	}
+	for i := range routes {
+		iface, ok := ifaces[routes[i].LinkIndex]
+		if !ok || iface.podName != "" || routes[i].Dst == nil {
+			continue
+		}
+		if ones, bits := routes[i].Dst.Mask.Size(); ones != bits {
+			continue
+		}
+		if ep := qr.enricher.EndpointByIP(routes[i].Dst.IP.String()); ep != nil {
+			iface.namespace = ep.GetNamespace()
+			iface.podName = ep.GetPodName()
+			ifaces[iface.index] = iface
+		}
+	}
+	return ifaces
+}
+
+func (qr *QdiscReader) readQdiscStats(ifaces map[int]tcInterface) error {
+	objs, err := getQdisc(qr.tcnl).Get()
+	if err != nil {
+		qr.l.Error("Error while dumping qdiscs", zap.Error(err))
+		return errors.Wrap(err, "failed to dump qdiscs")
+	}
+
+	qr.qdiscStats = qr.qdiscStats[:0]
+	for i := range objs {
+		iface, ok := ifaces[int(objs[i].Ifindex)]
+		if !ok {
+			continue
+		}
+		if stats, ok := newQdiscStats(iface, &objs[i], qdiscHandle(objs[i].Handle)); ok {
+			qr.qdiscStats = append(qr.qdiscStats, stats)
+		}
+	}
+	return nil
+}
+
+// readClassStats reads the classes of each interface, as the kernel only dumps the classes of a given interface.
+func (qr *QdiscReader) readClassStats(ifaces map[int]tcInterface) {
+	qr.classStats = qr.classStats[:0]
+	for _, iface := range ifaces {
+		objs, err := getClass(qr.tcnl).Get(&tc.Msg{
+			Family:  unix.AF_UNSPEC,
+			Ifindex: uint32(iface.index), //nolint:gosec // interface indexes are positive
+		})
+		if err != nil {
+			// the interface may have been deleted since it was listed
+			qr.l.Debug("Error while dumping classes", zap.String("interface", iface.name), zap.Error(err))
+			continue
+		}
+		for i := range objs {
+			if stats, ok := newQdiscStats(iface, &objs[i], classHandle(objs[i].Handle)); ok {
+				qr.classStats = append(qr.classStats, stats)
+			}
+		}
+	}
+}
+
+func (qr *QdiscReader) updateMetrics() {
+	qr.exportedQdiscs = export(metrics.QdiscStatsGauge, qr.qdiscStats, qr.exportedQdiscs)
+	qr.exportedClasses = export(metrics.QdiscClassStatsGauge, qr.classStats, qr.exportedClasses)
+}
+
+// export sets the statistics in the gauge, and deletes the label sets of the previous export which are gone.
+func export(gauge metrics.GaugeVec, stats []QdiscStats, previous map[qdiscKey]struct{}) map[qdiscKey]struct{} {
+	exported := make(map[qdiscKey]struct{}, len(stats))
+	for i := range stats {
+		s := &stats[i]
+		k := qdiscKey{iface: s.Interface, namespace: s.Namespace, podName: s.PodName, kind: s.Kind, handle: s.Handle}
+		exported[k] = struct{}{}
+		for stat, v := range map[string]uint64{
+			statBytes:      s.Bytes,
+			statPackets:    s.Packets,
+			statDrops:      s.Drops,
+			statOverlimits: s.Overlimits,
+			statRequeues:   s.Requeues,
+			statBacklog:    s.Backlog,
+		} {
+			gauge.WithLabelValues(k.iface, k.namespace, k.podName, k.kind, k.handle, stat).Set(float64(v))
+		}
+	}
+
+	for k := range previous {
+		if _, ok := exported[k]; ok {
+			continue
+		}
+		for _, stat := range []string{statBytes, statPackets, statDrops, statOverlimits, statRequeues, statBacklog} {
+			gauge.DeleteLabelValues(k.iface, k.namespace, k.podName, k.kind, k.handle, stat)
+		}
+	}
+	return exported
+}
+
+// newQdiscStats returns the statistics of a qdisc or class, preferring the statistics of TCA_STATS2 which include
+// requeues. It returns false for the kinds which do not queue packets and the objects without statistics.
+func newQdiscStats(iface tcInterface, obj *tc.Object, handle string) (QdiscStats, bool) {
+	if _, ok := skippedKinds[obj.Kind]; ok {
+		return QdiscStats{}, false
+	}
+
+	stats := QdiscStats{
+		Interface: iface.name,
+		Namespace: iface.namespace,
+		PodName:   iface.podName,
+		Kind:      obj.Kind,
+		Handle:    handle,
+	}
+	switch {
+	case obj.Stats2 != nil:
+		stats.Bytes = obj.Stats2.Bytes
+		stats.Packets = uint64(obj.Stats2.Packets)
+		stats.Drops = uint64(obj.Stats2.Drops)
+		stats.Overlimits = uint64(obj.Stats2.Overlimits)
+		stats.Requeues = uint64(obj.Stats2.Requeues)
+		stats.Backlog = uint64(obj.Stats2.Backlog)
+	case obj.Stats != nil:
+		stats.Bytes = obj.Stats.Bytes
+		stats.Packets = uint64(obj.Stats.Packets)
+		stats.Drops = uint64(obj.Stats.Drops)
+		stats.Overlimits = uint64(obj.Stats.Overlimits)
+		stats.Backlog = uint64(obj.Stats.Backlog)
+	default:
+		return QdiscStats{}, false
+	}
+	return stats, true
+}
+
+// qdiscHandle formats the handle of a qdisc as tc does, e.g. "8001:".
+func qdiscHandle(handle uint32) string {
+	return fmt.Sprintf("%x:", handle>>16)
+}
+
+// classHandle formats the handle of a class as tc does, e.g. "1:10".
+func classHandle(handle uint32) string {
+	return fmt.Sprintf("%x:%x", handle>>16, handle&0xffff)
+}
@@ -0,0 +1,174 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package qdisc
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	tc "github.com/florianl/go-tc"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+	gomock "go.uber.org/mock/gomock"
+)
+
+var errDump = errors.New("dump failed")
+
+type fakeQdisc struct {
+	objs []tc.Object
+	err  error
+}
+
+func (f *fakeQdisc) Get() ([]tc.Object, error) {
+	return f.objs, f.err
+}
+
+type fakeClass struct {
+	objs map[uint32][]tc.Object
+}
+
+func (f *fakeClass) Get(i *tc.Msg) ([]tc.Object, error) {
+	objs, ok := f.objs[i.Ifindex]
+	if !ok {
+		return nil, errDump
+	}
+	return objs, nil
+}
+
+func tcObject(ifindex, handle uint32, kind string, stats *tc.Stats, stats2 *tc.Stats2) tc.Object {
+	return tc.Object{
+		Msg:       tc.Msg{Ifindex: ifindex, Handle: handle},
+		Attribute: tc.Attribute{Kind: kind, Stats: stats, Stats2: stats2},
+	}
+}
+
+func setupFakes(t *testing.T, q *fakeQdisc, c *fakeClass) {
+	t.Helper()
+	oldQdisc, oldClass, oldRouteList := getQdisc, getClass, routeList
+	t.Cleanup(func() {
+		getQdisc, getClass, routeList = oldQdisc, oldClass, oldRouteList
+	})
+	getQdisc = func(nltc) qdisc { return q }
+	getClass = func(nltc) class { return c }
+	routeList = func(netlink.Link, int) ([]netlink.Route, error) {
+		return []netlink.Route{
+			{LinkIndex: 10, Dst: &net.IPNet{IP: net.IPv4(10, 0, 0, 5), Mask: net.CIDRMask(32, 32)}},
+			// only the host routes to pod IPs identify pods
+			{LinkIndex: 11, Dst: &net.IPNet{IP: net.IPv4(10, 0, 1, 0), Mask: net.CIDRMask(24, 32)}},
+		}, nil
+	}
+}
+
+var (
+	hostLinks = []netlink.LinkAttrs{{Index: 2, Name: "eth0"}}
+	veths     = []netlink.LinkAttrs{{Index: 10, Name: "azv1"}, {Index: 11, Name: "azv2"}}
+)
+
+func TestReadQdiscStats(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	setupFakes(t, &fakeQdisc{objs: []tc.Object{
+		tcObject(2, 0x80010000, "fq_codel", nil, &tc.Stats2{Bytes: 1000, Packets: 10, Drops: 2, Requeues: 1, Overlimits: 3, Backlog: 64}),
+		tcObject(2, 0xffff0000, "clsact", nil, &tc.Stats2{}),
+		tcObject(10, 0x10000, "tbf", &tc.Stats{Bytes: 500, Packets: 5, Drops: 4, Overlimits: 6, Backlog: 32}, nil),
+		tcObject(11, 0, "noqueue", nil, &tc.Stats2{}),
+		// interfaces which are neither host links nor pod veths are not read
+		tcObject(1, 0, "fq_codel", nil, &tc.Stats2{Bytes: 1}),
+	}}, &fakeClass{objs: map[uint32][]tc.Object{
+		2: {tcObject(2, 0x10010, "htb", nil, &tc.Stats2{Bytes: 300, Packets: 3, Drops: 1})},
+		// no statistics
+		10: {tcObject(10, 0x10001, "htb", nil, nil)},
+	}})
+
+	e := enricher.NewMockEnricherInterface(ctrl)
+	e.EXPECT().EndpointByIP("10.0.0.5").Return(&flow.Endpoint{Namespace: "ns1", PodName: "pod1"}).Times(1)
+
+	qr := NewQdiscReader(nil, e)
+	ifaces := qr.interfaces(hostLinks, veths)
+	require.NoError(t, qr.readQdiscStats(ifaces))
+	qr.readClassStats(ifaces)
+
+	assert.ElementsMatch(t, []QdiscStats{
+		{Interface: "eth0", Kind: "fq_codel", Handle: "8001:", Bytes: 1000, Packets: 10, Drops: 2, Overlimits: 3, Requeues: 1, Backlog: 64},
+		{Interface: "azv1", Namespace: "ns1", PodName: "pod1", Kind: "tbf", Handle: "1:", Bytes: 500, Packets: 5, Drops: 4, Overlimits: 6, Backlog: 32},
+	}, qr.qdiscStats)
+	assert.Equal(t, []QdiscStats{
+		{Interface: "eth0", Kind: "htb", Handle: "1:10", Bytes: 300, Packets: 3, Drops: 1},
+	}, qr.classStats)
+}
+
+func TestReadQdiscStatsWithoutEnricher(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+
+	setupFakes(t, &fakeQdisc{objs: []tc.Object{
+		tcObject(10, 0x10000, "tbf", nil, &tc.Stats2{Bytes: 500}),
+	}}, &fakeClass{})
+	routeList = func(netlink.Link, int) ([]netlink.Route, error) {
+		t.Fatal("routes must not be listed without an enricher")
+		return nil, nil
+	}
+
+	qr := NewQdiscReader(nil, nil)
+	require.NoError(t, qr.readQdiscStats(qr.interfaces(nil, veths)))
+	assert.Equal(t, []QdiscStats{{Interface: "azv1", Kind: "tbf", Handle: "1:", Bytes: 500}}, qr.qdiscStats)
+}
+
+func TestReadQdiscStatsError(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+
+	setupFakes(t, &fakeQdisc{err: errDump}, &fakeClass{})
+
+	qr := NewQdiscReader(nil, nil)
+	require.ErrorIs(t, qr.readAndUpdate(hostLinks, nil), errDump)
+}
+
+func TestQdiscUpdateMetrics(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	qdiscGauge := metrics.NewMockGaugeVec(ctrl)
+	classGauge := metrics.NewMockGaugeVec(ctrl)
+	oldQdiscGauge, oldClassGauge := metrics.QdiscStatsGauge, metrics.QdiscClassStatsGauge
+	metrics.QdiscStatsGauge, metrics.QdiscClassStatsGauge = qdiscGauge, classGauge
+	defer func() {
+		metrics.QdiscStatsGauge, metrics.QdiscClassStatsGauge = oldQdiscGauge, oldClassGauge
+	}()
+
+	testmetric := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "testmetric",
+		Help: "testmetric",
+	})
+	stats := []string{statBytes, statPackets, statDrops, statOverlimits, statRequeues, statBacklog}
+
+	qr := NewQdiscReader(nil, nil)
+	qr.qdiscStats = []QdiscStats{
+		{Interface: "eth0", Kind: "fq_codel", Handle: "8001:"},
+		{Interface: "azv1", Namespace: "ns1", PodName: "pod1", Kind: "tbf", Handle: "1:"},
+	}
+	for _, stat := range stats {
+		qdiscGauge.EXPECT().WithLabelValues("eth0", "", "", "fq_codel", "8001:", stat).Return(testmetric).Times(2)
+		qdiscGauge.EXPECT().WithLabelValues("azv1", "ns1", "pod1", "tbf", "1:", stat).Return(testmetric).Times(1)
+	}
+	qr.updateMetrics()
+
+	// the series of the qdisc of the deleted veth are deleted
+	qr.qdiscStats = qr.qdiscStats[:1]
+	for _, stat := range stats {
+		qdiscGauge.EXPECT().DeleteLabelValues("azv1", "ns1", "pod1", "tbf", "1:", stat).Return(true).Times(1)
+	}
+	qr.updateMetrics()
+}
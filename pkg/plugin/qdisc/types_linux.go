@@ -0,0 +1,97 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package qdisc
+
+import (
+	"sync"
+
+	tc "github.com/florianl/go-tc"
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/vishvananda/netlink"
+)
+
+const name = "qdisc"
+
+const (
+	// Statistic names of the qdisc_stats and qdisc_class_stats metrics
+	statBytes      = "bytes"
+	statPackets    = "packets"
+	statDrops      = "drops"
+	statOverlimits = "overlimits"
+	statRequeues   = "requeues"
+	statBacklog    = "backlog"
+)
+
+var (
+	getQdisc = func(tcnl nltc) qdisc {
+		return tcnl.Qdisc()
+	}
+	getClass = func(tcnl nltc) class {
+		return tcnl.Class()
+	}
+	tcOpen = func(config *tc.Config) (nltc, error) {
+		return tc.Open(config)
+	}
+	routeList = netlink.RouteList
+
+	// kinds of qdiscs which do not queue packets, and so have no statistics of interest
+	skippedKinds = map[string]struct{}{
+		"clsact":  {},
+		"ingress": {},
+		"noqueue": {},
+	}
+)
+
+type qdiscPlugin struct {
+	cfg        *kcfg.Config
+	l          *log.ZapLogger
+	isRunning  bool
+	startLock  sync.Mutex
+	callbackID string
+	tcnl       nltc
+	reader     *QdiscReader
+	// veths are the pod interfaces published by the endpoint watcher, by interface index
+	veths sync.Map
+}
+
+// QdiscStats are the statistics of a qdisc or class of an interface.
+type QdiscStats struct {
+	Interface string
+	Namespace string
+	PodName   string
+	Kind      string
+	Handle    string
+
+	Bytes      uint64
+	Packets    uint64
+	Drops      uint64
+	Overlimits uint64
+	Requeues   uint64
+	Backlog    uint64
+}
+
+// tcInterface is an interface whose qdiscs are read, with the pod it belongs to if any.
+type tcInterface struct {
+	index     int
+	name      string
+	namespace string
+	podName   string
+}
+
+// tc qdisc interface
+type qdisc interface {
+	Get() ([]tc.Object, error)
+}
+
+// tc class interface
+type class interface {
+	Get(i *tc.Msg) ([]tc.Object, error)
+}
+
+// netlink tc interface
+type nltc interface {
+	Qdisc() *tc.Qdisc
+	Class() *tc.Class
+	Close() error
+}
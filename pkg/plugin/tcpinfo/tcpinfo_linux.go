@@ -0,0 +1,104 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+// Package tcpinfo contains the Retina tcpinfo plugin. It reads the TCP_INFO of the established TCP sockets in the
+// network namespace of each pod through netlink inet_diag, and aggregates it by pod or by workload.
+package tcpinfo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	hubblev1 "github.com/cilium/cilium/pkg/hubble/api/v1"
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+	plugincommon "github.com/microsoft/retina/pkg/plugin/common"
+	"github.com/microsoft/retina/pkg/plugin/registry"
+	"go.uber.org/zap"
+)
+
+var ErrAlreadyRunning = errors.New("tcpinfo plugin is already running")
+
+func init() {
+	registry.Add(name, New)
+}
+
+// New creates a tcpinfo plugin.
+func New(cfg *kcfg.Config) registry.Plugin {
+	return &tcpinfo{
+		cfg: cfg,
+		l:   log.Logger().Named(name),
+	}
+}
+
+func (t *tcpinfo) Name() string {
+	return name
+}
+
+func (t *tcpinfo) Generate(context.Context) error {
+	return nil
+}
+
+func (t *tcpinfo) Compile(context.Context) error {
+	return nil
+}
+
+func (t *tcpinfo) Init() error {
+	return nil
+}
+
+func (t *tcpinfo) Start(ctx context.Context) error {
+	t.l.Info("Starting tcpinfo plugin")
+	t.startLock.Lock()
+	if t.isRunning {
+		t.startLock.Unlock()
+		return ErrAlreadyRunning
+	}
+	t.isRunning = true
+	t.startLock.Unlock()
+
+	// The pods of the network namespaces are resolved from their addresses, which requires pod level.
+	if !t.cfg.EnablePodLevel || !enricher.IsInitialized() {
+		t.l.Warn("tcpinfo plugin requires pod level, TCP socket stats will not be exported")
+		<-ctx.Done()
+		return nil
+	}
+	t.reader = NewTCPInfoReader(enricher.Instance(), t.cfg.TCPInfoAggregation, plugincommon.PathNetns)
+
+	return t.run(ctx)
+}
+
+func (t *tcpinfo) SetupChannel(chan *hubblev1.Event) error {
+	t.l.Warn("Plugin does not support SetupChannel", zap.String("plugin", name))
+	return nil
+}
+
+func (t *tcpinfo) run(ctx context.Context) error {
+	t.l.Info("Running tcpinfo plugin...")
+	ticker := time.NewTicker(t.cfg.MetricsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			t.l.Info("Context is done, tcpinfo will stop running")
+			return nil
+		case <-ticker.C:
+			err := t.reader.readAndUpdate()
+			if err != nil {
+				t.l.Error("Reading TCP socket stats failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (t *tcpinfo) Stop() error {
+	if !t.isRunning {
+		return nil
+	}
+	t.l.Info("Stopping tcpinfo plugin...")
+	t.isRunning = false
+	return nil
+}
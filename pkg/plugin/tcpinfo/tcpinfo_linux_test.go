@@ -0,0 +1,41 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package tcpinfo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestStartStop(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+
+	tp := New(&kcfg.Config{MetricsInterval: 100 * time.Second}).(*tcpinfo)
+	ctx, cancel := context.WithCancel(context.Background())
+	g, errctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		return tp.Start(errctx)
+	})
+	require.Eventually(t, func() bool {
+		tp.startLock.Lock()
+		defer tp.startLock.Unlock()
+		return tp.isRunning
+	}, time.Second, 10*time.Millisecond)
+	require.ErrorIs(t, tp.Start(ctx), ErrAlreadyRunning)
+	cancel()
+	require.NoError(t, g.Wait())
+	// the pods of the network namespaces are not resolved without pod level
+	assert.Nil(t, tp.reader)
+
+	require.NoError(t, tp.Stop())
+	assert.False(t, tp.isRunning)
+}
@@ -0,0 +1,216 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package tcpinfo
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/metrics"
+	plugincommon "github.com/microsoft/retina/pkg/plugin/common"
+	"github.com/microsoft/retina/pkg/utils"
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+type podKey struct {
+	namespace    string
+	workloadKind string
+	workloadName string
+	podName      string
+}
+
+func (k podKey) labels() []string {
+	return []string{k.namespace, k.workloadKind, k.workloadName, k.podName}
+}
+
+type TCPInfoReader struct {
+	l           *log.ZapLogger
+	enricher    enricher.EnricherInterface
+	aggregation kcfg.TCPInfoAggregation
+	netnsDir    string
+	podSockets  []PodSockets
+
+	// the pods exported by the last update, to delete the ones which are gone
+	exportedPods map[podKey]struct{}
+}
+
+// NewTCPInfoReader creates a reader of the TCP sockets of the pods whose network namespaces are bind mounted in
+// netnsDir. The enricher resolves the pods of the network namespaces from their addresses.
+func NewTCPInfoReader(e enricher.EnricherInterface, aggregation kcfg.TCPInfoAggregation, netnsDir string) *TCPInfoReader {
+	return &TCPInfoReader{
+		l:            log.Logger().Named(string("TCPInfoReader")),
+		enricher:     e,
+		aggregation:  aggregation,
+		netnsDir:     netnsDir,
+		exportedPods: make(map[podKey]struct{}),
+	}
+}
+
+func (tr *TCPInfoReader) readAndUpdate() error {
+	if err := tr.readPodSockets(); err != nil {
+		return err
+	}
+
+	tr.updateMetrics()
+	tr.l.Debug("Done reading and updating TCP socket stats")
+
+	return nil
+}
+
+// readPodSockets reads the established TCP sockets of each network namespace which belongs to a pod.
+func (tr *TCPInfoReader) readPodSockets() error {
+	entries, err := os.ReadDir(tr.netnsDir)
+	if err != nil {
+		return errors.Wrapf(err, "failed to list network namespaces in %s", tr.netnsDir)
+	}
+
+	byPod := make(map[podKey]int)
+	tr.podSockets = tr.podSockets[:0]
+	for _, entry := range entries {
+		path := filepath.Join(tr.netnsDir, entry.Name())
+		// A pod may have been deleted since the listing, its namespace is skipped.
+		if err := tr.readNetns(path, byPod); err != nil {
+			tr.l.Debug("Error while reading TCP sockets of network namespace", zap.String("netns", path), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+func (tr *TCPInfoReader) readNetns(path string, byPod map[podKey]int) error {
+	h, err := openNetns(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to open network namespace")
+	}
+	defer h.Close()
+
+	ep, err := plugincommon.NetnsEndpoint(tr.enricher, h)
+	if err != nil {
+		return err
+	}
+	if ep == nil {
+		// not the network namespace of a pod known to the cache
+		return nil
+	}
+
+	var sockets []SocketInfo
+	for _, family := range []uint8{unix.AF_INET, unix.AF_INET6} {
+		resps, err := h.SocketDiagTCPInfo(family)
+		// An interrupted dump is inconsistent but still useful for statistics.
+		if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+			return errors.Wrap(err, "failed to dump TCP sockets")
+		}
+		for _, resp := range resps {
+			if info, ok := socketInfo(resp); ok {
+				sockets = append(sockets, info)
+			}
+		}
+	}
+
+	k := tr.key(ep)
+	i, ok := byPod[k]
+	if !ok {
+		i = len(tr.podSockets)
+		byPod[k] = i
+		tr.podSockets = append(tr.podSockets, PodSockets{
+			Namespace:    k.namespace,
+			WorkloadKind: k.workloadKind,
+			WorkloadName: k.workloadName,
+			PodName:      k.podName,
+		})
+	}
+	tr.podSockets[i].Sockets = append(tr.podSockets[i].Sockets, sockets...)
+	return nil
+}
+
+func (tr *TCPInfoReader) key(ep *flow.Endpoint) podKey {
+	k := podKey{namespace: ep.GetNamespace(), podName: ep.GetPodName()}
+	if len(ep.GetWorkloads()) > 0 {
+		k.workloadKind, k.workloadName = utils.TopLevelWorkload(ep)
+		// A pod without workload is aggregated by itself.
+		if tr.aggregation == kcfg.TCPInfoAggregationWorkload {
+			k.podName = ""
+		}
+	}
+	return k
+}
+
+// socketInfo returns the TCP_INFO of an established socket, the other states have no meaningful round trip time or
+// queues.
+func socketInfo(resp *netlink.InetDiagTCPInfoResp) (SocketInfo, bool) {
+	if resp == nil || resp.InetDiagMsg == nil || resp.TCPInfo == nil || resp.InetDiagMsg.State != tcpEstablished {
+		return SocketInfo{}, false
+	}
+	info := resp.TCPInfo
+	return SocketInfo{
+		RTT:          time.Duration(info.Rtt) * time.Microsecond,
+		RTTVar:       time.Duration(info.Rttvar) * time.Microsecond,
+		Cwnd:         info.Snd_cwnd,
+		DeliveryRate: info.Delivery_rate,
+		Retrans:      info.Retrans,
+		Lost:         info.Lost,
+		Unacked:      info.Unacked,
+		SendQueue:    resp.InetDiagMsg.WQueue,
+		RecvQueue:    resp.InetDiagMsg.RQueue,
+	}, true
+}
+
+// updateMetrics observes each socket once in the histograms, so that they are sampled every interval, and sets the
+// gauges to the sums over the sockets.
+func (tr *TCPInfoReader) updateMetrics() {
+	exported := make(map[podKey]struct{}, len(tr.podSockets))
+	for _, pod := range tr.podSockets {
+		k := podKey{namespace: pod.Namespace, workloadKind: pod.WorkloadKind, workloadName: pod.WorkloadName, podName: pod.PodName}
+		exported[k] = struct{}{}
+		labels := k.labels()
+
+		rtt := metrics.TCPSocketRTTHistogram.WithLabelValues(labels...)
+		rttVar := metrics.TCPSocketRTTVarHistogram.WithLabelValues(labels...)
+		cwnd := metrics.TCPSocketCwndHistogram.WithLabelValues(labels...)
+		deliveryRate := metrics.TCPSocketDeliveryRateHistogram.WithLabelValues(labels...)
+
+		var retrans, lost, unacked, sendQueue, recvQueue uint64
+		for _, s := range pod.Sockets {
+			rtt.Observe(s.RTT.Seconds())
+			rttVar.Observe(s.RTTVar.Seconds())
+			cwnd.Observe(float64(s.Cwnd))
+			if s.DeliveryRate > 0 {
+				deliveryRate.Observe(float64(s.DeliveryRate))
+			}
+			retrans += uint64(s.Retrans)
+			lost += uint64(s.Lost)
+			unacked += uint64(s.Unacked)
+			sendQueue += uint64(s.SendQueue)
+			recvQueue += uint64(s.RecvQueue)
+		}
+
+		metrics.TCPSocketStatsGauge.WithLabelValues(append(labels, statSockets)...).Set(float64(len(pod.Sockets)))
+		metrics.TCPSocketStatsGauge.WithLabelValues(append(labels, statRetrans)...).Set(float64(retrans))
+		metrics.TCPSocketStatsGauge.WithLabelValues(append(labels, statLost)...).Set(float64(lost))
+		metrics.TCPSocketStatsGauge.WithLabelValues(append(labels, statUnacked)...).Set(float64(unacked))
+		metrics.TCPSocketStatsGauge.WithLabelValues(append(labels, statSendQueueBytes)...).Set(float64(sendQueue))
+		metrics.TCPSocketStatsGauge.WithLabelValues(append(labels, statRecvQueueBytes)...).Set(float64(recvQueue))
+	}
+
+	for k := range tr.exportedPods {
+		if _, ok := exported[k]; ok {
+			continue
+		}
+		labels := k.labels()
+		metrics.TCPSocketRTTHistogram.DeleteLabelValues(labels...)
+		metrics.TCPSocketRTTVarHistogram.DeleteLabelValues(labels...)
+		metrics.TCPSocketCwndHistogram.DeleteLabelValues(labels...)
+		metrics.TCPSocketDeliveryRateHistogram.DeleteLabelValues(labels...)
+		for _, stat := range []string{statSockets, statRetrans, statLost, statUnacked, statSendQueueBytes, statRecvQueueBytes} {
+			metrics.TCPSocketStatsGauge.DeleteLabelValues(append(labels, stat)...)
+		}
+	}
+	tr.exportedPods = exported
+}
@@ -0,0 +1,311 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package tcpinfo
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	gomock "go.uber.org/mock/gomock"
+	"golang.org/x/sys/unix"
+)
+
+var errNetlink = errors.New("netlink error")
+
+type fakeSockDiag struct {
+	addrs   []netlink.Addr
+	sockets map[uint8][]*netlink.InetDiagTCPInfoResp
+	err     error
+	closed  bool
+}
+
+func (f *fakeSockDiag) AddrList(netlink.Link, int) ([]netlink.Addr, error) {
+	return f.addrs, nil
+}
+
+func (f *fakeSockDiag) SocketDiagTCPInfo(family uint8) ([]*netlink.InetDiagTCPInfoResp, error) {
+	return f.sockets[family], f.err
+}
+
+func (f *fakeSockDiag) Close() error {
+	f.closed = true
+	return nil
+}
+
+func anys(lvs []string) []any {
+	a := make([]any, len(lvs))
+	for i, lv := range lvs {
+		a[i] = lv
+	}
+	return a
+}
+
+func addr(ip string) netlink.Addr {
+	return netlink.Addr{IPNet: &net.IPNet{IP: net.ParseIP(ip)}}
+}
+
+func socket(state uint8, rttUs, cwnd uint32, rqueue, wqueue uint32) *netlink.InetDiagTCPInfoResp {
+	return &netlink.InetDiagTCPInfoResp{
+		InetDiagMsg: &netlink.Socket{State: state, RQueue: rqueue, WQueue: wqueue},
+		TCPInfo:     &netlink.TCPInfo{Rtt: rttUs, Rttvar: rttUs / 2, Snd_cwnd: cwnd, Retrans: 1, Lost: 2, Unacked: 3, Delivery_rate: 1000},
+	}
+}
+
+// setupNetnsDir creates a directory with an entry per fake network namespace, and returns it.
+func setupNetnsDir(t *testing.T, handles map[string]*fakeSockDiag) string {
+	t.Helper()
+	dir := t.TempDir()
+	for ns := range handles {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, ns), nil, 0o600))
+	}
+	oldOpenNetns := openNetns
+	t.Cleanup(func() { openNetns = oldOpenNetns })
+	openNetns = func(path string) (sockDiag, error) {
+		h, ok := handles[filepath.Base(path)]
+		if !ok {
+			return nil, errNetlink
+		}
+		return h, nil
+	}
+	return dir
+}
+
+func TestReadPodSockets(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	handles := map[string]*fakeSockDiag{
+		"cni-1": {
+			addrs: []netlink.Addr{addr("127.0.0.1"), addr("fe80::1"), addr("10.0.0.5")},
+			sockets: map[uint8][]*netlink.InetDiagTCPInfoResp{
+				unix.AF_INET: {
+					socket(tcpEstablished, 1500, 10, 5, 6),
+					// listening
+					socket(10, 0, 10, 0, 128),
+					{InetDiagMsg: &netlink.Socket{State: tcpEstablished}},
+				},
+				unix.AF_INET6: {socket(tcpEstablished, 2000, 20, 0, 0)},
+			},
+		},
+		// pod2 and pod3 are replicas of the same deployment
+		"cni-2": {
+			addrs:   []netlink.Addr{addr("10.0.0.6")},
+			sockets: map[uint8][]*netlink.InetDiagTCPInfoResp{unix.AF_INET: {socket(tcpEstablished, 100, 10, 0, 0)}},
+		},
+		"cni-3": {
+			addrs:   []netlink.Addr{addr("10.0.0.7")},
+			sockets: map[uint8][]*netlink.InetDiagTCPInfoResp{unix.AF_INET: {socket(tcpEstablished, 100, 10, 0, 0)}},
+		},
+		// not a pod
+		"cni-4": {addrs: []netlink.Addr{addr("10.0.0.8")}},
+		"cni-5": {addrs: []netlink.Addr{addr("10.0.0.9")}, err: errNetlink},
+	}
+	dir := setupNetnsDir(t, handles)
+	// deleted since the listing
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cni-6"), nil, 0o600))
+
+	workloads := []*flow.Workload{{Kind: "ReplicaSet", Name: "app-5d8f7"}}
+	labels := []string{"pod-template-hash=5d8f7"}
+	e := enricher.NewMockEnricherInterface(ctrl)
+	e.EXPECT().EndpointByIP("10.0.0.5").Return(&flow.Endpoint{Namespace: "ns1", PodName: "pod1"}).Times(2)
+	e.EXPECT().EndpointByIP("10.0.0.6").Return(&flow.Endpoint{Namespace: "ns2", PodName: "pod2", Workloads: workloads, Labels: labels}).Times(2)
+	e.EXPECT().EndpointByIP("10.0.0.7").Return(&flow.Endpoint{Namespace: "ns2", PodName: "pod3", Workloads: workloads, Labels: labels}).Times(2)
+	e.EXPECT().EndpointByIP("10.0.0.8").Return(nil).Times(2)
+	e.EXPECT().EndpointByIP("10.0.0.9").Return(&flow.Endpoint{Namespace: "ns3", PodName: "pod4"}).Times(2)
+
+	tr := NewTCPInfoReader(e, kcfg.TCPInfoAggregationPod, dir)
+	require.NoError(t, tr.readPodSockets())
+	assert.ElementsMatch(t, []PodSockets{
+		{Namespace: "ns1", PodName: "pod1", Sockets: []SocketInfo{
+			{RTT: 1500 * time.Microsecond, RTTVar: 750 * time.Microsecond, Cwnd: 10, DeliveryRate: 1000, Retrans: 1, Lost: 2, Unacked: 3, SendQueue: 6, RecvQueue: 5},
+			{RTT: 2 * time.Millisecond, RTTVar: time.Millisecond, Cwnd: 20, DeliveryRate: 1000, Retrans: 1, Lost: 2, Unacked: 3},
+		}},
+		{Namespace: "ns2", WorkloadKind: "Deployment", WorkloadName: "app", PodName: "pod2", Sockets: []SocketInfo{
+			{RTT: 100 * time.Microsecond, RTTVar: 50 * time.Microsecond, Cwnd: 10, DeliveryRate: 1000, Retrans: 1, Lost: 2, Unacked: 3},
+		}},
+		{Namespace: "ns2", WorkloadKind: "Deployment", WorkloadName: "app", PodName: "pod3", Sockets: []SocketInfo{
+			{RTT: 100 * time.Microsecond, RTTVar: 50 * time.Microsecond, Cwnd: 10, DeliveryRate: 1000, Retrans: 1, Lost: 2, Unacked: 3},
+		}},
+	}, tr.podSockets)
+	for _, h := range handles {
+		assert.True(t, h.closed)
+	}
+
+	// the replicas are aggregated by workload
+	tr = NewTCPInfoReader(e, kcfg.TCPInfoAggregationWorkload, dir)
+	require.NoError(t, tr.readPodSockets())
+	require.Len(t, tr.podSockets, 2)
+	for _, pod := range tr.podSockets {
+		if pod.Namespace == "ns2" {
+			assert.Equal(t, "app", pod.WorkloadName)
+			assert.Empty(t, pod.PodName)
+			assert.Len(t, pod.Sockets, 2)
+		} else {
+			// a pod without workload is aggregated by itself
+			assert.Equal(t, "pod1", pod.PodName)
+		}
+	}
+
+	tr = NewTCPInfoReader(e, kcfg.TCPInfoAggregationPod, filepath.Join(dir, "nonexistent"))
+	require.Error(t, tr.readPodSockets())
+}
+
+func TestTCPInfoUpdateMetrics(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	rttHist := metrics.NewMockHistogramVec(ctrl)
+	rttVarHist := metrics.NewMockHistogramVec(ctrl)
+	cwndHist := metrics.NewMockHistogramVec(ctrl)
+	rateHist := metrics.NewMockHistogramVec(ctrl)
+	statsGauge := metrics.NewMockGaugeVec(ctrl)
+	oldRTT, oldRTTVar, oldCwnd, oldRate, oldStats := metrics.TCPSocketRTTHistogram, metrics.TCPSocketRTTVarHistogram, metrics.TCPSocketCwndHistogram, metrics.TCPSocketDeliveryRateHistogram, metrics.TCPSocketStatsGauge
+	metrics.TCPSocketRTTHistogram, metrics.TCPSocketRTTVarHistogram, metrics.TCPSocketCwndHistogram, metrics.TCPSocketDeliveryRateHistogram, metrics.TCPSocketStatsGauge = rttHist, rttVarHist, cwndHist, rateHist, statsGauge
+	defer func() {
+		metrics.TCPSocketRTTHistogram, metrics.TCPSocketRTTVarHistogram, metrics.TCPSocketCwndHistogram, metrics.TCPSocketDeliveryRateHistogram, metrics.TCPSocketStatsGauge = oldRTT, oldRTTVar, oldCwnd, oldRate, oldStats
+	}()
+
+	testhist := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "testhist",
+		Help:    "testhist",
+		Buckets: prometheus.DefBuckets,
+	})
+	testmetric := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "testmetric",
+		Help: "testmetric",
+	})
+	pod1 := []string{"ns1", "", "", "pod1"}
+	pod2 := []string{"ns2", "Deployment", "app", "pod2"}
+	for _, hist := range []*metrics.MockHistogramVec{rttHist, rttVarHist, cwndHist, rateHist} {
+		hist.EXPECT().WithLabelValues(anys(pod1)...).Return(testhist).Times(2)
+		hist.EXPECT().WithLabelValues(anys(pod2)...).Return(testhist).Times(1)
+	}
+	stats := []string{statSockets, statRetrans, statLost, statUnacked, statSendQueueBytes, statRecvQueueBytes}
+	for _, stat := range stats {
+		statsGauge.EXPECT().WithLabelValues(anys(append(pod1, stat))...).Return(testmetric).Times(2)
+		statsGauge.EXPECT().WithLabelValues(anys(append(pod2, stat))...).Return(testmetric).Times(1)
+	}
+
+	tr := NewTCPInfoReader(nil, kcfg.TCPInfoAggregationPod, "")
+	tr.podSockets = []PodSockets{
+		{Namespace: "ns1", PodName: "pod1", Sockets: []SocketInfo{{RTT: time.Millisecond}, {RTT: 2 * time.Millisecond, DeliveryRate: 1000}}},
+		{Namespace: "ns2", WorkloadKind: "Deployment", WorkloadName: "app", PodName: "pod2"},
+	}
+	tr.updateMetrics()
+
+	m := &dto.Metric{}
+	require.NoError(t, testhist.Write(m))
+	// the delivery rate is only observed once measured
+	assert.Equal(t, uint64(2+2+2+1), m.GetHistogram().GetSampleCount())
+
+	// pods which are gone are deleted
+	for _, hist := range []*metrics.MockHistogramVec{rttHist, rttVarHist, cwndHist, rateHist} {
+		hist.EXPECT().DeleteLabelValues(anys(pod2)...).Return(true).Times(1)
+	}
+	for _, stat := range stats {
+		statsGauge.EXPECT().DeleteLabelValues(anys(append(pod2, stat))...).Return(true).Times(1)
+	}
+	tr.podSockets = tr.podSockets[:1]
+	tr.updateMetrics()
+}
+
+// TestReadPodSocketsNetns reads the sockets of a connection in a network namespace, as the plugin does for the pods.
+func TestReadPodSocketsNetns(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("creating a network namespace requires root")
+	}
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cni-test")
+	conns := setupTestNetns(t, path, "10.10.10.10")
+	defer func() {
+		for _, c := range conns {
+			c.Close()
+		}
+	}()
+
+	e := enricher.NewMockEnricherInterface(ctrl)
+	e.EXPECT().EndpointByIP("10.10.10.10").Return(&flow.Endpoint{Namespace: "ns1", PodName: "pod1"})
+
+	tr := NewTCPInfoReader(e, kcfg.TCPInfoAggregationPod, dir)
+	require.NoError(t, tr.readPodSockets())
+	require.Len(t, tr.podSockets, 1)
+	assert.Equal(t, "pod1", tr.podSockets[0].PodName)
+	// both ends of the connection, the listener is not established
+	require.Len(t, tr.podSockets[0].Sockets, 2)
+	for _, s := range tr.podSockets[0].Sockets {
+		assert.Positive(t, s.Cwnd)
+	}
+}
+
+// setupTestNetns creates a network namespace bind mounted at path, with ip on its loopback, and a TCP connection in
+// it. It returns the listener and both ends of the connection.
+func setupTestNetns(t *testing.T, path, ip string) []net.Conn {
+	t.Helper()
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origin, err := netns.Get()
+	require.NoError(t, err)
+	defer origin.Close()
+	ns, err := netns.New()
+	if err != nil {
+		t.Skipf("failed to create network namespace: %v", err)
+	}
+	defer func() {
+		require.NoError(t, netns.Set(origin))
+		ns.Close()
+	}()
+
+	require.NoError(t, os.WriteFile(path, nil, 0o600))
+	require.NoError(t, unix.Mount("/proc/thread-self/ns/net", path, "", unix.MS_BIND, ""))
+	t.Cleanup(func() { _ = unix.Unmount(path, unix.MNT_DETACH) })
+
+	lo, err := netlink.LinkByName("lo")
+	require.NoError(t, err)
+	require.NoError(t, netlink.LinkSetUp(lo))
+	require.NoError(t, netlink.AddrAdd(lo, &netlink.Addr{IPNet: &net.IPNet{IP: net.ParseIP(ip), Mask: net.CIDRMask(32, 32)}}))
+
+	l, err := net.Listen("tcp4", net.JoinHostPort(ip, "0"))
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			accepted <- c
+		}
+		close(accepted)
+	}()
+	client, err := net.Dial("tcp4", l.Addr().String())
+	require.NoError(t, err)
+	server, ok := <-accepted
+	require.True(t, ok)
+	_, err = client.Write([]byte("ping"))
+	require.NoError(t, err)
+	return []net.Conn{client, server}
+}
@@ -0,0 +1,79 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package tcpinfo
+
+import (
+	"sync"
+	"time"
+
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/log"
+	plugincommon "github.com/microsoft/retina/pkg/plugin/common"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+const name = "tcpinfo"
+
+// tcpEstablished is the TCP_ESTABLISHED state of the sockets, see include/net/tcp_states.h
+const tcpEstablished = 1
+
+const (
+	// Statistic names of the tcp_socket_stats metric
+	statSockets        = "sockets"
+	statRetrans        = "retrans"
+	statLost           = "lost"
+	statUnacked        = "unacked"
+	statSendQueueBytes = "send_queue_bytes"
+	statRecvQueueBytes = "recv_queue_bytes"
+)
+
+// openNetns opens netlink sockets in the network namespace bind mounted at path.
+var openNetns = func(path string) (sockDiag, error) {
+	return plugincommon.OpenNetns(path, unix.NETLINK_ROUTE, unix.NETLINK_INET_DIAG)
+}
+
+type tcpinfo struct {
+	cfg       *kcfg.Config
+	l         *log.ZapLogger
+	isRunning bool
+	startLock sync.Mutex
+	reader    *TCPInfoReader
+}
+
+// SocketInfo is the TCP_INFO of an established socket.
+type SocketInfo struct {
+	RTT    time.Duration
+	RTTVar time.Duration
+	// Cwnd is the congestion window in segments
+	Cwnd uint32
+	// DeliveryRate is the most recent delivery rate in bytes per second, 0 until it is measured
+	DeliveryRate uint64
+	// Retrans is the number of segments retransmitted and not yet acknowledged
+	Retrans uint32
+	// Lost is the number of segments considered lost
+	Lost uint32
+	// Unacked is the number of segments sent and not yet acknowledged
+	Unacked uint32
+	// SendQueue is the number of bytes not yet acknowledged by the peer
+	SendQueue uint32
+	// RecvQueue is the number of bytes not yet read by the application
+	RecvQueue uint32
+}
+
+// PodSockets are the established TCP sockets of a pod, or of all the pods of a workload with the workload aggregation.
+type PodSockets struct {
+	Namespace    string
+	WorkloadKind string
+	WorkloadName string
+	// PodName is empty with the workload aggregation
+	PodName string
+	Sockets []SocketInfo
+}
+
+// sockDiag is the netlink handle of a network namespace.
+type sockDiag interface {
+	plugincommon.AddrLister
+	SocketDiagTCPInfo(family uint8) ([]*netlink.InetDiagTCPInfoResp, error)
+	Close() error
+}
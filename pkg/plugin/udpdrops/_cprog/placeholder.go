@@ -0,0 +1,3 @@
+package cprog //nolint:all
+
+// This file is a placeholder to make Go include this directory when vendoring.
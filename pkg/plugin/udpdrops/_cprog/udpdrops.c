@@ -0,0 +1,109 @@
+//go:build ignore
+
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+// Kprobe and kretprobe on __udp_enqueue_schedule_skb(), which charges a datagram to the receive buffer of its socket,
+// and drops it if the buffer is full or the UDP memory is exhausted. The drops are counted by network namespace and
+// local port, and sent to the plugin with the headers of the datagram. The fields of the kernel structures are read
+// with CO-RE, so the program loads on the kernels whose layouts differ from vmlinux.h.
+
+#include "vmlinux.h"
+#include "bpf_helpers.h"
+#include "bpf_core_read.h"
+#include "bpf_tracing.h"
+#include "udpdrops.h"
+
+char __license[] SEC("license") = "Dual MIT/GPL";
+
+// Needed by bpf2go's -type flag to generate the Go structs.
+const struct drop_key *unused_drop_key __attribute__((unused));
+const struct drop_value *unused_drop_value __attribute__((unused));
+const struct event *unused_event __attribute__((unused));
+
+// The arguments of the function on each CPU, from the kprobe to the kretprobe. The datagrams are enqueued with the
+// bottom halves disabled, so a CPU does not enqueue another one in between.
+struct
+{
+    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+    __type(key, __u32);
+    __type(value, struct enqueue_args);
+    __uint(max_entries, 1);
+} retina_udp_args SEC(".maps");
+
+struct
+{
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __type(key, struct drop_key);
+    __type(value, struct drop_value);
+    __uint(max_entries, DROPS_MAX_ENTRIES);
+} retina_udp_drops SEC(".maps");
+
+struct
+{
+    __uint(type, BPF_MAP_TYPE_PERF_EVENT_ARRAY);
+    __uint(key_size, sizeof(__u32));
+    __uint(value_size, sizeof(__u32));
+} retina_udp_evts SEC(".maps");
+
+SEC("kprobe/__udp_enqueue_schedule_skb")
+int BPF_KPROBE(retina_udp_enqueue, struct sock *sk, struct sk_buff *skb)
+{
+    __u32 zero = 0;
+    struct enqueue_args *args = bpf_map_lookup_elem(&retina_udp_args, &zero);
+    if (args)
+    {
+        args->sk = (__u64)sk;
+        args->skb = (__u64)skb;
+    }
+    return 0;
+}
+
+SEC("kretprobe/__udp_enqueue_schedule_skb")
+int BPF_KRETPROBE(retina_udp_enqueue_ret, int ret)
+{
+    if (ret >= 0)
+        return 0;
+
+    __u32 zero = 0;
+    struct enqueue_args *args = bpf_map_lookup_elem(&retina_udp_args, &zero);
+    if (!args)
+        return 0;
+    struct sock *sk = (struct sock *)args->sk;
+    struct sk_buff *skb = (struct sk_buff *)args->skb;
+    // The arguments are cleared, so that a missed kprobe does not attribute the drop to the previous datagram.
+    args->sk = 0;
+    if (!sk)
+        return 0;
+
+    struct event ev;
+    // The padding is sent to the plugin too.
+    __builtin_memset(&ev, 0, sizeof(ev));
+    ev.timestamp = bpf_ktime_get_ns();
+    ev.netns = BPF_CORE_READ(sk, __sk_common.skc_net.net, ns.inum);
+    ev.port = BPF_CORE_READ(sk, __sk_common.skc_num);
+    ev.reason = ret == -ENOMEM ? REASON_RCVBUF : REASON_MEMORY;
+
+    unsigned char *head = BPF_CORE_READ(skb, head);
+    bpf_probe_read_kernel(ev.hdr, sizeof(ev.hdr), head + BPF_CORE_READ(skb, network_header));
+    bpf_probe_read_kernel(ev.th, sizeof(ev.th), head + BPF_CORE_READ(skb, transport_header));
+
+    struct drop_key key = {.netns = ev.netns, .port = ev.port};
+    struct drop_value *value = bpf_map_lookup_elem(&retina_udp_drops, &key);
+    if (!value)
+    {
+        struct drop_value init = {};
+        bpf_map_update_elem(&retina_udp_drops, &key, &init, BPF_NOEXIST);
+        value = bpf_map_lookup_elem(&retina_udp_drops, &key);
+    }
+    if (value)
+    {
+        if (ev.reason == REASON_RCVBUF)
+            __sync_fetch_and_add(&value->rcvbuf, 1);
+        else
+            __sync_fetch_and_add(&value->memory, 1);
+    }
+
+    bpf_perf_event_output(ctx, &retina_udp_evts, BPF_F_CURRENT_CPU, &ev, sizeof(ev));
+    return 0;
+}
@@ -0,0 +1,53 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+#include "vmlinux.h"
+
+// Length of the IP header copied in the events, the IPv6 header or the IPv4 header with options.
+#define HDR_LEN 40
+// Length of the UDP header copied in the events, the ports.
+#define TH_LEN 4
+
+// Number of local ports tracked, the entries of the network namespaces which are gone are deleted by the plugin.
+#define DROPS_MAX_ENTRIES 4096
+
+// Error returned by __udp_enqueue_schedule_skb() when the receive buffer is full, the others are the UDP memory
+// pressure (-ENOBUFS).
+#define ENOMEM 12
+
+#define REASON_RCVBUF 0
+#define REASON_MEMORY 1
+
+// Arguments of __udp_enqueue_schedule_skb(), saved by the kprobe for the kretprobe. The pointers are stored as integers,
+// as bpf2go generates the Go types of the map values.
+struct enqueue_args
+{
+    __u64 sk;
+    __u64 skb;
+};
+
+// Key of the drop counters, a local port of a network namespace.
+struct drop_key
+{
+    __u32 netns;
+    __u32 port;
+};
+
+// Drop counters of a local port.
+struct drop_value
+{
+    __u64 rcvbuf;
+    __u64 memory;
+};
+
+// Drop sent to the plugin, with the headers of the dropped datagram.
+struct event
+{
+    __u64 timestamp;
+    __u32 netns;
+    __u16 port;
+    // REASON_RCVBUF when the receive buffer of the socket is full, REASON_MEMORY under UDP memory pressure
+    __u8 reason;
+    __u8 hdr[HDR_LEN];
+    __u8 th[TH_LEN];
+};
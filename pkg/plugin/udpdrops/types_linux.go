@@ -0,0 +1,84 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package udpdrops
+
+import (
+	"sync"
+
+	v1 "github.com/cilium/cilium/pkg/hubble/api/v1"
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/perf"
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+	plugincommon "github.com/microsoft/retina/pkg/plugin/common"
+	"golang.org/x/sys/unix"
+)
+
+const name = "udpdrops"
+
+// pathHostNetns is the network namespace of the host, as Retina runs in the host network.
+const pathHostNetns = "/proc/self/ns/net"
+
+// enqueueFn is the function which charges a datagram to the receive buffer of its socket, and drops it if the buffer is
+// full or the UDP memory is exhausted.
+const enqueueFn = "__udp_enqueue_schedule_skb"
+
+const (
+	// Values of the reason label of the udp_socket_receive_drops metric
+	reasonRcvbuf = "rcvbuf"
+	reasonMemory = "memory"
+
+	// Drop reasons of the flows
+	dropReasonRcvbufFull     = "UDP_RCVBUF_FULL"
+	dropReasonMemoryPressure = "UDP_MEMORY_PRESSURE"
+)
+
+const perCPUBuffer = 16
+
+// openNetns opens netlink sockets in the network namespace bind mounted at path.
+var openNetns = func(path string) (addrLister, error) {
+	return plugincommon.OpenNetns(path, unix.NETLINK_ROUTE)
+}
+
+type udpdrops struct {
+	cfg             *kcfg.Config
+	l               *log.ZapLogger
+	enricher        enricher.EnricherInterface
+	externalChannel chan *v1.Event
+	coll            *ebpf.Collection
+	perfReader      *perf.Reader
+	hooks           []interface{ Close() error }
+	reader          *UDPDropsReader
+	wg              sync.WaitGroup
+}
+
+// dropKey is the key of the drop counters, a local port of a network namespace.
+type dropKey = udpdropsDropKey
+
+// dropValue are the drop counters of a local port.
+type dropValue = udpdropsDropValue
+
+// PortDrops are the datagrams dropped by the UDP sockets of a local port of a pod, or of the host for empty Namespace
+// and PodName.
+type PortDrops struct {
+	Namespace string
+	PodName   string
+	Port      uint16
+	// RcvbufDrops is the number of datagrams dropped because the receive buffer of the socket was full
+	RcvbufDrops uint64
+	// MemoryDrops is the number of datagrams dropped because the memory of the UDP sockets exceeded net.ipv4.udp_mem
+	MemoryDrops uint64
+}
+
+// addrLister is the netlink handle of a network namespace.
+type addrLister interface {
+	plugincommon.AddrLister
+	Close() error
+}
+
+// dropMap is the map of the drop counters.
+type dropMap interface {
+	Counters() (map[dropKey]dropValue, error)
+	Delete(k dropKey) error
+}
@@ -0,0 +1,131 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+//go:build ebpf && linux
+
+// Tests for the udpdrops kprobe programs.
+//
+// These load the compiled programs, verify they pass the kernel verifier and attach to __udp_enqueue_schedule_skb, then
+// overflow the receive buffer of a UDP socket on the loopback and read the events and counters.
+//
+// Requires: root (or CAP_BPF+CAP_SYS_ADMIN), a kernel with BTF and kprobes.
+// Run: sudo go test -tags=ebpf -v -count=1 ./pkg/plugin/udpdrops/...
+
+package udpdrops
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"github.com/cilium/ebpf/perf"
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/plugin/ebpftest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func loadTestCollection(t *testing.T) *ebpf.Collection {
+	t.Helper()
+	ebpftest.RequirePrivileged(t)
+
+	spec, err := loadUdpdrops()
+	require.NoError(t, err)
+	coll, err := ebpf.NewCollection(spec)
+	require.NoError(t, err)
+	t.Cleanup(func() { coll.Close() })
+	return coll
+}
+
+// TestPrograms verifies the compiled object has the kprobe and kretprobe programs and the maps.
+func TestPrograms(t *testing.T) {
+	spec, err := loadUdpdrops()
+	require.NoError(t, err)
+	assert.Equal(t, "kprobe/"+enqueueFn, spec.Programs[udpdropsProgRetinaUdpEnqueue].SectionName)
+	assert.Equal(t, "kretprobe/"+enqueueFn, spec.Programs[udpdropsProgRetinaUdpEnqueueRet].SectionName)
+	for _, m := range []string{udpdropsMapRetinaUdpArgs, udpdropsMapRetinaUdpDrops, udpdropsMapRetinaUdpEvts} {
+		assert.Contains(t, spec.Maps, m)
+	}
+}
+
+// TestBPFLoadAndVerify verifies the assembled programs pass the kernel verifier and all expected objects are created.
+func TestBPFLoadAndVerify(t *testing.T) {
+	coll := loadTestCollection(t)
+
+	assert.NotNil(t, coll.Programs[udpdropsProgRetinaUdpEnqueue], "kprobe program should be loaded")
+	assert.NotNil(t, coll.Programs[udpdropsProgRetinaUdpEnqueueRet], "kretprobe program should be loaded")
+	assert.NotNil(t, coll.Maps[udpdropsMapRetinaUdpArgs], "arguments map should be created")
+	assert.NotNil(t, coll.Maps[udpdropsMapRetinaUdpDrops], "drop map should be created")
+	assert.NotNil(t, coll.Maps[udpdropsMapRetinaUdpEvts], "perf event array map should be created")
+}
+
+// TestBPFReceiveBufferFull verifies the datagrams dropped by the full receive buffer of a UDP socket are counted and
+// sent.
+func TestBPFReceiveBufferFull(t *testing.T) {
+	coll := loadTestCollection(t)
+	kp, err := link.Kprobe(enqueueFn, coll.Programs[udpdropsProgRetinaUdpEnqueue], nil)
+	require.NoError(t, err, "should attach kprobe to %s", enqueueFn)
+	t.Cleanup(func() { kp.Close() })
+	krp, err := link.Kretprobe(enqueueFn, coll.Programs[udpdropsProgRetinaUdpEnqueueRet], nil)
+	require.NoError(t, err, "should attach kretprobe to %s", enqueueFn)
+	t.Cleanup(func() { krp.Close() })
+
+	reader, err := perf.NewReader(coll.Maps[udpdropsMapRetinaUdpEvts], os.Getpagesize()*4)
+	require.NoError(t, err, "should create perf reader")
+	t.Cleanup(func() { reader.Close() })
+
+	// A socket with the smallest receive buffer, which is never read.
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM, 0)
+	require.NoError(t, err)
+	t.Cleanup(func() { unix.Close(fd) })
+	require.NoError(t, unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUF, 0))
+	require.NoError(t, unix.Bind(fd, &unix.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}))
+	sa, err := unix.Getsockname(fd)
+	require.NoError(t, err)
+	port := uint16(sa.(*unix.SockaddrInet4).Port) //nolint:gosec // ports are 16 bits
+
+	sender, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM, 0)
+	require.NoError(t, err)
+	t.Cleanup(func() { unix.Close(sender) })
+	payload := make([]byte, 1024)
+	for range 16 {
+		require.NoError(t, unix.Sendto(sender, payload, 0, sa))
+	}
+
+	ev, ok := ebpftest.ReadPerfEvent[udpdropsEvent](t, reader, 5*time.Second)
+	require.True(t, ok, "should receive a drop event")
+	assert.Equal(t, port, ev.Port)
+	assert.Zero(t, ev.Reason)
+
+	fl := toFlow(nil, &ev)
+	require.NotNil(t, fl)
+	assert.Equal(t, "127.0.0.1", fl.GetIP().GetSource())
+	assert.Equal(t, "127.0.0.1", fl.GetIP().GetDestination())
+	assert.EqualValues(t, port, fl.GetL4().GetUDP().GetDestinationPort())
+
+	inode, err := netnsInode(pathHostNetns)
+	require.NoError(t, err)
+	assert.Equal(t, inode, ev.Netns)
+	counters, err := (&ebpfDropMap{m: coll.Maps[udpdropsMapRetinaUdpDrops]}).Counters()
+	require.NoError(t, err)
+	v, ok := counters[dropKey{Netns: inode, Port: uint32(port)}]
+	require.True(t, ok, "should count the drops of the port")
+	assert.Positive(t, v.Rcvbuf)
+}
+
+// TestBPFStopAfterInitWithoutStart verifies Stop() releases the kernel resources loaded by Init() when Start() is never
+// called.
+func TestBPFStopAfterInitWithoutStart(t *testing.T) {
+	ebpftest.RequirePrivileged(t)
+
+	log.SetupZapLogger(log.GetDefaultLogOpts())
+
+	p := New(&kcfg.Config{EnablePodLevel: true})
+	require.NoError(t, p.Init())
+	// Start() deliberately not called.
+	require.NoError(t, p.Stop(), "Stop() must clean up even without Start()")
+}
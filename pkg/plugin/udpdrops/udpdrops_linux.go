@@ -0,0 +1,275 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+// Package udpdrops contains the Retina udpdrops plugin. It utilizes eBPF to trace the datagrams dropped by the UDP
+// sockets because their receive buffers are full or the UDP memory is exhausted, attributing them to the pods and local
+// ports of the sockets.
+package udpdrops
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	v1 "github.com/cilium/cilium/pkg/hubble/api/v1"
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"github.com/cilium/ebpf/perf"
+	"github.com/microsoft/retina/internal/ktime"
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/metrics"
+	plugincommon "github.com/microsoft/retina/pkg/plugin/common"
+	"github.com/microsoft/retina/pkg/plugin/registry"
+	_ "github.com/microsoft/retina/pkg/plugin/udpdrops/_cprog" // nolint // This is needed so cprog is included when vendoring
+	"github.com/microsoft/retina/pkg/utils"
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+//go:generate go run github.com/cilium/ebpf/cmd/bpf2go@master -cflags "-g -O2 -Wall -D__TARGET_ARCH_${GOARCH} -Wall" -target ${GOARCH} -type drop_key -type drop_value -type event udpdrops ./_cprog/udpdrops.c -- -I../lib/_${GOARCH} -I../lib/common/libbpf/_src
+
+func init() {
+	registry.Add(name, New)
+}
+
+// New creates a udpdrops plugin.
+func New(cfg *kcfg.Config) registry.Plugin {
+	return &udpdrops{
+		cfg: cfg,
+		l:   log.Logger().Named(name),
+	}
+}
+
+func (u *udpdrops) Name() string {
+	return name
+}
+
+// Generate and Compile are no-ops, the programs are compiled with bpf2go and embedded in the binary.
+func (u *udpdrops) Generate(context.Context) error { return nil }
+func (u *udpdrops) Compile(context.Context) error  { return nil }
+
+func (u *udpdrops) Init() error {
+	// The pods of the sockets are resolved from the addresses of their network namespaces.
+	if !u.cfg.EnablePodLevel {
+		u.l.Warn("udpdrops will not init because pod level is disabled")
+		return nil
+	}
+
+	spec, err := loadUdpdrops()
+	if err != nil {
+		return fmt.Errorf("failed to load eBPF spec: %w", err)
+	}
+	// The drop counters are read by the plugin only, so there's nothing to pin.
+	coll, err := ebpf.NewCollection(spec)
+	if err != nil {
+		return fmt.Errorf("failed to load eBPF objects: %w", err)
+	}
+	// Clean up loaded objects if a later step fails.
+	ok := false
+	defer func() {
+		if !ok {
+			for _, h := range u.hooks {
+				h.Close()
+			}
+			u.hooks = nil
+			coll.Close()
+		}
+	}()
+
+	kp, err := link.Kprobe(enqueueFn, coll.Programs[udpdropsProgRetinaUdpEnqueue], nil)
+	if err != nil {
+		return fmt.Errorf("failed to attach kprobe to %s: %w", enqueueFn, err)
+	}
+	u.hooks = append(u.hooks, kp)
+	krp, err := link.Kretprobe(enqueueFn, coll.Programs[udpdropsProgRetinaUdpEnqueueRet], nil)
+	if err != nil {
+		return fmt.Errorf("failed to attach kretprobe to %s: %w", enqueueFn, err)
+	}
+	u.hooks = append(u.hooks, krp)
+
+	reader, err := plugincommon.NewPerfReader(u.l, coll.Maps[udpdropsMapRetinaUdpEvts], perCPUBuffer, 1)
+	if err != nil {
+		return fmt.Errorf("failed to create perf reader: %w", err)
+	}
+
+	u.coll = coll
+	u.perfReader = reader
+	ok = true
+
+	u.l.Info("udpdrops plugin initialized")
+	return nil
+}
+
+func (u *udpdrops) Start(ctx context.Context) error {
+	if !u.cfg.EnablePodLevel {
+		u.l.Warn("udpdrops will not start because pod level is disabled")
+		return nil
+	}
+	if !enricher.IsInitialized() {
+		u.l.Warn("retina enricher is not initialized, UDP drops will not be exported")
+		<-ctx.Done()
+		return nil
+	}
+	u.enricher = enricher.Instance()
+	u.reader = NewUDPDropsReader(u.enricher, &ebpfDropMap{m: u.coll.Maps[udpdropsMapRetinaUdpDrops]}, plugincommon.PathNetns, pathHostNetns)
+
+	return u.run(ctx)
+}
+
+func (u *udpdrops) run(ctx context.Context) error {
+	// readEvents returns once the perf reader is closed below, as its Read() blocks until then.
+	u.wg.Add(1)
+	go func() {
+		defer u.wg.Done()
+		u.readEvents(ctx)
+	}()
+
+	ticker := time.NewTicker(u.cfg.MetricsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			u.l.Info("Context is done, udpdrops will stop running")
+			if err := u.perfReader.Close(); err != nil {
+				u.l.Warn("failed to close perf reader", zap.Error(err))
+			}
+			u.wg.Wait()
+			return nil
+		case <-ticker.C:
+			if err := u.reader.readAndUpdate(); err != nil {
+				u.l.Error("Reading UDP drops failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (u *udpdrops) readEvents(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			record, err := u.perfReader.Read()
+			if err != nil {
+				if errors.Is(err, perf.ErrClosed) {
+					return
+				}
+				u.l.Error("Error reading perf event", zap.Error(err))
+				continue
+			}
+
+			if record.LostSamples > 0 {
+				metrics.LostEventsCounter.WithLabelValues(utils.Kernel, name).Add(float64(record.LostSamples))
+				continue
+			}
+
+			u.handleEvent(record.RawSample)
+		}
+	}
+}
+
+func (u *udpdrops) handleEvent(sample []byte) {
+	var ev udpdropsEvent
+	if err := binary.Read(bytes.NewReader(sample), binary.NativeEndian, &ev); err != nil {
+		u.l.Error("Error reading bpf event", zap.Error(err), zap.Int("expected", binary.Size(ev)), zap.Int("actual", len(sample)))
+		return
+	}
+
+	fl := toFlow(u.l, &ev)
+	if fl == nil {
+		return
+	}
+	e := &v1.Event{
+		Event:     fl,
+		Timestamp: fl.Time,
+	}
+
+	if u.enricher != nil {
+		u.enricher.Write(e)
+	}
+
+	if u.externalChannel != nil {
+		select {
+		case u.externalChannel <- e:
+		default:
+			metrics.LostEventsCounter.WithLabelValues(utils.ExternalChannel, name).Inc()
+		}
+	}
+}
+
+// toFlow returns the dropped flow of a datagram, from the sender to the socket, or nil if the headers of the datagram
+// cannot be parsed.
+func toFlow(l *log.ZapLogger, ev *udpdropsEvent) *flow.Flow {
+	var srcIP, dstIP net.IP
+	switch ev.Hdr[0] >> 4 {
+	case 4:
+		srcIP, dstIP = net.IP(ev.Hdr[12:16]), net.IP(ev.Hdr[16:20])
+	case 6:
+		srcIP, dstIP = net.IP(ev.Hdr[8:24]), net.IP(ev.Hdr[24:40])
+	default:
+		return nil
+	}
+	srcPort := binary.BigEndian.Uint16(ev.Th[0:2])
+	dstPort := binary.BigEndian.Uint16(ev.Th[2:4])
+
+	fl := utils.ToFlow(
+		l,
+		ktime.MonotonicOffset.Nanoseconds()+int64(ev.Timestamp), //nolint:gosec // timestamp fits in int64
+		srcIP, dstIP,
+		uint32(srcPort), uint32(dstPort),
+		unix.IPPROTO_UDP, 0,
+		flow.Verdict_DROPPED,
+	)
+	if fl == nil {
+		return nil
+	}
+	// IsReply is not applicable for DROPPED verdicts.
+	fl.IsReply = nil
+
+	ext := utils.NewExtensions()
+	if ev.Reason == 0 {
+		utils.AddDropReasonName(fl, ext, dropReasonRcvbufFull)
+	} else {
+		utils.AddDropReasonName(fl, ext, dropReasonMemoryPressure)
+	}
+	utils.SetExtensions(fl, ext)
+	return fl
+}
+
+func (u *udpdrops) Stop() error {
+	if !u.cfg.EnablePodLevel {
+		return nil
+	}
+	// Init() loads the eBPF objects, attaches the programs and creates the perf reader, which must be released even if
+	// Start() was not called.
+	if u.perfReader != nil {
+		// Idempotent: run() already closes the reader on normal shutdown.
+		if err := u.perfReader.Close(); err != nil {
+			u.l.Warn("failed to close perf reader", zap.Error(err))
+		}
+	}
+	for _, h := range u.hooks {
+		if err := h.Close(); err != nil {
+			u.l.Warn("failed to close hook", zap.Error(err))
+		}
+	}
+	u.hooks = nil
+	if u.coll != nil {
+		u.coll.Close()
+		u.coll = nil
+	}
+	return nil
+}
+
+func (u *udpdrops) SetupChannel(ch chan *v1.Event) error {
+	u.externalChannel = ch
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package udpdrops
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	v1 "github.com/cilium/cilium/pkg/hubble/api/v1"
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPodLevelDisabled(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+
+	u := New(&kcfg.Config{EnablePodLevel: false}).(*udpdrops)
+	require.NoError(t, u.Init())
+	assert.Nil(t, u.coll)
+	require.NoError(t, u.Start(context.Background()))
+	assert.Nil(t, u.reader)
+	require.NoError(t, u.Stop())
+}
+
+func testEvent(src, dst net.IP, sport, dport uint16, reason uint8) []byte {
+	ev := udpdropsEvent{Timestamp: 1000, Netns: 4026531840, Port: dport, Reason: reason}
+	if ip4 := src.To4(); ip4 != nil {
+		ev.Hdr[0] = 0x45
+		copy(ev.Hdr[12:16], ip4)
+		copy(ev.Hdr[16:20], dst.To4())
+	} else {
+		ev.Hdr[0] = 0x60
+		copy(ev.Hdr[8:24], src)
+		copy(ev.Hdr[24:40], dst)
+	}
+	binary.BigEndian.PutUint16(ev.Th[0:2], sport)
+	binary.BigEndian.PutUint16(ev.Th[2:4], dport)
+
+	buf := make([]byte, 0, binary.Size(ev))
+	buf, err := binary.Append(buf, binary.NativeEndian, &ev)
+	if err != nil {
+		panic(err)
+	}
+	return buf
+}
+
+func TestHandleEvent(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+
+	u := New(&kcfg.Config{EnablePodLevel: true}).(*udpdrops)
+	ch := make(chan *v1.Event, 3)
+	require.NoError(t, u.SetupChannel(ch))
+
+	tests := []struct {
+		name       string
+		sample     []byte
+		src, dst   string
+		dropReason string
+	}{
+		{
+			name:       "receive buffer full IPv4",
+			sample:     testEvent(net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.5"), 40000, 53, 0),
+			src:        "10.0.0.1",
+			dst:        "10.0.0.5",
+			dropReason: dropReasonRcvbufFull,
+		},
+		{
+			name:       "memory pressure IPv6",
+			sample:     testEvent(net.ParseIP("fd00::1"), net.ParseIP("fd00::5"), 40000, 53, 1),
+			src:        "fd00::1",
+			dst:        "fd00::5",
+			dropReason: dropReasonMemoryPressure,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u.handleEvent(tt.sample)
+			require.Len(t, ch, 1)
+			fl := (<-ch).GetFlow()
+			assert.Equal(t, tt.src, fl.GetIP().GetSource())
+			assert.Equal(t, tt.dst, fl.GetIP().GetDestination())
+			assert.EqualValues(t, 40000, fl.GetL4().GetUDP().GetSourcePort())
+			assert.EqualValues(t, 53, fl.GetL4().GetUDP().GetDestinationPort())
+			assert.Equal(t, flow.Verdict_DROPPED, fl.GetVerdict())
+			assert.Equal(t, tt.dropReason, utils.DropReasonDescription(fl))
+		})
+	}
+
+	// truncated samples and unknown IP versions are skipped
+	eventLen := binary.Size(udpdropsEvent{})
+	u.handleEvent(make([]byte, eventLen-1))
+	u.handleEvent(make([]byte, eventLen))
+	assert.Empty(t, ch)
+}
+
+func TestEventSize(t *testing.T) {
+	assert.Equal(t, 64, binary.Size(udpdropsEvent{}))
+}
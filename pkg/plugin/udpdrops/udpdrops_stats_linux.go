@@ -0,0 +1,221 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package udpdrops
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/cilium/ebpf"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/metrics"
+	plugincommon "github.com/microsoft/retina/pkg/plugin/common"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+type portKey struct {
+	namespace string
+	podName   string
+	port      uint16
+}
+
+func (k portKey) labels() []string {
+	return []string{k.namespace, k.podName, strconv.Itoa(int(k.port))}
+}
+
+// netnsInfo is a network namespace whose drops are exported, a pod or the host.
+type netnsInfo struct {
+	namespace string
+	podName   string
+}
+
+// ebpfDropMap reads the drop counters from the eBPF map.
+type ebpfDropMap struct {
+	m *ebpf.Map
+}
+
+func (e *ebpfDropMap) Counters() (map[dropKey]dropValue, error) {
+	var (
+		k dropKey
+		v dropValue
+	)
+	counters := make(map[dropKey]dropValue)
+	iter := e.m.Iterate()
+	for iter.Next(&k, &v) {
+		counters[k] = v
+	}
+	if err := iter.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to iterate drop counters")
+	}
+	return counters, nil
+}
+
+func (e *ebpfDropMap) Delete(k dropKey) error {
+	return e.m.Delete(k) //nolint:wrapcheck // wrapped by the caller
+}
+
+type UDPDropsReader struct {
+	l         *log.ZapLogger
+	enricher  enricher.EnricherInterface
+	drops     dropMap
+	netnsDir  string
+	hostNetns string
+	ports     []PortDrops
+
+	// the ports exported by the last update, to delete the ones which are gone
+	exportedPorts map[portKey]struct{}
+}
+
+// NewUDPDropsReader creates a reader of the UDP drops of the pods whose network namespaces are bind mounted in
+// netnsDir, and of the host network namespace at hostNetns. The enricher resolves the pods of the network namespaces
+// from their addresses.
+func NewUDPDropsReader(e enricher.EnricherInterface, drops dropMap, netnsDir, hostNetns string) *UDPDropsReader {
+	return &UDPDropsReader{
+		l:             log.Logger().Named(string("UDPDropsReader")),
+		enricher:      e,
+		drops:         drops,
+		netnsDir:      netnsDir,
+		hostNetns:     hostNetns,
+		exportedPorts: make(map[portKey]struct{}),
+	}
+}
+
+func (ur *UDPDropsReader) readAndUpdate() error {
+	if err := ur.readDrops(); err != nil {
+		return err
+	}
+
+	ur.updateMetrics()
+	ur.l.Debug("Done reading and updating UDP drops")
+
+	return nil
+}
+
+// readDrops reads the drop counters of the local ports of each network namespace which belongs to a pod, and of the
+// host.
+func (ur *UDPDropsReader) readDrops() error {
+	namespaces, err := ur.readNamespaces()
+	if err != nil {
+		return err
+	}
+
+	counters, err := ur.drops.Counters()
+	if err != nil {
+		return err
+	}
+
+	byKey := make(map[portKey]int)
+	ur.ports = ur.ports[:0]
+	for k, v := range counters {
+		ns, ok := namespaces[k.Netns]
+		if !ok {
+			// The network namespace is gone, its counters are deleted so that the map does not fill up.
+			if err := ur.drops.Delete(k); err != nil {
+				ur.l.Debug("Error while deleting drop counters", zap.Uint32("netns", k.Netns), zap.Error(err))
+			}
+			continue
+		}
+		if ns == nil {
+			// not the network namespace of a pod known to the cache
+			continue
+		}
+		pk := portKey{namespace: ns.namespace, podName: ns.podName, port: uint16(k.Port)} //nolint:gosec // ports are 16 bits
+		i, ok := byKey[pk]
+		if !ok {
+			i = len(ur.ports)
+			byKey[pk] = i
+			ur.ports = append(ur.ports, PortDrops{Namespace: pk.namespace, PodName: pk.podName, Port: pk.port})
+		}
+		ur.ports[i].RcvbufDrops += v.Rcvbuf
+		ur.ports[i].MemoryDrops += v.Memory
+	}
+	return nil
+}
+
+// readNamespaces returns the network namespaces by inode. The namespaces which are not pods known to the cache are nil,
+// so that their counters are kept until the pods are.
+func (ur *UDPDropsReader) readNamespaces() (map[uint32]*netnsInfo, error) {
+	entries, err := os.ReadDir(ur.netnsDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list network namespaces in %s", ur.netnsDir)
+	}
+
+	namespaces := make(map[uint32]*netnsInfo, len(entries)+1)
+	paths := make([]string, 0, len(entries)+1)
+	paths = append(paths, ur.hostNetns)
+	for _, entry := range entries {
+		paths = append(paths, filepath.Join(ur.netnsDir, entry.Name()))
+	}
+	for i, path := range paths {
+		// A pod may have been deleted since the listing, its namespace is skipped.
+		inode, err := netnsInode(path)
+		if err != nil {
+			ur.l.Debug("Error while reading network namespace", zap.String("netns", path), zap.Error(err))
+			continue
+		}
+		if _, ok := namespaces[inode]; ok {
+			continue
+		}
+		if i == 0 {
+			namespaces[inode] = &netnsInfo{}
+			continue
+		}
+		ns, err := ur.readNetns(path)
+		if err != nil {
+			ur.l.Debug("Error while resolving pod of network namespace", zap.String("netns", path), zap.Error(err))
+		}
+		namespaces[inode] = ns
+	}
+	return namespaces, nil
+}
+
+// netnsInode returns the inode of a network namespace, which is net.ns.inum in the kernel.
+func netnsInode(path string) (uint32, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return 0, errors.Wrapf(err, "failed to stat %s", path)
+	}
+	return uint32(st.Ino), nil //nolint:gosec // namespace inodes are 32 bits
+}
+
+// readNetns returns the pod of a network namespace, or nil if the namespace is not a pod.
+func (ur *UDPDropsReader) readNetns(path string) (*netnsInfo, error) {
+	h, err := openNetns(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open network namespace")
+	}
+	defer h.Close()
+
+	ep, err := plugincommon.NetnsEndpoint(ur.enricher, h)
+	if err != nil || ep == nil {
+		return nil, err
+	}
+	return &netnsInfo{namespace: ep.GetNamespace(), podName: ep.GetPodName()}, nil
+}
+
+func (ur *UDPDropsReader) updateMetrics() {
+	exported := make(map[portKey]struct{}, len(ur.ports))
+	for _, p := range ur.ports {
+		k := portKey{namespace: p.Namespace, podName: p.PodName, port: p.Port}
+		exported[k] = struct{}{}
+		labels := k.labels()
+
+		metrics.UDPSocketReceiveDropsGauge.WithLabelValues(append(labels, reasonRcvbuf)...).Set(float64(p.RcvbufDrops))
+		metrics.UDPSocketReceiveDropsGauge.WithLabelValues(append(labels, reasonMemory)...).Set(float64(p.MemoryDrops))
+	}
+
+	for k := range ur.exportedPorts {
+		if _, ok := exported[k]; ok {
+			continue
+		}
+		labels := k.labels()
+		for _, reason := range []string{reasonRcvbuf, reasonMemory} {
+			metrics.UDPSocketReceiveDropsGauge.DeleteLabelValues(append(labels, reason)...)
+		}
+	}
+	ur.exportedPorts = exported
+}
@@ -0,0 +1,174 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+package udpdrops
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+	gomock "go.uber.org/mock/gomock"
+)
+
+var errNetlink = errors.New("netlink error")
+
+type fakeAddrLister struct {
+	addrs  []netlink.Addr
+	closed bool
+}
+
+func (f *fakeAddrLister) AddrList(netlink.Link, int) ([]netlink.Addr, error) {
+	return f.addrs, nil
+}
+
+func (f *fakeAddrLister) Close() error {
+	f.closed = true
+	return nil
+}
+
+type fakeDropMap struct {
+	counters map[dropKey]dropValue
+	deleted  []dropKey
+}
+
+func (f *fakeDropMap) Counters() (map[dropKey]dropValue, error) {
+	return f.counters, nil
+}
+
+func (f *fakeDropMap) Delete(k dropKey) error {
+	f.deleted = append(f.deleted, k)
+	return nil
+}
+
+func anys(lvs []string) []any {
+	a := make([]any, len(lvs))
+	for i, lv := range lvs {
+		a[i] = lv
+	}
+	return a
+}
+
+func addr(ip string) netlink.Addr {
+	return netlink.Addr{IPNet: &net.IPNet{IP: net.ParseIP(ip)}}
+}
+
+// setupNetnsDir creates a directory with the entries of the fake network namespaces in netns, and the host one next
+// to it, and returns it with the inodes of the entries.
+func setupNetnsDir(t *testing.T, handles map[string]*fakeAddrLister) (string, map[string]uint32) {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "netns"), 0o700))
+	inodes := make(map[string]uint32, len(handles))
+	for ns := range handles {
+		path := filepath.Join(dir, "netns", ns)
+		if ns == "host" {
+			path = filepath.Join(dir, ns)
+		}
+		require.NoError(t, os.WriteFile(path, nil, 0o600))
+		inode, err := netnsInode(path)
+		require.NoError(t, err)
+		inodes[ns] = inode
+	}
+	oldOpenNetns := openNetns
+	t.Cleanup(func() { openNetns = oldOpenNetns })
+	openNetns = func(path string) (addrLister, error) {
+		h, ok := handles[filepath.Base(path)]
+		if !ok {
+			return nil, errNetlink
+		}
+		return h, nil
+	}
+	return dir, inodes
+}
+
+func TestReadDrops(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	handles := map[string]*fakeAddrLister{
+		// the host is not resolved
+		"host":  {},
+		"cni-1": {addrs: []netlink.Addr{addr("127.0.0.1"), addr("fe80::1"), addr("10.0.0.5")}},
+		// not a pod
+		"cni-2": {addrs: []netlink.Addr{addr("10.0.0.8")}},
+	}
+	dir, inodes := setupNetnsDir(t, handles)
+
+	drops := &fakeDropMap{counters: map[dropKey]dropValue{
+		{Netns: inodes["cni-1"], Port: 53}:   {Rcvbuf: 10, Memory: 1},
+		{Netns: inodes["cni-1"], Port: 8125}: {Rcvbuf: 3},
+		{Netns: inodes["cni-2"], Port: 53}:   {Rcvbuf: 5},
+		{Netns: inodes["host"], Port: 4789}:  {Memory: 2},
+		// gone
+		{Netns: 1, Port: 53}: {Rcvbuf: 5},
+	}}
+
+	e := enricher.NewMockEnricherInterface(ctrl)
+	e.EXPECT().EndpointByIP("10.0.0.5").Return(&flow.Endpoint{Namespace: "ns1", PodName: "pod1"})
+	e.EXPECT().EndpointByIP("10.0.0.8").Return(nil)
+
+	ur := NewUDPDropsReader(e, drops, filepath.Join(dir, "netns"), filepath.Join(dir, "host"))
+	require.NoError(t, ur.readDrops())
+	assert.ElementsMatch(t, []PortDrops{
+		{Port: 4789, MemoryDrops: 2},
+		{Namespace: "ns1", PodName: "pod1", Port: 53, RcvbufDrops: 10, MemoryDrops: 1},
+		{Namespace: "ns1", PodName: "pod1", Port: 8125, RcvbufDrops: 3},
+	}, ur.ports)
+	assert.Equal(t, []dropKey{{Netns: 1, Port: 53}}, drops.deleted)
+	assert.True(t, handles["cni-1"].closed)
+	assert.True(t, handles["cni-2"].closed)
+
+	ur = NewUDPDropsReader(e, drops, filepath.Join(dir, "nonexistent"), filepath.Join(dir, "host"))
+	require.Error(t, ur.readDrops())
+}
+
+func TestUDPDropsUpdateMetrics(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dropsGauge := metrics.NewMockGaugeVec(ctrl)
+	oldDrops := metrics.UDPSocketReceiveDropsGauge
+	metrics.UDPSocketReceiveDropsGauge = dropsGauge
+	defer func() { metrics.UDPSocketReceiveDropsGauge = oldDrops }()
+
+	testmetric := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "testmetric",
+		Help: "testmetric",
+	})
+	pod1 := []string{"ns1", "pod1", "53"}
+	host := []string{"", "", "4789"}
+	for _, labels := range [][]string{pod1, host} {
+		dropsGauge.EXPECT().WithLabelValues(anys(append(labels, reasonRcvbuf))...).Return(testmetric)
+		dropsGauge.EXPECT().WithLabelValues(anys(append(labels, reasonMemory))...).Return(testmetric)
+	}
+
+	ur := NewUDPDropsReader(nil, nil, "", "")
+	ur.ports = []PortDrops{
+		{Namespace: "ns1", PodName: "pod1", Port: 53, RcvbufDrops: 10, MemoryDrops: 1},
+		{Port: 4789, MemoryDrops: 2},
+	}
+	ur.updateMetrics()
+
+	// the port of pod1 is gone, its series are deleted
+	dropsGauge.EXPECT().WithLabelValues(anys(append(host, reasonRcvbuf))...).Return(testmetric)
+	dropsGauge.EXPECT().WithLabelValues(anys(append(host, reasonMemory))...).Return(testmetric)
+	dropsGauge.EXPECT().DeleteLabelValues(anys(append(pod1, reasonRcvbuf))...).Return(true)
+	dropsGauge.EXPECT().DeleteLabelValues(anys(append(pod1, reasonMemory))...).Return(true)
+
+	ur.ports = ur.ports[1:]
+	ur.updateMetrics()
+}
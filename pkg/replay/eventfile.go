@@ -0,0 +1,151 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+// Package replay records the flows written to the enricher on a node and replays them offline through the enricher
+// and the metrics module, to see the series a MetricsConfiguration produces before rolling it out.
+package replay
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	"google.golang.org/protobuf/proto"
+)
+
+// fileMagic starts every recording, followed by a gzip stream of flows, each prefixed with its length as uvarint.
+const fileMagic = "RETINA-FLOWS-1\n"
+
+// maxFlowSize guards against allocating for a corrupt length prefix.
+const maxFlowSize = 1 << 20
+
+var (
+	ErrInvalidRecording = errors.New("invalid flow recording")
+	errFlowTooLarge     = errors.New("flow too large")
+)
+
+// Writer writes flows to a recording. It is safe for concurrent use.
+type Writer struct {
+	mu  sync.Mutex
+	gz  *gzip.Writer
+	buf []byte
+	n   int
+	err error
+}
+
+// NewWriter starts a recording on w. Close must be called to flush the recording.
+func NewWriter(w io.Writer) (*Writer, error) {
+	if _, err := io.WriteString(w, fileMagic); err != nil {
+		return nil, fmt.Errorf("failed to write recording header: %w", err)
+	}
+	return &Writer{gz: gzip.NewWriter(w)}, nil
+}
+
+// WriteFlow appends a flow to the recording. The flow is serialized before WriteFlow returns, so it may be modified
+// afterwards.
+func (w *Writer) WriteFlow(f *flow.Flow) error {
+	data, err := proto.Marshal(f)
+	if err != nil {
+		return fmt.Errorf("failed to marshal flow: %w", err)
+	}
+	return w.writeMarshaled(data)
+}
+
+// writeMarshaled appends a flow serialized with proto.Marshal to the recording.
+func (w *Writer) writeMarshaled(data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+
+	w.buf = binary.AppendUvarint(w.buf[:0], uint64(len(data)))
+	w.buf = append(w.buf, data...)
+	if _, err := w.gz.Write(w.buf); err != nil {
+		w.err = fmt.Errorf("failed to write flow: %w", err)
+		return w.err
+	}
+	w.n++
+	return nil
+}
+
+// Count returns the number of flows written.
+func (w *Writer) Count() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.n
+}
+
+// Flush writes the buffered flows to the underlying writer.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.gz.Flush(); err != nil {
+		w.err = fmt.Errorf("failed to flush recording: %w", err)
+	}
+	return w.err
+}
+
+// Close completes the recording. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.gz.Close(); err != nil && w.err == nil {
+		w.err = fmt.Errorf("failed to close recording: %w", err)
+	}
+	return w.err
+}
+
+// Reader reads the flows of a recording.
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader reads a recording written by Writer.
+func NewReader(r io.Reader) (*Reader, error) {
+	magic := make([]byte, len(fileMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != fileMagic {
+		return nil, fmt.Errorf("%w: missing header", ErrInvalidRecording)
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRecording, err)
+	}
+	return &Reader{r: bufio.NewReader(gz)}, nil
+}
+
+// Next returns the next flow of the recording, or io.EOF at the end of the recording. A recording which was cut off,
+// e.g. because the agent restarted while recording, ends with io.ErrUnexpectedEOF.
+func (r *Reader) Next() (*flow.Flow, error) {
+	size, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("failed to read flow length: %w", err)
+	}
+	if size > maxFlowSize {
+		return nil, fmt.Errorf("%w: %w of %d bytes", ErrInvalidRecording, errFlowTooLarge, size)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("failed to read flow: %w", err)
+	}
+	f := &flow.Flow{}
+	if err := proto.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRecording, err)
+	}
+	return f, nil
+}
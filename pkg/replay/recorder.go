@@ -0,0 +1,202 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package replay
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	v1 "github.com/cilium/cilium/pkg/hubble/api/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+)
+
+const (
+	// recordingPattern matches the recordings written by FileRecorder. The names sort in the order of the recordings.
+	recordingPattern    = "flows-*.rec"
+	recordingTimeFormat = "20060102150405.000000"
+	// recordQueueSize bounds the flows waiting to be written, flows are dropped when the disk does not keep up.
+	recordQueueSize = 4096
+	// recordFlushInterval is how often the current recording is flushed, so that it can be replayed while written.
+	recordFlushInterval = 5 * time.Second
+)
+
+// FlowSource is implemented by the enricher.
+type FlowSource interface {
+	AddRecorder(rec enricher.Recorder) (remove func())
+}
+
+// FileRecorder records the flows written to the enricher to files in a directory, for offline replay. A file is
+// rotated once it reaches the maximum file size, and the oldest files are removed beyond the maximum number of files,
+// so the recordings take at most maxFileSize*maxFiles bytes of the directory.
+type FileRecorder struct {
+	l           *log.ZapLogger
+	dir         string
+	maxFileSize int64
+	maxFiles    int
+
+	flows   chan []byte
+	dropped atomic.Uint64
+}
+
+func NewFileRecorder(dir string, maxFileSize int64, maxFiles int) *FileRecorder {
+	return &FileRecorder{
+		l:           log.Logger().Named("flow-recorder"),
+		dir:         dir,
+		maxFileSize: maxFileSize,
+		maxFiles:    maxFiles,
+		flows:       make(chan []byte, recordQueueSize),
+	}
+}
+
+// Run records the flows of the source until the context is canceled.
+func (r *FileRecorder) Run(ctx context.Context, source FlowSource) error {
+	if err := os.MkdirAll(r.dir, 0o750); err != nil {
+		return fmt.Errorf("failed to create flow recording directory: %w", err)
+	}
+	remove := source.AddRecorder(r.record)
+	defer remove()
+	r.l.Info("Recording flows", zap.String("directory", r.dir), zap.Int64("maxFileSize", r.maxFileSize), zap.Int("maxFiles", r.maxFiles))
+
+	ticker := time.NewTicker(recordFlushInterval)
+	defer ticker.Stop()
+
+	var current *recordingFile
+	defer func() {
+		if current != nil {
+			r.closeFile(current)
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case data := <-r.flows:
+			if current == nil {
+				var err error
+				if current, err = r.createFile(); err != nil {
+					r.l.Warn("Failed to create flow recording", zap.Error(err))
+					continue
+				}
+			}
+			if err := current.w.writeMarshaled(data); err != nil {
+				r.l.Warn("Failed to record flow", zap.String("file", current.name), zap.Error(err))
+				r.closeFile(current)
+				current = nil
+				continue
+			}
+			if current.size.n >= r.maxFileSize {
+				r.closeFile(current)
+				current = nil
+				r.removeOldFiles()
+			}
+		case <-ticker.C:
+			if current != nil {
+				if err := current.w.Flush(); err != nil {
+					r.l.Warn("Failed to flush flow recording", zap.String("file", current.name), zap.Error(err))
+				}
+			}
+			if dropped := r.dropped.Swap(0); dropped > 0 {
+				r.l.Warn("Dropped flows while recording, the disk did not keep up", zap.Uint64("flows", dropped))
+			}
+		}
+	}
+}
+
+// record runs on the goroutine of the plugin writing the event, so it only serializes the flow.
+func (r *FileRecorder) record(ev *v1.Event) {
+	f, ok := ev.Event.(*flow.Flow)
+	if !ok {
+		return
+	}
+	data, err := proto.Marshal(f)
+	if err != nil {
+		return
+	}
+	select {
+	case r.flows <- data:
+	default:
+		r.dropped.Add(1)
+	}
+}
+
+// recordingFile is the recording being written.
+type recordingFile struct {
+	name string
+	f    *os.File
+	w    *Writer
+	size *countingWriter
+}
+
+func (r *FileRecorder) createFile() (*recordingFile, error) {
+	name := filepath.Join(r.dir, "flows-"+time.Now().UTC().Format(recordingTimeFormat)+".rec")
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", name, err)
+	}
+	size := &countingWriter{w: f}
+	w, err := NewWriter(size)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &recordingFile{name: name, f: f, w: w, size: size}, nil
+}
+
+func (r *FileRecorder) closeFile(rf *recordingFile) {
+	if err := rf.w.Close(); err != nil {
+		r.l.Warn("Failed to complete flow recording", zap.String("file", rf.name), zap.Error(err))
+	}
+	if err := rf.f.Close(); err != nil {
+		r.l.Warn("Failed to close flow recording", zap.String("file", rf.name), zap.Error(err))
+	}
+	r.l.Info("Recorded flows", zap.String("file", rf.name), zap.Int("flows", rf.w.Count()), zap.Int64("bytes", rf.size.n))
+}
+
+// removeOldFiles removes the oldest recordings beyond the maximum number of files.
+func (r *FileRecorder) removeOldFiles() {
+	files, err := RecordingFiles(r.dir)
+	if err != nil {
+		r.l.Warn("Failed to list flow recordings", zap.Error(err))
+		return
+	}
+	for len(files) > r.maxFiles {
+		if err := os.Remove(files[0]); err != nil {
+			r.l.Warn("Failed to remove flow recording", zap.String("file", files[0]), zap.Error(err))
+		}
+		files = files[1:]
+	}
+}
+
+// RecordingFiles returns the recordings written by FileRecorder in a directory, oldest first.
+func RecordingFiles(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, recordingPattern))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recordings: %w", err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// countingWriter counts the bytes written to a file, as the file is not flushed after every flow.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err //nolint:wrapcheck // passthrough
+}
@@ -0,0 +1,122 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	v1 "github.com/cilium/cilium/pkg/hubble/api/v1"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+
+	api "github.com/microsoft/retina/crd/api/v1alpha1"
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/controllers/cache"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/module/metrics"
+)
+
+// Stats counts the flows of a replay.
+type Stats struct {
+	// Flows is the number of flows read from the recordings.
+	Flows int
+	// Enriched is the number of flows the enricher exported to the metrics module.
+	Enriched int
+	// Processed is the number of flows selected by the namespace filters of the spec.
+	Processed int
+	// Truncated is the number of recordings which were cut off, e.g. the recording the agent is still writing.
+	Truncated int
+}
+
+// Replay runs the flows of the recordings through the enricher, using the cache for pod, service and node
+// information, and the metrics of the spec. It returns the resulting series of the advanced metrics.
+func Replay(ctx context.Context, conf *kcfg.Config, spec *api.MetricsSpec, c cache.CacheInterface, recordings ...*Reader) (Stats, []*dto.MetricFamily, error) {
+	var stats Stats
+	e := enricher.NewStandalone(ctx, c)
+	replayer := metrics.NewReplayer(conf, spec, c)
+
+	for _, recording := range recordings {
+		for {
+			if err := ctx.Err(); err != nil {
+				return stats, nil, fmt.Errorf("replay canceled: %w", err)
+			}
+			f, err := recording.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				stats.Truncated++
+				break
+			}
+			if err != nil {
+				return stats, nil, err
+			}
+			stats.Flows++
+
+			ev := &v1.Event{Event: f, Timestamp: f.GetTime()}
+			if !e.Enrich(ev) {
+				continue
+			}
+			stats.Enriched++
+			if replayer.ProcessFlow(f) {
+				stats.Processed++
+			}
+		}
+	}
+
+	families, err := replayer.Gather()
+	if err != nil {
+		return stats, nil, fmt.Errorf("failed to gather metrics: %w", err)
+	}
+	return stats, families, nil
+}
+
+// WriteSeries writes the series in the Prometheus text exposition format.
+func WriteSeries(w io.Writer, families []*dto.MetricFamily) error {
+	encoder := expfmt.NewEncoder(w, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for _, family := range families {
+		if err := encoder.Encode(family); err != nil {
+			return fmt.Errorf("failed to encode metric %s: %w", family.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// WriteCardinality writes the number of series of every metric and the number of distinct values of each label.
+func WriteCardinality(w io.Writer, families []*dto.MetricFamily) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "METRIC\tSERIES\tLABEL VALUES")
+	for _, family := range families {
+		values := map[string]map[string]struct{}{}
+		for _, m := range family.GetMetric() {
+			for _, lp := range m.GetLabel() {
+				if values[lp.GetName()] == nil {
+					values[lp.GetName()] = map[string]struct{}{}
+				}
+				values[lp.GetName()][lp.GetValue()] = struct{}{}
+			}
+		}
+
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		labels := make([]string, 0, len(names))
+		for _, name := range names {
+			labels = append(labels, fmt.Sprintf("%s=%d", name, len(values[name])))
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", family.GetName(), len(family.GetMetric()), strings.Join(labels, " "))
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("failed to write cardinality: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package replay
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cilium/cilium/api/v1/flow"
+	v1 "github.com/cilium/cilium/pkg/hubble/api/v1"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	api "github.com/microsoft/retina/crd/api/v1alpha1"
+	kcfg "github.com/microsoft/retina/pkg/config"
+	"github.com/microsoft/retina/pkg/enricher"
+	"github.com/microsoft/retina/pkg/log"
+	"github.com/microsoft/retina/pkg/utils"
+)
+
+const testSnapshot = `
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Pod
+  metadata:
+    name: frontend-1
+    namespace: shop
+    labels:
+      app: frontend
+  status:
+    podIP: 10.0.0.1
+- apiVersion: v1
+  kind: Pod
+  metadata:
+    name: backend-1
+    namespace: shop
+  status:
+    podIP: 10.0.0.2
+- apiVersion: v1
+  kind: Pod
+  metadata:
+    name: node-exporter
+    namespace: monitoring
+  spec:
+    hostNetwork: true
+    containers: []
+  status:
+    podIP: 10.224.0.4
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: backend
+  namespace: shop
+spec:
+  clusterIP: 10.1.0.2
+---
+apiVersion: v1
+kind: Node
+metadata:
+  name: node-1
+  labels:
+    topology.kubernetes.io/zone: zone-1
+status:
+  addresses:
+  - type: InternalIP
+    address: 10.224.0.4
+`
+
+func testFlow(src, dst string, verdict flow.Verdict) *flow.Flow {
+	return utils.ToFlow(log.Logger(), time.Now().UnixNano(), net.ParseIP(src), net.ParseIP(dst), 443, 8080, 6, 0, verdict)
+}
+
+func recordFlows(t *testing.T, flows ...*flow.Flow) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	require.NoError(t, err)
+	for _, f := range flows {
+		require.NoError(t, w.WriteFlow(f))
+	}
+	require.NoError(t, w.Close())
+	return &buf
+}
+
+func TestRecordingRoundTrip(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	flows := []*flow.Flow{
+		testFlow("10.0.0.1", "10.0.0.2", flow.Verdict_FORWARDED),
+		testFlow("10.0.0.2", "10.0.0.1", flow.Verdict_DROPPED),
+	}
+	buf := recordFlows(t, flows...)
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	for _, want := range flows {
+		got, err := r.Next()
+		require.NoError(t, err)
+		assert.Equal(t, want.GetIP().GetSource(), got.GetIP().GetSource())
+		assert.Equal(t, want.GetVerdict(), got.GetVerdict())
+	}
+	_, err = r.Next()
+	require.ErrorIs(t, err, io.EOF)
+
+	// A recording which was cut off fails instead of silently ending.
+	r, err = NewReader(bytes.NewReader(buf.Bytes()[:buf.Len()-10]))
+	require.NoError(t, err)
+	for err == nil {
+		_, err = r.Next()
+	}
+	assert.NotErrorIs(t, err, io.EOF)
+
+	_, err = NewReader(strings.NewReader("not a recording"))
+	require.ErrorIs(t, err, ErrInvalidRecording)
+}
+
+func TestLoadSnapshot(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+
+	c, err := LoadSnapshot(strings.NewReader(testSnapshot))
+	require.NoError(t, err)
+
+	frontend := c.GetPodByIP("10.0.0.1")
+	require.NotNil(t, frontend)
+	assert.Equal(t, "shop/frontend-1", frontend.NamespacedName())
+	assert.NotNil(t, c.GetPodByIP("10.0.0.2"))
+	assert.NotNil(t, c.GetSvcByIP("10.1.0.2"))
+	node := c.GetNodeByIP("10.224.0.4")
+	require.NotNil(t, node)
+	assert.Equal(t, "zone-1", node.Zone())
+	assert.Nil(t, c.GetPodByIP("10.224.0.4"), "host network pods are not cached")
+}
+
+func forwardCount(t *testing.T, families []*dto.MetricFamily) []*dto.Metric {
+	t.Helper()
+	for _, family := range families {
+		if family.GetName() == "networkobservability_adv_forward_count" {
+			return family.GetMetric()
+		}
+	}
+	return nil
+}
+
+func labelValue(m *dto.Metric, name string) string {
+	for _, lp := range m.GetLabel() {
+		if lp.GetName() == name {
+			return lp.GetValue()
+		}
+	}
+	return ""
+}
+
+func TestReplay(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+
+	c, err := LoadSnapshot(strings.NewReader(testSnapshot))
+	require.NoError(t, err)
+	conf := &kcfg.Config{RemoteContext: true}
+	spec := &api.MetricsSpec{
+		ContextOptions: []api.MetricsContextOptions{
+			{
+				MetricName:        utils.ForwardPacketsGaugeName,
+				SourceLabels:      []string{"podname", "namespace"},
+				DestinationLabels: []string{"podname"},
+			},
+		},
+	}
+	flows := []*flow.Flow{
+		testFlow("10.0.0.1", "10.0.0.2", flow.Verdict_FORWARDED),
+		testFlow("10.0.0.1", "10.0.0.2", flow.Verdict_FORWARDED),
+		testFlow("10.0.0.2", "10.0.0.1", flow.Verdict_DROPPED),
+	}
+
+	t.Run("series", func(t *testing.T) {
+		r, err := NewReader(recordFlows(t, flows...))
+		require.NoError(t, err)
+		stats, families, err := Replay(context.Background(), conf, spec, c, r)
+		require.NoError(t, err)
+		assert.Equal(t, Stats{Flows: 3, Enriched: 3, Processed: 3}, stats)
+
+		series := forwardCount(t, families)
+		require.Len(t, series, 1)
+		assert.Equal(t, "frontend-1", labelValue(series[0], "source_podname"))
+		assert.Equal(t, "shop", labelValue(series[0], "source_namespace"))
+		assert.Equal(t, "backend-1", labelValue(series[0], "destination_podname"))
+		assert.InDelta(t, 2, series[0].GetGauge().GetValue(), 0)
+
+		var out bytes.Buffer
+		require.NoError(t, WriteSeries(&out, families))
+		assert.Contains(t, out.String(), `networkobservability_adv_forward_count{destination_podname="backend-1"`)
+
+		out.Reset()
+		require.NoError(t, WriteCardinality(&out, families))
+		assert.Contains(t, out.String(), "networkobservability_adv_forward_count")
+	})
+
+	t.Run("namespace filter", func(t *testing.T) {
+		filtered := *spec
+		filtered.Namespaces = api.MetricsNamespaces{Include: []string{"other"}}
+		r, err := NewReader(recordFlows(t, flows...))
+		require.NoError(t, err)
+		stats, families, err := Replay(context.Background(), conf, &filtered, c, r)
+		require.NoError(t, err)
+		assert.Equal(t, Stats{Flows: 3, Enriched: 3, Processed: 0}, stats)
+		assert.Empty(t, forwardCount(t, families))
+	})
+	t.Run("truncated recording", func(t *testing.T) {
+		// A recording the agent is still writing ends after its last flush.
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf)
+		require.NoError(t, err)
+		for _, f := range flows {
+			require.NoError(t, w.WriteFlow(f))
+		}
+		require.NoError(t, w.Flush())
+		r, err := NewReader(&buf)
+		require.NoError(t, err)
+		stats, _, err := Replay(context.Background(), conf, spec, c, r)
+		require.NoError(t, err)
+		assert.Equal(t, Stats{Flows: 3, Enriched: 3, Processed: 3, Truncated: 1}, stats)
+	})
+}
+
+type fakeFlowSource struct {
+	mu       sync.Mutex
+	recorder enricher.Recorder
+}
+
+func (f *fakeFlowSource) AddRecorder(rec enricher.Recorder) func() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.recorder = rec
+	return func() {}
+}
+
+func (f *fakeFlowSource) write(ev *v1.Event) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.recorder == nil {
+		return false
+	}
+	f.recorder(ev)
+	return true
+}
+
+func TestFileRecorder(t *testing.T) {
+	_, err := log.SetupZapLogger(log.GetDefaultLogOpts())
+	require.NoError(t, err)
+	dir := t.TempDir()
+	// Every flow exceeds the file size, so every flow rotates the recording.
+	r := NewFileRecorder(dir, 1, 2)
+	source := &fakeFlowSource{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- r.Run(ctx, source) }()
+	require.Eventually(t, func() bool { return source.write(&v1.Event{Event: &flow.LostEvent{}}) }, 5*time.Second, 10*time.Millisecond)
+
+	for _, src := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		source.write(&v1.Event{Event: testFlow(src, "10.0.0.4", flow.Verdict_FORWARDED)})
+		// Wait for the flow to be written, so that the recordings have distinct names.
+		require.Eventually(t, func() bool { return len(r.flows) == 0 }, 5*time.Second, 10*time.Millisecond)
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	require.NoError(t, <-done)
+
+	// The oldest recording was removed.
+	files, err := RecordingFiles(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	for i, src := range []string{"10.0.0.2", "10.0.0.3"} {
+		f, err := os.Open(files[i])
+		require.NoError(t, err)
+		defer f.Close()
+		rec, err := NewReader(f)
+		require.NoError(t, err)
+		got, err := rec.Next()
+		require.NoError(t, err)
+		assert.Equal(t, src, got.GetIP().GetSource())
+		_, err = rec.Next()
+		require.ErrorIs(t, err, io.EOF)
+	}
+}
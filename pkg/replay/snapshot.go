@@ -0,0 +1,135 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	"github.com/microsoft/retina/pkg/common"
+	"github.com/microsoft/retina/pkg/controllers/cache"
+	"github.com/microsoft/retina/pkg/pubsub"
+)
+
+// LoadSnapshot builds a cache from Pods, Services and Nodes in YAML or JSON, for example the output of
+//
+//	kubectl get pods,services,nodes -A -o yaml
+//
+// The objects are converted the same way the agent's controllers convert them. Other kinds are ignored.
+func LoadSnapshot(r io.Reader) (*cache.Cache, error) {
+	c := cache.New(pubsub.New())
+	decoder := serializer.NewCodecFactory(scheme.Scheme).UniversalDeserializer()
+
+	docs := utilyaml.NewYAMLReader(bufio.NewReader(r))
+	for {
+		doc, err := docs.Read()
+		if errors.Is(err, io.EOF) {
+			return c, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+
+		obj, _, err := decoder.Decode(doc, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode snapshot object: %w", err)
+		}
+		if err := addToCache(c, decoder, obj); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func addToCache(c *cache.Cache, decoder runtime.Decoder, obj runtime.Object) error {
+	switch o := obj.(type) {
+	case *corev1.List:
+		for _, item := range o.Items {
+			itemObj, _, err := decoder.Decode(item.Raw, nil, nil)
+			if err != nil {
+				return fmt.Errorf("failed to decode snapshot list item: %w", err)
+			}
+			if err := addToCache(c, decoder, itemObj); err != nil {
+				return err
+			}
+		}
+	case *corev1.PodList:
+		for i := range o.Items {
+			if err := addPod(c, &o.Items[i]); err != nil {
+				return err
+			}
+		}
+	case *corev1.ServiceList:
+		for i := range o.Items {
+			if err := addService(c, &o.Items[i]); err != nil {
+				return err
+			}
+		}
+	case *corev1.NodeList:
+		for i := range o.Items {
+			if err := addNode(c, &o.Items[i]); err != nil {
+				return err
+			}
+		}
+	case *corev1.Pod:
+		return addPod(c, o)
+	case *corev1.Service:
+		return addService(c, o)
+	case *corev1.Node:
+		return addNode(c, o)
+	}
+	return nil
+}
+
+// addPod mirrors the pod controller of the agent.
+func addPod(c *cache.Cache, pod *corev1.Pod) error {
+	if pod.Spec.HostNetwork || pod.Status.PodIP == "" {
+		return nil
+	}
+	if err := c.UpdateRetinaEndpoint(common.RetinaEndpointCommonFromPod(pod)); err != nil {
+		return fmt.Errorf("failed to add pod %s/%s: %w", pod.Namespace, pod.Name, err)
+	}
+	return nil
+}
+
+// addService mirrors the service controller of the agent.
+func addService(c *cache.Cache, service *corev1.Service) error {
+	if service.Spec.ClusterIP == "" || service.Spec.ClusterIP == corev1.ClusterIPNone {
+		return nil
+	}
+	ips := common.IPAddresses{IPv4: net.ParseIP(service.Spec.ClusterIP)}
+	var lbIP net.IP
+	if len(service.Status.LoadBalancer.Ingress) > 0 {
+		lbIP = net.ParseIP(service.Status.LoadBalancer.Ingress[0].IP)
+	}
+	svc := common.NewRetinaSvc(service.Name, service.Namespace, &ips, lbIP, service.Spec.Selector)
+	if err := c.UpdateRetinaSvc(svc); err != nil {
+		return fmt.Errorf("failed to add service %s/%s: %w", service.Namespace, service.Name, err)
+	}
+	return nil
+}
+
+// addNode mirrors the node controller of the agent.
+func addNode(c *cache.Cache, node *corev1.Node) error {
+	if len(node.Status.Addresses) == 0 {
+		return nil
+	}
+	n := common.NewRetinaNode(node.Name, net.ParseIP(node.Status.Addresses[0].Address), node.Labels[corev1.LabelTopologyZone])
+	if err := c.UpdateRetinaNode(n); err != nil {
+		return fmt.Errorf("failed to add node %s: %w", node.Name, err)
+	}
+	return nil
+}
@@ -48,6 +48,19 @@ var (
 	Active                = "ACTIVE"
 	Device                = "device"
 	Metric                = "metric"
+	Side                  = "side"
+	Policy                = "policy"
+	CPU                   = "cpu"
+	Namespace             = "namespace"
+	PodName               = "podname"
+	Kind                  = "kind"
+	Handle                = "handle"
+	WorkloadKind          = "workload_kind"
+	WorkloadName          = "workload_name"
+	Queue                 = "queue"
+	Family                = "family"
+	Threshold             = "threshold"
+	Resource              = "resource"
 
 	// TCP Connection Statistic Names
 	ResetCount           = "ResetCount"
@@ -4,6 +4,7 @@ package utils
 
 import (
 	"net"
+	"strings"
 	"time"
 
 	"github.com/cilium/cilium/api/v1/flow"
@@ -26,10 +27,17 @@ const (
 	ExtKeyPrevObservedPackets  = "previously_observed_packets"
 	ExtKeyPrevObservedBytes    = "previously_observed_bytes"
 	ExtKeyPrevObservedTCPFlags = "previously_observed_tcp_flags"
+	ExtKeyTCPZeroWindow        = "tcp_zero_window"
 	ExtKeySourceZone           = "source_zone"
 	ExtKeyDestinationZone      = "destination_zone"
+	ExtKeyICMPSource           = "icmp_source"
+	ExtKeyMTU                  = "mtu"
 
 	zoneUnknown = "unknown"
+
+	// podTemplateHashLabel is the label of the pods of a ReplicaSet created by a Deployment,
+	// the ReplicaSet name is the Deployment name suffixed with its value
+	podTemplateHashLabel = "pod-template-hash"
 )
 
 // Additional Verdicts to be used for flow objects
@@ -311,6 +319,23 @@ func GetTCPID(f *flow.Flow) uint64 {
 	return uint64(v.GetNumberValue())
 }
 
+// AddTCPZeroWindow marks the flow's packet as a TCP zero window advertisement.
+func AddTCPZeroWindow(s *structpb.Struct) {
+	if s == nil {
+		return
+	}
+	s.GetFields()[ExtKeyTCPZeroWindow] = structpb.NewBoolValue(true)
+}
+
+// IsTCPZeroWindow returns true if the flow's packet is a TCP zero window advertisement.
+func IsTCPZeroWindow(f *flow.Flow) bool {
+	s := GetExtensionsStruct(f)
+	if s == nil {
+		return false
+	}
+	return s.GetFields()[ExtKeyTCPZeroWindow].GetBoolValue()
+}
+
 // AddDNSInfo adds DNS information to the flow and its extensions.
 func AddDNSInfo(
 	f *flow.Flow, s *structpb.Struct, qType string, rCode uint32,
@@ -446,6 +471,23 @@ func AddDropReason(f *flow.Flow, s *structpb.Struct, dropReason uint16) {
 	}
 }
 
+// AddDropReasonName adds a drop reason which has no Retina drop reason, such as the overflows of the TCP listen queues,
+// to the flow and its extensions.
+func AddDropReasonName(f *flow.Flow, s *structpb.Struct, dropReason string) {
+	if f == nil || s == nil {
+		return
+	}
+
+	s.GetFields()[ExtKeyDropReason] = structpb.NewStringValue(dropReason)
+
+	f.Verdict = flow.Verdict_DROPPED
+	f.DropReasonDesc = flow.DropReason_DROP_REASON_UNKNOWN
+	f.EventType = &flow.CiliumEventType{
+		Type:    int32(api.MessageTypeDrop),
+		SubType: int32(f.GetDropReasonDesc()),
+	}
+}
+
 func DropReasonDescription(f *flow.Flow) string {
 	if f == nil {
 		return ""
@@ -507,3 +549,58 @@ func DestinationZone(f *flow.Flow) string {
 	}
 	return v.GetStringValue()
 }
+
+// AddICMPError adds the address of the router or host which sent an ICMP error about the packets of the flow to the
+// flow's extensions, with the MTU of the next hop if the error is a packet too big one.
+func AddICMPError(s *structpb.Struct, source string, mtu uint32) {
+	if s == nil {
+		return
+	}
+	s.GetFields()[ExtKeyICMPSource] = structpb.NewStringValue(source)
+	if mtu > 0 {
+		s.GetFields()[ExtKeyMTU] = structpb.NewNumberValue(float64(mtu))
+	}
+}
+
+// ICMPSource returns the address of the sender of the ICMP error from the flow's extensions.
+func ICMPSource(f *flow.Flow) string {
+	s := GetExtensionsStruct(f)
+	if s == nil {
+		return ""
+	}
+	v, ok := s.GetFields()[ExtKeyICMPSource]
+	if !ok {
+		return ""
+	}
+	return v.GetStringValue()
+}
+
+// MTU returns the MTU of the next hop of the ICMP packet too big error from the flow's extensions, or 0.
+func MTU(f *flow.Flow) uint32 {
+	s := GetExtensionsStruct(f)
+	if s == nil {
+		return 0
+	}
+	v, ok := s.GetFields()[ExtKeyMTU]
+	if !ok {
+		return 0
+	}
+	return uint32(v.GetNumberValue())
+}
+
+// TopLevelWorkload returns the workload of an endpoint, resolving the ReplicaSet created by a Deployment to the
+// Deployment, so that rollouts do not create new series. The endpoint must have at least one workload.
+func TopLevelWorkload(ep *flow.Endpoint) (kind, name string) {
+	wk := ep.GetWorkloads()[0]
+	kind, name = wk.GetKind(), wk.GetName()
+	if kind != "ReplicaSet" {
+		return kind, name
+	}
+	for _, label := range ep.GetLabels() {
+		hash, ok := strings.CutPrefix(label, podTemplateHashLabel+"=")
+		if ok && hash != "" && strings.HasSuffix(name, "-"+hash) {
+			return "Deployment", strings.TrimSuffix(name, "-"+hash)
+		}
+	}
+	return kind, name
+}
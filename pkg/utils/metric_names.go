@@ -15,21 +15,35 @@ const (
 	DropBytesGaugeName                   = "drop_bytes"
 	ForwardPacketsGaugeName              = "forward_count"
 	ForwardBytesGaugeName                = "forward_bytes"
+	ZoneTrafficCountName                 = "zone_traffic_count"
+	ZoneTrafficBytesName                 = "zone_traffic_bytes"
+	PacketSizeName                       = "packet_size"
+	ConnectionSizeName                   = "connection_size"
 	TCPStateGaugeName                    = "tcp_state"
 	TCPConnectionRemoteGaugeName         = "tcp_connection_remote"
 	TCPConnectionStatsName               = "tcp_connection_stats"
 	TCPFlagGauge                         = "tcp_flag_gauges"
 	TCPRetransCount                      = "tcp_retransmission_count"
+	TCPHandshakeFailuresName             = "tcp_handshake_failures"
+	TCPResetsName                        = "tcp_resets"
+	TCPZeroWindowName                    = "tcp_zero_window"
 	IPConnectionStatsName                = "ip_connection_stats"
 	UDPConnectionStatsName               = "udp_connection_stats"
 	InterfaceStatsName                   = "interface_stats"
+	SoftnetStatsName                     = "softnet_stats"
+	QdiscStatsName                       = "qdisc_stats"
+	QdiscClassStatsName                  = "qdisc_class_stats"
 	DNSRequestCounterName                = "dns_request_count"
 	DNSResponseCounterName               = "dns_response_count"
+	DNSFailureCounterName                = "dns_failure_count"
 	NodeAPIServerLatencyName             = "node_apiserver_latency"
 	NodeAPIServerTCPHandshakeLatencyName = "node_apiserver_handshake_latency"
 	NoResponseFromAPIServerName          = "node_apiserver_no_response"
 	InfinibandCounterStatsName           = "infiniband_counter_stats"
 	InfinibandStatusParamsName           = "infiniband_status_params"
+	InfinibandHWCounterStatsName         = "infiniband_hw_counter_stats"
+	InfinibandQueuePairsName             = "infiniband_queue_pairs"
+	InfinibandPodResourcesName           = "infiniband_pod_resources"
 
 	// Common Gauges across os distributions
 	NodeConnectivityStatusName         = "node_connectivity_status"
@@ -41,6 +55,36 @@ const (
 	ConntrackBytesTxGaugeName     = "conntrack_bytes_tx"
 	ConntrackBytesRxGaugeName     = "conntrack_bytes_rx"
 	ConntrackTotalConnectionsName = "conntrack_total_connections"
+
+	// Netfilter conntrack table
+	NfConntrackEntriesName    = "nf_conntrack_entries"
+	NfConntrackMaxEntriesName = "nf_conntrack_max_entries"
+	NfConntrackCPUStatsName   = "nf_conntrack_cpu_stats"
+	NfConntrackPodEntriesName = "nf_conntrack_pod_entries"
+
+	// TCP sockets of the pods
+	TCPSocketRTTName          = "tcp_socket_rtt_seconds"
+	TCPSocketRTTVarName       = "tcp_socket_rttvar_seconds"
+	TCPSocketCwndName         = "tcp_socket_cwnd_segments"
+	TCPSocketDeliveryRateName = "tcp_socket_delivery_rate_bytes_per_second"
+	TCPSocketStatsName        = "tcp_socket_stats"
+
+	// TCP listen queues of the pods
+	ListenQueueOverflowsName = "listen_queue_overflows"
+	ListenAcceptQueueName    = "listen_accept_queue"
+
+	// ICMP errors and PMTU black holes
+	ICMPErrorCounterName       = "icmp_error_count"
+	PMTUBlackholeSuspectedName = "pmtu_blackhole_suspected_sockets"
+
+	// UDP receive drops of the pods
+	UDPSocketReceiveDropsName = "udp_socket_receive_drops"
+
+	// Neighbor table, route and link changes of the node
+	NeighborEntriesName        = "neighbor_entries"
+	NeighborGCThreshName       = "neighbor_gc_thresh"
+	RouteChangeCounterName     = "route_change_count"
+	LinkStateChangeCounterName = "link_state_change_count"
 )
 
 // IsAdvancedMetric is a helper function to determine if a name is an advanced metric
@@ -51,6 +95,10 @@ func IsAdvancedMetric(name string) bool {
 		DropBytesGaugeName,
 		ForwardPacketsGaugeName,
 		ForwardBytesGaugeName,
+		ZoneTrafficCountName,
+		ZoneTrafficBytesName,
+		PacketSizeName,
+		ConnectionSizeName,
 		NodeConnectivityStatusName,
 		NodeConnectivityLatencySecondsName,
 		TCPStateGaugeName,
@@ -58,10 +106,14 @@ func IsAdvancedMetric(name string) bool {
 		TCPConnectionStatsName,
 		TCPFlagGauge,
 		TCPRetransCount,
+		TCPHandshakeFailuresName,
+		TCPResetsName,
+		TCPZeroWindowName,
 		IPConnectionStatsName,
 		UDPConnectionStatsName,
 		DNSRequestCounterName,
 		DNSResponseCounterName,
+		DNSFailureCounterName,
 		NodeAPIServerLatencyName,
 		NodeAPIServerTCPHandshakeLatencyName,
 		NoResponseFromAPIServerName:
@@ -10,6 +10,7 @@ import (
 	"testing"
 
 	"github.com/cilium/cilium/api/v1/flow"
+	"github.com/cilium/cilium/pkg/monitor/api"
 	"github.com/stretchr/testify/assert"
 	"github.com/vishvananda/netlink"
 
@@ -165,6 +166,40 @@ func TestAddDropReason(t *testing.T) {
 	}
 }
 
+func TestAddDropReasonName(t *testing.T) {
+	f := &flow.Flow{}
+	ext := NewExtensions()
+	AddDropReasonName(f, ext, "TCP_ACCEPT_QUEUE_FULL")
+	SetExtensions(f, ext)
+	assert.Equal(t, flow.Verdict_DROPPED, f.Verdict)
+	assert.Equal(t, flow.DropReason_DROP_REASON_UNKNOWN, f.DropReasonDesc)
+	assert.EqualValues(t, api.MessageTypeDrop, f.GetEventType().GetType())
+	assert.Equal(t, "TCP_ACCEPT_QUEUE_FULL", DropReasonDescription(f))
+
+	// no-op without flow or extensions
+	AddDropReasonName(nil, ext, "TCP_ACCEPT_QUEUE_FULL")
+	AddDropReasonName(f, nil, "TCP_ACCEPT_QUEUE_FULL")
+}
+
+func TestAddICMPError(t *testing.T) {
+	f := &flow.Flow{}
+	ext := NewExtensions()
+	AddICMPError(ext, "192.168.1.1", 1400)
+	SetExtensions(f, ext)
+	assert.Equal(t, "192.168.1.1", ICMPSource(f))
+	assert.EqualValues(t, 1400, MTU(f))
+
+	// the MTU is only set by the packet too big errors
+	ext = NewExtensions()
+	AddICMPError(ext, "192.168.1.1", 0)
+	SetExtensions(f, ext)
+	assert.Equal(t, "192.168.1.1", ICMPSource(f))
+	assert.Zero(t, MTU(f))
+
+	assert.Empty(t, ICMPSource(&flow.Flow{}))
+	AddICMPError(nil, "192.168.1.1", 1400)
+}
+
 func TestZoneHelpers(t *testing.T) {
 	tests := []struct {
 		name            string
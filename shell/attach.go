@@ -11,14 +11,14 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/cli-runtime/pkg/genericiooptions"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
 	"k8s.io/kubectl/pkg/cmd/attach"
 	"k8s.io/kubectl/pkg/cmd/exec"
+	"k8s.io/kubectl/pkg/util/term"
 )
 
-func attachToShell(restConfig *rest.Config, namespace, podName, containerName string, pod *v1.Pod) error {
+func attachToShell(config Config, namespace, podName, containerName string, pod *v1.Pod, title string) error {
 	attachOpts := &attach.AttachOptions{
-		Config: restConfig,
+		Config: config.RestConfig,
 		StreamOptions: exec.StreamOptions{
 			Namespace:     namespace,
 			PodName:       podName,
@@ -37,6 +37,26 @@ func attachToShell(restConfig *rest.Config, namespace, podName, containerName st
 		Pod:        pod,
 	}
 
+	if config.RecordPath != "" {
+		f, recorder, err := openRecording(config.RecordPath, title, term.TTY{Out: os.Stdout}.GetSize())
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		attachOpts.Attach = &recordingRemoteAttach{
+			delegate:    attachOpts.Attach,
+			recorder:    recorder,
+			recordInput: config.RecordInput,
+		}
+		defer func() {
+			if err := recorder.Err(); err != nil {
+				fmt.Fprintf(os.Stderr, "session recording %s is incomplete: %v\n", config.RecordPath, err)
+				return
+			}
+			fmt.Fprintf(os.Stderr, "Session recorded to %s\n", config.RecordPath)
+		}()
+	}
+
 	if err := attachOpts.Run(); err != nil {
 		return fmt.Errorf("error attaching to shell container: %w", err)
 	}
@@ -1,14 +1,27 @@
 package shell
 
 import (
+	"fmt"
+
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilrand "k8s.io/apimachinery/pkg/util/rand"
 )
 
+const startupScriptEnvKey = "RETINA_SHELL_STARTUP_SCRIPT"
+
+// startupScriptWrapper starts an interactive shell which runs the startup script before its first prompt.
+// kubectl resizes the terminal when it attaches, so the wrapper waits for SIGWINCH (for at most 10 seconds) to avoid
+// running the script before anyone can see its output.
+const startupScriptWrapper = `trap 'attached=1' WINCH
+for _ in $(seq 100); do [ -n "$attached" ] && break; sleep 0.1; done
+trap - WINCH
+{ echo '[ -f /etc/profile ] && . /etc/profile'; printf '%s\n' "$` + startupScriptEnvKey + `"; } > /tmp/retina-shell-startup.sh
+exec /bin/bash --rcfile /tmp/retina-shell-startup.sh -i`
+
 // convertToCapabilities converts a slice of strings to a slice of v1.Capability
 func ephemeralContainerForPodDebug(config Config) v1.EphemeralContainer {
-	return v1.EphemeralContainer{
+	ec := v1.EphemeralContainer{
 		EphemeralContainerCommon: v1.EphemeralContainerCommon{
 			Name:  randomRetinaShellContainerName(),
 			Image: config.RetinaShellImage,
@@ -22,6 +35,8 @@ func ephemeralContainerForPodDebug(config Config) v1.EphemeralContainer {
 			},
 		},
 	}
+	ec.Args, ec.Env = startupScriptArgsAndEnv(config)
+	return ec
 }
 
 func hostNetworkPodForNodeDebug(config Config, debugPodNamespace, nodeName string) *v1.Pod {
@@ -85,6 +100,25 @@ func hostNetworkPodForNodeDebug(config Config, debugPodNamespace, nodeName strin
 		)
 	}
 
+	for i, m := range config.Mounts {
+		volumeName := fmt.Sprintf("profile-mount-%d", i)
+		pod.Spec.Volumes = append(pod.Spec.Volumes, v1.Volume{
+			Name: volumeName,
+			VolumeSource: v1.VolumeSource{
+				HostPath: &v1.HostPathVolumeSource{
+					Path: m.HostPath,
+				},
+			},
+		})
+		pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, v1.VolumeMount{
+			Name:      volumeName,
+			MountPath: m.MountPath,
+			ReadOnly:  m.ReadOnly,
+		})
+	}
+
+	pod.Spec.Containers[0].Args, pod.Spec.Containers[0].Env = startupScriptArgsAndEnv(config)
+
 	if config.AppArmorUnconfined {
 		pod.Spec.Containers[0].SecurityContext.AppArmorProfile = &v1.AppArmorProfile{
 			Type: v1.AppArmorProfileTypeUnconfined,
@@ -100,6 +134,16 @@ func hostNetworkPodForNodeDebug(config Config, debugPodNamespace, nodeName strin
 	return pod
 }
 
+// startupScriptArgsAndEnv returns the container args and env to run the startup script of the config, if any.
+// The args replace the default command of the image, the entrypoint is kept.
+func startupScriptArgsAndEnv(config Config) ([]string, []v1.EnvVar) {
+	if config.StartupScript == "" {
+		return nil, nil
+	}
+	return []string{"/bin/bash", "-c", startupScriptWrapper},
+		[]v1.EnvVar{{Name: startupScriptEnvKey, Value: config.StartupScript}}
+}
+
 func randomRetinaShellContainerName() string {
 	const retinaShellContainerNameRandLen = 5
 	return "retina-shell-" + utilrand.String(retinaShellContainerNameRandLen)
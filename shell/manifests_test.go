@@ -95,3 +95,37 @@ func TestHostNetworkPodForNodeDebugWithMountHostFilesystemWithWriteAccess(t *tes
 	assert.False(t, pod.Spec.Containers[0].VolumeMounts[0].ReadOnly)
 	assert.False(t, pod.Spec.Containers[0].VolumeMounts[1].ReadOnly)
 }
+
+func TestHostNetworkPodForNodeDebugWithMounts(t *testing.T) {
+	config := Config{
+		RetinaShellImage: testRetinaImage,
+		Mounts: []Mount{
+			{HostPath: "/var/log", MountPath: "/host-logs", ReadOnly: true},
+			{HostPath: "/sys/fs/bpf", MountPath: "/sys/fs/bpf"},
+		},
+	}
+	pod := hostNetworkPodForNodeDebug(config, "kube-system", "node0001")
+	assert.Len(t, pod.Spec.Volumes, 2)
+	assert.Equal(t, "/var/log", pod.Spec.Volumes[0].HostPath.Path)
+	assert.Equal(t, "/sys/fs/bpf", pod.Spec.Volumes[1].HostPath.Path)
+	assert.Equal(t, []v1.VolumeMount{
+		{Name: "profile-mount-0", MountPath: "/host-logs", ReadOnly: true},
+		{Name: "profile-mount-1", MountPath: "/sys/fs/bpf"},
+	}, pod.Spec.Containers[0].VolumeMounts)
+}
+
+func TestHostNetworkPodForNodeDebugWithStartupScript(t *testing.T) {
+	pod := hostNetworkPodForNodeDebug(Config{RetinaShellImage: testRetinaImage}, "kube-system", "node0001")
+	assert.Empty(t, pod.Spec.Containers[0].Args)
+	assert.Empty(t, pod.Spec.Containers[0].Env)
+
+	pod = hostNetworkPodForNodeDebug(Config{RetinaShellImage: testRetinaImage, StartupScript: "conntrack -S"}, "kube-system", "node0001")
+	assert.Equal(t, []string{"/bin/bash", "-c", startupScriptWrapper}, pod.Spec.Containers[0].Args)
+	assert.Equal(t, []v1.EnvVar{{Name: startupScriptEnvKey, Value: "conntrack -S"}}, pod.Spec.Containers[0].Env)
+}
+
+func TestEphemeralContainerForPodDebugWithStartupScript(t *testing.T) {
+	ec := ephemeralContainerForPodDebug(Config{RetinaShellImage: testRetinaImage, StartupScript: "ss -tnp"})
+	assert.Equal(t, []string{"/bin/bash", "-c", startupScriptWrapper}, ec.Args)
+	assert.Equal(t, []v1.EnvVar{{Name: startupScriptEnvKey, Value: "ss -tnp"}}, ec.Env)
+}
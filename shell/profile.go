@@ -0,0 +1,184 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// ProfilesConfigMapKey is the key of the ConfigMap data holding the profiles, in the same format as a profiles file.
+const ProfilesConfigMapKey = "profiles.yaml"
+
+var (
+	errProfileNotFound = errors.New("shell profile not found")
+	errInvalidProfile  = errors.New("invalid shell profile")
+)
+
+// Profile bundles the image, privileges, mounts and startup script of a shell for a debugging task.
+type Profile struct {
+	// Image overrides the default retina-shell image.
+	Image        string   `json:"image,omitempty"`
+	Capabilities []string `json:"capabilities,omitempty"`
+	HostPID      bool     `json:"hostPID,omitempty"`
+
+	// Host filesystem access and mounts apply only to nodes, not pods.
+	MountHostFilesystem      bool    `json:"mountHostFilesystem,omitempty"`
+	AllowHostFilesystemWrite bool    `json:"allowHostFilesystemWrite,omitempty"`
+	Mounts                   []Mount `json:"mounts,omitempty"`
+
+	AppArmorUnconfined bool `json:"apparmorUnconfined,omitempty"`
+	SeccompUnconfined  bool `json:"seccompUnconfined,omitempty"`
+
+	// StartupScript is run by the interactive shell once it is attached, before the first prompt.
+	StartupScript string `json:"startupScript,omitempty"`
+}
+
+// Mount is a host path mounted into the shell container.
+type Mount struct {
+	HostPath  string `json:"hostPath"`
+	MountPath string `json:"mountPath"`
+	ReadOnly  bool   `json:"readOnly,omitempty"`
+}
+
+// ProfilesFile is the format of a profiles file and of the ProfilesConfigMapKey of a profiles ConfigMap.
+//
+//	profiles:
+//	  netdebug:
+//	    capabilities: [NET_ADMIN, NET_RAW]
+type ProfilesFile struct {
+	Profiles map[string]Profile `json:"profiles"`
+}
+
+// BuiltinProfiles returns the profiles available without any configuration.
+func BuiltinProfiles() map[string]Profile {
+	return map[string]Profile{
+		"netdebug": {
+			Capabilities: []string{"NET_ADMIN", "NET_RAW"},
+		},
+		"conntrack": {
+			Capabilities:  []string{"NET_ADMIN", "NET_RAW"},
+			StartupScript: "conntrack -S\nconntrack -C",
+		},
+		"hostfs": {
+			Capabilities:        []string{"SYS_CHROOT"},
+			MountHostFilesystem: true,
+			HostPID:             true,
+		},
+	}
+}
+
+// ParseProfiles parses and validates profiles in the format of ProfilesFile.
+func ParseProfiles(data []byte) (map[string]Profile, error) {
+	var file ProfilesFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing shell profiles: %w", err)
+	}
+	for name := range file.Profiles {
+		if err := validateProfile(file.Profiles[name]); err != nil {
+			return nil, fmt.Errorf("profile %q: %w", name, err)
+		}
+	}
+	return file.Profiles, nil
+}
+
+// LoadProfilesFile loads the profiles from a local file. A missing file is not an error unless required is set.
+func LoadProfilesFile(filePath string, required bool) (map[string]Profile, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && !required {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading shell profiles file: %w", err)
+	}
+	profiles, err := ParseProfiles(data)
+	if err != nil {
+		return nil, fmt.Errorf("error loading %s: %w", filePath, err)
+	}
+	return profiles, nil
+}
+
+// LoadProfilesConfigMap loads the profiles from the ProfilesConfigMapKey of a ConfigMap.
+func LoadProfilesConfigMap(ctx context.Context, clientset kubernetes.Interface, namespace, name string) (map[string]Profile, error) {
+	cm, err := clientset.CoreV1().
+		ConfigMaps(namespace).
+		Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving shell profiles ConfigMap %s/%s: %w", namespace, name, err)
+	}
+	profiles, err := ParseProfiles([]byte(cm.Data[ProfilesConfigMapKey]))
+	if err != nil {
+		return nil, fmt.Errorf("error loading ConfigMap %s/%s: %w", namespace, name, err)
+	}
+	return profiles, nil
+}
+
+// ResolveProfile looks up a profile by name. Later sources take precedence over earlier ones.
+func ResolveProfile(name string, sources ...map[string]Profile) (Profile, error) {
+	available := map[string]struct{}{}
+	for i := len(sources) - 1; i >= 0; i-- {
+		if profile, ok := sources[i][name]; ok {
+			return profile, nil
+		}
+		for n := range sources[i] {
+			available[n] = struct{}{}
+		}
+	}
+	names := make([]string, 0, len(available))
+	for n := range available {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return Profile{}, fmt.Errorf("%w: %q (available: %s)", errProfileNotFound, name, strings.Join(names, ", "))
+}
+
+// ApplyProfile adds the settings of the profile to the config. Capabilities are merged, and boolean settings are
+// enabled if either the config or the profile enables them. The image is not changed, as the caller decides whether
+// an explicitly configured image takes precedence.
+func ApplyProfile(config Config, profile Profile) Config {
+	config.Capabilities = mergeCapabilities(profile.Capabilities, config.Capabilities)
+	config.HostPID = config.HostPID || profile.HostPID
+	config.MountHostFilesystem = config.MountHostFilesystem || profile.MountHostFilesystem
+	config.AllowHostFilesystemWrite = config.AllowHostFilesystemWrite || profile.AllowHostFilesystemWrite
+	config.AppArmorUnconfined = config.AppArmorUnconfined || profile.AppArmorUnconfined
+	config.SeccompUnconfined = config.SeccompUnconfined || profile.SeccompUnconfined
+	config.Mounts = append(append([]Mount{}, profile.Mounts...), config.Mounts...)
+	if config.StartupScript == "" {
+		config.StartupScript = profile.StartupScript
+	}
+	return config
+}
+
+func mergeCapabilities(lists ...[]string) []string {
+	seen := map[string]struct{}{}
+	merged := []string{}
+	for _, list := range lists {
+		for _, c := range list {
+			if _, ok := seen[c]; ok {
+				continue
+			}
+			seen[c] = struct{}{}
+			merged = append(merged, c)
+		}
+	}
+	return merged
+}
+
+func validateProfile(profile Profile) error {
+	for _, m := range profile.Mounts {
+		if !path.IsAbs(m.HostPath) || !path.IsAbs(m.MountPath) {
+			return fmt.Errorf("%w: mount paths must be absolute, got hostPath %q and mountPath %q", errInvalidProfile, m.HostPath, m.MountPath)
+		}
+	}
+	return nil
+}
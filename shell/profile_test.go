@@ -0,0 +1,115 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package shell
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testProfiles = `
+profiles:
+  netdebug:
+    image: example.com/netdebug:v1
+    capabilities: [NET_ADMIN]
+  logs:
+    mounts:
+    - hostPath: /var/log
+      mountPath: /host-logs
+      readOnly: true
+    startupScript: ls /host-logs
+`
+
+func TestParseProfiles(t *testing.T) {
+	profiles, err := ParseProfiles([]byte(testProfiles))
+	require.NoError(t, err)
+	assert.Equal(t, Profile{Image: "example.com/netdebug:v1", Capabilities: []string{"NET_ADMIN"}}, profiles["netdebug"])
+	assert.Equal(t, Profile{
+		Mounts:        []Mount{{HostPath: "/var/log", MountPath: "/host-logs", ReadOnly: true}},
+		StartupScript: "ls /host-logs",
+	}, profiles["logs"])
+
+	_, err = ParseProfiles([]byte("profiles:\n  x:\n    capabilites: [NET_ADMIN]\n"))
+	require.Error(t, err, "unknown fields should be rejected")
+
+	_, err = ParseProfiles([]byte("profiles:\n  x:\n    mounts:\n    - hostPath: var\n      mountPath: /var\n"))
+	require.ErrorIs(t, err, errInvalidProfile)
+}
+
+func TestLoadProfilesFile(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+	profiles, err := LoadProfilesFile(missing, false)
+	require.NoError(t, err)
+	assert.Empty(t, profiles)
+
+	_, err = LoadProfilesFile(missing, true)
+	require.Error(t, err)
+
+	file := filepath.Join(t.TempDir(), "profiles.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(testProfiles), 0o600))
+	profiles, err = LoadProfilesFile(file, true)
+	require.NoError(t, err)
+	assert.Len(t, profiles, 2)
+}
+
+func TestLoadProfilesConfigMap(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "retina-shell-profiles", Namespace: "kube-system"},
+		Data:       map[string]string{ProfilesConfigMapKey: testProfiles},
+	})
+	profiles, err := LoadProfilesConfigMap(context.Background(), clientset, "kube-system", "retina-shell-profiles")
+	require.NoError(t, err)
+	assert.Len(t, profiles, 2)
+
+	_, err = LoadProfilesConfigMap(context.Background(), clientset, "default", "retina-shell-profiles")
+	require.Error(t, err)
+}
+
+func TestResolveProfile(t *testing.T) {
+	custom := map[string]Profile{"netdebug": {Capabilities: []string{"NET_ADMIN"}}}
+
+	profile, err := ResolveProfile("netdebug", BuiltinProfiles(), custom)
+	require.NoError(t, err)
+	assert.Equal(t, custom["netdebug"], profile, "later sources should take precedence")
+
+	profile, err = ResolveProfile("conntrack", BuiltinProfiles(), custom)
+	require.NoError(t, err)
+	assert.Equal(t, BuiltinProfiles()["conntrack"], profile)
+
+	_, err = ResolveProfile("missing", BuiltinProfiles(), custom)
+	require.ErrorIs(t, err, errProfileNotFound)
+	assert.Contains(t, err.Error(), "conntrack, hostfs, netdebug")
+}
+
+func TestApplyProfile(t *testing.T) {
+	config := Config{
+		RetinaShellImage:  testRetinaImage,
+		Capabilities:      []string{"NET_RAW", "SYS_PTRACE"},
+		SeccompUnconfined: true,
+	}
+	profile := Profile{
+		Image:               "example.com/netdebug:v1",
+		Capabilities:        []string{"NET_ADMIN", "NET_RAW"},
+		MountHostFilesystem: true,
+		Mounts:              []Mount{{HostPath: "/var/log", MountPath: "/host-logs"}},
+		StartupScript:       "conntrack -S",
+	}
+
+	applied := ApplyProfile(config, profile)
+	assert.Equal(t, testRetinaImage, applied.RetinaShellImage, "the image is chosen by the caller")
+	assert.Equal(t, []string{"NET_ADMIN", "NET_RAW", "SYS_PTRACE"}, applied.Capabilities)
+	assert.True(t, applied.MountHostFilesystem)
+	assert.True(t, applied.SeccompUnconfined)
+	assert.False(t, applied.HostPID)
+	assert.Equal(t, profile.Mounts, applied.Mounts)
+	assert.Equal(t, "conntrack -S", applied.StartupScript)
+}
@@ -0,0 +1,212 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package shell
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/kubectl/pkg/cmd/attach"
+	"k8s.io/kubectl/pkg/util/term"
+)
+
+const (
+	asciicastVersion = 2
+
+	asciicastEventOutput = "o"
+	asciicastEventInput  = "i"
+	asciicastEventResize = "r"
+
+	// Size of the terminal recorded when the size of the local terminal is unknown.
+	defaultRecordingWidth  = 80
+	defaultRecordingHeight = 24
+)
+
+// asciicastHeader is the first line of an asciicast v2 recording, see https://docs.asciinema.org/manual/asciicast/v2/.
+type asciicastHeader struct {
+	Version   int               `json:"version"`
+	Width     uint16            `json:"width"`
+	Height    uint16            `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// asciicastRecorder writes the events of a terminal session in asciicast v2 format.
+type asciicastRecorder struct {
+	mu    sync.Mutex
+	w     io.Writer
+	start time.Time
+	now   func() time.Time
+	err   error
+
+	// Incomplete UTF-8 sequences at the end of the last write of each stream, as events must hold valid strings.
+	pending map[string][]byte
+}
+
+func newAsciicastRecorder(w io.Writer, header asciicastHeader, now func() time.Time) (*asciicastRecorder, error) {
+	start := now()
+	header.Version = asciicastVersion
+	header.Timestamp = start.Unix()
+	data, err := json.Marshal(header)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling recording header: %w", err)
+	}
+	if _, err := fmt.Fprintf(w, "%s\n", data); err != nil {
+		return nil, fmt.Errorf("error writing recording header: %w", err)
+	}
+	return &asciicastRecorder{
+		w:       w,
+		start:   start,
+		now:     now,
+		pending: map[string][]byte{},
+	}, nil
+}
+
+// record appends an event to the recording. Errors are kept and returned by Err, so that a failing recording does
+// not interrupt the session.
+func (r *asciicastRecorder) record(code string, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+
+	data = append(r.pending[code], data...)
+	data, r.pending[code] = splitIncompleteUTF8(data)
+	if len(data) == 0 {
+		return
+	}
+
+	elapsed := float64(r.now().Sub(r.start).Microseconds()) / float64(time.Second/time.Microsecond)
+	event, err := json.Marshal([]any{elapsed, code, string(data)})
+	if err != nil {
+		r.err = fmt.Errorf("error marshaling recording event: %w", err)
+		return
+	}
+	if _, err := fmt.Fprintf(r.w, "%s\n", event); err != nil {
+		r.err = fmt.Errorf("error writing recording event: %w", err)
+	}
+}
+
+// Err returns the first error encountered while recording.
+func (r *asciicastRecorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// splitIncompleteUTF8 splits an incomplete UTF-8 sequence at the end of p from the rest.
+func splitIncompleteUTF8(p []byte) (complete, rest []byte) {
+	for i := len(p) - 1; i >= 0 && i > len(p)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(p[i]) {
+			if !utf8.FullRune(p[i:]) {
+				return p[:i], append([]byte{}, p[i:]...)
+			}
+			break
+		}
+	}
+	return p, nil
+}
+
+// recordingWriter passes writes through to out and records them.
+type recordingWriter struct {
+	out      io.Writer
+	recorder *asciicastRecorder
+	code     string
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	n, err := w.out.Write(p)
+	w.recorder.record(w.code, p[:n])
+	return n, err //nolint:wrapcheck // transparent writer
+}
+
+// recordingReader passes reads through from in and records them.
+type recordingReader struct {
+	in       io.Reader
+	recorder *asciicastRecorder
+}
+
+func (r *recordingReader) Read(p []byte) (int, error) {
+	n, err := r.in.Read(p)
+	if n > 0 {
+		r.recorder.record(asciicastEventInput, p[:n])
+	}
+	return n, err //nolint:wrapcheck // transparent reader
+}
+
+// recordingSizeQueue records the terminal size changes sent to the shell.
+type recordingSizeQueue struct {
+	delegate remotecommand.TerminalSizeQueue
+	recorder *asciicastRecorder
+}
+
+func (q *recordingSizeQueue) Next() *remotecommand.TerminalSize {
+	size := q.delegate.Next()
+	if size != nil {
+		q.recorder.record(asciicastEventResize, []byte(fmt.Sprintf("%dx%d", size.Width, size.Height)))
+	}
+	return size
+}
+
+// recordingRemoteAttach records the streams of an attached session. The streams are wrapped here rather than in the
+// attach options, so that kubectl still detects the local terminal to set it to raw mode and track its size.
+type recordingRemoteAttach struct {
+	delegate    attach.RemoteAttach
+	recorder    *asciicastRecorder
+	recordInput bool
+}
+
+func (a *recordingRemoteAttach) Attach(u *url.URL, config *rest.Config, stdin io.Reader, stdout, stderr io.Writer, tty bool, sizeQueue remotecommand.TerminalSizeQueue) error {
+	if stdin != nil && a.recordInput {
+		stdin = &recordingReader{in: stdin, recorder: a.recorder}
+	}
+	if stdout != nil {
+		stdout = &recordingWriter{out: stdout, recorder: a.recorder, code: asciicastEventOutput}
+	}
+	if stderr != nil {
+		stderr = &recordingWriter{out: stderr, recorder: a.recorder, code: asciicastEventOutput}
+	}
+	if sizeQueue != nil {
+		sizeQueue = &recordingSizeQueue{delegate: sizeQueue, recorder: a.recorder}
+	}
+	return a.delegate.Attach(u, config, stdin, stdout, stderr, tty, sizeQueue) //nolint:wrapcheck // wrapped by the caller
+}
+
+// openRecording creates the recording file of a session.
+func openRecording(filePath, title string, size *term.TerminalSize) (*os.File, *asciicastRecorder, error) {
+	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating session recording: %w", err)
+	}
+
+	header := asciicastHeader{
+		Width:  defaultRecordingWidth,
+		Height: defaultRecordingHeight,
+		Title:  title,
+		Env: map[string]string{
+			"SHELL": "/bin/bash",
+			"TERM":  os.Getenv("TERM"),
+		},
+	}
+	if size != nil && size.Width > 0 && size.Height > 0 {
+		header.Width, header.Height = size.Width, size.Height
+	}
+
+	recorder, err := newAsciicastRecorder(f, header, time.Now)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, recorder, nil
+}
@@ -0,0 +1,109 @@
+// Copyright (c) Microsoft Corporation.
+// Licensed under the MIT license.
+
+package shell
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// fakeClock advances by a second on every call.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	t := c.now
+	c.now = c.now.Add(time.Second)
+	return t
+}
+
+// fakeRemoteAttach echoes stdin to stdout, after reading one terminal size.
+type fakeRemoteAttach struct{}
+
+func (fakeRemoteAttach) Attach(_ *url.URL, _ *rest.Config, stdin io.Reader, stdout, _ io.Writer, _ bool, sizeQueue remotecommand.TerminalSizeQueue) error {
+	sizeQueue.Next()
+	_, err := io.Copy(stdout, stdin)
+	return err //nolint:wrapcheck // test
+}
+
+type fixedSizeQueue struct{}
+
+func (fixedSizeQueue) Next() *remotecommand.TerminalSize {
+	return &remotecommand.TerminalSize{Width: 120, Height: 40}
+}
+
+func recordingLines(t *testing.T, recording string) []string {
+	t.Helper()
+	lines := strings.Split(strings.TrimSpace(recording), "\n")
+	for _, line := range lines {
+		require.True(t, json.Valid([]byte(line)), "invalid recording line %q", line)
+	}
+	return lines
+}
+
+func TestAsciicastRecorder(t *testing.T) {
+	var buf bytes.Buffer
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	recorder, err := newAsciicastRecorder(&buf, asciicastHeader{Width: 100, Height: 30, Title: "retina shell node/node0001"}, clock.Now)
+	require.NoError(t, err)
+
+	attach := &recordingRemoteAttach{delegate: fakeRemoteAttach{}, recorder: recorder, recordInput: true}
+	var out bytes.Buffer
+	err = attach.Attach(nil, nil, strings.NewReader("ls\r\n"), &out, nil, true, fixedSizeQueue{})
+	require.NoError(t, err)
+	require.NoError(t, recorder.Err())
+	assert.Equal(t, "ls\r\n", out.String(), "output should be passed through")
+
+	assert.Equal(t, []string{
+		`{"version":2,"width":100,"height":30,"timestamp":1700000000,"title":"retina shell node/node0001"}`,
+		`[1,"r","120x40"]`,
+		`[2,"i","ls\r\n"]`,
+		`[3,"o","ls\r\n"]`,
+	}, recordingLines(t, buf.String()))
+}
+
+func TestAsciicastRecorderWithoutInput(t *testing.T) {
+	var buf bytes.Buffer
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	recorder, err := newAsciicastRecorder(&buf, asciicastHeader{Width: 80, Height: 24}, clock.Now)
+	require.NoError(t, err)
+
+	attach := &recordingRemoteAttach{delegate: fakeRemoteAttach{}, recorder: recorder}
+	err = attach.Attach(nil, nil, strings.NewReader("secret\r\n"), io.Discard, nil, true, fixedSizeQueue{})
+	require.NoError(t, err)
+
+	for _, line := range recordingLines(t, buf.String()) {
+		assert.NotContains(t, line, `"i"`)
+	}
+}
+
+func TestAsciicastRecorderSplitsIncompleteUTF8(t *testing.T) {
+	var buf bytes.Buffer
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	recorder, err := newAsciicastRecorder(&buf, asciicastHeader{Width: 80, Height: 24}, clock.Now)
+	require.NoError(t, err)
+
+	check := []byte("✓")
+	w := &recordingWriter{out: io.Discard, recorder: recorder, code: asciicastEventOutput}
+	_, err = w.Write(append([]byte("ok "), check[:1]...))
+	require.NoError(t, err)
+	_, err = w.Write(check[1:])
+	require.NoError(t, err)
+
+	lines := recordingLines(t, buf.String())
+	require.Len(t, lines, 3)
+	assert.Equal(t, `[1,"o","ok "]`, lines[1])
+	assert.Equal(t, `[2,"o","✓"]`, lines[2])
+}
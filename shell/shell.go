@@ -25,6 +25,17 @@ type Config struct {
 
 	AppArmorUnconfined bool
 	SeccompUnconfined  bool
+
+	// Mounts apply only to nodes, not pods.
+	Mounts []Mount
+
+	// StartupScript is run by the interactive shell once it is attached, before the first prompt.
+	StartupScript string
+
+	// RecordPath is the file to record the session to in asciicast v2 format. Empty disables recording.
+	RecordPath string
+	// RecordInput adds the keystrokes sent to the shell to the recording.
+	RecordInput bool
 }
 
 // RunInPod starts an interactive shell in a pod by creating and attaching to an ephemeral container.
@@ -63,7 +74,8 @@ func RunInPod(config Config, podNamespace, podName string) error {
 		return fmt.Errorf("error waiting for containers running: %w", err)
 	}
 
-	return attachToShell(config.RestConfig, podNamespace, podName, ephemeralContainer.Name, pod)
+	title := fmt.Sprintf("retina shell pod/%s -n %s", podName, podNamespace)
+	return attachToShell(config, podNamespace, podName, ephemeralContainer.Name, pod, title)
 }
 
 // RunInNode starts an interactive shell on a node by creating a HostNetwork pod and attaching to it.
@@ -105,5 +117,6 @@ func RunInNode(config Config, nodeName, debugPodNamespace string) error {
 		return err
 	}
 
-	return attachToShell(config.RestConfig, debugPodNamespace, pod.Name, pod.Spec.Containers[0].Name, pod)
+	title := "retina shell node/" + nodeName
+	return attachToShell(config, debugPodNamespace, pod.Name, pod.Spec.Containers[0].Name, pod, title)
 }
@@ -44,6 +44,22 @@ type TraceConfig struct {
 	// Timing configuration
 	TraceDuration time.Duration // How long to trace (0 = until Ctrl-C)
 	Timeout       time.Duration // Pod startup timeout
+
+	// Output streams (nil defaults to os.Stdout and os.Stderr)
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// outputStreams returns the configured stdout and stderr writers, defaulting to the process streams.
+func (c TraceConfig) outputStreams() (stdout, stderr io.Writer) {
+	stdout, stderr = c.Stdout, c.Stderr
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+	return stdout, stderr
 }
 
 // TraceCapabilities returns the required Linux capabilities for bpftrace.
@@ -69,6 +85,8 @@ func RunTrace(ctx context.Context, config TraceConfig, nodeName, debugPodNamespa
 		return fmt.Errorf("error constructing kube clientset: %w", err)
 	}
 
+	stdout, stderr := config.outputStreams()
+
 	// Validate node OS
 	err = validateOperatingSystemSupportedForNode(ctx, clientset, nodeName)
 	if err != nil {
@@ -78,7 +96,7 @@ func RunTrace(ctx context.Context, config TraceConfig, nodeName, debugPodNamespa
 	// Create the trace pod
 	pod := hostNetworkPodForTrace(config, debugPodNamespace, nodeName)
 
-	fmt.Printf("Creating trace pod %s/%s on node %s\n", debugPodNamespace, pod.Name, nodeName)
+	fmt.Fprintf(stdout, "Creating trace pod %s/%s on node %s\n", debugPodNamespace, pod.Name, nodeName)
 	createdPod, err := clientset.CoreV1().
 		Pods(debugPodNamespace).
 		Create(ctx, pod, metav1.CreateOptions{})
@@ -89,13 +107,13 @@ func RunTrace(ctx context.Context, config TraceConfig, nodeName, debugPodNamespa
 	// Ensure cleanup on exit (Ctrl-C, error, or normal termination)
 	// Note: intentionally using context.Background() for cleanup so it runs even if ctx is canceled
 	defer func() { //nolint:contextcheck // cleanup must run regardless of parent context state
-		fmt.Printf("Cleaning up trace pod %s/%s\n", debugPodNamespace, createdPod.Name)
+		fmt.Fprintf(stdout, "Cleaning up trace pod %s/%s\n", debugPodNamespace, createdPod.Name)
 		deleteCtx := context.Background() // Use fresh context for cleanup
 		deleteErr := clientset.CoreV1().
 			Pods(debugPodNamespace).
 			Delete(deleteCtx, createdPod.Name, metav1.DeleteOptions{})
 		if deleteErr != nil {
-			fmt.Fprintf(os.Stderr, "warning: failed to delete trace pod %s: %v\n", createdPod.Name, deleteErr)
+			fmt.Fprintf(stderr, "warning: failed to delete trace pod %s: %v\n", createdPod.Name, deleteErr)
 		}
 	}()
 
@@ -105,20 +123,20 @@ func RunTrace(ctx context.Context, config TraceConfig, nodeName, debugPodNamespa
 		return fmt.Errorf("error waiting for trace pod to start: %w", err)
 	}
 
-	fmt.Printf("Trace pod ready, starting trace...\n")
+	fmt.Fprintf(stdout, "Trace pod ready, starting trace...\n")
 
 	// First, fetch and display reason/state codes from kernel
 	// These are kernel-version specific so we read them at runtime
-	fmt.Printf("\n")
+	fmt.Fprintf(stdout, "\n")
 
 	// Display SKB drop reason codes (for DROP events)
 	dropReasonsCommand := DropReasonsCommand()
-	err = execInPod(ctx, config.RestConfig, clientset, debugPodNamespace, createdPod.Name, createdPod.Spec.Containers[0].Name, dropReasonsCommand, os.Stdout, os.Stderr)
+	err = execInPod(ctx, config.RestConfig, clientset, debugPodNamespace, createdPod.Name, createdPod.Spec.Containers[0].Name, dropReasonsCommand, stdout, stderr)
 	if err != nil {
 		// Non-fatal: continue even if we can't get reason codes
-		fmt.Fprintf(os.Stderr, "warning: could not fetch drop reason codes: %v\n", err)
+		fmt.Fprintf(stderr, "warning: could not fetch drop reason codes: %v\n", err)
 	}
-	fmt.Printf("\n")
+	fmt.Fprintf(stdout, "\n")
 
 	// Generate and run the bpftrace script
 	gen := NewScriptGenerator(config)
@@ -128,11 +146,11 @@ func RunTrace(ctx context.Context, config TraceConfig, nodeName, debugPodNamespa
 	// SECURITY: The script is passed via -e flag, not interpolated into a shell command
 	bpftraceCommand := []string{"bpftrace", "-e", script}
 
-	err = execInPod(ctx, config.RestConfig, clientset, debugPodNamespace, createdPod.Name, createdPod.Spec.Containers[0].Name, bpftraceCommand, os.Stdout, os.Stderr)
+	err = execInPod(ctx, config.RestConfig, clientset, debugPodNamespace, createdPod.Name, createdPod.Spec.Containers[0].Name, bpftraceCommand, stdout, stderr)
 	if err != nil {
 		// If duration was specified and context was cancelled, it's expected behavior
 		if config.TraceDuration > 0 && ctx.Err() != nil {
-			fmt.Printf("\nTrace completed after %s\n", config.TraceDuration)
+			fmt.Fprintf(stdout, "\nTrace completed after %s\n", config.TraceDuration)
 			return nil
 		}
 		return fmt.Errorf("error executing trace command: %w", err)